@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/bootstrap"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/git"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+)
+
+// shouldBootstrap tells if the indexing run should first import the index published by the CI, only on the first
+// run of the repository, nothing being indexed yet
+func shouldBootstrap(cfg *config.Config, indexManifest *manifest.Manifest) bool {
+	return cfg.Bootstrap.URL != "" && !noBootstrap && !metadataOnly && len(indexManifest.Paths()) == 0
+}
+
+// bootstrapIndex imports the index published by the CI for the most recent commit having one, and records its files
+// as indexed, except the ones changed locally since the commit which are left to the indexing run, nothing is
+// imported if the index cannot be downloaded
+func bootstrapIndex(
+	ctx context.Context,
+	cfg *config.Config,
+	root string,
+	vectorStore store.VectorStore,
+	indexManifest *manifest.Manifest,
+) error {
+	logger := zerolog.Ctx(ctx)
+	commits, err := git.Commits(ctx, root, cfg.Bootstrap.Depth)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Cannot list the commits of the repository, indexing it without bootstrap")
+		return nil
+	}
+	start := time.Now()
+	fetcher := bootstrap.NewFetcher(cfg.Bootstrap.URL, os.ExpandEnv(cfg.Bootstrap.Token))
+	artifact, err := fetcher.Open(ctx, commits)
+	if errors.Is(err, bootstrap.ErrNotFound) {
+		logger.Info().Int("commits", len(commits)).Msg("No index published for the last commits, indexing the whole repository")
+		return nil
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msg("Cannot download the published index, indexing the whole repository")
+		return nil
+	}
+	defer func() {
+		_ = artifact.Close()
+	}()
+	changed, err := git.ChangedFiles(ctx, root, artifact.Commit)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().Str("commit", artifact.Commit).Str("location", artifact.Location).Msg("Importing the published index")
+	importer := &importer{
+		ctx:         ctx,
+		cfg:         cfg,
+		vectorStore: vectorStore,
+		dir:         root,
+		files:       make(map[string][]string),
+		chunks:      make(map[string][]manifest.ChunkStats),
+	}
+	defer importer.close()
+	if err := importer.importRecords(artifact); err != nil {
+		return fmt.Errorf("failed to import the index of %s from %s (index without it with --no-bootstrap): %w",
+			artifact.Commit, artifact.Location, err)
+	}
+	marked, err := importer.markIndexed(indexManifest, changed)
+	if err != nil {
+		return err
+	}
+	if err := indexManifest.Save(); err != nil {
+		return err
+	}
+	logger.Info().
+		Str("commit", artifact.Commit).
+		Int("chunks", importer.imported).
+		Int("embedded", importer.embedded).
+		Int("files", marked).
+		Int("changedFiles", len(changed)).
+		Str("elapsed", fmt.Sprintf("%dms", time.Since(start).Milliseconds())).
+		Msg("Index bootstrapped, indexing the local changes")
+	return nil
+}
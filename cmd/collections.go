@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var collectionDimensions int
+
+var collectionsCmd = &cobra.Command{
+	Use:   "collections",
+	Short: "Manage the collections of the store",
+	Long: `Manage the collections of the store, a collection can then be used explicitly with --collection, e.g. to keep
+the main branch and a long-lived feature branch apart`,
+	Example: `  mm collections create feature-x
+  mm --collection feature-x --index .
+  mm --collection feature-x "token validation"
+  mm collections drop feature-x`,
+}
+
+var collectionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the collections",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCollectionManager(cmd.Context(), func(manager store.CollectionManager, _ *config.Config) error {
+			names, err := manager.Collections()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return nil
+		})
+	},
+}
+
+var collectionsCreateCmd = &cobra.Command{
+	Use:   "create name",
+	Short: "Create an empty collection",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateCollectionName(name); err != nil {
+			return err
+		}
+		return withCollectionManager(cmd.Context(), func(manager store.CollectionManager, _ *config.Config) error {
+			if err := manager.CreateCollection(name, collectionDimensions); err != nil {
+				return err
+			}
+			fmt.Printf("created collection %s\n", name)
+			return nil
+		})
+	},
+}
+
+var collectionsDropCmd = &cobra.Command{
+	Use:   "drop name",
+	Short: "Delete a collection, with all its chunks",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateCollectionName(name); err != nil {
+			return err
+		}
+		return withCollectionManager(cmd.Context(), func(manager store.CollectionManager, cfg *config.Config) error {
+			if err := manager.DropCollection(name); err != nil {
+				return err
+			}
+			path := manifestPath(cfg.ForCollection(name))
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to remove manifest %s: %w", path, err)
+			}
+			fmt.Printf("dropped collection %s\n", name)
+			return nil
+		})
+	},
+}
+
+// withCollectionManager opens the collection manager of the configured backend, the configuration is not scoped to
+// a collection
+func withCollectionManager(ctx context.Context, action func(manager store.CollectionManager, cfg *config.Config) error) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	if cfg.Store.Backend == config.LocalBackend {
+		path := os.ExpandEnv(cfg.Store.Path)
+		var manager store.CollectionManager = store.NewLocalCollections(os.ExpandEnv(cfg.Store.CollectionsDir()), filepath.Base(path))
+		if readOnly || !store.Writable(os.ExpandEnv(cfg.Store.CollectionsDir())) {
+			manager = store.NewReadOnlyCollections(manager)
+		}
+		return action(manager, cfg)
+	}
+
+	vectorStore, err := openStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = vectorStore.Close()
+	}()
+	manager, ok := vectorStore.(store.CollectionManager)
+	if !ok {
+		return fmt.Errorf("store backend %s cannot manage collections", cfg.Store.Backend)
+	}
+	return action(manager, cfg)
+}
+
+func init() {
+	collectionsCreateCmd.Flags().IntVar(
+		&collectionDimensions,
+		"dimensions",
+		embedding.DefaultDimensions,
+		"Dimensions of the embeddings of the collection, only needed by qdrant",
+	)
+
+	collectionsCmd.AddCommand(collectionsListCmd, collectionsCreateCmd, collectionsDropCmd)
+	mmCmd.AddCommand(collectionsCmd)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/container"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// containerAddress listens on all the interfaces, the port is published by the container runtime
+	containerAddress = ":7700"
+	// defaultDrainDelay leaves time to the load balancers to stop sending requests, before the server stops
+	defaultDrainDelay = 5 * time.Second
+)
+
+var (
+	containerServeAddress string
+	containerDrainDelay   time.Duration
+)
+
+var containerCmd = &cobra.Command{
+	Use:   "container",
+	Short: "Serve the search as the entrypoint of a container",
+	Long: `Serve the search with the defaults of a container: the working directory is the /data volume (unless
+--working-dir or MM_WORKING_DIR is set), the configuration is read from it, the MM_* variables of the environment
+override the configuration, and the server listens on all the interfaces. Besides /healthz, /livez answers as long as
+the server runs, and /readyz answers 503 for --drain-delay once the container is stopped, before the server stops.
+As the init process (PID 1), mm forwards the signals to a child mm and reaps the orphaned processes.`,
+	Example: `  docker run -v mm-data:/data -e MM_STORE_SCOPE=global -p 7700:7700 mm container`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if handled, code, err := container.RunAsInit(); handled {
+			if err != nil {
+				return err
+			}
+			os.Exit(code)
+		}
+		if tenant != "" {
+			return fmt.Errorf("--tenant cannot be used with container, all the tenants are served")
+		}
+		if !container.Detected() {
+			log.Warn().Msg("not running in a container, using the container defaults anyway")
+		}
+
+		if !mmCmd.PersistentFlags().Changed("working-dir") && os.Getenv(workingDirVariable) == "" {
+			workingDir = container.DataDirectory
+		}
+		if !mmCmd.PersistentFlags().Changed("config") {
+			configPath = filepath.Join(workingDirectory(), "config.yaml")
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		address := containerAddress
+		switch {
+		case cmd.Flags().Changed("address"):
+			address = containerServeAddress
+		case cfg.Serve.Address != config.Default().Serve.Address:
+			// set by the configuration or MM_SERVE_ADDRESS
+			address = cfg.Serve.Address
+		}
+		return runServe(cmd.Context(), cfg, address, containerDrainDelay)
+	},
+}
+
+func init() {
+	containerCmd.Flags().StringVar(
+		&containerServeAddress,
+		"address",
+		containerAddress,
+		"Address to listen on, overrides the serve address of the configuration and MM_SERVE_ADDRESS",
+	)
+	containerCmd.Flags().DurationVar(
+		&containerDrainDelay,
+		"drain-delay",
+		defaultDrainDelay,
+		"How long /readyz fails before the server stops, once the container is stopped",
+	)
+
+	mmCmd.AddCommand(containerCmd)
+}
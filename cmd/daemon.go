@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Manage the indexer daemon of the working directory",
+	Long: `Manage the indexer daemon of the working directory, a python indexer left running in the background with its
+model loaded, the next mm processes connect to its socket instead of starting their own indexer`,
+	Example: `  mm daemon start
+  mm --index .
+  mm daemon status
+  mm daemon stop`,
+}
+
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the indexer daemon, loading the model of the configuration",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Indexer.Address != "" {
+			return fmt.Errorf("the configuration connects to the indexer at %s, no daemon is needed", cfg.Indexer.Address)
+		}
+		daemon, err := embedding.StartDaemon(cmd.Context(), indexerOptions(cfg)...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("started indexer daemon (pid %d, model %s) on %s\n", daemon.Pid, daemon.Model, daemon.Address)
+		return nil
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the indexer daemon",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		daemon, err := embedding.StopDaemon(workingDirectory())
+		if errors.Is(err, embedding.ErrNoDaemon) {
+			fmt.Println("no indexer daemon running")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("stopped indexer daemon (pid %d)\n", daemon.Pid)
+		return nil
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the indexer daemon, if running",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		daemon, err := embedding.FindDaemon(workingDirectory())
+		if errors.Is(err, embedding.ErrNoDaemon) {
+			fmt.Println("no indexer daemon running")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("pid:     %d\n", daemon.Pid)
+		fmt.Printf("address: %s\n", daemon.Address)
+		fmt.Printf("model:   %s\n", daemon.Model)
+		fmt.Printf("uptime:  %s\n", time.Since(daemon.StartedAt).Round(time.Second))
+		if daemon.LibVersion != embedding.LibVersion() {
+			fmt.Println("the daemon runs the scripts of another version of mm and is not used, restart it")
+		}
+		return nil
+	},
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonStartCmd, daemonStopCmd, daemonStatusCmd)
+	mmCmd.AddCommand(daemonCmd)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	editDryRun bool
+	retagSet   []string
+	retagUnset []string
+)
+
+const selectorHelp = `The selector is made of key:value terms matching the metadata of the chunks, all the terms have to match,
+and alternatives are separated by OR. The path key matches the file path against a glob (relative globs match
+anywhere in the path).`
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete selector...",
+	Short: "Delete the chunks matching a selector",
+	Long: `Delete the chunks matching a selector, without indexing again. The files of the deleted chunks stay in the
+manifest, so they are not indexed again until they change.
+` + selectorHelp,
+	Example: `  mm delete 'path:vendor/** OR is_generated:true'
+  mm delete language:javascript path:dist --dry-run`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selector, err := store.ParseSelector(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+
+		return withEditableStore(cmd, func(editable store.InspectableStore, indexManifest *manifest.Manifest) error {
+			if editDryRun {
+				selected, err := store.Select(editable, selector)
+				if err != nil {
+					return err
+				}
+				printRecords("would delete", selected)
+				return nil
+			}
+
+			deleted, err := store.DeleteWhere(editable, selector)
+			if err != nil {
+				return err
+			}
+			ids := make([]string, len(deleted))
+			for i, record := range deleted {
+				ids[i] = record.Id
+			}
+			indexManifest.RemoveChunks(ids)
+			printRecords("deleted", deleted)
+			return indexManifest.Save()
+		})
+	},
+}
+
+var retagCmd = &cobra.Command{
+	Use:   "retag selector... [--set key=value...] [--unset key...]",
+	Short: "Change the metadata of the chunks matching a selector",
+	Long: `Set or remove metadata of the chunks matching a selector, without embedding them again.
+` + selectorHelp,
+	Example: `  mm retag path:internal/payments --set owner=payments
+  mm retag is_generated:true --unset is_generated --dry-run`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(retagSet) == 0 && len(retagUnset) == 0 {
+			return fmt.Errorf("either --set or --unset is required")
+		}
+		selector, err := store.ParseSelector(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		set := make(map[string]any, len(retagSet))
+		for _, assignment := range retagSet {
+			key, value, found := strings.Cut(assignment, "=")
+			if !found || key == "" {
+				return fmt.Errorf("invalid --set %s, expected key=value", assignment)
+			}
+			set[key] = store.ParseMetadataValue(value)
+		}
+
+		return withEditableStore(cmd, func(editable store.InspectableStore, _ *manifest.Manifest) error {
+			if editDryRun {
+				selected, err := store.Select(editable, selector)
+				if err != nil {
+					return err
+				}
+				printRecords("would update", selected)
+				return nil
+			}
+
+			updated, err := store.RetagWhere(editable, selector, set, retagUnset)
+			if err != nil {
+				return err
+			}
+			printRecords("updated", updated)
+			return nil
+		})
+	},
+}
+
+// withEditableStore opens the configured store and its manifest, for the commands editing records in bulk
+func withEditableStore(cmd *cobra.Command, action func(editable store.InspectableStore, indexManifest *manifest.Manifest) error) error {
+	return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+		editable, ok := vectorStore.(store.InspectableStore)
+		if !ok {
+			return fmt.Errorf("store backend %s cannot be edited", cfg.Store.Backend)
+		}
+		indexManifest, err := manifest.Load(manifestPath(cfg))
+		if err != nil {
+			return err
+		}
+		return action(editable, indexManifest)
+	})
+}
+
+func printRecords(action string, records []store.Record) {
+	for _, record := range records {
+		filePath, _ := record.Metadata["file_path"].(string)
+		fmt.Printf("%s %s (%s)\n", action, record.Id, filePath)
+	}
+	fmt.Printf("%s %d chunk(s)\n", action, len(records))
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{deleteCmd, retagCmd} {
+		cmd.Flags().BoolVar(
+			&editDryRun,
+			"dry-run",
+			false,
+			"Only show the chunks which would be changed",
+		)
+	}
+	retagCmd.Flags().StringArrayVar(
+		&retagSet,
+		"set",
+		nil,
+		"Set the metadata key to the value (booleans and numbers are converted), can be repeated",
+	)
+	retagCmd.Flags().StringArrayVar(
+		&retagUnset,
+		"unset",
+		nil,
+		"Remove the metadata key, can be repeated",
+	)
+
+	mmCmd.AddCommand(deleteCmd, retagCmd)
+}
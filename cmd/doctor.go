@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/doctor"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment of the python indexer",
+	Long: `Check the environment of the python indexer: a writable working directory, uv, a python version supported by
+the scripts, the resolution of their dependencies, the gpu computing the embeddings, and the integrity of the local
+chroma data. A fix is suggested for each check which did not pass, the first installation of the dependencies can
+take a few minutes.`,
+	Example: `  mm doctor
+  mm --working-dir /data/mm doctor`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		wd := workingDirectory()
+		env := doctor.Environment{
+			WorkingDirectory: wd,
+			LibDirectory:     embedding.LibPath(wd),
+			RequiredPython:   embedding.RequiredPython(),
+			Prepare: func(ctx context.Context) error {
+				return embedding.PrepareWorkingDirectory(ctx, wd, chromaPath())
+			},
+		}
+		if cfg.Store.Backend == config.ChromaBackend && !cfg.Store.Chroma.Remote() {
+			env.CheckChroma = func(ctx context.Context) ([]string, error) {
+				return checkChromaData(ctx, cfg)
+			}
+		}
+
+		results := doctor.Diagnose(cmd.Context(), env)
+		for _, result := range results {
+			fmt.Printf("%-8s %-18s %s\n", result.Status, result.Name, result.Detail)
+			if result.Fix != "" {
+				fmt.Printf("%-8s %-18s fix: %s\n", "", "", result.Fix)
+			}
+		}
+		if failures := doctor.Failures(results); failures > 0 {
+			return fmt.Errorf("%d check(s) failed", failures)
+		}
+		return nil
+	},
+}
+
+// checkChromaData looks for corruptions of the local chroma data, without repairing them
+func checkChromaData(ctx context.Context, cfg *config.Config) ([]string, error) {
+	logger := zerolog.Ctx(ctx).With().Str("process", "python store").Logger()
+	indexer, err := runIndexer(ctx, logger, indexerOptions(cfg, embedding.WithStoreOnly(), embedding.WithCollection(cfg.Store.Chroma.Collection))...)
+	if err != nil {
+		return nil, err
+	}
+	chroma := store.NewChroma(indexer)
+	defer func() {
+		_ = chroma.Close()
+	}()
+	if err := indexer.WaitReady(); err != nil {
+		return nil, err
+	}
+	return chroma.Check()
+}
+
+func init() {
+	mmCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/git"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/throttle"
+	"github.com/rs/zerolog"
+)
+
+// estimateSample is the number of chunks embedded by a local provider to measure its throughput
+const estimateSample = 32
+
+type (
+	// indexEstimate sums what an indexing run would embed
+	indexEstimate struct {
+		files     int
+		unchanged int
+		chunks    int
+		// cached are the chunks whose embedding is found in the embedding cache, not embedded again
+		cached int
+		tokens int64
+		// counted is set when the tokens are counted by the tokenizer of the model, they are estimated from the length
+		// of the texts otherwise
+		counted  bool
+		requests int
+		sample   []code.Chunk
+	}
+
+	// hostedEstimator estimates the tokens billed by a hosted provider, and its requests
+	hostedEstimator interface {
+		Estimate(chunks []code.Chunk) (tokens int, requests int)
+	}
+)
+
+// estimateIndex parses the files an indexing run would index, and prints the tokens of the chunks it would embed,
+// with the cost and the time of embedding them, without embedding them, nor modifying the index
+func estimateIndex(ctx context.Context, cfg *config.Config, paths []string, pathspecs []string) error {
+	logger := zerolog.Ctx(ctx)
+
+	provider, err := newProvider(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = provider.Close()
+	}()
+	estimate, err := estimateChunks(ctx, cfg, provider, paths, pathspecs)
+	if err != nil {
+		return err
+	}
+
+	hosted, isHosted := hostedConfig(cfg)
+	var throughput time.Duration
+	if !isHosted && len(estimate.sample) > 0 {
+		if throughput, err = measureThroughput(provider, estimate.sample); err != nil {
+			return err
+		}
+	}
+	logger.Debug().
+		Int("files", estimate.files).
+		Int("chunks", estimate.chunks).
+		Int64("tokens", estimate.tokens).
+		Msg("Indexing estimated")
+	printEstimate(cfg, embeddingModel(cfg), estimate, hosted, isHosted, throughput)
+	return nil
+}
+
+// estimateChunks parses the files an indexing run would index, and sums the chunks it would embed and their tokens,
+// counted by the provider when it can
+func estimateChunks(
+	ctx context.Context,
+	cfg *config.Config,
+	provider embedding.EmbeddingProvider,
+	paths []string,
+	pathspecs []string,
+) (indexEstimate, error) {
+	root, err := git.Root(ctx, paths[0])
+	if err != nil {
+		return indexEstimate{}, err
+	}
+	paths, roots, err := code.RootNames(root, paths)
+	if err != nil {
+		return indexEstimate{}, err
+	}
+	indexManifest, err := manifest.Load(manifestPath(cfg))
+	if err != nil {
+		return indexEstimate{}, err
+	}
+	// only read, the chunks found in it are not marked as used
+	cache, err := openEmbeddingCache(cfg)
+	if err != nil {
+		return indexEstimate{}, err
+	}
+	counter, counted := provider.(embedding.TokenCounter)
+	if counted {
+		// the tokenizer is the one of the model loaded by the python indexer
+		if err := provider.WaitReady(); err != nil {
+			return indexEstimate{}, err
+		}
+	}
+
+	model := embeddingModel(cfg)
+	estimate := indexEstimate{counted: counted}
+	parserLimiter := newParserLimiter(cfg)
+	enrichers := buildEnrichers(root, roots)
+	for _, path := range paths {
+		var selected map[string]bool
+		if len(pathspecs) > 0 {
+			if selected, err = git.ListFiles(ctx, path, pathspecs); err != nil {
+				return indexEstimate{}, err
+			}
+		}
+		err = code.FindInDirectory(
+			path,
+			code.NewGenericParser().Extensions(),
+			func(filePath string) error {
+				absPath, err := filepath.Abs(filePath)
+				if err != nil {
+					return fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+				}
+				if selected != nil && !selected[absPath] {
+					return nil
+				}
+				chunks, unchanged, err := estimatedChunks(ctx, parserLimiter, enrichers, indexManifest, filePath, absPath)
+				if err != nil {
+					return err
+				}
+				estimate.files++
+				if unchanged {
+					estimate.unchanged++
+					return nil
+				}
+				var embedded []code.Chunk
+				for _, chunk := range chunks {
+					if cache != nil && cache.Contains(model, chunk) {
+						estimate.cached++
+						continue
+					}
+					embedded = append(embedded, chunk)
+				}
+				return estimate.add(counter, provider, model, embedded)
+			},
+		)
+		if err != nil {
+			return indexEstimate{}, fmt.Errorf("failed to find files in directory %s: %w", path, err)
+		}
+	}
+	return estimate, nil
+}
+
+// estimatedChunks returns the chunks of the file an indexing run would embed, parsed and enriched the same way, or
+// whether the run would skip the file as unchanged
+func estimatedChunks(
+	ctx context.Context,
+	parserLimiter *throttle.ParserLimiter,
+	enrichers []code.Enricher,
+	indexManifest *manifest.Manifest,
+	filePath string,
+	absPath string,
+) ([]code.Chunk, bool, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+	previous, indexed := indexManifest.Get(absPath)
+	indexed = indexed && !fullIndex
+	if indexed && previous.Size == info.Size() && previous.ModifiedAt == info.ModTime().UnixNano() {
+		return nil, true, nil
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	hash := manifest.Hash(content)
+	if indexed && previous.Hash == hash {
+		return nil, true, nil
+	}
+	if indexManifest.Quarantined(absPath, hash) {
+		return nil, false, nil
+	}
+	parser := code.NewGenericParser(code.WithSmallFileThreshold(smallFile))
+	chunks, err := parseSafely(ctx, parserLimiter, parser, filePath, content, parseTimeout)
+	if errors.Is(err, errParserCrashed) {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("path", filePath).Msg("Parser crashed, skipping file")
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	if err := code.Enrich(ctx, filePath, chunks, enrichers...); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("path", filePath).Msg("failed to enrich chunks, estimating them as is")
+	}
+	return chunks, false, nil
+}
+
+// add counts the tokens of the chunks of a file, the hosted providers embedding the chunks of each file in their own
+// requests
+func (e *indexEstimate) add(counter embedding.TokenCounter, provider embedding.EmbeddingProvider, model string, chunks []code.Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	e.chunks += len(chunks)
+	if len(e.sample) < estimateSample {
+		e.sample = append(e.sample, chunks[:min(len(chunks), estimateSample-len(e.sample))]...)
+	}
+	if hosted, ok := provider.(hostedEstimator); ok {
+		tokens, requests := hosted.Estimate(chunks)
+		e.tokens += int64(tokens)
+		e.requests += requests
+		return nil
+	}
+	if counter == nil {
+		for _, chunk := range chunks {
+			e.tokens += int64(embedding.EstimateTokens(model, chunk))
+		}
+		return nil
+	}
+	tokens, err := counter.CountTokens(chunks)
+	if err != nil {
+		return err
+	}
+	for _, count := range tokens {
+		e.tokens += int64(count)
+	}
+	return nil
+}
+
+// measureThroughput embeds the sample with the local provider, returns the time spent per chunk
+func measureThroughput(provider embedding.EmbeddingProvider, sample []code.Chunk) (time.Duration, error) {
+	if err := provider.WaitReady(); err != nil {
+		return 0, err
+	}
+	// the first batch warms the model up
+	if _, err := provider.EmbedDocuments(sample[:1]); err != nil {
+		return 0, fmt.Errorf("failed to embed the sample: %w", err)
+	}
+	start := time.Now()
+	if _, err := provider.EmbedDocuments(sample); err != nil {
+		return 0, fmt.Errorf("failed to embed the sample: %w", err)
+	}
+	return time.Since(start) / time.Duration(len(sample)), nil
+}
+
+// hostedConfig returns the configuration of the hosted provider of the embedder, false for the local providers
+func hostedConfig(cfg *config.Config) (config.HostedConfig, bool) {
+	switch cfg.Indexer.Embedder {
+	case config.OpenAIEmbedder:
+		return cfg.Indexer.OpenAI, true
+	case config.VoyageEmbedder:
+		return cfg.Indexer.Voyage, true
+	case config.CohereEmbedder:
+		return cfg.Indexer.Cohere, true
+	}
+	return config.HostedConfig{}, false
+}
+
+// estimateCost returns the cost of embedding the tokens with the hosted provider, at the configured price, or the known
+// one of the model
+func estimateCost(cfg *config.Config, model string, tokens int64, hosted config.HostedConfig) string {
+	price, known := hosted.PricePerMillionTokens, hosted.PricePerMillionTokens > 0
+	if !known {
+		price, known = embedding.PricePerMillionTokens(model)
+	}
+	if !known {
+		return fmt.Sprintf("unknown, set price_per_million_tokens of the %s embedder", cfg.Indexer.Embedder)
+	}
+	return fmt.Sprintf("$%.4f (at $%g per million tokens)", float64(tokens)*price/1_000_000, price)
+}
+
+// printEstimate writes the estimate as text
+func printEstimate(
+	cfg *config.Config,
+	model string,
+	estimate indexEstimate,
+	hosted config.HostedConfig,
+	isHosted bool,
+	throughput time.Duration,
+) {
+	tokens := "estimated from the length of the texts"
+	if estimate.counted {
+		tokens = "counted with the tokenizer of the model"
+	}
+	fmt.Printf("model:     %s\n", model)
+	fmt.Printf("files:     %d (%d unchanged, skipped)\n", estimate.files, estimate.unchanged)
+	fmt.Printf("chunks:    %d to embed (%d found in the embedding cache)\n", estimate.chunks, estimate.cached)
+	fmt.Printf("tokens:    %d (%s)\n", estimate.tokens, tokens)
+
+	if !isHosted {
+		fmt.Println("cost:      free, the model runs locally")
+		if estimate.chunks == 0 {
+			fmt.Println("time:      none")
+			return
+		}
+		elapsed := throughput * time.Duration(estimate.chunks)
+		fmt.Printf(
+			"time:      about %s (%s per chunk, measured on %d chunk(s))\n",
+			elapsed.Round(time.Second),
+			throughput.Round(time.Microsecond),
+			len(estimate.sample),
+		)
+		return
+	}
+
+	fmt.Printf("requests:  %d\n", estimate.requests)
+	fmt.Printf("cost:      %s\n", estimateCost(cfg, model, estimate.tokens, hosted))
+
+	var minutes float64
+	if hosted.TokensPerMinute > 0 {
+		minutes = max(minutes, float64(estimate.tokens)/float64(hosted.TokensPerMinute))
+	}
+	if hosted.RequestsPerMinute > 0 {
+		minutes = max(minutes, float64(estimate.requests)/float64(hosted.RequestsPerMinute))
+	}
+	if hosted.TokensPerMinute == 0 && hosted.RequestsPerMinute == 0 {
+		fmt.Printf("time:      unknown, set requests_per_minute and tokens_per_minute of the %s embedder\n", cfg.Indexer.Embedder)
+		return
+	}
+	elapsed := time.Duration(minutes * float64(time.Minute))
+	fmt.Printf("time:      at least %s (paced by the rate limits)\n", elapsed.Round(time.Second))
+}
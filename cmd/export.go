@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportOut        string
+	exportEmbeddings bool
+)
+
+// exportedRecord is a line of the export, the embedding is only written with --embeddings, with the model computing
+// it, its dimensions being its length
+type exportedRecord struct {
+	Id        string         `json:"id"`
+	Document  string         `json:"document"`
+	Metadata  map[string]any `json:"metadata"`
+	Embedding []float32      `json:"embedding,omitempty"`
+	Model     string         `json:"model,omitempty"`
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the chunks of the index to JSONL",
+	Long: `Export all the chunks of the index, one JSON object per line sorted by id, with their metadata and optionally
+their embeddings, so the index can be inspected, diffed, or loaded into another system`,
+	Example: `  mm export --out index.jsonl
+  mm export --embeddings | jq -r .metadata.file_path | sort -u`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			inspector, ok := vectorStore.(store.Inspector)
+			if !ok {
+				return fmt.Errorf("store backend %s cannot be inspected", cfg.Store.Backend)
+			}
+			model, err := exportedModel(vectorStore, cfg)
+			if err != nil {
+				return err
+			}
+			records, err := inspector.Peek(0, nil)
+			if err != nil {
+				return err
+			}
+			sort.Slice(records, func(i, j int) bool {
+				return records[i].Id < records[j].Id
+			})
+
+			if exportOut == "" {
+				return exportRecords(os.Stdout, records, exportEmbeddings, model)
+			}
+			file, err := os.Create(exportOut)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", exportOut, err)
+			}
+			if err := exportRecords(file, records, exportEmbeddings, model); err != nil {
+				_ = file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return fmt.Errorf("failed to close %s: %w", exportOut, err)
+			}
+			fmt.Fprintf(os.Stderr, "exported %d chunk(s) to %s\n", len(records), exportOut)
+			return nil
+		})
+	},
+}
+
+// exportedModel returns the model of the embeddings of the store, the one recorded with the collection, or the
+// configured one for the collections recording none
+func exportedModel(vectorStore store.VectorStore, cfg *config.Config) (string, error) {
+	if recorder, ok := vectorStore.(store.ModelRecorder); ok {
+		model, err := recorder.CollectionModel()
+		if err != nil || model != "" {
+			return model, err
+		}
+	}
+	return embeddingModel(cfg), nil
+}
+
+func exportRecords(out io.Writer, records []store.Record, withEmbeddings bool, model string) error {
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, record := range records {
+		exported := exportedRecord{Id: record.Id, Document: record.Document, Metadata: record.Metadata}
+		if withEmbeddings {
+			exported.Embedding = record.Embedding
+			exported.Model = model
+		}
+		if err := encoder.Encode(exported); err != nil {
+			return fmt.Errorf("failed to export record %s: %w", record.Id, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(
+		&exportOut,
+		"out",
+		"o",
+		"",
+		"File to write the export to, standard output by default",
+	)
+	exportCmd.Flags().BoolVar(
+		&exportEmbeddings,
+		"embeddings",
+		false,
+		"Include the embeddings of the chunks",
+	)
+
+	mmCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/hooks"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// indexingFailures counts the files failing to be embedded or stored during a run, by cause, to report them at
+	// the end of the run instead of in the middle of the logs of the workers
+	indexingFailures struct {
+		lock    sync.Mutex
+		byCause map[string]*failedFiles
+	}
+
+	// failedFiles are the files failing for a cause, the last one being kept as an example
+	failedFiles struct {
+		cause string
+		files int
+		path  string
+		err   error
+	}
+)
+
+var (
+	// runFailures collects the failures of the current indexing run
+	runFailures = &indexingFailures{}
+	// runRestarts counts the python indexers restarted during the current indexing run, after a crash or a hang
+	runRestarts atomic.Int64
+)
+
+// record counts the failed file under the code of the error of the indexer, or the stage it failed at otherwise
+func (f *indexingFailures) record(event hooks.FileFailed) {
+	cause := event.Stage
+	var indexerErr *embedding.IndexerError
+	if errors.As(event.Err, &indexerErr) && indexerErr.Code != "" {
+		cause = string(indexerErr.Code)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.byCause == nil {
+		f.byCause = make(map[string]*failedFiles)
+	}
+	failed, found := f.byCause[cause]
+	if !found {
+		failed = &failedFiles{cause: cause}
+		f.byCause[cause] = failed
+	}
+	failed.files++
+	failed.path = event.Path
+	failed.err = event.Err
+}
+
+// drain returns the failures by cause, sorted by cause, and forgets them
+func (f *indexingFailures) drain() []failedFiles {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	failures := make([]failedFiles, 0, len(f.byCause))
+	for _, failed := range f.byCause {
+		failures = append(failures, *failed)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].cause < failures[j].cause
+	})
+	f.byCause = nil
+	return failures
+}
+
+// logIndexingFailures reports the files of the run failing to be indexed, one line per cause, they are indexed again
+// by the next run
+func logIndexingFailures(logger *zerolog.Logger) {
+	for _, failed := range runFailures.drain() {
+		logger.Warn().
+			Str("cause", failed.cause).
+			Int("files", failed.files).
+			Str("lastFile", failed.path).
+			AnErr("lastError", failed.err).
+			Msg("Files not indexed")
+	}
+}
+
+// logIndexerRestarts reports the python indexers restarted during the run, their requests were sent again so no file
+// was lost
+func logIndexerRestarts(logger *zerolog.Logger) {
+	if restarts := runRestarts.Swap(0); restarts > 0 {
+		logger.Warn().Int64("restarts", restarts).Msg("Indexer restarted")
+	}
+}
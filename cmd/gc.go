@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/gc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcDryRun bool
+	gcMaxAge time.Duration
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove the outdated artifacts of the working directory",
+	Long: `Remove the artifacts accumulating in the working directory across versions and interrupted runs: the lib
+directories (python scripts and virtual environments) of the versions of mm not used for --max-age, the lib files
+written before the lib directories were versioned, and the temporary files older than an hour.`,
+	Example: `  mm gc
+  mm gc --dry-run
+  mm gc --max-age 168h`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wd := workingDirectory()
+		artifacts, err := gc.Collect(
+			wd,
+			embedding.LibPath(wd),
+			gc.WithLibMaxAge(gcMaxAge),
+			gc.WithDryRun(gcDryRun),
+			gc.WithSkip(embedding.ChromaPath(wd)),
+		)
+		if err != nil {
+			return err
+		}
+
+		action := "removed"
+		if gcDryRun {
+			action = "would remove"
+		}
+		var total int64
+		for _, artifact := range artifacts {
+			fmt.Printf("%s %s (%s, %s)\n", action, artifact.Path, artifact.Reason, formatBytes(artifact.Bytes))
+			total += artifact.Bytes
+		}
+		fmt.Printf("%s %d artifact(s), %s\n", action, len(artifacts), formatBytes(total))
+		return nil
+	},
+}
+
+func init() {
+	gcCmd.Flags().BoolVar(
+		&gcDryRun,
+		"dry-run",
+		false,
+		"Only show what would be removed",
+	)
+	gcCmd.Flags().DurationVar(
+		&gcMaxAge,
+		"max-age",
+		gc.DefaultLibMaxAge,
+		"Remove the lib directories of the versions of mm not used for this long",
+	)
+
+	mmCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+const importBatchSize = 256
+
+var (
+	importMarkIndexed bool
+	importCacheOnly   bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import file.jsonl",
+	Short: "Import chunks exported with mm export",
+	Long: `Load the chunks of an export (- for the standard input) into the store, the chunks exported without their
+embeddings are embedded again. With --mark-indexed, the imported files found locally are recorded as indexed, so
+the next indexing run skips them until they change, the local files are expected to match the exported ones.
+With --cache-only, the store is left untouched: the exported embeddings only seed the embedding cache, so indexing
+the same code embeds none of the chunks whose content was exported.`,
+	Example: `  mm import index.jsonl
+  curl -s https://ci.example.com/mm/index.jsonl | mm import --mark-indexed -
+  mm import --cache-only teammate-index.jsonl && mm --index .`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in := os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", args[0], err)
+			}
+			defer func() {
+				_ = file.Close()
+			}()
+			in = file
+		}
+		if importCacheOnly {
+			return seedEmbeddingCache(in)
+		}
+
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			indexLock, err := lockIndex(cmd.Context(), cfg)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = indexLock.Release()
+			}()
+
+			importer := &importer{
+				ctx:         cmd.Context(),
+				cfg:         cfg,
+				vectorStore: vectorStore,
+				files:       make(map[string][]string),
+				chunks:      make(map[string][]manifest.ChunkStats),
+			}
+			defer importer.close()
+
+			if err := importer.importRecords(in); err != nil {
+				return err
+			}
+			fmt.Printf("imported %d chunk(s), %d embedded again\n", importer.imported, importer.embedded)
+			if !importMarkIndexed {
+				return nil
+			}
+			indexManifest, err := manifest.Load(manifestPath(cfg))
+			if err != nil {
+				return err
+			}
+			marked, err := importer.markIndexed(indexManifest, nil)
+			if err != nil {
+				return err
+			}
+			if err := indexManifest.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("marked %d of %d file(s) as indexed\n", marked, len(importer.files))
+			return nil
+		})
+	},
+}
+
+type importer struct {
+	ctx         context.Context
+	cfg         *config.Config
+	vectorStore store.VectorStore
+	// dir resolves the relative paths of the imported files, the current directory if empty
+	dir string
+	// provider embeds the chunks exported without their embeddings, started on the first one
+	provider embedding.EmbeddingProvider
+	// files maps the imported file paths to their chunk ids
+	files    map[string][]string
+	chunks   map[string][]manifest.ChunkStats
+	imported int
+	embedded int
+}
+
+// readExported decodes the records of an export, one per line, passing them to consume with the model of their
+// embedding
+func readExported(in io.Reader, consume func(record store.Record, model string) error) error {
+	scanner := bufio.NewScanner(in)
+	// a line holds a whole chunk, and its embedding
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var exported exportedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &exported); err != nil {
+			return fmt.Errorf("failed to decode line %d: %w", line, err)
+		}
+		err := consume(store.Record{
+			Id:        exported.Id,
+			Document:  exported.Document,
+			Metadata:  exported.Metadata,
+			Embedding: exported.Embedding,
+		}, exported.Model)
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read import: %w", err)
+	}
+	return nil
+}
+
+func (i *importer) importRecords(in io.Reader) error {
+	// the exported embeddings are searched with the configured model
+	if err := checkStore(i.cfg, i.vectorStore, 0); err != nil {
+		return err
+	}
+	var batch []store.Record
+	err := readExported(in, func(record store.Record, model string) error {
+		if err := checkExportedModel(i.cfg, model, record.Embedding); err != nil {
+			return err
+		}
+		batch = append(batch, record)
+		if len(batch) < importBatchSize {
+			return nil
+		}
+		err := i.importBatch(batch)
+		batch = nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := i.importBatch(batch); err != nil {
+		return err
+	}
+	return store.RecordModel(i.vectorStore, embeddingModel(i.cfg))
+}
+
+// checkExportedModel refuses the exported embedding of another model than the configured one, the exports recording
+// no model were made when only the default model of the python indexer was used
+func checkExportedModel(cfg *config.Config, model string, exported []float32) error {
+	if len(exported) == 0 {
+		// embedded again with the configured model
+		return nil
+	}
+	if model == "" {
+		model = embedding.DefaultModel
+	}
+	if configured := embeddingModel(cfg); model != configured {
+		return fmt.Errorf(
+			"%w: the embeddings of the export were computed by %s, not %s: import it with the same model",
+			store.ErrModelMismatch,
+			model,
+			configured,
+		)
+	}
+	if dimensions := embedderDimensions(cfg, nil); dimensions > 0 && len(exported) != dimensions {
+		return fmt.Errorf(
+			"%w: the export holds embeddings with %d dimensions, %s computes %d",
+			store.ErrModelMismatch,
+			len(exported),
+			model,
+			dimensions,
+		)
+	}
+	return nil
+}
+
+// seedEmbeddingCache puts the exported embeddings in the embedding cache, for the configured model, an export of
+// another model is refused, the chunks exported without embeddings are skipped
+func seedEmbeddingCache(in io.Reader) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	cache, err := openEmbeddingCache(cfg)
+	if err != nil {
+		return err
+	}
+	if cache == nil {
+		return fmt.Errorf("the embedding cache is disabled (indexer.cache_size)")
+	}
+
+	seeded, skipped := 0, 0
+	err = readExported(in, func(record store.Record, model string) error {
+		if len(record.Embedding) == 0 {
+			skipped++
+			return nil
+		}
+		if err := checkExportedModel(cfg, model, record.Embedding); err != nil {
+			return err
+		}
+		chunk, err := record.Chunk()
+		if err != nil {
+			return err
+		}
+		cache.Put(embeddingModel(cfg), chunk, record.Embedding)
+		seeded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := cache.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("seeded the embedding cache with %d embedding(s), %d chunk(s) skipped\n", seeded, skipped)
+	return nil
+}
+
+func (i *importer) importBatch(records []store.Record) error {
+	var chunks []code.Chunk
+	var missing []int
+	for idx, record := range records {
+		chunk, err := record.Chunk()
+		if err != nil {
+			return err
+		}
+		filePath := chunk.Metadata.FilePath
+		i.files[filePath] = append(i.files[filePath], record.Id)
+		i.chunks[filePath] = countChunk(i.chunks[filePath], chunk)
+		if len(record.Embedding) > 0 {
+			continue
+		}
+		chunks = append(chunks, chunk)
+		missing = append(missing, idx)
+	}
+
+	if len(chunks) > 0 {
+		if err := i.startProvider(); err != nil {
+			return err
+		}
+		embeddings, err := i.provider.EmbedDocuments(chunks)
+		if err != nil {
+			return err
+		}
+		for j, idx := range missing {
+			records[idx].Embedding = embeddings[j]
+		}
+		i.embedded += len(chunks)
+	}
+
+	if i.imported == 0 && len(records) > 0 {
+		if err := checkStore(i.cfg, i.vectorStore, len(records[0].Embedding)); err != nil {
+			return err
+		}
+	}
+	if err := i.vectorStore.Upsert(records); err != nil {
+		return fmt.Errorf("failed to store imported chunks: %w", err)
+	}
+	i.imported += len(records)
+	return nil
+}
+
+func (i *importer) startProvider() error {
+	if i.provider != nil {
+		return nil
+	}
+	provider, err := newProvider(i.ctx, i.cfg)
+	if err != nil {
+		return err
+	}
+	i.provider = provider
+	return provider.WaitReady()
+}
+
+// markIndexed records the imported files found locally in the manifest, as they are on disk, except the skipped ones
+// (by absolute path), returns the number of files marked
+func (i *importer) markIndexed(indexManifest *manifest.Manifest, skip map[string]bool) (int, error) {
+	parser := code.NewGenericParser()
+	marked := 0
+	for filePath, chunkIds := range i.files {
+		absPath, err := i.resolve(filePath)
+		if err != nil {
+			return 0, err
+		}
+		if skip[absPath] {
+			continue
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			// not checked out locally, indexed as usual if it ever is
+			continue
+		}
+		content, err := os.ReadFile(absPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read file %s: %w", absPath, err)
+		}
+		indexManifest.Put(absPath, manifest.Entry{
+			FilePath:   filePath,
+			Language:   parser.Language(filePath),
+			Hash:       manifest.Hash(content),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().UnixNano(),
+			ChunkIds:   chunkIds,
+			Chunks:     i.chunks[filePath],
+		})
+		marked++
+	}
+	return marked, nil
+}
+
+// resolve returns the absolute path of an imported file
+func (i *importer) resolve(filePath string) (string, error) {
+	if i.dir != "" && !filepath.IsAbs(filePath) {
+		return filepath.Join(i.dir, filePath), nil
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+	}
+	return absPath, nil
+}
+
+func (i *importer) close() {
+	if i.provider != nil {
+		_ = i.provider.Close()
+	}
+}
+
+func init() {
+	importCmd.Flags().BoolVar(
+		&importMarkIndexed,
+		"mark-indexed",
+		false,
+		"Record the imported files found locally as indexed, so the next indexing run skips them",
+	)
+	importCmd.Flags().BoolVar(
+		&importCacheOnly,
+		"cache-only",
+		false,
+		"Only seed the embedding cache with the exported embeddings, without importing the chunks in the store",
+	)
+	importCmd.MarkFlagsMutuallyExclusive("cache-only", "mark-indexed")
+
+	mmCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/git"
+	"github.com/a-peyrard/mm/internal/hooks"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/schema"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/a-peyrard/mm/internal/throttle"
+	"github.com/a-peyrard/mm/internal/worker"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// errParserCrashed is returned when the parser panics or times out on a file
+var errParserCrashed = errors.New("parser crashed")
+
+// errIndexingInterrupted is returned once an interrupted run has saved the files indexed before the interruption
+var errIndexingInterrupted = errors.New("indexing interrupted, the files indexed so far are kept")
+
+// indexRun summarizes an indexing run
+type indexRun struct {
+	// files is the number of files submitted to the workers, unchanged ones included
+	files int
+	// truncated is set when the run stopped at the maximum number of files
+	truncated bool
+	elapsed   time.Duration
+}
+
+// indexDirectories indexes the source files of the directories in the same store, stopping after maxFiles files if not
+// zero, the files deleted since the previous run are only removed from the store by complete runs, with pathspecs only
+// the files of the directories matching them are indexed
+func indexDirectories(
+	ctx context.Context,
+	cfg *config.Config,
+	paths []string,
+	pathspecs []string,
+	maxFiles int,
+) (indexRun, error) {
+	logger := zerolog.Ctx(ctx)
+
+	if metadataOnly {
+		// the chunks are kept apart, the configured store only holds embedded ones
+		cfg = metadataConfig(cfg)
+	}
+	if readOnlyIndex(cfg) {
+		return indexRun{}, fmt.Errorf("cannot index: %w (--read-only, or its files are not writable)", store.ErrReadOnly)
+	}
+	indexLock, err := lockIndex(ctx, cfg)
+	if err != nil {
+		return indexRun{}, err
+	}
+	defer func() {
+		if err := indexLock.Release(); err != nil {
+			logger.Warn().Err(err).Msg("failed to release the index lock")
+		}
+	}()
+	if err := code.NewGenericParser().CheckQueries(); err != nil {
+		return indexRun{}, fmt.Errorf("failed to check the language queries: %w", err)
+	}
+
+	vectorStore, publish, err := openIndexedStore(ctx, cfg)
+	if err != nil {
+		return indexRun{}, err
+	}
+	readLimiter, err := setupThrottling()
+	if err != nil {
+		return indexRun{}, err
+	}
+	parserLimiter := newParserLimiter(cfg)
+	// the paths in the embedded text are relative to the repository of the first directory
+	root, err := git.Root(ctx, paths[0])
+	if err != nil {
+		return indexRun{}, err
+	}
+	paths, roots, err := code.RootNames(root, paths)
+	if err != nil {
+		return indexRun{}, err
+	}
+	indexManifest, err := manifest.Load(manifestPath(cfg))
+	if err != nil {
+		return indexRun{}, err
+	}
+	if !metadataOnly {
+		if err := checkModel(cfg, indexManifest); err != nil {
+			return indexRun{}, err
+		}
+		// the manifest may be missing, or be the one of another user of a shared chroma server
+		if err := checkStore(cfg, vectorStore, embedderDimensions(cfg, nil)); err != nil {
+			return indexRun{}, err
+		}
+	}
+	// chunks of different versions must not be mixed in the store
+	if err := schema.Migrate(vectorStore, indexManifest); err != nil {
+		return indexRun{}, err
+	}
+	if err := indexManifest.Save(); err != nil {
+		return indexRun{}, err
+	}
+	if shouldBootstrap(cfg, indexManifest) {
+		if err := bootstrapIndex(ctx, cfg, root, vectorStore, indexManifest); err != nil {
+			return indexRun{}, err
+		}
+	}
+
+	logger.Info().Int("numberOfWorkers", numberOfWorkers).Msg("Initializing indexer daemons...")
+	// the failures of an interrupted run are not the ones of this run
+	runFailures.drain()
+	runRestarts.Store(0)
+	if showProgress {
+		runProgress.start(os.Stderr)
+		defer runProgress.finish()
+	}
+	start := time.Now()
+	shared, stopShared, err := startSharedEmbedder(ctx, cfg)
+	if err != nil {
+		return indexRun{}, err
+	}
+	if shared != nil {
+		// the embedder is started, it may tell the dimensions of a model not known beforehand
+		if err := checkStore(cfg, vectorStore, embedderDimensions(cfg, shared)); err != nil {
+			stopShared()
+			return indexRun{}, err
+		}
+	}
+	deduplicator := embedding.NewDeduplicator(0)
+	cache, err := openEmbeddingCache(cfg)
+	if err != nil {
+		return indexRun{}, err
+	}
+	secondary, err := openSecondaryIndex(ctx, cfg, indexManifest, cache)
+	if err != nil {
+		return indexRun{}, err
+	}
+	// the chunks of the modified, deleted, and evicted files are removed from both stores
+	indexedStore := secondary.mirror(vectorStore)
+	workerFactory := NewIndexerWorkerFactory(
+		buildEnrichers(root, roots),
+		indexedStore,
+		indexManifest,
+		readLimiter,
+		parserLimiter,
+		shared,
+		deduplicator,
+		cache,
+		embeddingModel(cfg),
+		mmHooks,
+		indexerOptions(cfg, embedding.WithEmbedOnly()),
+		dispatcherOptions(cfg),
+		secondary,
+	)
+	if metadataOnly {
+		workerFactory = NewMetadataWorkerFactory(buildEnrichers(root, roots), vectorStore, indexManifest, readLimiter, parserLimiter, mmHooks)
+	}
+	workerGroup, err := worker.NewGroup(ctx, numberOfWorkers, workerFactory)
+	if err != nil {
+		return indexRun{}, fmt.Errorf("failed to create worker group: %w", err)
+	}
+	_ = workerGroup.WaitAllWorkersToBeReady(ctx)
+	end := time.Now()
+	logger.Info().
+		Str("elapsed", fmt.Sprintf("%dms", end.Sub(start).Milliseconds())).
+		Int("numberOfWorkers", numberOfWorkers).
+		Msg("daemons ready")
+
+	// a Ctrl-C stops the intake of the files, the ones being indexed are completed, and the indexers drained
+	intake, stopIntake := worker.Interruptible(ctx)
+	defer stopIntake()
+
+	// look for source files in the provided directory
+	start = time.Now()
+	counter := 0
+	truncated := false
+	interrupted := false
+	found := make(map[string]bool)
+	for _, path := range paths {
+		if truncated || interrupted {
+			break
+		}
+		var selected map[string]bool
+		if len(pathspecs) > 0 {
+			if selected, err = git.ListFiles(ctx, path, pathspecs); err != nil {
+				return indexRun{}, err
+			}
+		}
+		err = code.FindInDirectory(
+			path,
+			code.NewGenericParser().Extensions(),
+			func(path string) error {
+				if maxFiles > 0 && counter >= maxFiles {
+					truncated = true
+					return fs.SkipAll
+				}
+				if intake.Err() != nil {
+					interrupted = true
+					return fs.SkipAll
+				}
+				absPath, err := filepath.Abs(path)
+				if err != nil {
+					return fmt.Errorf("failed to resolve path %s: %w", path, err)
+				}
+				// the files left out by the pathspecs are still found, their chunks are kept as they are
+				found[absPath] = true
+				if selected != nil && !selected[absPath] {
+					return nil
+				}
+				counter++
+				runProgress.fileSubmitted()
+				return workerGroup.Submit(path)
+			},
+		)
+		if err != nil {
+			return indexRun{}, fmt.Errorf("failed to find files in directory %s: %w", path, err)
+		}
+	}
+
+	if interrupted {
+		logger.Warn().Int("filesSubmitted", counter).Msg("Indexing interrupted, completing the files being indexed")
+		// the files not found are not deleted ones
+		truncated = true
+	}
+	_ = workerGroup.WaitAndClose()
+	stopShared()
+	runProgress.finish()
+	if assets {
+		for _, path := range paths {
+			if err := catalogAssets(ctx, path, pathspecs, indexManifest); err != nil {
+				return indexRun{}, err
+			}
+		}
+	}
+	if cache != nil {
+		// the embeddings already computed are kept, even if the run fails afterward
+		if err := cache.Close(); err != nil {
+			logger.Warn().Err(err).Msg("failed to save the embedding cache")
+		}
+	}
+	if !truncated {
+		for _, path := range paths {
+			if err := removeDeletedFiles(path, found, indexManifest, indexedStore); err != nil {
+				return indexRun{}, err
+			}
+		}
+	}
+	if err := evictFiles(ctx, cfg, indexManifest, indexedStore); err != nil {
+		return indexRun{}, err
+	}
+	if !metadataOnly {
+		if err := store.RecordModel(vectorStore, embeddingModel(cfg)); err != nil {
+			return indexRun{}, err
+		}
+	}
+	if secondary != nil {
+		if err := secondary.close(); err != nil {
+			return indexRun{}, err
+		}
+	}
+	if err := vectorStore.Close(); err != nil {
+		return indexRun{}, fmt.Errorf("failed to close store: %w", err)
+	}
+	if err := publish(); err != nil {
+		return indexRun{}, err
+	}
+	// only saved once the store is, otherwise files could be skipped while they are not persisted
+	model := embeddingModel(cfg)
+	if metadataOnly {
+		model = ""
+	}
+	indexManifest.MarkIndexed(time.Now(), model)
+	if err := indexManifest.Save(); err != nil {
+		return indexRun{}, err
+	}
+	end = time.Now()
+
+	logger.Info().
+		Str("elapsed", fmt.Sprintf("%dms", end.Sub(start).Milliseconds())).
+		Int("filesProcessed", counter).
+		Int64("embeddingsReused", deduplicator.Reused()).
+		Int64("embeddingsCached", cacheHits(cache)).
+		Bool("truncated", truncated).
+		Msg("Indexing completed")
+	logParserContention(logger, parserLimiter)
+	logIndexingFailures(logger)
+	logIndexerRestarts(logger)
+
+	run := indexRun{files: counter, truncated: truncated, elapsed: end.Sub(start)}
+	if interrupted {
+		return run, errIndexingInterrupted
+	}
+	return run, nil
+}
+
+type indexerWorker struct {
+	embedder embedding.ChunkEmbedder
+	// indexer is the python process owned by the worker, nil if the worker uses the shared dispatcher
+	indexer     *embedding.Supervisor
+	enrichers   []code.Enricher
+	vectorStore store.VectorStore
+	manifest    *manifest.Manifest
+	// readLimiter is shared by all the workers, nil if reads are not throttled
+	readLimiter *throttle.ReadLimiter
+	// parserLimiter is shared by all the workers, nil if the parses are not limited
+	parserLimiter *throttle.ParserLimiter
+	// hooks are notified of the indexed files and the embedded chunks
+	hooks *hooks.Hooks
+
+	// dispatcher splits the chunks of the large files sent to the indexer of the worker, nil with the shared one
+	dispatcher *embedding.Dispatcher
+
+	// secondary stores the secondary embeddings of the chunks, nil if none are configured
+	secondary *secondaryIndex
+}
+
+// NewIndexerWorkerFactory creates workers parsing and storing files, each worker runs its own python indexer to
+// embed the chunks, unless a shared embedder is provided, the chunks already embedded with the same content are
+// not embedded again if a deduplicator is provided, nor the ones embedded by the previous runs with the same model if
+// a cache is provided, the secondary embeddings are computed as well if secondary is not nil
+func NewIndexerWorkerFactory(
+	enrichers []code.Enricher,
+	vectorStore store.VectorStore,
+	indexManifest *manifest.Manifest,
+	readLimiter *throttle.ReadLimiter,
+	parserLimiter *throttle.ParserLimiter,
+	shared embedding.ChunkEmbedder,
+	deduplicator *embedding.Deduplicator,
+	cache *embedding.Cache,
+	model string,
+	h *hooks.Hooks,
+	indexerOpts []embedding.IndexerOption,
+	dispatcherOpts []embedding.DispatcherOption,
+	secondary *secondaryIndex,
+) worker.Factory[string] {
+	reuseEmbeddings := func(embedder embedding.ChunkEmbedder) embedding.ChunkEmbedder {
+		if deduplicator != nil {
+			embedder = deduplicator.Wrap(embedder)
+		}
+		if cache != nil {
+			embedder = cache.Wrap(embedder, model)
+		}
+		return embedder
+	}
+	return func(ctx context.Context, workerIdx int) (worker.Worker[string], error) {
+		if shared != nil {
+			return &indexerWorker{reuseEmbeddings(shared), nil, enrichers, vectorStore, indexManifest, readLimiter, parserLimiter, h, nil, secondary}, nil
+		}
+
+		logger := zerolog.Ctx(ctx).
+			With().
+			Str("process", "python indexer").
+			Int("workerIdx", workerIdx).
+			Logger()
+
+		indexer, err := superviseIndexer(ctx, logger, indexerOpts...)
+		if err != nil {
+			return nil, err
+		}
+		runProgress.follow(indexer)
+
+		// a worker embeds a single file at a time, its batches are not waiting for the chunks of other files
+		dispatcher := embedding.NewDispatcher(ctx, indexer, append(dispatcherOpts, embedding.WithDispatcherMaxWait(0))...)
+		return &indexerWorker{reuseEmbeddings(dispatcher), indexer, enrichers, vectorStore, indexManifest, readLimiter, parserLimiter, h, dispatcher, secondary}, nil
+	}
+}
+
+// openEmbeddingCache opens the embedding cache of the working directory, shared by all the collections, nil if it is
+// disabled or not needed
+func openEmbeddingCache(cfg *config.Config) (*embedding.Cache, error) {
+	if cfg.Indexer.CacheSize < 0 || metadataOnly {
+		return nil, nil
+	}
+	return embedding.OpenCache(filepath.Join(workingDirectory(), "cache", "embeddings.gob"), cfg.Indexer.CacheSize)
+}
+
+// cacheHits returns the number of embeddings found in the cache, 0 without cache
+func cacheHits(cache *embedding.Cache) int64 {
+	if cache == nil {
+		return 0
+	}
+	return cache.Hits()
+}
+
+// NewMetadataWorkerFactory creates workers parsing and storing files without embedding their chunks, they need
+// neither python nor a model
+func NewMetadataWorkerFactory(
+	enrichers []code.Enricher,
+	vectorStore store.VectorStore,
+	indexManifest *manifest.Manifest,
+	readLimiter *throttle.ReadLimiter,
+	parserLimiter *throttle.ParserLimiter,
+	h *hooks.Hooks,
+) worker.Factory[string] {
+	return func(ctx context.Context, workerIdx int) (worker.Worker[string], error) {
+		return &indexerWorker{nil, nil, enrichers, vectorStore, indexManifest, readLimiter, parserLimiter, h, nil, nil}, nil
+	}
+}
+
+// parseSafely parses the file, turning the panics of the parser and parses taking longer than the timeout into
+// errParserCrashed errors, a parse timing out keeps running in the background as it cannot be interrupted, and holds
+// its slot of the limiter until it completes
+func parseSafely(
+	ctx context.Context,
+	limiter *throttle.ParserLimiter,
+	parser *code.GenericParser,
+	filePath string,
+	content []byte,
+	timeout time.Duration,
+) ([]code.Chunk, error) {
+	type result struct {
+		chunks []code.Chunk
+		err    error
+	}
+	release, err := limiter.Acquire(ctx, parser.Language(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for a parser: %w", err)
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer release()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("%w: panic: %v", errParserCrashed, r)}
+			}
+		}()
+		chunks, err := parser.ParseFile(filePath, content)
+		done <- result{chunks, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.chunks, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: timed out after %s", errParserCrashed, timeout)
+	}
+}
+
+// setupThrottling lowers the priority of the process if requested, before the python indexers are started so they
+// inherit it, and returns the limiter to use for file reads
+func setupThrottling() (*throttle.ReadLimiter, error) {
+	if niceness != 0 {
+		if err := throttle.SetNiceness(niceness); err != nil {
+			return nil, err
+		}
+	}
+	if maxReadRate == "" {
+		return nil, nil
+	}
+	bytesPerSecond, err := throttle.ParseRate(maxReadRate)
+	if err != nil {
+		return nil, err
+	}
+	return throttle.NewReadLimiter(bytesPerSecond), nil
+}
+
+// newParserLimiter returns the limiter of the concurrent parses, --max-parsers overriding the global limit of the
+// configuration, nil if the parses are not limited
+func newParserLimiter(cfg *config.Config) *throttle.ParserLimiter {
+	limit := cfg.Indexer.Parsers.Max
+	if maxParsers > 0 {
+		limit = maxParsers
+	}
+	return throttle.NewParserLimiter(limit, cfg.Indexer.Parsers.Languages)
+}
+
+// logParserContention logs how long the parses of each language waited for the limiter, to tune its limits
+func logParserContention(logger *zerolog.Logger, limiter *throttle.ParserLimiter) {
+	for _, stats := range limiter.Stats() {
+		logger.Info().
+			Str("language", stats.Language).
+			Int("limit", stats.Limit).
+			Int64("parses", stats.Parses).
+			Int64("waited", stats.Waited).
+			Str("waitTime", fmt.Sprintf("%dms", stats.WaitTime.Milliseconds())).
+			Msg("Parser contention")
+	}
+}
+
+// buildEnrichers returns the enrichers to apply on parsed chunks, they are shared by all the workers, the paths of
+// the files are relative to root in their embedded text, roots names the indexed directories
+func buildEnrichers(root string, roots map[string]string) []code.Enricher {
+	enrichers := []code.Enricher{
+		code.ModificationTimeEnricher,
+		code.RootEnricher(roots),
+		code.ContentHashEnricher,
+		code.IssueEnricher,
+		code.NewGoModuleResolver().Enricher,
+		code.NewPythonModuleResolver().Enricher,
+	}
+	if pathContext {
+		enrichers = append(enrichers, code.PathContextEnricher(root))
+	}
+	if commitContext {
+		enrichers = append(enrichers, code.CommitContextEnricher)
+	}
+	return enrichers
+}
+
+func (w *indexerWorker) WaitReady(ctx context.Context) error {
+	if w.indexer == nil {
+		return nil
+	}
+	return w.indexer.WaitReady()
+}
+
+func (w *indexerWorker) Handle(ctx context.Context, filePath string) error {
+	log.Debug().Str("path", filePath).Msg("Processing file")
+	start := time.Now()
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+	previous, indexed := w.manifest.Get(absPath)
+	indexed = indexed && !fullIndex
+	if indexed && previous.Size == info.Size() && previous.ModifiedAt == info.ModTime().UnixNano() {
+		log.Debug().Str("path", filePath).Msg("File unchanged, skipping it")
+		w.fileIndexed(previous, true, start)
+		return nil
+	}
+
+	content, err := w.readLimiter.ReadFile(ctx, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	parser := code.NewGenericParser(code.WithSmallFileThreshold(smallFile))
+	entry := manifest.Entry{
+		FilePath:   filePath,
+		Language:   parser.Language(filePath),
+		Hash:       manifest.Hash(content),
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime().UnixNano(),
+		MatchedAt:  previous.MatchedAt,
+	}
+	if indexed && previous.Hash == entry.Hash {
+		// touched but not modified
+		log.Debug().Str("path", filePath).Msg("File content unchanged, skipping it")
+		entry.ChunkIds = previous.ChunkIds
+		entry.Chunks = previous.Chunks
+		entry.Evicted = previous.Evicted
+		w.manifest.Put(absPath, entry)
+		w.fileIndexed(entry, true, start)
+		return nil
+	}
+
+	if w.manifest.Quarantined(absPath, entry.Hash) {
+		log.Warn().Str("path", filePath).Msg("File quarantined after crashing the parser repeatedly, skipping it")
+		return nil
+	}
+
+	chunks, err := parseSafely(ctx, w.parserLimiter, parser, filePath, content, parseTimeout)
+	if errors.Is(err, errParserCrashed) {
+		// skipped instead of failing, a single pathological file must not stop the worker
+		failure := w.manifest.RecordFailure(absPath, entry.Hash, err.Error(), quarantineAfter)
+		log.Warn().Err(err).Str("path", filePath).Int("failures", failure.Count).Bool("quarantined", failure.Quarantined).Msg("Parser crashed, skipping file")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	w.manifest.ClearFailure(absPath)
+	if err = code.Enrich(ctx, filePath, chunks, w.enrichers...); err != nil {
+		log.Warn().Err(err).Str("path", filePath).Msg("failed to enrich chunks, indexing them as is")
+	}
+	// chunks of the previous version of the file would otherwise stay forever, with outdated ids and lines
+	if err = w.vectorStore.DeleteByFile(filePath); err != nil {
+		return fmt.Errorf("failed to delete previous chunks of %s: %w", filePath, err)
+	}
+	for _, chunk := range chunks {
+		entry.ChunkIds = append(entry.ChunkIds, chunk.Id)
+	}
+	entry.Chunks = chunkStats(chunks)
+	if len(chunks) == 0 {
+		w.manifest.Put(absPath, entry)
+		w.fileIndexed(entry, false, start)
+		return nil
+	}
+
+	// the chunks of a metadata-only index are stored without embeddings
+	embeddings := make([][]float32, len(chunks))
+	if w.embedder != nil {
+		embeddings, err = w.embedder.EmbedDocuments(chunks)
+		if err != nil {
+			return w.fileFailed(entry, "embed", fmt.Errorf("failed to embed chunks of %s: %w", filePath, err))
+		}
+		for i, chunk := range chunks {
+			w.hooks.ChunkEmbedded(hooks.ChunkEmbedded{Chunk: chunk, Dimensions: len(embeddings[i])})
+		}
+	}
+	records, err := store.NewRecords(chunks, embeddings)
+	if err != nil {
+		return err
+	}
+	if err = w.vectorStore.Upsert(records); err != nil {
+		return w.fileFailed(entry, "store", fmt.Errorf("failed to store chunks of %s: %w", filePath, err))
+	}
+	if w.secondary != nil {
+		if err = w.secondary.upsert(chunks); err != nil {
+			return w.fileFailed(entry, "embed", fmt.Errorf("failed to store the secondary embeddings of %s: %w", filePath, err))
+		}
+	}
+	w.manifest.Put(absPath, entry)
+	w.fileIndexed(entry, false, start)
+
+	return nil
+}
+
+// fileFailed notifies the hooks that the file of the manifest entry failed to be indexed at the stage, returns err
+func (w *indexerWorker) fileFailed(entry manifest.Entry, stage string, err error) error {
+	w.hooks.FileFailed(hooks.FileFailed{Path: entry.FilePath, Language: entry.Language, Stage: stage, Err: err})
+	return err
+}
+
+// fileIndexed notifies the hooks that the file of the manifest entry is indexed
+func (w *indexerWorker) fileIndexed(entry manifest.Entry, unchanged bool, start time.Time) {
+	w.hooks.FileIndexed(hooks.FileIndexed{
+		Path:      entry.FilePath,
+		Language:  entry.Language,
+		Chunks:    len(entry.ChunkIds),
+		Unchanged: unchanged,
+		Elapsed:   time.Since(start),
+	})
+}
+
+// chunkStats counts the chunks by type, and the size of their content, in the order the types are found
+func chunkStats(chunks []code.Chunk) []manifest.ChunkStats {
+	var stats []manifest.ChunkStats
+	for _, chunk := range chunks {
+		stats = countChunk(stats, chunk)
+	}
+	return stats
+}
+
+// countChunk adds the chunk to the counts of its type
+func countChunk(stats []manifest.ChunkStats, chunk code.Chunk) []manifest.ChunkStats {
+	position := slices.IndexFunc(stats, func(s manifest.ChunkStats) bool { return s.Type == chunk.Metadata.ChunkType })
+	if position < 0 {
+		position = len(stats)
+		stats = append(stats, manifest.ChunkStats{Type: chunk.Metadata.ChunkType})
+	}
+	stats[position].Count++
+	stats[position].Bytes += int64(len(chunk.Content))
+	return stats
+}
+
+func (w *indexerWorker) WaitAndClose() error {
+	if w.indexer == nil {
+		return nil
+	}
+	_ = w.dispatcher.Close()
+	countRestarts(w.indexer)
+	return w.indexer.Close()
+}
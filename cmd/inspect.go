@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const defaultPeekLimit = 10
+
+var (
+	peekLimit     int
+	peekWhere     string
+	peekDocuments bool
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Low-level browser of the configured vector store",
+	Long:  `Low-level browser of the configured vector store, to debug unexpected search results`,
+}
+
+var inspectCollectionsCmd = &cobra.Command{
+	Use:   "collections",
+	Short: "List the collections of the store",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withInspector(cmd.Context(), func(inspector store.Inspector) error {
+			collections, err := inspector.Collections()
+			if err != nil {
+				return err
+			}
+			for _, collection := range collections {
+				fmt.Println(collection)
+			}
+			return nil
+		})
+	},
+}
+
+var inspectStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the number of records of the store, and the dimensions of their embeddings",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			stats, err := vectorStore.Stats()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("backend:    %s\n", cfg.Store.Backend)
+			fmt.Printf("records:    %d\n", stats.Records)
+			fmt.Printf("dimensions: %d\n", stats.Dimensions)
+			return nil
+		})
+	},
+}
+
+var inspectPeekCmd = &cobra.Command{
+	Use:   "peek",
+	Short: "Show raw records (id, metadata, vector norm), optionally matching a filter",
+	Example: `  mm inspect peek --limit 5
+  mm inspect peek --where '{"language": "go"}'
+  mm inspect peek --where '{"$and": [{"file_path": "tax.py"}, {"chunk_type": "function"}]}'`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var where map[string]any
+		if peekWhere != "" {
+			if err := json.Unmarshal([]byte(peekWhere), &where); err != nil {
+				return fmt.Errorf("invalid filter %s: %w", peekWhere, err)
+			}
+		}
+
+		return withInspector(cmd.Context(), func(inspector store.Inspector) error {
+			records, err := inspector.Peek(peekLimit, where)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				metadata, err := json.Marshal(record.Metadata)
+				if err != nil {
+					return fmt.Errorf("failed to marshal metadata of %s: %w", record.Id, err)
+				}
+				fmt.Printf("%s (dim %d, norm %.4f)\n", record.Id, len(record.Embedding), record.Norm())
+				fmt.Printf("  %s\n", metadata)
+				if peekDocuments {
+					fmt.Println(record.Document)
+				}
+				fmt.Println()
+			}
+			fmt.Printf("%d record(s)\n", len(records))
+			return nil
+		})
+	},
+}
+
+var inspectDeleteCmd = &cobra.Command{
+	Use:   "delete id...",
+	Short: "Delete individual records by id",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withInspector(cmd.Context(), func(inspector store.Inspector) error {
+			if err := inspector.Delete(args); err != nil {
+				return err
+			}
+			fmt.Printf("%d record(s) deleted\n", len(args))
+			return nil
+		})
+	},
+}
+
+// withInspector opens the configured store for inspection, and closes it once the action is done
+func withInspector(ctx context.Context, action func(inspector store.Inspector) error) error {
+	return withStore(ctx, func(vectorStore store.VectorStore, cfg *config.Config) error {
+		inspector, ok := vectorStore.(store.Inspector)
+		if !ok {
+			return fmt.Errorf("store backend %s cannot be inspected", cfg.Store.Backend)
+		}
+		return action(inspector)
+	})
+}
+
+// withStore opens the configured store, and closes it once the action is done
+func withStore(ctx context.Context, action func(vectorStore store.VectorStore, cfg *config.Config) error) error {
+	logger := log.Logger.With().Timestamp().Caller().Logger()
+	ctx = logger.WithContext(ctx)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	vectorStore, err := openStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := vectorStore.Close(); err != nil {
+			logger.Error().Err(err).Msg("failed to close store")
+		}
+	}()
+
+	return action(vectorStore, cfg)
+}
+
+func init() {
+	inspectPeekCmd.Flags().IntVarP(
+		&peekLimit,
+		"limit",
+		"l",
+		defaultPeekLimit,
+		"Maximum number of records to show, 0 for all of them",
+	)
+	inspectPeekCmd.Flags().StringVar(
+		&peekWhere,
+		"where",
+		"",
+		"Raw chroma-like filter, as JSON",
+	)
+	inspectPeekCmd.Flags().BoolVar(
+		&peekDocuments,
+		"documents",
+		false,
+		"Also print the content of the records",
+	)
+
+	inspectCmd.AddCommand(inspectCollectionsCmd, inspectStatsCmd, inspectPeekCmd, inspectDeleteCmd)
+	mmCmd.AddCommand(inspectCmd)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/render"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+const defaultLinesRelated = 5
+
+var linesRelated int
+
+var linesCmd = &cobra.Command{
+	Use:   "lines file:start[-end]",
+	Short: "Print the chunks covering lines of a file, and the related code",
+	Long: `Print the indexed chunks covering lines of a file, e.g. a frame of a stack trace, followed by the chunks the
+closest to them, to turn a runtime error into the code context needed to debug it. The file can be given by its
+absolute path, or by a path relative to the indexed directory as long as a single indexed file ends with it`,
+	Example: `  mm lines internal/auth/token.go:42
+  mm lines /src/app/tax.py:10-25 --related 10
+  mm lines tax.py:12:7 --format anthropic`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := render.ParseFormat(format)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lines, err := search.ParseLineRange(args[0])
+		if err != nil {
+			return err
+		}
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			inspector, ok := vectorStore.(store.InspectableStore)
+			if !ok {
+				return fmt.Errorf("store backend %s cannot be inspected", cfg.Store.Backend)
+			}
+			indexManifest, err := manifest.Load(manifestPath(cfg))
+			if err != nil {
+				return err
+			}
+			lines.FilePath, err = indexedFilePath(indexManifest, lines.FilePath)
+			if err != nil {
+				return err
+			}
+
+			result, err := search.Lines(inspector, lines, linesRelated)
+			if err != nil {
+				return err
+			}
+
+			renderer := render.New(os.Stdout, render.ColorEnabled(os.Stdout, noColor))
+			if outputFormat, _ := render.ParseFormat(format); outputFormat != render.TextFormat {
+				return renderer.ToolResult(outputFormat, toolCallId, append(result.Covering, result.Related...))
+			}
+			renderer.LinesResult(result)
+			return nil
+		})
+	},
+}
+
+// indexedFilePath returns the path recorded in the chunks of the file, found by its absolute path, or by the end of
+// its path if it is the only indexed file ending with it
+func indexedFilePath(indexManifest *manifest.Manifest, path string) (string, error) {
+	if absPath, err := filepath.Abs(path); err == nil {
+		if entry, found := indexManifest.Get(absPath); found {
+			return entry.FilePath, nil
+		}
+	}
+
+	matches := indexManifest.Match(path)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%s is not indexed", path)
+	case 1:
+		entry, _ := indexManifest.Get(matches[0])
+		return entry.FilePath, nil
+	default:
+		return "", fmt.Errorf("%s matches several indexed files: %s", path, strings.Join(matches, ", "))
+	}
+}
+
+func init() {
+	linesCmd.Flags().IntVar(
+		&linesRelated,
+		"related",
+		defaultLinesRelated,
+		"Number of related chunks to print after the covering ones, 0 to only print the covering chunks",
+	)
+	linesCmd.Flags().StringVar(
+		&format,
+		"format",
+		string(render.TextFormat),
+		"Output format of the chunks: text, or a tool call response for an LLM API (openai, anthropic)",
+	)
+	linesCmd.Flags().StringVar(
+		&toolCallId,
+		"tool-call-id",
+		defaultToolCallId,
+		"Id of the tool call answered by the chunks, with the openai and anthropic formats",
+	)
+
+	mmCmd.AddCommand(linesCmd)
+}
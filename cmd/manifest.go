@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/asset"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/git"
+	"github.com/a-peyrard/mm/internal/lock"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// checkModel refuses an index built with another model, the embeddings of different models cannot be compared, nor
+// mixed in the store
+func checkModel(cfg *config.Config, indexManifest *manifest.Manifest) error {
+	if indexed := indexManifest.Model(); indexed != "" && indexed != embeddingModel(cfg) {
+		return fmt.Errorf(
+			"the index was built with %s, not %s: select the same embedder, or rebuild the index after mm purge --all",
+			indexed,
+			embeddingModel(cfg),
+		)
+	}
+	return nil
+}
+
+// removeDeletedFiles deletes the chunks of the files indexed previously in the directory, but not found anymore
+func removeDeletedFiles(dir string, found map[string]bool, indexManifest *manifest.Manifest, vectorStore store.VectorStore) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", dir, err)
+	}
+
+	for _, path := range indexManifest.Files(absDir) {
+		if found[path] {
+			continue
+		}
+		entry, _ := indexManifest.Get(path)
+		log.Debug().Str("path", entry.FilePath).Msg("File deleted, removing its chunks")
+		if err := vectorStore.DeleteByFile(entry.FilePath); err != nil {
+			return fmt.Errorf("failed to remove chunks of deleted file %s: %w", entry.FilePath, err)
+		}
+		indexManifest.Remove(path)
+	}
+	return nil
+}
+
+// catalogAssets records the non-code files of the directory in the manifest, without parsing nor embedding them, the
+// unchanged ones are not hashed again, and the ones no longer found are removed from the catalog
+func catalogAssets(ctx context.Context, path string, pathspecs []string, indexManifest *manifest.Manifest) error {
+	var selected map[string]bool
+	if len(pathspecs) > 0 {
+		var err error
+		if selected, err = git.ListFiles(ctx, path, pathspecs); err != nil {
+			return err
+		}
+	}
+
+	found := make(map[string]bool)
+	cataloged := 0
+	err := asset.Find(path, func(filePath string) error {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+		}
+		// the assets left out by the pathspecs are kept as they are
+		found[absPath] = true
+		if selected != nil && !selected[absPath] {
+			return nil
+		}
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to stat asset %s: %w", filePath, err)
+		}
+		previous, known := indexManifest.Asset(absPath)
+		if known && !fullIndex && previous.Size == info.Size() && previous.ModifiedAt == info.ModTime().UnixNano() {
+			return nil
+		}
+		entry, err := asset.Catalog(filePath)
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("path", filePath).Str("type", entry.Type).Msg("Asset cataloged")
+		indexManifest.PutAsset(absPath, entry)
+		cataloged++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find assets in directory %s: %w", path, err)
+	}
+
+	absDir, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", path, err)
+	}
+	for _, assetPath := range indexManifest.AssetPaths(absDir) {
+		if !found[assetPath] {
+			log.Debug().Str("path", assetPath).Msg("Asset deleted, removing it from the catalog")
+			indexManifest.RemoveAsset(assetPath)
+		}
+	}
+	zerolog.Ctx(ctx).Info().Str("path", path).Int("found", len(found)).Int("cataloged", cataloged).Msg("Assets cataloged")
+	return nil
+}
+
+// evictFiles drops the chunks of the files beyond the maximum size of the index, according to its eviction policy
+func evictFiles(ctx context.Context, cfg *config.Config, indexManifest *manifest.Manifest, vectorStore store.VectorStore) error {
+	if cfg.Store.MaxSize <= 0 {
+		return nil
+	}
+	logger := zerolog.Ctx(ctx)
+	embeddingBytes := 0
+	if !metadataOnly {
+		stats, err := vectorStore.Stats()
+		if err != nil {
+			return err
+		}
+		// the dimensions of the stored embeddings, or the ones of the model before any is stored
+		dimensions := stats.Dimensions
+		if dimensions == 0 {
+			dimensions = embedderDimensions(cfg, nil)
+		}
+		// qdrant keeps the originals on disk next to the quantized embeddings
+		keepOriginals := cfg.Store.KeepOriginals || cfg.Store.Backend == config.QdrantBackend
+		embeddingBytes = store.Quantization(cfg.Store.Quantization).EmbeddingBytes(dimensions, keepOriginals)
+	}
+	evictions := indexManifest.Evictions(
+		int64(cfg.Store.MaxSize),
+		embeddingBytes,
+		cfg.Store.Eviction == config.LeastRecentlyMatchedEviction,
+	)
+	if len(evictions) == 0 {
+		return nil
+	}
+
+	chunks, size := 0, int64(0)
+	for _, eviction := range evictions {
+		if err := vectorStore.DeleteByFile(eviction.Entry.FilePath); err != nil {
+			return fmt.Errorf("failed to evict chunks of %s: %w", eviction.Entry.FilePath, err)
+		}
+		indexManifest.Evict(eviction.Path)
+		logger.Info().
+			Str("path", eviction.Entry.FilePath).
+			Int("chunks", eviction.Chunks).
+			Str("size", formatBytes(eviction.Bytes)).
+			Msg("File evicted")
+		chunks += eviction.Chunks
+		size += eviction.Bytes
+	}
+	logger.Warn().
+		Int("files", len(evictions)).
+		Int("chunks", chunks).
+		Str("size", formatBytes(size)).
+		Str("maxSize", formatBytes(int64(cfg.Store.MaxSize))).
+		Str("policy", cfg.Store.Eviction).
+		Msg("Index over its maximum size, files evicted")
+	return nil
+}
+
+// recordMatches records the files of the results in the manifest, for the eviction of the least recently matched
+// files, skipped while another process writes the index
+func recordMatches(ctx context.Context, cfg *config.Config, results []search.Result) {
+	if cfg.Store.MaxSize <= 0 || cfg.Store.Eviction != config.LeastRecentlyMatchedEviction || readOnlyIndex(cfg) {
+		return
+	}
+	logger := zerolog.Ctx(ctx)
+	indexLock, err := lock.Acquire(ctx, lockPath(cfg), 0)
+	if err != nil {
+		logger.Debug().Err(err).Msg("index locked, matches not recorded")
+		return
+	}
+	defer func() {
+		_ = indexLock.Release()
+	}()
+
+	indexManifest, err := manifest.Load(manifestPath(cfg))
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to load manifest, matches not recorded")
+		return
+	}
+	label := collectionLabel(cfg)
+	filePaths := make([]string, 0, len(results))
+	for _, result := range results {
+		// the files of the other collections are in their own manifests
+		if result.Collection == "" || result.Collection == label {
+			filePaths = append(filePaths, result.Metadata.FilePath)
+		}
+	}
+	indexManifest.MarkMatched(filePaths, time.Now())
+	if err := indexManifest.Save(); err != nil {
+		logger.Warn().Err(err).Msg("failed to record matches")
+	}
+}
+
+// lockIndex prevents other mm processes from writing the index at the same time, waiting up to --wait-lock for the
+// one writing it
+func lockIndex(ctx context.Context, cfg *config.Config) (*lock.Lock, error) {
+	indexLock, err := lock.Acquire(ctx, lockPath(cfg), lockWait)
+	if errors.Is(err, lock.ErrLocked) {
+		return nil, fmt.Errorf("the index is being written: %w, retry later or wait for it with --wait-lock", err)
+	}
+	return indexLock, err
+}
+
+// lockPath returns the path of the lock of the index, next to its manifest
+func lockPath(cfg *config.Config) string {
+	return strings.TrimSuffix(manifestPath(cfg), ".json") + ".lock"
+}
+
+// manifestPath returns the path of the manifest of the files indexed in the configured store
+func manifestPath(cfg *config.Config) string {
+	id := manifest.Hash([]byte(cfg.Store.Identity()))[:16]
+	return filepath.Join(workingDirectory(), "manifests", id+".json")
+}
+
+// generationsPath is where the published generation of the collection is recorded
+func generationsPath(cfg *config.Config) string {
+	id := manifest.Hash([]byte(cfg.Store.Identity()))[:16]
+	return filepath.Join(workingDirectory(), "generations", id+".json")
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/config"
 	"github.com/a-peyrard/mm/internal/embedding"
-	"github.com/a-peyrard/mm/internal/set"
-	"github.com/a-peyrard/mm/internal/worker"
+	"github.com/a-peyrard/mm/internal/git"
+	"github.com/a-peyrard/mm/internal/hooks"
+	"github.com/a-peyrard/mm/internal/profile"
+	"github.com/a-peyrard/mm/internal/render"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -17,18 +20,118 @@ import (
 )
 
 var (
+	configPath  string
+	workingDir  string
+	dbPath      string
+	tenant      string
+	projectDir  string
+	collection  string
+	repairStore bool
+	noColor     bool
+	readOnly    bool
+	lockWait    time.Duration
+
+	embedderName string
+	modelName    string
+	deviceName   string
+
 	index           bool
 	numberOfWorkers int
+	commitContext   bool
+	pathContext     bool
+	smallFile       int
+	maxReadRate     string
+	niceness        int
+	sharedEmbedder  bool
+	fullIndex       bool
+	profileDir      string
+	parseTimeout    time.Duration
+	quarantineAfter int
+	metadataOnly    bool
+	assets          bool
+	estimate        bool
+
+	maxParsers  int
+	noBootstrap bool
+
+	batchSize     int
+	batchMaxBytes string
+
+	showProgress bool
+
+	limit      int
+	since      string
+	recent     bool
+	like       string
+	likeWeight float64
+	format     string
+	toolCallId string
+
+	alsoIn         []string
+	keepDuplicates bool
+	explain        bool
+
+	embeddingsName string
 )
 
 const defaultNumberOfWorkers = 2
 const defaultLogLevel = zerolog.DebugLevel
+const defaultSmallFileThreshold = 1024
+const defaultLimit = 5
+const defaultLikeWeight = 0.5
+const defaultParseTimeout = 30 * time.Second
+const defaultQuarantineAfter = 3
+const defaultToolCallId = "mm_search"
+
+const (
+	// workingDirVariable and dbPathVariable set the working directory and the chroma data without flags
+	workingDirVariable = "MM_WORKING_DIR"
+	dbPathVariable     = "MM_DB_PATH"
+	// projectWorkingDirName is the working directory of a project, used when found in the project or above it
+	projectWorkingDirName = ".mm"
+)
+
+// mmHooks observe the indexing and the searches of the command line, applications using mm as a library attach their
+// own metrics or audit the same way
+var mmHooks = hooks.New(
+	hooks.OnFileIndexed(func(event hooks.FileIndexed) {
+		if event.Unchanged {
+			runProgress.fileDone(0)
+		} else {
+			runProgress.fileDone(event.Chunks)
+		}
+		log.Trace().
+			Str("path", event.Path).
+			Int("chunks", event.Chunks).
+			Bool("unchanged", event.Unchanged).
+			Dur("elapsed", event.Elapsed).
+			Msg("File indexed")
+	}),
+	hooks.OnFileFailed(func(event hooks.FileFailed) {
+		runProgress.fileDone(0)
+		runFailures.record(event)
+	}),
+	hooks.OnSearch(func(event hooks.Search) {
+		log.Debug().
+			Err(event.Err).
+			Str("query", event.Query).
+			Int("results", event.Results).
+			Dur("elapsed", event.Elapsed).
+			Msg("Search completed")
+	}),
+)
 
 var mmCmd = &cobra.Command{
-	Use:   "mm --index [file ...]",
+	Use:   "mm [--index directory... [-- pathspec...] | query ...]",
 	Short: "My Memory CLI tool",
 	Long:  `My Memory CLI tool`,
-	Args:  cobra.MinimumNArgs(1),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if like != "" {
+			// the example is enough to search
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) > 0 && args[0] == "completion" {
 			shell := "zsh"
@@ -45,110 +148,241 @@ var mmCmd = &cobra.Command{
 			Logger()
 		ctx := logger.WithContext(cmd.Context())
 
-		if index {
-			logger.Info().Int("numberOfWorkers", numberOfWorkers).Msg("Initializing indexer daemons...")
-			start := time.Now()
-			workerGroup, err := worker.NewGroup(ctx, numberOfWorkers, NewIndexerWorker)
-			if err != nil {
-				return fmt.Errorf("failed to create worker group: %w", err)
-			}
-			_ = workerGroup.WaitAllWorkersToBeReady(ctx)
-			end := time.Now()
-			logger.Info().
-				Str("elapsed", fmt.Sprintf("%dms", end.Sub(start).Milliseconds())).
-				Int("numberOfWorkers", numberOfWorkers).
-				Msg("daemons ready")
-
-			// look for Python files in the provided directory
-			start = time.Now()
-			counter := 0
-			path := args[0]
-			err = code.FindInDirectory(
-				path,
-				set.Of(".py"),
-				func(path string) error {
-					counter++
-					return workerGroup.Submit(path)
-				},
-			)
-			if err != nil {
-				return fmt.Errorf("failed to find files in directory %s: %w", path, err)
+		var pathspecs []string
+		if dash := cmd.ArgsLenAtDash(); index && dash >= 0 {
+			// the arguments after -- restrict the indexed files, the current directory is indexed if none is given
+			args, pathspecs = args[:dash], args[dash:]
+			if len(args) == 0 {
+				args = []string{"."}
 			}
+		}
+		if index && projectDir == "" {
+			// the indexed directory is the project
+			projectDir = args[0]
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
 
-			_ = workerGroup.WaitAndClose()
-			end = time.Now()
+		if index {
+			if profileDir != "" {
+				stopProfile, err := profile.Start(profileDir)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if err := stopProfile(); err != nil {
+						logger.Error().Err(err).Msg("failed to write profiles")
+					}
+				}()
+			}
 
-			logger.Info().
-				Str("elapsed", fmt.Sprintf("%dms", end.Sub(start).Milliseconds())).
-				Int("filesProcessed", counter).
-				Msg("Indexing completed")
+			if estimate {
+				return estimateIndex(ctx, cfg, args, pathspecs)
+			}
+			_, err := indexDirectories(ctx, cfg, args, pathspecs, 0)
+			return err
 		}
 
-		return nil
+		return runSearch(ctx, cfg, args)
 	},
 }
 
-type indexerWorker struct {
-	indexer *embedding.RunningIndexer
-}
-
-func NewIndexerWorker(ctx context.Context, workerIdx int) (worker.Worker[string], error) {
-	logger := zerolog.Ctx(ctx).
-		With().
-		Str("process", "python indexer").
-		Int("workerIdx", workerIdx).
-		Logger()
-
-	// create the embedding indexer
-	indexer, err := embedding.RunIndexer(ctx)
+// loadConfig loads the configuration, scoped to the selected tenant or collection if any, or to the repository of
+// the project directory unless the scope is global
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run indexer: %w", err)
+		return nil, err
+	}
+	if err := selectEmbedder(cfg); err != nil {
+		return nil, err
 	}
-	go func() {
-		for out := range indexer.Output() {
-			logger.Trace().Msg(out)
+	if err := selectBatch(cfg); err != nil {
+		return nil, err
+	}
+	if tenant != "" {
+		if collection != "" {
+			return nil, fmt.Errorf("--collection cannot be used with --tenant, tenants have their own collection")
 		}
-	}()
-
-	return &indexerWorker{indexer}, nil
-}
+		return cfg.ForTenant(tenant)
+	}
+	if collection != "" {
+		if err := config.ValidateCollectionName(collection); err != nil {
+			return nil, err
+		}
+		return cfg.ForCollection(collection), nil
+	}
+	if cfg.Store.Scope == config.GlobalScope {
+		return cfg, nil
+	}
 
-func (w *indexerWorker) WaitReady(ctx context.Context) error {
-	return w.indexer.WaitReady()
+	dir := projectDir
+	if dir == "" {
+		dir = "."
+	}
+	root, err := git.Root(context.Background(), dir)
+	if err != nil {
+		return nil, err
+	}
+	scoped := cfg.ForProject(root)
+	log.Debug().Str("root", root).Str("collection", scoped.Store.CollectionName()).Msg("store scoped to the project")
+	return scoped, nil
 }
 
-func (w *indexerWorker) Handle(_ context.Context, filePath string) error {
-	log.Debug().Str("path", filePath).Msg("Processing file")
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", filePath, err)
+// workingDirectory returns where mm keeps the indexer, the chroma data, and the manifests: --working-dir,
+// MM_WORKING_DIR, the .mm directory of the project directory or of one of its parents, or $HOME/.mm
+func workingDirectory() string {
+	if workingDir != "" {
+		return os.ExpandEnv(workingDir)
+	}
+	if wd := os.Getenv(workingDirVariable); wd != "" {
+		return os.ExpandEnv(wd)
+	}
+	dir := projectDir
+	if dir == "" {
+		dir = "."
 	}
+	if wd := findProjectWorkingDirectory(dir); wd != "" {
+		return wd
+	}
+	return os.ExpandEnv(embedding.DefaultWorkingDirectory)
+}
 
-	chunks, err := code.NewGenericParser().ParseFile(filePath, content)
+// findProjectWorkingDirectory looks for a .mm directory in dir and its parents, empty if there is none
+func findProjectWorkingDirectory(dir string) string {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return fmt.Errorf("failed to parse file %s: %w", filePath, err)
+		return ""
 	}
-	if len(chunks) > 0 {
-		err = w.indexer.ProcessChunk(chunks)
-		if err != nil {
-			return fmt.Errorf("failed to process chunk: %w", err)
+	for {
+		candidate := filepath.Join(dir, projectWorkingDirName)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate
 		}
-		w.indexer.WaitForCompletion()
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
 	}
-
-	return nil
-}
-
-func (w *indexerWorker) WaitAndClose() error {
-	return w.indexer.Close()
 }
 
 func init() {
+	mmCmd.PersistentFlags().StringVar(
+		&configPath,
+		"config",
+		config.DefaultPath,
+		"Path of the configuration file",
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&workingDir,
+		"working-dir",
+		"",
+		"Directory of the indexer, the chroma data, and the manifests (default is $MM_WORKING_DIR, the .mm directory of the project if any, or $HOME/.mm)",
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&dbPath,
+		"db-path",
+		"",
+		"Directory of the data of the local chroma server, checked for corruptions (default is $MM_DB_PATH, or the chroma directory of the working directory)",
+	)
+
+	mmCmd.PersistentFlags().BoolVar(
+		&readOnly,
+		"read-only",
+		false,
+		"Open the index read-only, refusing any change (also the case when its files are not writable)",
+	)
+
+	mmCmd.PersistentFlags().DurationVar(
+		&lockWait,
+		"wait-lock",
+		0,
+		"How long to wait for another mm process writing the index to finish, fails right away by default",
+	)
+
+	mmCmd.PersistentFlags().BoolVar(
+		&noColor,
+		"no-color",
+		false,
+		"Disable colors in logs and results (also disabled when NO_COLOR is set, or when not writing to a terminal)",
+	)
+
+	mmCmd.PersistentFlags().BoolVar(
+		&repairStore,
+		"repair",
+		false,
+		"Recreate the chroma store if it is found corrupted at startup (its content has to be indexed again), and fix the inconsistencies found by verify",
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&embedderName,
+		"embedder",
+		"",
+		fmt.Sprintf(
+			"Computes the embeddings, %s (the default), %s to call a local ollama server, %s to serve a GGUF model with llama.cpp, or %s (or a compatible API), %s, or %s for a hosted model",
+			config.PythonEmbedder,
+			config.OllamaEmbedder,
+			config.LlamaCppEmbedder,
+			config.OpenAIEmbedder,
+			config.VoyageEmbedder,
+			config.CohereEmbedder,
+		),
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&modelName,
+		"embedding-model",
+		"",
+		fmt.Sprintf(
+			"Embedding model of the embedder, a sentence transformer for python (default is %s, %s, %s, %s, %s, or %s)",
+			embedding.DefaultModel,
+			embedding.DefaultOllamaModel,
+			embedding.DefaultLlamaCppModel,
+			embedding.DefaultOpenAIModel,
+			embedding.DefaultVoyageModel,
+			embedding.DefaultCohereModel,
+		),
+	)
+	// kept for the scripts written before the python indexer could use another model
+	mmCmd.PersistentFlags().StringVar(&modelName, "model", "", "Alias of --embedding-model")
+	mmCmd.PersistentFlags().StringVar(
+		&deviceName,
+		"device",
+		"",
+		"Device computing the embeddings of the python embedder, auto (the default) picks cuda, then mps, then cpu",
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&tenant,
+		"tenant",
+		"",
+		"Use the data of a tenant defined in the serve configuration",
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&projectDir,
+		"project",
+		"",
+		"Directory of the project whose collection is used, the indexed directory or the current one by default",
+	)
+
+	mmCmd.PersistentFlags().StringVar(
+		&collection,
+		"collection",
+		"",
+		"Name of the collection to use, instead of the one of the project",
+	)
+
 	mmCmd.Flags().BoolVar(
 		&index,
 		"index",
 		false,
-		"If we should run in index mode (otherwise will run in consume mode)",
+		"If we should run in index mode (otherwise will run in consume mode), several directories can be indexed together",
 	)
 
 	mmCmd.Flags().IntVarP(
@@ -159,10 +393,234 @@ func init() {
 		fmt.Sprintf("Number of workers to use for indexing (default is %d)", defaultNumberOfWorkers),
 	)
 
+	mmCmd.Flags().BoolVar(
+		&commitContext,
+		"commit-context",
+		false,
+		"Attach the subject of the last commit touching each chunk to its embedded text",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&pathContext,
+		"path-context",
+		true,
+		"Attach the words of the path of the file, relative to the repository, to the embedded text of its chunks",
+	)
+
+	mmCmd.Flags().IntVar(
+		&smallFile,
+		"small-file-threshold",
+		defaultSmallFileThreshold,
+		"Files smaller than this size (in bytes) are indexed as a single chunk, 0 to disable",
+	)
+
+	mmCmd.Flags().StringVar(
+		&maxReadRate,
+		"max-read-rate",
+		"",
+		"Maximum read bandwidth when indexing, like 512K or 10MB (per second), unlimited by default",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&noBootstrap,
+		"no-bootstrap",
+		false,
+		"Index the whole repository on the first run, instead of importing the index published by the CI (bootstrap.url)",
+	)
+
+	mmCmd.Flags().IntVar(
+		&maxParsers,
+		"max-parsers",
+		0,
+		"Maximum number of files parsed at the same time, whatever the number of workers, unlimited by default",
+	)
+
+	mmCmd.Flags().IntVar(
+		&batchSize,
+		"batch-size",
+		0,
+		"Number of chunks of several files embedded at once by the python indexer, the large files being split (default 256)",
+	)
+
+	mmCmd.Flags().StringVar(
+		&batchMaxBytes,
+		"batch-max-bytes",
+		"",
+		"Maximum content of the chunks embedded at once by the python indexer, like 512K or 2MB, unbounded by default",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&showProgress,
+		"progress",
+		false,
+		"Show the progress of the indexing on a line refreshed until the end of the run, with the time left",
+	)
+
+	mmCmd.Flags().IntVar(
+		&niceness,
+		"nice",
+		0,
+		"Niceness to run the indexing with (1-19, higher is lower priority), so background indexing stays unnoticed",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&sharedEmbedder,
+		"shared-embedder",
+		false,
+		"Embed the chunks of all the workers in large batches with a single python indexer, workers only parse files",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&fullIndex,
+		"full",
+		false,
+		"Re-index all the files, including unchanged ones (needed after changing indexing options)",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&metadataOnly,
+		"metadata-only",
+		false,
+		"Only store the parsed chunks and their symbols, without embeddings, for mm symbol (no python nor model needed)",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&assets,
+		"assets",
+		false,
+		"Also catalog the non-code files (images, models, dumps, ...) by path, size, type, and hash, so searches locate them by name",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&estimate,
+		"estimate",
+		false,
+		"Only count the tokens of the chunks the indexing would embed, and print the estimated cost and time of embedding them",
+	)
+
+	mmCmd.Flags().DurationVar(
+		&parseTimeout,
+		"parse-timeout",
+		defaultParseTimeout,
+		"Maximum time spent parsing a file, the files taking longer count as crashing the parser",
+	)
+
+	mmCmd.Flags().IntVar(
+		&quarantineAfter,
+		"quarantine-after",
+		defaultQuarantineAfter,
+		"Number of parser crashes (panics or timeouts) after which a file is skipped until it changes",
+	)
+
+	mmCmd.Flags().StringVar(
+		&profileDir,
+		"profile-dir",
+		"",
+		"Directory where to write cpu, heap and goroutine profiles of the indexing",
+	)
+	_ = mmCmd.Flags().MarkHidden("profile-dir")
+
+	mmCmd.Flags().IntVarP(
+		&limit,
+		"limit",
+		"l",
+		defaultLimit,
+		"Maximum number of results to return when searching",
+	)
+
+	mmCmd.Flags().StringVar(
+		&since,
+		"since",
+		"",
+		"Only return results changed since a date (2006-01-02) or a duration (36h, 3d, 2w)",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&recent,
+		"recent",
+		false,
+		"Boost results from actively developed code when searching",
+	)
+
+	mmCmd.Flags().StringVar(
+		&like,
+		"like",
+		"",
+		"Path to a code snippet, search code similar to it (combined with the query if any)",
+	)
+
+	mmCmd.Flags().Float64Var(
+		&likeWeight,
+		"like-weight",
+		defaultLikeWeight,
+		"Weight of the --like example against the query, between 0 (query only) and 1 (example only)",
+	)
+
+	mmCmd.Flags().StringSliceVar(
+		&alsoIn,
+		"also-in",
+		nil,
+		"Also search these collections, comma separated, identical chunks found in several of them are shown once",
+	)
+
+	mmCmd.Flags().StringVar(
+		&embeddingsName,
+		"embedding",
+		config.PrimaryEmbeddings,
+		"Embeddings searched, "+config.PrimaryEmbeddings+" (the default), or the name of the secondary embeddings of the configuration",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&keepDuplicates,
+		"keep-duplicates",
+		false,
+		"Show the identical chunks found in several files or collections as separate results",
+	)
+
+	mmCmd.Flags().BoolVar(
+		&explain,
+		"explain",
+		false,
+		"Show the contribution of each ranking stage to the score of the results",
+	)
+
+	mmCmd.Flags().StringVar(
+		&format,
+		"format",
+		string(render.TextFormat),
+		"Output format of the results: text, or a tool call response for an LLM API (openai, anthropic)",
+	)
+
+	mmCmd.Flags().StringVar(
+		&toolCallId,
+		"tool-call-id",
+		defaultToolCallId,
+		"Id of the tool call answered by the results, with the openai and anthropic formats",
+	)
+
 	mmCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if cmd.Flags().Changed("number-of-workers") && !index {
 			return fmt.Errorf("--number-of-workers can only be used with --index")
 		}
+		for _, flag := range []string{"commit-context", "path-context", "small-file-threshold", "max-read-rate", "nice", "shared-embedder", "full", "profile-dir", "parse-timeout", "quarantine-after", "metadata-only", "progress", "estimate"} {
+			if cmd.Flags().Changed(flag) && !index {
+				return fmt.Errorf("--%s can only be used with --index", flag)
+			}
+		}
+		if estimate && metadataOnly {
+			return fmt.Errorf("--estimate cannot be used with --metadata-only, nothing is embedded")
+		}
+		if likeWeight < 0 || likeWeight > 1 {
+			return fmt.Errorf("--like-weight must be between 0 and 1")
+		}
+		if _, err := render.ParseFormat(format); err != nil {
+			return err
+		}
+		for _, flag := range []string{"limit", "since", "recent", "like", "like-weight", "also-in", "keep-duplicates", "format", "tool-call-id"} {
+			if cmd.Flags().Changed(flag) && index {
+				return fmt.Errorf("--%s cannot be used with --index", flag)
+			}
+		}
 		return nil
 	}
 }
@@ -198,14 +656,24 @@ func getLogLevelFromEnv(envName string, fallbackLevel zerolog.Level) zerolog.Lev
 	return level
 }
 
-func main() {
-	zerolog.SetGlobalLevel(getLogLevel())
-	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+// setupLogger configures the console logger, once the flags are parsed
+func setupLogger() {
+	console := zerolog.ConsoleWriter{
+		Out:        os.Stderr,
+		TimeFormat: time.RFC3339,
+		NoColor:    !render.ColorEnabled(os.Stderr, noColor),
+	}
+	log.Logger = zerolog.New(console).
 		Level(zerolog.TraceLevel).
 		With().
 		Timestamp().
 		Caller().
 		Logger()
+}
+
+func main() {
+	zerolog.SetGlobalLevel(getLogLevel())
+	cobra.OnInitialize(setupLogger)
 
 	if err := mmCmd.Execute(); err != nil {
 		fmt.Println(err)
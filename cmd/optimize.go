@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// latencyQueries is the number of queries timed before and after the optimization
+const latencyQueries = 20
+
+var optimizeCmd = &cobra.Command{
+	Use:   "optimize",
+	Short: "Rewrite the store to reclaim space and rebuild its index",
+	Long: `Rewrite all the chunks of the store from scratch: the space left by deleted chunks is reclaimed, and the index
+of the vectors is rebuilt. The size of the store and the query latency are reported before and after. The chunks are
+backed up in the working directory during the rewrite, and can be restored with mm import if it fails. The sqlite
+database of chroma is held by its server, it is only vacuumed once the server is stopped, with the chroma cli.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			inspectable, ok := vectorStore.(store.InspectableStore)
+			if !ok {
+				return fmt.Errorf("store backend %s cannot be optimized", cfg.Store.Backend)
+			}
+			records, err := inspectable.Peek(0, nil)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				fmt.Println("store is empty, nothing to optimize")
+				return nil
+			}
+
+			sizeBefore := storeSize(cfg)
+			latencyBefore, err := queryLatency(vectorStore, records)
+			if err != nil {
+				return err
+			}
+
+			model, err := exportedModel(vectorStore, cfg)
+			if err != nil {
+				return err
+			}
+			backup := filepath.Join(workingDirectory(), "optimize-backup.jsonl")
+			if err := writeBackup(backup, records, model); err != nil {
+				return err
+			}
+			err = store.Rewrite(vectorStore, records)
+			inUse := errors.Is(err, store.ErrStoreInUse)
+			if err != nil && !inUse {
+				return fmt.Errorf("%w, the chunks can be restored with mm import %s", err, backup)
+			}
+			if err := os.Remove(backup); err != nil {
+				return fmt.Errorf("failed to remove backup %s: %w", backup, err)
+			}
+
+			sizeAfter := storeSize(cfg)
+			latencyAfter, err := queryLatency(vectorStore, records)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("rewrote %d chunk(s)\n", len(records))
+			fmt.Printf("size:          %s -> %s\n", sizeBefore, sizeAfter)
+			fmt.Printf("query latency: %s -> %s\n", latencyBefore, latencyAfter)
+			if inUse {
+				fmt.Printf(
+					"the database was not compacted while the chroma server runs, stop it and run "+
+						"chroma utils vacuum --path %s to reclaim the space of the deleted chunks\n",
+					chromaPath(),
+				)
+			}
+			return nil
+		})
+	},
+}
+
+// storeSize returns the disk usage of the store, when it is stored locally
+func storeSize(cfg *config.Config) string {
+	var path string
+	switch cfg.Store.Backend {
+	case config.LocalBackend:
+		path = os.ExpandEnv(cfg.Store.Path)
+	case config.ChromaBackend:
+		if cfg.Store.Chroma.Remote() {
+			return "n/a"
+		}
+		path = chromaPath()
+	default:
+		return "n/a"
+	}
+	size, err := diskUsage(path)
+	if err != nil {
+		return "n/a"
+	}
+	return formatBytes(size)
+}
+
+// queryLatency returns the mean latency of queries using the embeddings of the first records
+func queryLatency(vectorStore store.VectorStore, records []store.Record) (time.Duration, error) {
+	queries := min(latencyQueries, len(records))
+	start := time.Now()
+	for _, record := range records[:queries] {
+		if _, err := vectorStore.Query(record.Embedding, defaultLimit, nil); err != nil {
+			return 0, fmt.Errorf("failed to time queries: %w", err)
+		}
+	}
+	return (time.Since(start) / time.Duration(queries)).Round(time.Microsecond), nil
+}
+
+func writeBackup(path string, records []store.Record, model string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup %s of a previous optimization exists, restore it with mm import or remove it", path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check backup %s: %w", path, err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create backup %s: %w", path, err)
+	}
+	if err := exportRecords(file, records, true, model); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write backup %s: %w", path, err)
+	}
+	return nil
+}
+
+func init() {
+	mmCmd.AddCommand(optimizeCmd)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+// progressRefresh is the period of the progress line
+const progressRefresh = 500 * time.Millisecond
+
+type (
+	// indexingProgress renders the progress of an indexing run on a line of the terminal, refreshed until the run
+	// ends, from the progress reported by the python indexers and the files handled by the workers
+	indexingProgress struct {
+		lock     sync.Mutex
+		out      io.Writer
+		reported []embedding.IndexerProgress
+		stop     chan struct{}
+		stopped  sync.WaitGroup
+
+		submitted atomic.Int64
+		done      atomic.Int64
+		// chunks of the files indexed, counting the progress of the embedders not reporting it
+		chunks  atomic.Int64
+		started time.Time
+	}
+
+	// progressSource is an embedder reporting its progress, the python indexer
+	progressSource interface {
+		Progress() <-chan embedding.IndexerProgress
+	}
+)
+
+// runProgress renders the progress of the current indexing run, when enabled with --progress
+var runProgress = &indexingProgress{}
+
+// start renders the progress on out until stop, forgetting the progress of the previous run
+func (p *indexingProgress) start(out io.Writer) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.out = out
+	p.reported = nil
+	p.stop = make(chan struct{})
+	p.submitted.Store(0)
+	p.done.Store(0)
+	p.chunks.Store(0)
+	p.started = time.Now()
+
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				p.render()
+				_, _ = fmt.Fprintln(out)
+				return
+			case <-ticker.C:
+				p.render()
+			}
+		}
+	}()
+}
+
+// follow adds the progress of the embedder to the line, nothing if the progress is not rendered or the embedder does
+// not report it
+func (p *indexingProgress) follow(embedder any) {
+	source, ok := embedder.(progressSource)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !ok || p.stop == nil {
+		return
+	}
+	position := len(p.reported)
+	p.reported = append(p.reported, embedding.IndexerProgress{})
+	stop := p.stop
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case progress, ok := <-source.Progress():
+				if !ok {
+					return
+				}
+				p.lock.Lock()
+				p.reported[position] = progress
+				p.lock.Unlock()
+			}
+		}
+	}()
+}
+
+// fileSubmitted and fileDone count the files of the run, to estimate the time left
+func (p *indexingProgress) fileSubmitted() {
+	p.submitted.Add(1)
+}
+
+func (p *indexingProgress) fileDone(chunks int) {
+	p.done.Add(1)
+	p.chunks.Add(int64(chunks))
+}
+
+// finish stops rendering the progress, the line being left as is
+func (p *indexingProgress) finish() {
+	p.lock.Lock()
+	if p.stop == nil {
+		p.lock.Unlock()
+		return
+	}
+	close(p.stop)
+	p.stop = nil
+	p.lock.Unlock()
+	p.stopped.Wait()
+}
+
+func (p *indexingProgress) render() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var total embedding.IndexerProgress
+	for _, progress := range p.reported {
+		total.Embedded += progress.Embedded
+		total.Stored += progress.Stored
+		total.PerSecond += progress.PerSecond
+	}
+	if len(p.reported) == 0 {
+		// the other embedders do not report their progress, the chunks of the files indexed are counted instead
+		total.Embedded = p.chunks.Load()
+		total.Stored = total.Embedded
+		total.PerSecond = float64(total.Embedded) / time.Since(p.started).Seconds()
+	}
+	submitted, done := p.submitted.Load(), p.done.Load()
+	_, _ = fmt.Fprintf(
+		p.out,
+		"\r\x1b[KIndexing: %d/%d files, %d chunks embedded, %d stored, %.0f chunks/s, ETA %s",
+		done, submitted, total.Embedded, total.Stored, total.PerSecond, estimateTimeLeft(total, submitted, done),
+	)
+}
+
+// estimateTimeLeft extrapolates the chunks of the files left from the ones of the files done, at the current pace
+func estimateTimeLeft(total embedding.IndexerProgress, submitted, done int64) string {
+	if done == 0 || total.PerSecond <= 0 || total.Embedded == 0 {
+		return "-"
+	}
+	chunksLeft := float64(total.Embedded) / float64(done) * float64(max(submitted-done, 0))
+	return (time.Duration(chunksLeft/total.PerSecond) * time.Second).String()
+}
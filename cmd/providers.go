@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/rs/zerolog"
+)
+
+// embeddingProviders returns the registry of the embedding providers, configured by cfg
+func embeddingProviders(cfg *config.Config) *embedding.Registry {
+	indexer := cfg.Indexer
+	registry := embedding.NewRegistry()
+	registry.Register(config.PythonEmbedder, embedding.DefaultModel, func(ctx context.Context, model string) (embedding.EmbeddingProvider, error) {
+		logger := zerolog.Ctx(ctx).With().Str("process", "python indexer").Logger()
+		supervisor, err := superviseIndexer(ctx, logger, indexerOptions(cfg, embedding.WithEmbedOnly(), embedding.WithModel(model))...)
+		if err != nil {
+			return nil, err
+		}
+		return supervisor, nil
+	})
+	registry.Register(config.OllamaEmbedder, embedding.DefaultOllamaModel, func(ctx context.Context, model string) (embedding.EmbeddingProvider, error) {
+		return embedding.NewOllama(ctx, os.ExpandEnv(indexer.OllamaURL), model), nil
+	})
+	registry.Register(config.LlamaCppEmbedder, embedding.DefaultLlamaCppModel, func(ctx context.Context, model string) (embedding.EmbeddingProvider, error) {
+		return embedding.NewLlamaCpp(ctx, model, llamaCppOptions(cfg)...), nil
+	})
+	registry.Register(config.OpenAIEmbedder, embedding.DefaultOpenAIModel, func(ctx context.Context, model string) (embedding.EmbeddingProvider, error) {
+		return embedding.NewOpenAI(ctx, os.ExpandEnv(indexer.OpenAI.URL), os.ExpandEnv(indexer.OpenAI.APIKey), model, hostedOptions(indexer.OpenAI)...), nil
+	})
+	registry.Register(config.VoyageEmbedder, embedding.DefaultVoyageModel, func(ctx context.Context, model string) (embedding.EmbeddingProvider, error) {
+		return embedding.NewVoyage(ctx, os.ExpandEnv(indexer.Voyage.URL), os.ExpandEnv(indexer.Voyage.APIKey), model, hostedOptions(indexer.Voyage)...), nil
+	})
+	registry.Register(config.CohereEmbedder, embedding.DefaultCohereModel, func(ctx context.Context, model string) (embedding.EmbeddingProvider, error) {
+		return embedding.NewCohere(ctx, os.ExpandEnv(indexer.Cohere.URL), os.ExpandEnv(indexer.Cohere.APIKey), model, hostedOptions(indexer.Cohere)...), nil
+	})
+	return registry
+}
+
+// newProvider creates the embedding provider selected by the configuration, started by its WaitReady
+func newProvider(ctx context.Context, cfg *config.Config) (embedding.EmbeddingProvider, error) {
+	return embeddingProviders(cfg).New(ctx, cfg.Indexer.Embedder, cfg.Indexer.Model)
+}
+
+// providerModel returns the model of the embedding provider selected by the configuration
+func providerModel(cfg *config.Config) string {
+	if cfg.Indexer.Model != "" {
+		return cfg.Indexer.Model
+	}
+	model, _ := embeddingProviders(cfg).DefaultModel(cfg.Indexer.Embedder)
+	return model
+}
+
+// llamaCppOptions returns the options of the llama.cpp server tuned by the configuration, the models are downloaded
+// in the working directory
+func llamaCppOptions(cfg *config.Config) []embedding.LlamaCppOption {
+	opts := []embedding.LlamaCppOption{
+		embedding.WithModelsDir(filepath.Join(workingDirectory(), "models")),
+		embedding.WithLlamaCppThreads(cfg.Indexer.Threads),
+		embedding.WithContextSize(cfg.Indexer.LlamaCpp.ContextSize),
+		embedding.WithGPULayers(cfg.Indexer.LlamaCpp.GPULayers),
+	}
+	if cfg.Indexer.LlamaCpp.Server != "" {
+		opts = append(opts, embedding.WithLlamaServer(os.ExpandEnv(cfg.Indexer.LlamaCpp.Server)))
+	}
+	return opts
+}
+
+// hostedOptions returns the options of a hosted provider tuned by the configuration
+func hostedOptions(hosted config.HostedConfig) []embedding.HostedOption {
+	return []embedding.HostedOption{
+		embedding.WithHostedBatchSize(hosted.BatchSize),
+		embedding.WithHostedRateLimit(hosted.RequestsPerMinute, hosted.TokensPerMinute),
+	}
+}
+
+// logEmbeddingRequests logs the requests sent to a hosted provider during the run, with their retries and the time
+// spent waiting for its rate limits, nothing for the other providers
+func logEmbeddingRequests(logger *zerolog.Logger, provider embedding.EmbeddingProvider) {
+	hosted, ok := provider.(interface{ Stats() embedding.HostedStats })
+	if !ok {
+		return
+	}
+	stats := hosted.Stats()
+	if stats.Requests == 0 {
+		return
+	}
+	logger.Info().
+		Str("provider", provider.ModelID()).
+		Int64("requests", stats.Requests).
+		Int64("retries", stats.Retries).
+		Int64("rateLimited", stats.RateLimited).
+		Str("throttled", fmt.Sprintf("%dms", stats.Throttled.Milliseconds())).
+		Msg("Embedding requests")
+}
+
+// startSharedEmbedder returns the embedder shared by all the workers, the provider of the configuration, a single
+// python indexer being put behind a dispatcher batching the chunks of the workers, nil if each worker should run its
+// own python indexer, the returned function stops it
+func startSharedEmbedder(ctx context.Context, cfg *config.Config) (embedding.ChunkEmbedder, func(), error) {
+	if metadataOnly || (cfg.Indexer.Embedder == config.PythonEmbedder && !sharedEmbedder) {
+		return nil, func() {}, nil
+	}
+	return startEmbedder(ctx, cfg)
+}
+
+// startEmbedder returns the provider of the configuration, a python indexer being put behind a dispatcher batching the
+// chunks of the workers, the returned function stops it
+func startEmbedder(ctx context.Context, cfg *config.Config) (embedding.ChunkEmbedder, func(), error) {
+	provider, err := newProvider(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Indexer.Embedder != config.PythonEmbedder {
+		return provider, func() {
+			logEmbeddingRequests(zerolog.Ctx(ctx), provider)
+			_ = provider.Close()
+		}, nil
+	}
+	if err := provider.WaitReady(); err != nil {
+		_ = provider.Close()
+		return nil, nil, fmt.Errorf("failed to start the embedding provider: %w", err)
+	}
+	runProgress.follow(provider)
+
+	dispatcher := embedding.NewDispatcher(ctx, provider, dispatcherOptions(cfg)...)
+	return dispatcher, func() {
+		_ = dispatcher.Close()
+		countRestarts(provider)
+		_ = provider.Close()
+	}, nil
+}
+
+// dispatcherOptions returns the batches of the chunks sent to the python indexer, sized by the configuration or the
+// command line
+func dispatcherOptions(cfg *config.Config) []embedding.DispatcherOption {
+	var opts []embedding.DispatcherOption
+	if cfg.Indexer.Batch.Size > 0 {
+		opts = append(opts, embedding.WithDispatcherBatchSize(cfg.Indexer.Batch.Size))
+	}
+	if cfg.Indexer.Batch.MaxBytes > 0 {
+		opts = append(opts, embedding.WithDispatcherMaxBytes(int(cfg.Indexer.Batch.MaxBytes)))
+	}
+	return opts
+}
+
+// selectBatch overrides the batches of the configuration with the ones of the command line, if any
+func selectBatch(cfg *config.Config) error {
+	if batchSize < 0 {
+		return fmt.Errorf("--batch-size cannot be negative")
+	}
+	if batchSize > 0 {
+		cfg.Indexer.Batch.Size = batchSize
+	}
+	if batchMaxBytes != "" {
+		maxBytes, err := config.ParseByteSize(batchMaxBytes)
+		if err != nil {
+			return fmt.Errorf("invalid --batch-max-bytes: %w", err)
+		}
+		cfg.Indexer.Batch.MaxBytes = maxBytes
+	}
+	return nil
+}
+
+// indexerOptions returns the options of the python indexer tuned by the configuration, followed by opts
+func indexerOptions(cfg *config.Config, opts ...embedding.IndexerOption) []embedding.IndexerOption {
+	return append(
+		[]embedding.IndexerOption{
+			embedding.WithThreads(cfg.Indexer.Threads),
+			embedding.WithEmbedBatchSize(cfg.Indexer.EmbedBatchSize),
+			embedding.WithWriteBatchSize(cfg.Indexer.WriteBatchSize),
+			embedding.WithWorkingDirectory(workingDirectory()),
+			embedding.WithDBPath(chromaPath()),
+			embedding.WithAddress(indexerAddress(cfg)),
+			embedding.WithModel(pythonModel(cfg)),
+			embedding.WithDevice(cfg.Indexer.Device),
+			embedding.WithCompression(int(cfg.Indexer.Batch.CompressAbove)),
+			embedding.WithMaxInFlight(cfg.Indexer.Batch.MaxInFlight),
+			embedding.WithCollectionSpace(string(storeSpace(cfg).Metric), cfg.Store.Normalize),
+			embedding.WithCommand(cfg.Indexer.Command, cfg.Indexer.Args...),
+			embedding.WithChromaServer(embedding.ChromaServer{
+				Host:  os.ExpandEnv(cfg.Store.Chroma.Host),
+				Port:  cfg.Store.Chroma.Port,
+				SSL:   cfg.Store.Chroma.SSL,
+				Token: os.ExpandEnv(cfg.Store.Chroma.Token),
+			}),
+		},
+		opts...,
+	)
+}
+
+// indexerAddress returns the address of the indexer to connect to, the configured one, else the daemon of the
+// working directory when it runs the model of the configuration, empty to start a sub-process
+func indexerAddress(cfg *config.Config) string {
+	if cfg.Indexer.Address != "" {
+		return cfg.Indexer.Address
+	}
+	model := ""
+	if cfg.Indexer.Embedder == config.PythonEmbedder {
+		model = providerModel(cfg)
+	}
+	return embedding.DaemonAddress(workingDirectory(), model)
+}
+
+// pythonModel returns the sentence transformer model selected for the python indexer, empty for the default one or
+// when another embedder computes the embeddings
+func pythonModel(cfg *config.Config) string {
+	if cfg.Indexer.Embedder != config.PythonEmbedder {
+		return ""
+	}
+	return cfg.Indexer.Model
+}
+
+// embeddingModel names the model computing the embeddings, recorded in the manifest and keying the embedding cache
+func embeddingModel(cfg *config.Config) string {
+	if cfg.Indexer.Embedder == config.PythonEmbedder {
+		// not prefixed, the indexes built before the model could be selected recorded it as is
+		return providerModel(cfg)
+	}
+	return cfg.Indexer.Embedder + "/" + providerModel(cfg)
+}
+
+// embedderDimensions returns the dimensions of the embeddings of the embedder when it tells them before computing
+// any, the ones of the default model when the python indexers load it, 0 when unknown
+func embedderDimensions(cfg *config.Config, embedder embedding.ChunkEmbedder) int {
+	if sized, ok := embedder.(interface{ Dimensions() int }); ok && sized.Dimensions() > 0 {
+		return sized.Dimensions()
+	}
+	if cfg.Indexer.Embedder == config.PythonEmbedder && providerModel(cfg) == embedding.DefaultModel {
+		return embedding.DefaultDimensions
+	}
+	return 0
+}
+
+// runIndexer starts the embedding indexer, forwarding its output to the logger
+func runIndexer(ctx context.Context, logger zerolog.Logger, opts ...embedding.IndexerOption) (*embedding.RunningIndexer, error) {
+	indexer, err := embedding.RunIndexer(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run indexer: %w", err)
+	}
+	go func() {
+		for event := range indexer.Events() {
+			if event, ok := event.(embedding.LogEvent); ok {
+				logger.Trace().Str("level", event.Level.String()).Msg(event.Message)
+			}
+		}
+	}()
+
+	return indexer, nil
+}
+
+// superviseIndexer starts the embedding indexer, restarted when it crashes or hangs, forwarding the output of each
+// of its processes to the logger
+func superviseIndexer(ctx context.Context, logger zerolog.Logger, opts ...embedding.IndexerOption) (*embedding.Supervisor, error) {
+	return embedding.Supervise(logger.WithContext(ctx), func(ctx context.Context) (*embedding.RunningIndexer, error) {
+		return runIndexer(ctx, logger, opts...)
+	})
+}
+
+// countRestarts adds the restarts of the python indexer to the ones of the run, nothing for the other providers
+func countRestarts(provider embedding.EmbeddingProvider) {
+	if supervisor, ok := provider.(*embedding.Supervisor); ok {
+		runRestarts.Add(supervisor.Restarts())
+	}
+}
+
+// selectEmbedder overrides the embedder of the configuration with the one of the command line, if any
+func selectEmbedder(cfg *config.Config) error {
+	if embedderName != "" {
+		if err := config.ValidateEmbedder(embedderName); err != nil {
+			return err
+		}
+		cfg.Indexer.Embedder = embedderName
+	}
+	if modelName != "" {
+		cfg.Indexer.Model = modelName
+	}
+	if deviceName != "" {
+		if err := config.ValidateDevice(deviceName); err != nil {
+			return err
+		}
+		cfg.Indexer.Device = deviceName
+	}
+	return nil
+}
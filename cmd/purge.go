@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/glob"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	purgeAll    bool
+	purgePaths  []string
+	purgeDryRun bool
+)
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge [--all | --path pattern...]",
+	Short: "Delete indexed files from the store",
+	Long: `Delete the whole index, or the indexed files matching paths, along with their manifest entries.
+A path without wildcards deletes a file or a whole directory (a project), * matches within a path segment,
+and ** across segments.`,
+	Example: `  mm purge --all
+  mm purge --path ~/src/legacy-app
+  mm purge --path 'src/legacy/**' --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if purgeAll == (len(purgePaths) > 0) {
+			return fmt.Errorf("either --all or --path is required")
+		}
+		patterns, err := compilePatterns(purgePaths)
+		if err != nil {
+			return err
+		}
+
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			path := manifestPath(cfg)
+			if purgeAll {
+				return purgeStore(vectorStore, path)
+			}
+
+			indexManifest, err := manifest.Load(path)
+			if err != nil {
+				return err
+			}
+			return purgeFiles(vectorStore, indexManifest, patterns)
+		})
+	},
+}
+
+// compilePatterns compiles the path patterns, relative ones being resolved from the current directory
+func compilePatterns(paths []string) ([]*glob.Pattern, error) {
+	patterns := make([]*glob.Pattern, len(paths))
+	for i, path := range paths {
+		if !filepath.IsAbs(path) {
+			wd, err := os.Getwd()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get working directory: %w", err)
+			}
+			path = filepath.Join(wd, path)
+		}
+		pattern, err := glob.Compile(path)
+		if err != nil {
+			return nil, err
+		}
+		patterns[i] = pattern
+	}
+	return patterns, nil
+}
+
+func purgeStore(vectorStore store.VectorStore, manifestPath string) error {
+	stats, err := vectorStore.Stats()
+	if err != nil {
+		return err
+	}
+	if purgeDryRun {
+		fmt.Printf("would delete %d chunk(s)\n", stats.Records)
+		return nil
+	}
+
+	if err := vectorStore.DeleteAll(); err != nil {
+		return fmt.Errorf("failed to delete the index: %w", err)
+	}
+	// the index can be built again with another model
+	if err := store.ForgetModel(vectorStore); err != nil {
+		return err
+	}
+	if err := os.Remove(manifestPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove manifest: %w", err)
+	}
+	fmt.Printf("deleted %d chunk(s)\n", stats.Records)
+	return nil
+}
+
+func purgeFiles(vectorStore store.VectorStore, indexManifest *manifest.Manifest, patterns []*glob.Pattern) error {
+	action := "deleted"
+	if purgeDryRun {
+		action = "would delete"
+	}
+
+	files, chunks := 0, 0
+	for _, path := range indexManifest.Paths() {
+		if !matchesAny(path, patterns) {
+			continue
+		}
+		entry, _ := indexManifest.Get(path)
+		if !purgeDryRun {
+			if err := vectorStore.DeleteByFile(entry.FilePath); err != nil {
+				return fmt.Errorf("failed to delete chunks of %s: %w", entry.FilePath, err)
+			}
+			indexManifest.Remove(path)
+		}
+		fmt.Printf("%s %s (%d chunk(s))\n", action, path, len(entry.ChunkIds))
+		files++
+		chunks += len(entry.ChunkIds)
+	}
+	if err := indexManifest.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %d file(s), %d chunk(s)\n", action, files, chunks)
+	return nil
+}
+
+func matchesAny(path string, patterns []*glob.Pattern) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	purgeCmd.Flags().BoolVar(
+		&purgeAll,
+		"all",
+		false,
+		"Delete the whole index",
+	)
+	purgeCmd.Flags().StringArrayVar(
+		&purgePaths,
+		"path",
+		nil,
+		"Delete the indexed files matching the path (a file, a directory, or a glob), can be repeated",
+	)
+	purgeCmd.Flags().BoolVar(
+		&purgeDryRun,
+		"dry-run",
+		false,
+		"Only show what would be deleted",
+	)
+
+	mmCmd.AddCommand(purgeCmd)
+}
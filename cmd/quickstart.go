@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/git"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultQuickstartMaxFiles = 500
+	defaultQuickstartQuery    = "where is the entry point of the application"
+)
+
+// proposedConfig is the configuration proposed when none exists, the local backend needs no chroma server
+const proposedConfig = `store:
+  backend: local
+  path: $HOME/.mm/local/store.gob
+  scope: project
+`
+
+var (
+	quickstartMaxFiles    int
+	quickstartQuery       string
+	quickstartWriteConfig bool
+)
+
+var quickstartCmd = &cobra.Command{
+	Use:   "quickstart [directory]",
+	Short: "Index a sample of the repository and run a test query",
+	Long: `Detect the repository of the directory (the current one by default), propose a configuration if there is none,
+index a bounded sample of its files, run a test query, and report the timings, to check mm works on the repository
+before indexing all of it`,
+	Example: `  mm quickstart
+  mm quickstart ~/src/billing --max-files 200 --query "how are invoices taxed"
+  mm quickstart --write-config`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.Logger.With().Timestamp().Caller().Logger()
+		ctx := logger.WithContext(cmd.Context())
+
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		root, err := git.Root(ctx, dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("repository:    %s\n", root)
+
+		path := os.ExpandEnv(configPath)
+		_, err = os.Stat(path)
+		configExists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to check configuration %s: %w", path, err)
+		}
+		if !configExists {
+			fmt.Printf("configuration: none found at %s, proposing:\n\n%s\n\n", path, indent(strings.TrimSpace(proposedConfig), "  "))
+			if quickstartWriteConfig {
+				if err := writeProposedConfig(path); err != nil {
+					return err
+				}
+				fmt.Printf("configuration: written to %s\n", path)
+				configExists = true
+			}
+		} else {
+			fmt.Printf("configuration: %s\n", path)
+		}
+
+		if projectDir == "" {
+			projectDir = root
+		}
+		cfg, err := quickstartConfig(configExists)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("backend:       %s\n", cfg.Store.Backend)
+		fmt.Printf("collection:    %s\n", cfg.Store.CollectionName())
+
+		total := 0
+		err = code.FindInDirectory(root, code.NewGenericParser().Extensions(), func(string) error {
+			total++
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find files in directory %s: %w", root, err)
+		}
+		fmt.Printf("source files:  %d, indexing up to %d\n\n", total, quickstartMaxFiles)
+
+		// estimated before the sample is indexed, to cover the whole repository
+		cost, err := quickstartCost(ctx, cfg, root)
+		if err != nil {
+			return err
+		}
+
+		run, err := indexDirectories(ctx, cfg, []string{root}, nil, quickstartMaxFiles)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\ntest query:    %q\n\n", quickstartQuery)
+		start := time.Now()
+		if err := runSearch(ctx, cfg, []string{quickstartQuery}); err != nil {
+			return err
+		}
+		queryElapsed := time.Since(start)
+
+		printQuickstartReport(run, total, queryElapsed, cost)
+		return nil
+	},
+}
+
+// quickstartConfig returns the configuration of the quickstart, the proposed one if no configuration exists
+func quickstartConfig(configExists bool) (*config.Config, error) {
+	if configExists || tenant != "" || collection != "" {
+		return loadConfig()
+	}
+	cfg := config.Default()
+	cfg.Store.Backend = config.LocalBackend
+	return cfg.ForProject(projectDir), nil
+}
+
+func writeProposedConfig(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create configuration directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(proposedConfig), 0644); err != nil {
+		return fmt.Errorf("failed to write configuration %s: %w", path, err)
+	}
+	return nil
+}
+
+// printQuickstartReport prints the timings of the sample, and extrapolates them to the whole repository
+func printQuickstartReport(run indexRun, total int, queryElapsed time.Duration, cost string) {
+	fmt.Println()
+	fmt.Printf("indexed:       %d file(s) in %s\n", run.files, run.elapsed.Round(time.Millisecond))
+	if run.files > 0 {
+		perFile := run.elapsed / time.Duration(run.files)
+		fmt.Printf("per file:      %s\n", perFile.Round(time.Microsecond))
+		if run.truncated {
+			estimate := perFile * time.Duration(total)
+			fmt.Printf("full index:    ~%s estimated for %d file(s), run mm --index %s\n", estimate.Round(time.Second), total, projectDir)
+		}
+	}
+	fmt.Printf("query:         %s, including the start of the model\n", queryElapsed.Round(time.Millisecond))
+	fmt.Printf("cost:          %s\n", cost)
+}
+
+// quickstartCost returns the cost of indexing the repository with the configured provider, the tokens of its chunks
+// are only counted for a hosted one, see estimateIndex
+func quickstartCost(ctx context.Context, cfg *config.Config, root string) (string, error) {
+	model := embeddingModel(cfg)
+	hosted, isHosted := hostedConfig(cfg)
+	if !isHosted {
+		return fmt.Sprintf("free, the model %s runs locally", model), nil
+	}
+	provider, err := newProvider(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = provider.Close()
+	}()
+	estimate, err := estimateChunks(ctx, cfg, provider, []string{root}, nil)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"%s for the ~%d token(s) of the whole repository, embedded by %s",
+		estimateCost(cfg, model, estimate.tokens, hosted),
+		estimate.tokens,
+		model,
+	), nil
+}
+
+func init() {
+	quickstartCmd.Flags().IntVar(
+		&quickstartMaxFiles,
+		"max-files",
+		defaultQuickstartMaxFiles,
+		"Maximum number of files indexed by the sample",
+	)
+	quickstartCmd.Flags().StringVar(
+		&quickstartQuery,
+		"query",
+		defaultQuickstartQuery,
+		"Query run once the sample is indexed",
+	)
+	quickstartCmd.Flags().BoolVar(
+		&quickstartWriteConfig,
+		"write-config",
+		false,
+		"Write the proposed configuration when none exists",
+	)
+
+	mmCmd.AddCommand(quickstartCmd)
+}
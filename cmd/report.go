@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "List the files crashing the parser",
+	Long: `List the files on which the parser crashed (panic or timeout) while indexing, the quarantined ones are skipped by
+the indexing runs until they change`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		indexManifest, err := manifest.Load(manifestPath(cfg))
+		if err != nil {
+			return err
+		}
+
+		failures := indexManifest.Failures()
+		if len(failures) == 0 {
+			fmt.Println("No parser crashes.")
+			return nil
+		}
+		paths := make([]string, 0, len(failures))
+		for path := range failures {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		quarantined := 0
+		for _, path := range paths {
+			failure := failures[path]
+			state := "failing"
+			if failure.Quarantined {
+				state = "quarantined"
+				quarantined++
+			}
+			fmt.Printf("%-12s %s (%d crash(es), last: %s)\n", state, path, failure.Count, failure.LastError)
+		}
+		fmt.Printf("%d file(s) crashing the parser, %d quarantined\n", len(paths), quarantined)
+		return nil
+	},
+}
+
+func init() {
+	mmCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultSampleSize      = 10
+	defaultSampleNeighbors = 3
+)
+
+var (
+	sampleSize      int
+	sampleType      string
+	sampleNeighbors int
+	sampleSeed      uint64
+)
+
+var sampleCmd = &cobra.Command{
+	Use:   "sample",
+	Short: "Print random chunks with their nearest neighbors",
+	Long: `Print random indexed chunks, with their metadata and their nearest neighbors, to check at a glance whether the
+chunking or the embeddings regressed after a change`,
+	Example: `  mm sample --n 50 --type functions
+  mm sample --n 5 --neighbors 10 --seed 42`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			inspector, ok := vectorStore.(store.Inspector)
+			if !ok {
+				return fmt.Errorf("store backend %s cannot be inspected", cfg.Store.Backend)
+			}
+			var where map[string]any
+			if sampleType != "" {
+				where = map[string]any{"chunk_type": sampleType}
+			}
+			records, err := inspector.Peek(0, where)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				fmt.Println("No chunks found.")
+				return nil
+			}
+
+			seed := sampleSeed
+			if !cmd.Flags().Changed("seed") {
+				seed = rand.Uint64()
+			}
+			random := rand.New(rand.NewPCG(seed, seed))
+			random.Shuffle(len(records), func(i, j int) {
+				records[i], records[j] = records[j], records[i]
+			})
+			total := len(records)
+			records = records[:min(sampleSize, total)]
+
+			for i, record := range records {
+				fmt.Printf("%d. %s %s [%v]\n", i+1, recordLocation(record.Metadata), record.Id, record.Metadata["chunk_type"])
+				fmt.Println(indent(record.Document, "   "))
+				if sampleNeighbors == 0 {
+					fmt.Println()
+					continue
+				}
+
+				// the chunk is its own closest neighbor
+				neighbors, err := vectorStore.Query(record.Embedding, sampleNeighbors+1, nil)
+				if err != nil {
+					return fmt.Errorf("failed to find the neighbors of %s: %w", record.Id, err)
+				}
+				fmt.Println("   neighbors:")
+				for _, neighbor := range neighbors {
+					if neighbor.Id == record.Id {
+						continue
+					}
+					metadata := neighbor.Metadata
+					fmt.Printf(
+						"     %.3f %s:%d-%d %s\n",
+						neighbor.Distance,
+						metadata.FilePath,
+						metadata.StartLine,
+						metadata.EndLine,
+						neighbor.Id,
+					)
+				}
+				fmt.Println()
+			}
+			fmt.Printf("seed %d, sampled %d of %d chunk(s)\n", seed, len(records), total)
+			return nil
+		})
+	},
+}
+
+func recordLocation(metadata map[string]any) string {
+	return fmt.Sprintf("%v:%v-%v", metadata["file_path"], metadata["start_line"], metadata["end_line"])
+}
+
+func indent(text string, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+func init() {
+	sampleCmd.Flags().IntVarP(
+		&sampleSize,
+		"n",
+		"n",
+		defaultSampleSize,
+		"Number of chunks to sample",
+	)
+	sampleCmd.Flags().StringVarP(
+		&sampleType,
+		"type",
+		"t",
+		"",
+		"Only sample the chunks of this type (functions, methods, classes, file, ...)",
+	)
+	sampleCmd.Flags().IntVar(
+		&sampleNeighbors,
+		"neighbors",
+		defaultSampleNeighbors,
+		"Number of nearest neighbors to show for each chunk",
+	)
+	sampleCmd.Flags().Uint64Var(
+		&sampleSeed,
+		"seed",
+		0,
+		"Seed of the sampling, to get the same chunks again (random by default)",
+	)
+
+	mmCmd.AddCommand(sampleCmd)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/render"
+	"github.com/a-peyrard/mm/internal/schema"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+)
+
+func runSearch(ctx context.Context, cfg *config.Config, args []string) error {
+	logger := zerolog.Ctx(ctx)
+
+	text, filter := search.ParseQuery(strings.Join(args, " "))
+	opts := []search.Option{
+		search.WithLimit(limit),
+		search.WithRecencyBoost(recent),
+		search.WithFilter(filter),
+		search.WithDuplicates(keepDuplicates || cfg.Search.KeepDuplicates),
+		search.WithHooks(mmHooks),
+		search.WithExplanation(explain),
+	}
+	if like != "" {
+		snippet, err := os.ReadFile(like)
+		if err != nil {
+			return fmt.Errorf("failed to read example %s: %w", like, err)
+		}
+		opts = append(opts, search.WithExample(string(snippet), likeWeight))
+	}
+	if since != "" {
+		sinceTime, err := search.ParseSince(since, time.Now())
+		if err != nil {
+			return err
+		}
+		opts = append(opts, search.WithSince(sinceTime))
+	}
+
+	indexManifest, err := manifest.Load(manifestPath(cfg))
+	if err != nil {
+		return err
+	}
+	if err := checkModel(cfg, indexManifest); err != nil {
+		return err
+	}
+	pending, err := schema.Check(indexManifest)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		logger.Warn().Msg("the index is migrated by the next indexing run, results may be incomplete until then")
+	}
+
+	// the files are tracked by the manifest of the primary embeddings, the secondary ones have their own collection
+	embeddingsCfg, err := cfg.ForEmbeddings(embeddingsName)
+	if err != nil {
+		return err
+	}
+	vectorStore, err := openStore(ctx, embeddingsCfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = vectorStore.Close()
+	}()
+
+	provider, err := newProvider(ctx, embeddingsCfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = provider.Close()
+	}()
+	if err := provider.WaitReady(); err != nil {
+		return fmt.Errorf("failed to start the embedding provider: %w", err)
+	}
+	if err := checkStore(embeddingsCfg, vectorStore, provider.Dimensions()); err != nil {
+		return err
+	}
+
+	sources := []search.Source{{Querier: store.Querier{Embedder: provider, Store: vectorStore}}}
+	others := append(slices.Clone(cfg.Search.Collections), alsoIn...)
+	// the configuration is scoped to the project, the other collections are not
+	base, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range others {
+		if err := config.ValidateCollectionName(name); err != nil {
+			return err
+		}
+		otherCfg, err := base.ForCollection(name).ForEmbeddings(embeddingsName)
+		if err != nil {
+			return err
+		}
+		other, err := openStore(ctx, otherCfg)
+		if err != nil {
+			return fmt.Errorf("failed to open collection %s: %w", name, err)
+		}
+		defer func() {
+			_ = other.Close()
+		}()
+		if err := checkStore(otherCfg, other, provider.Dimensions()); err != nil {
+			return fmt.Errorf("failed to search collection %s: %w", name, err)
+		}
+		sources = append(sources, search.Source{Collection: name, Querier: store.Querier{Embedder: provider, Store: other}})
+	}
+	if len(sources) > 1 {
+		sources[0].Collection = collectionLabel(cfg)
+	}
+	results, err := search.SearchCollections(sources, text, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to search: %w", err)
+	}
+	recordMatches(ctx, cfg, results)
+
+	renderer := render.New(os.Stdout, render.ColorEnabled(os.Stdout, noColor))
+	if outputFormat, _ := render.ParseFormat(format); outputFormat != render.TextFormat {
+		return renderer.ToolResult(outputFormat, toolCallId, results)
+	}
+	renderer.SearchResults(results)
+	if text != "" {
+		// the assets are not embedded, they can only be located by their path
+		found := indexManifest.FindAssets(text)
+		renderer.Assets(found[:min(len(found), limit)])
+	}
+
+	return nil
+}
+
+// collectionLabel names the collection of the configuration in the results, the directory of the file of a local
+// collection
+func collectionLabel(cfg *config.Config) string {
+	if cfg.Store.Backend == config.LocalBackend {
+		return filepath.Base(filepath.Dir(os.ExpandEnv(cfg.Store.Path)))
+	}
+	return cfg.Store.CollectionName()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// secondaryIndex stores the secondary embeddings of the chunks indexed by a run, see config.SecondaryConfig, the
+	// chunks are parsed once, and their files tracked by the manifest of the primary embeddings
+	secondaryIndex struct {
+		cfg      *config.Config
+		embedder embedding.ChunkEmbedder
+		store    store.VectorStore
+		publish  func() error
+		stop     func()
+	}
+
+	// mirroredStore removes the chunks of the files from the store of the secondary embeddings as well, the upserts
+	// only go to the primary store, see secondaryIndex.upsert
+	mirroredStore struct {
+		store.VectorStore
+		secondary store.VectorStore
+	}
+)
+
+// openSecondaryIndex opens the store of the secondary embeddings and starts their embedder, nil when none are
+// configured, or when the run does not compute embeddings, the files indexed before the secondary embeddings were
+// configured are indexed again, their primary embeddings being found in the cache
+func openSecondaryIndex(
+	ctx context.Context,
+	cfg *config.Config,
+	indexManifest *manifest.Manifest,
+	cache *embedding.Cache,
+) (*secondaryIndex, error) {
+	if metadataOnly || cfg.Indexer.Secondary.Embedder == "" {
+		return nil, nil
+	}
+	secondaryCfg, err := cfg.ForEmbeddings(cfg.Indexer.Secondary.Name)
+	if err != nil {
+		return nil, err
+	}
+	vectorStore, publish, err := openIndexedStore(ctx, secondaryCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the store of the %s embeddings: %w", cfg.Indexer.Secondary.Name, err)
+	}
+	if err := checkStore(secondaryCfg, vectorStore, embedderDimensions(secondaryCfg, nil)); err != nil {
+		_ = vectorStore.Close()
+		return nil, err
+	}
+	stats, err := vectorStore.Stats()
+	if err != nil {
+		_ = vectorStore.Close()
+		return nil, err
+	}
+	if stats.Records == 0 {
+		backfill(ctx, indexManifest)
+	}
+	embedder, stop, err := startEmbedder(ctx, secondaryCfg)
+	if err != nil {
+		_ = vectorStore.Close()
+		return nil, err
+	}
+	if cache != nil {
+		embedder = cache.Wrap(embedder, embeddingModel(secondaryCfg))
+	}
+	zerolog.Ctx(ctx).Info().
+		Str("name", cfg.Indexer.Secondary.Name).
+		Str("model", embeddingModel(secondaryCfg)).
+		Str("collection", secondaryCfg.Store.CollectionName()).
+		Msg("Secondary embeddings enabled")
+	return &secondaryIndex{cfg: secondaryCfg, embedder: embedder, store: vectorStore, publish: publish, stop: stop}, nil
+}
+
+// backfill marks the indexed files as modified, so their secondary embeddings are computed by the run, the evicted
+// files stay out of the index
+func backfill(ctx context.Context, indexManifest *manifest.Manifest) {
+	files := 0
+	for _, path := range indexManifest.Paths() {
+		entry, _ := indexManifest.Get(path)
+		if entry.Evicted {
+			continue
+		}
+		// neither skipped as unchanged, nor as touched but not modified
+		entry.ModifiedAt = 0
+		entry.Hash = ""
+		indexManifest.Put(path, entry)
+		files++
+	}
+	if files > 0 {
+		zerolog.Ctx(ctx).Info().Int("files", files).Msg("Indexing the files again to compute their secondary embeddings")
+	}
+}
+
+// upsert embeds the chunks with the secondary embedder, and stores them
+func (s *secondaryIndex) upsert(chunks []code.Chunk) error {
+	embeddings, err := s.embedder.EmbedDocuments(chunks)
+	if err != nil {
+		return fmt.Errorf("failed to compute the %s embeddings: %w", s.cfg.Indexer.Embedder, err)
+	}
+	records, err := store.NewRecords(chunks, embeddings)
+	if err != nil {
+		return err
+	}
+	return s.store.Upsert(records)
+}
+
+// close stops the embedder, records the model with the collection, and publishes it
+func (s *secondaryIndex) close() error {
+	s.stop()
+	if err := store.RecordModel(s.store, embeddingModel(s.cfg)); err != nil {
+		_ = s.store.Close()
+		return err
+	}
+	if err := s.store.Close(); err != nil {
+		return fmt.Errorf("failed to close the store of the secondary embeddings: %w", err)
+	}
+	return s.publish()
+}
+
+// mirror returns the store removing the chunks from the secondary store as well, the store itself without secondary
+// embeddings
+func (s *secondaryIndex) mirror(vectorStore store.VectorStore) store.VectorStore {
+	if s == nil {
+		return vectorStore
+	}
+	return mirroredStore{VectorStore: vectorStore, secondary: s.store}
+}
+
+func (m mirroredStore) DeleteByFile(filePath string) error {
+	if err := m.VectorStore.DeleteByFile(filePath); err != nil {
+		return err
+	}
+	return m.secondary.DeleteByFile(filePath)
+}
+
+func (m mirroredStore) DeleteAll() error {
+	if err := m.VectorStore.DeleteAll(); err != nil {
+		return err
+	}
+	return m.secondary.DeleteAll()
+}
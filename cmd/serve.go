@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/health"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/profile"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/serve"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+var (
+	serveAddress string
+	servePprof   bool
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Expose the search over http",
+	Long: `Expose the search over http (POST /search, and POST /lines for the chunks covering a line range), and the
+edition of the chunks (POST /delete and POST /retag, as mm delete and mm retag do), either for the configured store
+without authentication, or for each tenant defined in the serve section of the configuration, authenticated by their bearer token`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tenant != "" {
+			return fmt.Errorf("--tenant cannot be used with serve, all the tenants are served")
+		}
+		// without tenants, the store of the project is served
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		address := cfg.Serve.Address
+		if cmd.Flags().Changed("address") {
+			address = serveAddress
+		}
+		return runServe(cmd.Context(), cfg, address, 0)
+	},
+}
+
+// runServe serves the search until the process is interrupted, the server is reported as not ready for drainDelay
+// before it stops accepting requests, so the load balancers stop sending them
+func runServe(ctx context.Context, cfg *config.Config, address string, drainDelay time.Duration) error {
+	logger := log.Logger.With().Timestamp().Caller().Logger()
+	ctx, stop := signal.NotifyContext(logger.WithContext(ctx), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the provider computing the embeddings of the queries is shared by all the tenants, it is closed once the server
+	// is shut down rather than killed by the interruption, so the requests being served complete
+	provider, err := newProvider(context.WithoutCancel(ctx), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = provider.Close()
+	}()
+	ready := make(chan struct{})
+	var readyErr error
+	go func() {
+		readyErr = provider.WaitReady()
+		close(ready)
+	}()
+	select {
+	case <-ready:
+		if readyErr != nil {
+			return fmt.Errorf("failed to start the embedding provider: %w", readyErr)
+		}
+	case <-ctx.Done():
+		logger.Info().Msg("interrupted before the embedding provider was ready")
+		return nil
+	}
+
+	tenants, closeStores, err := buildTenants(ctx, cfg, provider)
+	defer closeStores()
+	if err != nil {
+		return err
+	}
+
+	server := serve.NewServer(&logger, tenants...)
+	var handler http.Handler = server
+	if servePprof {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		profile.RegisterHandlers(mux)
+		handler = mux
+	}
+	httpServer := &http.Server{
+		Addr:    address,
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Drain()
+		if drainDelay > 0 {
+			logger.Info().Dur("delay", drainDelay).Msg("draining before shutdown")
+			time.Sleep(drainDelay)
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info().Str("address", address).Int("tenants", len(cfg.Serve.Tenants)).Msg("serving search")
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+// buildTenants opens the store of each tenant, or the configured store as an anonymous tenant if none is defined,
+// the returned function closes all the opened stores
+func buildTenants(ctx context.Context, cfg *config.Config, provider embedding.EmbeddingProvider) ([]serve.Tenant, func(), error) {
+	var stores []store.VectorStore
+	closeStores := func() {
+		for _, s := range stores {
+			if err := s.Close(); err != nil {
+				log.Error().Err(err).Msg("failed to close store")
+			}
+		}
+	}
+
+	if len(cfg.Serve.Tenants) == 0 {
+		vectorStore, err := openFollowingStore(ctx, cfg)
+		if err != nil {
+			return nil, closeStores, err
+		}
+		stores = append(stores, vectorStore)
+		if err := checkStore(cfg, vectorStore, provider.Dimensions()); err != nil {
+			return nil, closeStores, err
+		}
+		querier := store.Querier{Embedder: provider, Store: vectorStore}
+		return []serve.Tenant{{
+			Name:       "default",
+			Querier:    querier,
+			Collection: cfg.Store.CollectionName(),
+			Stats:      collectionStats(cfg, vectorStore),
+			Lines:      collectionLines(cfg, vectorStore),
+			Delete:     collectionDelete(cfg, vectorStore),
+			Retag:      collectionRetag(vectorStore),
+		}}, closeStores, nil
+	}
+
+	var tenants []serve.Tenant
+	for _, tenantCfg := range cfg.Serve.Tenants {
+		// checked not to be empty once expanded by the validation of the configuration
+		token := os.ExpandEnv(tenantCfg.Token)
+		scoped, err := cfg.ForTenant(tenantCfg.Name)
+		if err != nil {
+			return nil, closeStores, err
+		}
+		vectorStore, err := openFollowingStore(ctx, scoped)
+		if err != nil {
+			return nil, closeStores, fmt.Errorf("failed to open store of tenant %s: %w", tenantCfg.Name, err)
+		}
+		stores = append(stores, vectorStore)
+		if err := checkStore(scoped, vectorStore, provider.Dimensions()); err != nil {
+			return nil, closeStores, fmt.Errorf("failed to serve tenant %s: %w", tenantCfg.Name, err)
+		}
+
+		tenants = append(tenants, serve.Tenant{
+			Name:    tenantCfg.Name,
+			Token:   token,
+			Querier: store.Querier{Embedder: provider, Store: vectorStore},
+			Quota: serve.Quota{
+				QueriesPerMinute: tenantCfg.Quota.QueriesPerMinute,
+				MaxResults:       tenantCfg.Quota.MaxResults,
+			},
+			Collection: scoped.Store.CollectionName(),
+			Stats:      collectionStats(scoped, vectorStore),
+			Lines:      collectionLines(scoped, vectorStore),
+			Delete:     collectionDelete(scoped, vectorStore),
+			Retag:      collectionRetag(vectorStore),
+		})
+	}
+	return tenants, closeStores, nil
+}
+
+// openFollowingStore opens the store, following the generations published by the indexing runs if enabled
+func openFollowingStore(ctx context.Context, cfg *config.Config) (store.VectorStore, error) {
+	if !cfg.Store.Generations || cfg.Store.Backend == config.LocalBackend {
+		return openStore(ctx, cfg)
+	}
+	return store.NewFollower(store.NewGenerations(generationsPath(cfg)), func(generation int) (store.VectorStore, error) {
+		return openCollection(ctx, generationConfig(cfg, generation))
+	})
+}
+
+// collectionStats returns a function collecting the stats of the collection, the manifest is read again on each call
+// as the collection is indexed by other processes
+func collectionStats(cfg *config.Config, vectorStore store.VectorStore) func() (health.Stats, error) {
+	return func() (health.Stats, error) {
+		indexManifest, err := manifest.Load(manifestPath(cfg))
+		if err != nil {
+			return health.Stats{}, err
+		}
+		return health.Collect(cfg.Store.CollectionName(), cfg.Store.Backend, vectorStore, indexManifest, cfg.Serve.MaxIndexAge, time.Now())
+	}
+}
+
+// collectionLines returns a function retrieving the chunks covering a line range of the collection, nil if the store
+// cannot be inspected
+func collectionLines(cfg *config.Config, vectorStore store.VectorStore) func(search.LineRange, int) (search.LinesResult, error) {
+	inspector, ok := vectorStore.(store.InspectableStore)
+	if !ok {
+		return nil
+	}
+	return func(lines search.LineRange, related int) (search.LinesResult, error) {
+		indexManifest, err := manifest.Load(manifestPath(cfg))
+		if err != nil {
+			return search.LinesResult{}, err
+		}
+		lines.FilePath, err = indexedFilePath(indexManifest, lines.FilePath)
+		if err != nil {
+			return search.LinesResult{}, err
+		}
+		return search.Lines(inspector, lines, related)
+	}
+}
+
+// collectionDelete returns a function deleting the chunks of the collection matching a selector, as mm delete does,
+// nil if the store cannot be edited
+func collectionDelete(cfg *config.Config, vectorStore store.VectorStore) func(*store.Selector) ([]store.Record, error) {
+	editable, ok := vectorStore.(store.InspectableStore)
+	if !ok {
+		return nil
+	}
+	return func(selector *store.Selector) ([]store.Record, error) {
+		indexManifest, err := manifest.Load(manifestPath(cfg))
+		if err != nil {
+			return nil, err
+		}
+		deleted, err := store.DeleteWhere(editable, selector)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(deleted))
+		for i, record := range deleted {
+			ids[i] = record.Id
+		}
+		// the files of the deleted chunks are not indexed again until they change
+		indexManifest.RemoveChunks(ids)
+		return deleted, indexManifest.Save()
+	}
+}
+
+// collectionRetag returns a function changing the metadata of the chunks of the collection matching a selector, as
+// mm retag does, nil if the store cannot be edited
+func collectionRetag(vectorStore store.VectorStore) func(*store.Selector, map[string]any, []string) ([]store.Record, error) {
+	editable, ok := vectorStore.(store.InspectableStore)
+	if !ok {
+		return nil
+	}
+	return func(selector *store.Selector, set map[string]any, unset []string) ([]store.Record, error) {
+		return store.RetagWhere(editable, selector, set, unset)
+	}
+}
+
+func init() {
+	serveCmd.Flags().StringVar(
+		&serveAddress,
+		"address",
+		"",
+		"Address to listen on (default is the serve address of the configuration, localhost:7700)",
+	)
+	serveCmd.Flags().BoolVar(
+		&servePprof,
+		"pprof",
+		false,
+		"Expose the profiling endpoints under /debug/pprof/, without authentication",
+	)
+	_ = serveCmd.Flags().MarkHidden("pprof")
+
+	mmCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/snapshot"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	snapshotConfigName    = "config.yaml"
+	snapshotManifestsName = "manifests"
+	snapshotDataName      = "data"
+	snapshotStoreName     = "store.gob"
+	snapshotChromaName    = "chroma"
+)
+
+var (
+	snapshotForce      bool
+	snapshotWithConfig bool
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Back up or restore the index",
+	Long: `Package the index (the chroma directory or the local store), its manifest, and the configuration into a single
+archive, so a built index can be backed up or shared with teammates. The manifest records absolute paths, a restored
+index is only reused as is where the repository is checked out at the same path`,
+	Example: `  mm snapshot create index.tar.gz
+  mm snapshot restore index.tar.gz --force`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create file",
+	Short: "Package the index into an archive",
+	Long:  `Package the index into an archive, no indexing run should be in progress while it is created`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		path := args[0]
+		if _, err := os.Stat(path); err == nil && !snapshotForce {
+			return fmt.Errorf("%s exists, use --force to replace it", path)
+		}
+
+		tmp := path + ".tmp"
+		file, err := os.Create(tmp)
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot %s: %w", tmp, err)
+		}
+		if err := writeSnapshot(file, cfg); err != nil {
+			_ = file.Close()
+			_ = os.Remove(tmp)
+			return err
+		}
+		if err := file.Close(); err != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("failed to write snapshot %s: %w", tmp, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("failed to replace snapshot %s: %w", path, err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat snapshot %s: %w", path, err)
+		}
+		fmt.Printf("Snapshot of the %s index %s written to %s (%s).\n", cfg.Store.Backend, cfg.Store.CollectionName(), path, formatBytes(info.Size()))
+		return nil
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore file",
+	Short: "Restore the index from an archive",
+	Long: `Restore the index from an archive created by mm snapshot create. The local store is restored in the collection
+of the current project, the chroma directory is restored as a whole, the chroma server must be stopped meanwhile`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open snapshot %s: %w", args[0], err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		wd := workingDirectory()
+		if err := os.MkdirAll(wd, 0755); err != nil {
+			return fmt.Errorf("failed to create working directory: %w", err)
+		}
+		// extracted next to the restored data, so it can be moved in place
+		extracted, err := os.MkdirTemp(wd, "snapshot-")
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(extracted)
+		}()
+
+		metadata, err := snapshot.Extract(file, extracted)
+		if err != nil {
+			return err
+		}
+		if snapshotWithConfig {
+			if err := restoreConfig(extracted); err != nil {
+				return err
+			}
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if metadata.Backend != cfg.Store.Backend {
+			return fmt.Errorf("snapshot of a %s index, the configured backend is %s", metadata.Backend, cfg.Store.Backend)
+		}
+		if readOnlyIndex(cfg) {
+			return fmt.Errorf("cannot restore the snapshot: %w", store.ErrReadOnly)
+		}
+
+		switch {
+		case cfg.Store.Backend == config.LocalBackend:
+			err = restoreLocal(extracted, cfg)
+		case cfg.Store.Chroma.Remote():
+			err = fmt.Errorf("cannot restore the snapshot in the remote chroma server %s", cfg.Store.Chroma.Host)
+		default:
+			err = restoreChroma(extracted, wd)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf(
+			"Restored the %s index %s, created %s by mm %s.\n",
+			metadata.Backend,
+			metadata.Collection,
+			metadata.CreatedAt.Format(time.RFC3339),
+			metadata.MMVersion,
+		)
+		return nil
+	},
+}
+
+// writeSnapshot packages the index of the configured store, with its manifest and the configuration
+func writeSnapshot(w io.Writer, cfg *config.Config) error {
+	writer, err := snapshot.NewWriter(w, snapshot.Metadata{
+		CreatedAt:  time.Now().UTC(),
+		MMVersion:  version,
+		Backend:    cfg.Store.Backend,
+		Collection: cfg.Store.CollectionName(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if path := os.ExpandEnv(configPath); fileExists(path) {
+		if err := writer.AddFile(snapshotConfigName, path); err != nil {
+			return err
+		}
+	}
+
+	wd := workingDirectory()
+	switch cfg.Store.Backend {
+	case config.LocalBackend:
+		path := os.ExpandEnv(cfg.Store.Path)
+		if !fileExists(path) {
+			return fmt.Errorf("no index at %s, nothing to snapshot", path)
+		}
+		if err := writer.AddFile(filepath.ToSlash(filepath.Join(snapshotDataName, snapshotStoreName)), path); err != nil {
+			return err
+		}
+		if manifest := manifestPath(cfg); fileExists(manifest) {
+			name := filepath.ToSlash(filepath.Join(snapshotManifestsName, filepath.Base(manifest)))
+			if err := writer.AddFile(name, manifest); err != nil {
+				return err
+			}
+		}
+	case config.QdrantBackend:
+		return fmt.Errorf("snapshots of the qdrant backend are managed by the qdrant server")
+	default:
+		if cfg.Store.Chroma.Remote() {
+			return fmt.Errorf("snapshots of a remote chroma server are managed by the server")
+		}
+		// the chroma directory holds all the collections, so do the manifests
+		if err := writer.AddDir(filepath.ToSlash(filepath.Join(snapshotDataName, snapshotChromaName)), chromaPath()); err != nil {
+			return fmt.Errorf("failed to add chroma directory: %w", err)
+		}
+		if manifests := filepath.Join(wd, snapshotManifestsName); fileExists(manifests) {
+			if err := writer.AddDir(snapshotManifestsName, manifests); err != nil {
+				return fmt.Errorf("failed to add manifests: %w", err)
+			}
+		}
+	}
+
+	return writer.Close()
+}
+
+// restoreConfig installs the configuration of the snapshot, an existing configuration is only replaced with --force
+func restoreConfig(extracted string) error {
+	source := filepath.Join(extracted, snapshotConfigName)
+	if !fileExists(source) {
+		return fmt.Errorf("the snapshot has no configuration")
+	}
+	target := os.ExpandEnv(configPath)
+	if fileExists(target) && !snapshotForce {
+		return fmt.Errorf("configuration %s exists, use --force to replace it", target)
+	}
+	return installFile(source, target)
+}
+
+// restoreLocal installs the store in the collection of the current project, along with its manifest
+func restoreLocal(extracted string, cfg *config.Config) error {
+	target := os.ExpandEnv(cfg.Store.Path)
+	if fileExists(target) && !snapshotForce {
+		return fmt.Errorf("an index exists at %s, use --force to replace it", target)
+	}
+	if err := installFile(filepath.Join(extracted, snapshotDataName, snapshotStoreName), target); err != nil {
+		return err
+	}
+
+	manifests, err := os.ReadDir(filepath.Join(extracted, snapshotManifestsName))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(manifests) == 0) {
+		// without manifest, the next indexing run checks all the files again
+		if err := os.Remove(manifestPath(cfg)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove manifest: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifests of the snapshot: %w", err)
+	}
+	return installFile(filepath.Join(extracted, snapshotManifestsName, manifests[0].Name()), manifestPath(cfg))
+}
+
+// restoreChroma replaces the chroma directory, and the manifests of its collections, the current directory is moved
+// aside, and only removed once the one of the snapshot is in place
+func restoreChroma(extracted string, wd string) error {
+	source := filepath.Join(extracted, snapshotDataName, snapshotChromaName)
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		return fmt.Errorf("the snapshot has no chroma directory")
+	}
+	target := chromaPath()
+	entries, err := os.ReadDir(target)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read chroma directory %s: %w", target, err)
+	}
+	if len(entries) > 0 && !snapshotForce {
+		return fmt.Errorf("an index exists at %s, use --force to replace it", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", target, err)
+	}
+	previous := ""
+	if err == nil {
+		previous = target + ".previous"
+		if fileExists(previous) {
+			return fmt.Errorf("the chroma directory of a failed restore is at %s, remove it or move it back first", previous)
+		}
+		if err := os.Rename(target, previous); err != nil {
+			return fmt.Errorf("failed to move chroma directory %s aside: %w", target, err)
+		}
+	}
+	if err := os.Rename(source, target); err != nil {
+		if previous != "" {
+			if restoreErr := os.Rename(previous, target); restoreErr != nil {
+				return fmt.Errorf("failed to restore chroma directory %s, the previous one is at %s: %w", target, previous, err)
+			}
+		}
+		return fmt.Errorf("failed to restore chroma directory %s: %w", target, err)
+	}
+	if previous != "" {
+		if err := os.RemoveAll(previous); err != nil {
+			return fmt.Errorf("failed to remove previous chroma directory %s: %w", previous, err)
+		}
+	}
+
+	manifests, err := os.ReadDir(filepath.Join(extracted, snapshotManifestsName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifests of the snapshot: %w", err)
+	}
+	for _, manifest := range manifests {
+		source := filepath.Join(extracted, snapshotManifestsName, manifest.Name())
+		if err := installFile(source, filepath.Join(wd, snapshotManifestsName, manifest.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installFile copies the file to the target, which is replaced atomically
+func installFile(source string, target string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", target, err)
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func init() {
+	snapshotCreateCmd.Flags().BoolVar(
+		&snapshotForce,
+		"force",
+		false,
+		"Replace an existing archive",
+	)
+	snapshotRestoreCmd.Flags().BoolVar(
+		&snapshotForce,
+		"force",
+		false,
+		"Replace the existing index, and configuration with --with-config",
+	)
+	snapshotRestoreCmd.Flags().BoolVar(
+		&snapshotWithConfig,
+		"with-config",
+		false,
+		"Also restore the configuration packaged in the snapshot",
+	)
+
+	snapshotCmd.AddCommand(snapshotCreateCmd, snapshotRestoreCmd)
+	mmCmd.AddCommand(snapshotCmd)
+}
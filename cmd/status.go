@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/health"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/schema"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+// statusReport is the status of the index printed with --json
+type statusReport struct {
+	health.Stats
+	Dimensions       int                      `json:"dimensions"`
+	Schema           string                   `json:"schema"`
+	WorkingDirectory string                   `json:"working_directory"`
+	DiskUsage        int64                    `json:"disk_usage_bytes"`
+	Languages        []manifest.LanguageStats `json:"languages"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the health of the index",
+	Long: `Show the content of the index (chunks, files, languages and chunk types), how it was built, and the disk usage
+of mm, as JSON with --json for dashboards`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			stats, err := vectorStore.Stats()
+			if err != nil {
+				return err
+			}
+			indexManifest, err := manifest.Load(manifestPath(cfg))
+			if err != nil {
+				return err
+			}
+			wd := workingDirectory()
+			usage, err := diskUsage(wd)
+			if err != nil {
+				return err
+			}
+			collectionHealth, err := health.Collect(cfg.Store.CollectionName(), cfg.Store.Backend, vectorStore, indexManifest, cfg.Serve.MaxIndexAge, time.Now())
+			if err != nil {
+				return err
+			}
+			report := statusReport{
+				Stats:            collectionHealth,
+				Dimensions:       stats.Dimensions,
+				Schema:           schemaStatus(indexManifest),
+				WorkingDirectory: wd,
+				DiskUsage:        usage,
+				Languages:        indexManifest.Stats(),
+			}
+			if report.Model == "" {
+				report.Model = embedding.DefaultModel
+			}
+
+			if statusJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			}
+			printStatus(report)
+			return nil
+		})
+	},
+}
+
+// printStatus writes the status of the index as text
+func printStatus(report statusReport) {
+	lastIndexed := "never"
+	if at := report.IndexedAt; at != nil {
+		lastIndexed = fmt.Sprintf("%s (%s ago)", at.Format(time.RFC3339), time.Since(*at).Round(time.Second))
+	}
+
+	fmt.Printf("backend:       %s\n", report.Backend)
+	fmt.Printf("collection:    %s\n", report.Name)
+	fmt.Printf("chunks:        %d\n", report.Chunks)
+	fmt.Printf("files:         %d\n", report.Files)
+	if report.EvictedFiles > 0 {
+		fmt.Printf("evicted:       %d file(s), over the maximum size of the index\n", report.EvictedFiles)
+	}
+	fmt.Printf("model:         %s (%d dimensions)\n", report.Model, report.Dimensions)
+	fmt.Printf("schema:        %s\n", report.Schema)
+	fmt.Printf("last indexed:  %s\n", lastIndexed)
+	fmt.Printf("disk usage:    %s (%s)\n", formatBytes(report.DiskUsage), report.WorkingDirectory)
+	if report.Healthy() {
+		fmt.Println("health:        ok")
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("health:        %s\n", problem)
+	}
+
+	if len(report.Languages) > 0 {
+		fmt.Println("languages:")
+	}
+	for _, language := range report.Languages {
+		fmt.Printf(
+			"  %-12s %d file(s), %d chunk(s), %s (%s per chunk)\n",
+			language.Language,
+			language.Files,
+			language.Chunks,
+			formatBytes(language.Bytes),
+			formatBytes(language.AverageChunkBytes),
+		)
+		for _, chunkType := range language.ChunkTypes {
+			fmt.Printf(
+				"    %-10s %d chunk(s), %s per chunk\n",
+				chunkType.Type,
+				chunkType.Chunks,
+				formatBytes(chunkType.AverageChunkBytes),
+			)
+		}
+	}
+}
+
+// schemaStatus describes the version of the index, and whether this release can use it as is
+func schemaStatus(indexManifest *manifest.Manifest) string {
+	version := schema.IndexVersion(indexManifest)
+	pending, err := schema.Check(indexManifest)
+	switch {
+	case errors.Is(err, schema.ErrNewerIndex):
+		return fmt.Sprintf("v%d (built by a newer release of mm)", version)
+	case err != nil:
+		return fmt.Sprintf("v%d (reindex required for v%d)", version, schema.Version)
+	case len(pending) > 0:
+		return fmt.Sprintf("v%d (migrated to v%d by the next indexing run)", version, schema.Version)
+	}
+	return fmt.Sprintf("v%d", version)
+}
+
+// diskUsage returns the total size of the files in the directory
+func diskUsage(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute disk usage of %s: %w", dir, err)
+	}
+	return total, nil
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(
+		&statusJSON,
+		"json",
+		false,
+		"Print the status as JSON, with the statistics of the languages and chunk types",
+	)
+
+	mmCmd.AddCommand(statusCmd)
+}
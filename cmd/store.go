@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/netfs"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// storeSpace is how the embeddings of a new collection are compared, the configuration is validated on load
+func storeSpace(cfg *config.Config) store.Space {
+	metric, _ := store.ParseMetric(cfg.Store.Metric)
+	return store.Space{Metric: metric, Normalized: cfg.Store.Normalize}
+}
+
+// checkStore refuses a store holding the embeddings of another model than the configured one, or of other dimensions
+// than the given ones, if known (not zero), or comparing them otherwise than configured
+func checkStore(cfg *config.Config, vectorStore store.VectorStore, dimensions int) error {
+	if err := store.CheckModel(vectorStore, embeddingModel(cfg), dimensions); err != nil {
+		return err
+	}
+	return store.CheckSpace(vectorStore, storeSpace(cfg))
+}
+
+// openStore opens the published generation of the configured vector store, embeddings are always computed by mm
+// before being stored
+func openStore(ctx context.Context, cfg *config.Config) (store.VectorStore, error) {
+	if cfg.Store.Backend != config.LocalBackend {
+		// generations may have been disabled since they were published
+		generation, err := store.NewGenerations(generationsPath(cfg)).Published()
+		if err != nil {
+			return nil, err
+		}
+		cfg = generationConfig(cfg, generation)
+	}
+	vectorStore, err := openCollection(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if readOnlyIndex(cfg) {
+		zerolog.Ctx(ctx).Debug().Msg("store opened read-only")
+		return store.NewReadOnly(vectorStore), nil
+	}
+	return vectorStore, nil
+}
+
+// readOnlyIndex checks whether the index is opened read-only: with --read-only, or when the file of the local store
+// or the manifests cannot be written, e.g. an index shared by many users or baked in a CI image
+func readOnlyIndex(cfg *config.Config) bool {
+	if readOnly {
+		return true
+	}
+	if cfg.Store.Backend == config.LocalBackend && !store.Writable(filepath.Dir(os.ExpandEnv(cfg.Store.Path))) {
+		return true
+	}
+	return !store.Writable(filepath.Dir(manifestPath(cfg)))
+}
+
+// openIndexedStore opens the store written by an indexing run, a copy of the published generation when generations
+// are enabled, published by the returned function once the run is complete, the published store otherwise
+func openIndexedStore(ctx context.Context, cfg *config.Config) (store.VectorStore, func() error, error) {
+	if !cfg.Store.Generations || cfg.Store.Backend == config.LocalBackend {
+		vectorStore, err := openStore(ctx, cfg)
+		return vectorStore, func() error { return nil }, err
+	}
+
+	generations := store.NewGenerations(generationsPath(cfg))
+	published, err := generations.Published()
+	if err != nil {
+		return nil, nil, err
+	}
+	next := published + 1
+	source, err := openCollection(ctx, generationConfig(cfg, published))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+	if err := dropStaleGenerations(source, cfg.Store.CollectionName(), published); err != nil {
+		return nil, nil, err
+	}
+	inspector, ok := source.(store.Inspector)
+	if !ok {
+		return nil, nil, fmt.Errorf("store backend %s cannot be copied to a new generation", cfg.Store.Backend)
+	}
+
+	target, err := openCollection(ctx, generationConfig(cfg, next))
+	if err != nil {
+		return nil, nil, err
+	}
+	copied, err := store.CopyRecords(inspector, target)
+	if err != nil {
+		_ = target.Close()
+		return nil, nil, err
+	}
+	zerolog.Ctx(ctx).Info().Int("generation", next).Int("records", copied).Msg("next generation of the collection prepared")
+	return target, func() error { return generations.Publish(next) }, nil
+}
+
+// dropStaleGenerations drops the generation preceding the published one, its readers had a whole run to switch, and
+// the one following it, left by a failed run
+func dropStaleGenerations(vectorStore store.VectorStore, collection string, published int) error {
+	manager, ok := vectorStore.(store.CollectionManager)
+	if !ok {
+		return nil
+	}
+	names, err := manager.Collections()
+	if err != nil {
+		return err
+	}
+	stale := map[string]bool{store.GenerationName(collection, published+1): true}
+	if published > 0 {
+		stale[store.GenerationName(collection, published-1)] = true
+	}
+	for _, name := range names {
+		if !stale[name] {
+			continue
+		}
+		if err := manager.DropCollection(name); err != nil {
+			return fmt.Errorf("failed to drop stale generation %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// generationConfig returns the configuration scoped to the collection holding the generation
+func generationConfig(cfg *config.Config, generation int) *config.Config {
+	if generation == 0 {
+		return cfg
+	}
+	return cfg.ForCollection(store.GenerationName(cfg.Store.CollectionName(), generation))
+}
+
+// metadataConfig returns the configuration of the local store holding the chunks indexed without embeddings, kept
+// next to the manifests apart from the configured store
+func metadataConfig(cfg *config.Config) *config.Config {
+	id := manifest.Hash([]byte(cfg.Store.Identity()))[:16]
+	scoped := *cfg
+	scoped.Store.Backend = config.LocalBackend
+	scoped.Store.Path = filepath.Join(workingDirectory(), "metadata", id+".gob")
+	scoped.Store.Generations = false
+	return &scoped
+}
+
+// openCollection opens the collection of the configured vector store
+func openCollection(ctx context.Context, cfg *config.Config) (store.VectorStore, error) {
+	if err := checkFileSystem(cfg); err != nil {
+		return nil, err
+	}
+	switch cfg.Store.Backend {
+	case config.LocalBackend:
+		localStore, err := store.OpenLocal(
+			os.ExpandEnv(cfg.Store.Path),
+			store.WithLocalSpace(storeSpace(cfg)),
+			store.WithLocalQuantization(store.Quantization(cfg.Store.Quantization), cfg.Store.KeepOriginals),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open local store: %w", err)
+		}
+		return localStore, nil
+	case config.QdrantBackend:
+		qdrant := cfg.Store.Qdrant
+		return store.NewQdrant(
+			ctx,
+			os.ExpandEnv(qdrant.URL),
+			os.ExpandEnv(qdrant.APIKey),
+			qdrant.Collection,
+			store.WithQdrantSpace(storeSpace(cfg)),
+			store.WithQdrantQuantization(store.Quantization(cfg.Store.Quantization), cfg.Store.KeepOriginals),
+		), nil
+	default:
+		// chroma is only reachable through the python indexer
+		logger := zerolog.Ctx(ctx).With().Str("process", "python store").Logger()
+		indexer, err := runIndexer(ctx, logger, indexerOptions(cfg, embedding.WithStoreOnly(), embedding.WithCollection(cfg.Store.Chroma.Collection))...)
+		if err != nil {
+			return nil, err
+		}
+		if err := indexer.WaitReady(); err != nil {
+			_ = indexer.Close()
+			return nil, fmt.Errorf("failed to start the python store: %w", err)
+		}
+		chroma := store.NewChroma(indexer, store.WithChromaSpace(storeSpace(cfg)))
+		if err := checkChroma(cfg, chroma); err != nil {
+			_ = chroma.Close()
+			return nil, err
+		}
+		return chroma, nil
+	}
+}
+
+// checkFileSystem refuses to open the data of the local chroma server on a network filesystem, where the locks of its
+// SQLite database are unreliable, several teammates corrupted their store with ~/.mm on a network home
+func checkFileSystem(cfg *config.Config) error {
+	switch {
+	case cfg.Store.Backend == config.LocalBackend:
+		path := os.ExpandEnv(cfg.Store.Path)
+		if fileSystem, err := netfs.Detect(path); err == nil && fileSystem.Network {
+			// replaced at once by a rename, only the writes of several hosts at the same time are lost
+			log.Warn().Str("path", path).Str("fs", fileSystem.Type).Msg("local store on a network filesystem, do not index it from several machines at once")
+		}
+	case cfg.Store.Backend == config.ChromaBackend && !cfg.Store.Chroma.Remote():
+		path := chromaPath()
+		fileSystem, err := netfs.Detect(path)
+		if err != nil || !fileSystem.Network {
+			return nil
+		}
+		if !cfg.Store.AllowNetworkFS {
+			return fmt.Errorf(
+				"the chroma data %s is on a network filesystem (%s), where SQLite locking is unreliable and corrupts the "+
+					"store: move it to a local disk with --db-path (or MM_DB_PATH, or a local --working-dir), use a chroma "+
+					"server (store.chroma.host) or the local backend, or set store.allow_network_fs to take the risk",
+				path,
+				fileSystem.Type,
+			)
+		}
+		log.Warn().Str("path", path).Str("fs", fileSystem.Type).Msg("chroma data on a network filesystem, it can be corrupted by concurrent writes")
+	}
+	return nil
+}
+
+// checkChroma verifies the chroma data was not corrupted by a previous run, and repairs it if requested
+func checkChroma(cfg *config.Config, chroma *store.Chroma) error {
+	problems, err := chroma.Check()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	for _, problem := range problems {
+		log.Warn().Str("problem", problem).Msg("chroma store is corrupted")
+	}
+	if !repairStore {
+		return fmt.Errorf("chroma store is corrupted (%d problem(s)), run with --repair to recreate it", len(problems))
+	}
+
+	if err := chroma.Repair(); err != nil {
+		return err
+	}
+	// the store is empty, all the files have to be indexed again
+	if err := os.Remove(manifestPath(cfg)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to reset manifest: %w", err)
+	}
+	log.Warn().Msg("chroma store recreated, the code has to be indexed again")
+	return nil
+}
+
+// chromaPath returns the directory of the data of the local chroma server: --db-path, MM_DB_PATH, or the chroma
+// directory of the working directory
+func chromaPath() string {
+	if dbPath != "" {
+		return os.ExpandEnv(dbPath)
+	}
+	if path := os.Getenv(dbPathVariable); path != "" {
+		return os.ExpandEnv(path)
+	}
+	return embedding.ChromaPath(workingDirectory())
+}
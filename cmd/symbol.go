@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/render"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var symbolLimit int
+
+var symbolCmd = &cobra.Command{
+	Use:   "symbol name [filter...]",
+	Short: "Print the definitions of a function, method, or class",
+	Long: `Print the indexed definitions of a function, method, or class, found by name: a bare name matches the
+functions and classes named after it, a name qualified by its class (TokenValidator.validate) the methods of the
+class. Filters of the search (pkg:, mod:, root:) restrict the definitions. The chunks are found by their metadata,
+so it works on the indexes built with --metadata-only, without python nor embedding model`,
+	Example: `  mm symbol calculate_tax
+  mm symbol TokenValidator.validate root:backend
+  mm symbol Validate pkg:internal/auth --format anthropic`,
+	Args: cobra.MinimumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := render.ParseFormat(format)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		symbol, filter := search.ParseQuery(strings.Join(args, " "))
+		if symbol == "" || strings.Contains(symbol, " ") {
+			return fmt.Errorf("expected a single symbol name, got %q", symbol)
+		}
+
+		return withSymbolStore(cmd.Context(), func(inspector store.Inspector) error {
+			results, err := search.Symbols(inspector, symbol, filter, symbolLimit)
+			if err != nil {
+				return err
+			}
+
+			renderer := render.New(os.Stdout, render.ColorEnabled(os.Stdout, noColor))
+			if outputFormat, _ := render.ParseFormat(format); outputFormat != render.TextFormat {
+				return renderer.ToolResult(outputFormat, toolCallId, results)
+			}
+			if len(results) == 0 {
+				fmt.Printf("No definition of %s found.\n", symbol)
+				return nil
+			}
+			renderer.Chunks(results)
+			return nil
+		})
+	},
+}
+
+// withSymbolStore opens the store of the chunks indexed with --metadata-only if there is one, the configured store
+// otherwise, and closes it once the action is done
+func withSymbolStore(ctx context.Context, action func(inspector store.Inspector) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(metadataConfig(cfg).Store.Path); err == nil {
+		cfg = metadataConfig(cfg)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check the metadata-only index: %w", err)
+	}
+
+	logger := log.Logger.With().Timestamp().Caller().Logger()
+	vectorStore, err := openStore(logger.WithContext(ctx), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := vectorStore.Close(); err != nil {
+			logger.Error().Err(err).Msg("failed to close store")
+		}
+	}()
+
+	inspector, ok := vectorStore.(store.Inspector)
+	if !ok {
+		return fmt.Errorf("store backend %s cannot be inspected", cfg.Store.Backend)
+	}
+	return action(inspector)
+}
+
+func init() {
+	symbolCmd.Flags().IntVarP(
+		&symbolLimit,
+		"limit",
+		"n",
+		0,
+		"Maximum number of definitions to print, 0 for all of them",
+	)
+	symbolCmd.Flags().StringVar(
+		&format,
+		"format",
+		string(render.TextFormat),
+		"Output format of the chunks: text, or a tool call response for an LLM API (openai, anthropic)",
+	)
+	symbolCmd.Flags().StringVar(
+		&toolCallId,
+		"tool-call-id",
+		defaultToolCallId,
+		"Id of the tool call answered by the chunks, with the openai and anthropic formats",
+	)
+
+	mmCmd.AddCommand(symbolCmd)
+}
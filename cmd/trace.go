@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/render"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/a-peyrard/mm/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultTraceFrames  = 5
+	defaultTraceRelated = 3
+)
+
+var (
+	traceFrames  int
+	traceRelated int
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace [file]",
+	Short: "Print the code implicated by a stack trace",
+	Long: `Parse a stack trace (Python, Go, or JavaScript) read from the file or the standard input, and print the indexed
+chunks of its innermost frames, with the chunks the closest to them. Frames outside the index (standard library,
+dependencies, ...) are skipped`,
+	Example: `  mm trace < stacktrace.txt
+  go test ./... 2>&1 | mm trace --frames 3 --related 0`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var input io.Reader = os.Stdin
+		if len(args) == 1 {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open stack trace %s: %w", args[0], err)
+			}
+			defer func() {
+				_ = file.Close()
+			}()
+			input = file
+		}
+		frames, err := trace.Parse(input)
+		if err != nil {
+			return err
+		}
+		if len(frames) == 0 {
+			return fmt.Errorf("no frame found, expected a Python, Go, or JavaScript stack trace")
+		}
+
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			inspector, ok := vectorStore.(store.InspectableStore)
+			if !ok {
+				return fmt.Errorf("store backend %s cannot be inspected", cfg.Store.Backend)
+			}
+			indexManifest, err := manifest.Load(manifestPath(cfg))
+			if err != nil {
+				return err
+			}
+
+			renderer := render.New(os.Stdout, render.ColorEnabled(os.Stdout, noColor))
+			printed := 0
+			skipped := 0
+			seen := make(map[search.LineRange]bool)
+			for _, frame := range frames {
+				if printed == traceFrames {
+					break
+				}
+				filePath, err := indexedFilePath(indexManifest, frame.FilePath)
+				if err != nil {
+					skipped++
+					continue
+				}
+				// recursive calls repeat the same frame
+				lines := search.LineRange{FilePath: filePath, Start: frame.Line, End: frame.Line}
+				if seen[lines] {
+					continue
+				}
+				seen[lines] = true
+
+				result, err := search.Lines(inspector, lines, traceRelated)
+				if err != nil {
+					return err
+				}
+				printed++
+				fmt.Printf("#%d %s\n", printed, frame)
+				renderer.LinesResult(result)
+			}
+			if printed == 0 {
+				return fmt.Errorf("none of the %d frame(s) is in the index", len(frames))
+			}
+			if skipped > 0 {
+				fmt.Printf("%d frame(s) outside the index skipped\n", skipped)
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	traceCmd.Flags().IntVar(
+		&traceFrames,
+		"frames",
+		defaultTraceFrames,
+		"Number of frames to print, starting from the innermost one",
+	)
+	traceCmd.Flags().IntVar(
+		&traceRelated,
+		"related",
+		defaultTraceRelated,
+		"Number of related chunks to print for each frame, 0 to only print the chunks of the frames",
+	)
+
+	mmCmd.AddCommand(traceCmd)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/a-peyrard/mm/internal/config"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/a-peyrard/mm/internal/verify"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the integrity of the index",
+	Long: `Cross-check the manifest against the store and the filesystem: chunks missing from the store, chunks of no
+indexed file, deleted files, files changed since they were indexed, and embeddings with unexpected dimensions.
+With --repair, the inconsistent files are dropped from the index (to be indexed again by the next run), and the
+orphan chunks are deleted.`,
+	Example: `  mm verify
+  mm verify --repair && mm --index ~/src`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStore(cmd.Context(), func(vectorStore store.VectorStore, cfg *config.Config) error {
+			verifiable, ok := vectorStore.(store.InspectableStore)
+			if !ok {
+				return fmt.Errorf("store backend %s cannot be verified", cfg.Store.Backend)
+			}
+			indexManifest, err := manifest.Load(manifestPath(cfg))
+			if err != nil {
+				return err
+			}
+
+			issues, err := verify.Verify(verifiable, indexManifest)
+			if err != nil {
+				return err
+			}
+			for _, issue := range issues {
+				fmt.Println(issue)
+			}
+			if len(issues) == 0 {
+				fmt.Println("index is consistent")
+				return nil
+			}
+			if !repairStore {
+				return fmt.Errorf("index is inconsistent (%d issue(s)), run with --repair to fix it", len(issues))
+			}
+
+			if err := verify.Repair(verifiable, indexManifest, issues); err != nil {
+				return err
+			}
+			if err := indexManifest.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("repaired %d issue(s), index the code again to restore the dropped files\n", len(issues))
+			return nil
+		})
+	},
+}
+
+func init() {
+	mmCmd.AddCommand(verifyCmd)
+}
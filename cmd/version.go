@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/spf13/cobra"
+)
+
+// version of mm, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+var verbose bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the version of mm",
+	Long:  `Show the version of mm, and with --verbose the python lib and the tree-sitter grammars compiled in the binary`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("mm %s (%s)\n", version, runtime.Version())
+		if !verbose {
+			return nil
+		}
+
+		fmt.Printf("lib: %s\n", embedding.LibPath(workingDirectory()))
+		parser := code.NewGenericParser()
+		fmt.Println("grammars:")
+		for _, grammar := range parser.Grammars() {
+			fmt.Printf("  %-12s %s %s (ABI %d)\n", grammar.Language, grammar.Module, grammar.Version, grammar.AbiVersion)
+		}
+		if err := parser.CheckQueries(); err != nil {
+			return err
+		}
+		fmt.Println("queries: ok")
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the grammars compiled in the binary")
+	mmCmd.AddCommand(versionCmd)
+}
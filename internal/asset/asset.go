@@ -0,0 +1,73 @@
+package asset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/manifest"
+)
+
+// types of the cataloged files, by extension
+var types = map[string]string{
+	".png": "image", ".jpg": "image", ".jpeg": "image", ".gif": "image", ".svg": "image", ".webp": "image",
+	".ico": "image", ".bmp": "image", ".tif": "image", ".tiff": "image", ".psd": "image",
+
+	".onnx": "model", ".pt": "model", ".pth": "model", ".ckpt": "model", ".safetensors": "model", ".gguf": "model",
+	".h5": "model", ".tflite": "model", ".pkl": "model", ".joblib": "model",
+
+	".sql": "dump", ".dump": "dump", ".bak": "dump", ".db": "dump", ".sqlite": "dump", ".sqlite3": "dump",
+
+	".csv": "data", ".tsv": "data", ".parquet": "data", ".avro": "data", ".npy": "data", ".npz": "data",
+
+	".zip": "archive", ".tar": "archive", ".gz": "archive", ".tgz": "archive", ".bz2": "archive", ".xz": "archive",
+	".7z": "archive", ".jar": "archive", ".war": "archive",
+
+	".ttf": "font", ".otf": "font", ".woff": "font", ".woff2": "font", ".eot": "font",
+
+	".pdf": "document", ".docx": "document", ".xlsx": "document", ".pptx": "document",
+
+	".mp3": "media", ".wav": "media", ".ogg": "media", ".mp4": "media", ".mov": "media", ".webm": "media",
+}
+
+// Type returns the type of the asset, empty if the file is not cataloged as an asset
+func Type(path string) string {
+	return types[strings.ToLower(filepath.Ext(path))]
+}
+
+// Find calls the callback with the assets of the directory, skipping the same directories as the indexing
+func Find(dir string, callback code.Consumer[string]) error {
+	return code.FindFiles(dir, func(name string) bool { return Type(name) != "" }, callback)
+}
+
+// Catalog returns the entry of the asset, its content is hashed without being loaded in memory, assets can be large
+func Catalog(path string) (manifest.Asset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return manifest.Asset{}, fmt.Errorf("failed to open asset %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return manifest.Asset{}, fmt.Errorf("failed to stat asset %s: %w", path, err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return manifest.Asset{}, fmt.Errorf("failed to hash asset %s: %w", path, err)
+	}
+	return manifest.Asset{
+		FilePath:   path,
+		Type:       Type(path),
+		Hash:       hex.EncodeToString(hash.Sum(nil)),
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime().UnixNano(),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package asset
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestType(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "it should recognize an image", path: "static/Logo.PNG", want: "image"},
+		{name: "it should recognize a model", path: "models/ranker.onnx", want: "model"},
+		{name: "it should recognize a dump", path: "migrations/0001_init.sql", want: "dump"},
+		{name: "it should not catalog code", path: "main.go"},
+		{name: "it should not catalog a file without extension", path: "Makefile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Type(tt.path))
+		})
+	}
+}
+
+func TestFindAndCatalog(t *testing.T) {
+	// GIVEN
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "static"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "static", "logo.png"), []byte("png"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node_modules", "icon.png"), []byte("png"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+
+	// WHEN
+	var found []string
+	err := Find(dir, func(path string) error {
+		found = append(found, path)
+		return nil
+	})
+	require.NoError(t, err)
+	asset, err := Catalog(found[0])
+	require.NoError(t, err)
+
+	// THEN
+	assert.Equal(t, []string{filepath.Join(dir, "static", "logo.png")}, found)
+	assert.Equal(t, "image", asset.Type)
+	assert.Equal(t, int64(3), asset.Size)
+	assert.Equal(t, "8f8cbb7dcf46e0bc7d53265749a6c17d116093a6ba95e442764060c76fd4a86c", asset.Hash)
+}
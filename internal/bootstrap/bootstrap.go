@@ -0,0 +1,133 @@
+// Package bootstrap fetches the index published by the CI of a repository, an export of the chunks of a commit, so
+// the first indexing run imports it instead of embedding the whole repository
+package bootstrap
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// CommitPlaceholder is replaced by the hash of a commit in the url of the artifacts
+const CommitPlaceholder = "{commit}"
+
+// connectTimeout bounds the time to get the response headers, the artifacts of large repositories are long to download
+const connectTimeout = 30 * time.Second
+
+// ErrNotFound is returned when none of the commits has a published index
+var ErrNotFound = errors.New("no index published for the commits")
+
+type (
+	// Fetcher opens the artifacts of the commits, downloaded from an http(s) url, or read from a path (a mounted
+	// share, or a file:// url)
+	Fetcher struct {
+		pattern string
+		token   string
+		client  *http.Client
+	}
+
+	// Artifact is the export of the index of a commit, to be closed once read
+	Artifact struct {
+		io.Reader
+		// Commit is the hash of the commit whose index was published
+		Commit string
+		// Location is the url or the path the artifact was read from
+		Location string
+
+		closers []io.Closer
+	}
+)
+
+// NewFetcher creates a fetcher of the artifacts located by the pattern, where CommitPlaceholder is replaced by the
+// hash of the commit, the token is sent as a bearer token if not empty
+func NewFetcher(pattern string, token string) *Fetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = connectTimeout
+	return &Fetcher{
+		pattern: pattern,
+		token:   token,
+		client:  &http.Client{Transport: transport},
+	}
+}
+
+// Location returns the url or the path of the artifact of the commit
+func (f *Fetcher) Location(commit string) string {
+	return strings.ReplaceAll(f.pattern, CommitPlaceholder, commit)
+}
+
+// Open opens the artifact of the first commit having one, the commits are expected from the most recent one,
+// ErrNotFound is returned if none has, artifacts ending with .gz are decompressed
+func (f *Fetcher) Open(ctx context.Context, commits []string) (*Artifact, error) {
+	for _, commit := range commits {
+		location := f.Location(commit)
+		body, err := f.open(ctx, location)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		artifact := &Artifact{Reader: body, Commit: commit, Location: location, closers: []io.Closer{body}}
+		if strings.HasSuffix(strings.SplitN(location, "?", 2)[0], ".gz") {
+			decompressed, err := gzip.NewReader(body)
+			if err != nil {
+				_ = body.Close()
+				return nil, fmt.Errorf("failed to decompress %s: %w", location, err)
+			}
+			artifact.Reader = decompressed
+			artifact.closers = append(artifact.closers, decompressed)
+		}
+		return artifact, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Close releases the download, or the file, of the artifact
+func (a *Artifact) Close() error {
+	var errs []error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		errs = append(errs, a.closers[i].Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *Fetcher) open(ctx context.Context, location string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		file, err := os.Open(strings.TrimPrefix(location, "file://"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", location, err)
+		}
+		return file, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", location, err)
+	}
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", location, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: status %d", location, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
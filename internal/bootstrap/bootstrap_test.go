@@ -0,0 +1,118 @@
+package bootstrap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcher_Open(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte("compressed index"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/mm/bbb.jsonl":
+			_, _ = w.Write([]byte("index of bbb"))
+		case "/mm/bbb.jsonl.gz":
+			_, _ = w.Write(compressed.Bytes())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ccc.jsonl"), []byte("index of ccc"), 0644))
+
+	tests := []struct {
+		name        string
+		pattern     string
+		token       string
+		commits     []string
+		wantCommit  string
+		wantContent string
+		wantErr     error
+	}{
+		{
+			name:        "it should download the artifact of the most recent commit having one",
+			pattern:     server.URL + "/mm/{commit}.jsonl",
+			token:       "secret",
+			commits:     []string{"aaa", "bbb", "ccc"},
+			wantCommit:  "bbb",
+			wantContent: "index of bbb",
+		},
+		{
+			name:        "it should decompress a gzipped artifact",
+			pattern:     server.URL + "/mm/{commit}.jsonl.gz",
+			token:       "secret",
+			commits:     []string{"bbb"},
+			wantCommit:  "bbb",
+			wantContent: "compressed index",
+		},
+		{
+			name:        "it should read an artifact from a path",
+			pattern:     "file://" + filepath.Join(dir, "{commit}.jsonl"),
+			commits:     []string{"aaa", "ccc"},
+			wantCommit:  "ccc",
+			wantContent: "index of ccc",
+		},
+		{
+			name:    "it should return not found if no commit has an artifact",
+			pattern: server.URL + "/mm/{commit}.jsonl",
+			token:   "secret",
+			commits: []string{"aaa", "ddd"},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			fetcher := NewFetcher(tt.pattern, tt.token)
+
+			// WHEN
+			artifact, err := fetcher.Open(context.Background(), tt.commits)
+
+			// THEN
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer func() {
+				_ = artifact.Close()
+			}()
+			content, err := io.ReadAll(artifact)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCommit, artifact.Commit)
+			assert.Equal(t, tt.wantContent, string(content))
+		})
+	}
+
+	t.Run("it should fail when the server refuses the download", func(t *testing.T) {
+		// GIVEN
+		fetcher := NewFetcher(server.URL+"/mm/{commit}.jsonl", "wrong")
+
+		// WHEN
+		_, err := fetcher.Open(context.Background(), []string{"bbb"})
+
+		// THEN
+		assert.ErrorContains(t, err, "status 403")
+	})
+}
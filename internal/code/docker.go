@@ -0,0 +1,183 @@
+package code
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fromInstruction matches the FROM instruction starting a stage of a dockerfile, capturing its image and its name
+var fromInstruction = regexp.MustCompile(`(?i)^\s*FROM\s+(?:--\S+\s+)*(\S+)(?:\s+AS\s+(\S+))?`)
+
+// heredoc matches the heredocs of an instruction, capturing their delimiter, e.g. RUN <<EOF, COPY <<-"END" /app/run
+var heredoc = regexp.MustCompile(`(?:^|[^<])<<-?\s*["']?(\w+)["']?`)
+
+// composeFile matches the names of the compose files, their overrides included, e.g. docker-compose.prod.yml
+var composeFile = regexp.MustCompile(`^(docker-)?compose(\.[\w-]+)?\.ya?ml$`)
+
+// isDockerfile tells whether the file is a dockerfile, e.g. Dockerfile, Dockerfile.prod, api.dockerfile
+func isDockerfile(filePath string) bool {
+	name := strings.ToLower(filepath.Base(filePath))
+	return name == "dockerfile" || name == "containerfile" ||
+		strings.HasPrefix(name, "dockerfile.") || strings.HasSuffix(name, ".dockerfile")
+}
+
+// isComposeFile tells whether the file is a docker compose file
+func isComposeFile(filePath string) bool {
+	return composeFile.MatchString(strings.ToLower(filepath.Base(filePath)))
+}
+
+// IsDeploymentFile tells whether the file is a dockerfile or a compose file, told by their name rather than by their
+// extension
+func IsDeploymentFile(filePath string) bool {
+	return isDockerfile(filePath) || isComposeFile(filePath)
+}
+
+// parseDockerfile chunks the dockerfile per stage, from its FROM instruction to the next one, the instructions before
+// the first stage (e.g. the global ARG) being part of it
+func parseDockerfile(filePath string, sourceCode []byte) []Chunk {
+	lines := strings.Split(string(sourceCode), "\n")
+
+	var starts []int
+	var matches [][]string
+	for i := 0; i < len(lines); {
+		start := i
+		instruction, next := dockerInstruction(lines, i)
+		i = next
+		if match := fromInstruction.FindStringSubmatch(instruction); match != nil {
+			starts = append(starts, start)
+			matches = append(matches, match)
+		}
+	}
+
+	chunks := make([]Chunk, 0, len(starts))
+	for i, start := range starts {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		from := start
+		if i == 0 {
+			from = 0
+		}
+		match := matches[i]
+		chunks = append(chunks, deploymentChunk(filePath, lines, from, end, "dockerfile", "stages", match[2], match[1]))
+	}
+	return chunks
+}
+
+// dockerInstruction returns the instruction starting at the line, its continuation lines joined, and the line following
+// it and its heredocs, so neither of them is mistaken for an instruction, e.g. the from of a multi-line sql query
+func dockerInstruction(lines []string, start int) (string, int) {
+	instruction := lines[start]
+	end := start + 1
+	for strings.HasSuffix(strings.TrimRight(instruction, " \t\r"), "\\") && end < len(lines) {
+		instruction = strings.TrimSuffix(strings.TrimRight(instruction, " \t\r"), "\\") + " " + lines[end]
+		end++
+	}
+	if strings.HasPrefix(strings.TrimSpace(instruction), "#") {
+		return instruction, end
+	}
+	for _, delimiter := range heredoc.FindAllStringSubmatch(instruction, -1) {
+		for end < len(lines) && strings.TrimSpace(lines[end]) != delimiter[1] {
+			end++
+		}
+		end = min(end+1, len(lines))
+	}
+	return instruction, end
+}
+
+// parseComposeFile chunks the compose file per service, from its name to the next one
+func parseComposeFile(filePath string, sourceCode []byte) ([]Chunk, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(sourceCode, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file %s: %w", filePath, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return []Chunk{}, nil
+	}
+	root := document.Content[0]
+
+	// the lines of the keys ending the services, the next service, or the next top-level key
+	var boundaries []int
+	var services *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		boundaries = append(boundaries, root.Content[i].Line-1)
+		if root.Content[i].Value == "services" && root.Content[i+1].Kind == yaml.MappingNode {
+			services = root.Content[i+1]
+		}
+	}
+	if services == nil {
+		return []Chunk{}, nil
+	}
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		boundaries = append(boundaries, services.Content[i].Line-1)
+	}
+	slices.Sort(boundaries)
+
+	lines := strings.Split(string(sourceCode), "\n")
+	chunks := make([]Chunk, 0, len(services.Content)/2)
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		key, service := services.Content[i], services.Content[i+1]
+		start := key.Line - 1
+		end := len(lines)
+		if idx := slices.IndexFunc(boundaries, func(line int) bool { return line > start }); idx >= 0 {
+			end = boundaries[idx]
+		}
+		chunks = append(
+			chunks,
+			deploymentChunk(filePath, lines, start, end, "compose", "services", key.Value, composeImage(service)),
+		)
+	}
+	return chunks, nil
+}
+
+// composeImage returns the image of the service, empty if it is built
+func composeImage(service *yaml.Node) string {
+	if service.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(service.Content); i += 2 {
+		if service.Content[i].Value == "image" {
+			return service.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// deploymentChunk returns the chunk of the lines [start, end) of the file, without its trailing blank lines
+func deploymentChunk(
+	filePath string,
+	lines []string,
+	start int,
+	end int,
+	language string,
+	chunkType string,
+	name string,
+	image string,
+) Chunk {
+	for end > start+1 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	id := fmt.Sprintf("%s_%s_%d", filePath, name, start+1)
+	if name == "" {
+		id = fmt.Sprintf("%s_%s_%d", filePath, chunkType, start+1)
+	}
+	return Chunk{
+		Id:      id,
+		Content: strings.Join(lines[start:end], "\n"),
+		Metadata: ChunkMetadata{
+			FilePath:     filePath,
+			FunctionName: name,
+			StartLine:    start + 1,
+			EndLine:      end,
+			Language:     language,
+			ChunkType:    chunkType,
+			Image:        image,
+		},
+	}
+}
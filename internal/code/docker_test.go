@@ -0,0 +1,187 @@
+package code
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericParser_ParseFile_Dockerfile(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `# syntax=docker/dockerfile:1
+ARG PYTHON=3.12
+
+FROM --platform=$BUILDPLATFORM python:${PYTHON}-slim AS build
+RUN pip install uv
+
+from gcr.io/distroless/python3
+COPY --from=build /app /app
+`
+
+	// WHEN
+	got, err := parser.ParseFile("deploy/Dockerfile", []byte(sourceCode))
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, []Chunk{
+		{
+			Id: "deploy/Dockerfile_build_1",
+			Content: "# syntax=docker/dockerfile:1\nARG PYTHON=3.12\n\n" +
+				"FROM --platform=$BUILDPLATFORM python:${PYTHON}-slim AS build\nRUN pip install uv",
+			Metadata: ChunkMetadata{
+				FilePath:     "deploy/Dockerfile",
+				FunctionName: "build",
+				StartLine:    1,
+				EndLine:      5,
+				Language:     "dockerfile",
+				ChunkType:    "stages",
+				Image:        "python:${PYTHON}-slim",
+			},
+		},
+		{
+			Id:      "deploy/Dockerfile_stages_7",
+			Content: "from gcr.io/distroless/python3\nCOPY --from=build /app /app",
+			Metadata: ChunkMetadata{
+				FilePath:  "deploy/Dockerfile",
+				StartLine: 7,
+				EndLine:   8,
+				Language:  "dockerfile",
+				ChunkType: "stages",
+				Image:     "gcr.io/distroless/python3",
+			},
+		},
+	}, got)
+}
+
+func TestGenericParser_ParseFile_Dockerfile_ContinuationsAndHeredocs(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `FROM postgres:16 AS db
+RUN psql -c "select name \
+  from users"
+RUN <<EOF
+psql -c "select name
+from users"
+EOF
+COPY <<-"END" /docker-entrypoint-initdb.d/init.sql
+	from accounts
+END
+
+FROM \
+  nginx:1.27 \
+  AS web
+`
+
+	// WHEN
+	got, err := parser.ParseFile("Dockerfile", []byte(sourceCode))
+
+	// THEN
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "db", got[0].Metadata.FunctionName)
+	assert.Equal(t, "postgres:16", got[0].Metadata.Image)
+	assert.Equal(t, 1, got[0].Metadata.StartLine)
+	assert.Equal(t, 10, got[0].Metadata.EndLine)
+	assert.Equal(t, "web", got[1].Metadata.FunctionName)
+	assert.Equal(t, "nginx:1.27", got[1].Metadata.Image)
+	assert.Equal(t, 12, got[1].Metadata.StartLine)
+	assert.Equal(t, 14, got[1].Metadata.EndLine)
+}
+
+func TestGenericParser_ParseFile_ComposeFile(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `services:
+  api:
+    build: .
+    depends_on: [db]
+
+  db:
+    image: postgres:16
+    environment:
+      POSTGRES_PASSWORD: secret
+
+volumes:
+  data: {}
+`
+
+	// WHEN
+	got, err := parser.ParseFile("docker-compose.yml", []byte(sourceCode))
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, []Chunk{
+		{
+			Id:      "docker-compose.yml_api_2",
+			Content: "  api:\n    build: .\n    depends_on: [db]",
+			Metadata: ChunkMetadata{
+				FilePath:     "docker-compose.yml",
+				FunctionName: "api",
+				StartLine:    2,
+				EndLine:      4,
+				Language:     "compose",
+				ChunkType:    "services",
+			},
+		},
+		{
+			Id:      "docker-compose.yml_db_6",
+			Content: "  db:\n    image: postgres:16\n    environment:\n      POSTGRES_PASSWORD: secret",
+			Metadata: ChunkMetadata{
+				FilePath:     "docker-compose.yml",
+				FunctionName: "db",
+				StartLine:    6,
+				EndLine:      9,
+				Language:     "compose",
+				ChunkType:    "services",
+				Image:        "postgres:16",
+			},
+		},
+	}, got)
+}
+
+func TestIsDeploymentFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filePath string
+		want     bool
+	}{
+		{name: "it should detect a dockerfile", filePath: "Dockerfile", want: true},
+		{name: "it should detect a dockerfile variant", filePath: "deploy/Dockerfile.prod", want: true},
+		{name: "it should detect a dockerfile by its extension", filePath: "api.dockerfile", want: true},
+		{name: "it should detect a compose file", filePath: "compose.yaml", want: true},
+		{name: "it should detect a compose override", filePath: "docker-compose.override.yml", want: true},
+		{name: "it should not detect another yaml file", filePath: "config.yaml", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			got := IsDeploymentFile(tt.filePath)
+
+			// THEN
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindInDirectory_DeploymentFiles(t *testing.T) {
+	// GIVEN
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "compose.yaml"), []byte("services: {}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "config.yaml"), []byte("debug: true\n"), 0644))
+
+	// WHEN
+	var found []string
+	err := FindInDirectory(root, NewGenericParser().Extensions(), func(path string) error {
+		found = append(found, filepath.Base(path))
+		return nil
+	})
+
+	// THEN
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Dockerfile", "compose.yaml"}, found)
+}
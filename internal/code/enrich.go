@@ -0,0 +1,298 @@
+package code
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/a-peyrard/mm/internal/git"
+)
+
+// Enricher decorates the chunks extracted from a file with additional metadata or context
+type Enricher func(ctx context.Context, filePath string, chunks []Chunk) error
+
+// Enrich applies all the enrichers, in order, to the chunks of the file
+func Enrich(ctx context.Context, filePath string, chunks []Chunk, enrichers ...Enricher) error {
+	for _, enricher := range enrichers {
+		if err := enricher(ctx, filePath, chunks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModificationTimeEnricher records the modification time of the file on each chunk
+func ModificationTimeEnricher(_ context.Context, filePath string, chunks []Chunk) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+
+	modifiedAt := info.ModTime().Unix()
+	for i := range chunks {
+		chunks[i].Metadata.ModifiedAt = modifiedAt
+	}
+
+	return nil
+}
+
+// CommitContextEnricher attaches the subject of the last commit touching each chunk, so the rationale
+// recorded in commit messages is embedded alongside the code it explains.
+func CommitContextEnricher(ctx context.Context, filePath string, chunks []Chunk) error {
+	blame, err := git.BlameFile(ctx, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to get commit context: %w", err)
+	}
+
+	for i := range chunks {
+		commit, found := blame.LastCommit(chunks[i].Metadata.StartLine, chunks[i].Metadata.EndLine)
+		if !found {
+			continue
+		}
+		chunks[i].Metadata.CommittedAt = commit.CommitterTime
+		chunks[i].Metadata.CommitSubject = commit.Subject
+		chunks[i].Context = append(chunks[i].Context, "why: "+commit.Subject)
+	}
+
+	return nil
+}
+
+// PathContextEnricher attaches the words of the path of the file, relative to root, so queries naming a module or a
+// service ("the uploader in the media service") match chunks whose content never mentions it
+func PathContextEnricher(root string) Enricher {
+	return func(_ context.Context, filePath string, chunks []Chunk) error {
+		relPath := filePath
+		if absPath, err := filepath.Abs(filePath); err == nil {
+			if rel, err := filepath.Rel(root, absPath); err == nil && !strings.HasPrefix(rel, "..") {
+				relPath = rel
+			}
+		}
+		tokens := PathTokens(relPath)
+		if len(tokens) == 0 {
+			return nil
+		}
+
+		line := "path: " + strings.Join(tokens, " ")
+		for i := range chunks {
+			chunks[i].Context = append(chunks[i].Context, line)
+		}
+		return nil
+	}
+}
+
+// PathTokens splits the directories and the name of a file, without its extension, into distinct lower-cased words,
+// e.g. media_service/uploadHandler.go gives media, service, upload, handler
+func PathTokens(path string) []string {
+	path = strings.TrimSuffix(filepath.ToSlash(path), filepath.Ext(path))
+
+	var tokens []string
+	seen := make(map[string]bool)
+	add := func(word []rune) {
+		token := strings.ToLower(string(word))
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	runes := []rune(path)
+	start := 0
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			add(runes[start:i])
+			start = i + 1
+		case i > start && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			// camel case, e.g. uploadHandler
+			add(runes[start:i])
+			start = i
+		case i > start && unicode.IsUpper(r) && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			// end of an acronym, e.g. HTTPHandler
+			add(runes[start:i])
+			start = i
+		}
+	}
+	add(runes[start:])
+	return tokens
+}
+
+// RootEnricher records on each chunk the name of the indexed directory holding its file, roots maps the absolute path
+// of the indexed directories to their name, the deepest one holding the file wins
+func RootEnricher(roots map[string]string) Enricher {
+	return func(_ context.Context, filePath string, chunks []Chunk) error {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+		}
+
+		name, longest := "", -1
+		for dir, dirName := range roots {
+			if len(dir) > longest && strings.HasPrefix(absPath, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+				name, longest = dirName, len(dir)
+			}
+		}
+		for i := range chunks {
+			chunks[i].Metadata.Root = name
+		}
+		return nil
+	}
+}
+
+// RootNames names the indexed directories after their path in the repository rooted at root, or after their base name
+// outside of it, prefixed by their parent directories when several share it, it returns the paths without the
+// duplicated directories, and fails if a directory is inside another one, its files would be indexed twice
+func RootNames(root string, paths []string) ([]string, map[string]string, error) {
+	type indexedDir struct {
+		path   string
+		absDir string
+		// parts are the components of the absolute path of a directory outside of the repository, nil inside of it
+		parts []string
+		depth int
+	}
+	var dirs []*indexedDir
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve path %s: %w", path, err)
+		}
+		if seen[absPath] {
+			continue
+		}
+		seen[absPath] = true
+		for _, other := range dirs {
+			if isInside(absPath, other.absDir) || isInside(other.absDir, absPath) {
+				return nil, nil, fmt.Errorf("directories %s and %s are nested, index the outer one only", other.path, path)
+			}
+		}
+		dir := &indexedDir{path: path, absDir: absPath}
+		if rel, err := filepath.Rel(root, absPath); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			dir.parts = strings.FieldsFunc(filepath.ToSlash(absPath), func(r rune) bool { return r == '/' })
+			dir.depth = 1
+		}
+		dirs = append(dirs, dir)
+	}
+
+	name := func(dir *indexedDir) string {
+		if dir.parts == nil {
+			rel, _ := filepath.Rel(root, dir.absDir)
+			return filepath.ToSlash(rel)
+		}
+		if dir.depth > len(dir.parts) {
+			// the absolute path, never the relative one of a directory of the repository
+			return filepath.ToSlash(dir.absDir)
+		}
+		return strings.Join(dir.parts[len(dir.parts)-dir.depth:], "/")
+	}
+	for {
+		counts := make(map[string]int, len(dirs))
+		for _, dir := range dirs {
+			counts[name(dir)]++
+		}
+		deepened := false
+		for _, dir := range dirs {
+			if dir.parts != nil && counts[name(dir)] > 1 && dir.depth <= len(dir.parts) {
+				dir.depth++
+				deepened = true
+			}
+		}
+		if !deepened {
+			break
+		}
+	}
+
+	unique := make([]string, 0, len(dirs))
+	names := make(map[string]string, len(dirs))
+	for _, dir := range dirs {
+		unique = append(unique, dir.path)
+		names[dir.absDir] = name(dir)
+	}
+	return unique, names, nil
+}
+
+// isInside returns true if path is dir or one of its descendants
+func isInside(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ContentHashEnricher records the hash of the normalized content of each chunk, see ContentHash
+func ContentHashEnricher(_ context.Context, _ string, chunks []Chunk) error {
+	for i := range chunks {
+		chunks[i].Metadata.ContentHash = ContentHash(chunks[i].Content)
+	}
+	return nil
+}
+
+// ContentHash hashes the content with its lines trimmed and its blank lines dropped, so copies only differing by
+// their indentation or line endings share the same hash
+func ContentHash(content string) string {
+	hash := sha256.New()
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		hash.Write([]byte(line))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// issuePattern matches the issue tracker references: tracker keys (PROJ-123), issue numbers (#1234), and owned notes
+// (TODO(alice), FIXME(bob))
+var issuePattern = regexp.MustCompile(`\b[A-Z][A-Z0-9]{1,9}-[1-9][0-9]*\b|(?:^|[^\w&#])#[1-9][0-9]*\b|\b(?:TODO|FIXME)\([^()\s]+\)`)
+
+// colorPrefixes are the characters preceding a hex color rather than an issue number, ignoring the spaces, e.g.
+// color: #333 or fill="#333", and colorSuffixes the ones following it, e.g. border: 1px solid #333;
+const (
+	colorPrefixes = `:="'` + "`"
+	colorSuffixes = `;"'` + "`"
+)
+
+// notIssueKeys are the prefixes of tracker-like keys which are standards, not projects, e.g. UTF-8 or SHA-256
+var notIssueKeys = map[string]bool{
+	"AES": true, "CRC": true, "CVE": true, "ISO": true, "SHA": true, "TLS": true, "SSL": true, "UTF": true, "UCS": true,
+}
+
+// IssueEnricher records the issue tracker references found in the content of each chunk, so searches can pivot from
+// a ticket to the code mentioning it
+func IssueEnricher(_ context.Context, _ string, chunks []Chunk) error {
+	for i := range chunks {
+		chunks[i].Metadata.Issues = IssueReferences(chunks[i].Content)
+	}
+	return nil
+}
+
+// IssueReferences returns the distinct issue tracker references of the content, in order of appearance
+func IssueReferences(content string) []string {
+	var references []string
+	seen := make(map[string]bool)
+	for _, location := range issuePattern.FindAllStringIndex(content, -1) {
+		match := content[location[0]:location[1]]
+		if i := strings.IndexByte(match, '#'); i >= 0 {
+			// the character preceding the issue number
+			match = match[i:]
+			before := strings.TrimRight(content[:location[0]+i], " \t")
+			after := strings.TrimLeft(content[location[1]:], " \t")
+			if before != "" && strings.ContainsRune(colorPrefixes, rune(before[len(before)-1])) ||
+				after != "" && strings.ContainsRune(colorSuffixes, rune(after[0])) {
+				continue
+			}
+		}
+		if key, _, found := strings.Cut(match, "-"); found && notIssueKeys[key] {
+			continue
+		}
+		if !seen[match] {
+			seen[match] = true
+			references = append(references, match)
+		}
+	}
+	return references
+}
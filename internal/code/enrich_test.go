@@ -0,0 +1,216 @@
+package code
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "it should split directories and file name on separators",
+			path: "services/media-service/upload_handler.py",
+			want: []string{"services", "media", "service", "upload", "handler"},
+		},
+		{
+			name: "it should split camel case names",
+			path: "src/MediaService/uploadHTTPHandler.ts",
+			want: []string{"src", "media", "service", "upload", "http", "handler"},
+		},
+		{
+			name: "it should drop repeated words",
+			path: "billing/billing.go",
+			want: []string{"billing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			tokens := PathTokens(tt.path)
+
+			// THEN
+			assert.Equal(t, tt.want, tokens)
+		})
+	}
+}
+
+func TestPathContextEnricher(t *testing.T) {
+	// GIVEN
+	root := t.TempDir()
+	chunks := []Chunk{{Content: "def upload(file): ..."}, {Content: "def resize(image): ..."}}
+
+	// WHEN
+	err := PathContextEnricher(root)(context.Background(), filepath.Join(root, "media", "uploader.py"), chunks)
+
+	// THEN
+	require.NoError(t, err)
+	for _, chunk := range chunks {
+		assert.Equal(t, []string{"path: media uploader"}, chunk.Context)
+	}
+}
+
+func TestRootEnricher(t *testing.T) {
+	// GIVEN
+	repository := t.TempDir()
+	enricher := RootEnricher(map[string]string{
+		filepath.Join(repository, "libs"):         "libs",
+		filepath.Join(repository, "libs", "auth"): "libs/auth",
+		filepath.Join(repository, "backend"):      "backend",
+	})
+
+	tests := []struct {
+		name     string
+		filePath string
+		want     string
+	}{
+		{
+			name:     "it should record the root holding the file",
+			filePath: filepath.Join(repository, "backend", "upload.py"),
+			want:     "backend",
+		},
+		{
+			name:     "it should record the deepest root holding the file",
+			filePath: filepath.Join(repository, "libs", "auth", "token.go"),
+			want:     "libs/auth",
+		},
+		{
+			name:     "it should not match a root sharing a prefix of the directory",
+			filePath: filepath.Join(repository, "backend-legacy", "upload.py"),
+			want:     "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := []Chunk{{}}
+
+			// WHEN
+			err := enricher(context.Background(), tt.filePath, chunks)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, chunks[0].Metadata.Root)
+		})
+	}
+}
+
+func TestRootNames(t *testing.T) {
+	// GIVEN
+	repository := filepath.Join(t.TempDir(), "repository")
+	outside := t.TempDir()
+
+	tests := []struct {
+		name      string
+		paths     []string
+		wantPaths []string
+		wantNames map[string]string
+		wantErr   string
+	}{
+		{
+			name:      "it should name the directories after their path in the repository",
+			paths:     []string{filepath.Join(repository, "libs", "auth"), filepath.Join(repository, "backend")},
+			wantPaths: []string{filepath.Join(repository, "libs", "auth"), filepath.Join(repository, "backend")},
+			wantNames: map[string]string{
+				filepath.Join(repository, "libs", "auth"): "libs/auth",
+				filepath.Join(repository, "backend"):      "backend",
+			},
+		},
+		{
+			name:      "it should index a directory given twice once",
+			paths:     []string{filepath.Join(repository, "backend"), filepath.Join(repository, "backend", "..", "backend")},
+			wantPaths: []string{filepath.Join(repository, "backend")},
+			wantNames: map[string]string{filepath.Join(repository, "backend"): "backend"},
+		},
+		{
+			name:    "it should refuse a directory inside another one",
+			paths:   []string{filepath.Join(repository, "libs"), filepath.Join(repository, "libs", "auth")},
+			wantErr: "are nested",
+		},
+		{
+			name:    "it should refuse a directory holding another one",
+			paths:   []string{filepath.Join(repository, "libs", "auth"), repository},
+			wantErr: "are nested",
+		},
+		{
+			name:      "it should prefix the directories outside the repository sharing their base name",
+			paths:     []string{filepath.Join(repository, "api"), filepath.Join(outside, "a", "api"), filepath.Join(outside, "b", "api")},
+			wantPaths: []string{filepath.Join(repository, "api"), filepath.Join(outside, "a", "api"), filepath.Join(outside, "b", "api")},
+			wantNames: map[string]string{
+				filepath.Join(repository, "api"):   "api",
+				filepath.Join(outside, "a", "api"): "a/api",
+				filepath.Join(outside, "b", "api"): "b/api",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			paths, names, err := RootNames(repository, tt.paths)
+
+			// THEN
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPaths, paths)
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	// GIVEN
+	content := "func add(a, b int) int {\n\treturn a + b\n}"
+
+	// WHEN
+	reindented := ContentHash("  func add(a, b int) int {\r\n\n      return a + b\r\n  }\n")
+
+	// THEN
+	assert.Equal(t, ContentHash(content), reindented, "it should ignore indentation, blank lines and line endings")
+	assert.NotEqual(t, ContentHash(content), ContentHash("func add(a, b int) int {\n\treturn b + a\n}"))
+}
+
+func TestIssueReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "it should find the tracker keys, issue numbers and owned notes",
+			content: "// TODO(alice): drop once PAY-1234 ships, see #87\nfunc retry() {}",
+			want:    []string{"TODO(alice)", "PAY-1234", "#87"},
+		},
+		{
+			name:    "it should return each reference once",
+			content: "// PAY-1234\n// fixed by PAY-1234",
+			want:    []string{"PAY-1234"},
+		},
+		{
+			name:    "it should ignore the standards, colors and anchors looking like references",
+			content: "charset = \"UTF-8\"  # SHA-256 of the body\ncolor: #fff; x := &#39;\nlink(\"page#2\")",
+		},
+		{
+			name:    "it should ignore the hex colors made of digits",
+			content: "border: 1px solid #333;\n<rect fill=\"#555555\"/>\n{color: '#123456', bg: #123abc} // fixes #42",
+			want:    []string{"#42"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			references := IssueReferences(tt.content)
+
+			// THEN
+			assert.Equal(t, tt.want, references)
+		})
+	}
+}
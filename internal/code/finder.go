@@ -11,7 +11,28 @@ type Consumer[T any] func(T) error
 // fixme: find a better place for this
 var dirToSkip = set.Of(".venv", ".git", "node_modules", "venv", "__pycache__", ".idea", ".vscode")
 
+// FindInDirectory calls the callback with the files of the directory having one of the extensions, with the
+// dockerfiles and the compose files, and with the extension-less shell scripts when the shell extension is one of them
 func FindInDirectory(dir string, extensions set.Set[string], callback Consumer[string]) error {
+	scripts := extensions.Contains(".sh")
+	return FindFiles(
+		dir,
+		func(name string) bool {
+			return extensions.Contains(filepath.Ext(name)) || IsDeploymentFile(name) ||
+				(scripts && filepath.Ext(name) == "")
+		},
+		func(path string) error {
+			if filepath.Ext(path) == "" && !IsDeploymentFile(path) && !IsShellScript(path) {
+				return nil
+			}
+			return callback(path)
+		},
+	)
+}
+
+// FindFiles calls the callback with the files of the directory whose name matches, skipping the same directories as
+// FindInDirectory
+func FindFiles(dir string, match func(name string) bool, callback Consumer[string]) error {
 	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -19,7 +40,7 @@ func FindInDirectory(dir string, extensions set.Set[string], callback Consumer[s
 		if d.IsDir() && dirToSkip.Contains(d.Name()) {
 			return fs.SkipDir
 		}
-		if !d.IsDir() && extensions.Contains(filepath.Ext(d.Name())) {
+		if !d.IsDir() && match(d.Name()) {
 			err := callback(path)
 			if err != nil {
 				return err
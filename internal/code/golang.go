@@ -0,0 +1,141 @@
+package code
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	goModule struct {
+		path string // module path, as declared in go.mod
+		dir  string // directory containing go.mod
+	}
+
+	// GoModuleResolver finds the module owning go files, caching the go.mod lookups per directory
+	GoModuleResolver struct {
+		lock    sync.Mutex
+		modules map[string]*goModule
+	}
+)
+
+func NewGoModuleResolver() *GoModuleResolver {
+	return &GoModuleResolver{
+		modules: make(map[string]*goModule),
+	}
+}
+
+// Enricher records the module path, package name and package path of go chunks
+func (r *GoModuleResolver) Enricher(_ context.Context, filePath string, chunks []Chunk) error {
+	if len(chunks) == 0 || filepath.Ext(filePath) != ".go" {
+		return nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), filePath, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return fmt.Errorf("failed to parse package clause of %s: %w", filePath, err)
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+	}
+	dir := filepath.Dir(absPath)
+	module, err := r.resolve(dir)
+	if err != nil {
+		return err
+	}
+
+	var modulePath, packagePath, importPath string
+	if module != nil {
+		modulePath = module.path
+		importPath = module.path
+		rel, err := filepath.Rel(module.dir, dir)
+		if err == nil && rel != "." {
+			packagePath = filepath.ToSlash(rel)
+			importPath = module.path + "/" + packagePath
+		}
+	}
+
+	for i := range chunks {
+		chunks[i].Metadata.GoModule = modulePath
+		chunks[i].Metadata.Package = file.Name.Name
+		chunks[i].Metadata.PackagePath = packagePath
+		chunks[i].Metadata.ImportPath = importPath
+	}
+
+	return nil
+}
+
+// resolve returns the module owning the directory, or nil if the directory is not part of a module
+func (r *GoModuleResolver) resolve(dir string) (*goModule, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var visited []string
+	var module *goModule
+	for current := dir; ; current = filepath.Dir(current) {
+		if cached, found := r.modules[current]; found {
+			module = cached
+			break
+		}
+		visited = append(visited, current)
+
+		modulePath, err := readModulePath(filepath.Join(current, "go.mod"))
+		if err == nil {
+			module = &goModule{path: modulePath, dir: current}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if parent := filepath.Dir(current); parent == current {
+			break
+		}
+	}
+
+	for _, v := range visited {
+		r.modules[v] = module
+	}
+	return module, nil
+}
+
+func readModulePath(goModPath string) (string, error) {
+	file, err := os.Open(goModPath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "module" {
+			continue
+		}
+		modulePath := fields[1]
+		if unquoted, err := strconv.Unquote(modulePath); err == nil {
+			modulePath = unquoted
+		}
+		if modulePath != "" {
+			return modulePath, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", goModPath, err)
+	}
+
+	return "", fmt.Errorf("no module directive found in %s", goModPath)
+}
@@ -0,0 +1,32 @@
+package code
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoModuleResolver_Enricher(t *testing.T) {
+	// GIVEN
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module github.com/acme/shop\n\ngo 1.24\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "internal", "auth"), 0755))
+	filePath := filepath.Join(root, "internal", "auth", "token.go")
+	require.NoError(t, os.WriteFile(filePath, []byte("package auth\n\nfunc Validate() {}\n"), 0644))
+
+	chunks := []Chunk{{Id: "token.go_Validate_3"}}
+
+	// WHEN
+	err := NewGoModuleResolver().Enricher(context.Background(), filePath, chunks)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, "github.com/acme/shop", chunks[0].Metadata.GoModule)
+	assert.Equal(t, "auth", chunks[0].Metadata.Package)
+	assert.Equal(t, "internal/auth", chunks[0].Metadata.PackagePath)
+	assert.Equal(t, "github.com/acme/shop/internal/auth", chunks[0].Metadata.ImportPath)
+}
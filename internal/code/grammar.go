@@ -0,0 +1,91 @@
+package code
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"sort"
+
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// grammarModules maps the languages to the go modules of their tree-sitter grammar
+var grammarModules = map[string]string{
+	"python":        "github.com/tree-sitter/tree-sitter-python",
+	"bash":          "github.com/tree-sitter/tree-sitter-bash",
+	"c":             "github.com/tree-sitter/tree-sitter-c",
+	"c_header":      "github.com/tree-sitter/tree-sitter-c",
+	"cc":            "github.com/tree-sitter/tree-sitter-cpp",
+	"cpp":           "github.com/tree-sitter/tree-sitter-cpp",
+	"cxx":           "github.com/tree-sitter/tree-sitter-cpp",
+	"hpp":           "github.com/tree-sitter/tree-sitter-cpp",
+	"go":            "github.com/tree-sitter/tree-sitter-go",
+	"java":          "github.com/tree-sitter/tree-sitter-java",
+	"javascript":    "github.com/tree-sitter/tree-sitter-javascript",
+	"kotlin":        "github.com/alexaandru/go-sitter-forest/kotlin",
+	"kotlin_script": "github.com/alexaandru/go-sitter-forest/kotlin",
+	"typescript":    "github.com/tree-sitter/tree-sitter-typescript",
+	"tsx":           "github.com/tree-sitter/tree-sitter-typescript",
+	"rust":          "github.com/tree-sitter/tree-sitter-rust",
+	"shell":         "github.com/tree-sitter/tree-sitter-bash",
+	"scala":         "github.com/tree-sitter/tree-sitter-scala",
+	"swift":         "github.com/alexaandru/go-sitter-forest/swift",
+}
+
+// GrammarInfo describes a tree-sitter grammar compiled in the binary
+type GrammarInfo struct {
+	Language string
+	Module   string
+	// Version of the go module, unknown if the build information is not available
+	Version    string
+	AbiVersion uint32
+}
+
+// Grammars returns the grammars of the supported languages, sorted by language
+func (p *GenericParser) Grammars() []GrammarInfo {
+	versions := make(map[string]string)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			versions[dep.Path] = dep.Version
+		}
+	}
+
+	grammars := make([]GrammarInfo, 0, len(p.languages))
+	for name, config := range p.languages {
+		module := grammarModules[name]
+		version, found := versions[module]
+		if !found {
+			version = "unknown"
+		}
+		grammars = append(grammars, GrammarInfo{
+			Language:   name,
+			Module:     module,
+			Version:    version,
+			AbiVersion: config.Language.AbiVersion(),
+		})
+	}
+	sort.Slice(grammars, func(i, j int) bool {
+		return grammars[i].Language < grammars[j].Language
+	})
+	return grammars
+}
+
+// CheckQueries compiles the queries of all the languages against their grammar, a query broken by a grammar bump
+// would otherwise only be noticed as missing chunks
+func (p *GenericParser) CheckQueries() error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(p.languages)) {
+		config := p.languages[name]
+		for _, queryType := range sortedQueryTypes(config.Queries) {
+			query, err := sitter.NewQuery(config.Language, config.Queries[queryType])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("query %s of %s does not compile: %w", queryType, name, err))
+				continue
+			}
+			query.Close()
+		}
+	}
+	return errors.Join(errs...)
+}
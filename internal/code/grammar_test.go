@@ -0,0 +1,47 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericParser_CheckQueries(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+
+	// WHEN
+	err := parser.CheckQueries()
+
+	// THEN
+	assert.NoError(t, err, "it should compile all the queries against the grammars, check them after a grammar bump")
+}
+
+func TestGenericParser_CheckQueries_BrokenQuery(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	config := parser.languages["python"]
+	config.Queries = map[string]string{"functions": `(function_definition unknown_field: (identifier) @name)`}
+	parser.languages["python"] = config
+
+	// WHEN
+	err := parser.CheckQueries()
+
+	// THEN
+	assert.ErrorContains(t, err, "query functions of python does not compile")
+}
+
+func TestGenericParser_Grammars(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+
+	// WHEN
+	grammars := parser.Grammars()
+
+	// THEN
+	assert.Len(t, grammars, len(parser.languages))
+	for _, grammar := range grammars {
+		assert.NotEmpty(t, grammar.Module, "it should know the module of the %s grammar", grammar.Language)
+		assert.NotZero(t, grammar.AbiVersion)
+	}
+}
@@ -1,17 +1,33 @@
 package code
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
+	"github.com/a-peyrard/mm/internal/set"
+
+	kotlin "github.com/alexaandru/go-sitter-forest/kotlin"
+	swift "github.com/alexaandru/go-sitter-forest/swift"
 	sitter "github.com/tree-sitter/go-tree-sitter"
+	bash "github.com/tree-sitter/tree-sitter-bash/bindings/go"
+	c "github.com/tree-sitter/tree-sitter-c/bindings/go"
+	cpp "github.com/tree-sitter/tree-sitter-cpp/bindings/go"
 	golang "github.com/tree-sitter/tree-sitter-go/bindings/go"
+	java "github.com/tree-sitter/tree-sitter-java/bindings/go"
 	javascript "github.com/tree-sitter/tree-sitter-javascript/bindings/go"
 	python "github.com/tree-sitter/tree-sitter-python/bindings/go"
 	rust "github.com/tree-sitter/tree-sitter-rust/bindings/go"
+	scala "github.com/tree-sitter/tree-sitter-scala/bindings/go"
 	typescript "github.com/tree-sitter/tree-sitter-typescript/bindings/go"
 )
 
+// ChunkMetadata is stored along with each chunk, changing the meaning of its fields or the ids of the chunks requires
+// bumping schema.Version, as adding a field the search filters rely on, other optional fields do not
 type ChunkMetadata struct {
 	FilePath     string `json:"file_path"`
 	FunctionName string `json:"function_name,omitempty"`
@@ -20,12 +36,37 @@ type ChunkMetadata struct {
 	EndLine      int    `json:"end_line"`
 	Language     string `json:"language"`
 	ChunkType    string `json:"chunk_type"` // "function", "class", "variable", "import", etc.
+
+	ModifiedAt    int64  `json:"modified_at"`  // unix timestamp of the file modification
+	CommittedAt   int64  `json:"committed_at"` // unix timestamp of the last commit touching the chunk, 0 if unknown
+	CommitSubject string `json:"commit_subject,omitempty"`
+
+	GoModule    string `json:"go_module,omitempty"`
+	Package     string `json:"package,omitempty"`
+	PackagePath string `json:"package_path,omitempty"` // directory of the package, relative to the module root
+	ImportPath  string `json:"import_path,omitempty"`
+	ModulePath  string `json:"module_path,omitempty"` // dotted python module path, e.g. billing.tax.calculator
+
+	// Root is the name of the indexed directory holding the file, several can be indexed in the same collection
+	Root string `json:"root,omitempty"`
+	// ContentHash identifies the content of the chunk regardless of its indentation and blank lines, vendored or
+	// generated copies of the same code share it
+	ContentHash string `json:"content_hash,omitempty"`
+
+	// Issues are the issue tracker references found in the content (PROJ-123, #1234, TODO(owner))
+	Issues []string `json:"issues,omitempty"`
+
+	// Image is the image of a dockerfile stage, or of a compose service, e.g. python:3.12-slim
+	Image string `json:"image,omitempty"`
 }
 
 type Chunk struct {
 	Id       string        `json:"id"`
 	Content  string        `json:"content"`
 	Metadata ChunkMetadata `json:"metadata"`
+
+	// Context holds extra lines embedded alongside the content, but not stored as part of the document
+	Context []string `json:"context,omitempty"`
 }
 
 type LanguageConfig struct {
@@ -38,13 +79,29 @@ type LanguageConfig struct {
 // GenericParser handles parsing of multiple languages
 type GenericParser struct {
 	languages map[string]LanguageConfig
+
+	// files smaller than this size (in bytes) produce a single file chunk, 0 disables it
+	smallFileThreshold int
+}
+
+type ParserOption func(*GenericParser)
+
+// WithSmallFileThreshold makes files smaller than the threshold (in bytes) produce a single file-level chunk,
+// rather than many tiny symbol chunks
+func WithSmallFileThreshold(threshold int) ParserOption {
+	return func(p *GenericParser) {
+		p.smallFileThreshold = threshold
+	}
 }
 
 // NewGenericParser creates a new parser with language configurations
-func NewGenericParser() *GenericParser {
+func NewGenericParser(opts ...ParserOption) *GenericParser {
 	parser := &GenericParser{
 		languages: make(map[string]LanguageConfig),
 	}
+	for _, opt := range opts {
+		opt(parser)
+	}
 
 	// Configure supported languages
 	parser.configureLanguages()
@@ -97,7 +154,7 @@ func (p *GenericParser) configureLanguages() {
 					body: (block) @function.body
 				) @function.definition
 				(method_declaration
-					name: (identifier) @method.name
+					name: (field_identifier) @method.name
 					parameters: (parameter_list) @method.params
 					body: (block) @method.body
 				) @method.definition
@@ -184,14 +241,14 @@ func (p *GenericParser) configureLanguages() {
 			`,
 			"classes": `
 				(class_declaration
-					name: (identifier) @class.name
+					name: (type_identifier) @class.name
 					body: (class_body) @class.body
 				) @class.definition
 			`,
 			"interfaces": `
 				(interface_declaration
 					name: (type_identifier) @interface.name
-					body: (object_type) @interface.body
+					body: (interface_body) @interface.body
 				) @interface.definition
 			`,
 			"types": `
@@ -265,6 +322,315 @@ func (p *GenericParser) configureLanguages() {
 		},
 	}
 
+	// Java configuration
+	p.languages["java"] = LanguageConfig{
+		Language:     sitter.NewLanguage(java.Language()),
+		FileExt:      ".java",
+		LanguageName: "java",
+		Queries: map[string]string{
+			"methods": `
+				(method_declaration
+					name: (identifier) @method.name
+					parameters: (formal_parameters) @method.params
+					body: (block) @method.body
+				) @method.declaration
+				(constructor_declaration
+					name: (identifier) @method.name
+					parameters: (formal_parameters) @method.params
+					body: (constructor_body) @method.body
+				) @method.declaration
+			`,
+			"classes": `
+				(class_declaration
+					name: (identifier) @class.name
+					body: (class_body) @class.body
+				) @class.declaration
+				(record_declaration
+					name: (identifier) @class.name
+					body: (class_body) @class.body
+				) @class.declaration
+			`,
+			"interfaces": `
+				(interface_declaration
+					name: (identifier) @interface.name
+					body: (interface_body) @interface.body
+				) @interface.declaration
+			`,
+			"annotations": `
+				(annotation_type_declaration
+					name: (identifier) @annotation.name
+					body: (annotation_type_body) @annotation.body
+				) @annotation.declaration
+			`,
+			"enums": `
+				(enum_declaration
+					name: (identifier) @enum.name
+					body: (enum_body) @enum.body
+				) @enum.declaration
+			`,
+			"fields": `
+				(field_declaration
+					type: (_) @field.type
+					declarator: (variable_declarator
+						name: (identifier) @field.name
+					)
+				) @field.declaration
+			`,
+		},
+	}
+
+	// C configuration
+	p.languages["c"] = LanguageConfig{
+		Language:     sitter.NewLanguage(c.Language()),
+		FileExt:      ".c",
+		LanguageName: "c",
+		Queries: map[string]string{
+			"functions": `
+				(function_definition
+					declarator: [(function_declarator) (pointer_declarator)] @function.declarator
+					body: (compound_statement) @function.body
+				) @function.definition
+			`,
+			"structs": `
+				(struct_specifier
+					name: (type_identifier) @struct.name
+					body: (field_declaration_list) @struct.body
+				) @struct.definition
+				(union_specifier
+					name: (type_identifier) @struct.name
+					body: (field_declaration_list) @struct.body
+				) @struct.definition
+			`,
+			"enums": `
+				(enum_specifier
+					name: (type_identifier) @enum.name
+					body: (enumerator_list) @enum.body
+				) @enum.definition
+			`,
+			"types": `
+				(type_definition
+					declarator: (type_identifier) @type.name
+				) @type.definition
+			`,
+			"macros": `
+				(preproc_def
+					name: (identifier) @macro.name
+					value: (preproc_arg) @macro.value
+				) @macro.definition
+				(preproc_function_def
+					name: (identifier) @macro.name
+					parameters: (preproc_params) @macro.params
+					value: (preproc_arg) @macro.value
+				) @macro.definition
+			`,
+		},
+	}
+
+	// C headers mostly declare the functions defined elsewhere, their prototypes are chunked as well
+	headerQueries := maps.Clone(p.languages["c"].Queries)
+	headerQueries["prototypes"] = `
+		(declaration
+			declarator: [(function_declarator) (pointer_declarator)] @prototype.declarator
+		) @prototype.declaration
+	`
+	p.languages["c_header"] = LanguageConfig{
+		Language:     p.languages["c"].Language,
+		FileExt:      ".h",
+		LanguageName: "c",
+		Queries:      headerQueries,
+	}
+
+	// C++ configuration, the member functions defined in their class or out of it are attributed to it, and the
+	// templates are chunked with their template parameters
+	cppConfig := LanguageConfig{
+		Language:     sitter.NewLanguage(cpp.Language()),
+		LanguageName: "cpp",
+		Queries: map[string]string{
+			"functions": `
+				(function_definition
+					declarator: [
+						(function_declarator declarator: [
+							(identifier) @function.name
+							(field_identifier) @function.name
+							(destructor_name) @function.name
+							(operator_name) @function.name
+							(qualified_identifier name: (_) @function.name)
+						])
+						(pointer_declarator declarator: (function_declarator declarator: (identifier) @function.name))
+						(reference_declarator (function_declarator declarator: (identifier) @function.name))
+					]
+					body: (compound_statement) @function.body
+				) @function.definition
+			`,
+			"classes": `
+				(class_specifier
+					name: (type_identifier) @class.name
+					body: (field_declaration_list) @class.body
+				) @class.definition
+			`,
+			"structs": `
+				(struct_specifier
+					name: (type_identifier) @struct.name
+					body: (field_declaration_list) @struct.body
+				) @struct.definition
+			`,
+			"enums": `
+				(enum_specifier
+					name: (type_identifier) @enum.name
+					body: (enumerator_list) @enum.body
+				) @enum.definition
+			`,
+		},
+	}
+	for name, ext := range map[string]string{"cpp": ".cpp", "cc": ".cc", "cxx": ".cxx", "hpp": ".hpp"} {
+		config := cppConfig
+		config.FileExt = ext
+		p.languages[name] = config
+	}
+
+	// Kotlin configuration, the gradle scripts included, the extension functions are attributed to their receiver type
+	kotlinConfig := LanguageConfig{
+		Language:     sitter.NewLanguage(kotlin.GetLanguage()),
+		FileExt:      ".kt",
+		LanguageName: "kotlin",
+		Queries: map[string]string{
+			"functions": `
+				(function_declaration
+					(simple_identifier) @function.name
+					(function_value_parameters) @function.params
+					(function_body) @function.body
+				) @function.declaration
+			`,
+			"classes": `
+				(class_declaration
+					(type_identifier) @class.name
+				) @class.declaration
+			`,
+			"objects": `
+				(object_declaration
+					(type_identifier) @object.name
+					(class_body) @object.body
+				) @object.declaration
+				(companion_object
+					(type_identifier)? @object.name
+					(class_body) @object.body
+				) @object.declaration
+			`,
+		},
+	}
+	p.languages["kotlin"] = kotlinConfig
+	kotlinConfig.FileExt = ".kts"
+	p.languages["kotlin_script"] = kotlinConfig
+
+	// Swift configuration, classes, structs, enums, and extensions are all class declarations told by their kind
+	p.languages["swift"] = LanguageConfig{
+		Language:     sitter.NewLanguage(swift.GetLanguage()),
+		FileExt:      ".swift",
+		LanguageName: "swift",
+		Queries: map[string]string{
+			"functions": `
+				(function_declaration
+					name: (simple_identifier) @function.name
+				) @function.declaration
+				(init_declaration) @function.declaration
+			`,
+			"classes": `
+				(class_declaration
+					declaration_kind: ["class" "actor"]
+					name: (type_identifier) @class.name
+				) @class.declaration
+			`,
+			"structs": `
+				(class_declaration
+					declaration_kind: "struct"
+					name: (type_identifier) @struct.name
+				) @struct.declaration
+			`,
+			"enums": `
+				(class_declaration
+					declaration_kind: "enum"
+					name: (type_identifier) @enum.name
+				) @enum.declaration
+			`,
+			"protocols": `
+				(protocol_declaration
+					name: (type_identifier) @protocol.name
+					body: (protocol_body) @protocol.body
+				) @protocol.declaration
+			`,
+			"extensions": `
+				(class_declaration
+					declaration_kind: "extension"
+					name: (user_type (type_identifier) @extension.name)
+				) @extension.declaration
+			`,
+		},
+	}
+
+	// Scala configuration, the case classes are chunked as classes
+	p.languages["scala"] = LanguageConfig{
+		Language:     sitter.NewLanguage(scala.Language()),
+		FileExt:      ".scala",
+		LanguageName: "scala",
+		Queries: map[string]string{
+			"functions": `
+				(function_definition
+					name: (identifier) @function.name
+					parameters: (parameters)* @function.params
+					body: (_) @function.body
+				) @function.definition
+			`,
+			"classes": `
+				(class_definition
+					name: (identifier) @class.name
+				) @class.definition
+			`,
+			"objects": `
+				(object_definition
+					name: (identifier) @object.name
+				) @object.definition
+			`,
+			"traits": `
+				(trait_definition
+					name: (identifier) @trait.name
+				) @trait.definition
+			`,
+		},
+	}
+
+	// Shell configuration, only the variables assigned at the top level of the scripts are chunked, without capturing
+	// their value, a word taken for their name otherwise, the extension-less scripts are told by their shebang
+	shellConfig := LanguageConfig{
+		Language:     sitter.NewLanguage(bash.Language()),
+		FileExt:      ".sh",
+		LanguageName: "shell",
+		Queries: map[string]string{
+			"functions": `
+				(function_definition
+					name: (word) @function.name
+					body: (_) @function.body
+				) @function.definition
+			`,
+			"variables": `
+				(program
+					(variable_assignment
+						name: (variable_name) @variable.name
+					) @variable.assignment
+				)
+				(program
+					(declaration_command
+						(variable_assignment
+							name: (variable_name) @variable.name
+						)
+					) @variable.declaration
+				)
+			`,
+		},
+	}
+	p.languages["shell"] = shellConfig
+	shellConfig.FileExt = ".bash"
+	p.languages["bash"] = shellConfig
+
 	// Also add TypeScript JSX support
 	p.languages["tsx"] = LanguageConfig{
 		Language:     sitter.NewLanguage(typescript.LanguageTSX()),
@@ -276,10 +642,29 @@ func (p *GenericParser) configureLanguages() {
 
 // ParseFile parses a source file and returns chunks
 func (p *GenericParser) ParseFile(filePath string, sourceCode []byte) ([]Chunk, error) {
+	switch {
+	case isDockerfile(filePath):
+		return parseDockerfile(filePath, sourceCode), nil
+	case isComposeFile(filePath):
+		return parseComposeFile(filePath, sourceCode)
+	}
+
 	config, found := p.detectLanguage(filePath)
+	if !found && filepath.Ext(filePath) == "" && isShellScript(sourceCode) {
+		shell := p.languages["shell"]
+		config, found = &shell, true
+	}
 	if !found {
 		return nil, fmt.Errorf("unsupported file type: %s", filePath)
 	}
+	if config.FileExt == ".h" && isCppHeader(sourceCode) {
+		cppHeader := p.languages["hpp"]
+		config = &cppHeader
+	}
+
+	if len(sourceCode) > 0 && len(sourceCode) < p.smallFileThreshold {
+		return []Chunk{fileChunk(filePath, sourceCode, config.LanguageName)}, nil
+	}
 
 	parser := sitter.NewParser()
 	err := parser.SetLanguage(config.Language)
@@ -314,11 +699,11 @@ func (p *GenericParser) ParseFile(filePath string, sourceCode []byte) ([]Chunk,
 
 	chunks := make([]Chunk, 0)
 
-	// Extract different types of definitions
-	for queryType, queryString := range config.Queries {
+	// Extract different types of definitions, in a stable order
+	for _, queryType := range sortedQueryTypes(config.Queries) {
 		typeChunks, err := p.extractChunksWithQuery(
 			rootNode,
-			queryString,
+			config.Queries[queryType],
 			sourceCode,
 			filePath,
 			config,
@@ -330,9 +715,33 @@ func (p *GenericParser) ParseFile(filePath string, sourceCode []byte) ([]Chunk,
 		chunks = append(chunks, typeChunks...)
 	}
 
+	// two queries can chunk the same declaration, e.g. the struct of a c typedef, the ids of the chunks must be unique
+	ids := set.New[string]()
+	for i := range chunks {
+		if ids.Contains(chunks[i].Id) {
+			chunks[i].Id = fmt.Sprintf("%s_%s", chunks[i].Id, chunks[i].Metadata.ChunkType)
+		}
+		ids.Add(chunks[i].Id)
+	}
+
 	return chunks, nil
 }
 
+func fileChunk(filePath string, sourceCode []byte, language string) Chunk {
+	content := string(sourceCode)
+	return Chunk{
+		Id:      fmt.Sprintf("%s_file_1", filePath),
+		Content: content,
+		Metadata: ChunkMetadata{
+			FilePath:  filePath,
+			StartLine: 1,
+			EndLine:   strings.Count(strings.TrimRight(content, "\n"), "\n") + 1,
+			Language:  language,
+			ChunkType: "file",
+		},
+	}
+}
+
 func (p *GenericParser) extractChunksWithQuery(
 	node *sitter.Node,
 	queryString string,
@@ -379,8 +788,10 @@ func (p *GenericParser) processMatch(
 	chunkType string,
 ) *Chunk {
 	var mainNode *sitter.Node
+	var declarator *sitter.Node
 	var name string
 	var className string
+	var namespace string
 
 	// Extract information from captures
 	for _, capture := range match.Captures {
@@ -391,7 +802,11 @@ func (p *GenericParser) processMatch(
 			mainNode = &capture.Node
 		case capture.Node.Kind() == "assignment":
 			mainNode = &capture.Node
-		case capture.Node.Kind() == "identifier":
+		case chunkNodes[language].Contains(capture.Node.Kind()):
+			mainNode = &capture.Node
+		case declaratorNodes.Contains(capture.Node.Kind()):
+			declarator = &capture.Node
+		case nameNodes.Contains(capture.Node.Kind()):
 			name = content
 		case strings.Contains(capture.Node.Kind(), "class"):
 			if strings.Contains(capture.Node.Kind(), "name") {
@@ -403,6 +818,24 @@ func (p *GenericParser) processMatch(
 	if mainNode == nil {
 		return nil
 	}
+	if declarator != nil {
+		functionName, isFunction := functionDeclaratorName(declarator, sourceCode)
+		if !isFunction {
+			return nil
+		}
+		name = functionName
+	}
+	if language == "swift" && mainNode.Kind() == "init_declaration" {
+		name = "init"
+	}
+	if language == "cpp" {
+		if parent := mainNode.Parent(); parent != nil && parent.Kind() == "template_declaration" {
+			mainNode = parent
+		}
+		if qualified := cppQualifiedDeclarator(mainNode); qualified != nil {
+			_, name = cppQualifiedName(qualified, sourceCode)
+		}
+	}
 
 	// Get the content of the matched node
 	content := mainNode.Utf8Text(sourceCode)
@@ -410,6 +843,11 @@ func (p *GenericParser) processMatch(
 	// Calculate line numbers
 	startLine := int(mainNode.StartPosition().Row) + 1
 	endLine := int(mainNode.EndPosition().Row) + 1
+	if mainNode.EndPosition().Column == 0 && endLine > startLine {
+		// the node ends with its line, e.g. a c macro
+		content = strings.TrimSuffix(content, "\n")
+		endLine--
+	}
 
 	// Generate unique ID
 	id := fmt.Sprintf("%s_%s_%d", filePath, name, startLine)
@@ -421,6 +859,36 @@ func (p *GenericParser) processMatch(
 		className = extractParentIdentifier(mainNode, sourceCode)
 		chunkType = "methods"
 	}
+	if language == "java" && (chunkType == "methods" || chunkType == "fields") {
+		className = enclosingJavaType(mainNode, sourceCode)
+	}
+	if language == "cpp" {
+		if owner := cppMemberOwner(mainNode, sourceCode); chunkType == "functions" && owner != "" {
+			className = owner
+			chunkType = "methods"
+		}
+		namespace = enclosingCppNamespace(mainNode, sourceCode)
+	}
+	if language == "swift" && chunkType == "functions" {
+		if owner := swiftOwner(mainNode, sourceCode); owner != "" {
+			className = owner
+			chunkType = "methods"
+		}
+	}
+	if language == "scala" && chunkType == "functions" {
+		if owner := scalaOwner(mainNode, sourceCode); owner != "" {
+			className = owner
+			chunkType = "methods"
+		}
+	}
+	if language == "kotlin" {
+		if owner := kotlinOwner(mainNode, sourceCode); owner != "" && chunkType != "classes" {
+			className = owner
+			if chunkType == "functions" {
+				chunkType = "methods"
+			}
+		}
+	}
 	if chunkType == "classes" {
 		className = name
 		name = ""
@@ -438,6 +906,7 @@ func (p *GenericParser) processMatch(
 			EndLine:      endLine,
 			Language:     language,
 			ChunkType:    chunkType,
+			Package:      namespace,
 		},
 	}
 
@@ -459,6 +928,55 @@ func (p *GenericParser) processMatch(
 //	return ""
 //}
 
+// queryTypesOrder is the order in which chunks are extracted, unknown query types come last, alphabetically
+var queryTypesOrder = []string{
+	"functions", "methods", "classes", "interfaces", "annotations", "structs", "enums", "traits", "impls", "types",
+	"objects", "protocols", "extensions", "prototypes", "macros", "fields", "variables", "constants", "statics", "imports",
+}
+
+func sortedQueryTypes(queries map[string]string) []string {
+	rank := func(queryType string) int {
+		if idx := slices.Index(queryTypesOrder, queryType); idx >= 0 {
+			return idx
+		}
+		return len(queryTypesOrder)
+	}
+
+	queryTypes := slices.Collect(maps.Keys(queries))
+	slices.SortFunc(queryTypes, func(a, b string) int {
+		if byRank := cmp.Compare(rank(a), rank(b)); byRank != 0 {
+			return byRank
+		}
+		return strings.Compare(a, b)
+	})
+	return queryTypes
+}
+
+// Extensions returns the file extensions of all the supported languages
+func (p *GenericParser) Extensions() set.Set[string] {
+	extensions := set.New[string]()
+	for _, config := range p.languages {
+		extensions.Add(config.FileExt)
+	}
+	return extensions
+}
+
+// Language returns the name of the language of the file, empty if it is not supported, told by its extension only,
+// the .h headers being c ones even when ParseFile parses them as c++
+func (p *GenericParser) Language(filePath string) string {
+	switch {
+	case isDockerfile(filePath):
+		return "dockerfile"
+	case isComposeFile(filePath):
+		return "compose"
+	}
+	config, found := p.detectLanguage(filePath)
+	if !found {
+		return ""
+	}
+	return config.LanguageName
+}
+
 func (p *GenericParser) detectLanguage(filePath string) (config *LanguageConfig, found bool) {
 	for _, config := range p.languages {
 		if strings.HasSuffix(filePath, config.FileExt) {
@@ -493,3 +1011,191 @@ func isMethod(node *sitter.Node, sourceCode []byte) bool {
 	}
 	return false
 }
+
+// nameNodes are the kinds of the nodes naming the chunks
+var nameNodes = set.Of(
+	"identifier", "type_identifier", "field_identifier", "destructor_name", "operator_name", "simple_identifier",
+	"word", "variable_name",
+)
+
+// declaratorNodes are the kinds of the c declarators, nested until the function declarator naming the function, e.g.
+// the pointers of char **split(...)
+var declaratorNodes = set.Of("function_declarator", "pointer_declarator")
+
+// functionDeclaratorName returns the name of the function declared by the c declarator, following the nested
+// declarators, false if the declarator does not declare a function, e.g. a variable or a function pointer
+func functionDeclaratorName(declarator *sitter.Node, sourceCode []byte) (string, bool) {
+	for declarator != nil && declarator.Kind() != "function_declarator" {
+		declarator = declarator.ChildByFieldName("declarator")
+	}
+	if declarator == nil {
+		return "", false
+	}
+	name := declarator.ChildByFieldName("declarator")
+	if name == nil || !nameNodes.Contains(name.Kind()) {
+		return "", false
+	}
+	return name.Utf8Text(sourceCode), true
+}
+
+// chunkNodes are the kinds of the nodes chunked by language, besides the definitions, e.g. the java declarations
+var chunkNodes = map[string]set.Set[string]{
+	"java": set.Of(
+		"class_declaration", "record_declaration", "interface_declaration", "annotation_type_declaration",
+		"enum_declaration", "method_declaration", "constructor_declaration", "field_declaration",
+	),
+	"c":      set.Of("struct_specifier", "union_specifier", "enum_specifier", "preproc_def", "preproc_function_def", "declaration"),
+	"cpp":    set.Of("class_specifier", "struct_specifier", "enum_specifier"),
+	"kotlin": set.Of("function_declaration", "class_declaration", "object_declaration", "companion_object"),
+	"shell":  set.Of("variable_assignment", "declaration_command"),
+	"swift":  set.Of("function_declaration", "init_declaration", "class_declaration", "protocol_declaration"),
+}
+
+// enclosingJavaType returns the name of the innermost type declaring the java member, empty for a top-level one
+func enclosingJavaType(node *sitter.Node, sourceCode []byte) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.Kind() {
+		case "class_declaration", "record_declaration", "interface_declaration", "enum_declaration",
+			"annotation_type_declaration":
+			if name := parent.ChildByFieldName("name"); name != nil {
+				return name.Utf8Text(sourceCode)
+			}
+		}
+	}
+	return ""
+}
+
+// cppConstructs are the constructs telling a c++ header from a c one
+var cppConstructs = regexp.MustCompile(
+	`(?m)^\s*(template\s*<|namespace\s+\w|(public|private|protected)\s*:)|\bclass\s+\w+(\s+final)?\s*([:{]|$)|\bstd::`,
+)
+
+// isCppHeader tells whether the .h header is a c++ one, the headers are c ones unless they use c++ constructs
+func isCppHeader(sourceCode []byte) bool {
+	return cppConstructs.Match(sourceCode)
+}
+
+// cppMemberOwner returns the class of the c++ member function, defined in the class or qualified by it out of it,
+// empty for a free function
+func cppMemberOwner(node *sitter.Node, sourceCode []byte) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Kind() != "class_specifier" && parent.Kind() != "struct_specifier" {
+			continue
+		}
+		if name := parent.ChildByFieldName("name"); name != nil {
+			return name.Utf8Text(sourceCode)
+		}
+	}
+	if qualified := cppQualifiedDeclarator(node); qualified != nil {
+		scope, _ := cppQualifiedName(qualified, sourceCode)
+		return scope
+	}
+	return ""
+}
+
+// cppQualifiedDeclarator returns the qualified name of the c++ function defined out of its class, nil for the others
+func cppQualifiedDeclarator(node *sitter.Node) *sitter.Node {
+	definition := node
+	if definition.Kind() == "template_declaration" {
+		definition = findChild(definition, "function_definition")
+	}
+	if definition == nil {
+		return nil
+	}
+	declarator := definition.ChildByFieldName("declarator")
+	for declarator != nil && declarator.Kind() != "function_declarator" {
+		declarator = declarator.ChildByFieldName("declarator")
+	}
+	if declarator == nil {
+		return nil
+	}
+	qualified := declarator.ChildByFieldName("declarator")
+	if qualified == nil || qualified.Kind() != "qualified_identifier" {
+		return nil
+	}
+	return qualified
+}
+
+// cppQualifiedName splits the qualified name into its scope and its name, through the nested scopes, e.g.
+// outer::Inner and deep for outer::Inner::deep
+func cppQualifiedName(qualified *sitter.Node, sourceCode []byte) (string, string) {
+	var scopes []string
+	node := qualified
+	for node != nil && node.Kind() == "qualified_identifier" {
+		if scope := node.ChildByFieldName("scope"); scope != nil {
+			scopes = append(scopes, scope.Utf8Text(sourceCode))
+		}
+		node = node.ChildByFieldName("name")
+	}
+	if node == nil {
+		return strings.Join(scopes, "::"), ""
+	}
+	return strings.Join(scopes, "::"), node.Utf8Text(sourceCode)
+}
+
+// enclosingCppNamespace returns the namespaces enclosing the c++ node, e.g. billing::tax, empty for the global one
+func enclosingCppNamespace(node *sitter.Node, sourceCode []byte) string {
+	var namespaces []string
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Kind() != "namespace_definition" {
+			continue
+		}
+		if name := parent.ChildByFieldName("name"); name != nil {
+			namespaces = append([]string{name.Utf8Text(sourceCode)}, namespaces...)
+		}
+	}
+	return strings.Join(namespaces, "::")
+}
+
+func findChild(node *sitter.Node, kind string) *sitter.Node {
+	for i := uint(0); i < node.ChildCount(); i++ {
+		if child := node.Child(i); child != nil && child.Kind() == kind {
+			return child
+		}
+	}
+	return nil
+}
+
+// kotlinOwner returns the type the kotlin function belongs to, the receiver type of an extension function, or the
+// class or the object declaring it, the class of a companion object, empty for a top-level declaration
+func kotlinOwner(node *sitter.Node, sourceCode []byte) string {
+	if receiver := node.ChildByFieldName("receiver"); receiver != nil {
+		return receiver.Utf8Text(sourceCode)
+	}
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Kind() != "class_declaration" && parent.Kind() != "object_declaration" {
+			continue
+		}
+		if name := findChild(parent, "type_identifier"); name != nil {
+			return name.Utf8Text(sourceCode)
+		}
+	}
+	return ""
+}
+
+// swiftOwner returns the type declaring the swift function, the type extended for the functions of an extension, empty
+// for a global function
+func swiftOwner(node *sitter.Node, sourceCode []byte) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Kind() != "class_declaration" && parent.Kind() != "protocol_declaration" {
+			continue
+		}
+		if name := parent.ChildByFieldName("name"); name != nil {
+			return name.Utf8Text(sourceCode)
+		}
+	}
+	return ""
+}
+
+// scalaOwner returns the class, the object, or the trait defining the scala function, empty for a top-level one
+func scalaOwner(node *sitter.Node, sourceCode []byte) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.Kind() {
+		case "class_definition", "object_definition", "trait_definition":
+			if name := parent.ChildByFieldName("name"); name != nil {
+				return name.Utf8Text(sourceCode)
+			}
+		}
+	}
+	return ""
+}
@@ -137,6 +137,834 @@ TAX_RATE = 0.2
 	}
 }
 
+func TestGenericParser_ParseFile_Java(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `package billing;
+
+public @interface Audited {
+    String value() default "";
+}
+
+public class TaxCalculator {
+    private static final double RATE = 0.2;
+
+    public double calculate(double amount) {
+        return amount * RATE;
+    }
+
+    enum Bracket { LOW, HIGH }
+}
+
+interface Calculator {
+    double calculate(double amount);
+}
+`
+
+	// WHEN
+	got, err := parser.ParseFile("TaxCalculator.java", []byte(sourceCode))
+
+	// THEN
+	assert.NoError(t, err)
+	assertChunksEqual(t, []Chunk{
+		{
+			Id:      "TaxCalculator.java_calculate_10",
+			Content: "public double calculate(double amount) {\n return amount * RATE;\n }",
+			Metadata: ChunkMetadata{
+				FilePath:     "TaxCalculator.java",
+				FunctionName: "calculate",
+				ClassName:    "TaxCalculator",
+				StartLine:    10,
+				EndLine:      12,
+				Language:     "java",
+				ChunkType:    "methods",
+			},
+		},
+		{
+			Id: "TaxCalculator.java_TaxCalculator_7",
+			Content: "public class TaxCalculator {\n private static final double RATE = 0.2;\n\n" +
+				" public double calculate(double amount) {\n return amount * RATE;\n }\n\n enum Bracket { LOW, HIGH }\n}",
+			Metadata: ChunkMetadata{
+				FilePath:  "TaxCalculator.java",
+				ClassName: "TaxCalculator",
+				StartLine: 7,
+				EndLine:   15,
+				Language:  "java",
+				ChunkType: "classes",
+			},
+		},
+		{
+			Id:      "TaxCalculator.java_Calculator_17",
+			Content: "interface Calculator {\n double calculate(double amount);\n}",
+			Metadata: ChunkMetadata{
+				FilePath:     "TaxCalculator.java",
+				FunctionName: "Calculator",
+				StartLine:    17,
+				EndLine:      19,
+				Language:     "java",
+				ChunkType:    "interfaces",
+			},
+		},
+		{
+			Id:      "TaxCalculator.java_Audited_3",
+			Content: "public @interface Audited {\n String value() default \"\";\n}",
+			Metadata: ChunkMetadata{
+				FilePath:     "TaxCalculator.java",
+				FunctionName: "Audited",
+				StartLine:    3,
+				EndLine:      5,
+				Language:     "java",
+				ChunkType:    "annotations",
+			},
+		},
+		{
+			Id:      "TaxCalculator.java_Bracket_14",
+			Content: "enum Bracket { LOW, HIGH }",
+			Metadata: ChunkMetadata{
+				FilePath:     "TaxCalculator.java",
+				FunctionName: "Bracket",
+				StartLine:    14,
+				EndLine:      14,
+				Language:     "java",
+				ChunkType:    "enums",
+			},
+		},
+		{
+			Id:      "TaxCalculator.java_RATE_8",
+			Content: "private static final double RATE = 0.2;",
+			Metadata: ChunkMetadata{
+				FilePath:     "TaxCalculator.java",
+				FunctionName: "RATE",
+				ClassName:    "TaxCalculator",
+				StartLine:    8,
+				EndLine:      8,
+				Language:     "java",
+				ChunkType:    "fields",
+			},
+		},
+	}, got)
+}
+
+func TestGenericParser_ParseFile_C(t *testing.T) {
+	tests := []struct {
+		name       string
+		filePath   string
+		sourceCode string
+		want       []Chunk
+	}{
+		{
+			name:     "it should parse C functions, structs, enums, typedefs, and macros",
+			filePath: "tax.c",
+			sourceCode: `#include "tax.h"
+
+#define RATE 20
+#define PERCENT(x) ((x) * RATE / 100)
+
+struct invoice {
+    int amount;
+};
+
+enum bracket { LOW, HIGH };
+
+typedef struct invoice invoice_t;
+
+int tax(int amount) {
+    return PERCENT(amount);
+}
+`,
+			want: []Chunk{
+				{
+					Id:       "tax.c_tax_14",
+					Content:  "int tax(int amount) {\n return PERCENT(amount);\n}",
+					Metadata: ChunkMetadata{FilePath: "tax.c", FunctionName: "tax", StartLine: 14, EndLine: 16, Language: "c", ChunkType: "functions"},
+				},
+				{
+					Id:       "tax.c_invoice_6",
+					Content:  "struct invoice {\n int amount;\n}",
+					Metadata: ChunkMetadata{FilePath: "tax.c", FunctionName: "invoice", StartLine: 6, EndLine: 8, Language: "c", ChunkType: "structs"},
+				},
+				{
+					Id:       "tax.c_bracket_10",
+					Content:  "enum bracket { LOW, HIGH }",
+					Metadata: ChunkMetadata{FilePath: "tax.c", FunctionName: "bracket", StartLine: 10, EndLine: 10, Language: "c", ChunkType: "enums"},
+				},
+				{
+					Id:       "tax.c_invoice_t_12",
+					Content:  "typedef struct invoice invoice_t;",
+					Metadata: ChunkMetadata{FilePath: "tax.c", FunctionName: "invoice_t", StartLine: 12, EndLine: 12, Language: "c", ChunkType: "types"},
+				},
+				{
+					Id:       "tax.c_RATE_3",
+					Content:  "#define RATE 20",
+					Metadata: ChunkMetadata{FilePath: "tax.c", FunctionName: "RATE", StartLine: 3, EndLine: 3, Language: "c", ChunkType: "macros"},
+				},
+				{
+					Id:       "tax.c_PERCENT_4",
+					Content:  "#define PERCENT(x) ((x) * RATE / 100)",
+					Metadata: ChunkMetadata{FilePath: "tax.c", FunctionName: "PERCENT", StartLine: 4, EndLine: 4, Language: "c", ChunkType: "macros"},
+				},
+			},
+		},
+		{
+			name:     "it should parse the prototypes of a C header, but not its include guard",
+			filePath: "tax.h",
+			sourceCode: `#ifndef TAX_H
+#define TAX_H
+
+int tax(int amount);
+char *label(int amount);
+
+#endif
+`,
+			want: []Chunk{
+				{
+					Id:       "tax.h_tax_4",
+					Content:  "int tax(int amount);",
+					Metadata: ChunkMetadata{FilePath: "tax.h", FunctionName: "tax", StartLine: 4, EndLine: 4, Language: "c", ChunkType: "prototypes"},
+				},
+				{
+					Id:       "tax.h_label_5",
+					Content:  "char *label(int amount);",
+					Metadata: ChunkMetadata{FilePath: "tax.h", FunctionName: "label", StartLine: 5, EndLine: 5, Language: "c", ChunkType: "prototypes"},
+				},
+			},
+		},
+		{
+			name:     "it should parse the functions returning a pointer to a pointer, but not the variables",
+			filePath: "split.c",
+			sourceCode: `char **split(const char *text);
+char *separator;
+
+char **split(const char *text) {
+    return 0;
+}
+`,
+			want: []Chunk{
+				{
+					Id:       "split.c_split_4",
+					Content:  "char **split(const char *text) {\n return 0;\n}",
+					Metadata: ChunkMetadata{FilePath: "split.c", FunctionName: "split", StartLine: 4, EndLine: 6, Language: "c", ChunkType: "functions"},
+				},
+			},
+		},
+		{
+			name:     "it should give unique ids to a typedef of a named struct",
+			filePath: "point.h",
+			sourceCode: `typedef struct Point { int x; } Point;
+
+char **split(const char *text);
+`,
+			want: []Chunk{
+				{
+					Id:       "point.h_Point_1",
+					Content:  "struct Point { int x; }",
+					Metadata: ChunkMetadata{FilePath: "point.h", FunctionName: "Point", StartLine: 1, EndLine: 1, Language: "c", ChunkType: "structs"},
+				},
+				{
+					Id:       "point.h_Point_1_types",
+					Content:  "typedef struct Point { int x; } Point;",
+					Metadata: ChunkMetadata{FilePath: "point.h", FunctionName: "Point", StartLine: 1, EndLine: 1, Language: "c", ChunkType: "types"},
+				},
+				{
+					Id:       "point.h_split_3",
+					Content:  "char **split(const char *text);",
+					Metadata: ChunkMetadata{FilePath: "point.h", FunctionName: "split", StartLine: 3, EndLine: 3, Language: "c", ChunkType: "prototypes"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			parser := NewGenericParser()
+
+			// WHEN
+			got, err := parser.ParseFile(tt.filePath, []byte(tt.sourceCode))
+
+			// THEN
+			assert.NoError(t, err)
+			assertChunksEqual(t, tt.want, got)
+		})
+	}
+}
+
+func TestGenericParser_ParseFile_Cpp(t *testing.T) {
+	tests := []struct {
+		name       string
+		filePath   string
+		sourceCode string
+		want       []Chunk
+	}{
+		{
+			name:     "it should parse C++ functions, templates, and classes, attributing the member functions to their class",
+			filePath: "tax.cpp",
+			sourceCode: `namespace billing {
+
+template <typename T>
+T clamp(T value, T low) {
+    return value < low ? low : value;
+}
+
+class Calculator {
+public:
+    double rate() const {
+        return rate_;
+    }
+
+private:
+    double rate_;
+};
+
+double Calculator::calculate(double amount) {
+    return amount * rate_;
+}
+
+}  // namespace billing
+`,
+			want: []Chunk{
+				{
+					Id:      "tax.cpp_clamp_3",
+					Content: "template <typename T>\nT clamp(T value, T low) {\n return value < low ? low : value;\n}",
+					Metadata: ChunkMetadata{
+						FilePath:     "tax.cpp",
+						FunctionName: "clamp",
+						StartLine:    3,
+						EndLine:      6,
+						Language:     "cpp",
+						ChunkType:    "functions",
+						Package:      "billing",
+					},
+				},
+				{
+					Id:      "tax.cpp_rate_10",
+					Content: "double rate() const {\n return rate_;\n }",
+					Metadata: ChunkMetadata{
+						FilePath:     "tax.cpp",
+						FunctionName: "rate",
+						ClassName:    "Calculator",
+						StartLine:    10,
+						EndLine:      12,
+						Language:     "cpp",
+						ChunkType:    "methods",
+						Package:      "billing",
+					},
+				},
+				{
+					Id:      "tax.cpp_calculate_18",
+					Content: "double Calculator::calculate(double amount) {\n return amount * rate_;\n}",
+					Metadata: ChunkMetadata{
+						FilePath:     "tax.cpp",
+						FunctionName: "calculate",
+						ClassName:    "Calculator",
+						StartLine:    18,
+						EndLine:      20,
+						Language:     "cpp",
+						ChunkType:    "methods",
+						Package:      "billing",
+					},
+				},
+				{
+					Id: "tax.cpp_Calculator_8",
+					Content: "class Calculator {\npublic:\n double rate() const {\n return rate_;\n }\n\n" +
+						"private:\n double rate_;\n}",
+					Metadata: ChunkMetadata{
+						FilePath:  "tax.cpp",
+						ClassName: "Calculator",
+						StartLine: 8,
+						EndLine:   16,
+						Language:  "cpp",
+						ChunkType: "classes",
+						Package:   "billing",
+					},
+				},
+			},
+		},
+		{
+			name:     "it should parse a header using C++ constructs as C++",
+			filePath: "invoice.h",
+			sourceCode: `#pragma once
+
+class Invoice {
+public:
+    int id() const { return id_; }
+private:
+    int id_;
+};
+`,
+			want: []Chunk{
+				{
+					Id:      "invoice.h_id_5",
+					Content: "int id() const { return id_; }",
+					Metadata: ChunkMetadata{
+						FilePath:     "invoice.h",
+						FunctionName: "id",
+						ClassName:    "Invoice",
+						StartLine:    5,
+						EndLine:      5,
+						Language:     "cpp",
+						ChunkType:    "methods",
+					},
+				},
+				{
+					Id:      "invoice.h_Invoice_3",
+					Content: "class Invoice {\npublic:\n int id() const { return id_; }\nprivate:\n int id_;\n}",
+					Metadata: ChunkMetadata{
+						FilePath:  "invoice.h",
+						ClassName: "Invoice",
+						StartLine: 3,
+						EndLine:   8,
+						Language:  "cpp",
+						ChunkType: "classes",
+					},
+				},
+			},
+		},
+		{
+			name:     "it should attribute a member function of a nested class to its full scope",
+			filePath: "deep.cpp",
+			sourceCode: `int outer::Inner::deep() {
+    return 42;
+}
+`,
+			want: []Chunk{
+				{
+					Id:      "deep.cpp_deep_1",
+					Content: "int outer::Inner::deep() {\n return 42;\n}",
+					Metadata: ChunkMetadata{
+						FilePath:     "deep.cpp",
+						FunctionName: "deep",
+						ClassName:    "outer::Inner",
+						StartLine:    1,
+						EndLine:      3,
+						Language:     "cpp",
+						ChunkType:    "methods",
+					},
+				},
+			},
+		},
+		{
+			name:       "it should parse a header declaring a one-line class as C++",
+			filePath:   "foo.h",
+			sourceCode: "class Foo { public: void bar(); };\n",
+			want: []Chunk{
+				{
+					Id:      "foo.h_Foo_1",
+					Content: "class Foo { public: void bar(); }",
+					Metadata: ChunkMetadata{
+						FilePath:  "foo.h",
+						ClassName: "Foo",
+						StartLine: 1,
+						EndLine:   1,
+						Language:  "cpp",
+						ChunkType: "classes",
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			parser := NewGenericParser()
+
+			// WHEN
+			got, err := parser.ParseFile(tt.filePath, []byte(tt.sourceCode))
+
+			// THEN
+			assert.NoError(t, err)
+			assertChunksEqual(t, tt.want, got)
+		})
+	}
+}
+
+func TestGenericParser_ParseFile_Kotlin(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `package billing
+
+fun Double.toCents(): Long = (this * 100).toLong()
+
+class Calculator(val rate: Double) {
+    fun calculate(amount: Double): Double {
+        return amount * rate
+    }
+
+    companion object Factory {
+        fun create(): Calculator = Calculator(0.2)
+    }
+}
+
+object Registry {
+    fun register() {}
+}
+`
+
+	// WHEN
+	got, err := parser.ParseFile("Calculator.kt", []byte(sourceCode))
+
+	// THEN
+	assert.NoError(t, err)
+	assertChunksEqual(t, []Chunk{
+		{
+			Id:      "Calculator.kt_toCents_3",
+			Content: "fun Double.toCents(): Long = (this * 100).toLong()",
+			Metadata: ChunkMetadata{
+				FilePath:     "Calculator.kt",
+				FunctionName: "toCents",
+				ClassName:    "Double",
+				StartLine:    3,
+				EndLine:      3,
+				Language:     "kotlin",
+				ChunkType:    "methods",
+			},
+		},
+		{
+			Id:      "Calculator.kt_calculate_6",
+			Content: "fun calculate(amount: Double): Double {\n return amount * rate\n }",
+			Metadata: ChunkMetadata{
+				FilePath:     "Calculator.kt",
+				FunctionName: "calculate",
+				ClassName:    "Calculator",
+				StartLine:    6,
+				EndLine:      8,
+				Language:     "kotlin",
+				ChunkType:    "methods",
+			},
+		},
+		{
+			Id:      "Calculator.kt_create_11",
+			Content: "fun create(): Calculator = Calculator(0.2)",
+			Metadata: ChunkMetadata{
+				FilePath:     "Calculator.kt",
+				FunctionName: "create",
+				ClassName:    "Calculator",
+				StartLine:    11,
+				EndLine:      11,
+				Language:     "kotlin",
+				ChunkType:    "methods",
+			},
+		},
+		{
+			Id:      "Calculator.kt_register_16",
+			Content: "fun register() {}",
+			Metadata: ChunkMetadata{
+				FilePath:     "Calculator.kt",
+				FunctionName: "register",
+				ClassName:    "Registry",
+				StartLine:    16,
+				EndLine:      16,
+				Language:     "kotlin",
+				ChunkType:    "methods",
+			},
+		},
+		{
+			Id: "Calculator.kt_Calculator_5",
+			Content: "class Calculator(val rate: Double) {\n fun calculate(amount: Double): Double {\n return amount * rate\n }\n\n" +
+				" companion object Factory {\n fun create(): Calculator = Calculator(0.2)\n }\n}",
+			Metadata: ChunkMetadata{
+				FilePath:  "Calculator.kt",
+				ClassName: "Calculator",
+				StartLine: 5,
+				EndLine:   13,
+				Language:  "kotlin",
+				ChunkType: "classes",
+			},
+		},
+		{
+			Id:      "Calculator.kt_Factory_10",
+			Content: "companion object Factory {\n fun create(): Calculator = Calculator(0.2)\n }",
+			Metadata: ChunkMetadata{
+				FilePath:     "Calculator.kt",
+				FunctionName: "Factory",
+				ClassName:    "Calculator",
+				StartLine:    10,
+				EndLine:      12,
+				Language:     "kotlin",
+				ChunkType:    "objects",
+			},
+		},
+		{
+			Id:      "Calculator.kt_Registry_15",
+			Content: "object Registry {\n fun register() {}\n}",
+			Metadata: ChunkMetadata{
+				FilePath:     "Calculator.kt",
+				FunctionName: "Registry",
+				StartLine:    15,
+				EndLine:      17,
+				Language:     "kotlin",
+				ChunkType:    "objects",
+			},
+		},
+	}, got)
+}
+
+func TestGenericParser_ParseFile_Swift(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `struct Invoice {
+    let amount: Double
+
+    init(amount: Double) {
+        self.amount = amount
+    }
+
+    func total() -> Double { amount }
+}
+
+protocol Taxable {
+    func tax() -> Double
+}
+
+extension Invoice: Taxable {
+    func tax() -> Double { amount * 0.2 }
+}
+`
+
+	// WHEN
+	got, err := parser.ParseFile("Invoice.swift", []byte(sourceCode))
+
+	// THEN
+	assert.NoError(t, err)
+	assertChunksEqual(t, []Chunk{
+		{
+			Id:       "Invoice.swift_init_4",
+			Content:  "init(amount: Double) {\n self.amount = amount\n }",
+			Metadata: ChunkMetadata{FilePath: "Invoice.swift", FunctionName: "init", ClassName: "Invoice", StartLine: 4, EndLine: 6, Language: "swift", ChunkType: "methods"},
+		},
+		{
+			Id:       "Invoice.swift_total_8",
+			Content:  "func total() -> Double { amount }",
+			Metadata: ChunkMetadata{FilePath: "Invoice.swift", FunctionName: "total", ClassName: "Invoice", StartLine: 8, EndLine: 8, Language: "swift", ChunkType: "methods"},
+		},
+		{
+			Id:       "Invoice.swift_tax_16",
+			Content:  "func tax() -> Double { amount * 0.2 }",
+			Metadata: ChunkMetadata{FilePath: "Invoice.swift", FunctionName: "tax", ClassName: "Invoice", StartLine: 16, EndLine: 16, Language: "swift", ChunkType: "methods"},
+		},
+		{
+			Id:       "Invoice.swift_Invoice_1",
+			Content:  "struct Invoice {\n let amount: Double\n\n init(amount: Double) {\n self.amount = amount\n }\n\n func total() -> Double { amount }\n}",
+			Metadata: ChunkMetadata{FilePath: "Invoice.swift", FunctionName: "Invoice", StartLine: 1, EndLine: 9, Language: "swift", ChunkType: "structs"},
+		},
+		{
+			Id:       "Invoice.swift_Taxable_11",
+			Content:  "protocol Taxable {\n func tax() -> Double\n}",
+			Metadata: ChunkMetadata{FilePath: "Invoice.swift", FunctionName: "Taxable", StartLine: 11, EndLine: 13, Language: "swift", ChunkType: "protocols"},
+		},
+		{
+			Id:       "Invoice.swift_Invoice_15",
+			Content:  "extension Invoice: Taxable {\n func tax() -> Double { amount * 0.2 }\n}",
+			Metadata: ChunkMetadata{FilePath: "Invoice.swift", FunctionName: "Invoice", StartLine: 15, EndLine: 17, Language: "swift", ChunkType: "extensions"},
+		},
+	}, got)
+}
+
+func TestGenericParser_ParseFile_Scala(t *testing.T) {
+	// GIVEN
+	parser := NewGenericParser()
+	sourceCode := `trait Taxable {
+  def tax(): Double
+}
+
+case class Invoice(amount: Double) extends Taxable {
+  def tax(): Double = amount * 0.2
+}
+
+object Invoice {
+  def apply(amount: Double): Invoice = new Invoice(amount)
+}
+`
+
+	// WHEN
+	got, err := parser.ParseFile("Invoice.scala", []byte(sourceCode))
+
+	// THEN
+	assert.NoError(t, err)
+	assertChunksEqual(t, []Chunk{
+		{
+			Id:       "Invoice.scala_tax_6",
+			Content:  "def tax(): Double = amount * 0.2",
+			Metadata: ChunkMetadata{FilePath: "Invoice.scala", FunctionName: "tax", ClassName: "Invoice", StartLine: 6, EndLine: 6, Language: "scala", ChunkType: "methods"},
+		},
+		{
+			Id:       "Invoice.scala_apply_10",
+			Content:  "def apply(amount: Double): Invoice = new Invoice(amount)",
+			Metadata: ChunkMetadata{FilePath: "Invoice.scala", FunctionName: "apply", ClassName: "Invoice", StartLine: 10, EndLine: 10, Language: "scala", ChunkType: "methods"},
+		},
+		{
+			Id:       "Invoice.scala_Invoice_5",
+			Content:  "case class Invoice(amount: Double) extends Taxable {\n def tax(): Double = amount * 0.2\n}",
+			Metadata: ChunkMetadata{FilePath: "Invoice.scala", ClassName: "Invoice", StartLine: 5, EndLine: 7, Language: "scala", ChunkType: "classes"},
+		},
+		{
+			Id:       "Invoice.scala_Taxable_1",
+			Content:  "trait Taxable {\n def tax(): Double\n}",
+			Metadata: ChunkMetadata{FilePath: "Invoice.scala", FunctionName: "Taxable", StartLine: 1, EndLine: 3, Language: "scala", ChunkType: "traits"},
+		},
+		{
+			Id:       "Invoice.scala_Invoice_9",
+			Content:  "object Invoice {\n def apply(amount: Double): Invoice = new Invoice(amount)\n}",
+			Metadata: ChunkMetadata{FilePath: "Invoice.scala", FunctionName: "Invoice", StartLine: 9, EndLine: 11, Language: "scala", ChunkType: "objects"},
+		},
+	}, got)
+}
+
+func TestGenericParser_ParseFile_Shell(t *testing.T) {
+	sourceCode := `#!/usr/bin/env bash
+set -euo pipefail
+
+export IMAGE=registry.example.com/app:latest
+
+deploy() {
+    COUNT=1
+    kubectl apply -f "$1"
+}
+`
+	tests := []struct {
+		name     string
+		filePath string
+		want     []Chunk
+	}{
+		{
+			name:     "it should parse the functions and the top-level variables of a shell script",
+			filePath: "deploy.sh",
+			want: []Chunk{
+				{
+					Id:       "deploy.sh_deploy_6",
+					Content:  "deploy() {\n COUNT=1\n kubectl apply -f \"$1\"\n}",
+					Metadata: ChunkMetadata{FilePath: "deploy.sh", FunctionName: "deploy", StartLine: 6, EndLine: 9, Language: "shell", ChunkType: "functions"},
+				},
+				{
+					Id:       "deploy.sh_IMAGE_4",
+					Content:  "export IMAGE=registry.example.com/app:latest",
+					Metadata: ChunkMetadata{FilePath: "deploy.sh", FunctionName: "IMAGE", StartLine: 4, EndLine: 4, Language: "shell", ChunkType: "variables"},
+				},
+			},
+		},
+		{
+			name:     "it should parse an extension-less script told by its shebang",
+			filePath: "bin/deploy",
+			want: []Chunk{
+				{
+					Id:       "bin/deploy_deploy_6",
+					Content:  "deploy() {\n COUNT=1\n kubectl apply -f \"$1\"\n}",
+					Metadata: ChunkMetadata{FilePath: "bin/deploy", FunctionName: "deploy", StartLine: 6, EndLine: 9, Language: "shell", ChunkType: "functions"},
+				},
+				{
+					Id:       "bin/deploy_IMAGE_4",
+					Content:  "export IMAGE=registry.example.com/app:latest",
+					Metadata: ChunkMetadata{FilePath: "bin/deploy", FunctionName: "IMAGE", StartLine: 4, EndLine: 4, Language: "shell", ChunkType: "variables"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			parser := NewGenericParser()
+
+			// WHEN
+			got, err := parser.ParseFile(tt.filePath, []byte(sourceCode))
+
+			// THEN
+			assert.NoError(t, err)
+			assertChunksEqual(t, tt.want, got)
+		})
+	}
+}
+
+func TestGenericParser_ParseFile_SmallFiles(t *testing.T) {
+	type args struct {
+		filePath   string
+		sourceCode string
+		threshold  int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Chunk
+	}{
+		{
+			name: "it should produce a single file chunk for files under the threshold",
+			args: args{
+				filePath:   "settings.py",
+				sourceCode: "DEBUG = True\nTIMEOUT = 30\n",
+				threshold:  1024,
+			},
+			want: []Chunk{
+				{
+					Id:      "settings.py_file_1",
+					Content: "DEBUG = True\nTIMEOUT = 30\n",
+					Metadata: ChunkMetadata{
+						FilePath:  "settings.py",
+						StartLine: 1,
+						EndLine:   2,
+						Language:  "python",
+						ChunkType: "file",
+					},
+				},
+			},
+		},
+		{
+			name: "it should produce symbol chunks for files over the threshold",
+			args: args{
+				filePath:   "settings.py",
+				sourceCode: "DEBUG = True\nTIMEOUT = 30\n",
+				threshold:  10,
+			},
+			want: []Chunk{
+				{
+					Id:      "settings.py_DEBUG_1",
+					Content: "DEBUG = True",
+					Metadata: ChunkMetadata{
+						FilePath:     "settings.py",
+						FunctionName: "DEBUG",
+						StartLine:    1,
+						EndLine:      1,
+						Language:     "python",
+						ChunkType:    "variables",
+					},
+				},
+				{
+					Id:      "settings.py_TIMEOUT_2",
+					Content: "TIMEOUT = 30",
+					Metadata: ChunkMetadata{
+						FilePath:     "settings.py",
+						FunctionName: "TIMEOUT",
+						StartLine:    2,
+						EndLine:      2,
+						Language:     "python",
+						ChunkType:    "variables",
+					},
+				},
+			},
+		},
+		{
+			name: "it should not produce any chunk for empty files",
+			args: args{
+				filePath:   "empty.py",
+				sourceCode: "",
+				threshold:  1024,
+			},
+			want: []Chunk{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			parser := NewGenericParser(WithSmallFileThreshold(tt.args.threshold))
+
+			// WHEN
+			got, err := parser.ParseFile(tt.args.filePath, []byte(tt.args.sourceCode))
+
+			// THEN
+			assert.NoError(t, err)
+			assertChunksEqual(t, tt.want, got)
+		})
+	}
+}
+
 //func TestGenericParser_ParseFile_Go(t *testing.T) {
 //	type args struct {
 //		filePath   string
@@ -679,6 +1507,61 @@ func TestGenericParser_detectLanguage(t *testing.T) {
 			args: args{filePath: "example/test.rs"},
 			want: "rust",
 		},
+		{
+			name: "it should detect java file",
+			args: args{filePath: "example/Test.java"},
+			want: "java",
+		},
+		{
+			name: "it should detect c file",
+			args: args{filePath: "example/test.c"},
+			want: "c",
+		},
+		{
+			name: "it should detect c header as c",
+			args: args{filePath: "example/test.h"},
+			want: "c",
+		},
+		{
+			name: "it should detect cpp file",
+			args: args{filePath: "example/test.cpp"},
+			want: "cpp",
+		},
+		{
+			name: "it should detect cc file as cpp",
+			args: args{filePath: "example/test.cc"},
+			want: "cpp",
+		},
+		{
+			name: "it should detect hpp header as cpp",
+			args: args{filePath: "example/test.hpp"},
+			want: "cpp",
+		},
+		{
+			name: "it should detect kotlin file",
+			args: args{filePath: "example/Test.kt"},
+			want: "kotlin",
+		},
+		{
+			name: "it should detect kotlin script as kotlin",
+			args: args{filePath: "example/build.gradle.kts"},
+			want: "kotlin",
+		},
+		{
+			name: "it should detect swift file",
+			args: args{filePath: "example/Test.swift"},
+			want: "swift",
+		},
+		{
+			name: "it should detect scala file",
+			args: args{filePath: "example/Test.scala"},
+			want: "scala",
+		},
+		{
+			name: "it should detect shell script",
+			args: args{filePath: "example/test.sh"},
+			want: "shell",
+		},
 		{
 			name: "it should return empty string for unsupported file",
 			args: args{filePath: "example/test.txt"},
@@ -0,0 +1,71 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PythonModuleResolver derives the dotted module path of python files from the package structure (directories
+// containing an __init__.py), caching the lookups per directory
+type PythonModuleResolver struct {
+	lock     sync.Mutex
+	packages map[string]bool
+}
+
+func NewPythonModuleResolver() *PythonModuleResolver {
+	return &PythonModuleResolver{
+		packages: make(map[string]bool),
+	}
+}
+
+// Enricher records the module path (e.g. billing.tax.calculator) and package (e.g. billing.tax) of python chunks
+func (r *PythonModuleResolver) Enricher(_ context.Context, filePath string, chunks []Chunk) error {
+	if len(chunks) == 0 || filepath.Ext(filePath) != ".py" {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+	}
+
+	var packageParts []string
+	for dir := filepath.Dir(absPath); r.isPackage(dir); dir = filepath.Dir(dir) {
+		packageParts = append(packageParts, filepath.Base(dir))
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	slices.Reverse(packageParts)
+
+	pkg := strings.Join(packageParts, ".")
+	modulePath := pkg
+	if name := strings.TrimSuffix(filepath.Base(absPath), ".py"); name != "__init__" {
+		modulePath = strings.Join(append(packageParts, name), ".")
+	}
+
+	for i := range chunks {
+		chunks[i].Metadata.ModulePath = modulePath
+		chunks[i].Metadata.Package = pkg
+	}
+
+	return nil
+}
+
+func (r *PythonModuleResolver) isPackage(dir string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	isPackage, found := r.packages[dir]
+	if !found {
+		_, err := os.Stat(filepath.Join(dir, "__init__.py"))
+		isPackage = err == nil
+		r.packages[dir] = isPackage
+	}
+	return isPackage
+}
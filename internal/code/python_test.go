@@ -0,0 +1,64 @@
+package code
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPythonModuleResolver_Enricher(t *testing.T) {
+	// GIVEN
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src", "billing", "tax"), 0755))
+	for _, path := range []string{
+		filepath.Join(root, "src", "billing", "__init__.py"),
+		filepath.Join(root, "src", "billing", "tax", "__init__.py"),
+		filepath.Join(root, "src", "billing", "tax", "calculator.py"),
+		filepath.Join(root, "src", "main.py"),
+	} {
+		require.NoError(t, os.WriteFile(path, []byte("TAX_RATE = 0.2\n"), 0644))
+	}
+
+	tests := []struct {
+		name           string
+		filePath       string
+		wantModulePath string
+		wantPackage    string
+	}{
+		{
+			name:           "it should resolve a module nested in packages",
+			filePath:       filepath.Join(root, "src", "billing", "tax", "calculator.py"),
+			wantModulePath: "billing.tax.calculator",
+			wantPackage:    "billing.tax",
+		},
+		{
+			name:           "it should resolve a package init file to the package itself",
+			filePath:       filepath.Join(root, "src", "billing", "tax", "__init__.py"),
+			wantModulePath: "billing.tax",
+			wantPackage:    "billing.tax",
+		},
+		{
+			name:           "it should resolve a top level module",
+			filePath:       filepath.Join(root, "src", "main.py"),
+			wantModulePath: "main",
+			wantPackage:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := []Chunk{{Id: "TAX_RATE_1"}}
+
+			// WHEN
+			err := NewPythonModuleResolver().Enricher(context.Background(), tt.filePath, chunks)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantModulePath, chunks[0].Metadata.ModulePath)
+			assert.Equal(t, tt.wantPackage, chunks[0].Metadata.Package)
+		})
+	}
+}
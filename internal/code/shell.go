@@ -0,0 +1,37 @@
+package code
+
+import (
+	"io"
+	"os"
+	"regexp"
+)
+
+// shebangLength is the number of bytes read from an extension-less file to find its shebang
+const shebangLength = 128
+
+// shellShebang matches the shebangs of the shell scripts, e.g. #!/bin/sh, #!/usr/bin/env bash
+var shellShebang = regexp.MustCompile(`^#!\s*\S*/(env\s+(-\S+\s+)*)?(ba|da|k|z)?sh(\s|$)`)
+
+// isShellScript tells whether the content starts with the shebang of a shell script
+func isShellScript(sourceCode []byte) bool {
+	return shellShebang.Match(sourceCode[:min(len(sourceCode), shebangLength)])
+}
+
+// IsShellScript tells whether the file starts with the shebang of a shell script, the extension-less scripts being
+// indexed as shell ones
+func IsShellScript(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	head := make([]byte, shebangLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return isShellScript(head[:n])
+}
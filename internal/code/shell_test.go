@@ -0,0 +1,76 @@
+package code
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsShellScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{
+			name:    "it should detect a bash script",
+			content: "#!/bin/bash\necho hello\n",
+			want:    true,
+		},
+		{
+			name:    "it should detect a script run with env",
+			content: "#!/usr/bin/env -S bash -e\necho hello\n",
+			want:    true,
+		},
+		{
+			name:    "it should detect a posix shell script",
+			content: "#! /bin/sh\n",
+			want:    true,
+		},
+		{
+			name:    "it should not detect a python script",
+			content: "#!/usr/bin/env python3\nprint('hello')\n",
+			want:    false,
+		},
+		{
+			name:    "it should not detect a file without shebang",
+			content: "Copyright (c) the authors\n",
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			path := filepath.Join(t.TempDir(), "script")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			// WHEN
+			got := IsShellScript(path)
+
+			// THEN
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindInDirectory_ShellScripts(t *testing.T) {
+	// GIVEN
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "deploy"), []byte("#!/bin/bash\necho deploy\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "LICENSE"), []byte("MIT License\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644))
+
+	// WHEN
+	var found []string
+	err := FindInDirectory(root, NewGenericParser().Extensions(), func(path string) error {
+		found = append(found, filepath.Base(path))
+		return nil
+	})
+
+	// THEN
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"deploy", "main.go"}, found, "it should find the extension-less scripts only")
+}
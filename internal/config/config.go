@@ -0,0 +1,782 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where the configuration is looked up when not specified
+const DefaultPath = "$HOME/.mm/config.yaml"
+
+// DefaultCollection is the name of the collection holding the chunks when not scoped
+const DefaultCollection = "code_chunks"
+
+// maxProjectBaseName keeps the names of the project collections within the limits of the backends
+const maxProjectBaseName = 32
+
+// embeddingNamePattern is the one of the names of the secondary embeddings, suffixing the names of the collections
+var embeddingNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+var collectionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{1,61}[a-zA-Z0-9]$`)
+
+const (
+	// ChromaBackend stores the chunks in a chroma server, through the python indexer
+	ChromaBackend = "chroma"
+	// LocalBackend stores the chunks in a file, managed by mm itself
+	LocalBackend = "local"
+	// QdrantBackend stores the chunks in a qdrant server, embeddings being computed by the python indexer
+	QdrantBackend = "qdrant"
+)
+
+const (
+	// OldestFileEviction evicts the files modified the longest time ago first
+	OldestFileEviction = "oldest-file"
+	// LeastRecentlyMatchedEviction evicts the files whose chunks were not returned by a search for the longest time
+	// first, the files never returned being evicted from the oldest one
+	LeastRecentlyMatchedEviction = "least-recently-matched"
+)
+
+const (
+	// L2Metric measures the squared euclidean distance between the embeddings, the default
+	L2Metric = "l2"
+	// CosineMetric measures one minus the cosine similarity of the embeddings
+	CosineMetric = "cosine"
+	// DotMetric measures one minus the dot product of the embeddings, meant for normalized embeddings
+	DotMetric = "dot"
+)
+
+// PrimaryEmbeddings names the embeddings computed by the embedder of the indexer, see SecondaryConfig
+const PrimaryEmbeddings = "primary"
+
+const (
+	// Int8Quantization stores each dimension of the embeddings in a byte, four times smaller than a float32
+	Int8Quantization = "int8"
+	// BinaryQuantization stores the sign of each dimension of the embeddings in a bit, thirty-two times smaller
+	BinaryQuantization = "binary"
+)
+
+const (
+	// PythonEmbedder computes the embeddings with the sentence transformer model of the python indexer
+	PythonEmbedder = "python"
+	// OllamaEmbedder computes the embeddings with the model of an ollama server, called directly by mm
+	OllamaEmbedder = "ollama"
+	// OpenAIEmbedder computes the embeddings with a hosted model, through the OpenAI API or a compatible one
+	OpenAIEmbedder = "openai"
+	// VoyageEmbedder computes the embeddings with a hosted model of Voyage AI, voyage-code-3 by default
+	VoyageEmbedder = "voyage"
+	// CohereEmbedder computes the embeddings with a hosted model of Cohere
+	CohereEmbedder = "cohere"
+	// LlamaCppEmbedder computes the embeddings with a GGUF model, served by a llama.cpp server started by mm
+	LlamaCppEmbedder = "llamacpp"
+)
+
+const (
+	// AutoDevice computes the embeddings of the python indexer on the first accelerator found, cuda then mps, else cpu
+	AutoDevice = "auto"
+	CPUDevice  = "cpu"
+	// CUDADevice computes the embeddings on a nvidia gpu
+	CUDADevice = "cuda"
+	// MPSDevice computes the embeddings on the gpu of an apple silicon mac
+	MPSDevice = "mps"
+)
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"gb", 1 << 30},
+	{"g", 1 << 30},
+	{"mb", 1 << 20},
+	{"m", 1 << 20},
+	{"kb", 1 << 10},
+	{"k", 1 << 10},
+	{"b", 1},
+}
+
+const (
+	// ProjectScope stores the chunks of each repository in its own collection
+	ProjectScope = "project"
+	// GlobalScope stores the chunks of all the repositories in a single collection
+	GlobalScope = "global"
+)
+
+type (
+	Config struct {
+		Store   StoreConfig   `yaml:"store"`
+		Indexer IndexerConfig `yaml:"indexer"`
+		Serve   ServeConfig   `yaml:"serve"`
+		Search  SearchConfig  `yaml:"search"`
+
+		// Bootstrap imports the index published by the CI on the first indexing run of a repository
+		Bootstrap BootstrapConfig `yaml:"bootstrap"`
+	}
+
+	// BootstrapConfig locates the exports of the index published by the CI for each commit, see mm export
+	BootstrapConfig struct {
+		// URL of the export of a commit, where {commit} is replaced by its hash, an http(s) url or a path, e.g.
+		// https://ci.example.com/mm/{commit}.jsonl.gz, disabled if empty
+		URL string `yaml:"url"`
+		// Token is optional, sent as a bearer token, environment variables are expanded
+		Token string `yaml:"token"`
+		// Depth is the number of commits looked back from HEAD for a published index
+		Depth int `yaml:"depth"`
+	}
+
+	// SearchConfig tunes the searches of the command line
+	SearchConfig struct {
+		// Collections are searched along the collection of the project, e.g. the collections of its dependencies
+		Collections []string `yaml:"collections"`
+		// KeepDuplicates returns the identical chunks found in several files or collections as separate results
+		KeepDuplicates bool `yaml:"keep_duplicates"`
+	}
+
+	// IndexerConfig tunes the python indexer to the machine, zero values keep the defaults of the indexer
+	IndexerConfig struct {
+		// Threads used by the model, one per core by default
+		Threads int `yaml:"threads"`
+		// EmbedBatchSize is the number of texts encoded at once by the model
+		EmbedBatchSize int `yaml:"embed_batch_size"`
+		// WriteBatchSize is the number of records written at once in chroma
+		WriteBatchSize int `yaml:"write_batch_size"`
+		// Address of an indexer service started with --listen, unix:///path or tcp://host:port, used instead of
+		// spawning the indexer, the settings above are then the ones of the service
+		Address string `yaml:"address"`
+		// Command runs the python indexer with another interpreter, e.g. the python of a virtual environment of its
+		// own, and Args with another script, speaking the same protocol, instead of the one embedded in mm, uv or the
+		// virtual environment of the working directory, and the embedded script, being used if empty
+		Command string   `yaml:"command"`
+		Args    []string `yaml:"args"`
+
+		// CacheSize bounds the embeddings kept across runs by the embedding cache, so only the chunks whose content
+		// changed are embedded again, 0 for the default size, -1 to disable the cache
+		CacheSize int `yaml:"cache_size"`
+
+		// Embedder computes the embeddings, PythonEmbedder by default, OllamaEmbedder to skip python when an ollama
+		// server already runs, LlamaCppEmbedder for a GGUF model served by llama.cpp, or OpenAIEmbedder,
+		// VoyageEmbedder, and CohereEmbedder for a hosted model (chroma still needs python to store the chunks)
+		Embedder string `yaml:"embedder"`
+		// Model is the embedding model of the embedder, a sentence transformer for the python indexer, the default
+		// one of the embedder if empty
+		Model string `yaml:"model"`
+		// Device computes the embeddings of the python indexer, AutoDevice by default
+		Device string `yaml:"device"`
+		// OllamaURL is the address of the ollama server
+		OllamaURL string       `yaml:"ollama_url"`
+		OpenAI    HostedConfig `yaml:"openai"`
+		Voyage    HostedConfig `yaml:"voyage"`
+		Cohere    HostedConfig `yaml:"cohere"`
+
+		// LlamaCpp runs the server of the llamacpp embedder
+		LlamaCpp LlamaCppConfig `yaml:"llamacpp"`
+
+		// Parsers bounds the files parsed at the same time, independently of the number of workers
+		Parsers ParsersConfig `yaml:"parsers"`
+
+		// Batch groups the chunks of several files, and splits the ones of the large files, before sending them to
+		// the python indexer
+		Batch BatchConfig `yaml:"batch"`
+
+		// Secondary computes a second embedding of each chunk, e.g. with a text model next to a code one
+		Secondary SecondaryConfig `yaml:"secondary"`
+	}
+
+	// SecondaryConfig computes the secondary embeddings of the chunks, stored in a collection next to the one of the
+	// primary embeddings, and searched instead of them with --embedding, disabled without embedder
+	SecondaryConfig struct {
+		// Name selects the secondary embeddings, and suffixes their collection
+		Name     string `yaml:"name"`
+		Embedder string `yaml:"embedder"`
+		// Model is the embedding model of the embedder, the default one of the embedder if empty
+		Model string `yaml:"model"`
+	}
+
+	// LlamaCppConfig runs the llama.cpp server computing the embeddings with a GGUF model, the model being selected
+	// with Model as a path, an url, or a hf:owner/repository/file reference, downloaded in the models directory of
+	// the working directory
+	LlamaCppConfig struct {
+		// Server is the path of the llama-server binary, found in the PATH by default
+		Server string `yaml:"server"`
+		// ContextSize is the context of the model in tokens, the longer texts are truncated, 2048 by default
+		ContextSize int `yaml:"context_size"`
+		// GPULayers is the number of layers of the model offloaded to the GPU, none by default
+		GPULayers int `yaml:"gpu_layers"`
+	}
+
+	// ParsersConfig bounds the concurrent tree-sitter parses, they run through cgo and contend on large runs, lower
+	// limits trade speed for CPU and memory
+	ParsersConfig struct {
+		// Max is the number of files parsed at the same time across the languages, unlimited if zero
+		Max int `yaml:"max"`
+		// Languages bounds the files of each language parsed at the same time, by language name (go, python, ...)
+		Languages map[string]int `yaml:"languages"`
+	}
+
+	// BatchConfig sizes the batches of chunks embedded at once, larger batches keep a GPU busy, smaller ones bound
+	// the memory of the indexer
+	BatchConfig struct {
+		// Size is the number of chunks embedded at once, 256 by default
+		Size int `yaml:"size"`
+		// MaxBytes bounds the content of the chunks embedded at once, unbounded by default
+		MaxBytes ByteSize `yaml:"max_bytes"`
+		// CompressAbove compresses with gzip the batches larger than it sent to the python indexer, never by default
+		CompressAbove ByteSize `yaml:"compress_above"`
+		// MaxInFlight bounds the batches sent to a python indexer without response, so it does not buffer more than
+		// its model embeds, 8 by default, unbounded if negative
+		MaxInFlight int `yaml:"max_in_flight"`
+	}
+
+	// HostedConfig locates the embeddings API of a hosted provider
+	HostedConfig struct {
+		// URL is the base url of the API, an OpenAI compatible endpoint for the openai embedder
+		URL string `yaml:"url"`
+		// APIKey is sent as a bearer token, environment variables are expanded so the key does not have to be in
+		// the file
+		APIKey string `yaml:"api_key"`
+		// BatchSize is the number of texts embedded by a single request, bounded by the limit of the provider
+		BatchSize int `yaml:"batch_size"`
+
+		// RequestsPerMinute and TokensPerMinute pace the requests below the rate limits of the account, the
+		// requests rejected anyway being retried with a backoff, unlimited if zero
+		RequestsPerMinute int `yaml:"requests_per_minute"`
+		TokensPerMinute   int `yaml:"tokens_per_minute"`
+
+		// PricePerMillionTokens is the price of the embeddings in dollars, estimated by mm --index --estimate, the
+		// known price of the model if zero
+		PricePerMillionTokens float64 `yaml:"price_per_million_tokens"`
+	}
+
+	StoreConfig struct {
+		Backend string `yaml:"backend"`
+		// Path of the file holding the local store
+		Path string `yaml:"path"`
+		// Scope is project to give each repository its own collection, or global to share a single one
+		Scope  string       `yaml:"scope"`
+		Chroma ChromaConfig `yaml:"chroma"`
+		Qdrant QdrantConfig `yaml:"qdrant"`
+
+		// Generations makes searches read the last complete indexing run of a chroma or qdrant collection, each run
+		// writing a copy of the collection published once complete, the local store is always replaced at once
+		Generations bool `yaml:"generations"`
+
+		// AllowNetworkFS opens the data of the local chroma server on a network filesystem (NFS, SMB, ...), where
+		// SQLite locks are unreliable, refused by default as it corrupts the store when several processes write it
+		AllowNetworkFS bool `yaml:"allow_network_fs"`
+
+		// MaxSize bounds the size of the index, estimated from the chunks and their embeddings, the files beyond it
+		// are evicted at the end of the indexing runs, unlimited if zero
+		MaxSize ByteSize `yaml:"max_size"`
+		// Eviction chooses the files evicted beyond MaxSize, OldestFileEviction by default
+		Eviction string `yaml:"eviction"`
+
+		// Metric measures the distance between the embeddings of a new collection, L2Metric if empty, the existing
+		// collections keep the one they were created with
+		Metric string `yaml:"metric"`
+		// Normalize scales the embeddings to a unit length before storing and searching them, chosen as well when
+		// the collection is created
+		Normalize bool `yaml:"normalize"`
+
+		// Quantization stores the embeddings quantized, Int8Quantization or BinaryQuantization, at full precision if
+		// empty, only supported by the local and qdrant backends
+		Quantization string `yaml:"quantization"`
+		// KeepOriginals keeps the embeddings at full precision next to the quantized ones, to rerank the candidates
+		// found with the quantized ones
+		KeepOriginals bool `yaml:"keep_originals"`
+	}
+
+	// ByteSize is a number of bytes, written like 512K, 10MB or 2G in the configuration, units are powers of 1024
+	ByteSize int64
+
+	ChromaConfig struct {
+		Collection string `yaml:"collection"`
+		// Host of a chroma server shared by a team, the local server (localhost, with its data in the working
+		// directory of mm) is used if empty
+		Host string `yaml:"host"`
+		// Port of the chroma server, 8000 if zero
+		Port int `yaml:"port"`
+		// SSL connects to the chroma server over https
+		SSL bool `yaml:"ssl"`
+		// Token is optional, sent as a bearer token, environment variables are expanded
+		Token string `yaml:"token"`
+	}
+
+	QdrantConfig struct {
+		URL string `yaml:"url"`
+		// APIKey is optional, environment variables are expanded so the key does not have to be in the file
+		APIKey     string `yaml:"api_key"`
+		Collection string `yaml:"collection"`
+	}
+
+	ServeConfig struct {
+		Address string `yaml:"address"`
+		// Tenants are isolated from each other, if none is defined the server exposes the store without auth
+		Tenants []TenantConfig `yaml:"tenants"`
+		// MaxIndexAge marks the collections not indexed for longer as stalled in the health checks, 0 to disable
+		MaxIndexAge time.Duration `yaml:"max_index_age"`
+	}
+
+	TenantConfig struct {
+		Name string `yaml:"name"`
+		// Token authenticates the requests of the tenant, environment variables are expanded
+		Token string `yaml:"token"`
+		// DataDir holds the local store of the tenant, defaults to $HOME/.mm/tenants/<name>
+		DataDir string `yaml:"data_dir"`
+		// Collection is the qdrant collection of the tenant, defaults to code_chunks_<name>
+		Collection string      `yaml:"collection"`
+		Quota      QuotaConfig `yaml:"quota"`
+	}
+
+	// QuotaConfig limits the usage of a tenant, zero values mean unlimited
+	QuotaConfig struct {
+		QueriesPerMinute int `yaml:"queries_per_minute"`
+		MaxResults       int `yaml:"max_results"`
+	}
+)
+
+// Default returns the configuration used when no configuration file exists
+func Default() *Config {
+	return &Config{
+		Store: StoreConfig{
+			Backend:  ChromaBackend,
+			Path:     "$HOME/.mm/local/store.gob",
+			Scope:    ProjectScope,
+			Eviction: OldestFileEviction,
+			Chroma: ChromaConfig{
+				Collection: DefaultCollection,
+			},
+			Qdrant: QdrantConfig{
+				URL:        "http://localhost:6333",
+				Collection: DefaultCollection,
+			},
+		},
+		Indexer: IndexerConfig{
+			Embedder:  PythonEmbedder,
+			OllamaURL: "http://localhost:11434",
+			OpenAI: HostedConfig{
+				URL:    "https://api.openai.com/v1",
+				APIKey: "$OPENAI_API_KEY",
+			},
+			Voyage: HostedConfig{
+				URL:    "https://api.voyageai.com/v1",
+				APIKey: "$VOYAGE_API_KEY",
+			},
+			Cohere: HostedConfig{
+				URL:    "https://api.cohere.com/v2",
+				APIKey: "$CO_API_KEY",
+			},
+		},
+		Serve: ServeConfig{
+			Address: "localhost:7700",
+		},
+		Bootstrap: BootstrapConfig{
+			Depth: 20,
+		},
+	}
+}
+
+// Tenant returns the configuration of the tenant
+func (c *Config) Tenant(name string) (TenantConfig, bool) {
+	for _, tenant := range c.Serve.Tenants {
+		if tenant.Name == name {
+			return tenant, true
+		}
+	}
+	return TenantConfig{}, false
+}
+
+// ForTenant returns a copy of the configuration with the store scoped to the data of the tenant
+func (c *Config) ForTenant(name string) (*Config, error) {
+	tenant, found := c.Tenant(name)
+	if !found {
+		return nil, fmt.Errorf("unknown tenant %q", name)
+	}
+
+	scoped := *c
+	switch c.Store.Backend {
+	case LocalBackend:
+		dataDir := tenant.DataDir
+		if dataDir == "" {
+			dataDir = filepath.Join("$HOME/.mm/tenants", tenant.Name)
+		}
+		scoped.Store.Path = filepath.Join(dataDir, "store.gob")
+	case QdrantBackend:
+		scoped.Store.Qdrant.Collection = tenant.Collection
+		if scoped.Store.Qdrant.Collection == "" {
+			scoped.Store.Qdrant.Collection = DefaultCollection + "_" + tenant.Name
+		}
+	default:
+		return nil, fmt.Errorf("tenants are not supported by the %s backend, its collection is shared", c.Store.Backend)
+	}
+	return &scoped, nil
+}
+
+// ForProject returns a copy of the configuration with the store scoped to the collection of the repository rooted
+// at root
+func (c *Config) ForProject(root string) *Config {
+	base := DefaultCollection
+	switch c.Store.Backend {
+	case QdrantBackend:
+		base = c.Store.Qdrant.Collection
+	case ChromaBackend:
+		base = c.Store.Chroma.Collection
+	}
+	return c.ForCollection(base + "_" + ProjectName(root))
+}
+
+// ForCollection returns a copy of the configuration with the store using the named collection, a file in the
+// collections directory for the local backend
+func (c *Config) ForCollection(name string) *Config {
+	scoped := *c
+	switch c.Store.Backend {
+	case LocalBackend:
+		scoped.Store.Path = filepath.Join(c.Store.CollectionsDir(), name, filepath.Base(c.Store.Path))
+	case QdrantBackend:
+		scoped.Store.Qdrant.Collection = name
+	default:
+		scoped.Store.Chroma.Collection = name
+	}
+	return &scoped
+}
+
+// ForEmbeddings returns a copy of the configuration computing and searching the named embeddings, in their own
+// collection, next to the one of the primary embeddings, the configuration itself for PrimaryEmbeddings or an empty
+// name
+func (c *Config) ForEmbeddings(name string) (*Config, error) {
+	if name == "" || name == PrimaryEmbeddings {
+		return c, nil
+	}
+	secondary := c.Indexer.Secondary
+	if secondary.Embedder == "" || name != secondary.Name {
+		return nil, fmt.Errorf("unknown embeddings %q, configure them in indexer.secondary", name)
+	}
+	scoped := *c
+	scoped.Indexer.Embedder = secondary.Embedder
+	scoped.Indexer.Model = secondary.Model
+	scoped.Indexer.Secondary = SecondaryConfig{}
+	switch c.Store.Backend {
+	case LocalBackend:
+		extension := filepath.Ext(c.Store.Path)
+		scoped.Store.Path = strings.TrimSuffix(c.Store.Path, extension) + "_" + name + extension
+	case QdrantBackend:
+		scoped.Store.Qdrant.Collection += "_" + name
+	default:
+		scoped.Store.Chroma.Collection += "_" + name
+	}
+	return &scoped, nil
+}
+
+// CollectionsDir returns the directory holding the named collections of the local backend
+func (s StoreConfig) CollectionsDir() string {
+	return filepath.Join(filepath.Dir(s.Path), "collections")
+}
+
+// ValidateCollectionName checks that the name is accepted as a collection by all the backends
+func ValidateCollectionName(name string) error {
+	if !collectionNamePattern.MatchString(name) {
+		return fmt.Errorf(
+			"invalid collection name %q, expected 3 to 63 letters, digits, dots, dashes or underscores, starting and ending with a letter or a digit",
+			name,
+		)
+	}
+	return nil
+}
+
+// ProjectName derives a readable and unique name from the root of a repository: its base name, sanitized to be a
+// valid collection name, followed by a hash of its path
+func ProjectName(root string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(root)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+		if builder.Len() == maxProjectBaseName {
+			break
+		}
+	}
+	sum := sha256.Sum256([]byte(root))
+	return builder.String() + "_" + hex.EncodeToString(sum[:])[:8]
+}
+
+// Identity identifies the data of the store, two configurations sharing it use the same data
+func (s StoreConfig) Identity() string {
+	switch s.Backend {
+	case LocalBackend:
+		return s.Backend + ":" + os.ExpandEnv(s.Path)
+	case QdrantBackend:
+		return s.Backend + ":" + os.ExpandEnv(s.Qdrant.URL) + "/" + s.Qdrant.Collection
+	default:
+		if s.Chroma.Remote() {
+			return fmt.Sprintf("%s:%s:%d/%s", s.Backend, os.ExpandEnv(s.Chroma.Host), s.Chroma.Port, s.Chroma.Collection)
+		}
+		return s.Backend + ":" + s.Chroma.Collection
+	}
+}
+
+// Remote checks if the chunks are stored in a chroma server whose data is not in the working directory of mm
+func (c ChromaConfig) Remote() bool {
+	return c.Host != ""
+}
+
+// CollectionName returns the name of the collection holding the chunks, the file for the local backend
+func (s StoreConfig) CollectionName() string {
+	switch s.Backend {
+	case LocalBackend:
+		return os.ExpandEnv(s.Path)
+	case QdrantBackend:
+		return s.Qdrant.Collection
+	default:
+		return s.Chroma.Collection
+	}
+}
+
+// Load reads the configuration file, falling back to the defaults for anything not specified, the MM_* variables of
+// the environment (see environment) override it
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	content, err := os.ReadFile(os.ExpandEnv(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read configuration %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration %s: %w", path, err)
+	}
+	if err := cfg.applyEnvironment(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	switch c.Store.Backend {
+	case LocalBackend:
+	case ChromaBackend:
+		if c.Store.Chroma.Collection == "" {
+			return fmt.Errorf("chroma backend requires a collection")
+		}
+		if c.Store.Chroma.Port < 0 || c.Store.Chroma.Port > 65535 {
+			return fmt.Errorf("invalid chroma port %d", c.Store.Chroma.Port)
+		}
+	case QdrantBackend:
+		if c.Store.Qdrant.URL == "" || c.Store.Qdrant.Collection == "" {
+			return fmt.Errorf("qdrant backend requires an url and a collection")
+		}
+	default:
+		return fmt.Errorf(
+			"unknown store backend %q, expected %q, %q or %q",
+			c.Store.Backend,
+			ChromaBackend,
+			LocalBackend,
+			QdrantBackend,
+		)
+	}
+
+	if c.Indexer.Threads < 0 || c.Indexer.EmbedBatchSize < 0 || c.Indexer.WriteBatchSize < 0 {
+		return fmt.Errorf("indexer threads and batch sizes cannot be negative")
+	}
+	if c.Indexer.Batch.Size < 0 || c.Indexer.Batch.MaxBytes < 0 || c.Indexer.Batch.CompressAbove < 0 {
+		return fmt.Errorf("indexer batch size, max bytes, and compression threshold cannot be negative")
+	}
+	if c.Indexer.CacheSize < -1 {
+		return fmt.Errorf("indexer cache size must be positive, 0 for the default size, or -1 to disable the cache")
+	}
+	if err := ValidateEmbedder(c.Indexer.Embedder); err != nil {
+		return err
+	}
+	if err := ValidateDevice(c.Indexer.Device); err != nil {
+		return err
+	}
+	if secondary := c.Indexer.Secondary; secondary.Embedder != "" {
+		if err := ValidateEmbedder(secondary.Embedder); err != nil {
+			return fmt.Errorf("invalid secondary embeddings: %w", err)
+		}
+		if !embeddingNamePattern.MatchString(secondary.Name) || secondary.Name == PrimaryEmbeddings {
+			return fmt.Errorf(
+				"invalid secondary embeddings name %q, expected 1 to 32 lowercase letters, digits or dashes, other than %q",
+				secondary.Name,
+				PrimaryEmbeddings,
+			)
+		}
+	}
+	if c.Indexer.Embedder == OllamaEmbedder && c.Indexer.OllamaURL == "" {
+		return fmt.Errorf("ollama embedder requires an url")
+	}
+	for _, hosted := range []struct {
+		embedder string
+		config   HostedConfig
+	}{
+		{OpenAIEmbedder, c.Indexer.OpenAI},
+		{VoyageEmbedder, c.Indexer.Voyage},
+		{CohereEmbedder, c.Indexer.Cohere},
+	} {
+		if c.Indexer.Embedder == hosted.embedder && hosted.config.URL == "" {
+			return fmt.Errorf("%s embedder requires an url", hosted.embedder)
+		}
+		if hosted.config.BatchSize < 0 {
+			return fmt.Errorf("%s batch size cannot be negative", hosted.embedder)
+		}
+		if hosted.config.PricePerMillionTokens < 0 {
+			return fmt.Errorf("%s price per million tokens cannot be negative", hosted.embedder)
+		}
+	}
+
+	if c.Indexer.LlamaCpp.ContextSize < 0 || c.Indexer.LlamaCpp.GPULayers < 0 {
+		return fmt.Errorf("llamacpp context size and gpu layers cannot be negative")
+	}
+	if c.Indexer.Parsers.Max < 0 {
+		return fmt.Errorf("indexer parsers max cannot be negative")
+	}
+	for language, limit := range c.Indexer.Parsers.Languages {
+		if limit < 0 {
+			return fmt.Errorf("indexer parsers limit of %s cannot be negative", language)
+		}
+	}
+
+	if c.Bootstrap.URL != "" && !strings.Contains(c.Bootstrap.URL, "{commit}") {
+		return fmt.Errorf("bootstrap url must contain {commit}, replaced by the hash of the commits")
+	}
+	if c.Bootstrap.Depth < 1 {
+		return fmt.Errorf("bootstrap depth must be positive")
+	}
+
+	if c.Store.MaxSize < 0 {
+		return fmt.Errorf("store max size cannot be negative")
+	}
+	if c.Store.Eviction != OldestFileEviction && c.Store.Eviction != LeastRecentlyMatchedEviction {
+		return fmt.Errorf(
+			"unknown store eviction %q, expected %q or %q",
+			c.Store.Eviction,
+			OldestFileEviction,
+			LeastRecentlyMatchedEviction,
+		)
+	}
+
+	switch c.Store.Metric {
+	case "", L2Metric, CosineMetric, DotMetric:
+	default:
+		return fmt.Errorf("unknown store metric %q, expected %q, %q or %q", c.Store.Metric, L2Metric, CosineMetric, DotMetric)
+	}
+
+	switch c.Store.Quantization {
+	case "":
+	case Int8Quantization, BinaryQuantization:
+		if c.Store.Backend == ChromaBackend {
+			return fmt.Errorf("store quantization is not supported by the %s backend", ChromaBackend)
+		}
+	default:
+		return fmt.Errorf(
+			"unknown store quantization %q, expected %q or %q",
+			c.Store.Quantization,
+			Int8Quantization,
+			BinaryQuantization,
+		)
+	}
+
+	if c.Store.Scope != ProjectScope && c.Store.Scope != GlobalScope {
+		return fmt.Errorf("unknown store scope %q, expected %q or %q", c.Store.Scope, ProjectScope, GlobalScope)
+	}
+
+	for _, name := range c.Search.Collections {
+		if err := ValidateCollectionName(name); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, tenant := range c.Serve.Tenants {
+		if tenant.Name == "" || tenant.Token == "" {
+			return fmt.Errorf("tenants require a name and a token")
+		}
+		// the tokens are compared as the server does, once expanded
+		token := os.ExpandEnv(tenant.Token)
+		if token == "" {
+			// an empty token would disable the authentication
+			return fmt.Errorf("token of tenant %q is empty once expanded", tenant.Name)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("duplicated tenant %q", tenant.Name)
+		}
+		if tokens[token] {
+			return fmt.Errorf("tenant %q reuses the token of another tenant", tenant.Name)
+		}
+		names[tenant.Name] = true
+		tokens[token] = true
+	}
+	return nil
+}
+
+// ValidateDevice checks the device of the python indexer is a known one, empty for AutoDevice
+func ValidateDevice(device string) error {
+	switch device {
+	case "", AutoDevice, CPUDevice, CUDADevice, MPSDevice:
+		return nil
+	default:
+		return fmt.Errorf("unknown device %q, expected %q, %q, %q or %q", device, AutoDevice, CPUDevice, CUDADevice, MPSDevice)
+	}
+}
+
+// ValidateEmbedder checks the embedder is a known one
+func ValidateEmbedder(embedder string) error {
+	switch embedder {
+	case PythonEmbedder, OllamaEmbedder, OpenAIEmbedder, VoyageEmbedder, CohereEmbedder, LlamaCppEmbedder:
+		return nil
+	default:
+		return fmt.Errorf(
+			"unknown embedder %q, expected %q, %q, %q, %q, %q or %q",
+			embedder,
+			PythonEmbedder,
+			OllamaEmbedder,
+			LlamaCppEmbedder,
+			OpenAIEmbedder,
+			VoyageEmbedder,
+			CohereEmbedder,
+		)
+	}
+}
+
+// ParseByteSize parses a size like 512K, 10MB or 2G to a number of bytes, units are powers of 1024
+func ParseByteSize(value string) (ByteSize, error) {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(normalized, unit.suffix) {
+			normalized = strings.TrimSuffix(normalized, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimSpace(normalized), 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a size like 512K, 10MB or 2G", value)
+	}
+	return ByteSize(amount * float64(multiplier)), nil
+}
+
+func (s *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	size, err := ParseByteSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
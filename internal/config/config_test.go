@@ -0,0 +1,125 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_ForEmbeddings(t *testing.T) {
+	tests := []struct {
+		name       string
+		backend    string
+		embeddings string
+		want       func(t *testing.T, cfg *Config)
+		wantErr    string
+	}{
+		{
+			name:       "it should keep the configuration of the primary embeddings",
+			embeddings: PrimaryEmbeddings,
+			want: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, PythonEmbedder, cfg.Indexer.Embedder)
+				assert.Equal(t, "/mm/collections/code_chunks_repo/store.gob", cfg.Store.Path)
+			},
+		},
+		{
+			name:       "it should store the secondary embeddings next to the local store",
+			embeddings: "text",
+			want: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, OpenAIEmbedder, cfg.Indexer.Embedder)
+				assert.Equal(t, "text-embedding-3-large", cfg.Indexer.Model)
+				assert.Empty(t, cfg.Indexer.Secondary.Embedder)
+				assert.Equal(t, "/mm/collections/code_chunks_repo/store_text.gob", cfg.Store.Path)
+			},
+		},
+		{
+			name:       "it should suffix the collection of the qdrant backend",
+			backend:    QdrantBackend,
+			embeddings: "text",
+			want: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "code_chunks_repo_text", cfg.Store.Qdrant.Collection)
+			},
+		},
+		{
+			name:       "it should refuse unknown embeddings",
+			embeddings: "code",
+			wantErr:    `unknown embeddings "code"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			cfg := Default()
+			cfg.Store.Backend = LocalBackend
+			if tt.backend != "" {
+				cfg.Store.Backend = tt.backend
+			}
+			cfg.Store.Path = "/mm/store.gob"
+			cfg.Store.Qdrant.Collection = DefaultCollection
+			cfg.Indexer.Secondary = SecondaryConfig{Name: "text", Embedder: OpenAIEmbedder, Model: "text-embedding-3-large"}
+			scoped := cfg.ForCollection(DefaultCollection + "_repo")
+
+			// WHEN
+			embeddings, err := scoped.ForEmbeddings(tt.embeddings)
+
+			// THEN
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.want(t, embeddings)
+		})
+	}
+}
+
+func TestConfig_ValidateTenants(t *testing.T) {
+	t.Setenv("MM_TEST_TOKEN_A", "secret")
+	t.Setenv("MM_TEST_TOKEN_B", "secret")
+	t.Setenv("MM_TEST_TOKEN_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		tenants []TenantConfig
+		wantErr string
+	}{
+		{
+			name: "it should accept tenants with distinct tokens",
+			tenants: []TenantConfig{
+				{Name: "billing", Token: "$MM_TEST_TOKEN_A"},
+				{Name: "search", Token: "other"},
+			},
+		},
+		{
+			name: "it should refuse tenants whose tokens are the same once expanded",
+			tenants: []TenantConfig{
+				{Name: "billing", Token: "$MM_TEST_TOKEN_A"},
+				{Name: "search", Token: "$MM_TEST_TOKEN_B"},
+			},
+			wantErr: `tenant "search" reuses the token of another tenant`,
+		},
+		{
+			name:    "it should refuse a token empty once expanded",
+			tenants: []TenantConfig{{Name: "billing", Token: "$MM_TEST_TOKEN_EMPTY"}},
+			wantErr: `token of tenant "billing" is empty once expanded`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			cfg := Default()
+			cfg.Serve.Tenants = tt.tenants
+
+			// WHEN
+			err := cfg.validate()
+
+			// THEN
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
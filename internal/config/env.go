@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// environment overrides the settings of the configuration file, so containers can be configured without mounting it
+var environment = []struct {
+	variable string
+	apply    func(cfg *Config, value string) error
+}{
+	{"MM_STORE_BACKEND", func(cfg *Config, value string) error { cfg.Store.Backend = value; return nil }},
+	{"MM_STORE_PATH", func(cfg *Config, value string) error { cfg.Store.Path = value; return nil }},
+	{"MM_STORE_SCOPE", func(cfg *Config, value string) error { cfg.Store.Scope = value; return nil }},
+	{"MM_CHROMA_HOST", func(cfg *Config, value string) error { cfg.Store.Chroma.Host = value; return nil }},
+	{"MM_CHROMA_PORT", func(cfg *Config, value string) error { return parseInt(&cfg.Store.Chroma.Port, value) }},
+	{"MM_CHROMA_COLLECTION", func(cfg *Config, value string) error { cfg.Store.Chroma.Collection = value; return nil }},
+	{"MM_QDRANT_URL", func(cfg *Config, value string) error { cfg.Store.Qdrant.URL = value; return nil }},
+	{"MM_QDRANT_COLLECTION", func(cfg *Config, value string) error { cfg.Store.Qdrant.Collection = value; return nil }},
+	{"MM_INDEXER_ADDRESS", func(cfg *Config, value string) error { cfg.Indexer.Address = value; return nil }},
+	{"MM_EMBEDDER", func(cfg *Config, value string) error { cfg.Indexer.Embedder = value; return nil }},
+	{"MM_MODEL", func(cfg *Config, value string) error { cfg.Indexer.Model = value; return nil }},
+	{"MM_OLLAMA_URL", func(cfg *Config, value string) error { cfg.Indexer.OllamaURL = value; return nil }},
+	{"MM_OPENAI_URL", func(cfg *Config, value string) error { cfg.Indexer.OpenAI.URL = value; return nil }},
+	{"MM_BOOTSTRAP_URL", func(cfg *Config, value string) error { cfg.Bootstrap.URL = value; return nil }},
+	{"MM_SERVE_ADDRESS", func(cfg *Config, value string) error { cfg.Serve.Address = value; return nil }},
+}
+
+// applyEnvironment overrides the configuration with the variables set in the environment
+func (c *Config) applyEnvironment(lookup func(string) (string, bool)) error {
+	for _, override := range environment {
+		value, found := lookup(override.variable)
+		if !found || value == "" {
+			continue
+		}
+		if err := override.apply(c, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", override.variable, err)
+		}
+	}
+	return nil
+}
+
+func parseInt(target *int, value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*target = parsed
+	return nil
+}
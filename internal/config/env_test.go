@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Environment(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(t *testing.T, cfg *Config)
+		wantErr string
+	}{
+		{
+			name: "it should override the configuration with the environment",
+			env: map[string]string{
+				"MM_STORE_BACKEND":   "chroma",
+				"MM_CHROMA_HOST":     "chroma",
+				"MM_CHROMA_PORT":     "8000",
+				"MM_SERVE_ADDRESS":   "0.0.0.0:7700",
+				"MM_INDEXER_ADDRESS": "",
+			},
+			want: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, ChromaBackend, cfg.Store.Backend)
+				assert.Equal(t, "chroma", cfg.Store.Chroma.Host)
+				assert.Equal(t, 8000, cfg.Store.Chroma.Port)
+				assert.Equal(t, "0.0.0.0:7700", cfg.Serve.Address)
+				assert.Equal(t, "tcp://indexer:7800", cfg.Indexer.Address, "it should ignore the empty variables")
+			},
+		},
+		{
+			name:    "it should reject invalid values",
+			env:     map[string]string{"MM_CHROMA_PORT": "http"},
+			wantErr: "invalid MM_CHROMA_PORT",
+		},
+		{
+			name:    "it should validate the overridden configuration",
+			env:     map[string]string{"MM_STORE_BACKEND": "sqlite"},
+			wantErr: `unknown store backend "sqlite"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte("store:\n  backend: local\nindexer:\n  address: tcp://indexer:7800\n"), 0644))
+			for variable, value := range tt.env {
+				t.Setenv(variable, value)
+			}
+
+			// WHEN
+			cfg, err := Load(path)
+
+			// THEN
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.want(t, cfg)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Package container adapts mm to run in a container: detection of the container, default data directory, and the
+// duties of the init process (PID 1)
+package container
+
+import (
+	"os"
+)
+
+// DataDirectory is the working directory of mm in a container, where a volume is expected to be mounted
+const DataDirectory = "/data"
+
+// initChildVariable is set in the environment of the child started by the init process, so it does not start one
+// again
+const initChildVariable = "MM_INIT_CHILD"
+
+// markers are the files created by the container runtimes
+var markers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// Detected checks whether mm runs in a container, started by docker, podman, or kubernetes
+func Detected() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	for _, marker := range markers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
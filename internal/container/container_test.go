@@ -0,0 +1,18 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetected(t *testing.T) {
+	// GIVEN
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+
+	// WHEN
+	detected := Detected()
+
+	// THEN
+	assert.True(t, detected, "it should detect a pod of kubernetes")
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package container
+
+// RunAsInit has nothing to do on this platform, there is no init process to stand for
+func RunAsInit() (bool, int, error) {
+	return false, 0, nil
+}
@@ -0,0 +1,80 @@
+//go:build unix
+
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// forwardedSignals are passed by the init process to its child
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGINT,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// RunAsInit runs mm again as a child when it is the init process of the container, returns false otherwise. The
+// kernel ignores the signals the init process does not handle, and the orphaned processes (e.g. the python indexer of
+// a crashed uv) are attached to it, so the init process forwards the signals to the child, reaps all the processes,
+// and returns the exit code of the child once it exits
+func RunAsInit() (bool, int, error) {
+	if os.Getpid() != 1 || os.Getenv(initChildVariable) != "" {
+		return false, 0, nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return true, 1, fmt.Errorf("failed to find the executable: %w", err)
+	}
+	env := append(os.Environ(), initChildVariable+"=1")
+	code, err := runChild(executable, os.Args, env, []*os.File{os.Stdin, os.Stdout, os.Stderr})
+	return true, code, err
+}
+
+// runChild starts the child, forwards the signals to it, and reaps the exited processes until the child is one of
+// them, returns its exit code
+func runChild(executable string, args []string, env []string, files []*os.File) (int, error) {
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, append(forwardedSignals, syscall.SIGCHLD)...)
+	defer signal.Stop(signals)
+
+	child, err := os.StartProcess(executable, args, &os.ProcAttr{Env: env, Files: files})
+	if err != nil {
+		return 1, fmt.Errorf("failed to start mm: %w", err)
+	}
+
+	for sig := range signals {
+		if sig != syscall.SIGCHLD {
+			_ = child.Signal(sig)
+			continue
+		}
+		if exited, code := reap(child.Pid); exited {
+			return code, nil
+		}
+	}
+	return 1, nil
+}
+
+// reap waits for all the exited processes, returns whether the child is one of them, and its exit code
+func reap(childPid int) (bool, int) {
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err != nil || pid <= 0 {
+			return false, 0
+		}
+		if pid != childPid {
+			continue
+		}
+		if status.Signaled() {
+			return true, 128 + int(status.Signal())
+		}
+		return true, status.ExitStatus()
+	}
+}
@@ -0,0 +1,127 @@
+//go:build unix
+
+package container
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChildVariable runs the test binary as the child of the init process, see TestFakeChild
+const fakeChildVariable = "MM_FAKE_INIT_CHILD"
+
+// TestFakeChild is not a test, it exits with the code of its arguments, or once terminated after printing ready when
+// its argument is trap, when the test binary is started by the tests as the child
+func TestFakeChild(t *testing.T) {
+	if os.Getenv(fakeChildVariable) == "" {
+		t.Skip("only run as the fake child")
+	}
+	arg := os.Args[slices.Index(os.Args, "--")+1]
+	if arg != "trap" {
+		code, _ := strconv.Atoi(arg)
+		os.Exit(code)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	_, _ = os.Stdout.WriteString("ready\n")
+	<-signals
+	os.Exit(42)
+}
+
+// fakeChild returns the arguments and the environment starting the test binary as the fake child
+func fakeChild(arg string) ([]string, []string) {
+	return []string{os.Args[0], "-test.run=TestFakeChild", "--", arg}, append(os.Environ(), fakeChildVariable+"=1")
+}
+
+func TestRunChild(t *testing.T) {
+	tests := []struct {
+		name     string
+		arg      string
+		signal   bool
+		wantCode int
+	}{
+		{
+			name:     "it should return the exit code of the child",
+			arg:      "3",
+			wantCode: 3,
+		},
+		{
+			name:     "it should forward the signals to the child",
+			arg:      "trap",
+			signal:   true,
+			wantCode: 42,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			reader, writer, err := os.Pipe()
+			require.NoError(t, err)
+			defer func() {
+				_ = reader.Close()
+				_ = writer.Close()
+			}()
+			args, env := fakeChild(tt.arg)
+
+			// WHEN
+			type result struct {
+				code int
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				code, err := runChild(os.Args[0], args, env, []*os.File{nil, writer, os.Stderr})
+				done <- result{code, err}
+			}()
+			if tt.signal {
+				line, err := bufio.NewReader(reader).ReadString('\n')
+				require.NoError(t, err)
+				require.Equal(t, "ready\n", line)
+				require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+			}
+			got := <-done
+
+			// THEN
+			require.NoError(t, got.err)
+			assert.Equal(t, tt.wantCode, got.code)
+		})
+	}
+}
+
+func TestReap(t *testing.T) {
+	// GIVEN
+	start := func(arg string) *os.Process {
+		args, env := fakeChild(arg)
+		process, err := os.StartProcess(os.Args[0], args, &os.ProcAttr{Env: env, Files: []*os.File{nil, nil, os.Stderr}})
+		require.NoError(t, err)
+		return process
+	}
+	orphan := start("0")
+	child := start("5")
+
+	// WHEN
+	var exited bool
+	var code int
+	reaped := assert.Eventually(t, func() bool {
+		if childExited, childCode := reap(child.Pid); childExited {
+			exited, code = true, childCode
+		}
+		// a process left to be reaped can still be signaled
+		return exited && errors.Is(syscall.Kill(orphan.Pid, 0), syscall.ESRCH)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// THEN
+	assert.True(t, exited, "it should reap the child")
+	assert.Equal(t, 5, code)
+	assert.True(t, reaped, "it should reap the other processes as well")
+}
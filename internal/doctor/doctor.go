@@ -0,0 +1,257 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type (
+	// Status of a check
+	Status string
+
+	// Result of a check, with a suggestion to fix the environment when it did not pass
+	Result struct {
+		Name   string
+		Status Status
+		Detail string
+		Fix    string
+	}
+
+	// Runner runs a command in a directory, returning its combined output
+	Runner func(ctx context.Context, dir string, name string, args ...string) (string, error)
+
+	// Environment is the one the python indexer runs in
+	Environment struct {
+		WorkingDirectory string
+		// LibDirectory holds the python scripts and their virtual environment
+		LibDirectory string
+		// RequiredPython are the versions of python supported by the scripts, e.g. >=3.13
+		RequiredPython string
+		// Prepare installs the python scripts in the lib directory
+		Prepare func(ctx context.Context) error
+		// CheckChroma returns the corruptions of the chroma data, nil when the store is not a local chroma
+		CheckChroma func(ctx context.Context) ([]string, error)
+		// Run runs the commands of the checks, the commands are executed when nil
+		Run Runner
+	}
+)
+
+const (
+	Passed  Status = "ok"
+	Warning Status = "warning"
+	Failed  Status = "failed"
+	// Skipped checks depend on a check which did not pass
+	Skipped Status = "skipped"
+)
+
+// gpuScript prints the device torch would use to compute the embeddings
+const gpuScript = `import torch
+if torch.cuda.is_available():
+    print("cuda", torch.cuda.get_device_name(0))
+elif torch.backends.mps.is_available():
+    print("mps")
+else:
+    print("cpu")`
+
+// Diagnose checks the environment of the python indexer, each check is skipped when one it depends on did not pass
+func Diagnose(ctx context.Context, env Environment) []Result {
+	run := env.Run
+	if run == nil {
+		run = execute
+	}
+
+	var results []Result
+	workingDirectory := checkWorkingDirectory(env.WorkingDirectory)
+	results = append(results, workingDirectory)
+	scripts := skipUnless(workingDirectory, "scripts", func() Result {
+		return checkScripts(ctx, env)
+	})
+	results = append(results, scripts)
+	uv := checkUV(ctx, run)
+	results = append(results, uv)
+	python := skipUnless(uv, "python", func() Result {
+		return skipUnless(scripts, "python", func() Result {
+			return checkPython(ctx, run, env)
+		})
+	})
+	results = append(results, python)
+	dependencies := skipUnless(python, "dependencies", func() Result {
+		return checkDependencies(ctx, run, env)
+	})
+	results = append(results, dependencies)
+	results = append(results, skipUnless(dependencies, "gpu", func() Result {
+		return checkGPU(ctx, run, env)
+	}))
+	if env.CheckChroma != nil {
+		results = append(results, skipUnless(dependencies, "chroma", func() Result {
+			return checkChroma(ctx, env)
+		}))
+	}
+	return results
+}
+
+// Failures counts the checks which failed
+func Failures(results []Result) int {
+	failures := 0
+	for _, result := range results {
+		if result.Status == Failed {
+			failures++
+		}
+	}
+	return failures
+}
+
+func checkWorkingDirectory(wd string) Result {
+	result := Result{Name: "working directory", Detail: wd}
+	fix := "set --working-dir (or MM_WORKING_DIR) to a writable directory"
+	if err := os.MkdirAll(wd, 0755); err != nil {
+		return failed(result, fmt.Sprintf("cannot be created: %v", err), fix)
+	}
+	file, err := os.CreateTemp(wd, ".mm-write-check-*")
+	if err != nil {
+		return failed(result, fmt.Sprintf("%s is not writable: %v", wd, err), fix)
+	}
+	_ = file.Close()
+	_ = os.Remove(file.Name())
+	result.Status = Passed
+	return result
+}
+
+func checkScripts(ctx context.Context, env Environment) Result {
+	result := Result{Name: "scripts", Detail: env.LibDirectory}
+	if err := env.Prepare(ctx); err != nil {
+		return failed(result, err.Error(), fmt.Sprintf("check the permissions of %s", env.WorkingDirectory))
+	}
+	result.Status = Passed
+	return result
+}
+
+func checkUV(ctx context.Context, run Runner) Result {
+	result := Result{Name: "uv"}
+	output, err := run(ctx, "", "uv", "--version")
+	if err != nil {
+		return failed(
+			result,
+			summarize(output, err),
+			"install uv, it runs the python indexer: curl -LsSf https://astral.sh/uv/install.sh | sh (see https://docs.astral.sh/uv/)",
+		)
+	}
+	result.Status = Passed
+	result.Detail = firstLine(output)
+	return result
+}
+
+func checkPython(ctx context.Context, run Runner, env Environment) Result {
+	result := Result{Name: "python"}
+	// found in the lib directory, uv selects a version matching the requirement of the pyproject
+	output, err := run(ctx, env.LibDirectory, "uv", "python", "find")
+	if err != nil {
+		return failed(
+			result,
+			fmt.Sprintf("no python %s found: %s", env.RequiredPython, summarize(output, err)),
+			fmt.Sprintf("install one with: uv python install '%s'", env.RequiredPython),
+		)
+	}
+	interpreter := firstLine(output)
+	version, err := run(ctx, "", interpreter, "--version")
+	if err != nil {
+		return failed(result, summarize(version, err), fmt.Sprintf("reinstall it with: uv python install --reinstall '%s'", env.RequiredPython))
+	}
+	result.Status = Passed
+	result.Detail = fmt.Sprintf("%s (%s)", firstLine(version), interpreter)
+	return result
+}
+
+func checkDependencies(ctx context.Context, run Runner, env Environment) Result {
+	result := Result{Name: "dependencies"}
+	output, err := run(ctx, env.LibDirectory, "uv", "sync", "--dry-run")
+	if err != nil {
+		return failed(
+			result,
+			fmt.Sprintf("cannot be resolved: %s", summarize(output, err)),
+			"check the access to the python package index (or the one set by UV_INDEX_URL), and the proxy settings",
+		)
+	}
+	result.Status = Passed
+	result.Detail = "resolved"
+	return result
+}
+
+func checkGPU(ctx context.Context, run Runner, env Environment) Result {
+	result := Result{Name: "gpu"}
+	output, err := run(ctx, env.LibDirectory, "uv", "run", "python", "-c", gpuScript)
+	if err != nil {
+		return failed(result, fmt.Sprintf("torch cannot be loaded: %s", summarize(output, err)), "reinstall the dependencies: remove "+env.LibDirectory)
+	}
+	device := lastLine(output)
+	result.Detail = device
+	if device == "cpu" {
+		result.Status = Warning
+		result.Fix = "no gpu found, the embeddings are computed on the cpu: install the drivers of the gpu, or use a " +
+			"remote embedder (--embedder) for large repositories"
+		return result
+	}
+	result.Status = Passed
+	return result
+}
+
+func checkChroma(ctx context.Context, env Environment) Result {
+	result := Result{Name: "chroma"}
+	problems, err := env.CheckChroma(ctx)
+	if err != nil {
+		return failed(result, err.Error(), "check the logs of the indexer with LOG_LEVEL=debug")
+	}
+	if len(problems) > 0 {
+		return failed(
+			result,
+			strings.Join(problems, ", "),
+			"recreate the store with mm --index --repair, its content is then indexed again",
+		)
+	}
+	result.Status = Passed
+	result.Detail = "no corruption found"
+	return result
+}
+
+// skipUnless runs the check if the one it depends on passed, skips it otherwise
+func skipUnless(dependency Result, name string, check func() Result) Result {
+	if dependency.Status == Passed || dependency.Status == Warning {
+		return check()
+	}
+	return Result{Name: name, Status: Skipped, Detail: "requires " + dependency.Name}
+}
+
+func failed(result Result, detail string, fix string) Result {
+	result.Status = Failed
+	result.Detail = detail
+	result.Fix = fix
+	return result
+}
+
+func execute(ctx context.Context, dir string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// summarize keeps the last line of the output of a failed command, usually the error, or the error of the execution
+func summarize(output string, err error) string {
+	if line := lastLine(output); line != "" {
+		return line
+	}
+	return err.Error()
+}
+
+func firstLine(output string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
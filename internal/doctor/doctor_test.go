@@ -0,0 +1,119 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name        string
+		outputs     map[string]string
+		failing     map[string]bool
+		chroma      []string
+		wantStatus  map[string]Status
+		wantFailure int
+	}{
+		{
+			name:    "it should pass in a complete environment",
+			outputs: map[string]string{"uv run": "cuda NVIDIA A10G"},
+			wantStatus: map[string]Status{
+				"working directory": Passed,
+				"scripts":           Passed,
+				"uv":                Passed,
+				"python":            Passed,
+				"dependencies":      Passed,
+				"gpu":               Passed,
+				"chroma":            Passed,
+			},
+		},
+		{
+			name:    "it should skip the checks requiring uv when it is missing",
+			failing: map[string]bool{"uv --version": true},
+			wantStatus: map[string]Status{
+				"uv":           Failed,
+				"python":       Skipped,
+				"dependencies": Skipped,
+				"gpu":          Skipped,
+				"chroma":       Skipped,
+			},
+			wantFailure: 1,
+		},
+		{
+			name:    "it should fail when the dependencies cannot be resolved",
+			failing: map[string]bool{"uv sync": true},
+			wantStatus: map[string]Status{
+				"python":       Passed,
+				"dependencies": Failed,
+				"gpu":          Skipped,
+			},
+			wantFailure: 1,
+		},
+		{
+			name:    "it should warn when the embeddings are computed on the cpu",
+			outputs: map[string]string{"uv run": "Installed 42 packages\ncpu"},
+			wantStatus: map[string]Status{
+				"gpu": Warning,
+			},
+		},
+		{
+			name:    "it should fail on a corrupted chroma data",
+			outputs: map[string]string{"uv run": "mps"},
+			chroma:  []string{"missing segment"},
+			wantStatus: map[string]Status{
+				"chroma": Failed,
+			},
+			wantFailure: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			env := Environment{
+				WorkingDirectory: t.TempDir(),
+				RequiredPython:   ">=3.13",
+				Prepare: func(context.Context) error {
+					return nil
+				},
+				CheckChroma: func(context.Context) ([]string, error) {
+					return tt.chroma, nil
+				},
+				Run: func(_ context.Context, _ string, name string, args ...string) (string, error) {
+					command := name
+					if len(args) > 0 {
+						command += " " + args[0]
+					}
+					if tt.failing[command] {
+						return "error: failed", errors.New("exit status 1")
+					}
+					if output, ok := tt.outputs[command]; ok {
+						return output, nil
+					}
+					if command == "uv python" {
+						return "/usr/bin/python3.13\n", nil
+					}
+					return "Python 3.13.1\n", nil
+				},
+			}
+
+			// WHEN
+			results := Diagnose(context.Background(), env)
+
+			// THEN
+			statuses := make(map[string]Status, len(results))
+			for _, result := range results {
+				statuses[result.Name] = result.Status
+				if result.Status == Failed || result.Status == Warning {
+					assert.NotEmpty(t, result.Fix, "it should suggest a fix for %s", result.Name)
+				}
+			}
+			for name, status := range tt.wantStatus {
+				assert.Equal(t, status, statuses[name], name)
+			}
+			assert.Equal(t, tt.wantFailure, Failures(results))
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package embedding
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+const (
+	// DefaultCacheSize bounds the embeddings kept by a cache, about 150MB with the default model
+	DefaultCacheSize = 100_000
+
+	cacheFormatVersion = 1
+)
+
+type (
+	// Cache keeps the embeddings computed by the previous indexing runs, keyed on the text embedded and the model, so
+	// only the chunks whose content changed are embedded again, it is persisted in a single file and shared by all
+	// the workers and the indexed collections
+	Cache struct {
+		path    string
+		maxSize int
+
+		lock    sync.Mutex
+		entries map[string]*cacheEntry
+		dirty   bool
+
+		hits atomic.Int64
+	}
+
+	cacheEntry struct {
+		Embedding []float32
+		// UsedAt is the unix time of the last run using the embedding, the least recently used ones are evicted first
+		UsedAt int64
+	}
+
+	cacheFile struct {
+		Version int
+		Entries map[string]*cacheEntry
+	}
+
+	// cachingEmbedder embeds with the wrapped embedder the chunks missing from the cache
+	cachingEmbedder struct {
+		embedder ChunkEmbedder
+		cache    *Cache
+		model    string
+	}
+)
+
+// OpenCache loads the cache persisted at path, or creates an empty one if the file does not exist yet, keeping up to
+// maxSize embeddings, the default size if zero
+func OpenCache(path string, maxSize int) (*Cache, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	cache := &Cache{path: path, maxSize: maxSize, entries: make(map[string]*cacheEntry)}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var content cacheFile
+	if err := gob.NewDecoder(file).Decode(&content); err != nil || content.Version != cacheFormatVersion {
+		// only a cache, the embeddings are computed again
+		return cache, nil
+	}
+	if content.Entries != nil {
+		cache.entries = content.Entries
+	}
+	return cache, nil
+}
+
+// Wrap returns an embedder reusing the cached embeddings of the chunks, computed by the model
+func (c *Cache) Wrap(embedder ChunkEmbedder, model string) ChunkEmbedder {
+	return &cachingEmbedder{embedder: embedder, cache: c, model: model}
+}
+
+// Hits returns the number of chunks whose embedding was found in the cache
+func (c *Cache) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Close persists the cache if it has been modified, evicting the least recently used embeddings above its size
+func (c *Cache) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	c.evict()
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create embedding cache directory: %w", err)
+	}
+	// write in a temporary file and rename it, so a crash never leaves a partially written cache
+	tmpPath := c.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create embedding cache file: %w", err)
+	}
+	if err := gob.NewEncoder(file).Encode(cacheFile{Version: cacheFormatVersion, Entries: c.entries}); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to encode embedding cache: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("failed to replace embedding cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// Put records the embedding of the chunk computed by the model, e.g. exported by another index
+func (c *Cache) Put(model string, chunk code.Chunk, embedding []float32) {
+	c.put(cacheKey(model, chunk), embedding)
+}
+
+// Contains tells whether the embedding of the chunk computed by the model is cached, without marking it as used
+func (c *Cache) Contains(model string, chunk code.Chunk) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, found := c.entries[cacheKey(model, chunk)]
+	return found
+}
+
+func (c *Cache) evict() {
+	if len(c.entries) <= c.maxSize {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].UsedAt > c.entries[keys[j]].UsedAt
+	})
+	for _, key := range keys[c.maxSize:] {
+		delete(c.entries, key)
+	}
+}
+
+func (c *Cache) get(key string) ([]float32, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry.UsedAt = time.Now().Unix()
+	c.dirty = true
+	return entry.Embedding, true
+}
+
+func (c *Cache) put(key string, embedding []float32) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries[key] = &cacheEntry{Embedding: embedding, UsedAt: time.Now().Unix()}
+	c.dirty = true
+}
+
+// cacheKey identifies the text embedded for the chunk, its content and its context, and the model embedding it
+func cacheKey(model string, chunk code.Chunk) string {
+	hash := sha256.New()
+	hash.Write([]byte(model))
+	hash.Write([]byte{0})
+	hash.Write([]byte(chunk.Content))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(chunk.Context, "\n")))
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+func (e *cachingEmbedder) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	embeddings := make([][]float32, len(chunks))
+	keys := make([]string, len(chunks))
+	var missing []code.Chunk
+	var positions []int
+	for i, chunk := range chunks {
+		keys[i] = cacheKey(e.model, chunk)
+		if embedding, found := e.cache.get(keys[i]); found {
+			embeddings[i] = embedding
+			e.cache.hits.Add(1)
+			continue
+		}
+		missing = append(missing, chunk)
+		positions = append(positions, i)
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := e.embedder.EmbedDocuments(missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range positions {
+		embeddings[i] = computed[j]
+		e.cache.put(keys[i], computed[j])
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,89 @@
+package embedding
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_Wrap(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "cache", "embeddings.gob")
+	cache, err := OpenCache(path, 0)
+	require.NoError(t, err)
+	embedder := &lengthEmbedder{}
+	_, err = cache.Wrap(embedder, DefaultModel).EmbedDocuments([]code.Chunk{{Content: "a"}, {Content: "bb"}})
+	require.NoError(t, err)
+	require.NoError(t, cache.Close())
+
+	// WHEN
+	reopened, err := OpenCache(path, 0)
+	require.NoError(t, err)
+	embeddings, err := reopened.Wrap(embedder, DefaultModel).EmbedDocuments([]code.Chunk{
+		{Content: "bb"},
+		{Content: "bb", Context: []string{"path: billing"}},
+		{Content: "ccc"},
+	})
+	require.NoError(t, err)
+	otherModel, err := reopened.Wrap(embedder, "bge-small-en").EmbedDocuments([]code.Chunk{{Content: "a"}})
+	require.NoError(t, err)
+
+	// THEN
+	assert.Equal(t, [][]float32{{2}, {2}, {3}}, embeddings)
+	assert.Equal(t, [][]float32{{1}}, otherModel)
+	assert.Equal(t, []int{2, 2, 1}, embedder.batches, "it should only embed the texts not embedded by the previous runs with the model")
+	assert.Equal(t, int64(1), reopened.Hits())
+}
+
+func TestCache_Put(t *testing.T) {
+	// GIVEN
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "embeddings.gob"), 0)
+	require.NoError(t, err)
+	embedder := &lengthEmbedder{}
+
+	// WHEN
+	cache.Put(DefaultModel, code.Chunk{Content: "exported"}, []float32{42})
+	embeddings, err := cache.Wrap(embedder, DefaultModel).EmbedDocuments([]code.Chunk{{Content: "exported"}})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{42}}, embeddings)
+	assert.Empty(t, embedder.batches, "it should reuse the embedding put in the cache")
+}
+
+func TestCache_Close(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "embeddings.gob")
+	cache, err := OpenCache(path, 2)
+	require.NoError(t, err)
+	cache.put("old", []float32{1})
+	cache.entries["old"].UsedAt = 1
+	cache.put("recent", []float32{2})
+	cache.put("new", []float32{3})
+
+	// WHEN
+	require.NoError(t, cache.Close())
+
+	// THEN
+	reopened, err := OpenCache(path, 2)
+	require.NoError(t, err)
+	assert.Len(t, reopened.entries, 2)
+	assert.NotContains(t, reopened.entries, "old", "it should evict the least recently used embeddings")
+}
+
+func TestOpenCache_Corrupted(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "embeddings.gob")
+	require.NoError(t, os.WriteFile(path, []byte("not a cache"), 0644))
+
+	// WHEN
+	cache, err := OpenCache(path, 0)
+
+	// THEN
+	require.NoError(t, err, "it should start from an empty cache")
+	assert.Empty(t, cache.entries)
+}
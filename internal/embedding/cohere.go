@@ -0,0 +1,69 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const (
+	// DefaultCohereURL is the base url of the version 2 of the Cohere API
+	DefaultCohereURL = "https://api.cohere.com/v2"
+	// DefaultCohereModel is the embedding model of Cohere used if none is selected
+	DefaultCohereModel = "embed-english-v3.0"
+)
+
+type (
+	// cohereProvider calls the Cohere embed API
+	cohereProvider struct{}
+
+	cohereRequest struct {
+		Model string   `json:"model"`
+		Texts []string `json:"texts"`
+		// InputType tells the documents stored from the queries searching them
+		InputType      string   `json:"input_type"`
+		EmbeddingTypes []string `json:"embedding_types"`
+		// Truncate cuts the end of the texts longer than the context of the model, instead of failing
+		Truncate string `json:"truncate"`
+	}
+
+	cohereResponse struct {
+		Embeddings struct {
+			Float [][]float32 `json:"float"`
+		} `json:"embeddings"`
+	}
+)
+
+// NewCohere creates an embedder using the model of the Cohere API at baseURL
+func NewCohere(ctx context.Context, baseURL string, apiKey string, model string, opts ...HostedOption) *Hosted {
+	return newHosted(ctx, cohereProvider{}, baseURL, apiKey, model, opts...)
+}
+
+func (cohereProvider) name() string {
+	return "cohere"
+}
+
+func (cohereProvider) path() string {
+	return "/embed"
+}
+
+// limits are the ones of the embed models of Cohere, 96 texts per request, and a context of 512 tokens, the longer
+// texts being truncated by the API
+func (cohereProvider) limits() hostedLimits {
+	return hostedLimits{maxTexts: 96, maxTextTokens: 512}
+}
+
+func (cohereProvider) request(model string, texts []string, query bool) any {
+	inputType := "search_document"
+	if query {
+		inputType = "search_query"
+	}
+	return cohereRequest{Model: model, Texts: texts, InputType: inputType, EmbeddingTypes: []string{"float"}, Truncate: "END"}
+}
+
+func (cohereProvider) embeddings(content []byte) ([][]float32, error) {
+	var response cohereResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, err
+	}
+	return response.Embeddings.Float, nil
+}
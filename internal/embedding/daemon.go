@@ -0,0 +1,239 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	daemonSocketName = "indexer.sock"
+	daemonStateName  = "indexer.json"
+	daemonLogName    = "indexer.log"
+	// daemonStartTimeout bounds the start of the daemon, loading the model can take a while
+	daemonStartTimeout = 2 * time.Minute
+	// daemonProbeTimeout bounds the connection checking the daemon is running
+	daemonProbeTimeout = 200 * time.Millisecond
+	// daemonStopTimeout is how long the daemon has to exit once interrupted, before being killed
+	daemonStopTimeout = 10 * time.Second
+	// daemonOwnerDepth is the number of ancestors of the process listening on the socket searched for the pid of the
+	// daemon, uv running python as its child
+	daemonOwnerDepth = 4
+)
+
+// ErrNoDaemon is returned when no indexer daemon runs for the working directory
+var ErrNoDaemon = errors.New("no indexer daemon running")
+
+// Daemon is an indexer left running in the background, serving the next mm processes of the working directory on a
+// unix socket, so they skip the start of python and the load of the model
+type Daemon struct {
+	Pid        int       `json:"pid"`
+	Address    string    `json:"address"`
+	Model      string    `json:"model"`
+	LibVersion string    `json:"lib_version"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// StartDaemon starts an indexer daemon for the working directory of the options, and waits for it to accept
+// connections, its logs are written in indexer.log of the working directory
+func StartDaemon(ctx context.Context, opts ...IndexerOption) (*Daemon, error) {
+	options := buildOptions(opts...)
+	wd := os.ExpandEnv(options.WorkingDirectory)
+	if daemon, err := FindDaemon(wd); err == nil {
+		return nil, fmt.Errorf("an indexer daemon already runs with pid %d, stop it first", daemon.Pid)
+	}
+
+	// the daemon outlives the command starting it
+	cmd, err := indexerCommand(context.WithoutCancel(ctx), options)
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(wd, daemonSocketName)
+	address := "unix://" + socket
+	cmd.Args = append(cmd.Args, "--listen", address)
+	logFile, err := os.OpenFile(filepath.Join(wd, daemonLogName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the log of the indexer daemon: %w", err)
+	}
+	defer func() {
+		_ = logFile.Close()
+	}()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the indexer daemon: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	model := options.Model
+	if model == "" {
+		model = DefaultModel
+	}
+	daemon := &Daemon{
+		Pid:        cmd.Process.Pid,
+		Address:    address,
+		Model:      model,
+		LibVersion: LibVersion(),
+		StartedAt:  time.Now(),
+	}
+	deadline := time.After(daemonStartTimeout)
+	for !daemon.accepts() {
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("indexer daemon exited before accepting connections (%v), see %s", err, logFile.Name())
+		case <-deadline:
+			_ = cmd.Process.Kill()
+			return nil, fmt.Errorf("indexer daemon did not accept connections after %s, see %s", daemonStartTimeout, logFile.Name())
+		case <-ctx.Done():
+			_ = cmd.Process.Kill()
+			return nil, ctx.Err()
+		case <-time.After(daemonProbeTimeout):
+		}
+	}
+
+	content, err := json.Marshal(daemon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the state of the indexer daemon: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(wd, daemonStateName), content, 0644); err != nil {
+		_ = cmd.Process.Kill()
+		return nil, fmt.Errorf("failed to write the state of the indexer daemon: %w", err)
+	}
+	return daemon, nil
+}
+
+// FindDaemon returns the indexer daemon of the working directory, ErrNoDaemon if none accepts connections, the state
+// can be shipped with a cloned repository, so only a daemon listening on the socket of the working directory, from the
+// recorded process, is trusted
+func FindDaemon(wd string) (*Daemon, error) {
+	content, err := os.ReadFile(filepath.Join(wd, daemonStateName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoDaemon
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the state of the indexer daemon: %w", err)
+	}
+	var daemon Daemon
+	if err := json.Unmarshal(content, &daemon); err != nil {
+		return nil, fmt.Errorf("failed to read the state of the indexer daemon: %w", err)
+	}
+	if err := daemon.checkSocket(wd); err != nil {
+		return nil, err
+	}
+	if !daemon.accepts() {
+		return nil, ErrNoDaemon
+	}
+	if err := daemon.checkOwner(); err != nil {
+		return nil, err
+	}
+	return &daemon, nil
+}
+
+// DaemonAddress returns the address of the indexer daemon of the working directory, if it runs the model and the
+// scripts of this version of mm, any model if empty, an empty address otherwise
+func DaemonAddress(wd string, model string) string {
+	daemon, err := FindDaemon(wd)
+	if err != nil || daemon.LibVersion != LibVersion() || (model != "" && daemon.Model != model) {
+		return ""
+	}
+	return daemon.Address
+}
+
+// StopDaemon interrupts the indexer daemon of the working directory, killing it if it does not exit in time
+func StopDaemon(wd string) (*Daemon, error) {
+	daemon, err := FindDaemon(wd)
+	if err != nil {
+		return nil, err
+	}
+	process, err := os.FindProcess(daemon.Pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the indexer daemon: %w", err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		_ = process.Kill()
+	}
+	deadline := time.Now().Add(daemonStopTimeout)
+	for daemon.accepts() && time.Now().Before(deadline) {
+		time.Sleep(daemonProbeTimeout)
+	}
+	if daemon.accepts() {
+		_ = process.Kill()
+	}
+
+	_ = os.Remove(filepath.Join(wd, daemonStateName))
+	_ = os.Remove(filepath.Join(wd, daemonSocketName))
+	return daemon, nil
+}
+
+// accepts checks the daemon accepts connections on its socket
+func (d *Daemon) accepts() bool {
+	network, address := parseAddress(d.Address)
+	conn, err := net.DialTimeout(network, address, daemonProbeTimeout)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// checkSocket checks the address of the daemon is the unix socket of the working directory, not a symbolic link
+func (d *Daemon) checkSocket(wd string) error {
+	socket, isUnix := strings.CutPrefix(d.Address, "unix://")
+	expected, err := filepath.Abs(filepath.Join(wd, daemonSocketName))
+	if err != nil {
+		return fmt.Errorf("failed to resolve the socket of the indexer daemon: %w", err)
+	}
+	if socket, err = filepath.Abs(socket); !isUnix || err != nil || socket != expected {
+		return fmt.Errorf("refusing the indexer daemon at %s, not the socket %s of the working directory", d.Address, expected)
+	}
+	info, err := os.Lstat(socket)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNoDaemon
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat the socket of the indexer daemon: %w", err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("refusing the indexer daemon at %s, not a unix socket", d.Address)
+	}
+	return nil
+}
+
+// checkOwner checks the process listening on the socket is the recorded daemon, or one of its children
+func (d *Daemon) checkOwner() error {
+	_, address := parseAddress(d.Address)
+	conn, err := net.DialTimeout("unix", address, daemonProbeTimeout)
+	if err != nil {
+		return ErrNoDaemon
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	pid, err := peerPid(conn.(*net.UnixConn))
+	if err != nil {
+		return err
+	}
+	for range daemonOwnerDepth {
+		if pid == d.Pid {
+			return nil
+		}
+		if pid <= 1 {
+			break
+		}
+		if pid, err = parentPid(pid); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("refusing the indexer daemon at %s, its socket is not owned by pid %d", d.Address, d.Pid)
+}
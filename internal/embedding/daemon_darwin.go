@@ -0,0 +1,39 @@
+//go:build darwin
+
+package embedding
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerPid returns the pid of the process listening on the other end of the unix socket connection
+func peerPid(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the owner of the socket: %w", err)
+	}
+	var pid int
+	var pidErr error
+	err = raw.Control(func(fd uintptr) {
+		pid, pidErr = unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	})
+	if err == nil {
+		err = pidErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the owner of the socket: %w", err)
+	}
+	return pid, nil
+}
+
+// parentPid returns the pid of the parent of the process
+func parentPid(pid int) (int, error) {
+	info, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the parent of process %d: %w", pid, err)
+	}
+	return int(info.Eproc.Ppid), nil
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package embedding
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerPid returns the pid of the process listening on the other end of the unix socket connection
+func peerPid(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the owner of the socket: %w", err)
+	}
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the owner of the socket: %w", err)
+	}
+	return int(cred.Pid), nil
+}
+
+// parentPid returns the pid of the parent of the process
+func parentPid(pid int) (int, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the parent of process %d: %w", pid, err)
+	}
+	// the name of the command, between parentheses, can hold spaces, the state and the parent pid follow it
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("failed to read the parent of process %d: unexpected stat %q", pid, stat)
+	}
+	return strconv.Atoi(fields[1])
+}
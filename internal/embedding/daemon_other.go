@@ -0,0 +1,8 @@
+//go:build !unix
+
+package embedding
+
+import "os/exec"
+
+// detach cannot start a new session on this platform, the daemon is left as a child of mm
+func detach(*exec.Cmd) {}
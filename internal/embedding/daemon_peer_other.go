@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package embedding
+
+import (
+	"errors"
+	"net"
+)
+
+// errNoPeerPid is returned on the platforms not telling the owner of a socket, no daemon is trusted there
+var errNoPeerPid = errors.New("the owner of a socket cannot be read on this platform")
+
+func peerPid(*net.UnixConn) (int, error) {
+	return 0, errNoPeerPid
+}
+
+func parentPid(int) (int, error) {
+	return 0, errNoPeerPid
+}
@@ -0,0 +1,196 @@
+package embedding
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemonAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		libVersion string
+		listening  bool
+		want       bool
+	}{
+		{
+			name:       "it should connect to the daemon running the model",
+			model:      DefaultModel,
+			libVersion: LibVersion(),
+			listening:  true,
+			want:       true,
+		},
+		{
+			name:       "it should connect to the daemon when any model is accepted",
+			model:      "",
+			libVersion: LibVersion(),
+			listening:  true,
+			want:       true,
+		},
+		{
+			name:       "it should not connect to a daemon running another model",
+			model:      "all-mpnet-base-v2",
+			libVersion: LibVersion(),
+			listening:  true,
+			want:       false,
+		},
+		{
+			name:       "it should not connect to a daemon running the scripts of another version",
+			model:      DefaultModel,
+			libVersion: "0.0.1",
+			listening:  true,
+			want:       false,
+		},
+		{
+			name:       "it should not connect to a daemon no longer listening",
+			model:      DefaultModel,
+			libVersion: LibVersion(),
+			listening:  false,
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			wd := t.TempDir()
+			address := "unix://" + filepath.Join(wd, daemonSocketName)
+			if tt.listening {
+				listener, err := net.Listen("unix", filepath.Join(wd, daemonSocketName))
+				require.NoError(t, err)
+				defer func() {
+					_ = listener.Close()
+				}()
+			}
+			writeDaemonState(t, wd, Daemon{
+				Pid:        os.Getpid(),
+				Address:    address,
+				Model:      DefaultModel,
+				LibVersion: tt.libVersion,
+				StartedAt:  time.Now(),
+			})
+
+			// WHEN
+			got := DaemonAddress(wd, tt.model)
+
+			// THEN
+			if tt.want {
+				assert.Equal(t, address, got)
+			} else {
+				assert.Empty(t, got)
+			}
+		})
+	}
+}
+
+func TestFindDaemon(t *testing.T) {
+	t.Run("it should not find a daemon without state", func(t *testing.T) {
+		// WHEN
+		_, err := FindDaemon(t.TempDir())
+
+		// THEN
+		assert.ErrorIs(t, err, ErrNoDaemon)
+	})
+
+	t.Run("it should fail on a corrupted state", func(t *testing.T) {
+		// GIVEN
+		wd := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(wd, daemonStateName), []byte("{"), 0644))
+
+		// WHEN
+		_, err := FindDaemon(wd)
+
+		// THEN
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNoDaemon)
+	})
+}
+
+func TestFindDaemon_Untrusted(t *testing.T) {
+	tests := []struct {
+		name    string
+		address func(wd string) string
+		pid     int
+		wantErr string
+	}{
+		{
+			name:    "it should refuse a daemon listening on tcp",
+			address: func(string) string { return "tcp://203.0.113.7:7800" },
+			pid:     os.Getpid(),
+			wantErr: "not the socket",
+		},
+		{
+			name:    "it should refuse a daemon listening out of the working directory",
+			address: func(wd string) string { return "unix://" + filepath.Join(filepath.Dir(wd), daemonSocketName) },
+			pid:     os.Getpid(),
+			wantErr: "not the socket",
+		},
+		{
+			name:    "it should refuse a socket not owned by the recorded process",
+			address: func(wd string) string { return "unix://" + filepath.Join(wd, daemonSocketName) },
+			pid:     os.Getppid() + 1_000_000,
+			wantErr: "not owned by pid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			wd := t.TempDir()
+			listener, err := net.Listen("unix", filepath.Join(wd, daemonSocketName))
+			require.NoError(t, err)
+			defer func() {
+				_ = listener.Close()
+			}()
+			writeDaemonState(t, wd, Daemon{
+				Pid:        tt.pid,
+				Address:    tt.address(wd),
+				Model:      DefaultModel,
+				LibVersion: LibVersion(),
+			})
+
+			// WHEN
+			_, err = FindDaemon(wd)
+
+			// THEN
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Empty(t, DaemonAddress(wd, DefaultModel))
+		})
+	}
+}
+
+func TestFindDaemon_SymlinkedSocket(t *testing.T) {
+	// GIVEN
+	wd := t.TempDir()
+	elsewhere := filepath.Join(t.TempDir(), "other.sock")
+	listener, err := net.Listen("unix", elsewhere)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	require.NoError(t, os.Symlink(elsewhere, filepath.Join(wd, daemonSocketName)))
+	writeDaemonState(t, wd, Daemon{
+		Pid:        os.Getpid(),
+		Address:    "unix://" + filepath.Join(wd, daemonSocketName),
+		Model:      DefaultModel,
+		LibVersion: LibVersion(),
+	})
+
+	// WHEN
+	_, err = FindDaemon(wd)
+
+	// THEN
+	assert.ErrorContains(t, err, "not a unix socket", "it should not follow a symbolic link to another socket")
+}
+
+// writeDaemonState writes the state of a daemon in the working directory
+func writeDaemonState(t *testing.T, wd string, daemon Daemon) {
+	content, err := json.Marshal(daemon)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(wd, daemonStateName), content, 0644))
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package embedding
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach runs the command in its own session, so it is not interrupted with the terminal of mm
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
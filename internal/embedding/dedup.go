@@ -0,0 +1,128 @@
+package embedding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+// defaultDeduplicatorSize bounds the embeddings kept by a deduplicator, about 30MB with the default model
+const defaultDeduplicatorSize = 20_000
+
+type (
+	// Deduplicator remembers the embeddings computed during an indexing run by text embedded, the content hash and the
+	// context lines, so the identical chunks of vendored or generated code are only embedded once, it is shared by all
+	// the workers
+	Deduplicator struct {
+		lock       sync.Mutex
+		embeddings map[string][]float32
+		maxSize    int
+
+		reused atomic.Int64
+	}
+
+	// deduplicatingEmbedder embeds with the wrapped embedder the chunks whose content was not embedded yet
+	deduplicatingEmbedder struct {
+		embedder     ChunkEmbedder
+		deduplicator *Deduplicator
+	}
+)
+
+// NewDeduplicator creates a deduplicator remembering up to maxSize embeddings, the default size if zero
+func NewDeduplicator(maxSize int) *Deduplicator {
+	if maxSize <= 0 {
+		maxSize = defaultDeduplicatorSize
+	}
+	return &Deduplicator{
+		embeddings: make(map[string][]float32),
+		maxSize:    maxSize,
+	}
+}
+
+// Wrap returns an embedder reusing the embeddings of the chunks already embedded with the same content and context
+func (d *Deduplicator) Wrap(embedder ChunkEmbedder) ChunkEmbedder {
+	return &deduplicatingEmbedder{embedder: embedder, deduplicator: d}
+}
+
+// Reused returns the number of chunks which were not embedded again
+func (d *Deduplicator) Reused() int64 {
+	return d.reused.Load()
+}
+
+func (d *Deduplicator) get(hash string) ([]float32, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	embedding, found := d.embeddings[hash]
+	return embedding, found
+}
+
+func (d *Deduplicator) put(hash string, embedding []float32) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// once full, new contents are still embedded, they are just not remembered
+	if len(d.embeddings) < d.maxSize {
+		d.embeddings[hash] = embedding
+	}
+}
+
+// dedupKey identifies the text embedded for the chunk, its content by its hash and its context lines (its path, its
+// commit), empty if the content has no hash
+func dedupKey(chunk code.Chunk) string {
+	if chunk.Metadata.ContentHash == "" {
+		return ""
+	}
+	hash := sha256.New()
+	hash.Write([]byte(chunk.Metadata.ContentHash))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(chunk.Context, "\n")))
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+func (e *deduplicatingEmbedder) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	embeddings := make([][]float32, len(chunks))
+	var missing []code.Chunk
+	// positions of the chunks of the batch sharing the text of each missing chunk
+	var positions [][]int
+	pending := make(map[string]int)
+	for i, chunk := range chunks {
+		hash := dedupKey(chunk)
+		if hash != "" {
+			if embedding, found := e.deduplicator.get(hash); found {
+				embeddings[i] = embedding
+				e.deduplicator.reused.Add(1)
+				continue
+			}
+			if j, found := pending[hash]; found {
+				positions[j] = append(positions[j], i)
+				e.deduplicator.reused.Add(1)
+				continue
+			}
+			pending[hash] = len(missing)
+		}
+		missing = append(missing, chunk)
+		positions = append(positions, []int{i})
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := e.embedder.EmbedDocuments(missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, chunk := range missing {
+		if hash := dedupKey(chunk); hash != "" {
+			e.deduplicator.put(hash, computed[j])
+		}
+		for _, i := range positions[j] {
+			embeddings[i] = computed[j]
+		}
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,53 @@
+package embedding
+
+import (
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator_Wrap(t *testing.T) {
+	// GIVEN
+	embedder := &lengthEmbedder{}
+	deduplicator := NewDeduplicator(0)
+	first := deduplicator.Wrap(embedder)
+	second := deduplicator.Wrap(embedder)
+	chunk := func(content string, hash string) code.Chunk {
+		return code.Chunk{Content: content, Metadata: code.ChunkMetadata{ContentHash: hash}}
+	}
+
+	// WHEN
+	firstEmbeddings, err := first.EmbedDocuments([]code.Chunk{chunk("a", "h1"), chunk("bb", "h2"), chunk("a", "h1")})
+	require.NoError(t, err)
+	secondEmbeddings, err := second.EmbedDocuments([]code.Chunk{chunk("bb", "h2"), chunk("ccc", ""), chunk("ccc", "")})
+	require.NoError(t, err)
+
+	// THEN
+	assert.Equal(t, [][]float32{{1}, {2}, {1}}, firstEmbeddings)
+	assert.Equal(t, [][]float32{{2}, {3}, {3}}, secondEmbeddings)
+	assert.Equal(t, []int{2, 2}, embedder.batches, "it should only embed the unknown contents, and the chunks without hash")
+	assert.Equal(t, int64(2), deduplicator.Reused())
+}
+
+func TestDeduplicator_WrapWithContext(t *testing.T) {
+	// GIVEN
+	embedder := &lengthEmbedder{}
+	deduplicator := NewDeduplicator(0)
+	chunk := func(path string) code.Chunk {
+		return code.Chunk{
+			Content:  "a",
+			Context:  []string{"path: " + path},
+			Metadata: code.ChunkMetadata{ContentHash: "h1"},
+		}
+	}
+
+	// WHEN
+	_, err := deduplicator.Wrap(embedder).EmbedDocuments([]code.Chunk{chunk("a/b.go"), chunk("c/d.go"), chunk("a/b.go")})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, embedder.batches, "it should embed the same content again with another context")
+	assert.Equal(t, int64(1), deduplicator.Reused())
+}
@@ -0,0 +1,283 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+const (
+	defaultDispatcherBatchSize = 256
+	defaultDispatcherMaxWait   = 50 * time.Millisecond
+)
+
+// ErrDispatcherClosed is returned when chunks are submitted to a closed dispatcher
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+type (
+	ChunkEmbedder interface {
+		EmbedDocuments(chunks []code.Chunk) ([][]float32, error)
+	}
+
+	DispatcherOptions struct {
+		// BatchSize is the number of chunks aggregated before calling the embedder, the chunks of a larger file are
+		// split across several batches
+		BatchSize int
+		// MaxWait is how long a partial batch waits for more chunks before being embedded
+		MaxWait time.Duration
+
+		// MaxBytes bounds the content of the chunks of a batch, unbounded if zero, a larger chunk is embedded alone
+		MaxBytes int
+	}
+
+	DispatcherOption func(*DispatcherOptions)
+
+	// Dispatcher aggregates the chunks submitted concurrently by several workers into large batches, embedded by a
+	// single embedder, so parsing can stay parallel while the model gets batches large enough to be efficient.
+	Dispatcher struct {
+		embedder ChunkEmbedder
+		options  *DispatcherOptions
+
+		requests chan *dispatchRequest
+		done     chan struct{}
+
+		closeOnce sync.Once
+		stopped   sync.WaitGroup
+	}
+
+	dispatchRequest struct {
+		chunks   []code.Chunk
+		response chan dispatchResponse
+
+		// embeddings are filled by the parts of the request, until none remains
+		embeddings [][]float32
+		remaining  int
+		err        error
+	}
+
+	// dispatchPart is a range of the chunks of a request, embedded in the same batch
+	dispatchPart struct {
+		request *dispatchRequest
+		offset  int
+		count   int
+	}
+
+	dispatchResponse struct {
+		embeddings [][]float32
+		err        error
+	}
+)
+
+func WithDispatcherBatchSize(batchSize int) DispatcherOption {
+	return func(opts *DispatcherOptions) {
+		opts.BatchSize = batchSize
+	}
+}
+
+// WithDispatcherMaxBytes bounds the content of the chunks embedded at once, unbounded if not positive
+func WithDispatcherMaxBytes(maxBytes int) DispatcherOption {
+	return func(opts *DispatcherOptions) {
+		opts.MaxBytes = maxBytes
+	}
+}
+
+func WithDispatcherMaxWait(maxWait time.Duration) DispatcherOption {
+	return func(opts *DispatcherOptions) {
+		opts.MaxWait = maxWait
+	}
+}
+
+// NewDispatcher starts a dispatcher embedding batches with the embedder, until the context is done or it is closed
+func NewDispatcher(ctx context.Context, embedder ChunkEmbedder, opts ...DispatcherOption) *Dispatcher {
+	options := &DispatcherOptions{
+		BatchSize: defaultDispatcherBatchSize,
+		MaxWait:   defaultDispatcherMaxWait,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	dispatcher := &Dispatcher{
+		embedder: embedder,
+		options:  options,
+		requests: make(chan *dispatchRequest),
+		done:     make(chan struct{}),
+	}
+	dispatcher.stopped.Add(1)
+	go dispatcher.run(ctx)
+
+	return dispatcher
+}
+
+// EmbedDocuments queues the chunks in the next batch, and waits for their embeddings
+func (d *Dispatcher) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	request := &dispatchRequest{
+		chunks:     chunks,
+		response:   make(chan dispatchResponse, 1),
+		embeddings: make([][]float32, len(chunks)),
+		remaining:  len(chunks),
+	}
+	select {
+	case <-d.done:
+		return nil, ErrDispatcherClosed
+	case d.requests <- request:
+	}
+
+	resp := <-request.response
+	return resp.embeddings, resp.err
+}
+
+// Dimensions of the embeddings of the embedder, 0 if it does not tell them
+func (d *Dispatcher) Dimensions() int {
+	if sized, ok := d.embedder.(interface{ Dimensions() int }); ok {
+		return sized.Dimensions()
+	}
+	return 0
+}
+
+// Close embeds the pending batch and stops the dispatcher, the embedder is not closed
+func (d *Dispatcher) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.done)
+	})
+	d.stopped.Wait()
+	return nil
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	defer d.stopped.Done()
+
+	var (
+		batch      []*dispatchPart
+		batchSize  int
+		batchBytes int
+		timer      *time.Timer
+		timeout    <-chan time.Time
+	)
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) > 0 {
+			d.embed(batch)
+		}
+		batch, batchSize, batchBytes = nil, 0, 0
+	}
+	// add splits the chunks of the request across the batches, a large file is embedded in several calls
+	add := func(request *dispatchRequest) {
+		var part *dispatchPart
+		for offset, chunk := range request.chunks {
+			size := chunkBytes(chunk)
+			full := batchSize >= d.options.BatchSize ||
+				(d.options.MaxBytes > 0 && batchBytes+size > d.options.MaxBytes)
+			if batchSize > 0 && full {
+				flush()
+				part = nil
+			}
+			if part == nil {
+				part = &dispatchPart{request: request, offset: offset}
+				batch = append(batch, part)
+			}
+			part.count++
+			batchSize++
+			batchBytes += size
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// the next requests are refused, as once closed, and the pending ones fail
+			d.closeOnce.Do(func() {
+				close(d.done)
+			})
+			// each pending request has its last part in the batch
+			for _, part := range batch {
+				part.request.response <- dispatchResponse{err: ctx.Err()}
+			}
+			for {
+				select {
+				case request := <-d.requests:
+					request.response <- dispatchResponse{err: ctx.Err()}
+				default:
+					return
+				}
+			}
+		case <-d.done:
+			flush()
+			return
+		case <-timeout:
+			flush()
+		case request := <-d.requests:
+			add(request)
+			if batchSize >= d.options.BatchSize {
+				flush()
+			} else if timer == nil && batchSize > 0 {
+				timer = time.NewTimer(d.options.MaxWait)
+				timeout = timer.C
+			}
+		}
+	}
+}
+
+// embed sends all the chunks of the batch in a single call, and dispatches the embeddings back to the requests, each
+// request being answered once all its parts are embedded
+func (d *Dispatcher) embed(batch []*dispatchPart) {
+	var chunks []code.Chunk
+	for _, part := range batch {
+		// the other parts of a failed request are not embedded
+		if part.request.err == nil {
+			chunks = append(chunks, part.request.chunks[part.offset:part.offset+part.count]...)
+		}
+	}
+
+	var (
+		embeddings [][]float32
+		err        error
+	)
+	if len(chunks) > 0 {
+		embeddings, err = d.embedder.EmbedDocuments(chunks)
+		if err == nil && len(embeddings) != len(chunks) {
+			err = fmt.Errorf("expected %d embeddings, got %d", len(chunks), len(embeddings))
+		}
+	}
+	offset := 0
+	for _, part := range batch {
+		request := part.request
+		if request.err == nil {
+			if err != nil {
+				request.err = err
+			} else {
+				copy(request.embeddings[part.offset:], embeddings[offset:offset+part.count])
+				offset += part.count
+			}
+		}
+		request.remaining -= part.count
+		if request.remaining > 0 {
+			continue
+		}
+		if request.err != nil {
+			request.response <- dispatchResponse{err: request.err}
+		} else {
+			request.response <- dispatchResponse{embeddings: request.embeddings}
+		}
+	}
+}
+
+// chunkBytes is the size of the text embedded for the chunk
+func chunkBytes(chunk code.Chunk) int {
+	size := len(chunk.Content)
+	for _, line := range chunk.Context {
+		size += len(line)
+	}
+	return size
+}
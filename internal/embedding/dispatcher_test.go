@@ -0,0 +1,162 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lengthEmbedder embeds each chunk as the length of its content, and records the size of the batches
+type lengthEmbedder struct {
+	lock    sync.Mutex
+	batches []int
+}
+
+func (e *lengthEmbedder) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	e.lock.Lock()
+	e.batches = append(e.batches, len(chunks))
+	e.lock.Unlock()
+
+	embeddings := make([][]float32, len(chunks))
+	for i, chunk := range chunks {
+		embeddings[i] = []float32{float32(len(chunk.Content))}
+	}
+	return embeddings, nil
+}
+
+func TestDispatcher_EmbedDocuments(t *testing.T) {
+	// GIVEN
+	embedder := &lengthEmbedder{}
+	dispatcher := NewDispatcher(context.Background(), embedder, WithDispatcherBatchSize(4), WithDispatcherMaxWait(time.Hour))
+	defer func() {
+		_ = dispatcher.Close()
+	}()
+
+	// WHEN
+	results := make([][][]float32, 4)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := string(make([]byte, i+1))
+			embeddings, err := dispatcher.EmbedDocuments([]code.Chunk{{Content: content}})
+			assert.NoError(t, err)
+			results[i] = embeddings
+		}(i)
+	}
+	wg.Wait()
+
+	// THEN
+	assert.Equal(t, []int{4}, embedder.batches, "it should embed all the chunks in a single batch")
+	for i, embeddings := range results {
+		require.Len(t, embeddings, 1)
+		assert.Equal(t, []float32{float32(i + 1)}, embeddings[0], "it should return the embeddings of the request")
+	}
+}
+
+func TestDispatcher_EmbedDocuments_PartialBatch(t *testing.T) {
+	// GIVEN
+	embedder := &lengthEmbedder{}
+	dispatcher := NewDispatcher(context.Background(), embedder, WithDispatcherMaxWait(time.Millisecond))
+	defer func() {
+		_ = dispatcher.Close()
+	}()
+
+	// WHEN
+	embeddings, err := dispatcher.EmbedDocuments([]code.Chunk{{Content: "a"}, {Content: "bb"}})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1}, {2}}, embeddings, "it should not wait for a full batch forever")
+}
+
+func TestDispatcher_EmbedDocuments_Canceled(t *testing.T) {
+	// GIVEN
+	ctx, cancel := context.WithCancel(context.Background())
+	embedder := &lengthEmbedder{}
+	dispatcher := NewDispatcher(ctx, embedder, WithDispatcherBatchSize(4), WithDispatcherMaxWait(time.Hour))
+	defer func() {
+		_ = dispatcher.Close()
+	}()
+	pending := make(chan error, 1)
+	go func() {
+		_, err := dispatcher.EmbedDocuments([]code.Chunk{{Content: "a"}})
+		pending <- err
+	}()
+
+	// WHEN
+	cancel()
+	_, err := dispatcher.EmbedDocuments([]code.Chunk{{Content: "b"}})
+
+	// THEN
+	assert.Error(t, err, "it should refuse the requests once the context is canceled")
+	select {
+	case err := <-pending:
+		assert.Error(t, err, "it should fail the pending requests")
+	case <-time.After(time.Second):
+		assert.Fail(t, "it should answer the pending requests")
+	}
+	assert.Empty(t, embedder.batches, "it should not embed once the context is canceled")
+}
+
+func TestDispatcher_EmbedDocuments_Split(t *testing.T) {
+	chunks := func(sizes ...int) []code.Chunk {
+		var chunks []code.Chunk
+		for _, size := range sizes {
+			chunks = append(chunks, code.Chunk{Content: string(make([]byte, size))})
+		}
+		return chunks
+	}
+	tests := []struct {
+		name        string
+		opts        []DispatcherOption
+		chunks      []code.Chunk
+		wantBatches []int
+	}{
+		{
+			name:        "it should split the chunks of a large file across batches",
+			opts:        []DispatcherOption{WithDispatcherBatchSize(2)},
+			chunks:      chunks(1, 2, 3, 4, 5),
+			wantBatches: []int{2, 2, 1},
+		},
+		{
+			name:        "it should bound the content of a batch",
+			opts:        []DispatcherOption{WithDispatcherMaxBytes(5)},
+			chunks:      chunks(2, 2, 2, 4, 1),
+			wantBatches: []int{2, 1, 2},
+		},
+		{
+			name:        "it should embed alone a chunk larger than the bound",
+			opts:        []DispatcherOption{WithDispatcherMaxBytes(5)},
+			chunks:      chunks(1, 8, 1),
+			wantBatches: []int{1, 1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			embedder := &lengthEmbedder{}
+			dispatcher := NewDispatcher(context.Background(), embedder, append(tt.opts, WithDispatcherMaxWait(time.Millisecond))...)
+			defer func() {
+				_ = dispatcher.Close()
+			}()
+
+			// WHEN
+			embeddings, err := dispatcher.EmbedDocuments(tt.chunks)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBatches, embedder.batches)
+			require.Len(t, embeddings, len(tt.chunks))
+			for i, chunk := range tt.chunks {
+				assert.Equal(t, []float32{float32(len(chunk.Content))}, embeddings[i], "it should keep the order of the chunks")
+			}
+		})
+	}
+}
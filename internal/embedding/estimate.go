@@ -0,0 +1,63 @@
+package embedding
+
+import (
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+// TokenCounter counts the tokens of the texts embedded for the chunks with the tokenizer of the model, the tokens of
+// the other providers are estimated from the length of the texts, see EstimateTokens
+type TokenCounter interface {
+	CountTokens(chunks []code.Chunk) ([]int, error)
+}
+
+// knownPrices are the prices of the hosted models, in dollars per million tokens, matched against the lower-cased
+// model name, first match wins
+var knownPrices = []struct {
+	pattern string
+	price   float64
+}{
+	{"text-embedding-3-small", 0.02},
+	{"text-embedding-3-large", 0.13},
+	{"text-embedding-ada-002", 0.10},
+	{"voyage-code-3", 0.18},
+	{"voyage-3-lite", 0.02},
+	{"voyage-3", 0.06},
+	{"embed-english-light-v3.0", 0.10},
+	{"embed-english-v3.0", 0.10},
+	{"embed-multilingual-v3.0", 0.10},
+}
+
+// PricePerMillionTokens returns the price of embedding a million tokens with the hosted model, false if it is not
+// known
+func PricePerMillionTokens(model string) (float64, bool) {
+	for _, known := range knownPrices {
+		if strings.Contains(strings.ToLower(model), known.pattern) {
+			return known.price, true
+		}
+	}
+	return 0, false
+}
+
+// EstimateTokens estimates the tokens of the text embedded for the chunk by the model from its length, the same way
+// the requests to the hosted providers are sized
+func EstimateTokens(model string, chunk code.Chunk) int {
+	return len(instructionFor(model).documentText(chunk))/charsPerToken + 1
+}
+
+// Estimate estimates the tokens billed for embedding the chunks, and the number of requests embedding them in
+// batches fitting in the limits of the provider, the texts longer than the context of the model being truncated
+func (h *Hosted) Estimate(chunks []code.Chunk) (tokens int, requests int) {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = h.instruction.documentText(chunk)
+	}
+	batches := h.limits.batches(texts)
+	for _, batch := range batches {
+		for _, text := range batch {
+			tokens += len(text)/charsPerToken + 1
+		}
+	}
+	return tokens, len(batches)
+}
@@ -0,0 +1,73 @@
+package embedding
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPricePerMillionTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		want      float64
+		wantKnown bool
+	}{
+		{
+			name:      "it should know the price of the openai models",
+			model:     "text-embedding-3-small",
+			want:      0.02,
+			wantKnown: true,
+		},
+		{
+			name:      "it should tell the lite voyage model apart",
+			model:     "voyage-3-lite",
+			want:      0.02,
+			wantKnown: true,
+		},
+		{
+			name:  "it should not know the price of other models",
+			model: "nomic-embed-text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			price, known := PricePerMillionTokens(tt.model)
+
+			// THEN
+			assert.Equal(t, tt.wantKnown, known)
+			assert.Equal(t, tt.want, price)
+		})
+	}
+}
+
+func TestHosted_Estimate(t *testing.T) {
+	// GIVEN
+	openAI := NewOpenAI(context.Background(), "http://localhost", "secret", "text-embedding-3-small", WithHostedBatchSize(2))
+	chunks := []code.Chunk{
+		{Content: strings.Repeat("a", 30)},
+		{Content: strings.Repeat("b", 60)},
+		{Content: strings.Repeat("c", 8191*maxCharsPerToken*2)},
+	}
+
+	// WHEN
+	tokens, requests := openAI.Estimate(chunks)
+
+	// THEN
+	assert.Equal(t, 2, requests)
+	// the longest text is truncated to the context of the model
+	assert.Equal(t, 11+21+8191*maxCharsPerToken/charsPerToken+1, tokens)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	// WHEN
+	tokens := EstimateTokens("nomic-embed-text", code.Chunk{Content: strings.Repeat("a", 14)})
+
+	// THEN
+	// the instruction of the model is embedded with the chunk
+	assert.Equal(t, (len("search_document: ")+14)/charsPerToken+1, tokens)
+}
@@ -0,0 +1,99 @@
+package embedding
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// eventsBuffer is the number of events kept until read, the events of the messages of the indexer are dropped once
+// it is full, so a slow reader never delays the responses
+const eventsBuffer = 256
+
+type (
+	// IndexerEvent is reported by the indexer while it runs, a LogEvent, ReadyEvent, ProgressEvent, BatchDoneEvent, or
+	// ErrorEvent
+	IndexerEvent interface {
+		indexerEvent()
+	}
+
+	// LogEvent is a line written by the indexer on its stderr
+	LogEvent struct {
+		// Level is told by the mark of the line, ✓ for the steps of the startup, ✗ for the failures
+		Level   zerolog.Level
+		Message string
+	}
+
+	// ReadyEvent is sent once the indexer accepts requests
+	ReadyEvent struct {
+		// Protocol is the version of the protocol spoken by the indexer, refused if it is not the one of mm
+		Protocol int
+		// Device computes the embeddings, Devices are the ones available, empty if the indexer does not load a model
+		Device  string
+		Devices []string
+	}
+
+	// ProgressEvent is the progress reported by the indexer after each batch
+	ProgressEvent struct {
+		IndexerProgress
+	}
+
+	// BatchDoneEvent is sent for each request embedding texts completed by the indexer
+	BatchDoneEvent struct {
+		RequestID string
+		// Kind is index for the chunks embedded and stored, embed for the chunks or the query only embedded
+		Kind string
+		// Texts is the number of texts embedded by the request
+		Texts int
+	}
+
+	// ErrorEvent is a request failed by the indexer, or the refusal of an indexer speaking another protocol
+	ErrorEvent struct {
+		// RequestID is the failed request, empty for a refusal
+		RequestID string
+		Err       error
+	}
+)
+
+func (LogEvent) indexerEvent()       {}
+func (ReadyEvent) indexerEvent()     {}
+func (ProgressEvent) indexerEvent()  {}
+func (BatchDoneEvent) indexerEvent() {}
+func (ErrorEvent) indexerEvent()     {}
+
+// logEvent parses a line of the stderr of the indexer, its mark telling its level, the lines of the libraries are
+// debug ones unless they warn
+func logEvent(line string) LogEvent {
+	switch {
+	case strings.HasPrefix(line, "✓"):
+		return LogEvent{Level: zerolog.InfoLevel, Message: strings.TrimSpace(strings.TrimPrefix(line, "✓"))}
+	case strings.HasPrefix(line, "✗"):
+		return LogEvent{Level: zerolog.ErrorLevel, Message: strings.TrimSpace(strings.TrimPrefix(line, "✗"))}
+	case strings.Contains(line, "Warning:"), strings.HasPrefix(line, "WARNING"):
+		return LogEvent{Level: zerolog.WarnLevel, Message: line}
+	}
+	return LogEvent{Level: zerolog.DebugLevel, Message: line}
+}
+
+// responseEvent returns the event of a response to a request, false for the responses not reported, e.g. the ones
+// of the searches and of the store requests
+func responseEvent(resp response) (IndexerEvent, bool) {
+	if err := resp.err(); err != nil {
+		return ErrorEvent{RequestID: resp.RequestID, Err: err}, true
+	}
+	switch resp.Kind {
+	case "index":
+		return BatchDoneEvent{RequestID: resp.RequestID, Kind: resp.Kind, Texts: resp.IndexedCount}, true
+	case "embed":
+		return BatchDoneEvent{RequestID: resp.RequestID, Kind: resp.Kind, Texts: len(resp.Embeddings)}, true
+	}
+	return nil, false
+}
+
+// offerEvent sends the event unless the events not read yet fill the buffer
+func offerEvent(events chan IndexerEvent, event IndexerEvent) {
+	select {
+	case events <- event:
+	default:
+	}
+}
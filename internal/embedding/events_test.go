@@ -0,0 +1,94 @@
+package embedding
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want LogEvent
+	}{
+		{
+			name: "it should report the steps of the startup as info",
+			line: "✓ Loaded model 'all-MiniLM-L6-v2' from cache",
+			want: LogEvent{Level: zerolog.InfoLevel, Message: "Loaded model 'all-MiniLM-L6-v2' from cache"},
+		},
+		{
+			name: "it should report the failures as errors",
+			line: "✗ Skipped a request: boom",
+			want: LogEvent{Level: zerolog.ErrorLevel, Message: "Skipped a request: boom"},
+		},
+		{
+			name: "it should report the warnings of the libraries",
+			line: "/lib/torch/cuda.py:12: UserWarning: CUDA initialization failed",
+			want: LogEvent{Level: zerolog.WarnLevel, Message: "/lib/torch/cuda.py:12: UserWarning: CUDA initialization failed"},
+		},
+		{
+			name: "it should report the other lines as debug",
+			line: "Batches: 100%|██████████| 1/1",
+			want: LogEvent{Level: zerolog.DebugLevel, Message: "Batches: 100%|██████████| 1/1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			event := logEvent(tt.line)
+
+			// THEN
+			assert.Equal(t, tt.want, event)
+		})
+	}
+}
+
+func TestRunningIndexer_Events(t *testing.T) {
+	// GIVEN
+	stdinReader, stdinWriter := io.Pipe()
+	defer func() { _ = stdinReader.Close() }()
+	stdoutReader, stdoutWriter := io.Pipe()
+	go func() {
+		defer func() { _ = stdoutWriter.Close() }()
+		_ = writeMessage(stdoutWriter, []byte(`{"status": "READY", "protocol": 2, "device": "cpu", "devices": ["cpu"]}`))
+		message, err := readMessage(bufio.NewReader(stdinReader))
+		if err != nil {
+			return
+		}
+		_ = writeMessage(stdoutWriter, []byte(`{"status": "PROGRESS", "embedded": 2, "stored": 0, "per_second": 4}`))
+		_ = writeMessage(stdoutWriter, fmt.Appendf(nil, `{"request_id": "%s", "kind": "embed", "status": "success", "embeddings": [[1], [2]]}`, requestID(message)))
+	}()
+	indexer := initRunningIndexer(context.Background(), nil, stdinWriter, stdoutReader, io.NopCloser(strings.NewReader("✓ Using the cpu\n")))
+	require.NoError(t, indexer.WaitReady())
+
+	// WHEN
+	_, err := indexer.EmbedDocuments([]code.Chunk{{Id: "a", Content: "a"}, {Id: "b", Content: "b"}})
+	require.NoError(t, err)
+
+	// THEN
+	var events []IndexerEvent
+	for event := range indexer.Events() {
+		events = append(events, event)
+	}
+	assert.Contains(t, events, LogEvent{Level: zerolog.InfoLevel, Message: "Using the cpu"})
+	assert.Contains(t, events, ReadyEvent{Protocol: 2, Device: "cpu", Devices: []string{"cpu"}})
+	assert.Contains(t, events, ProgressEvent{IndexerProgress{Embedded: 2, PerSecond: 4}})
+	var done []BatchDoneEvent
+	for _, event := range events {
+		if event, ok := event.(BatchDoneEvent); ok {
+			done = append(done, event)
+		}
+	}
+	require.Len(t, done, 1)
+	assert.Equal(t, "embed", done[0].Kind)
+	assert.Equal(t, 2, done[0].Texts)
+}
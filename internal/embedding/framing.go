@@ -0,0 +1,139 @@
+package embedding
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// the messages exchanged with the indexer are preceded by headers giving their length, and their encoding if they
+// are compressed, followed by an empty line, so a message can hold lines of any length, and a message too large is
+// refused before being read
+const (
+	contentLengthHeader   = "Content-Length"
+	contentEncodingHeader = "Content-Encoding"
+	// gzipEncoding compresses a message with gzip, used when the indexer lists it in its ready message
+	gzipEncoding = "gzip"
+	// maxMessageSize bounds a message exchanged with the indexer, responses holding embeddings can be large
+	maxMessageSize = 64 * 1024 * 1024
+)
+
+// errMessageTooLarge is returned for the messages exceeding maxMessageSize, in either direction
+var errMessageTooLarge = errors.New("message too large")
+
+// writeMessage writes the message with its header, in a single write so the messages of concurrent writers are not
+// interleaved
+func writeMessage(w io.Writer, message []byte) error {
+	return writeFrame(w, message, "")
+}
+
+// writeGzipMessage writes the message compressed with gzip, for an indexer accepting the gzipEncoding
+func writeGzipMessage(w io.Writer, message []byte) error {
+	if len(message) > maxMessageSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d bytes", errMessageTooLarge, len(message), maxMessageSize)
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress message: %w", err)
+	}
+	return writeFrame(w, compressed.Bytes(), gzipEncoding)
+}
+
+func writeFrame(w io.Writer, body []byte, encoding string) error {
+	if len(body) > maxMessageSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d bytes", errMessageTooLarge, len(body), maxMessageSize)
+	}
+	frame := make([]byte, 0, len(body)+64)
+	frame = fmt.Appendf(frame, "%s: %d\r\n", contentLengthHeader, len(body))
+	if encoding != "" {
+		frame = fmt.Appendf(frame, "%s: %s\r\n", contentEncodingHeader, encoding)
+	}
+	frame = append(frame, "\r\n"...)
+	frame = append(frame, body...)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readMessage reads the next message, decompressed, io.EOF if the stream ends before it starts
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	encoding := ""
+	for {
+		header, err := r.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(header) == 0 && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to read message header %q: %w", truncateHeader(header), err)
+		}
+		header = bytes.TrimRight(header, "\r\n")
+		if len(header) == 0 {
+			break
+		}
+
+		name, value, _ := bytes.Cut(header, []byte(": "))
+		switch string(name) {
+		case contentLengthHeader:
+			length, err = strconv.Atoi(string(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid message length %q", truncateHeader(value))
+			}
+			if length > maxMessageSize {
+				return nil, fmt.Errorf("%w: %d bytes, the limit is %d bytes", errMessageTooLarge, length, maxMessageSize)
+			}
+		case contentEncodingHeader:
+			encoding = string(value)
+		default:
+			return nil, fmt.Errorf("invalid message header %q, expected %q", truncateHeader(header), contentLengthHeader)
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("invalid message, %q header missing", contentLengthHeader)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("failed to read message of %d bytes: %w", length, err)
+	}
+	switch encoding {
+	case "":
+		return message, nil
+	case gzipEncoding:
+		return gunzip(message)
+	default:
+		return nil, fmt.Errorf("unsupported message encoding %q", truncateHeader([]byte(encoding)))
+	}
+}
+
+// gunzip decompresses a message, refusing it once its content exceeds maxMessageSize
+func gunzip(message []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress message: %w", err)
+	}
+	content, err := io.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress message: %w", err)
+	}
+	if len(content) > maxMessageSize {
+		return nil, fmt.Errorf("%w: more than %d bytes once decompressed", errMessageTooLarge, maxMessageSize)
+	}
+	return content, nil
+}
+
+// truncateHeader keeps the errors readable when something else than a header is read, such as a log line
+func truncateHeader(header []byte) string {
+	const maxLength = 64
+	if len(header) > maxLength {
+		return string(header[:maxLength]) + "..."
+	}
+	return string(header)
+}
@@ -0,0 +1,116 @@
+package embedding
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMessage(t *testing.T) {
+	t.Run("it should read back the messages, whatever the length of their lines", func(t *testing.T) {
+		// GIVEN
+		var stream bytes.Buffer
+		long := `{"content": "` + strings.Repeat("a", 256*1024) + `"}`
+		require.NoError(t, writeMessage(&stream, []byte(long)))
+		require.NoError(t, writeMessage(&stream, []byte("{\"content\": \"two\\nlines\"}")))
+		reader := bufio.NewReader(&stream)
+
+		// WHEN
+		first, errFirst := readMessage(reader)
+		second, errSecond := readMessage(reader)
+		_, errEnd := readMessage(reader)
+
+		// THEN
+		require.NoError(t, errFirst)
+		require.NoError(t, errSecond)
+		assert.Equal(t, long, string(first))
+		assert.Equal(t, "{\"content\": \"two\\nlines\"}", string(second))
+		assert.ErrorIs(t, errEnd, io.EOF)
+	})
+
+	t.Run("it should read back a compressed message", func(t *testing.T) {
+		// GIVEN
+		var stream bytes.Buffer
+		message := `{"chunks": [{"content": "` + strings.Repeat("func main() {}\\n", 10000) + `"}]}`
+		require.NoError(t, writeGzipMessage(&stream, []byte(message)))
+		compressed := stream.Len()
+
+		// WHEN
+		read, err := readMessage(bufio.NewReader(&stream))
+
+		// THEN
+		require.NoError(t, err)
+		assert.Equal(t, message, string(read))
+		assert.Less(t, compressed, len(message)/10)
+	})
+
+	t.Run("it should refuse to write a message too large", func(t *testing.T) {
+		// GIVEN
+		var stream bytes.Buffer
+
+		// WHEN
+		err := writeMessage(&stream, make([]byte, maxMessageSize+1))
+
+		// THEN
+		assert.ErrorIs(t, err, errMessageTooLarge)
+		assert.Zero(t, stream.Len())
+	})
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		wantErr string
+	}{
+		{
+			name:    "it should refuse a message without header",
+			stream:  "{\"status\": \"READY\"}\n",
+			wantErr: `invalid message header "{\"status\": \"READY\"}", expected "Content-Length"`,
+		},
+		{
+			name:    "it should refuse an invalid length",
+			stream:  "Content-Length: twelve\r\n\r\n{}",
+			wantErr: `invalid message length "twelve"`,
+		},
+		{
+			name:    "it should refuse a message too large before reading it",
+			stream:  "Content-Length: 1000000000\r\n\r\n{}",
+			wantErr: "message too large: 1000000000 bytes, the limit is 67108864 bytes",
+		},
+		{
+			name:    "it should refuse headers not followed by an empty line",
+			stream:  "Content-Length: 2\r\n{}",
+			wantErr: `failed to read message header "{}": EOF`,
+		},
+		{
+			name:    "it should refuse a message without length",
+			stream:  "Content-Encoding: gzip\r\n\r\n{}",
+			wantErr: `invalid message, "Content-Length" header missing`,
+		},
+		{
+			name:    "it should refuse an unknown encoding",
+			stream:  "Content-Length: 2\r\nContent-Encoding: br\r\n\r\n{}",
+			wantErr: `unsupported message encoding "br"`,
+		},
+		{
+			name:    "it should refuse a truncated message",
+			stream:  "Content-Length: 10\r\n\r\n{}",
+			wantErr: "failed to read message of 10 bytes: unexpected EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			_, err := readMessage(bufio.NewReader(strings.NewReader(tt.stream)))
+
+			// THEN
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/throttle"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultHostedRetries    = 5
+	defaultHostedRetryDelay = time.Second
+	// maxHostedRetryDelay bounds the delays between the retries, including the ones asked by the server
+	maxHostedRetryDelay = time.Minute
+
+	hostedTimeout = time.Minute
+
+	// charsPerToken estimates the tokens of a text from its length, code has fewer characters per token than prose
+	charsPerToken = 3
+	// maxCharsPerToken cuts the texts longer than the context of the models generously, the provider truncating the
+	// rest to the exact context
+	maxCharsPerToken = 6
+)
+
+type (
+	HostedOptions struct {
+		// BatchSize is the number of texts embedded by a single request, bounded by the limit of the provider
+		BatchSize int
+		// Retries is the number of times a request is retried when rate limited, when the server fails, or cannot be
+		// reached
+		Retries int
+		// RetryDelay is the delay before the first retry, doubled by each following one, unless the server asks for
+		// another one
+		RetryDelay time.Duration
+
+		// RequestsPerMinute and TokensPerMinute pace the requests below the rate limits of the account, so they are
+		// not rejected, unlimited if zero
+		RequestsPerMinute int
+		TokensPerMinute   int
+	}
+
+	// HostedStats counts the requests sent to the API by the embedder
+	HostedStats struct {
+		Requests int64
+		// Retries of the failed requests, RateLimited of them being rejected by the rate limits of the provider
+		Retries     int64
+		RateLimited int64
+		// Throttled is the time spent waiting for the rate limiters of the embedder
+		Throttled time.Duration
+	}
+
+	HostedOption func(*HostedOptions)
+
+	// hostedLimits are the limits of the requests of a provider, the batches are split to fit in them
+	hostedLimits struct {
+		// maxTexts is the number of texts accepted by a single request
+		maxTexts int
+		// maxTokens bounds the tokens of a single request, estimated from the length of the texts, unbounded if zero
+		maxTokens int
+		// maxTextTokens is the context of the models, the texts far longer are truncated before being sent, the
+		// provider truncating the others, unbounded if zero
+		maxTextTokens int
+	}
+
+	// hostedProvider builds the requests of the embeddings API of a provider, and decodes its responses
+	hostedProvider interface {
+		// name of the provider, in the errors and the logs
+		name() string
+		// path of the embeddings endpoint, relative to the base url
+		path() string
+		limits() hostedLimits
+		// request returns the body of the request embedding the texts as documents, or as queries
+		request(model string, texts []string, query bool) any
+		// embeddings decodes the embeddings of the response, in the order of the texts
+		embeddings(content []byte) ([][]float32, error)
+	}
+
+	// Hosted computes the embeddings with a hosted model, through the embeddings API of its provider
+	Hosted struct {
+		ctx         context.Context
+		baseURL     string
+		apiKey      string
+		model       string
+		instruction instruction
+		provider    hostedProvider
+		limits      hostedLimits
+		options     *HostedOptions
+		client      *http.Client
+
+		// dimensions of the last embeddings computed, the APIs do not tell beforehand
+		dimensions atomic.Int32
+
+		requestLimiter *throttle.TokenBucket
+		tokenLimiter   *throttle.TokenBucket
+		requests       atomic.Int64
+		retries        atomic.Int64
+		rateLimited    atomic.Int64
+		throttled      atomic.Int64
+	}
+
+	// hostedStatusError is a response of the API with an error status, retried if the server may succeed later
+	hostedStatusError struct {
+		provider   string
+		status     int
+		body       string
+		retryAfter time.Duration
+	}
+)
+
+// WithHostedBatchSize sets the number of texts embedded by a single request, the limit of the provider if not
+// positive or above it
+func WithHostedBatchSize(size int) HostedOption {
+	return func(opts *HostedOptions) {
+		opts.BatchSize = size
+	}
+}
+
+// WithHostedRetries sets the number of retries of the failed requests, and the delay before the first one
+func WithHostedRetries(retries int, delay time.Duration) HostedOption {
+	return func(opts *HostedOptions) {
+		opts.Retries = retries
+		opts.RetryDelay = delay
+	}
+}
+
+// WithHostedRateLimit paces the requests to the rate limits of the account, in requests and in tokens per minute,
+// the tokens being estimated from the length of the texts, unlimited if not positive
+func WithHostedRateLimit(requestsPerMinute int, tokensPerMinute int) HostedOption {
+	return func(opts *HostedOptions) {
+		opts.RequestsPerMinute = requestsPerMinute
+		opts.TokensPerMinute = tokensPerMinute
+	}
+}
+
+func newHosted(ctx context.Context, provider hostedProvider, baseURL string, apiKey string, model string, opts ...HostedOption) *Hosted {
+	options := &HostedOptions{
+		Retries:    defaultHostedRetries,
+		RetryDelay: defaultHostedRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	limits := provider.limits()
+	if options.BatchSize > 0 && options.BatchSize < limits.maxTexts {
+		limits.maxTexts = options.BatchSize
+	}
+	return &Hosted{
+		ctx:         ctx,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		apiKey:      apiKey,
+		model:       model,
+		instruction: instructionFor(model),
+		provider:    provider,
+		limits:      limits,
+		options:     options,
+		client:      &http.Client{Timeout: hostedTimeout},
+
+		requestLimiter: throttle.NewTokenBucket(options.RequestsPerMinute),
+		tokenLimiter:   throttle.NewTokenBucket(options.TokensPerMinute),
+	}
+}
+
+// EmbedDocuments computes the embeddings of the chunks, in batches fitting in the limits of the provider
+func (h *Hosted) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = h.instruction.documentText(chunk)
+	}
+	embeddings := make([][]float32, 0, len(chunks))
+	for _, batch := range h.limits.batches(texts) {
+		computed, err := h.embed(batch, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		embeddings = append(embeddings, computed...)
+	}
+	return embeddings, nil
+}
+
+// EmbedQuery computes the embedding of the query, the ones of the text and of the example are averaged, weighted by
+// the like weight of the query
+func (h *Hosted) EmbedQuery(query Query) ([]float32, error) {
+	texts, weights, err := h.instruction.queryTexts(query)
+	if err != nil {
+		return nil, err
+	}
+	var embeddings [][]float32
+	for _, batch := range h.limits.batches(texts) {
+		computed, err := h.embed(batch, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		embeddings = append(embeddings, computed...)
+	}
+	return average(embeddings, weights)
+}
+
+// Dimensions of the embeddings of the model, 0 until the first ones are computed
+func (h *Hosted) Dimensions() int {
+	return int(h.dimensions.Load())
+}
+
+// ModelID identifies the model of the provider
+func (h *Hosted) ModelID() string {
+	return h.provider.name() + "/" + h.model
+}
+
+// Stats returns the requests sent to the API since the embedder was created
+func (h *Hosted) Stats() HostedStats {
+	return HostedStats{
+		Requests:    h.requests.Load(),
+		Retries:     h.retries.Load(),
+		RateLimited: h.rateLimited.Load(),
+		Throttled:   time.Duration(h.throttled.Load()),
+	}
+}
+
+// WaitReady returns right away, there is nothing to start
+func (h *Hosted) WaitReady() error {
+	return nil
+}
+
+// Close releases the idle connections to the API
+func (h *Hosted) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// batches splits the texts in batches fitting in the limits, truncating the texts longer than the context of the
+// models
+func (l hostedLimits) batches(texts []string) [][]string {
+	var (
+		batches [][]string
+		batch   []string
+		tokens  int
+	)
+	for _, text := range texts {
+		if l.maxTextTokens > 0 {
+			text = truncate(text, l.maxTextTokens*maxCharsPerToken)
+		}
+		textTokens := len(text)/charsPerToken + 1
+		if len(batch) > 0 && (len(batch) >= l.maxTexts || (l.maxTokens > 0 && tokens+textTokens > l.maxTokens)) {
+			batches = append(batches, batch)
+			batch, tokens = nil, 0
+		}
+		batch = append(batch, text)
+		tokens += textTokens
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// truncate cuts the text to at most size bytes, without splitting a character
+func truncate(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	for size > 0 && !utf8.RuneStart(text[size]) {
+		size--
+	}
+	return text[:size]
+}
+
+// embed computes the embeddings of the texts in a single request, retried when rate limited or when the server fails
+func (h *Hosted) embed(texts []string, query bool) ([][]float32, error) {
+	payload, err := json.Marshal(h.provider.request(h.model, texts, query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s request: %w", h.provider.name(), err)
+	}
+
+	tokens := 0
+	for _, text := range texts {
+		tokens += len(text)/charsPerToken + 1
+	}
+	delay := h.options.RetryDelay
+	for attempt := 0; ; attempt++ {
+		if err := h.throttle(tokens); err != nil {
+			return nil, err
+		}
+		embeddings, err := h.call(payload, len(texts))
+		var statusErr *hostedStatusError
+		isStatusErr := errors.As(err, &statusErr)
+		if isStatusErr && statusErr.status == http.StatusTooManyRequests {
+			h.rateLimited.Add(1)
+		}
+		retryable := err != nil && h.ctx.Err() == nil && isRetryable(err)
+		if !retryable || attempt >= h.options.Retries {
+			return embeddings, err
+		}
+		h.retries.Add(1)
+
+		wait := delay
+		if isStatusErr && statusErr.retryAfter > 0 {
+			wait = statusErr.retryAfter
+		}
+		wait = min(wait, maxHostedRetryDelay)
+		zerolog.Ctx(h.ctx).Warn().
+			Err(err).
+			Str("provider", h.provider.name()).
+			Dur("delay", wait).
+			Int("attempt", attempt+1).
+			Msg("embedding request failed, retrying")
+		select {
+		case <-time.After(wait):
+		case <-h.ctx.Done():
+			return nil, h.ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// throttle waits for the rate limiters to allow a request of the tokens
+func (h *Hosted) throttle(tokens int) error {
+	waited, err := h.requestLimiter.Wait(h.ctx, 1)
+	if err != nil {
+		return err
+	}
+	waitedTokens, err := h.tokenLimiter.Wait(h.ctx, tokens)
+	if err != nil {
+		return err
+	}
+	h.throttled.Add(int64(waited + waitedTokens))
+	return nil
+}
+
+// call sends a single request, and checks the embeddings of the response
+func (h *Hosted) call(payload []byte, count int) ([][]float32, error) {
+	h.requests.Add(1)
+	name := h.provider.name()
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodPost, h.baseURL+h.provider.path(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request to %s failed: %w", name, h.baseURL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", name, err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, &hostedStatusError{
+			provider:   name,
+			status:     resp.StatusCode,
+			body:       string(content),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	embeddings, err := h.provider.embeddings(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", name, err)
+	}
+	if len(embeddings) != count {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", count, len(embeddings))
+	}
+	if count > 0 {
+		h.dimensions.Store(int32(len(embeddings[0])))
+	}
+	return embeddings, nil
+}
+
+func (e *hostedStatusError) Error() string {
+	if e.status == http.StatusUnauthorized {
+		return fmt.Sprintf("%s request unauthorized, check the api key: %s", e.provider, e.body)
+	}
+	return fmt.Sprintf("%s request failed with status %d: %s", e.provider, e.status, e.body)
+}
+
+// isRetryable tells if the request may succeed later, when the provider could not be reached, rate limited the request,
+// or failed, the invalid responses and the client errors would fail the same way again
+func isRetryable(err error) bool {
+	var statusErr *hostedStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryable tells if the request may succeed later, when rate limited or when the server failed
+func (e *hostedStatusError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= http.StatusInternalServerError
+}
+
+// parseRetryAfter returns the delay of a Retry-After header given in seconds, 0 if there is none
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,117 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostedLimits_Batches(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits hostedLimits
+		texts  []string
+		want   [][]string
+	}{
+		{
+			name:   "it should split the batches on the number of texts",
+			limits: hostedLimits{maxTexts: 2},
+			texts:  []string{"a", "b", "c"},
+			want:   [][]string{{"a", "b"}, {"c"}},
+		},
+		{
+			name:   "it should split the batches on the estimated tokens",
+			limits: hostedLimits{maxTexts: 10, maxTokens: 5},
+			texts:  []string{"aaaaaa", "bbb", "cccccc"},
+			want:   [][]string{{"aaaaaa", "bbb"}, {"cccccc"}},
+		},
+		{
+			name:   "it should send alone a text above the tokens of a request",
+			limits: hostedLimits{maxTexts: 10, maxTokens: 2},
+			texts:  []string{"aaaaaaaaa", "b"},
+			want:   [][]string{{"aaaaaaaaa"}, {"b"}},
+		},
+		{
+			name:   "it should truncate the texts far longer than the context",
+			limits: hostedLimits{maxTexts: 10, maxTextTokens: 1},
+			texts:  []string{"abcdefgh", "é" + strings.Repeat("x", 4) + "é"},
+			want:   [][]string{{"abcdef", "éxxxx"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.limits.batches(tt.texts))
+		})
+	}
+}
+
+func TestHosted_Providers(t *testing.T) {
+	tests := []struct {
+		name        string
+		newEmbedder func(baseURL string) *Hosted
+		path        string
+		response    string
+		wantRequest map[string]any
+	}{
+		{
+			name: "it should embed the documents with voyage",
+			newEmbedder: func(baseURL string) *Hosted {
+				return NewVoyage(context.Background(), baseURL, "secret", DefaultVoyageModel)
+			},
+			path:     "/embeddings",
+			response: `{"data":[{"index":1,"embedding":[2]},{"index":0,"embedding":[1]}]}`,
+			wantRequest: map[string]any{
+				"model":      "voyage-code-3",
+				"input":      []any{"a", "b"},
+				"input_type": "document",
+				"truncation": true,
+			},
+		},
+		{
+			name: "it should embed the documents with cohere",
+			newEmbedder: func(baseURL string) *Hosted {
+				return NewCohere(context.Background(), baseURL, "secret", DefaultCohereModel)
+			},
+			path:     "/embed",
+			response: `{"embeddings":{"float":[[1],[2]]}}`,
+			wantRequest: map[string]any{
+				"model":           "embed-english-v3.0",
+				"texts":           []any{"a", "b"},
+				"input_type":      "search_document",
+				"embedding_types": []any{"float"},
+				"truncate":        "END",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			var request map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tt.path, r.URL.Path)
+				assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+				content, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(content, &request))
+				_, _ = io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			// WHEN
+			embeddings, err := tt.newEmbedder(server.URL).EmbedDocuments([]code.Chunk{{Content: "a"}, {Content: "b"}})
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRequest, request)
+			assert.Equal(t, [][]float32{{1}, {2}}, embeddings)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package embedding
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	_ "embed"
@@ -15,14 +16,45 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// DefaultWorkingDirectory is where mm keeps its scripts, configuration, and data
+const DefaultWorkingDirectory = "$HOME/.mm"
+
+// DefaultModel is the sentence transformer model used by the indexer to compute embeddings
+const DefaultModel = "all-MiniLM-L6-v2"
+
+// DefaultDimensions is the number of dimensions of the embeddings of DefaultModel
+const DefaultDimensions = 384
+
 const (
 	libDirectoryName    = "lib"
+	libVersionLength    = 12
 	chromaDirectoryName = "chroma"
+
+	// maxLineSize bounds a single line of the logs of the indexer
+	maxLineSize = 1024 * 1024
+
+	// chromaTokenVariable is the environment variable holding the token of the chroma server for the indexer
+	chromaTokenVariable = "MM_CHROMA_TOKEN"
+
+	// closeTimeout is how long the indexer has to finish its current request and exit, before being killed
+	closeTimeout = 10 * time.Second
+	// defaultDrainTimeout is how long Close waits for the responses of the requests already sent, before closing the
+	// indexer anyway
+	defaultDrainTimeout = 30 * time.Second
+	// defaultMaxInFlight bounds the requests sent to the indexer without response, the next ones waiting for a slot,
+	// so the indexer does not buffer more batches than it embeds
+	defaultMaxInFlight = 8
+	// defaultHangTimeout is how long an indexer sending heartbeats can be silent before being killed as hung, the
+	// indexer sends one every 5 seconds, even while processing a request
+	defaultHangTimeout = time.Minute
 )
 
 //go:embed python/indexer.py
@@ -34,6 +66,58 @@ var pyprojectToml []byte
 type (
 	IndexerOptions struct {
 		WorkingDirectory string
+		// DBPath is the directory of the data of the local chroma server, the chroma directory of the working
+		// directory if empty
+		DBPath string
+		// EmbedOnly runs the indexer without connecting to chroma, it only computes embeddings
+		EmbedOnly bool
+		// StoreOnly runs the indexer without loading the model, it only stores embeddings in chroma
+		StoreOnly bool
+		// Collection is the chroma collection holding the chunks, the default one of the indexer if empty
+		Collection string
+		// Threads, EmbedBatchSize, and WriteBatchSize tune the indexer, the defaults of the indexer are used if zero
+		Threads        int
+		EmbedBatchSize int
+		WriteBatchSize int
+		// Address of an indexer service to connect to, an indexer sub-process is spawned if empty
+		Address string
+		// Chroma is the server storing the chunks, the local one if its host is empty
+		Chroma ChromaServer
+
+		// Model is the sentence transformer model computing the embeddings, DefaultModel if empty
+		Model string
+		// HangTimeout is how long the indexer can stop sending heartbeats before being killed as hung, never if zero
+		HangTimeout time.Duration
+		// DrainTimeout is how long Close waits for the responses of the requests already sent, not at all if zero
+		DrainTimeout time.Duration
+		// MaxInFlight bounds the requests sent to the indexer without response, the next ones blocking until one is
+		// answered, defaultMaxInFlight if zero, unbounded if negative
+		MaxInFlight int
+		// CompressAbove compresses the requests larger than it, when the indexer accepts compressed requests, never
+		// if zero
+		CompressAbove int
+		// Device computes the embeddings, auto, cpu, cuda, or mps, the indexer picks the first accelerator found if
+		// empty
+		Device string
+		// Metric compares the embeddings of a collection created by the indexer, l2, cosine, or dot, l2 if empty,
+		// recorded with Normalized, whether mm normalizes the embeddings, in the metadata of the collection
+		Metric     string
+		Normalized bool
+
+		// Command runs the indexer instead of the python of uv or of the virtual environment of the working directory,
+		// with Args instead of the indexer script of the working directory, e.g. another interpreter running the
+		// embedded script, or a script of its own speaking the same protocol
+		Command string
+		Args    []string
+	}
+
+	// ChromaServer locates a chroma server, the defaults of the indexer (localhost:8000) are used for empty values
+	ChromaServer struct {
+		Host string
+		Port int
+		SSL  bool
+		// Token is sent as a bearer token if not empty, it is passed to the indexer through its environment
+		Token string
 	}
 
 	IndexerOption func(*IndexerOptions)
@@ -49,43 +133,308 @@ type (
 		stdout io.ReadCloser
 		stderr io.ReadCloser
 
-		out          chan string
-		completionCh chan struct{}
+		// events reported by the indexer, see Events
+		events chan IndexerEvent
+		// ready is closed once the indexer announced it is ready, exited once its output ended
+		ready  chan struct{}
+		exited chan struct{}
+
+		pending *pendingRequests
+		// writeLock keeps the requests written by concurrent callers on separate lines
+		writeLock *sync.Mutex
+		// acks are the indexing requests sent by ProcessChunk and not acknowledged yet, ackErr the first failure
+		acks    *sync.WaitGroup
+		ackLock *sync.Mutex
+		ackErr  error
+		// lastHeartbeat is the time of the last heartbeat in nanoseconds, 0 for the indexers not sending any
+		lastHeartbeat *atomic.Int64
+		// acceptsGzip is set once the indexer announced it accepts the requests compressed with gzip, the ones larger
+		// than compressAbove are then compressed
+		acceptsGzip   *atomic.Bool
+		compressAbove int
+		// drainTimeout is how long Close waits for the responses of the requests already sent
+		drainTimeout time.Duration
+		// inFlight holds a slot per request sent without response, nil if they are not bounded
+		inFlight chan struct{}
+		// progress holds the last progress reported by the indexer, until read
+		progress chan IndexerProgress
+		// device computing the embeddings, announced by the indexer once ready
+		device *atomic.Value
+
+		model string
+		// dimensions of the embeddings, learned from the first ones when the model is not the default one
+		dimensions atomic.Int32
+	}
+
+	Query struct {
+		Text     string         `json:"text,omitempty"`
+		NResults int            `json:"n_results"`
+		Where    map[string]any `json:"where,omitempty"`
+
+		// Like is a code example, its embedding is combined with the one of the text, weighted by LikeWeight, nil for
+		// the default weight so an explicit 0 is kept
+		Like       string   `json:"like,omitempty"`
+		LikeWeight *float64 `json:"like_weight,omitempty"`
+	}
 
-		pendingChunks *atomic.Int32
+	QueryResult struct {
+		Id       string             `json:"id"`
+		Document string             `json:"document"`
+		Metadata code.ChunkMetadata `json:"metadata"`
+		Distance float64            `json:"distance"`
+	}
 
-		ready *sync.WaitGroup
+	// IndexerProgress is reported by the indexer after each batch, its counts start with the indexer
+	IndexerProgress struct {
+		// Embedded is the number of texts embedded, Stored the number of chunks stored
+		Embedded int64
+		Stored   int64
+		// PerSecond is the number of chunks processed per second over the last seconds
+		PerSecond float64
+	}
+
+	// RawRecord is a record as stored in chroma, returned when inspecting the collection
+	RawRecord struct {
+		Id        string         `json:"id"`
+		Document  string         `json:"document"`
+		Metadata  map[string]any `json:"metadata"`
+		Embedding []float32      `json:"embedding"`
+	}
+
+	// pendingRequests routes the responses of the indexer to the requests waiting for them, by request id
+	pendingRequests struct {
+		lock    sync.Mutex
+		nextID  uint64
+		waiting map[string]chan response
+		exited  bool
+		// drained is closed once draining, see drain, and no request waits for its response anymore
+		drained chan struct{}
+		// err fails the requests once the indexer exited, errIndexerExited if nil
+		err error
+	}
+
+	// IndexerErrorCode classifies the failures reported by the indexer
+	IndexerErrorCode string
+
+	// IndexerError is a failure reported by the indexer for a request, errors.As tells its code
+	IndexerError struct {
+		Code    IndexerErrorCode
+		Message string
+	}
+
+	response struct {
+		RequestID   string        `json:"request_id"`
+		Kind        string        `json:"kind"`
+		Status      string        `json:"status"`
+		Error       string        `json:"error"`
+		Results     []QueryResult `json:"results"`
+		Embeddings  [][]float32   `json:"embeddings"`
+		Collections []string      `json:"collections"`
+		Records     []RawRecord   `json:"records"`
+		Count       int           `json:"count"`
+		Dimensions  int           `json:"dimensions"`
+		Problems    []string      `json:"problems"`
+
+		// IndexedCount is the number of chunks stored by an index request
+		IndexedCount int `json:"indexed_count"`
+
+		// Tokens counts the tokens of the texts of the chunks, returned instead of their embeddings when asked
+		Tokens []int `json:"tokens"`
+
+		// Model is the embedding model recorded with the collection, empty if none was
+		Model string `json:"model"`
+
+		// Code classifies the error of a failed request
+		Code IndexerErrorCode `json:"code"`
+		// Protocol is the version of the protocol spoken by the indexer, announced with its ready status
+		Protocol int `json:"protocol"`
+		// Compression lists the encodings of the requests accepted by the indexer, announced with its ready status
+		Compression []string `json:"compression"`
+		// Embedded, Stored, and PerSecond are the counts of a progress message
+		Embedded  int64   `json:"embedded"`
+		Stored    int64   `json:"stored"`
+		PerSecond float64 `json:"per_second"`
+		// Device computes the embeddings of the indexer, Devices are the ones available, announced with its ready
+		// status
+		Device  string   `json:"device"`
+		Devices []string `json:"devices"`
+		// Metric and Normalized describe how the embeddings of the collection are compared, returned with its stats
+		Metric     string `json:"metric"`
+		Normalized bool   `json:"normalized"`
 	}
 )
 
+const (
+	// InvalidRequestError is a request the indexer cannot process, or not in its mode (embed only, store only)
+	InvalidRequestError IndexerErrorCode = "invalid_request"
+	// EncodingError is a chunk whose text cannot be encoded
+	EncodingError IndexerErrorCode = "encoding"
+	// OutOfMemoryError is a batch too large for the memory of the model, smaller batches may succeed
+	OutOfMemoryError IndexerErrorCode = "out_of_memory"
+	// StoreError is a failure of chroma
+	StoreError IndexerErrorCode = "store"
+	// InternalError is any other failure of the indexer
+	InternalError IndexerErrorCode = "internal"
+)
+
+var (
+	// errIndexerExited fails the requests still waiting for their response when the indexer exits
+	errIndexerExited = errors.New("the indexer exited")
+	// ErrIndexerClosing fails the requests sent once the indexer is closing, waiting for the responses of the previous
+	// ones
+	ErrIndexerClosing = errors.New("the indexer is closing")
+	// ErrProtocolMismatch fails the requests sent to an indexer speaking another version of the protocol than mm
+	ErrProtocolMismatch = errors.New("indexer protocol mismatch")
+)
+
+const (
+	// readyStatus is the status of the message sent by the indexer once it accepts requests
+	readyStatus = "READY"
+	// heartbeatStatus is the status of the messages sent periodically by the indexer while it is alive
+	heartbeatStatus = "HEARTBEAT"
+	// progressStatus is the status of the messages sent by the indexer after each batch embedded or stored
+	progressStatus = "PROGRESS"
+	// protocolVersion is the version of the messages exchanged with the indexer, announced by the indexer once ready,
+	// to bump with any incompatible change of indexer.py
+	protocolVersion = 2
+)
+
 func WithWorkingDirectory(wd string) func(*IndexerOptions) {
 	return func(opts *IndexerOptions) {
 		opts.WorkingDirectory = wd
 	}
 }
 
+// WithDBPath sets the directory of the data of the local chroma server, checked for corruptions by the indexer
+func WithDBPath(path string) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.DBPath = path
+	}
+}
+
+// WithEmbedOnly runs the indexer only to compute embeddings, storing them is up to the caller
+func WithEmbedOnly() func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.EmbedOnly = true
+	}
+}
+
+// WithCollection selects the chroma collection holding the chunks
+func WithCollection(name string) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Collection = name
+	}
+}
+
+// WithThreads sets the number of threads used by the model
+func WithThreads(threads int) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Threads = threads
+	}
+}
+
+// WithEmbedBatchSize sets the number of texts encoded at once by the model
+func WithEmbedBatchSize(size int) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.EmbedBatchSize = size
+	}
+}
+
+// WithWriteBatchSize sets the number of records written at once in chroma
+func WithWriteBatchSize(size int) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.WriteBatchSize = size
+	}
+}
+
+// WithModel selects the sentence transformer model computing the embeddings, the default one if empty
+func WithModel(model string) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Model = model
+	}
+}
+
+// WithDevice sets the device computing the embeddings, auto, cpu, cuda, or mps
+func WithDevice(device string) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Device = device
+	}
+}
+
+// WithCollectionSpace sets how the embeddings of a collection created by the indexer are compared, and whether they
+// are normalized by mm, recorded with the collection
+func WithCollectionSpace(metric string, normalized bool) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Metric = metric
+		opts.Normalized = normalized
+	}
+}
+
+// WithCommand runs the indexer with the command and the arguments, followed by the options of the indexer, the
+// python of uv or of the virtual environment of the working directory if the command is empty, and the embedded
+// script if there are no arguments, environment variables are expanded in both
+func WithCommand(command string, args ...string) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Command = command
+		opts.Args = args
+	}
+}
+
+// WithHangTimeout sets how long the indexer can stop sending heartbeats before being killed as hung, never if zero
+func WithHangTimeout(timeout time.Duration) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.HangTimeout = timeout
+	}
+}
+
+// WithDrainTimeout sets how long Close waits for the responses of the requests already sent, not at all if zero
+func WithDrainTimeout(timeout time.Duration) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.DrainTimeout = timeout
+	}
+}
+
+// WithMaxInFlight bounds the requests sent to the indexer without response, the default bound if zero, unbounded if
+// negative
+func WithMaxInFlight(requests int) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.MaxInFlight = requests
+	}
+}
+
+// WithCompression compresses the requests larger than threshold bytes sent to an indexer accepting it, never if zero
+func WithCompression(threshold int) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.CompressAbove = threshold
+	}
+}
+
+// WithChromaServer stores the chunks in the chroma server, instead of the local one
+func WithChromaServer(server ChromaServer) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Chroma = server
+	}
+}
+
+// WithStoreOnly runs the indexer only to store embeddings computed by the caller in chroma
+func WithStoreOnly() func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.StoreOnly = true
+	}
+}
+
 func RunIndexer(ctx context.Context, opts ...IndexerOption) (*RunningIndexer, error) {
 	logger := zerolog.Ctx(ctx)
 
 	options := buildOptions(opts...)
-
-	wd := os.ExpandEnv(options.WorkingDirectory)
-	err := prepareWorkingDirectoryIfNeeded(ctx, os.ExpandEnv(wd))
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to prepare working directory")
-		return nil, fmt.Errorf("failed to prepare working directory: %w", err)
+	if options.Address != "" {
+		return connectIndexer(ctx, options)
 	}
 
-	cmdTokens := []string{
-		"run",
-		"python",
-		"indexer.py",
+	cmd, err := indexerCommand(ctx, options)
+	if err != nil {
+		return nil, err
 	}
-	// fixme: we will need to pass the db path to the chroma server, and run it somewhere else
-	// cmdTokens = append(cmdTokens, buildIndexerCmdArgs(wd)...)
-
-	cmd := exec.CommandContext(ctx, "uv", cmdTokens...)
-	cmd.Dir = filepath.Join(wd, libDirectoryName)
 
 	// Set up pipes for communication
 	stdin, err := cmd.StdinPipe()
@@ -107,6 +456,11 @@ func RunIndexer(ctx context.Context, opts ...IndexerOption) (*RunningIndexer, er
 	}
 
 	runningIndexer := initRunningIndexer(ctx, cmd, stdin, stdout, stderr)
+	runningIndexer.useModel(options.Model)
+	runningIndexer.watch(options.HangTimeout)
+	runningIndexer.compressAbove = options.CompressAbove
+	runningIndexer.drainTimeout = options.DrainTimeout
+	runningIndexer.limitInFlight(options.MaxInFlight)
 
 	logger.Trace().Msg("running indexer sub-process")
 	if err := cmd.Start(); err != nil {
@@ -117,64 +471,166 @@ func RunIndexer(ctx context.Context, opts ...IndexerOption) (*RunningIndexer, er
 	return runningIndexer, nil
 }
 
-func initRunningIndexer(ctx context.Context, cmd *exec.Cmd, stdin io.WriteCloser, stdout io.ReadCloser, stderr io.ReadCloser) *RunningIndexer {
+// indexerCommand prepares the working directory, and the command running the python indexer with the options
+func indexerCommand(ctx context.Context, options *IndexerOptions) (*exec.Cmd, error) {
 	logger := zerolog.Ctx(ctx)
 
-	out := captureOutput(ctx, stdout, stderr, logger)
+	wd := os.ExpandEnv(options.WorkingDirectory)
+	dbPath := os.ExpandEnv(options.DBPath)
+	if dbPath == "" {
+		dbPath = ChromaPath(wd)
+	}
+	err := prepareWorkingDirectoryIfNeeded(ctx, wd, dbPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to prepare working directory")
+		return nil, fmt.Errorf("failed to prepare working directory: %w", err)
+	}
 
-	completionCh := make(chan struct{})
+	cmdTokens := []string{"indexer.py"}
+	if len(options.Args) > 0 {
+		cmdTokens = make([]string, len(options.Args))
+		for i, arg := range options.Args {
+			cmdTokens[i] = os.ExpandEnv(arg)
+		}
+	}
+	// fixme: we will need to pass the db path to the chroma server, and run it somewhere else, for now the
+	//  indexer only uses it to check the integrity of the data
+	if options.EmbedOnly {
+		cmdTokens = append(cmdTokens, "--embed-only")
+	} else {
+		cmdTokens = append(cmdTokens, buildIndexerCmdArgs(dbPath, options.Chroma)...)
+	}
+	if options.StoreOnly {
+		cmdTokens = append(cmdTokens, "--store-only")
+	}
+	if options.Collection != "" {
+		cmdTokens = append(cmdTokens, "--collection", options.Collection)
+	}
+	if options.Threads > 0 {
+		cmdTokens = append(cmdTokens, "--threads", strconv.Itoa(options.Threads))
+	}
+	if options.EmbedBatchSize > 0 {
+		cmdTokens = append(cmdTokens, "--embed-batch-size", strconv.Itoa(options.EmbedBatchSize))
+	}
+	if options.WriteBatchSize > 0 {
+		cmdTokens = append(cmdTokens, "--write-batch-size", strconv.Itoa(options.WriteBatchSize))
+	}
+	if options.Model != "" {
+		cmdTokens = append(cmdTokens, "--model-name", options.Model)
+	}
+	if options.Device != "" {
+		cmdTokens = append(cmdTokens, "--device", options.Device)
+	}
+	if options.Metric != "" {
+		cmdTokens = append(cmdTokens, "--metric", options.Metric)
+	}
+	if options.Normalized {
+		cmdTokens = append(cmdTokens, "--normalized")
+	}
 
-	ready := sync.WaitGroup{}
-	ready.Add(1)
-	pendingChunks := atomic.Int32{}
-	outWrapped := make(chan string)
-	go func() {
-		defer close(outWrapped)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case line, ok := <-out:
-				if !ok {
-					return
-				}
+	libPath := LibPath(wd)
+	var cmd *exec.Cmd
+	if options.Command != "" {
+		// the interpreter and the dependencies of the script are the responsibility of the user
+		cmd = exec.CommandContext(ctx, os.ExpandEnv(options.Command), cmdTokens...)
+	} else if hasUV() {
+		cmd = exec.CommandContext(ctx, "uv", append([]string{"run", "python"}, cmdTokens...)...)
+	} else {
+		python, err := prepareVenv(ctx, libPath)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.CommandContext(ctx, python, cmdTokens...)
+	}
+	cmd.Dir = libPath
+	if options.Chroma.Token != "" && !options.EmbedOnly {
+		// not on the command line, where any user of the machine could read it
+		cmd.Env = append(os.Environ(), chromaTokenVariable+"="+options.Chroma.Token)
+	}
 
-				select {
-				case outWrapped <- line:
-				case <-ctx.Done():
-					return
-					// fixme: restore this or another mechanism to not hang if no-one is listening.
-					//   but if we put this, the listener is missing some of the logs
-					//default:
-					//	// maybe no one is reading the output, so we just drop it
-				}
+	return cmd, nil
+}
 
-				if !strings.Contains(line, "status") {
-					continue
-				}
+func initRunningIndexer(ctx context.Context, cmd *exec.Cmd, stdin io.WriteCloser, stdout io.ReadCloser, stderr io.ReadCloser) *RunningIndexer {
+	logger := zerolog.Ctx(ctx)
 
-				if strings.Contains(line, "READY") {
-					ready.Done()
-				}
+	messages := readMessages(ctx, stdout, logger)
+	out := captureOutput(ctx, stderr, logger)
+	events := make(chan IndexerEvent, eventsBuffer)
+	// closed once both the messages and the logs of the indexer ended
+	senders := &sync.WaitGroup{}
+	senders.Add(2)
+	go func() {
+		senders.Wait()
+		close(events)
+	}()
 
-				val := pendingChunks.Add(-1)
-				if val < 0 {
-					// don't want negative values, this counter is not precise science, we would need to
-					// identify the chunks sent with some unique ids, here we just assume that the indexer
-					// is always returning a single line per chunk processed
-					pendingChunks.CompareAndSwap(val, 0)
+	ready := make(chan struct{})
+	exited := make(chan struct{})
+	pending := &pendingRequests{waiting: make(map[string]chan response)}
+	lastHeartbeat := &atomic.Int64{}
+	acceptsGzip := &atomic.Bool{}
+	progress := make(chan IndexerProgress, 1)
+	device := &atomic.Value{}
+	go func() {
+		defer senders.Done()
+		defer close(exited)
+		defer pending.exit()
+		defer close(progress)
+		readyOnce := sync.Once{}
+		for message := range messages {
+			resp, ok := parseResponse(message)
+			switch {
+			case !ok:
+				logger.Warn().Str("message", truncateHeader(message)).Msg("dropping invalid message of the indexer")
+			case resp.Status == readyStatus:
+				if resp.Protocol != protocolVersion {
+					err := protocolMismatch(cmd, resp.Protocol)
+					logger.Error().Err(err).Msg("indexer refused")
+					pending.refuse(err)
+					offerEvent(events, ErrorEvent{Err: err})
 				}
-
-				if val <= 0 {
-					select {
-					case completionCh <- struct{}{}:
-					default:
-					}
+				acceptsGzip.Store(slices.Contains(resp.Compression, gzipEncoding))
+				if resp.Device != "" {
+					device.Store(resp.Device)
+					logger.Info().Str("device", resp.Device).Strs("available", resp.Devices).Msg("Indexer embedding on device")
+				}
+				readyOnce.Do(func() {
+					close(ready)
+					offerEvent(events, ReadyEvent{Protocol: resp.Protocol, Device: resp.Device, Devices: resp.Devices})
+				})
+			case resp.Status == heartbeatStatus:
+				lastHeartbeat.Store(time.Now().UnixNano())
+			case resp.Status == progressStatus:
+				reported := IndexerProgress{Embedded: resp.Embedded, Stored: resp.Stored, PerSecond: resp.PerSecond}
+				offerProgress(progress, reported)
+				offerEvent(events, ProgressEvent{reported})
+			case !pending.deliver(resp):
+				logger.Warn().Str("requestId", resp.RequestID).Msg("dropping response of an unknown request")
+			default:
+				if event, ok := responseEvent(resp); ok {
+					offerEvent(events, event)
 				}
 			}
 		}
 	}()
 
+	// the logs of the indexer are forwarded separately, the responses are not waiting for them to be read
+	go func() {
+		defer senders.Done()
+		for line := range out {
+			select {
+			case events <- logEvent(line):
+			case <-ctx.Done():
+				return
+				// fixme: restore this or another mechanism to not hang if no-one is listening.
+				//   but if we put this, the listener is missing some of the logs
+				//default:
+				//	// maybe no one is reading the output, so we just drop it
+			}
+		}
+	}()
+
 	return &RunningIndexer{
 		ctx:    ctx,
 		logger: logger,
@@ -184,39 +640,250 @@ func initRunningIndexer(ctx context.Context, cmd *exec.Cmd, stdin io.WriteCloser
 		stdout:  stdout,
 		stderr:  stderr,
 
-		out:          outWrapped,
-		completionCh: completionCh,
+		events: events,
+		ready:  ready,
+		exited: exited,
 
-		pendingChunks: &pendingChunks,
+		pending:   pending,
+		writeLock: &sync.Mutex{},
+		acks:      &sync.WaitGroup{},
+		ackLock:   &sync.Mutex{},
 
-		ready: &ready,
+		lastHeartbeat: lastHeartbeat,
+		acceptsGzip:   acceptsGzip,
+		progress:      progress,
+		device:        device,
 	}
 }
 
-func captureOutput(ctx context.Context, stdout io.ReadCloser, stderr io.ReadCloser, logger *zerolog.Logger) chan string {
-	out := make(chan string)
-	wg := &sync.WaitGroup{}
-	wg.Add(2)
+// watch kills the indexer once it stops sending heartbeats for the timeout, its requests then failing, the indexers
+// not sending any heartbeat are not watched
+func (i *RunningIndexer) watch(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
 	go func() {
-		defer wg.Done()
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line != "" {
-				select {
-				case <-ctx.Done():
-					return
-				case out <- line:
-				}
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-i.exited:
+				return
+			case <-ticker.C:
+			}
+			last := i.lastHeartbeat.Load()
+			if last == 0 || time.Since(time.Unix(0, last)) < timeout {
+				continue
 			}
+			i.logger.Error().Dur("silence", time.Since(time.Unix(0, last))).Msg("indexer stopped sending heartbeats, killing it")
+			i.kill()
+			return
 		}
-		if err := scanner.Err(); err != nil && !strings.Contains(err.Error(), "closed") {
-			logger.Error().Err(err).Msg("error reading stdout")
+	}()
+}
+
+// kill stops the indexer right away, or disconnects from the indexer service
+func (i *RunningIndexer) kill() {
+	if i.command != nil && i.command.Process != nil {
+		_ = i.command.Process.Kill()
+		return
+	}
+	_ = i.stdout.Close()
+}
+
+// err returns the failure reported by the response, nil if it succeeded
+func (r response) err() error {
+	if r.Status == "success" {
+		return nil
+	}
+	return &IndexerError{Code: r.Code, Message: r.Error}
+}
+
+func (e *IndexerError) Error() string {
+	// the services started before the codes were introduced do not send them
+	if e.Code == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// parseResponse decodes a message of the protocol, a response carrying the id of its request or a status, false if
+// it is neither
+func parseResponse(message []byte) (response, bool) {
+	var resp response
+	if err := json.Unmarshal(message, &resp); err != nil {
+		return response{}, false
+	}
+	return resp, resp.RequestID != "" || resp.Status == readyStatus || resp.Status == heartbeatStatus || resp.Status == progressStatus
+}
+
+// offerProgress replaces the progress not read yet, if any, the readers only care about the last one
+func offerProgress(progress chan IndexerProgress, latest IndexerProgress) {
+	for {
+		select {
+		case progress <- latest:
+			return
+		default:
+		}
+		select {
+		case <-progress:
+		default:
+		}
+	}
+}
+
+// add registers a new request, returns its id and the channel receiving its response, closed if the indexer exits
+func (p *pendingRequests) add() (string, chan response, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.exited {
+		return "", nil, p.failure()
+	}
+	if p.drained != nil {
+		return "", nil, ErrIndexerClosing
+	}
+	p.nextID++
+	id := strconv.FormatUint(p.nextID, 10)
+	responses := make(chan response, 1)
+	p.waiting[id] = responses
+	return id, responses, nil
+}
+
+// remove forgets a request whose response is not awaited anymore
+func (p *pendingRequests) remove(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.waiting, id)
+	p.checkDrained()
+}
+
+// deliver sends the response to its request, false if no request waits for it
+func (p *pendingRequests) deliver(resp response) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	responses, found := p.waiting[resp.RequestID]
+	if !found {
+		return false
+	}
+	delete(p.waiting, resp.RequestID)
+	responses <- resp
+	p.checkDrained()
+	return true
+}
+
+// drain refuses the next requests, returns the channel closed once the responses of the waiting ones are received
+func (p *pendingRequests) drain() (<-chan struct{}, int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.drained == nil {
+		p.drained = make(chan struct{})
+		p.checkDrained()
+	}
+	return p.drained, len(p.waiting)
+}
+
+// waitingCount is the number of requests waiting for their response
+func (p *pendingRequests) waitingCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.waiting)
+}
+
+// checkDrained closes drained once draining, and no request waits anymore
+func (p *pendingRequests) checkDrained() {
+	if p.drained == nil || len(p.waiting) > 0 {
+		return
+	}
+	select {
+	case <-p.drained:
+	default:
+		close(p.drained)
+	}
+}
+
+// exit fails the requests still waiting, and the next ones
+func (p *pendingRequests) exit() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.close()
+}
+
+// refuse fails the requests still waiting, and the next ones, with err
+func (p *pendingRequests) refuse(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.close()
+}
+
+// refusal is the error refusing the indexer, nil if it is usable
+func (p *pendingRequests) refusal() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
+
+// failure is the error of the requests sent once the indexer exited
+func (p *pendingRequests) failure() error {
+	if p.err != nil {
+		return p.err
+	}
+	return errIndexerExited
+}
+
+func (p *pendingRequests) close() {
+	p.exited = true
+	for id, responses := range p.waiting {
+		close(responses)
+		delete(p.waiting, id)
+	}
+	p.checkDrained()
+}
+
+// readMessages reads the messages of the protocol written by the indexer on its stdout, until it ends, or until a
+// message cannot be read, the following ones being lost
+func readMessages(ctx context.Context, stdout io.Reader, logger *zerolog.Logger) chan []byte {
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		reader := bufio.NewReader(stdout)
+		// the indexers before the framing of the messages wrote one json document per line, the ready one is still
+		// read to tell which protocol they speak
+		if first, err := reader.Peek(1); err == nil && first[0] == '{' {
+			line, _ := reader.ReadBytes('\n')
+			select {
+			case <-ctx.Done():
+				return
+			case messages <- bytes.TrimSpace(line):
+			}
+		}
+		for {
+			message, err := readMessage(reader)
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !strings.Contains(err.Error(), "closed") {
+					logger.Error().Err(err).Msg("error reading the messages of the indexer")
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case messages <- message:
+			}
 		}
 	}()
+	return messages
+}
+
+// captureOutput forwards the logs written by the indexer on its stderr, line by line
+func captureOutput(ctx context.Context, stderr io.Reader, logger *zerolog.Logger) chan string {
+	out := make(chan string)
 	go func() {
-		defer wg.Done()
+		defer close(out)
 		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
 		for scanner.Scan() {
 			line := scanner.Text()
 			if line != "" {
@@ -231,67 +898,422 @@ func captureOutput(ctx context.Context, stdout io.ReadCloser, stderr io.ReadClos
 			logger.Error().Err(err).Msg("error reading stderr")
 		}
 	}()
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
 	return out
 }
 
+// WaitReady returns once the indexer accepts requests, or with an error if it exited before or speaks another version
+// of the protocol
 func (i *RunningIndexer) WaitReady() error {
-	i.ready.Wait()
+	select {
+	case <-i.ready:
+		return i.pending.refusal()
+	case <-i.exited:
+		select {
+		case <-i.ready:
+			return i.pending.refusal()
+		default:
+		}
+		return fmt.Errorf("%w before being ready", errIndexerExited)
+	}
+}
 
-	return nil
+// hasExited tells if the output of the indexer ended, the indexer being gone
+func (i *RunningIndexer) hasExited() bool {
+	select {
+	case <-i.exited:
+		return true
+	default:
+		return false
+	}
 }
 
-func (i *RunningIndexer) Output() <-chan string {
-	return i.out
+// Progress returns the last progress reported by the indexer, each one replacing the previous one if it was not read,
+// closed once the indexer exits
+func (i *RunningIndexer) Progress() <-chan IndexerProgress {
+	return i.progress
 }
 
+// Events returns the logs, the progress, and the completed requests reported by the indexer, closed once it exits,
+// the logs are waiting to be read, the other events being dropped when they are not read fast enough
+func (i *RunningIndexer) Events() <-chan IndexerEvent {
+	return i.events
+}
+
+// ProcessChunk sends the chunks to be embedded and stored by the indexer, without waiting for them to be, the
+// failures are returned by WaitForCompletion
 func (i *RunningIndexer) ProcessChunk(chunks []code.Chunk) error {
-	toProcess := map[string]any{
-		"chunks": chunks,
-	}
-	bytes, err := json.Marshal(toProcess)
+	release, err := i.acquire()
 	if err != nil {
-		i.logger.Error().Err(err).Msg("failed to marshal chunks")
-		return fmt.Errorf("failed to marshal chunks: %w", err)
+		return err
 	}
-
-	i.pendingChunks.Add(1)
-	_, err = fmt.Fprintln(i.stdin, string(bytes))
+	id, responses, err := i.pending.add()
 	if err != nil {
-		i.pendingChunks.Add(-1)
+		release()
+		return err
+	}
+	if err := i.send(id, map[string]any{"chunks": chunks}); err != nil {
+		i.pending.remove(id)
+		release()
 		i.logger.Error().Err(err).Msg("failed to write chunks to stdin")
-		return fmt.Errorf("failed to write chunks to stdin: %w", err)
+		return err
 	}
 
+	i.acks.Add(1)
+	go func() {
+		defer i.acks.Done()
+		defer release()
+		var err error
+		select {
+		case <-i.ctx.Done():
+			i.pending.remove(id)
+			err = i.ctx.Err()
+		case resp, ok := <-responses:
+			if !ok {
+				err = errIndexerExited
+			} else if resp.Status != "success" {
+				err = resp.err()
+			}
+		}
+		if err != nil {
+			i.ackLock.Lock()
+			if i.ackErr == nil {
+				i.ackErr = fmt.Errorf("failed to index chunks: %w", err)
+			}
+			i.ackLock.Unlock()
+		}
+	}()
 	return nil
 }
 
-func (i *RunningIndexer) WaitForCompletion() {
-	i.logger.Trace().Msg("wait for completion of indexer")
-	if i.pendingChunks.Load() == 0 {
+// Query searches the indexed chunks closest to the query text
+func (i *RunningIndexer) Query(query Query) ([]QueryResult, error) {
+	resp, err := i.request(map[string]any{"query": query})
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return resp.Results, nil
+}
+
+// Dimensions of the embeddings of the sentence transformer model, 0 until the first one is computed when the model
+// is not the default one
+func (i *RunningIndexer) Dimensions() int {
+	return int(i.dimensions.Load())
+}
+
+// ModelID returns the sentence transformer model of the indexer
+// Device returns the device computing the embeddings, empty until the indexer is ready, or if it does not load a model
+func (i *RunningIndexer) Device() string {
+	device, _ := i.device.Load().(string)
+	return device
+}
+
+func (i *RunningIndexer) ModelID() string {
+	return i.model
+}
+
+// useModel records the sentence transformer model of the indexer, DefaultModel if empty
+func (i *RunningIndexer) useModel(model string) {
+	if model == "" || model == DefaultModel {
+		i.model = DefaultModel
+		i.dimensions.Store(DefaultDimensions)
 		return
 	}
+	i.model = model
+}
+
+// EmbedDocuments computes the embeddings of the chunks, without storing them
+func (i *RunningIndexer) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	resp, err := i.request(map[string]any{"embed": map[string]any{"chunks": chunks}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed chunks: %w", err)
+	}
+	if len(resp.Embeddings) != len(chunks) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(chunks), len(resp.Embeddings))
+	}
+	if len(resp.Embeddings) > 0 {
+		i.dimensions.Store(int32(len(resp.Embeddings[0])))
+	}
+	return resp.Embeddings, nil
+}
+
+// CountTokens counts the tokens of the texts embedded for the chunks with the tokenizer of the model, without
+// embedding them
+func (i *RunningIndexer) CountTokens(chunks []code.Chunk) ([]int, error) {
+	resp, err := i.request(map[string]any{"embed": map[string]any{"chunks": chunks, "count_tokens": true}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	if len(resp.Tokens) != len(chunks) {
+		return nil, fmt.Errorf("expected %d token counts, got %d", len(chunks), len(resp.Tokens))
+	}
+	return resp.Tokens, nil
+}
+
+// EmbedQuery computes the embedding of the query (combining the text and the example if any)
+func (i *RunningIndexer) EmbedQuery(query Query) ([]float32, error) {
+	resp, err := i.request(map[string]any{"embed": map[string]any{"query": query}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(resp.Embeddings) != 1 {
+		return nil, fmt.Errorf("expected a single embedding, got %d", len(resp.Embeddings))
+	}
+	i.dimensions.Store(int32(len(resp.Embeddings[0])))
+	return resp.Embeddings[0], nil
+}
+
+// Upsert stores records with embeddings computed by the caller in chroma
+func (i *RunningIndexer) Upsert(records []RawRecord) error {
+	_, err := i.request(map[string]any{"store": map[string]any{"action": "upsert", "records": records}})
+	if err != nil {
+		return fmt.Errorf("failed to upsert records: %w", err)
+	}
+	return nil
+}
+
+// QueryEmbedding searches the records closest to the embedding in chroma
+func (i *RunningIndexer) QueryEmbedding(vector []float32, nResults int, where map[string]any) ([]QueryResult, error) {
+	resp, err := i.request(map[string]any{
+		"store": map[string]any{"action": "query", "embedding": vector, "n_results": nResults, "where": where},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embedding: %w", err)
+	}
+	return resp.Results, nil
+}
+
+// DeleteByFile removes all the records of the file from chroma
+func (i *RunningIndexer) DeleteByFile(filePath string) error {
+	_, err := i.request(map[string]any{"store": map[string]any{"action": "delete", "file_path": filePath}})
+	if err != nil {
+		return fmt.Errorf("failed to delete records of %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Stats returns the number of records stored in chroma, and the dimensions of their embeddings
+func (i *RunningIndexer) Stats() (count int, dimensions int, err error) {
+	resp, err := i.request(map[string]any{"store": map[string]any{"action": "stats"}})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return resp.Count, resp.Dimensions, nil
+}
+
+// CollectionModel returns the embedding model recorded with the chroma collection, empty if none was
+func (i *RunningIndexer) CollectionModel() (string, error) {
+	resp, err := i.request(map[string]any{"store": map[string]any{"action": "stats"}})
+	if err != nil {
+		return "", fmt.Errorf("failed to get stats: %w", err)
+	}
+	return resp.Model, nil
+}
+
+// CollectionSpace returns how the embeddings of the chroma collection are compared, with its number of records, the
+// collections created before mm recorded it compare them with l2, unnormalized
+func (i *RunningIndexer) CollectionSpace() (metric string, normalized bool, count int, err error) {
+	resp, err := i.request(map[string]any{"store": map[string]any{"action": "stats"}})
+	if err != nil {
+		return "", false, 0, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return resp.Metric, resp.Normalized, resp.Count, nil
+}
+
+// RecordCollectionModel records the embedding model with the chroma collection
+func (i *RunningIndexer) RecordCollectionModel(model string) error {
+	_, err := i.request(map[string]any{"store": map[string]any{"action": "record_model", "model": model}})
+	if err != nil {
+		return fmt.Errorf("failed to record model: %w", err)
+	}
+	return nil
+}
+
+// CheckStore looks for corruptions of the chroma data, left by hard kills of previous runs, returns the problems found
+func (i *RunningIndexer) CheckStore() ([]string, error) {
+	resp, err := i.request(map[string]any{"store": map[string]any{"action": "check"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check store: %w", err)
+	}
+	return resp.Problems, nil
+}
+
+// ResetStore recreates the chroma collection, dropping all its records
+func (i *RunningIndexer) ResetStore() error {
+	_, err := i.request(map[string]any{"store": map[string]any{"action": "reset"}})
+	if err != nil {
+		return fmt.Errorf("failed to reset store: %w", err)
+	}
+	return nil
+}
+
+// CreateCollection creates an empty collection in the chroma server
+func (i *RunningIndexer) CreateCollection(name string) error {
+	_, err := i.request(map[string]any{"inspect": map[string]any{"action": "create", "name": name}})
+	if err != nil {
+		return fmt.Errorf("failed to create collection %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropCollection deletes a collection of the chroma server, with all its records
+func (i *RunningIndexer) DropCollection(name string) error {
+	_, err := i.request(map[string]any{"inspect": map[string]any{"action": "drop", "name": name}})
+	if err != nil {
+		return fmt.Errorf("failed to drop collection %s: %w", name, err)
+	}
+	return nil
+}
+
+// Collections lists the collections of the chroma server
+func (i *RunningIndexer) Collections() ([]string, error) {
+	resp, err := i.request(map[string]any{"inspect": map[string]any{"action": "collections"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return resp.Collections, nil
+}
+
+// Peek returns at most limit raw records matching the where filter, or all of them if limit is 0
+func (i *RunningIndexer) Peek(limit int, where map[string]any) ([]RawRecord, error) {
+	resp, err := i.request(map[string]any{
+		"inspect": map[string]any{"action": "peek", "limit": limit, "where": where},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to peek records: %w", err)
+	}
+	return resp.Records, nil
+}
+
+// PeekPage returns at most limit records of the collection, after the first offset ones
+func (i *RunningIndexer) PeekPage(offset int, limit int) ([]RawRecord, error) {
+	resp, err := i.request(map[string]any{
+		"inspect": map[string]any{"action": "peek", "offset": offset, "limit": limit},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to peek records: %w", err)
+	}
+	return resp.Records, nil
+}
+
+// Delete removes the records with the given ids
+func (i *RunningIndexer) Delete(ids []string) error {
+	_, err := i.request(map[string]any{"inspect": map[string]any{"action": "delete", "ids": ids}})
+	if err != nil {
+		return fmt.Errorf("failed to delete records: %w", err)
+	}
+	return nil
+}
+
+// request sends a request and waits for its response, matched by its request id as the concurrent requests can be
+// answered in any order by the indexer
+func (i *RunningIndexer) request(payload map[string]any) (response, error) {
+	release, err := i.acquire()
+	if err != nil {
+		return response{}, err
+	}
+	defer release()
+	id, responses, err := i.pending.add()
+	if err != nil {
+		return response{}, err
+	}
+	if err := i.send(id, payload); err != nil {
+		i.pending.remove(id)
+		return response{}, err
+	}
 
 	select {
 	case <-i.ctx.Done():
-	case <-i.completionCh:
+		i.pending.remove(id)
+		return response{}, i.ctx.Err()
+	case resp, ok := <-responses:
+		if !ok {
+			i.pending.lock.Lock()
+			defer i.pending.lock.Unlock()
+			return response{}, i.pending.failure()
+		}
+		if err := resp.err(); err != nil {
+			return response{}, err
+		}
+		return resp, nil
 	}
+}
 
-	return
+// limitInFlight bounds the requests sent without response, defaultMaxInFlight if zero, unbounded if negative
+func (i *RunningIndexer) limitInFlight(requests int) {
+	if requests == 0 {
+		requests = defaultMaxInFlight
+	}
+	if requests > 0 {
+		i.inFlight = make(chan struct{}, requests)
+	}
 }
 
+// acquire waits for a slot of the requests in flight, returns the function releasing it once the response is
+// received, fails if the context is done or the indexer exits while waiting
+func (i *RunningIndexer) acquire() (func(), error) {
+	if i.inFlight == nil {
+		return func() {}, nil
+	}
+	// the model embeds slower than the requests are sent, the caller waits instead of the indexer buffering them
+	select {
+	case i.inFlight <- struct{}{}:
+		return func() { <-i.inFlight }, nil
+	case <-i.ctx.Done():
+		return nil, i.ctx.Err()
+	case <-i.exited:
+		i.pending.lock.Lock()
+		defer i.pending.lock.Unlock()
+		return nil, i.pending.failure()
+	}
+}
+
+// send writes the request identified by id as a message framed by its Content-Length, compressed if large enough and
+// accepted by the indexer
+func (i *RunningIndexer) send(id string, payload map[string]any) error {
+	payload["request_id"] = id
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// the large batches are compressed, relieving the pipe or the network from their source code
+	write := writeMessage
+	if i.compressAbove > 0 && len(bytes) > i.compressAbove && i.acceptsGzip.Load() {
+		write = writeGzipMessage
+	}
+
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+	if err := write(i.stdin, bytes); err != nil {
+		return fmt.Errorf("failed to write request to stdin: %w", err)
+	}
+	return nil
+}
+
+// WaitForCompletion waits for the indexer to acknowledge all the chunks sent by ProcessChunk, returns the first
+// failure
+func (i *RunningIndexer) WaitForCompletion() error {
+	i.logger.Trace().Msg("wait for completion of indexer")
+	i.acks.Wait()
+
+	i.ackLock.Lock()
+	defer i.ackLock.Unlock()
+	return i.ackErr
+}
+
+// Close stops accepting requests, waits for the responses of the ones already sent, up to the drain timeout, then asks
+// the indexer to exit, killing it if it does not in time
 func (i *RunningIndexer) Close() error {
 	i.logger.Trace().Msg("close indexer")
+	i.drain()
 	var errs []error
 
 	if err := i.stdin.Close(); err != nil {
 		errs = append(errs, fmt.Errorf("failed to close stdin: %w", err))
 	}
-	if err := i.command.Process.Kill(); err != nil {
-		errs = append(errs, fmt.Errorf("failed to kill process: %w", err))
+	// closing stdin asks the indexer to exit, killing it right away could interrupt a write to the store
+	if err := i.waitExit(closeTimeout); err != nil {
+		errs = append(errs, err)
 	}
 	if err := i.stdout.Close(); err != nil {
 		errs = append(errs, fmt.Errorf("failed to close stdin: %w", err))
@@ -303,6 +1325,53 @@ func (i *RunningIndexer) Close() error {
 	return errors.Join(errs...)
 }
 
+// drain refuses the next requests, and waits for the responses of the ones already sent, until the drain timeout, or
+// the indexer exits
+func (i *RunningIndexer) drain() {
+	drained, waiting := i.pending.drain()
+	if waiting == 0 || i.drainTimeout <= 0 {
+		return
+	}
+	i.logger.Debug().Int("requests", waiting).Msg("waiting for the requests sent to the indexer")
+	timer := time.NewTimer(i.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-i.exited:
+	case <-timer.C:
+		// not silently, the chunks of these requests are missing from the index
+		i.logger.Warn().
+			Int("requests", i.pending.waitingCount()).
+			Dur("timeout", i.drainTimeout).
+			Msg("indexer did not answer the requests in time, closing it anyway")
+	}
+}
+
+// waitExit waits for the process to exit, and kills it if it is still running after the timeout
+func (i *RunningIndexer) waitExit(timeout time.Duration) error {
+	// nothing to wait for when connected to an indexer service
+	if i.command == nil || i.command.Process == nil {
+		return nil
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		_, _ = i.command.Process.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+		i.logger.Warn().Msg("indexer did not exit in time, killing it")
+		if err := i.command.Process.Kill(); err != nil {
+			return fmt.Errorf("failed to kill process: %w", err)
+		}
+		return nil
+	}
+}
+
 func (i *RunningIndexer) WaitAndClose() error {
 	i.WaitForCompletion()
 	return i.Close()
@@ -310,7 +1379,9 @@ func (i *RunningIndexer) WaitAndClose() error {
 
 func buildOptions(opts ...IndexerOption) *IndexerOptions {
 	options := &IndexerOptions{
-		WorkingDirectory: "$HOME/.mm",
+		WorkingDirectory: DefaultWorkingDirectory,
+		HangTimeout:      defaultHangTimeout,
+		DrainTimeout:     defaultDrainTimeout,
 	}
 	for _, opt := range opts {
 		opt(options)
@@ -318,7 +1389,7 @@ func buildOptions(opts ...IndexerOption) *IndexerOptions {
 	return options
 }
 
-func prepareWorkingDirectoryIfNeeded(ctx context.Context, wd string) error {
+func prepareWorkingDirectoryIfNeeded(ctx context.Context, wd string, dbPath string) error {
 	logger := zerolog.Ctx(ctx)
 
 	err := ensurePathExists(wd)
@@ -326,20 +1397,26 @@ func prepareWorkingDirectoryIfNeeded(ctx context.Context, wd string) error {
 		logger.Error().Err(err).Msg("failed to ensure working directory exists")
 		return fmt.Errorf("failed to ensure working directory exists: %w", err)
 	}
-	err = ensurePathExists(filepath.Join(wd, libDirectoryName))
+	libPath := LibPath(wd)
+	err = ensurePathExists(libPath)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to ensure lib directory exists")
 		return fmt.Errorf("failed to ensure lib directory exists %w", err)
 	}
-	err = ensurePathExists(filepath.Join(wd, chromaDirectoryName))
+	// the garbage collection removes the lib directories not used for a while, left by uninstalled versions
+	now := time.Now()
+	if err = os.Chtimes(libPath, now, now); err != nil {
+		logger.Warn().Err(err).Msg("failed to mark lib directory as used")
+	}
+	err = ensurePathExists(dbPath)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to ensure database directory exists")
 		return fmt.Errorf("failed to ensure database directory exists %w", err)
 	}
 
 	// Note: in the future we could generate checksums at compile time, and embed them in the binary,
-	pythonScriptPath := filepath.Join(wd, libDirectoryName, "indexer.py")
-	pyprojectTomlPath := filepath.Join(wd, libDirectoryName, "pyproject.toml")
+	pythonScriptPath := filepath.Join(libPath, "indexer.py")
+	pyprojectTomlPath := filepath.Join(libPath, "pyproject.toml")
 	if requiresUpdate(pythonScriptPath, computeChecksum(pythonScript)) ||
 		requiresUpdate(pyprojectTomlPath, computeChecksum(pyprojectToml)) {
 		logger.Debug().Msg("updating python script")
@@ -369,11 +1446,53 @@ func prepareWorkingDirectoryIfNeeded(ctx context.Context, wd string) error {
 	return nil
 }
 
-func buildIndexerCmdArgs(wd string) []string {
-	return []string{
-		"--db-path",
-		filepath.Join(wd, chromaDirectoryName),
+func buildIndexerCmdArgs(dbPath string, chroma ChromaServer) []string {
+	var args []string
+	if chroma.Host == "" {
+		// the data of a remote server cannot be checked
+		args = append(args, "--db-path", dbPath)
+	} else {
+		args = append(args, "--host", chroma.Host)
+	}
+	if chroma.Port > 0 {
+		args = append(args, "--port", strconv.Itoa(chroma.Port))
+	}
+	if chroma.SSL {
+		args = append(args, "--ssl")
+	}
+	return args
+}
+
+// LibPath returns the directory of the python scripts and of their virtual environment in the working directory, each
+// version of the scripts has its own directory, so several versions of mm can share the working directory
+func LibPath(wd string) string {
+	return filepath.Join(wd, libDirectoryName, LibVersion())
+}
+
+// LibVersion identifies the version of the python scripts embedded in the binary
+func LibVersion() string {
+	return computeChecksum(append(slices.Clone(pythonScript), pyprojectToml...))[:libVersionLength]
+}
+
+// PrepareWorkingDirectory creates the working directory and installs the python scripts of this version of mm, as
+// done before starting an indexer
+func PrepareWorkingDirectory(ctx context.Context, wd string, dbPath string) error {
+	return prepareWorkingDirectoryIfNeeded(ctx, wd, dbPath)
+}
+
+// RequiredPython returns the versions of python supported by the scripts, as declared by their pyproject.toml
+func RequiredPython() string {
+	for _, line := range strings.Split(string(pyprojectToml), "\n") {
+		if value, found := strings.CutPrefix(line, "requires-python"); found {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value), "=")), `"`)
+		}
 	}
+	return ""
+}
+
+// ChromaPath returns the directory of the chroma data in the working directory
+func ChromaPath(wd string) string {
+	return filepath.Join(wd, chromaDirectoryName)
 }
 
 func ensurePathExists(path string) error {
@@ -393,6 +1512,25 @@ func requiresUpdate(path string, expectedSum string) bool {
 		// the file does not exist, we need to update
 		return true
 	}
+	if string(content) != expectedSum {
+		return true
+	}
 
-	return string(content) != expectedSum
+	// the file itself is checked too, a stale script left with a fresh checksum would not speak the same protocol
+	content, err = os.ReadFile(path)
+	return err != nil || computeChecksum(content) != expectedSum
+}
+
+// protocolMismatch explains how to get an indexer speaking the protocol of mm, cmd is nil for an indexer service
+func protocolMismatch(cmd *exec.Cmd, announced int) error {
+	if cmd == nil {
+		return fmt.Errorf(
+			"%w: the indexer service speaks version %d of the protocol, mm speaks version %d, restart the service with this version of mm",
+			ErrProtocolMismatch, announced, protocolVersion,
+		)
+	}
+	return fmt.Errorf(
+		"%w: the python indexer in %s speaks version %d of the protocol, mm speaks version %d, remove the directory to reinstall it",
+		ErrProtocolMismatch, cmd.Dir, announced, protocolVersion,
+	)
 }
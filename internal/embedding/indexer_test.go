@@ -0,0 +1,568 @@
+package embedding
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildIndexerCmdArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		chroma ChromaServer
+		want   []string
+	}{
+		{
+			name: "it should check the data of the local server",
+			want: []string{"--db-path", "/home/mm/.mm/chroma"},
+		},
+		{
+			name:   "it should check the data of a local server on another port",
+			chroma: ChromaServer{Port: 8001},
+			want:   []string{"--db-path", "/home/mm/.mm/chroma", "--port", "8001"},
+		},
+		{
+			name:   "it should connect to a remote server without checking its data",
+			chroma: ChromaServer{Host: "chroma.internal", Port: 443, SSL: true, Token: "secret"},
+			want:   []string{"--host", "chroma.internal", "--port", "443", "--ssl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			args := buildIndexerCmdArgs("/home/mm/.mm/chroma", tt.chroma)
+
+			// THEN
+			assert.Equal(t, tt.want, args)
+		})
+	}
+}
+
+// pipeIndexer runs an indexer answering each request with the response returned by respond, nil to not answer,
+// the indexer exits once its input is closed or exit is
+func pipeIndexer(t *testing.T, respond func(id string, request map[string]any) map[string]any) (*RunningIndexer, chan struct{}) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	exit := make(chan struct{})
+	go func() {
+		<-exit
+		_ = stdoutWriter.Close()
+	}()
+	go func() {
+		_ = writeMessage(stdoutWriter, []byte(`{"status": "READY", "protocol": 2}`))
+		reader := bufio.NewReader(stdinReader)
+		var lock sync.Mutex
+		for {
+			message, err := readMessage(reader)
+			if err != nil {
+				return
+			}
+			var request map[string]any
+			require.NoError(t, json.Unmarshal(message, &request))
+			id := request["request_id"].(string)
+			go func() {
+				resp := respond(id, request)
+				if resp == nil {
+					return
+				}
+				resp["request_id"] = id
+				bytes, _ := json.Marshal(resp)
+				lock.Lock()
+				defer lock.Unlock()
+				_ = writeMessage(stdoutWriter, bytes)
+			}()
+		}
+	}()
+	indexer := initRunningIndexer(context.Background(), nil, stdinWriter, stdoutReader, io.NopCloser(strings.NewReader("✓ a log line\n")))
+	go func() {
+		for range indexer.Events() {
+		}
+	}()
+	return indexer, exit
+}
+
+func TestRunningIndexer_Request(t *testing.T) {
+	t.Run("it should match the responses to their requests", func(t *testing.T) {
+		// GIVEN
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			query := request["embed"].(map[string]any)["query"].(map[string]any)
+			text := query["text"].(string)
+			// the longer texts are answered first
+			time.Sleep(time.Duration(10-len(text)) * 5 * time.Millisecond)
+			return map[string]any{"kind": "embed", "status": "success", "embeddings": [][]float32{{float32(len(text))}}}
+		})
+		defer close(exit)
+		require.NoError(t, indexer.WaitReady())
+
+		// WHEN
+		results := make([][]float32, 5)
+		wg := sync.WaitGroup{}
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				embedding, err := indexer.EmbedQuery(Query{Text: strings.Repeat("a", i+1)})
+				assert.NoError(t, err)
+				results[i] = embedding
+			}(i)
+		}
+		wg.Wait()
+
+		// THEN
+		for i, embedding := range results {
+			assert.Equal(t, []float32{float32(i + 1)}, embedding)
+		}
+	})
+
+	t.Run("it should return the error of the indexer", func(t *testing.T) {
+		// GIVEN
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			return map[string]any{"kind": "store", "status": "error", "error": "collection not found", "code": "store"}
+		})
+		defer close(exit)
+
+		// WHEN
+		err := indexer.ResetStore()
+
+		// THEN
+		assert.EqualError(t, err, "failed to reset store: collection not found (store)")
+		var indexerErr *IndexerError
+		require.ErrorAs(t, err, &indexerErr)
+		assert.Equal(t, StoreError, indexerErr.Code)
+	})
+
+	t.Run("it should fail the waiting requests when the indexer exits", func(t *testing.T) {
+		// GIVEN
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			return nil
+		})
+		require.NoError(t, indexer.WaitReady())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			close(exit)
+		}()
+
+		// WHEN
+		_, _, err := indexer.Stats()
+		_, _, errAfterExit := indexer.Stats()
+
+		// THEN
+		assert.ErrorIs(t, err, errIndexerExited)
+		assert.ErrorIs(t, errAfterExit, errIndexerExited)
+	})
+}
+
+func TestRunningIndexer_WaitForCompletion(t *testing.T) {
+	// GIVEN
+	var indexed atomic.Int32
+	indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+		chunks := request["chunks"].([]any)
+		if chunks[0].(map[string]any)["id"] == "broken" {
+			return map[string]any{"kind": "index", "status": "error", "error": "surrogates not allowed", "code": "encoding"}
+		}
+		time.Sleep(10 * time.Millisecond)
+		indexed.Add(int32(len(chunks)))
+		return map[string]any{"kind": "index", "status": "success", "indexed_count": len(chunks)}
+	})
+	defer close(exit)
+
+	// WHEN
+	require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: "a"}, {Id: "b"}}))
+	require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: "broken"}}))
+	require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: "c"}}))
+	err := indexer.WaitForCompletion()
+
+	// THEN
+	assert.EqualError(t, err, "failed to index chunks: surrogates not allowed (encoding)")
+	var indexerErr *IndexerError
+	require.ErrorAs(t, err, &indexerErr)
+	assert.Equal(t, EncodingError, indexerErr.Code)
+	assert.Equal(t, int32(3), indexed.Load(), "it should wait for all the chunks to be acknowledged")
+}
+
+func TestRunningIndexer_MaxInFlight(t *testing.T) {
+	// GIVEN
+	var inFlight, maxInFlight atomic.Int32
+	indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+		current := inFlight.Add(1)
+		for previous := maxInFlight.Load(); current > previous && !maxInFlight.CompareAndSwap(previous, current); {
+			previous = maxInFlight.Load()
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+		return map[string]any{"kind": "index", "status": "success", "indexed_count": 1}
+	})
+	defer close(exit)
+	indexer.limitInFlight(2)
+
+	// WHEN
+	for i := range 6 {
+		require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: strconv.Itoa(i)}}))
+	}
+	err := indexer.WaitForCompletion()
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), maxInFlight.Load())
+}
+
+func TestRunningIndexer_Close(t *testing.T) {
+	t.Run("it should wait for the chunks already sent", func(t *testing.T) {
+		// GIVEN
+		var indexed atomic.Int32
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			time.Sleep(20 * time.Millisecond)
+			indexed.Add(int32(len(request["chunks"].([]any))))
+			return map[string]any{"kind": "index", "status": "success", "indexed_count": 1}
+		})
+		defer close(exit)
+		indexer.drainTimeout = time.Second
+		require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: "a"}, {Id: "b"}}))
+		require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: "c"}}))
+
+		// WHEN
+		err := indexer.Close()
+
+		// THEN
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), indexed.Load())
+		assert.NoError(t, indexer.WaitForCompletion())
+		assert.ErrorIs(t, indexer.ProcessChunk([]code.Chunk{{Id: "d"}}), ErrIndexerClosing)
+	})
+
+	t.Run("it should close the indexer once the drain timeout is over", func(t *testing.T) {
+		// GIVEN
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			return nil
+		})
+		defer close(exit)
+		indexer.drainTimeout = 20 * time.Millisecond
+		require.NoError(t, indexer.ProcessChunk([]code.Chunk{{Id: "a"}}))
+
+		// WHEN
+		start := time.Now()
+		err := indexer.Close()
+
+		// THEN
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestRunningIndexer_Watch(t *testing.T) {
+	t.Run("it should kill the indexer once it stops sending heartbeats", func(t *testing.T) {
+		// GIVEN
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			return nil
+		})
+		defer close(exit)
+		require.NoError(t, indexer.WaitReady())
+		indexer.lastHeartbeat.Store(time.Now().UnixNano())
+		indexer.watch(40 * time.Millisecond)
+
+		// WHEN
+		_, _, err := indexer.Stats()
+
+		// THEN
+		assert.ErrorIs(t, err, errIndexerExited)
+	})
+
+	t.Run("it should not watch an indexer not sending heartbeats", func(t *testing.T) {
+		// GIVEN
+		indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+			time.Sleep(80 * time.Millisecond)
+			return map[string]any{"kind": "stats", "status": "success", "count": 3}
+		})
+		defer close(exit)
+		indexer.watch(20 * time.Millisecond)
+
+		// WHEN
+		count, _, err := indexer.Stats()
+
+		// THEN
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+}
+
+func TestRunningIndexer_WaitReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		ready   func(w io.Writer)
+		wantErr string
+	}{
+		{
+			name: "it should refuse an indexer speaking another version of the protocol",
+			ready: func(w io.Writer) {
+				_ = writeMessage(w, []byte(`{"status": "READY", "protocol": 3}`))
+			},
+			wantErr: "the indexer service speaks version 3 of the protocol, mm speaks version 2",
+		},
+		{
+			name: "it should refuse an indexer writing a message per line",
+			ready: func(w io.Writer) {
+				_, _ = fmt.Fprintln(w, `{"status": "READY", "protocol": 1}`)
+			},
+			wantErr: "the indexer service speaks version 1 of the protocol, mm speaks version 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			stdinReader, stdinWriter := io.Pipe()
+			defer func() { _ = stdinReader.Close() }()
+			stdoutReader, stdoutWriter := io.Pipe()
+			defer func() { _ = stdoutWriter.Close() }()
+			go tt.ready(stdoutWriter)
+			indexer := initRunningIndexer(context.Background(), nil, stdinWriter, stdoutReader, io.NopCloser(strings.NewReader("")))
+
+			// WHEN
+			err := indexer.WaitReady()
+			_, _, errRequest := indexer.Stats()
+
+			// THEN
+			assert.ErrorIs(t, err, ErrProtocolMismatch)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.ErrorIs(t, errRequest, ErrProtocolMismatch)
+		})
+	}
+}
+
+func TestRunningIndexer_Device(t *testing.T) {
+	tests := []struct {
+		name       string
+		ready      string
+		wantDevice string
+	}{
+		{
+			name:       "it should record the device announced by the indexer",
+			ready:      `{"status": "READY", "protocol": 2, "device": "cuda", "devices": ["cpu", "cuda"]}`,
+			wantDevice: "cuda",
+		},
+		{
+			name:       "it should not know the device of an indexer without model",
+			ready:      `{"status": "READY", "protocol": 2}`,
+			wantDevice: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			stdinReader, stdinWriter := io.Pipe()
+			defer func() { _ = stdinReader.Close() }()
+			stdoutReader, stdoutWriter := io.Pipe()
+			defer func() { _ = stdoutWriter.Close() }()
+			go func() {
+				_ = writeMessage(stdoutWriter, []byte(tt.ready))
+			}()
+			indexer := initRunningIndexer(context.Background(), nil, stdinWriter, stdoutReader, io.NopCloser(strings.NewReader("")))
+
+			// WHEN
+			require.NoError(t, indexer.WaitReady())
+
+			// THEN
+			assert.Equal(t, tt.wantDevice, indexer.Device())
+		})
+	}
+}
+
+func TestRequiresUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		checksum string
+		want     bool
+	}{
+		{
+			name:     "it should keep an up to date script",
+			script:   "print('v2')",
+			checksum: computeChecksum([]byte("print('v2')")),
+			want:     false,
+		},
+		{
+			name:     "it should update a script with another checksum",
+			script:   "print('v1')",
+			checksum: computeChecksum([]byte("print('v1')")),
+			want:     true,
+		},
+		{
+			name:     "it should update a stale script left with a fresh checksum",
+			script:   "print('v1')",
+			checksum: computeChecksum([]byte("print('v2')")),
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			path := filepath.Join(t.TempDir(), "indexer.py")
+			require.NoError(t, os.WriteFile(path, []byte(tt.script), 0644))
+			require.NoError(t, os.WriteFile(path+".sha256", []byte(tt.checksum), 0644))
+
+			// WHEN
+			update := requiresUpdate(path, computeChecksum([]byte("print('v2')")))
+
+			// THEN
+			assert.Equal(t, tt.want, update)
+		})
+	}
+}
+
+func TestIndexerCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		args     []string
+		wantPath string
+		wantArgs []string
+	}{
+		{
+			name:     "it should run the embedded script with another interpreter",
+			command:  "/opt/venv/bin/python",
+			wantPath: "/opt/venv/bin/python",
+			wantArgs: []string{"/opt/venv/bin/python", "indexer.py", "--embed-only"},
+		},
+		{
+			name:     "it should run a script of its own",
+			command:  "/opt/venv/bin/python",
+			args:     []string{"-X", "utf8", "$MM_TEST_SCRIPTS/indexer.py"},
+			wantPath: "/opt/venv/bin/python",
+			wantArgs: []string{"/opt/venv/bin/python", "-X", "utf8", "/srv/scripts/indexer.py", "--embed-only"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			t.Setenv("MM_TEST_SCRIPTS", "/srv/scripts")
+			options := &IndexerOptions{}
+			for _, opt := range []IndexerOption{WithWorkingDirectory(t.TempDir()), WithEmbedOnly(), WithCommand(tt.command, tt.args...)} {
+				opt(options)
+			}
+
+			// WHEN
+			cmd, err := indexerCommand(context.Background(), options)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPath, cmd.Path)
+			assert.Equal(t, tt.wantArgs, cmd.Args)
+		})
+	}
+}
+
+func TestRequiredPython(t *testing.T) {
+	t.Run("it should read the python versions of the pyproject", func(t *testing.T) {
+		// WHEN
+		required := RequiredPython()
+
+		// THEN
+		assert.Equal(t, ">=3.13", required)
+	})
+}
+
+func TestRunningIndexer_Compression(t *testing.T) {
+	tests := []struct {
+		name          string
+		compression   string
+		compressAbove int
+		wantEncoding  string
+	}{
+		{
+			name:          "it should compress the large requests when the indexer accepts it",
+			compression:   `["gzip"]`,
+			compressAbove: 1024,
+			wantEncoding:  "gzip",
+		},
+		{
+			name:          "it should not compress the requests of an indexer not accepting it",
+			compression:   `[]`,
+			compressAbove: 1024,
+		},
+		{
+			name:        "it should not compress the requests without threshold",
+			compression: `["gzip"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			stdinReader, stdinWriter := io.Pipe()
+			stdoutReader, stdoutWriter := io.Pipe()
+			defer func() { _ = stdoutWriter.Close() }()
+			encodings := make(chan string, 1)
+			go func() {
+				_ = writeMessage(stdoutWriter, []byte(`{"status": "READY", "protocol": 2, "compression": `+tt.compression+`}`))
+				reader := bufio.NewReader(stdinReader)
+				// the headers are read before the message, to tell its encoding
+				header, _ := reader.Peek(64)
+				encoding := ""
+				if strings.Contains(string(header), "Content-Encoding: gzip") {
+					encoding = "gzip"
+				}
+				message, err := readMessage(reader)
+				require.NoError(t, err)
+				encodings <- encoding
+				_ = writeMessage(stdoutWriter, fmt.Appendf(nil, `{"request_id": "%s", "kind": "embed", "status": "success", "embeddings": [[1]]}`, requestID(message)))
+			}()
+			indexer := initRunningIndexer(context.Background(), nil, stdinWriter, stdoutReader, io.NopCloser(strings.NewReader("")))
+			indexer.compressAbove = tt.compressAbove
+			require.NoError(t, indexer.WaitReady())
+
+			// WHEN
+			_, err := indexer.EmbedDocuments([]code.Chunk{{Id: "a", Content: strings.Repeat("func main() {}\n", 1000)}})
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEncoding, <-encodings)
+		})
+	}
+}
+
+func TestRunningIndexer_Progress(t *testing.T) {
+	// GIVEN
+	stdinReader, stdinWriter := io.Pipe()
+	defer func() { _ = stdinReader.Close() }()
+	stdoutReader, stdoutWriter := io.Pipe()
+	indexer := initRunningIndexer(context.Background(), nil, stdinWriter, stdoutReader, io.NopCloser(strings.NewReader("")))
+
+	// WHEN
+	_ = writeMessage(stdoutWriter, []byte(`{"status": "READY", "protocol": 2}`))
+	_ = writeMessage(stdoutWriter, []byte(`{"status": "PROGRESS", "embedded": 256, "stored": 0, "per_second": 80.5}`))
+	_ = writeMessage(stdoutWriter, []byte(`{"status": "PROGRESS", "embedded": 512, "stored": 256, "per_second": 95}`))
+	_ = stdoutWriter.Close()
+	<-indexer.exited
+
+	// THEN
+	var reported []IndexerProgress
+	for progress := range indexer.Progress() {
+		reported = append(reported, progress)
+	}
+	assert.Equal(t, []IndexerProgress{{Embedded: 512, Stored: 256, PerSecond: 95}}, reported, "it should only keep the last progress")
+}
+
+func TestQuery_MarshalJSON(t *testing.T) {
+	// GIVEN
+	zero := 0.0
+	query := Query{Text: "abc", NResults: 3, Like: "def", LikeWeight: &zero}
+
+	// WHEN
+	content, err := json.Marshal(query)
+
+	// THEN
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "abc", "n_results": 3, "like": "def", "like_weight": 0}`, string(content))
+}
@@ -0,0 +1,95 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+// defaultLikeWeight is the weight of the example of a query when it is not set, the same as the python indexer
+const defaultLikeWeight = 0.5
+
+// instruction is prepended to the embedded texts, some models are trained with a prefix telling the queries from the
+// documents
+type instruction struct {
+	query    string
+	document string
+}
+
+// known instruction templates, matched against the lower-cased model name, first match wins, the same as the ones of
+// the python indexer
+var instructions = []struct {
+	pattern     string
+	instruction instruction
+}{
+	{"e5-", instruction{query: "query: ", document: "passage: "}},
+	{"bge-", instruction{query: "Represent this sentence for searching relevant passages: "}},
+	{"mxbai-embed", instruction{query: "Represent this sentence for searching relevant passages: "}},
+	{"nomic-embed", instruction{query: "search_query: ", document: "search_document: "}},
+}
+
+// instructionFor returns the instruction template known for the model, none if it is not known
+func instructionFor(model string) instruction {
+	for _, known := range instructions {
+		if strings.Contains(strings.ToLower(model), known.pattern) {
+			return known.instruction
+		}
+	}
+	return instruction{}
+}
+
+// documentText returns the text embedded for the chunk, the context lines are embedded with the content
+func (i instruction) documentText(chunk code.Chunk) string {
+	return i.document + strings.Join(append(slices.Clone(chunk.Context), chunk.Content), "\n")
+}
+
+// queryTexts returns the texts embedded for the query, its text and its example, with the weights averaging their
+// embeddings
+func (i instruction) queryTexts(query Query) ([]string, []float64, error) {
+	var (
+		texts   []string
+		weights []float64
+	)
+	likeWeight := defaultLikeWeight
+	if query.LikeWeight != nil {
+		likeWeight = *query.LikeWeight
+	}
+	if query.Text != "" {
+		texts = append(texts, i.query+query.Text)
+		weights = append(weights, 1-likeWeight)
+	}
+	if query.Like != "" {
+		texts = append(texts, i.query+query.Like)
+		weights = append(weights, likeWeight)
+	}
+	if len(texts) == 0 {
+		return nil, nil, errors.New("failed to embed query: the query requires a text or an example")
+	}
+	return texts, weights, nil
+}
+
+// average returns the weighted average of the embeddings, which must have the same dimensions
+func average(embeddings [][]float32, weights []float64) ([]float32, error) {
+	if len(embeddings) == 1 {
+		return embeddings[0], nil
+	}
+	sum := make([]float64, len(embeddings[0]))
+	total := 0.0
+	for i, embedding := range embeddings {
+		if len(embedding) != len(sum) {
+			return nil, fmt.Errorf("failed to average embeddings of %d and %d dimensions", len(sum), len(embedding))
+		}
+		for j, value := range embedding {
+			sum[j] += weights[i] * float64(value)
+		}
+		total += weights[i]
+	}
+	averaged := make([]float32, len(sum))
+	for j, value := range sum {
+		averaged[j] = float32(value / total)
+	}
+	return averaged, nil
+}
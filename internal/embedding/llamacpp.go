@@ -0,0 +1,320 @@
+package embedding
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultLlamaCppModel is the GGUF model used with llama.cpp if none is selected, downloaded on first use
+	DefaultLlamaCppModel = "hf:nomic-ai/nomic-embed-text-v1.5-GGUF/nomic-embed-text-v1.5.Q8_0.gguf"
+	// DefaultLlamaServer is the server of llama.cpp, looked up in the PATH
+	DefaultLlamaServer = "llama-server"
+	// defaultLlamaCppContext is the context of the default model, the texts beyond it are truncated
+	defaultLlamaCppContext = 2048
+
+	// llamaCppStartTimeout is long, the server loads the whole model before answering
+	llamaCppStartTimeout = 2 * time.Minute
+	llamaCppStopTimeout  = 5 * time.Second
+	// llamaCppOutputLines are the last lines of the output of the server kept to explain its failures
+	llamaCppOutputLines = 5
+)
+
+type (
+	LlamaCppOptions struct {
+		// Server is the path of the llama-server binary
+		Server string
+		// ModelsDir is the directory the models are downloaded into
+		ModelsDir string
+		// Threads used by the model, the default of llama.cpp if zero
+		Threads int
+		// ContextSize is the context of the model, in tokens, the longer texts are truncated
+		ContextSize int
+		// GPULayers is the number of layers offloaded to the GPU, none if zero
+		GPULayers int
+	}
+
+	LlamaCppOption func(*LlamaCppOptions)
+
+	// LlamaCpp computes the embeddings with a GGUF model, served by a llama.cpp server started on first use, and
+	// stopped when closed, without any python
+	LlamaCpp struct {
+		ctx     context.Context
+		model   string
+		options *LlamaCppOptions
+
+		start    sync.Once
+		startErr error
+		cmd      *exec.Cmd
+		exited   chan struct{}
+		// hosted calls the server once started
+		hosted atomic.Pointer[Hosted]
+	}
+
+	// llamaCppProvider calls the OpenAI compatible embeddings API of llama.cpp
+	llamaCppProvider struct {
+		openAIProvider
+		contextSize int
+	}
+)
+
+// WithLlamaServer sets the path of the llama-server binary
+func WithLlamaServer(server string) LlamaCppOption {
+	return func(opts *LlamaCppOptions) {
+		opts.Server = server
+	}
+}
+
+// WithModelsDir sets the directory the models are downloaded into
+func WithModelsDir(dir string) LlamaCppOption {
+	return func(opts *LlamaCppOptions) {
+		opts.ModelsDir = dir
+	}
+}
+
+// WithLlamaCppThreads sets the number of threads used by the model
+func WithLlamaCppThreads(threads int) LlamaCppOption {
+	return func(opts *LlamaCppOptions) {
+		opts.Threads = threads
+	}
+}
+
+// WithContextSize sets the context of the model, the default one if not positive
+func WithContextSize(size int) LlamaCppOption {
+	return func(opts *LlamaCppOptions) {
+		if size > 0 {
+			opts.ContextSize = size
+		}
+	}
+}
+
+// WithGPULayers sets the number of layers offloaded to the GPU
+func WithGPULayers(layers int) LlamaCppOption {
+	return func(opts *LlamaCppOptions) {
+		opts.GPULayers = layers
+	}
+}
+
+// NewLlamaCpp creates an embedder using the GGUF model, a path, an url, or a hf:owner/repository/file reference to
+// Hugging Face, the model is downloaded and the server started on first use
+func NewLlamaCpp(ctx context.Context, model string, opts ...LlamaCppOption) *LlamaCpp {
+	options := &LlamaCppOptions{
+		Server:      DefaultLlamaServer,
+		ContextSize: defaultLlamaCppContext,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &LlamaCpp{ctx: ctx, model: model, options: options}
+}
+
+// WaitReady downloads the model if needed, and starts the server, returns once it answers
+func (l *LlamaCpp) WaitReady() error {
+	l.start.Do(func() {
+		l.startErr = l.run()
+	})
+	return l.startErr
+}
+
+// EmbedDocuments computes the embeddings of the chunks, the context lines are embedded with the content
+func (l *LlamaCpp) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	if err := l.WaitReady(); err != nil {
+		return nil, err
+	}
+	return l.hosted.Load().EmbedDocuments(chunks)
+}
+
+// EmbedQuery computes the embedding of the query, the ones of the text and of the example are averaged, weighted by
+// the like weight of the query
+func (l *LlamaCpp) EmbedQuery(query Query) ([]float32, error) {
+	if err := l.WaitReady(); err != nil {
+		return nil, err
+	}
+	return l.hosted.Load().EmbedQuery(query)
+}
+
+// Dimensions of the embeddings of the model, 0 until the first one is computed
+func (l *LlamaCpp) Dimensions() int {
+	if hosted := l.hosted.Load(); hosted != nil {
+		return hosted.Dimensions()
+	}
+	return 0
+}
+
+// ModelID identifies the GGUF model, as it was selected
+func (l *LlamaCpp) ModelID() string {
+	return "llamacpp/" + l.model
+}
+
+// Close stops the server, killed if it does not stop in time
+func (l *LlamaCpp) Close() error {
+	if hosted := l.hosted.Load(); hosted != nil {
+		_ = hosted.Close()
+	}
+	if l.cmd == nil || l.cmd.Process == nil {
+		return nil
+	}
+	select {
+	case <-l.exited:
+		return nil
+	default:
+	}
+	if err := l.cmd.Process.Signal(os.Interrupt); err != nil {
+		// not supported on windows
+		_ = l.cmd.Process.Kill()
+	}
+	select {
+	case <-l.exited:
+	case <-time.After(llamaCppStopTimeout):
+		_ = l.cmd.Process.Kill()
+		<-l.exited
+	}
+	return nil
+}
+
+func (l *LlamaCpp) run() error {
+	path, err := FetchModel(l.ctx, l.model, l.options.ModelsDir)
+	if err != nil {
+		return err
+	}
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+
+	// the batches hold whole texts, embeddings are not computed across batches
+	contextSize := strconv.Itoa(l.options.ContextSize)
+	args := []string{
+		"--model", path,
+		"--embeddings",
+		"--host", "127.0.0.1",
+		"--port", strconv.Itoa(port),
+		"--ctx-size", contextSize,
+		"--batch-size", contextSize,
+		"--ubatch-size", contextSize,
+	}
+	if l.options.Threads > 0 {
+		args = append(args, "--threads", strconv.Itoa(l.options.Threads))
+	}
+	if l.options.GPULayers > 0 {
+		args = append(args, "--n-gpu-layers", strconv.Itoa(l.options.GPULayers))
+	}
+	l.cmd = exec.CommandContext(l.ctx, l.options.Server, args...)
+	output, err := l.cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create llama.cpp output pipe: %w", err)
+	}
+	l.cmd.Stdout = l.cmd.Stderr
+
+	logger := zerolog.Ctx(l.ctx).With().Str("process", "llama.cpp").Logger()
+	logger.Debug().Str("model", path).Int("port", port).Msg("starting llama.cpp server")
+	if err := l.cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("%s not found, install llama.cpp or set indexer.llamacpp.server: %w", l.options.Server, err)
+		}
+		return fmt.Errorf("failed to start llama.cpp server: %w", err)
+	}
+
+	var (
+		lock sync.Mutex
+		last []string
+	)
+	l.exited = make(chan struct{})
+	go func() {
+		defer close(l.exited)
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			logger.Trace().Msg(scanner.Text())
+			lock.Lock()
+			last = append(last, scanner.Text())
+			if len(last) > llamaCppOutputLines {
+				last = last[1:]
+			}
+			lock.Unlock()
+		}
+		_ = l.cmd.Wait()
+	}()
+
+	baseURL := "http://127.0.0.1:" + strconv.Itoa(port)
+	if err := l.waitHealthy(baseURL); err != nil {
+		_ = l.Close()
+		lock.Lock()
+		defer lock.Unlock()
+		return fmt.Errorf("llama.cpp server failed to start: %w: %s", err, strings.Join(last, "\n"))
+	}
+	l.hosted.Store(newHosted(
+		l.ctx,
+		llamaCppProvider{contextSize: l.options.ContextSize},
+		baseURL+"/v1",
+		"",
+		strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		WithHostedRetries(1, time.Second),
+	))
+	logger.Debug().Msg("llama.cpp server ready")
+	return nil
+}
+
+// waitHealthy polls the health endpoint until the model is loaded, or the server exits
+func (l *LlamaCpp) waitHealthy(baseURL string) error {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.After(llamaCppStartTimeout)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.exited:
+			return fmt.Errorf("the server exited")
+		case <-deadline:
+			return fmt.Errorf("the server did not load the model within %s", llamaCppStartTimeout)
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		case <-ticker.C:
+		}
+		resp, err := client.Get(baseURL + "/health")
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+		// 503 while the model is loading
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+	}
+}
+
+func (llamaCppProvider) name() string {
+	return "llama.cpp"
+}
+
+// limits keep each text within the context of the model, the texts are truncated at maxCharsPerToken characters per
+// token by the hosted embedder, half the context is about the context at charsPerToken
+func (p llamaCppProvider) limits() hostedLimits {
+	return hostedLimits{maxTexts: 32, maxTextTokens: p.contextSize * charsPerToken / maxCharsPerToken}
+}
+
+// freePort returns a port of the loopback interface not used at the moment
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
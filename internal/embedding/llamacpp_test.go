@@ -0,0 +1,88 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLlamaServerVariable runs the test binary as a fake llama-server, see TestFakeLlamaServer
+const fakeLlamaServerVariable = "MM_FAKE_LLAMA_SERVER"
+
+// TestFakeLlamaServer is not a test, it serves the embeddings API of llama-server on the port of its arguments when
+// the test binary is started by the tests as the server
+func TestFakeLlamaServer(t *testing.T) {
+	if os.Getenv(fakeLlamaServerVariable) == "" {
+		t.Skip("only run as the fake llama-server")
+	}
+	args := os.Args[slices.Index(os.Args, "--")+1:]
+	port := args[slices.Index(args, "--port")+1]
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var request openAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		var response openAIResponse
+		for i, input := range request.Input {
+			response.Data = append(response.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{float32(len(input)), 1}})
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	_ = http.ListenAndServe("127.0.0.1:"+port, mux)
+	os.Exit(0)
+}
+
+// fakeLlamaServer returns a script starting the test binary as the fake llama-server
+func fakeLlamaServer(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake llama-server is a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "llama-server")
+	content := "#!/bin/sh\n" + fakeLlamaServerVariable + "=1 exec " + os.Args[0] + " -test.run=TestFakeLlamaServer -- \"$@\"\n"
+	require.NoError(t, os.WriteFile(script, []byte(content), 0755))
+	return script
+}
+
+func TestLlamaCpp_EmbedDocuments(t *testing.T) {
+	// GIVEN
+	model := filepath.Join(t.TempDir(), "nomic-embed-text-v1.5.Q8_0.gguf")
+	require.NoError(t, os.WriteFile(model, []byte("gguf"), 0644))
+	llamaCpp := NewLlamaCpp(context.Background(), model, WithLlamaServer(fakeLlamaServer(t)))
+	defer func() {
+		_ = llamaCpp.Close()
+	}()
+
+	// WHEN
+	embeddings, err := llamaCpp.EmbedDocuments([]code.Chunk{{Content: "a"}, {Content: "bb"}})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{18, 1}, {19, 1}}, embeddings, "it should prefix the documents of the nomic model")
+}
+
+func TestLlamaCpp_MissingServer(t *testing.T) {
+	// GIVEN
+	model := filepath.Join(t.TempDir(), "local.gguf")
+	require.NoError(t, os.WriteFile(model, []byte("gguf"), 0644))
+	llamaCpp := NewLlamaCpp(context.Background(), model, WithLlamaServer("mm-missing-llama-server"))
+
+	// WHEN
+	_, err := llamaCpp.EmbedQuery(Query{Text: "retry the payment"})
+
+	// THEN
+	assert.ErrorContains(t, err, "install llama.cpp")
+	assert.NoError(t, llamaCpp.Close())
+}
@@ -0,0 +1,134 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// huggingFacePrefix references a file of a Hugging Face repository, as hf:owner/repository/file
+const huggingFacePrefix = "hf:"
+
+// linkedETagHeader holds the sha256 of the files stored with git lfs by Hugging Face
+const linkedETagHeader = "X-Linked-Etag"
+
+// sha256Hex matches a sha256 in hexadecimal, the etags of the other files being the sha1 of their git blob
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// huggingFaceURL is the base url of the files of the Hugging Face repositories, changed by the tests
+var huggingFaceURL = "https://huggingface.co"
+
+// FetchModel returns the local path of the model, a path is used as is, an url or a hf:owner/repository/file
+// reference is downloaded into a directory of dir keyed by its url on first use, and kept there for the next runs
+func FetchModel(ctx context.Context, model string, dir string) (string, error) {
+	location := model
+	if reference, found := strings.CutPrefix(model, huggingFacePrefix); found {
+		parts := strings.SplitN(reference, "/", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return "", fmt.Errorf("invalid model %s, expected %sowner/repository/file", model, huggingFacePrefix)
+		}
+		location = fmt.Sprintf("%s/%s/%s/resolve/main/%s", huggingFaceURL, parts[0], parts[1], parts[2])
+	}
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		if _, err := os.Stat(location); err != nil {
+			return "", fmt.Errorf("model %s not found: %w", location, err)
+		}
+		return location, nil
+	}
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid model url %s: %w", location, err)
+	}
+	// keyed by the url, the files of different repositories often share their name, e.g. model.gguf
+	key := sha256.Sum256([]byte(location))
+	modelPath := filepath.Join(dir, hex.EncodeToString(key[:])[:16], path.Base(parsed.Path))
+	if _, err := os.Stat(modelPath); err == nil {
+		return modelPath, nil
+	}
+	if err := download(ctx, location, modelPath); err != nil {
+		return "", err
+	}
+	return modelPath, nil
+}
+
+// download writes the content of the url to the file, through a temporary file so an interrupted download is not
+// mistaken for the model, the size is checked against the one announced, and the sha256 against the one published by
+// Hugging Face for the files stored with git lfs
+func download(ctx context.Context, location string, file string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", location, err)
+	}
+	// the sha256 is announced by the response redirecting to the storage of the file
+	var linkedETag string
+	client := *http.DefaultClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if etag := req.Response.Header.Get(linkedETagHeader); etag != "" {
+			linkedETag = etag
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download model %s: %w", location, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download model %s: status %d", location, resp.StatusCode)
+	}
+
+	zerolog.Ctx(ctx).Info().
+		Str("url", location).
+		Int64("bytes", resp.ContentLength).
+		Str("path", file).
+		Msg("Downloading the embedding model, only on first use")
+	start := time.Now()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create models directory: %w", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create model file: %w", err)
+	}
+	if etag := resp.Header.Get(linkedETagHeader); etag != "" {
+		linkedETag = etag
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(temp, hash), resp.Body)
+	if err == nil && resp.ContentLength >= 0 && written != resp.ContentLength {
+		err = fmt.Errorf("got %d bytes, expected %d", written, resp.ContentLength)
+	}
+	expected := strings.Trim(linkedETag, `"`)
+	if actual := hex.EncodeToString(hash.Sum(nil)); err == nil && sha256Hex.MatchString(expected) && actual != expected {
+		err = fmt.Errorf("sha256 %s does not match the published %s", actual, expected)
+	}
+	err = errors.Join(err, temp.Close())
+	if err == nil {
+		err = os.Rename(temp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return fmt.Errorf("failed to download model %s: %w", location, err)
+	}
+	zerolog.Ctx(ctx).Info().Str("elapsed", fmt.Sprintf("%dms", time.Since(start).Milliseconds())).Msg("Model downloaded")
+	return nil
+}
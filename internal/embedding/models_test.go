@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchModel(t *testing.T) {
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nomic-ai/nomic-embed-text-v1.5-GGUF/resolve/main/model.gguf":
+			downloads.Add(1)
+			_, _ = w.Write([]byte("gguf"))
+		case "/other/embeddings-GGUF/resolve/main/model.gguf":
+			_, _ = w.Write([]byte("other gguf"))
+		case "/lfs/embeddings-GGUF/resolve/main/model.gguf":
+			sum := sha256.Sum256([]byte("published gguf"))
+			w.Header().Set("X-Linked-Etag", `"`+hex.EncodeToString(sum[:])+`"`)
+			_, _ = w.Write([]byte("corrupted gguf"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	previous := huggingFaceURL
+	huggingFaceURL = server.URL
+	defer func() {
+		huggingFaceURL = previous
+	}()
+
+	t.Run("it should download a model of hugging face once", func(t *testing.T) {
+		// GIVEN
+		dir := t.TempDir()
+
+		// WHEN
+		first, err := FetchModel(context.Background(), "hf:nomic-ai/nomic-embed-text-v1.5-GGUF/model.gguf", dir)
+		require.NoError(t, err)
+		second, err := FetchModel(context.Background(), "hf:nomic-ai/nomic-embed-text-v1.5-GGUF/model.gguf", dir)
+		require.NoError(t, err)
+
+		// THEN
+		assert.Equal(t, dir, filepath.Dir(filepath.Dir(first)))
+		assert.Equal(t, "model.gguf", filepath.Base(first))
+		assert.Equal(t, first, second)
+		assert.Equal(t, int32(1), downloads.Load())
+		content, err := os.ReadFile(first)
+		require.NoError(t, err)
+		assert.Equal(t, "gguf", string(content))
+	})
+
+	t.Run("it should not share the download of two repositories having the same file name", func(t *testing.T) {
+		// GIVEN
+		dir := t.TempDir()
+
+		// WHEN
+		first, err := FetchModel(context.Background(), "hf:nomic-ai/nomic-embed-text-v1.5-GGUF/model.gguf", dir)
+		require.NoError(t, err)
+		second, err := FetchModel(context.Background(), "hf:other/embeddings-GGUF/model.gguf", dir)
+		require.NoError(t, err)
+
+		// THEN
+		assert.NotEqual(t, first, second)
+		content, err := os.ReadFile(second)
+		require.NoError(t, err)
+		assert.Equal(t, "other gguf", string(content))
+	})
+
+	t.Run("it should not keep a download not matching its published sha256", func(t *testing.T) {
+		// GIVEN
+		dir := t.TempDir()
+
+		// WHEN
+		_, err := FetchModel(context.Background(), "hf:lfs/embeddings-GGUF/model.gguf", dir)
+
+		// THEN
+		assert.ErrorContains(t, err, "does not match the published")
+		matches, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+	})
+
+	t.Run("it should not keep a failed download", func(t *testing.T) {
+		// GIVEN
+		dir := t.TempDir()
+
+		// WHEN
+		_, err := FetchModel(context.Background(), server.URL+"/missing.gguf", dir)
+
+		// THEN
+		assert.ErrorContains(t, err, "status 404")
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("it should use a local model as is", func(t *testing.T) {
+		// GIVEN
+		model := filepath.Join(t.TempDir(), "local.gguf")
+		require.NoError(t, os.WriteFile(model, []byte("gguf"), 0644))
+
+		// WHEN
+		path, err := FetchModel(context.Background(), model, t.TempDir())
+
+		// THEN
+		require.NoError(t, err)
+		assert.Equal(t, model, path)
+	})
+
+	t.Run("it should reject an incomplete hugging face reference", func(t *testing.T) {
+		_, err := FetchModel(context.Background(), "hf:nomic-ai/model.gguf", t.TempDir())
+
+		assert.ErrorContains(t, err, "expected hf:owner/repository/file")
+	})
+}
@@ -0,0 +1,158 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+const (
+	// DefaultOllamaURL is the address of a local ollama server
+	DefaultOllamaURL = "http://localhost:11434"
+	// DefaultOllamaModel is the embedding model used with ollama if none is selected
+	DefaultOllamaModel = "nomic-embed-text"
+
+	// ollamaTimeout is long, the server loads the model on the first request
+	ollamaTimeout = 2 * time.Minute
+)
+
+type (
+	// Ollama computes the embeddings with the model of an ollama server, through its REST API, without any python
+	Ollama struct {
+		ctx         context.Context
+		baseURL     string
+		model       string
+		instruction instruction
+		client      *http.Client
+
+		// dimensions of the last embedding computed, the server does not tell beforehand
+		dimensions atomic.Int32
+	}
+
+	ollamaRequest struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+	}
+
+	ollamaResponse struct {
+		Embedding []float32 `json:"embedding"`
+	}
+)
+
+// NewOllama creates an embedder using the model of the ollama server, the model has to be pulled beforehand
+func NewOllama(ctx context.Context, baseURL string, model string) *Ollama {
+	return &Ollama{
+		ctx:         ctx,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		model:       model,
+		instruction: instructionFor(model),
+		client:      &http.Client{Timeout: ollamaTimeout},
+	}
+}
+
+// Model returns the name of the model of the ollama server
+func (o *Ollama) Model() string {
+	return o.model
+}
+
+// Dimensions of the embeddings of the model, 0 until the first one is computed
+func (o *Ollama) Dimensions() int {
+	return int(o.dimensions.Load())
+}
+
+// ModelID identifies the model of the ollama server
+func (o *Ollama) ModelID() string {
+	return "ollama/" + o.model
+}
+
+// EmbedDocuments computes the embeddings of the chunks, the context lines are embedded with the content
+func (o *Ollama) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	embeddings := make([][]float32, len(chunks))
+	for i, chunk := range chunks {
+		embedding, err := o.embed(o.instruction.documentText(chunk))
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chunk %s: %w", chunk.Id, err)
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+// EmbedQuery computes the embedding of the query, the ones of the text and of the example are averaged, weighted by
+// the like weight of the query
+func (o *Ollama) EmbedQuery(query Query) ([]float32, error) {
+	texts, weights, err := o.instruction.queryTexts(query)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embedding, err := o.embed(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		embeddings[i] = embedding
+	}
+	return average(embeddings, weights)
+}
+
+// WaitReady returns right away, the server loads the model on the first request
+func (o *Ollama) WaitReady() error {
+	return nil
+}
+
+// Close releases the idle connections to the server
+func (o *Ollama) Close() error {
+	o.client.CloseIdleConnections()
+	return nil
+}
+
+// embed computes the embedding of a single text
+func (o *Ollama) embed(text string) ([]float32, error) {
+	payload, err := json.Marshal(ollamaRequest{Model: o.model, Prompt: text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ollama request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodPost, o.baseURL+"/api/embeddings", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ollama request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama request failed, is the server running at %s? %w", o.baseURL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ollama response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("ollama model %s not found, pull it with: ollama pull %s", o.model, o.model)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("ollama request failed with status %d: %s", resp.StatusCode, content)
+	}
+
+	var response ollamaResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if len(response.Embedding) == 0 {
+		return nil, fmt.Errorf("ollama returned an empty embedding, is %s an embedding model?", o.model)
+	}
+	o.dimensions.Store(int32(len(response.Embedding)))
+	return response.Embedding, nil
+}
@@ -0,0 +1,114 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ollamaServer answers the embedding requests with a vector whose first value is the length of the prompt, and
+// records the prompts received
+func ollamaServer(t *testing.T, prompts *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request ollamaRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if r.URL.Path != "/api/embeddings" || request.Model != "nomic-embed-text" {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			return
+		}
+		*prompts = append(*prompts, request.Prompt)
+		_ = json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float32{float32(len(request.Prompt)), 1}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOllama_EmbedDocuments(t *testing.T) {
+	// GIVEN
+	var prompts []string
+	server := ollamaServer(t, &prompts)
+	ollama := NewOllama(context.Background(), server.URL+"/", "nomic-embed-text")
+
+	// WHEN
+	embeddings, err := ollama.EmbedDocuments([]code.Chunk{
+		{Id: "1", Content: "func a() {}", Context: []string{"fix a"}},
+		{Id: "2", Content: "func b() {}"},
+	})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, []string{"search_document: fix a\nfunc a() {}", "search_document: func b() {}"}, prompts)
+	assert.Equal(t, [][]float32{{float32(len(prompts[0])), 1}, {float32(len(prompts[1])), 1}}, embeddings)
+}
+
+func TestOllama_EmbedQuery(t *testing.T) {
+	quarter, zero := 0.25, 0.0
+	tests := []struct {
+		name    string
+		query   Query
+		prompts []string
+		want    []float32
+	}{
+		{
+			name:    "it should embed the text with the query instruction",
+			query:   Query{Text: "abc"},
+			prompts: []string{"search_query: abc"},
+			want:    []float32{17, 1},
+		},
+		{
+			name:    "it should average the text and the example with equal weights by default",
+			query:   Query{Text: "abc", Like: "abcde"},
+			prompts: []string{"search_query: abc", "search_query: abcde"},
+			want:    []float32{18, 1},
+		},
+		{
+			name:    "it should weight the example by the like weight",
+			query:   Query{Text: "abc", Like: "abcdefghijklmnopqrstu", LikeWeight: &quarter},
+			prompts: []string{"search_query: abc", "search_query: abcdefghijklmnopqrstu"},
+			want:    []float32{21.5, 1},
+		},
+		{
+			name:    "it should only use the text with a like weight of 0",
+			query:   Query{Text: "abc", Like: "abcdefghijklmnopqrstu", LikeWeight: &zero},
+			prompts: []string{"search_query: abc", "search_query: abcdefghijklmnopqrstu"},
+			want:    []float32{17, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			var prompts []string
+			server := ollamaServer(t, &prompts)
+			ollama := NewOllama(context.Background(), server.URL, "nomic-embed-text")
+
+			// WHEN
+			embedding, err := ollama.EmbedQuery(tt.query)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.prompts, prompts)
+			assert.InDeltaSlice(t, tt.want, embedding, 1e-6)
+		})
+	}
+}
+
+func TestOllama_Errors(t *testing.T) {
+	// GIVEN
+	var prompts []string
+	server := ollamaServer(t, &prompts)
+	ollama := NewOllama(context.Background(), server.URL, "missing-model")
+
+	// WHEN
+	_, chunkErr := ollama.EmbedDocuments([]code.Chunk{{Id: "1", Content: "x"}})
+	_, queryErr := ollama.EmbedQuery(Query{})
+
+	// THEN
+	assert.ErrorContains(t, chunkErr, "ollama pull missing-model")
+	assert.ErrorContains(t, queryErr, "requires a text or an example")
+}
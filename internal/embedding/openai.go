@@ -0,0 +1,73 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+)
+
+const (
+	// DefaultOpenAIURL is the base url of the OpenAI API, compatible endpoints are selected by their own base url
+	DefaultOpenAIURL = "https://api.openai.com/v1"
+	// DefaultOpenAIModel is the embedding model used with the OpenAI API if none is selected
+	DefaultOpenAIModel = "text-embedding-3-small"
+)
+
+type (
+	// openAIProvider calls the OpenAI embeddings API, or any compatible one
+	openAIProvider struct{}
+
+	openAIRequest struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+
+	openAIResponse struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+)
+
+// NewOpenAI creates an embedder using the model of the OpenAI API, or of a compatible endpoint, at baseURL
+func NewOpenAI(ctx context.Context, baseURL string, apiKey string, model string, opts ...HostedOption) *Hosted {
+	return newHosted(ctx, openAIProvider{}, baseURL, apiKey, model, opts...)
+}
+
+func (openAIProvider) name() string {
+	return "openai"
+}
+
+func (openAIProvider) path() string {
+	return "/embeddings"
+}
+
+// limits are the ones of the OpenAI API, 2048 inputs and 300K tokens per request, 8191 tokens per input, the
+// requests being kept much smaller, the compatible endpoints often accept less
+func (openAIProvider) limits() hostedLimits {
+	return hostedLimits{maxTexts: 96, maxTokens: 100_000, maxTextTokens: 8191}
+}
+
+func (openAIProvider) request(model string, texts []string, _ bool) any {
+	return openAIRequest{Model: model, Input: texts}
+}
+
+func (openAIProvider) embeddings(content []byte) ([][]float32, error) {
+	return decodeIndexedEmbeddings(content)
+}
+
+// decodeIndexedEmbeddings decodes a response of the OpenAI API, where each embedding has the index of its input
+func decodeIndexedEmbeddings(content []byte) ([][]float32, error) {
+	var response openAIResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, err
+	}
+	// the embeddings are documented to follow the inputs, the compatible endpoints may not keep the order
+	sort.Slice(response.Data, func(i, j int) bool { return response.Data[i].Index < response.Data[j].Index })
+	embeddings := make([][]float32, len(response.Data))
+	for i, data := range response.Data {
+		embeddings[i] = data.Embedding
+	}
+	return embeddings, nil
+}
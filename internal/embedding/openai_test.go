@@ -0,0 +1,213 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAIServer answers each input with a vector holding its length, in reverse order of the inputs, after failing
+// the given number of requests with the status, the batches received are recorded
+func openAIServer(t *testing.T, failures int, status int, batches *[][]string) *httptest.Server {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+			return
+		}
+		if int(requests.Add(1)) <= failures {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":"try again"}`, status)
+			return
+		}
+		var request openAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		*batches = append(*batches, request.Input)
+
+		var response openAIResponse
+		for i := len(request.Input) - 1; i >= 0; i-- {
+			response.Data = append(response.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{float32(len(request.Input[i])), 1}})
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAI_EmbedDocuments(t *testing.T) {
+	// GIVEN
+	var batches [][]string
+	server := openAIServer(t, 0, 0, &batches)
+	openAI := NewOpenAI(context.Background(), server.URL, "secret", "text-embedding-3-small", WithHostedBatchSize(2))
+
+	// WHEN
+	embeddings, err := openAI.EmbedDocuments([]code.Chunk{{Content: "a"}, {Content: "bb", Context: []string{"c"}}, {Content: "dddd"}})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "c\nbb"}, {"dddd"}}, batches)
+	assert.Equal(t, [][]float32{{1, 1}, {4, 1}, {4, 1}}, embeddings)
+	assert.Equal(t, 2, openAI.Dimensions())
+	assert.Equal(t, "openai/text-embedding-3-small", openAI.ModelID())
+}
+
+func TestOpenAI_EmbedQuery(t *testing.T) {
+	// GIVEN
+	var batches [][]string
+	server := openAIServer(t, 0, 0, &batches)
+	openAI := NewOpenAI(context.Background(), server.URL, "secret", "text-embedding-3-small")
+
+	// WHEN
+	embedding, err := openAI.EmbedQuery(Query{Text: "ab", Like: "abcdef"})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"ab", "abcdef"}}, batches, "it should embed the text and the example in a single request")
+	assert.InDeltaSlice(t, []float32{4, 1}, embedding, 1e-6)
+}
+
+func TestOpenAI_Retries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		apiKey    string
+		wantErr   string
+		wantStats HostedStats
+	}{
+		{
+			name:      "it should retry when rate limited",
+			failures:  2,
+			status:    http.StatusTooManyRequests,
+			apiKey:    "secret",
+			wantStats: HostedStats{Requests: 3, Retries: 2, RateLimited: 2},
+		},
+		{
+			name:      "it should retry when the server fails",
+			failures:  1,
+			status:    http.StatusBadGateway,
+			apiKey:    "secret",
+			wantStats: HostedStats{Requests: 2, Retries: 1},
+		},
+		{
+			name:      "it should give up after the retries",
+			failures:  4,
+			status:    http.StatusServiceUnavailable,
+			apiKey:    "secret",
+			wantErr:   "status 503",
+			wantStats: HostedStats{Requests: 4, Retries: 3},
+		},
+		{
+			name:      "it should not retry a client error",
+			failures:  1,
+			status:    http.StatusBadRequest,
+			apiKey:    "secret",
+			wantErr:   "status 400",
+			wantStats: HostedStats{Requests: 1},
+		},
+		{
+			name:      "it should not retry an invalid api key",
+			apiKey:    "wrong",
+			wantErr:   "check the api key",
+			wantStats: HostedStats{Requests: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			var batches [][]string
+			server := openAIServer(t, tt.failures, tt.status, &batches)
+			openAI := NewOpenAI(context.Background(), server.URL, tt.apiKey, "text-embedding-3-small", WithHostedRetries(3, time.Millisecond))
+
+			// WHEN
+			embeddings, err := openAI.EmbedDocuments([]code.Chunk{{Content: "a"}})
+
+			// THEN
+			assert.Equal(t, tt.wantStats, openAI.Stats())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Empty(t, batches)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, [][]float32{{1, 1}}, embeddings)
+		})
+	}
+}
+
+func TestOpenAI_RetriesFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		baseURL   func(t *testing.T) string
+		wantErr   string
+		wantStats HostedStats
+	}{
+		{
+			name: "it should retry when the server cannot be reached",
+			baseURL: func(t *testing.T) string {
+				server := httptest.NewServer(http.NotFoundHandler())
+				server.Close()
+				return server.URL
+			},
+			wantErr:   "request to",
+			wantStats: HostedStats{Requests: 4, Retries: 3},
+		},
+		{
+			name: "it should not retry an invalid response",
+			baseURL: func(t *testing.T) string {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = io.WriteString(w, `{"data": "none"}`)
+				}))
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+			wantErr:   "failed to decode openai response",
+			wantStats: HostedStats{Requests: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			openAI := NewOpenAI(context.Background(), tt.baseURL(t), "secret", "text-embedding-3-small", WithHostedRetries(3, time.Millisecond))
+
+			// WHEN
+			_, err := openAI.EmbedDocuments([]code.Chunk{{Content: "a"}})
+
+			// THEN
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantStats, openAI.Stats())
+		})
+	}
+}
+
+func TestOpenAI_RateLimit(t *testing.T) {
+	// GIVEN
+	var batches [][]string
+	server := openAIServer(t, 0, 0, &batches)
+	openAI := NewOpenAI(context.Background(), server.URL, "secret", "text-embedding-3-small", WithHostedRateLimit(0, 6000))
+
+	// WHEN
+	_, err := openAI.EmbedDocuments([]code.Chunk{{Content: strings.Repeat("a", 3*6000)}})
+	require.NoError(t, err)
+	_, err = openAI.EmbedDocuments([]code.Chunk{{Content: "a"}})
+	require.NoError(t, err)
+
+	// THEN
+	stats := openAI.Stats()
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Positive(t, stats.Throttled, "it should wait for the tokens of the first request to be refilled")
+	assert.Len(t, batches, 2)
+}
@@ -0,0 +1,92 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+type (
+	// EmbeddingProvider computes the embeddings of the chunks and of the queries with a model, the python indexer
+	// being one provider among ollama, llama.cpp, and the hosted APIs
+	EmbeddingProvider interface {
+		// EmbedDocuments computes the embeddings of the chunks, in the same order
+		EmbedDocuments(chunks []code.Chunk) ([][]float32, error)
+		// EmbedQuery computes the embedding of the query, comparable to the ones of the chunks
+		EmbedQuery(query Query) ([]float32, error)
+		// Dimensions of the embeddings, 0 until the first one is computed when the model does not tell beforehand
+		Dimensions() int
+		// ModelID identifies the model computing the embeddings, the embeddings of different models cannot be
+		// compared nor mixed in the store
+		ModelID() string
+		// WaitReady returns once the provider computes embeddings, or with the error preventing it
+		WaitReady() error
+		Close() error
+	}
+
+	// ProviderFactory creates a provider using the model
+	ProviderFactory func(ctx context.Context, model string) (EmbeddingProvider, error)
+
+	// Registry creates the providers by name, the one of the configuration being selected without knowing them
+	Registry struct {
+		providers map[string]registeredProvider
+	}
+
+	registeredProvider struct {
+		defaultModel string
+		factory      ProviderFactory
+	}
+)
+
+// NewRegistry creates a registry without any provider
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]registeredProvider)}
+}
+
+// Register makes the provider available under the name, using the default model when none is selected, a provider
+// already registered under the name is replaced
+func (r *Registry) Register(name string, defaultModel string, factory ProviderFactory) {
+	r.providers[name] = registeredProvider{defaultModel: defaultModel, factory: factory}
+}
+
+// Names returns the sorted names of the registered providers
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultModel returns the model used by the provider when none is selected
+func (r *Registry) DefaultModel(name string) (string, error) {
+	provider, found := r.providers[name]
+	if !found {
+		return "", r.unknown(name)
+	}
+	return provider.defaultModel, nil
+}
+
+// New creates the provider registered under the name, using its default model if model is empty
+func (r *Registry) New(ctx context.Context, name string, model string) (EmbeddingProvider, error) {
+	provider, found := r.providers[name]
+	if !found {
+		return nil, r.unknown(name)
+	}
+	if model == "" {
+		model = provider.defaultModel
+	}
+	created, err := provider.factory(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s embedding provider: %w", name, err)
+	}
+	return created, nil
+}
+
+func (r *Registry) unknown(name string) error {
+	return fmt.Errorf("unknown embedding provider %q, expected one of %s", name, strings.Join(r.Names(), ", "))
+}
@@ -0,0 +1,80 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_New(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("ollama", "nomic-embed-text", func(ctx context.Context, model string) (EmbeddingProvider, error) {
+		return NewOllama(ctx, DefaultOllamaURL, model), nil
+	})
+	registry.Register("broken", "model", func(ctx context.Context, model string) (EmbeddingProvider, error) {
+		return nil, errors.New("no server")
+	})
+
+	tests := []struct {
+		name        string
+		provider    string
+		model       string
+		wantModelID string
+		wantErr     string
+	}{
+		{
+			name:        "it should create the provider with the default model",
+			provider:    "ollama",
+			wantModelID: "ollama/nomic-embed-text",
+		},
+		{
+			name:        "it should create the provider with the selected model",
+			provider:    "ollama",
+			model:       "mxbai-embed-large",
+			wantModelID: "ollama/mxbai-embed-large",
+		},
+		{
+			name:     "it should list the registered providers for an unknown one",
+			provider: "word2vec",
+			wantErr:  `unknown embedding provider "word2vec", expected one of broken, ollama`,
+		},
+		{
+			name:     "it should return the error of the factory",
+			provider: "broken",
+			wantErr:  "failed to create broken embedding provider: no server",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			provider, err := registry.New(context.Background(), tt.provider, tt.model)
+
+			// THEN
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantModelID, provider.ModelID())
+			assert.Equal(t, 0, provider.Dimensions(), "it should not know the dimensions before the first embedding")
+		})
+	}
+}
+
+func TestRegistry_DefaultModel(t *testing.T) {
+	// GIVEN
+	registry := NewRegistry()
+	registry.Register("openai", DefaultOpenAIModel, nil)
+
+	// WHEN
+	model, err := registry.DefaultModel("openai")
+	_, unknownErr := registry.DefaultModel("voyage")
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOpenAIModel, model)
+	assert.Error(t, unknownErr)
+}
@@ -1,69 +1,543 @@
 #!/usr/bin/env python3
 import argparse
+import collections
 import json
+import os
+import signal
+import socketserver
+import sqlite3
 import sys
+import threading
 import uuid
 import time
-from typing import Dict, List, Any
+import zlib
+from dataclasses import dataclass
+from typing import Dict, List, Any, Optional
 
 import chromadb
+import numpy as np
 from sentence_transformers import SentenceTransformer
 
 
-def process_request(client: chromadb.HttpClient, req: str, model: SentenceTransformer) -> Dict[str, Any]:
+@dataclass(frozen=True)
+class Instruction:
+    """Prefixes expected by some embedding models to distinguish queries from documents."""
+    query: str = ""
+    document: str = ""
+
+
+NO_INSTRUCTION = Instruction()
+
+# name of the collection holding the chunks, set from the command line
+collection_name = "code_chunks"
+# metric comparing the embeddings of a new collection, and whether they are normalized by mm, set from the command line
+collection_metric = "l2"
+collection_normalized = False
+# settings of the connection handled by the current thread when listening on a socket, see serve
+connection = threading.local()
+# number of texts encoded at once by the model, and of records written at once in chroma, set from the command line
+embed_batch_size = 32
+write_batch_size = 512
+# seconds between the heartbeats telling the caller the indexer is alive while it processes a request, 0 to disable
+heartbeat_interval = 5.0
+# device computing the embeddings, and the ones available, announced with the ready status, None without model
+device: Optional[str] = None
+devices: List[str] = []
+# key of the metadata of the collection recording the model of its embeddings, mm refuses to mix models
+MODEL_METADATA = "mm:model"
+# keys of the metadata of the collection recording how its embeddings are compared, chosen at its creation
+METRIC_METADATA = "mm:metric"
+NORMALIZED_METADATA = "mm:normalized"
+# spaces of the index of chroma, by metric of mm
+HNSW_SPACES = {"l2": "l2", "cosine": "cosine", "dot": "ip"}
+# separates the name of an array from its element in the flattened metadata stored in chroma
+ARRAY_SEPARATOR = ":"
+# version of the messages exchanged with mm, announced with the ready status, mm refuses an indexer speaking another
+# one, to bump with protocolVersion of indexer.go on any incompatible change
+PROTOCOL_VERSION = 2
+# the messages exchanged with mm are preceded by headers giving their length, and their encoding if compressed,
+# followed by an empty line
+CONTENT_LENGTH = b"Content-Length: "
+CONTENT_ENCODING = b"Content-Encoding: "
+# encodings of the requests accepted, announced with the ready status, mm compresses the large batches with them
+ACCEPTED_ENCODINGS = ["gzip"]
+# bounds a message exchanged with mm, as maxMessageSize of framing.go
+MAX_MESSAGE_SIZE = 64 * 1024 * 1024
+
+# known instruction templates, matched against the lower-cased model name, first match wins
+INSTRUCTIONS = [
+    ("e5-", Instruction(query="query: ", document="passage: ")),
+    ("bge-", Instruction(query="Represent this sentence for searching relevant passages: ")),
+    ("mxbai-embed", Instruction(query="Represent this sentence for searching relevant passages: ")),
+    ("nomic-embed", Instruction(query="search_query: ", document="search_document: ")),
+]
+
+
+def instruction_for(model_name: str, query: Optional[str] = None, document: Optional[str] = None) -> Instruction:
+    instruction = NO_INSTRUCTION
+    for pattern, candidate in INSTRUCTIONS:
+        if pattern in model_name.lower():
+            instruction = candidate
+            break
+
+    # explicit templates take precedence over the known ones
+    return Instruction(
+        query=instruction.query if query is None else query,
+        document=instruction.document if document is None else document,
+    )
+
+
+def available_devices() -> List[str]:
+    import torch
+    available = ["cpu"]
+    if torch.cuda.is_available():
+        available.append("cuda")
+    if torch.backends.mps.is_available():
+        available.append("mps")
+    return available
+
+
+def select_device(requested: str, available: List[str]) -> str:
+    # auto prefers the accelerators, a device requested explicitly must be there
+    if requested == "auto":
+        return next((candidate for candidate in ("cuda", "mps") if candidate in available), "cpu")
+    if requested not in available:
+        raise ValueError(f"device {requested} is not available, found: {', '.join(available)}")
+    return requested
+
+
+# codes of the errors, so the caller can tell the failures of a chunk from the ones of the model or of the store
+INVALID_REQUEST = "invalid_request"
+ENCODING = "encoding"
+OUT_OF_MEMORY = "out_of_memory"
+STORE = "store"
+INTERNAL = "internal"
+
+
+def error_code(e: Exception) -> str:
+    if isinstance(e, UnicodeError):
+        return ENCODING
+    # torch raises its own out of memory errors, for the GPU
+    if isinstance(e, MemoryError) or "OutOfMemory" in type(e).__name__:
+        return OUT_OF_MEMORY
+    if type(e).__module__.startswith(("chromadb", "httpx")):
+        return STORE
+    return INTERNAL
+
+
+def error_result(req_id: str, message: str, code: str) -> Dict[str, Any]:
+    return {"request_id": req_id, "status": "error", "error": message, "code": code}
+
+
+def process_request(
+        client: Optional[chromadb.HttpClient],
+        req: str,
+        model: Optional[SentenceTransformer],
+        instruction: Instruction = NO_INSTRUCTION,
+        db_path: Optional[str] = None,
+) -> Dict[str, Any]:
     req_id = str(uuid.uuid4())
+    kind = "index"
     try:
         input_data = json.loads(req)
-        req_id = input_data.get("meta", {}).get("id", req_id)
+        # the caller matches the response to its request by this id, echoed even on failures
+        req_id = str(input_data.get("request_id") or req_id)
         chunks = input_data.get("chunks", [])
+        query = input_data.get("query")
+        to_embed = input_data.get("embed")
+        to_inspect = input_data.get("inspect")
+        to_store = input_data.get("store")
 
-        if chunks:
-            result = index_chunks(client, req_id, chunks, model)
+        # the kind is known upfront, so errors are reported to the caller waiting for the response
+        if to_store is not None:
+            kind = "store"
+        elif to_inspect is not None:
+            kind = "inspect"
+        elif to_embed is not None:
+            kind = "embed"
+        elif query is not None:
+            kind = "query"
+
+        if client is None and kind != "embed":
+            result = error_result(req_id, "Running in embed only mode, only embed requests are supported", INVALID_REQUEST)
+        elif model is None and kind in ("embed", "query", "index"):
+            result = error_result(req_id, "Running in store only mode, no model loaded", INVALID_REQUEST)
+        elif kind == "store":
+            result = store(client, req_id, to_store, db_path)
+        elif kind == "inspect":
+            result = inspect(client, req_id, to_inspect)
+        elif kind == "embed":
+            result = embed(req_id, to_embed, model, instruction)
+        elif kind == "query":
+            result = query_chunks(client, req_id, query, model, instruction)
+        elif chunks:
+            result = index_chunks(client, req_id, chunks, model, instruction)
         else:
-            result = {"id": req_id, "status": "error", "message": "No chunks provided"}
+            result = error_result(req_id, "No chunks provided", INVALID_REQUEST)
 
     except json.JSONDecodeError as e:
-        result = {"id": req_id, "status": "error", "message": f"Invalid JSON: {str(e)}"}
+        result = error_result(req_id, f"Invalid JSON: {str(e)}", INVALID_REQUEST)
     except Exception as e:
-        result = {"id": req_id, "status": "error", "message": str(e)}
+        result = error_result(req_id, str(e), error_code(e))
 
+    result["kind"] = kind
     return result
 
 
-def index_chunks(client: chromadb.HttpClient, req_id: str, chunks: List[Dict[str, str]], model: SentenceTransformer):
-    # Get or create collection (thread-safe with server mode)
-    collection = client.get_or_create_collection(
-        name="code_chunks",
-        metadata={"description": "Code chunks for semantic search"}
+def current_collection() -> str:
+    # a connection can select its own collection, otherwise the one of the command line is used
+    return getattr(connection, "collection", None) or collection_name
+
+
+def get_collection(client: chromadb.HttpClient):
+    # Get or create collection (thread-safe with server mode), the metadata only applies to a new collection
+    return client.get_or_create_collection(
+        name=current_collection(),
+        metadata=collection_metadata()
     )
 
+
+def collection_metadata() -> Dict[str, Any]:
+    # a connection can select its own space, otherwise the one of the command line is used
+    metric = getattr(connection, "metric", None) or collection_metric
+    normalized = getattr(connection, "normalized", None)
+    return {
+        "description": "Code chunks for semantic search",
+        "hnsw:space": HNSW_SPACES[metric],
+        METRIC_METADATA: metric,
+        NORMALIZED_METADATA: collection_normalized if normalized is None else normalized,
+    }
+
+
+def collection_space(metadata: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    # the collections created before mm recorded its space only know the one of chroma, l2 by default
+    metadata = metadata or {}
+    spaces = {space: metric for metric, space in HNSW_SPACES.items()}
+    metric = metadata.get(METRIC_METADATA) or spaces.get(metadata.get("hnsw:space"), "l2")
+    return {"metric": metric, "normalized": bool(metadata.get(NORMALIZED_METADATA, False))}
+
+
+def encode(model: SentenceTransformer, texts: List[str]) -> np.ndarray:
+    return model.encode(texts, batch_size=embed_batch_size)
+
+
+def count_tokens(model: SentenceTransformer, texts: List[str]) -> List[int]:
+    # the special tokens are counted, but not the truncation to the context of the model
+    return [len(ids) for ids in model.tokenizer(texts, add_special_tokens=True)["input_ids"]] if texts else []
+
+
+def normalize(embeddings: np.ndarray) -> np.ndarray:
+    # scales the embeddings (the last axis) to a unit length, as mm does for the collections it normalizes
+    norms = np.linalg.norm(embeddings, axis=-1, keepdims=True)
+    return np.divide(embeddings, norms, out=np.array(embeddings, dtype=float), where=norms > 0)
+
+
+def flatten_metadata(metadata: Dict[str, Any]) -> Dict[str, Any]:
+    # chroma only stores scalar values, an array becomes one flag per element, e.g. issues:PAY-12
+    flat = {}
+    for key, value in metadata.items():
+        if isinstance(value, list):
+            for element in value:
+                flat[f"{key}{ARRAY_SEPARATOR}{element}"] = True
+        else:
+            flat[key] = value
+    return flat
+
+
+def unflatten_metadata(metadata: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+    if not metadata:
+        return metadata
+    nested = {}
+    for key, value in metadata.items():
+        name, separator, element = key.partition(ARRAY_SEPARATOR)
+        if separator and value is True:
+            nested.setdefault(name, []).append(element)
+        else:
+            nested[key] = value
+    return nested
+
+
+def chroma_where(where: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+    # the $contains conditions on the arrays match the flag of their element
+    if not where:
+        return None
+    translated = {}
+    for key, condition in where.items():
+        if key in ("$and", "$or"):
+            translated[key] = [chroma_where(sub) for sub in condition]
+        elif isinstance(condition, dict) and "$contains" in condition:
+            translated[f"{key}{ARRAY_SEPARATOR}{condition['$contains']}"] = True
+        else:
+            translated[key] = condition
+    return translated
+
+
+def upsert(collection, ids: List[str], embeddings: List[List[float]], documents: List[str], metadatas: List[Dict]):
+    metadatas = [flatten_metadata(metadata) for metadata in metadatas]
+    # chroma rejects batches larger than its limit, and large batches hold a lot of memory
+    for start in range(0, len(ids), write_batch_size):
+        end = start + write_batch_size
+        collection.upsert(
+            ids=ids[start:end],
+            embeddings=embeddings[start:end],
+            documents=documents[start:end],
+            metadatas=metadatas[start:end],
+        )
+
+
+def index_chunks(
+        client: chromadb.HttpClient,
+        req_id: str,
+        chunks: List[Dict[str, str]],
+        model: SentenceTransformer,
+        instruction: Instruction = NO_INSTRUCTION,
+):
+    collection = get_collection(client)
+
     ids = []
     documents = []
+    texts = []
     metadata_list = []
     for chunk in chunks:
         ids.append(chunk["id"])
         documents.append(chunk["content"])
+        texts.append(embedding_text(chunk, instruction))
         metadata_list.append(chunk.get("metadata", {}))
 
-    embeddings = model.encode(documents)
+    embeddings = encode(model, texts)
+    if collection_space(collection.metadata)["normalized"]:
+        embeddings = normalize(embeddings)
 
     # Upsert is thread-safe in server mode
-    collection.upsert(
-        ids=ids,
-        embeddings=embeddings.tolist(),
-        documents=documents,
-        metadatas=metadata_list,
+    upsert(collection, ids, embeddings.tolist(), documents, metadata_list)
+
+    return {"request_id": req_id, "status": "success", "indexed_count": len(chunks)}
+
+
+def query_chunks(
+        client: chromadb.HttpClient,
+        req_id: str,
+        query: Dict[str, Any],
+        model: SentenceTransformer,
+        instruction: Instruction = NO_INSTRUCTION,
+):
+    collection = get_collection(client)
+
+    embedding = query_embedding(query, model, instruction)
+    if collection_space(collection.metadata)["normalized"]:
+        embedding = normalize(embedding)
+    results = query_collection(collection, embedding.tolist(), query.get("n_results", 10), query.get("where"))
+
+    return {"request_id": req_id, "status": "success", "results": results}
+
+
+def query_collection(collection, embedding: List[float], n_results: int, where: Optional[Dict[str, Any]]):
+    response = collection.query(
+        query_embeddings=[embedding],
+        n_results=n_results,
+        where=chroma_where(where),
+        include=["documents", "metadatas", "distances"],
     )
 
-    return {"id": req_id, "status": "success", "indexed_count": len(chunks)}
+    results = []
+    for chunk_id, document, metadata, distance in zip(
+        response["ids"][0],
+        response["documents"][0],
+        response["metadatas"][0],
+        response["distances"][0],
+    ):
+        results.append({"id": chunk_id, "document": document, "metadata": unflatten_metadata(metadata), "distance": distance})
+    return results
+
+
+def store(client: chromadb.HttpClient, req_id: str, request: Dict[str, Any], db_path: Optional[str] = None):
+    # storage of embeddings computed by the caller, the collection is used as a plain vector store
+    action = request.get("action")
+    if action == "check":
+        return {"request_id": req_id, "status": "success", "problems": check_store(client, db_path)}
+    if action == "reset":
+        # the segments of the collection are dropped, the chunks have to be indexed again, with the same model
+        model = (get_collection(client).metadata or {}).get(MODEL_METADATA)
+        client.delete_collection(current_collection())
+        collection = get_collection(client)
+        if model:
+            # as for record_model, chroma refuses to change the space of its index
+            metadata = {key: value for key, value in (collection.metadata or {}).items() if not key.startswith("hnsw:")}
+            collection.modify(metadata={**metadata, MODEL_METADATA: model})
+        return {"request_id": req_id, "status": "success"}
+
+    collection = get_collection(client)
+    if action == "upsert":
+        records = request.get("records", [])
+        if records:
+            upsert(
+                collection,
+                [record["id"] for record in records],
+                [record["embedding"] for record in records],
+                [record["document"] for record in records],
+                [record["metadata"] for record in records],
+            )
+        return {"request_id": req_id, "status": "success", "indexed_count": len(records)}
+    if action == "query":
+        results = query_collection(collection, request["embedding"], request.get("n_results", 10), request.get("where"))
+        return {"request_id": req_id, "status": "success", "results": results}
+    if action == "delete":
+        collection.delete(where={"file_path": request["file_path"]})
+        return {"request_id": req_id, "status": "success"}
+    if action == "stats":
+        count = collection.count()
+        dimensions = 0
+        if count > 0:
+            sample = collection.get(limit=1, include=["embeddings"])
+            dimensions = len(sample["embeddings"][0])
+        model = (collection.metadata or {}).get(MODEL_METADATA, "")
+        return {
+            "request_id": req_id,
+            "status": "success",
+            "count": count,
+            "dimensions": dimensions,
+            "model": model,
+            **collection_space(collection.metadata),
+        }
+    if action == "record_model":
+        # the metadata is replaced as a whole, the description and the space are kept, chroma refuses to change the
+        # one of its index
+        metadata = {key: value for key, value in (collection.metadata or {}).items() if not key.startswith("hnsw:")}
+        metadata[MODEL_METADATA] = request["model"]
+        collection.modify(metadata=metadata)
+        return {"request_id": req_id, "status": "success"}
+
+    return error_result(req_id, f"Unknown store action {action}", INVALID_REQUEST)
+
+
+def embed(req_id: str, request: Dict[str, Any], model: SentenceTransformer, instruction: Instruction = NO_INSTRUCTION):
+    # only compute the embeddings, storing them is the responsibility of the caller
+    if "query" in request:
+        embeddings = [query_embedding(request["query"], model, instruction).tolist()]
+    else:
+        texts = [embedding_text(chunk, instruction) for chunk in request.get("chunks", [])]
+        if request.get("count_tokens"):
+            # estimates the cost of embedding the chunks, without computing their embeddings
+            return {"request_id": req_id, "status": "success", "tokens": count_tokens(model, texts)}
+        embeddings = encode(model, texts).tolist() if texts else []
+
+    return {"request_id": req_id, "status": "success", "embeddings": embeddings}
+
+
+def inspect(client: chromadb.HttpClient, req_id: str, request: Dict[str, Any]):
+    # low-level access to the raw records, to debug search results
+    action = request.get("action")
+    if action == "collections":
+        # depending on the chroma version, collections are listed as names or as objects
+        names = [getattr(c, "name", c) for c in client.list_collections()]
+        return {"request_id": req_id, "status": "success", "collections": names}
+    if action == "create":
+        client.create_collection(name=request["name"], metadata=collection_metadata())
+        return {"request_id": req_id, "status": "success"}
+    if action == "drop":
+        client.delete_collection(request["name"])
+        return {"request_id": req_id, "status": "success"}
 
+    collection = get_collection(client)
+    if action == "peek":
+        response = collection.get(
+            ids=request.get("ids") or None,
+            where=chroma_where(request.get("where")),
+            limit=request.get("limit") or None,
+            offset=request.get("offset") or None,
+            include=["documents", "metadatas", "embeddings"],
+        )
+        records = []
+        for chunk_id, document, metadata, embedding in zip(
+            response["ids"],
+            response["documents"],
+            response["metadatas"],
+            response["embeddings"],
+        ):
+            records.append({
+                "id": chunk_id,
+                "document": document,
+                "metadata": unflatten_metadata(metadata),
+                "embedding": [float(v) for v in embedding],
+            })
+        return {"request_id": req_id, "status": "success", "records": records}
+    if action == "delete":
+        ids = request.get("ids", [])
+        if ids:
+            collection.delete(ids=ids)
+        return {"request_id": req_id, "status": "success", "deleted_count": len(ids)}
 
-def wait_for_server(host: str, port: int, timeout: int = 30):
+    return error_result(req_id, f"Unknown inspect action {action}", INVALID_REQUEST)
+
+
+def check_store(client: chromadb.HttpClient, db_path: Optional[str] = None) -> List[str]:
+    # detects the corruptions left by hard kills of a previous run, returns a description of each problem found
+    problems = []
+
+    sqlite_path = os.path.join(db_path, "chroma.sqlite3") if db_path else None
+    if sqlite_path and os.path.exists(sqlite_path):
+        try:
+            with sqlite3.connect(f"file:{sqlite_path}?mode=ro", uri=True) as connection:
+                for (row,) in connection.execute("PRAGMA quick_check"):
+                    if row != "ok":
+                        problems.append(f"sqlite: {row}")
+        except sqlite3.Error as e:
+            problems.append(f"sqlite: {e}")
+
+    # partially written segments usually fail when they are loaded
+    try:
+        collection = get_collection(client)
+        if collection.count() > 0:
+            sample = collection.get(limit=1, include=["embeddings"])
+            collection.query(query_embeddings=[list(sample["embeddings"][0])], n_results=1)
+    except Exception as e:
+        problems.append(f"collection: {e}")
+
+    return problems
+
+
+def query_embedding(
+        query: Dict[str, Any],
+        model: SentenceTransformer,
+        instruction: Instruction = NO_INSTRUCTION,
+) -> np.ndarray:
+    # the query can combine a natural language text and a code example, weighted by like_weight
+    like_weight = query.get("like_weight", 0.5)
+    texts = []
+    weights = []
+    if query.get("text"):
+        texts.append(instruction.query + query["text"])
+        weights.append(1 - like_weight)
+    if query.get("like"):
+        texts.append(instruction.query + query["like"])
+        weights.append(like_weight)
+    if not texts:
+        raise ValueError("Query requires a text or an example")
+
+    embeddings = encode(model, texts)
+    if len(texts) == 1:
+        return embeddings[0]
+    return np.average(embeddings, axis=0, weights=weights)
+
+
+def embedding_text(chunk: Dict[str, Any], instruction: Instruction = NO_INSTRUCTION) -> str:
+    # context lines (commit subjects, ...) are embedded with the content, but not stored in the document
+    return instruction.document + "\n".join(chunk.get("context", []) + [chunk["content"]])
+
+
+def connect(host: str, port: int, ssl: bool = False) -> chromadb.HttpClient:
+    # the token is read from the environment, so it does not show in the command line
+    token = os.environ.get("MM_CHROMA_TOKEN")
+    headers = {"Authorization": f"Bearer {token}"} if token else None
+    return chromadb.HttpClient(host=host, port=port, ssl=ssl, headers=headers)
+
+
+def wait_for_server(host: str, port: int, timeout: int = 30, ssl: bool = False):
     start_time = time.time()
     while time.time() - start_time < timeout:
         # noinspection PyBroadException
         try:
-            client = chromadb.HttpClient(host=host, port=port)
+            client = connect(host, port, ssl)
             client.heartbeat()  # Test connection
             print(f"✓ ChromaDB server is available at {host}:{port}", file=sys.stderr)
             return True
@@ -87,6 +561,11 @@ def main():
         default=8000,
         help="ChromaDB server port (default: 8000)"
     )
+    parser.add_argument(
+        "--ssl",
+        action="store_true",
+        help="Connect to the ChromaDB server over https"
+    )
     parser.add_argument(
         "--timeout",
         type=int,
@@ -98,43 +577,392 @@ def main():
         default="all-MiniLM-L6-v2",
         help="Name of the sentence transformer model (default: all-MiniLM-L6-v2)"
     )
+    parser.add_argument(
+        "--device",
+        choices=["auto", "cpu", "cuda", "mps"],
+        default="auto",
+        help="Device computing the embeddings, auto picks cuda, then mps, then cpu (default: auto)"
+    )
+    parser.add_argument(
+        "--query-instruction",
+        default=None,
+        help="Prefix added to queries before embedding (default: depends on the model)"
+    )
+    parser.add_argument(
+        "--document-instruction",
+        default=None,
+        help="Prefix added to documents before embedding (default: depends on the model)"
+    )
+    parser.add_argument(
+        "--embed-only",
+        action="store_true",
+        help="Only compute embeddings, without connecting to ChromaDB (the caller stores them)"
+    )
+    parser.add_argument(
+        "--db-path",
+        default=None,
+        help="Directory where the ChromaDB server persists its data, used to check its integrity"
+    )
+    parser.add_argument(
+        "--store-only",
+        action="store_true",
+        help="Only store embeddings computed by the caller in ChromaDB, without loading the model"
+    )
+    parser.add_argument(
+        "--collection",
+        default="code_chunks",
+        help="Name of the ChromaDB collection holding the chunks (default: code_chunks)"
+    )
+    parser.add_argument(
+        "--metric",
+        choices=list(HNSW_SPACES),
+        default="l2",
+        help="Metric comparing the embeddings of a new collection (default: l2)"
+    )
+    parser.add_argument(
+        "--normalized",
+        action="store_true",
+        help="Record that the embeddings of a new collection are normalized by the caller"
+    )
+    parser.add_argument(
+        "--threads",
+        type=int,
+        default=0,
+        help="Number of threads used by the model (default: 0, one per core)"
+    )
+    parser.add_argument(
+        "--embed-batch-size",
+        type=int,
+        default=32,
+        help="Number of texts encoded at once by the model (default: 32)"
+    )
+    parser.add_argument(
+        "--write-batch-size",
+        type=int,
+        default=512,
+        help="Number of records written at once in ChromaDB (default: 512)"
+    )
+    parser.add_argument(
+        "--heartbeat-interval",
+        type=float,
+        default=5.0,
+        help="Seconds between the heartbeats sent to the caller, 0 to disable them (default: 5)"
+    )
+    parser.add_argument(
+        "--listen",
+        type=str,
+        default=None,
+        help="Serve the requests of several clients on a socket, unix:///path or tcp://host:port, instead of stdin"
+    )
     args = parser.parse_args()
 
-    if not wait_for_server(args.host, args.port, args.timeout):
+    # stdout only carries the messages of the protocol, what the libraries print there goes to the logs instead
+    protocol_out = sys.stdout.buffer
+    sys.stdout = sys.stderr
+    if not args.listen:
+        # a Ctrl-C reaches the whole process group, mm answers it by closing stdin once the requests already sent are
+        # answered, the indexer exits then
+        signal.signal(signal.SIGINT, signal.SIG_IGN)
+
+    global collection_name, collection_metric, collection_normalized
+    global embed_batch_size, write_batch_size, heartbeat_interval, device, devices
+    collection_name = args.collection
+    collection_metric = args.metric
+    collection_normalized = args.normalized
+    embed_batch_size = args.embed_batch_size
+    write_batch_size = args.write_batch_size
+    heartbeat_interval = args.heartbeat_interval
+    if args.threads > 0:
+        import torch
+        torch.set_num_threads(args.threads)
+
+    if not args.embed_only and not wait_for_server(args.host, args.port, args.timeout, args.ssl):
         print("Unable to join chroma server, is it started?", file=sys.stderr)
         sys.exit(1)
 
-    try:
-        model = SentenceTransformer(args.model_name, local_files_only=True)
-        print(f"✓ Loaded model '{args.model_name}' from cache", file=sys.stderr)
-    except Exception as e:
-        print(f"✗ Failed to load model '{args.model_name}' from cache: {e}", file=sys.stderr)
-        print("Please run: python cache_model.py <model_name> first", file=sys.stderr)
-        sys.exit(1)
+    model = None
+    if not args.store_only:
+        devices = available_devices()
+        try:
+            device = select_device(args.device, devices)
+        except ValueError as e:
+            print(f"✗ {e}", file=sys.stderr)
+            sys.exit(1)
+        print(f"✓ Computing the embeddings on {device} (available: {', '.join(devices)})", file=sys.stderr)
+        try:
+            model = SentenceTransformer(args.model_name, device=device, local_files_only=True)
+            print(f"✓ Loaded model '{args.model_name}' from cache", file=sys.stderr)
+        except Exception as cache_error:
+            # a model selected with --model-name is downloaded on first use, then loaded from the cache
+            print(f"Model '{args.model_name}' not cached ({cache_error}), downloading it", file=sys.stderr)
+            try:
+                model = SentenceTransformer(args.model_name, device=device)
+                print(f"✓ Downloaded model '{args.model_name}'", file=sys.stderr)
+            except Exception as e:
+                print(f"✗ Failed to load model '{args.model_name}': {e}", file=sys.stderr)
+                print("Please run: python cache_model.py <model_name> first", file=sys.stderr)
+                sys.exit(1)
+
+    instruction = instruction_for(args.model_name, args.query_instruction, args.document_instruction)
+    if model is not None and instruction != NO_INSTRUCTION:
+        print(f"✓ Using instructions {instruction} for model '{args.model_name}'", file=sys.stderr)
+
+    client = None
+    if not args.embed_only:
+        try:
+            client = connect(args.host, args.port, args.ssl)
+            print(f"✓ Connected to ChromaDB server at {args.host}:{args.port}", file=sys.stderr)
+        except Exception as e:
+            print(f"✗ Failed to connect to ChromaDB server: {e}", file=sys.stderr)
+            sys.exit(1)
+
+    if args.listen:
+        listen(args.listen, client, model, instruction, args.db_path)
+        return
 
+    serve(sys.stdin.buffer, protocol_out, client, model, instruction, args.db_path)
+
+
+def serve(
+        reader,
+        writer,
+        client: Optional[chromadb.HttpClient],
+        model: Optional[SentenceTransformer],
+        instruction: Instruction = NO_INSTRUCTION,
+        db_path: Optional[str] = None,
+):
+    # one response per request, until the reader is closed
+    lock = threading.Lock()
+    ready = {"status": "READY", "protocol": PROTOCOL_VERSION, "compression": ACCEPTED_ENCODINGS}
+    if device is not None:
+        ready.update(device=device, devices=devices)
+    write(writer, lock, ready)
+    stopped = threading.Event()
+    if heartbeat_interval > 0:
+        threading.Thread(target=heartbeat, args=(writer, lock, stopped), daemon=True).start()
     try:
-        client = chromadb.HttpClient(host=args.host, port=args.port)
-        print(f"✓ Connected to ChromaDB server at {args.host}:{args.port}", file=sys.stderr)
-    except Exception as e:
-        print(f"✗ Failed to connect to ChromaDB server: {e}", file=sys.stderr)
-        sys.exit(1)
+        serve_requests(reader, writer, lock, client, model, instruction, db_path)
+    finally:
+        stopped.set()
 
-    print(json.dumps({"status": "READY"}))
-    sys.stdout.flush()
 
+def serve_requests(
+        reader,
+        writer,
+        lock: threading.Lock,
+        client: Optional[chromadb.HttpClient],
+        model: Optional[SentenceTransformer],
+        instruction: Instruction,
+        db_path: Optional[str],
+):
+    progress = Progress()
     while True:
-        line = sys.stdin.readline()
-        if not line:
+        try:
+            message = read_message(reader)
+        except SkippedMessage as e:
+            # mm does not send such requests, they could not be answered without reading their id
+            print(f"✗ Skipped a request: {e}", file=sys.stderr)
+            continue
+        except ProtocolError as e:
+            print(f"✗ Stopped reading the requests: {e}", file=sys.stderr)
+            break
+        if message is None:
             break
 
-        request = line.strip()
-        if not request or request == "exit":
+        request = message.decode("utf-8", errors="replace").strip()
+        if not request:
+            continue
+
+        options = parse_options(request)
+        if options is not None:
+            # the settings of the connection are sent before any request, they do not expect a response
+            connection.collection = options.get("collection")
+            connection.metric = options.get("metric")
+            connection.normalized = options.get("normalized")
+            continue
+
+        result = process_request(client, request, model, instruction, db_path)
+        write(writer, lock, result)
+        if progress.record(result):
+            write(writer, lock, progress.message())
+
+
+class Progress:
+    """Counts the texts embedded and the chunks stored for a caller, reported after each batch."""
+
+    def __init__(self, window: float = 10.0):
+        self.embedded = 0
+        self.stored = 0
+        # the throughput is computed over the batches of the last seconds, (time, chunks) of each batch
+        self.window = window
+        self.started = time.monotonic()
+        self.batches = collections.deque()
+
+    def record(self, result: Dict[str, Any]) -> bool:
+        # True if the result embedded or stored chunks, the caller is then told
+        if result.get("status") != "success":
+            return False
+        embedded = stored = 0
+        kind = result.get("kind")
+        if kind == "index":
+            embedded = stored = result.get("indexed_count", 0)
+        elif kind == "embed":
+            embedded = len(result.get("embeddings") or [])
+        elif kind == "store":
+            stored = result.get("indexed_count", 0)
+        if not embedded and not stored:
+            return False
+
+        self.embedded += embedded
+        self.stored += stored
+        now = time.monotonic()
+        self.batches.append((now, max(embedded, stored)))
+        while now - self.batches[0][0] > self.window:
+            self.batches.popleft()
+        return True
+
+    def per_second(self) -> float:
+        elapsed = min(self.window, time.monotonic() - self.started)
+        return sum(chunks for _, chunks in self.batches) / elapsed if elapsed > 0 else 0.0
+
+    def message(self) -> Dict[str, Any]:
+        return {
+            "status": "PROGRESS",
+            "embedded": self.embedded,
+            "stored": self.stored,
+            "per_second": round(self.per_second(), 1),
+        }
+
+
+class ProtocolError(Exception):
+    """A message that cannot be read, the next ones cannot be found in the stream."""
+
+
+class SkippedMessage(Exception):
+    """A message that cannot be used, skipped, the next ones can still be read."""
+
+
+class MessageTooLarge(SkippedMessage):
+    """A message larger than MAX_MESSAGE_SIZE, skipped without being read whole."""
+
+
+def read_message(reader) -> Optional[bytes]:
+    # None once the reader ends between two messages
+    length = None
+    encoding = None
+    while True:
+        header = reader.readline(256)
+        if not header:
+            if length is None and encoding is None:
+                return None
+            raise ProtocolError("failed to read message header, the reader ended")
+        if not header.endswith(b"\n"):
+            raise ProtocolError(f"invalid message header {header[:64]!r}, expected {CONTENT_LENGTH!r}")
+        header = header.rstrip(b"\r\n")
+        if not header:
             break
+        if header.startswith(CONTENT_LENGTH):
+            value = header[len(CONTENT_LENGTH):]
+            if not value.isdigit():
+                raise ProtocolError(f"invalid message length {value[:64]!r}")
+            length = int(value)
+        elif header.startswith(CONTENT_ENCODING):
+            encoding = header[len(CONTENT_ENCODING):].decode("ascii", errors="replace")
+        else:
+            raise ProtocolError(f"invalid message header {header[:64]!r}, expected {CONTENT_LENGTH!r}")
+    if length is None:
+        raise ProtocolError(f"invalid message, {CONTENT_LENGTH!r} header missing")
+
+    if length > MAX_MESSAGE_SIZE:
+        remaining = length
+        while remaining > 0:
+            skipped = reader.read(min(remaining, 1024 * 1024))
+            if not skipped:
+                break
+            remaining -= len(skipped)
+        raise MessageTooLarge(f"message too large: {length} bytes, the limit is {MAX_MESSAGE_SIZE} bytes")
+
+    message = reader.read(length)
+    if len(message) < length:
+        raise ProtocolError(f"failed to read message of {length} bytes, the reader ended")
+    if encoding is None:
+        return message
+    if encoding != "gzip":
+        raise SkippedMessage(f"unsupported message encoding {encoding[:64]!r}")
+    decompressor = zlib.decompressobj(wbits=31)
+    try:
+        content = decompressor.decompress(message, MAX_MESSAGE_SIZE)
+    except zlib.error as e:
+        raise SkippedMessage(f"failed to decompress message: {e}")
+    if decompressor.unconsumed_tail:
+        raise MessageTooLarge(f"message too large: more than {MAX_MESSAGE_SIZE} bytes once decompressed")
+    return content
+
+
+def write_message(writer, message: bytes):
+    writer.write(CONTENT_LENGTH + str(len(message)).encode() + b"\r\n\r\n" + message)
+    writer.flush()
+
 
-        result = process_request(client, request, model)
+def write(writer, lock: threading.Lock, message: Dict[str, Any]):
+    # the heartbeats are written by another thread, a message must not be cut by one
+    data = json.dumps(message).encode("utf-8")
+    with lock:
+        write_message(writer, data)
 
-        print(json.dumps(result))
-        sys.stdout.flush()
+
+def heartbeat(writer, lock: threading.Lock, stopped: threading.Event):
+    # sent while a long request is processed too, so the caller can tell a busy indexer from a hung one
+    while not stopped.wait(heartbeat_interval):
+        try:
+            write(writer, lock, {"status": "HEARTBEAT"})
+        except (OSError, ValueError):
+            return
+
+
+def parse_options(request: str) -> Optional[Dict[str, Any]]:
+    if not request.startswith('{"options"'):
+        return None
+    try:
+        return json.loads(request).get("options") or {}
+    except json.JSONDecodeError:
+        return None
+
+
+def listen(
+        address: str,
+        client: Optional[chromadb.HttpClient],
+        model: Optional[SentenceTransformer],
+        instruction: Instruction = NO_INSTRUCTION,
+        db_path: Optional[str] = None,
+):
+    # each connection is served by its own thread, sharing the model and the chroma client
+    class Handler(socketserver.BaseRequestHandler):
+        def handle(self):
+            reader = self.request.makefile("rb")
+            writer = self.request.makefile("wb")
+            try:
+                serve(reader, writer, client, model, instruction, db_path)
+            except (BrokenPipeError, ConnectionResetError):
+                pass
+
+    if address.startswith("unix://"):
+        path = address[len("unix://"):]
+        if os.path.exists(path):
+            os.remove(path)
+        server = socketserver.ThreadingUnixStreamServer(path, Handler)
+    else:
+        host, _, port = address.removeprefix("tcp://").rpartition(":")
+        socketserver.ThreadingTCPServer.allow_reuse_address = True
+        server = socketserver.ThreadingTCPServer((host or "0.0.0.0", int(port)), Handler)
+    server.daemon_threads = True
+
+    print(f"✓ Listening on {address}", file=sys.stderr)
+    with server:
+        try:
+            server.serve_forever()
+        except KeyboardInterrupt:
+            pass
 
 
 if __name__ == "__main__":
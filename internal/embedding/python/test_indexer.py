@@ -1,6 +1,9 @@
+import gzip
+import io
 import json
 import subprocess
 import tempfile
+import threading
 import time
 import uuid
 from typing import Dict, List, Optional
@@ -10,7 +13,9 @@ import pytest
 from chromadb import QueryResult
 from sentence_transformers import SentenceTransformer
 
-from indexer import index_chunks
+from indexer import index_chunks, instruction_for, Instruction, NO_INSTRUCTION, flatten_metadata, unflatten_metadata, \
+    chroma_where, error_code, process_request, heartbeat, read_message, write_message, MessageTooLarge, ProtocolError, \
+    Progress, select_device, collection_space, count_tokens
 
 
 @pytest.fixture
@@ -36,8 +41,6 @@ class IndexerDaemon:
             stdin=subprocess.PIPE,
             stdout=subprocess.PIPE,
             stderr=subprocess.PIPE,
-            text=True,
-            bufsize=1  # Line buffered
         )
         self.stdin = self.process.stdin
         self.stdout = self.process.stdout
@@ -60,16 +63,13 @@ class IndexerDaemon:
             try:
                 import select
                 if select.select([self.stdout], [], [], 0.1)[0]:
-                    line = self.stdout.readline()
-                    if line.strip():
-                        try:
-                            ready_msg = json.loads(line.strip())
-                            if ready_msg.get("status") == "READY":
-                                return
-                            else:
-                                raise Exception(f"Expected READY status, got: {ready_msg}")
-                        except json.JSONDecodeError:
-                            raise Exception(f"Expected JSON READY message, got: {line.strip()}")
+                    message = read_message(self.stdout)
+                    if message is not None:
+                        ready_msg = json.loads(message)
+                        if ready_msg.get("status") == "READY":
+                            return
+                        else:
+                            raise Exception(f"Expected READY status, got: {ready_msg}")
             except Exception:
                 time.sleep(0.1)
                 continue
@@ -83,29 +83,27 @@ class IndexerDaemon:
 
         # Send request as JSON line
         request = {
-            "meta": {
-              "id": req_id or str(uuid.uuid4())
-            },
+            "request_id": req_id or str(uuid.uuid4()),
             "chunks": chunks
         }
-        json_line = json.dumps(request) + "\n"
-        self.stdin.write(json_line)
-        self.stdin.flush()
+        write_message(self.stdin, json.dumps(request).encode("utf-8"))
 
-        # Read response
-        response_line = self.stdout.readline()
-        if not response_line:
-            raise Exception("No response from daemon")
+        # Read response, skipping the heartbeats sent while the request is processed
+        while True:
+            message = read_message(self.stdout)
+            if message is None:
+                raise Exception("No response from daemon")
 
-        return json.loads(response_line.strip())
+            response = json.loads(message)
+            if response.get("status") != "HEARTBEAT":
+                return response
 
     def stop(self):
         """Stop the indexer daemon."""
         if self.process and self.process.poll() is None:
-            # Send exit command
+            # Closing stdin asks the daemon to exit
             try:
-                self.stdin.write("exit\n")
-                self.stdin.flush()
+                self.stdin.close()
 
                 # Wait for graceful shutdown
                 self.process.wait(timeout=5)
@@ -195,7 +193,7 @@ def describe_e2e_tests_for_index_chunks():
         # WHEN & THEN
         with IndexerDaemon(temp_path) as daemon:
             result = daemon.send_request(chunks, req_id="test_request_123")
-            assert result["id"] == "test_request_123"
+            assert result["request_id"] == "test_request_123"
 
     def test_should_handle_multiple_requests(temp_path):
         # GIVEN
@@ -279,7 +277,7 @@ def describe_index_chunks():
         result = index_chunks(req_id=req_id, chunks=chunks, model=model, db_path=temp_path)
 
         # THEN
-        assert result["id"] == req_id
+        assert result["request_id"] == req_id
 
     def test_should_be_able_search_indexed_documents(temp_path, model):
         # GIVEN
@@ -315,3 +313,220 @@ def describe_index_chunks():
         results = search(query="function to calculate taxes", db_path=temp_path, n_results=1)
         assert len(results["ids"][0]) > 0
         assert "calculate_tax" in results["documents"][0][0]
+
+
+def describe_instruction_for():
+    def test_should_use_known_template_for_e5_models():
+        # WHEN
+        instruction = instruction_for("intfloat/e5-base-v2")
+
+        # THEN
+        assert instruction == Instruction(query="query: ", document="passage: ")
+
+    def test_should_not_use_instructions_for_unknown_models():
+        # WHEN
+        instruction = instruction_for("all-MiniLM-L6-v2")
+
+        # THEN
+        assert instruction == NO_INSTRUCTION
+
+    def test_should_prefer_explicit_templates():
+        # WHEN
+        instruction = instruction_for("intfloat/e5-base-v2", query="q: ")
+
+        # THEN
+        assert instruction == Instruction(query="q: ", document="passage: ")
+
+
+def describe_select_device():
+    def test_should_prefer_the_accelerators():
+        # WHEN
+        device = select_device("auto", ["cpu", "cuda"])
+
+        # THEN
+        assert device == "cuda"
+
+    def test_should_fall_back_to_the_cpu():
+        # WHEN
+        device = select_device("auto", ["cpu"])
+
+        # THEN
+        assert device == "cpu"
+
+    def test_should_refuse_a_missing_device():
+        # WHEN / THEN
+        with pytest.raises(ValueError, match="device mps is not available"):
+            select_device("mps", ["cpu", "cuda"])
+
+
+def describe_count_tokens():
+    def test_should_count_the_tokens_without_embedding(model):
+        # GIVEN
+        request = {"request_id": "7", "embed": {"chunks": [{"content": "def add(a, b): return a + b"}], "count_tokens": True}}
+
+        # WHEN
+        result = process_request(None, json.dumps(request), model)
+
+        # THEN
+        assert result["status"] == "success"
+        assert "embeddings" not in result
+        assert result["tokens"] == count_tokens(model, ["def add(a, b): return a + b"])
+        assert result["tokens"][0] > 2
+
+
+def describe_collection_space():
+    def test_should_read_the_recorded_space():
+        # WHEN
+        space = collection_space({"hnsw:space": "ip", "mm:metric": "dot", "mm:normalized": True})
+
+        # THEN
+        assert space == {"metric": "dot", "normalized": True}
+
+    def test_should_fall_back_to_the_space_of_chroma():
+        # WHEN
+        space = collection_space({"hnsw:space": "cosine"})
+
+        # THEN
+        assert space == {"metric": "cosine", "normalized": False}
+
+    def test_should_default_to_l2():
+        # WHEN
+        space = collection_space(None)
+
+        # THEN
+        assert space == {"metric": "l2", "normalized": False}
+
+
+def describe_array_metadata():
+    def test_should_flatten_and_restore_arrays():
+        # GIVEN
+        metadata = {"file_path": "/src/pay.py", "issues": ["PAY-12", "#87"]}
+
+        # WHEN
+        flat = flatten_metadata(metadata)
+
+        # THEN
+        assert flat == {"file_path": "/src/pay.py", "issues:PAY-12": True, "issues:#87": True}
+        assert unflatten_metadata(flat) == metadata
+
+    def test_should_translate_contains_to_the_flag_of_the_element():
+        # WHEN
+        where = chroma_where({"$and": [{"root": {"$eq": "api"}}, {"issues": {"$contains": "PAY-12"}}]})
+
+        # THEN
+        assert where == {"$and": [{"root": {"$eq": "api"}}, {"issues:PAY-12": True}]}
+
+
+def describe_errors():
+    def test_should_classify_the_errors():
+        class OutOfMemoryError(RuntimeError):
+            pass
+
+        assert error_code(UnicodeEncodeError("utf-8", "\ud800", 0, 1, "surrogates not allowed")) == "encoding"
+        assert error_code(OutOfMemoryError("CUDA out of memory")) == "out_of_memory"
+        assert error_code(MemoryError()) == "out_of_memory"
+        assert error_code(ValueError("boom")) == "internal"
+
+    def test_should_return_the_code_of_an_invalid_request():
+        # WHEN
+        result = process_request(None, '{"request_id": "7", "embed": {}', None)
+
+        # THEN
+        assert result["status"] == "error"
+        assert result["code"] == "invalid_request"
+
+
+def describe_heartbeat():
+    def test_should_send_heartbeats_until_stopped(monkeypatch):
+        # GIVEN
+        monkeypatch.setattr("indexer.heartbeat_interval", 0.01)
+        writer = io.BytesIO()
+        stopped = threading.Event()
+        thread = threading.Thread(target=heartbeat, args=(writer, threading.Lock(), stopped))
+        thread.start()
+
+        # WHEN
+        time.sleep(0.1)
+        stopped.set()
+        thread.join(timeout=1)
+
+        # THEN
+        assert not thread.is_alive()
+        reader = io.BufferedReader(io.BytesIO(writer.getvalue()))
+        messages = list(iter(lambda: read_message(reader), None))
+        assert len(messages) > 1
+        assert all(json.loads(message) == {"status": "HEARTBEAT"} for message in messages)
+
+
+def describe_framing():
+    def test_should_read_back_the_messages_whatever_their_lines():
+        # GIVEN
+        stream = io.BytesIO()
+        write_message(stream, b"line one\nline two")
+        write_message(stream, b"{}")
+        reader = io.BufferedReader(io.BytesIO(stream.getvalue()))
+
+        # WHEN
+        messages = [read_message(reader), read_message(reader), read_message(reader)]
+
+        # THEN
+        assert messages == [b"line one\nline two", b"{}", None]
+
+    def test_should_decompress_a_compressed_message():
+        # GIVEN
+        content = b'{"chunks": [{"content": "' + b"func main() {}" * 1000 + b'"}]}'
+        compressed = gzip.compress(content)
+        stream = b"Content-Length: %d\r\nContent-Encoding: gzip\r\n\r\n" % len(compressed) + compressed
+        reader = io.BufferedReader(io.BytesIO(stream))
+
+        # WHEN
+        message = read_message(reader)
+
+        # THEN
+        assert message == content
+
+    def test_should_skip_a_message_too_large(monkeypatch):
+        # GIVEN
+        monkeypatch.setattr("indexer.MAX_MESSAGE_SIZE", 4)
+        stream = io.BytesIO()
+        write_message(stream, b'{"chunks": []}')
+        write_message(stream, b"{}")
+        reader = io.BufferedReader(io.BytesIO(stream.getvalue()))
+
+        # WHEN
+        with pytest.raises(MessageTooLarge):
+            read_message(reader)
+        message = read_message(reader)
+
+        # THEN
+        assert message == b"{}"
+
+    def test_should_refuse_a_message_without_header():
+        # GIVEN
+        reader = io.BufferedReader(io.BytesIO(b'{"chunks": []}\n'))
+
+        # WHEN / THEN
+        with pytest.raises(ProtocolError):
+            read_message(reader)
+
+
+def describe_progress():
+    def test_should_count_the_chunks_embedded_and_stored():
+        # GIVEN
+        progress = Progress()
+
+        # WHEN
+        recorded = [
+            progress.record({"kind": "index", "status": "success", "indexed_count": 10}),
+            progress.record({"kind": "embed", "status": "success", "embeddings": [[0.1], [0.2]]}),
+            progress.record({"kind": "store", "status": "success", "indexed_count": 2}),
+            progress.record({"kind": "store", "status": "success", "count": 12}),
+            progress.record({"kind": "index", "status": "error", "error": "boom"}),
+        ]
+
+        # THEN
+        assert recorded == [True, True, True, False, False]
+        message = progress.message()
+        assert message["status"] == "PROGRESS"
+        assert (message["embedded"], message["stored"]) == (12, 12)
+        assert message["per_second"] > 0
@@ -0,0 +1,95 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// dialTimeout bounds the connection to an indexer service
+const dialTimeout = 10 * time.Second
+
+type (
+	// connectionOptions are sent to the indexer service before any request, they only apply to the connection
+	connectionOptions struct {
+		Collection string `json:"collection,omitempty"`
+		// Metric and Normalized describe the embeddings of the collection, recorded when the service creates it, the
+		// ones the service was started with if omitted
+		Metric     string `json:"metric,omitempty"`
+		Normalized bool   `json:"normalized,omitempty"`
+	}
+
+	// halfClosingConn closes only the writing side of the connection, so the service can end the responses in flight
+	halfClosingConn struct {
+		net.Conn
+	}
+)
+
+// WithAddress connects to an indexer service listening on the address, unix:///path or tcp://host:port,
+// instead of spawning an indexer sub-process
+func WithAddress(address string) func(*IndexerOptions) {
+	return func(opts *IndexerOptions) {
+		opts.Address = address
+	}
+}
+
+// connectIndexer connects to an indexer service started with --listen, the model and the chroma server it uses are
+// the ones of the service, only the collection, and how its embeddings are compared, are selected by the connection
+func connectIndexer(ctx context.Context, options *IndexerOptions) (*RunningIndexer, error) {
+	logger := zerolog.Ctx(ctx)
+
+	network, address := parseAddress(options.Address)
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to indexer at %s: %w", options.Address, err)
+	}
+
+	logger.Trace().Str("address", options.Address).Msg("connected to indexer service")
+	runningIndexer := initRunningIndexer(ctx, nil, halfClosingConn{conn}, conn, io.NopCloser(strings.NewReader("")))
+	// the service loaded its model when started, it is expected to be the selected one
+	runningIndexer.useModel(options.Model)
+	runningIndexer.watch(options.HangTimeout)
+	runningIndexer.compressAbove = options.CompressAbove
+	runningIndexer.drainTimeout = options.DrainTimeout
+	runningIndexer.limitInFlight(options.MaxInFlight)
+
+	if options.Collection != "" || options.Metric != "" {
+		bytes, err := json.Marshal(map[string]connectionOptions{"options": {
+			Collection: options.Collection,
+			Metric:     options.Metric,
+			Normalized: options.Normalized,
+		}})
+		if err != nil {
+			_ = runningIndexer.Close()
+			return nil, fmt.Errorf("failed to marshal connection options: %w", err)
+		}
+		if err := writeMessage(conn, bytes); err != nil {
+			_ = runningIndexer.Close()
+			return nil, fmt.Errorf("failed to send connection options: %w", err)
+		}
+	}
+
+	return runningIndexer, nil
+}
+
+// parseAddress returns the network and the address to dial, an address without scheme is a tcp one
+func parseAddress(address string) (network string, dialAddress string) {
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		return "unix", path
+	}
+	return "tcp", strings.TrimPrefix(address, "tcp://")
+}
+
+func (c halfClosingConn) Close() error {
+	if closer, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,167 @@
+package embedding
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     string
+		wantNetwork string
+		wantAddress string
+	}{
+		{
+			name:        "it should dial a unix socket",
+			address:     "unix:///run/mm/indexer.sock",
+			wantNetwork: "unix",
+			wantAddress: "/run/mm/indexer.sock",
+		},
+		{
+			name:        "it should dial a tcp address",
+			address:     "tcp://indexer:7800",
+			wantNetwork: "tcp",
+			wantAddress: "indexer:7800",
+		},
+		{
+			name:        "it should dial tcp without scheme",
+			address:     "localhost:7800",
+			wantNetwork: "tcp",
+			wantAddress: "localhost:7800",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			network, address := parseAddress(tt.address)
+
+			// THEN
+			assert.Equal(t, tt.wantNetwork, network)
+			assert.Equal(t, tt.wantAddress, address)
+		})
+	}
+}
+
+func TestRunIndexer_Address(t *testing.T) {
+	// GIVEN
+	socket := filepath.Join(t.TempDir(), "indexer.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		_ = writeMessage(conn, []byte(`{"status": "READY", "protocol": 2}`))
+
+		var messages []string
+		reader := bufio.NewReader(conn)
+		for {
+			message, err := readMessage(reader)
+			if err != nil {
+				break
+			}
+			messages = append(messages, string(message))
+			if len(messages) == 2 {
+				_ = writeMessage(conn, fmt.Appendf(nil, `{"request_id": "%s", "kind": "store", "status": "success", "count": 3, "dimensions": 384}`, requestID(message)))
+			}
+		}
+		received <- messages
+	}()
+
+	// WHEN
+	indexer, err := RunIndexer(context.Background(), WithAddress("unix://"+socket), WithCollection("feature_x"))
+	require.NoError(t, err)
+	go func() {
+		for range indexer.Events() {
+		}
+	}()
+	require.NoError(t, indexer.WaitReady())
+	count, dimensions, err := indexer.Stats()
+	require.NoError(t, err)
+	require.NoError(t, indexer.Close())
+
+	// THEN
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 384, dimensions)
+	assert.Equal(t, DefaultModel, indexer.ModelID())
+	assert.Equal(t, DefaultDimensions, indexer.Dimensions())
+	messages := <-received
+	require.Len(t, messages, 2)
+	assert.JSONEq(t, `{"options": {"collection": "feature_x"}}`, messages[0])
+	assert.Contains(t, messages[1], `"store"`)
+}
+
+func TestRunIndexer_Model(t *testing.T) {
+	// GIVEN
+	socket := filepath.Join(t.TempDir(), "indexer.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		_ = writeMessage(conn, []byte(`{"status": "READY", "protocol": 2}`))
+
+		reader := bufio.NewReader(conn)
+		for {
+			message, err := readMessage(reader)
+			if err != nil {
+				return
+			}
+			_ = writeMessage(conn, fmt.Appendf(nil, `{"request_id": "%s", "kind": "embed", "status": "success", "embeddings": [[0.1, 0.2, 0.3]]}`, requestID(message)))
+		}
+	}()
+
+	// WHEN
+	indexer, err := RunIndexer(context.Background(), WithAddress("unix://"+socket), WithModel("all-mpnet-base-v2"))
+	require.NoError(t, err)
+	go func() {
+		for range indexer.Events() {
+		}
+	}()
+	require.NoError(t, indexer.WaitReady())
+	dimensionsBefore := indexer.Dimensions()
+	_, err = indexer.EmbedQuery(Query{Text: "refresh the token"})
+	require.NoError(t, err)
+	require.NoError(t, indexer.Close())
+
+	// THEN
+	assert.Equal(t, "all-mpnet-base-v2", indexer.ModelID())
+	assert.Equal(t, 0, dimensionsBefore, "it should not know the dimensions of another model before the first embedding")
+	assert.Equal(t, 3, indexer.Dimensions())
+}
+
+// requestID returns the id of the request, echoed by the responses of the indexer
+func requestID(message []byte) string {
+	var request struct {
+		RequestID string `json:"request_id"`
+	}
+	_ = json.Unmarshal(message, &request)
+	return request.RequestID
+}
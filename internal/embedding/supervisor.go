@@ -0,0 +1,243 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/rs/zerolog"
+)
+
+// defaultMaxRestarts is how many times an indexer is restarted during a run before its failures are returned
+const defaultMaxRestarts = 5
+
+type (
+	SupervisorOptions struct {
+		// MaxRestarts is how many times the indexer is restarted before giving up, never restarted if zero
+		MaxRestarts int
+	}
+
+	SupervisorOption func(*SupervisorOptions)
+
+	// Supervisor runs an indexer and restarts it when it crashes or is killed as hung, the requests failing because
+	// the indexer exited are sent again to the new one, so the callers do not notice the restart
+	Supervisor struct {
+		ctx     context.Context
+		start   func(ctx context.Context) (*RunningIndexer, error)
+		options *SupervisorOptions
+
+		lock     sync.Mutex
+		indexer  *RunningIndexer
+		restarts atomic.Int64
+		// restarting is the restart in progress, the requests failing meanwhile wait for it, nil if there is none
+		restarting *supervisorRestart
+		// closed is set once the supervisor is closed, an indexer started by a restart in progress is closed as well
+		closed bool
+
+		// progress is the progress of the indexers started so far, the counts of the restarted ones being added to
+		// the ones of the indexers they replaced
+		progress chan IndexerProgress
+		reported IndexerProgress
+	}
+
+	// supervisorRestart is a restart of the indexer, done is closed once indexer or err is set
+	supervisorRestart struct {
+		done    chan struct{}
+		indexer *RunningIndexer
+		err     error
+	}
+)
+
+// WithMaxRestarts sets how many times the indexer is restarted before giving up, never restarted if zero
+func WithMaxRestarts(maxRestarts int) SupervisorOption {
+	return func(opts *SupervisorOptions) {
+		opts.MaxRestarts = maxRestarts
+	}
+}
+
+// Supervise starts the indexer with start, and again each time it exits while requests are sent to it
+func Supervise(ctx context.Context, start func(ctx context.Context) (*RunningIndexer, error), opts ...SupervisorOption) (*Supervisor, error) {
+	options := &SupervisorOptions{MaxRestarts: defaultMaxRestarts}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	indexer, err := start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	supervisor := &Supervisor{
+		ctx:      ctx,
+		start:    start,
+		options:  options,
+		indexer:  indexer,
+		progress: make(chan IndexerProgress, 1),
+	}
+	supervisor.follow(indexer, IndexerProgress{})
+	return supervisor, nil
+}
+
+// EmbedDocuments computes the embeddings of the chunks, sent again to a restarted indexer if the current one exits
+func (s *Supervisor) EmbedDocuments(chunks []code.Chunk) ([][]float32, error) {
+	var embeddings [][]float32
+	err := s.retry(func(indexer *RunningIndexer) (err error) {
+		embeddings, err = indexer.EmbedDocuments(chunks)
+		return err
+	})
+	return embeddings, err
+}
+
+// EmbedQuery computes the embedding of the query, sent again to a restarted indexer if the current one exits
+func (s *Supervisor) EmbedQuery(query Query) ([]float32, error) {
+	var vector []float32
+	err := s.retry(func(indexer *RunningIndexer) (err error) {
+		vector, err = indexer.EmbedQuery(query)
+		return err
+	})
+	return vector, err
+}
+
+// CountTokens counts the tokens of the chunks, sent again to a restarted indexer if the current one exits
+func (s *Supervisor) CountTokens(chunks []code.Chunk) ([]int, error) {
+	var tokens []int
+	err := s.retry(func(indexer *RunningIndexer) (err error) {
+		tokens, err = indexer.CountTokens(chunks)
+		return err
+	})
+	return tokens, err
+}
+
+func (s *Supervisor) Dimensions() int {
+	return s.current().Dimensions()
+}
+
+func (s *Supervisor) ModelID() string {
+	return s.current().ModelID()
+}
+
+func (s *Supervisor) WaitReady() error {
+	return s.current().WaitReady()
+}
+
+// Progress returns the last progress reported by the indexers, each one replacing the previous one if it was not read
+func (s *Supervisor) Progress() <-chan IndexerProgress {
+	return s.progress
+}
+
+// Restarts returns the number of times the indexer was restarted
+func (s *Supervisor) Restarts() int64 {
+	return s.restarts.Load()
+}
+
+func (s *Supervisor) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	indexer := s.indexer
+	s.lock.Unlock()
+	return indexer.Close()
+}
+
+func (s *Supervisor) current() *RunningIndexer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.indexer
+}
+
+// retry sends the request to the current indexer, and once again to a restarted one if the indexer exited
+func (s *Supervisor) retry(send func(indexer *RunningIndexer) error) error {
+	indexer := s.current()
+	err := send(indexer)
+	if err == nil || s.ctx.Err() != nil || !(errors.Is(err, errIndexerExited) || indexer.hasExited()) {
+		return err
+	}
+	// a restarted indexer would speak the same protocol
+	if errors.Is(err, ErrProtocolMismatch) {
+		return err
+	}
+
+	restarted, restartErr := s.restart(indexer, err)
+	if restartErr != nil {
+		return errors.Join(err, restartErr)
+	}
+	return send(restarted)
+}
+
+// restart replaces the exited indexer, unless another request already replaced it, or is replacing it, the new
+// indexer is started without holding the lock, so the other requests and the progress are not blocked meanwhile
+func (s *Supervisor) restart(exited *RunningIndexer, cause error) (*RunningIndexer, error) {
+	s.lock.Lock()
+	if s.indexer != exited {
+		defer s.lock.Unlock()
+		return s.indexer, nil
+	}
+	if restarting := s.restarting; restarting != nil {
+		s.lock.Unlock()
+		<-restarting.done
+		return restarting.indexer, restarting.err
+	}
+	if s.closed {
+		defer s.lock.Unlock()
+		return nil, fmt.Errorf("indexer not restarted, the supervisor is closed")
+	}
+	if s.restarts.Load() >= int64(s.options.MaxRestarts) {
+		defer s.lock.Unlock()
+		return nil, fmt.Errorf("indexer not restarted, already restarted %d times", s.restarts.Load())
+	}
+	restarting := &supervisorRestart{done: make(chan struct{})}
+	s.restarting = restarting
+	s.lock.Unlock()
+	defer close(restarting.done)
+
+	logger := zerolog.Ctx(s.ctx)
+	logger.Warn().Err(cause).Int64("restarts", s.restarts.Load()+1).Msg("indexer exited, restarting it")
+	_ = exited.Close()
+	indexer, err := s.startReady()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.restarting = nil
+	if err == nil && s.closed {
+		// closed while the indexer was starting, it would never be closed otherwise
+		_ = indexer.Close()
+		indexer, err = nil, fmt.Errorf("indexer not restarted, the supervisor is closed")
+	}
+	if err != nil {
+		restarting.err = err
+		return nil, err
+	}
+	s.indexer = indexer
+	s.restarts.Add(1)
+	s.follow(indexer, s.reported)
+	restarting.indexer = indexer
+	return indexer, nil
+}
+
+// startReady starts a new indexer, and waits for it to be ready
+func (s *Supervisor) startReady() (*RunningIndexer, error) {
+	indexer, err := s.start(s.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restart indexer: %w", err)
+	}
+	if err := indexer.WaitReady(); err != nil {
+		_ = indexer.Close()
+		return nil, fmt.Errorf("failed to restart indexer: %w", err)
+	}
+	return indexer, nil
+}
+
+// follow forwards the progress of the indexer, added to the progress of the indexers it replaced
+func (s *Supervisor) follow(indexer *RunningIndexer, replaced IndexerProgress) {
+	go func() {
+		for progress := range indexer.Progress() {
+			progress.Embedded += replaced.Embedded
+			progress.Stored += replaced.Stored
+			s.lock.Lock()
+			s.reported = progress
+			s.lock.Unlock()
+			offerProgress(s.progress, progress)
+		}
+	}()
+}
@@ -0,0 +1,140 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor_EmbedDocuments(t *testing.T) {
+	// crashingIndexers starts indexers crashing on their first request, the last one answering them
+	crashingIndexers := func(t *testing.T, crashes int) func(ctx context.Context) (*RunningIndexer, error) {
+		var lock sync.Mutex
+		started := 0
+		return func(ctx context.Context) (*RunningIndexer, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			started++
+			crashing := started <= crashes
+			var exitOnce sync.Once
+			var exit chan struct{}
+			indexer, exit := pipeIndexer(t, func(id string, request map[string]any) map[string]any {
+				if crashing {
+					exitOnce.Do(func() { close(exit) })
+					return nil
+				}
+				return map[string]any{"kind": "embed", "status": "success", "embeddings": [][]float32{{1}, {2}}}
+			})
+			t.Cleanup(func() { exitOnce.Do(func() { close(exit) }) })
+			return indexer, nil
+		}
+	}
+
+	t.Run("it should send the chunks again to a restarted indexer", func(t *testing.T) {
+		// GIVEN
+		supervisor, err := Supervise(context.Background(), crashingIndexers(t, 1))
+		require.NoError(t, err)
+
+		// WHEN
+		embeddings, err := supervisor.EmbedDocuments([]code.Chunk{{Id: "a"}, {Id: "b"}})
+
+		// THEN
+		require.NoError(t, err)
+		assert.Equal(t, [][]float32{{1}, {2}}, embeddings)
+		assert.Equal(t, int64(1), supervisor.Restarts())
+	})
+
+	t.Run("it should give up once the indexer was restarted too many times", func(t *testing.T) {
+		// GIVEN
+		supervisor, err := Supervise(context.Background(), crashingIndexers(t, 3), WithMaxRestarts(1))
+		require.NoError(t, err)
+
+		// WHEN
+		_, err = supervisor.EmbedDocuments([]code.Chunk{{Id: "a"}, {Id: "b"}})
+		_, errAfterRestart := supervisor.EmbedDocuments([]code.Chunk{{Id: "a"}, {Id: "b"}})
+
+		// THEN
+		assert.ErrorIs(t, err, errIndexerExited)
+		assert.ErrorIs(t, errAfterRestart, errIndexerExited)
+		assert.ErrorContains(t, errAfterRestart, "already restarted 1 times")
+		assert.Equal(t, int64(1), supervisor.Restarts())
+	})
+
+	t.Run("it should restart the indexer once for the concurrent requests, without blocking the other calls", func(t *testing.T) {
+		// GIVEN
+		crashing := crashingIndexers(t, 1)
+		starting, release := make(chan struct{}), make(chan struct{})
+		started := 0
+		supervisor, err := Supervise(context.Background(), func(ctx context.Context) (*RunningIndexer, error) {
+			if started++; started == 2 {
+				close(starting)
+				<-release
+			}
+			return crashing(ctx)
+		})
+		require.NoError(t, err)
+
+		// WHEN
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = supervisor.EmbedDocuments([]code.Chunk{{Id: "a"}, {Id: "b"}})
+			}()
+		}
+		<-starting
+		modelID := supervisor.ModelID()
+		close(release)
+		wg.Wait()
+
+		// THEN
+		assert.Empty(t, modelID, "it should answer while the indexer restarts")
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, int64(1), supervisor.Restarts())
+		assert.Equal(t, 2, started)
+	})
+
+	t.Run("it should close the indexer started while the supervisor is closed", func(t *testing.T) {
+		// GIVEN
+		crashing := crashingIndexers(t, 1)
+		starting, release := make(chan struct{}), make(chan struct{})
+		var restarted *RunningIndexer
+		started := 0
+		supervisor, err := Supervise(context.Background(), func(ctx context.Context) (*RunningIndexer, error) {
+			if started++; started == 1 {
+				return crashing(ctx)
+			}
+			close(starting)
+			<-release
+			indexer, err := crashing(ctx)
+			restarted = indexer
+			return indexer, err
+		})
+		require.NoError(t, err)
+
+		// WHEN
+		result := make(chan error)
+		go func() {
+			_, err := supervisor.EmbedDocuments([]code.Chunk{{Id: "a"}, {Id: "b"}})
+			result <- err
+		}()
+		<-starting
+		require.NoError(t, supervisor.Close())
+		close(release)
+		err = <-result
+
+		// THEN
+		assert.ErrorContains(t, err, "the supervisor is closed")
+		require.NotNil(t, restarted)
+		_, err = restarted.EmbedDocuments([]code.Chunk{{Id: "a"}, {Id: "b"}})
+		assert.Error(t, err, "it should close the restarted indexer")
+	})
+}
@@ -0,0 +1,198 @@
+package embedding
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+//go:embed python/uv.lock
+var uvLock []byte
+
+const (
+	// venvDirectoryName is the virtual environment created with pip when uv is not installed, apart from the one of uv
+	venvDirectoryName = "venv"
+	// venvInstalledName records the checksum of the lock the virtual environment was installed from
+	venvInstalledName = ".mm-installed"
+	constraintsName   = "constraints.txt"
+)
+
+// ErrNoPython is returned when neither uv nor a python supported by the scripts is installed
+var ErrNoPython = errors.New("no python found to run the indexer")
+
+// pythonCandidates are the interpreters looked for when uv is not installed
+var pythonCandidates = []string{"python3", "python"}
+
+// hasUV checks whether uv is installed, the python indexer then runs with uv run
+func hasUV() bool {
+	_, err := exec.LookPath("uv")
+	return err == nil
+}
+
+// prepareVenv creates a virtual environment in the lib directory with the python of the system, and installs the
+// dependencies of the scripts with pip, pinned by the lock of uv, returns the python of the virtual environment
+func prepareVenv(ctx context.Context, libPath string) (string, error) {
+	logger := zerolog.Ctx(ctx)
+
+	venv := filepath.Join(libPath, venvDirectoryName)
+	python := venvPython(venv)
+	checksum := computeChecksum(uvLock)
+	if installed, err := os.ReadFile(filepath.Join(venv, venvInstalledName)); err == nil && string(installed) == checksum {
+		return python, nil
+	}
+
+	required := RequiredPython()
+	system, err := findPython(ctx, required)
+	if err != nil {
+		return "", err
+	}
+	logger.Info().Str("python", system).Str("venv", venv).Msg("uv is not installed, installing the dependencies of the indexer with pip, it can take a few minutes")
+	if output, err := exec.CommandContext(ctx, system, "-m", "venv", "--clear", venv).CombinedOutput(); err != nil {
+		return "", fmt.Errorf(
+			"failed to create the virtual environment of the indexer with %s (%s), install the venv module of python "+
+				"(e.g. apt install python3-venv), or uv (https://docs.astral.sh/uv/): %w",
+			system,
+			lastOutputLine(output),
+			err,
+		)
+	}
+
+	requirements, constraints := lockedRequirements(uvLock)
+	constraintsPath := filepath.Join(libPath, constraintsName)
+	if err := os.WriteFile(constraintsPath, []byte(strings.Join(constraints, "\n")+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write the constraints of the indexer: %w", err)
+	}
+	args := append([]string{"-m", "pip", "install", "--disable-pip-version-check", "-c", constraintsPath}, requirements...)
+	if output, err := exec.CommandContext(ctx, python, args...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf(
+			"failed to install the dependencies of the indexer with pip (%s), check the access to the python package "+
+				"index, or install uv (https://docs.astral.sh/uv/): %w",
+			lastOutputLine(output),
+			err,
+		)
+	}
+	if err := os.WriteFile(filepath.Join(venv, venvInstalledName), []byte(checksum), 0644); err != nil {
+		return "", fmt.Errorf("failed to mark the virtual environment of the indexer as installed: %w", err)
+	}
+	return python, nil
+}
+
+// findPython returns the first python of the system satisfying the requirement of the scripts
+func findPython(ctx context.Context, required string) (string, error) {
+	var found []string
+	for _, candidate := range pythonCandidates {
+		path, err := exec.LookPath(candidate)
+		if err != nil {
+			continue
+		}
+		output, err := exec.CommandContext(ctx, path, "-c", "import sys; print('%d.%d' % sys.version_info[:2])").Output()
+		if err != nil {
+			continue
+		}
+		version := strings.TrimSpace(string(output))
+		if satisfiesPython(version, required) {
+			return path, nil
+		}
+		found = append(found, fmt.Sprintf("%s is %s", path, version))
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("%w: uv is not installed, nor python, install uv (https://docs.astral.sh/uv/), or python %s", ErrNoPython, required)
+	}
+	return "", fmt.Errorf(
+		"%w: uv is not installed, and the indexer requires python %s (%s), install uv (https://docs.astral.sh/uv/), or python %s",
+		ErrNoPython,
+		required,
+		strings.Join(found, ", "),
+		required,
+	)
+}
+
+// satisfiesPython checks a major.minor version against a minimum version, e.g. >=3.13, other requirements are
+// accepted, pip refuses the unsupported versions anyway
+func satisfiesPython(version string, required string) bool {
+	minimum, found := strings.CutPrefix(required, ">=")
+	if !found {
+		return true
+	}
+	return compareVersions(version, strings.TrimSpace(minimum)) >= 0
+}
+
+// compareVersions compares dotted numeric versions, the missing components are zeros
+func compareVersions(a string, b string) int {
+	left := strings.Split(a, ".")
+	right := strings.Split(b, ".")
+	for i := 0; i < max(len(left), len(right)); i++ {
+		var l, r int
+		if i < len(left) {
+			l, _ = strconv.Atoi(left[i])
+		}
+		if i < len(right) {
+			r, _ = strconv.Atoi(right[i])
+		}
+		if l != r {
+			return l - r
+		}
+	}
+	return 0
+}
+
+// lockedRequirements reads the lock of uv, returning the direct dependencies of the scripts, and the versions of all
+// the locked packages as constraints of pip, only the packages needed on the platform are installed
+func lockedRequirements(lock []byte) (requirements []string, constraints []string) {
+	var name, version string
+	var project, inDependencies bool
+	flush := func() {
+		if name != "" && version != "" && !project {
+			constraints = append(constraints, name+"=="+version)
+		}
+		name, version, project, inDependencies = "", "", false, false
+	}
+	for _, line := range strings.Split(string(lock), "\n") {
+		switch {
+		case line == "[[package]]":
+			flush()
+		case strings.HasPrefix(line, "["):
+			// a sub table of the package, e.g. its dev dependencies
+			inDependencies = false
+		case strings.HasPrefix(line, "name = ") && name == "":
+			name = strings.Trim(strings.TrimPrefix(line, "name = "), `"`)
+		case strings.HasPrefix(line, "version = ") && version == "":
+			version = strings.Trim(strings.TrimPrefix(line, "version = "), `"`)
+		case strings.HasPrefix(line, "source = ") && strings.Contains(line, "virtual"):
+			// the scripts themselves
+			project = true
+		case project && line == "dependencies = [":
+			inDependencies = true
+		case inDependencies && line == "]":
+			inDependencies = false
+		case inDependencies:
+			if _, rest, found := strings.Cut(line, `name = "`); found {
+				dependency, _, _ := strings.Cut(rest, `"`)
+				requirements = append(requirements, dependency)
+			}
+		}
+	}
+	flush()
+	return requirements, constraints
+}
+
+func venvPython(venv string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(venv, "Scripts", "python.exe")
+	}
+	return filepath.Join(venv, "bin", "python")
+}
+
+func lastOutputLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,112 @@
+package embedding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSatisfiesPython(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		required string
+		want     bool
+	}{
+		{
+			name:     "it should accept the minimum version",
+			version:  "3.13",
+			required: ">=3.13",
+			want:     true,
+		},
+		{
+			name:     "it should accept a later version",
+			version:  "3.14",
+			required: ">=3.13",
+			want:     true,
+		},
+		{
+			name:     "it should compare the components as numbers",
+			version:  "3.9",
+			required: ">=3.13",
+			want:     false,
+		},
+		{
+			name:     "it should refuse an older major version",
+			version:  "2.7",
+			required: ">=3.13",
+			want:     false,
+		},
+		{
+			name:     "it should leave the other requirements to pip",
+			version:  "3.11",
+			required: "~=3.12",
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			satisfied := satisfiesPython(tt.version, tt.required)
+
+			// THEN
+			assert.Equal(t, tt.want, satisfied)
+		})
+	}
+}
+
+func TestLockedRequirements(t *testing.T) {
+	t.Run("it should pin the dependencies of the scripts with the lock", func(t *testing.T) {
+		// GIVEN
+		lock := `version = 1
+requires-python = ">=3.13"
+
+[[package]]
+name = "chromadb"
+version = "1.0.15"
+source = { registry = "https://pypi.org/simple" }
+dependencies = [
+    { name = "numpy" },
+]
+
+[[package]]
+name = "my-memory"
+version = "0.1.0"
+source = { virtual = "." }
+dependencies = [
+    { name = "chromadb" },
+    { name = "sentence-transformers" },
+]
+
+[package.dev-dependencies]
+dev = [
+    { name = "pytest" },
+]
+
+[[package]]
+name = "numpy"
+version = "2.3.1"
+source = { registry = "https://pypi.org/simple" }
+`
+
+		// WHEN
+		requirements, constraints := lockedRequirements([]byte(lock))
+
+		// THEN
+		assert.Equal(t, []string{"chromadb", "sentence-transformers"}, requirements)
+		assert.Equal(t, []string{"chromadb==1.0.15", "numpy==2.3.1"}, constraints)
+	})
+
+	t.Run("it should read the lock of the scripts", func(t *testing.T) {
+		// WHEN
+		requirements, constraints := lockedRequirements(uvLock)
+
+		// THEN
+		assert.Equal(t, []string{"chromadb", "sentence-transformers"}, requirements)
+		assert.NotEmpty(t, constraints)
+		for _, constraint := range constraints {
+			assert.Contains(t, constraint, "==")
+			assert.NotContains(t, constraint, "my-memory")
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package embedding
+
+import "context"
+
+const (
+	// DefaultVoyageURL is the base url of the Voyage AI API
+	DefaultVoyageURL = "https://api.voyageai.com/v1"
+	// DefaultVoyageModel is the code embedding model of Voyage AI
+	DefaultVoyageModel = "voyage-code-3"
+)
+
+type (
+	// voyageProvider calls the Voyage AI embeddings API
+	voyageProvider struct{}
+
+	voyageRequest struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+		// InputType prepends the prompt of the model for documents or queries
+		InputType  string `json:"input_type"`
+		Truncation bool   `json:"truncation"`
+	}
+)
+
+// NewVoyage creates an embedder using the model of the Voyage AI API at baseURL
+func NewVoyage(ctx context.Context, baseURL string, apiKey string, model string, opts ...HostedOption) *Hosted {
+	return newHosted(ctx, voyageProvider{}, baseURL, apiKey, model, opts...)
+}
+
+func (voyageProvider) name() string {
+	return "voyage"
+}
+
+func (voyageProvider) path() string {
+	return "/embeddings"
+}
+
+// limits are the ones of voyage-code-3, 1000 inputs and 120K tokens per request, 32K tokens per input
+func (voyageProvider) limits() hostedLimits {
+	return hostedLimits{maxTexts: 128, maxTokens: 120_000, maxTextTokens: 32_000}
+}
+
+func (voyageProvider) request(model string, texts []string, query bool) any {
+	inputType := "document"
+	if query {
+		inputType = "query"
+	}
+	return voyageRequest{Model: model, Input: texts, InputType: inputType, Truncation: true}
+}
+
+// embeddings decodes the response, it has the shape of the one of the OpenAI API
+func (voyageProvider) embeddings(content []byte) ([][]float32, error) {
+	return decodeIndexedEmbeddings(content)
+}
@@ -0,0 +1,244 @@
+// Package gc removes the artifacts accumulating in the working directory: the lib directories of the uninstalled
+// versions of mm, and the temporary files left by interrupted runs
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLibMaxAge is how long a lib directory can stay unused before its version is considered uninstalled
+	DefaultLibMaxAge = 30 * 24 * time.Hour
+
+	// DefaultTempMaxAge is how old a temporary file must be to be considered orphaned, younger ones can belong to a
+	// running process
+	DefaultTempMaxAge = time.Hour
+)
+
+// DataDirs are the directories of the working directory written by mm, the only ones where the files with a .tmp
+// suffix are its own, other files of the working directory only when named with the .mm- prefix
+var DataDirs = []string{"manifests", "generations", "cache", "models", "metadata", "local"}
+
+type (
+	Options struct {
+		LibMaxAge  time.Duration
+		TempMaxAge time.Duration
+		// DryRun only reports the artifacts, without removing them
+		DryRun bool
+		Now    time.Time
+		// Skip are directories of the working directory not walked for temporary files, e.g. the chroma data
+		Skip []string
+		// DataDirs are the directories of the working directory where the .tmp files are removed, see DataDirs
+		DataDirs []string
+	}
+
+	Option func(*Options)
+
+	// Artifact is a file or a directory removed by the collection
+	Artifact struct {
+		Path   string
+		Reason string
+		Bytes  int64
+	}
+)
+
+// WithLibMaxAge removes the lib directories unused for longer than maxAge
+func WithLibMaxAge(maxAge time.Duration) Option {
+	return func(opts *Options) {
+		opts.LibMaxAge = maxAge
+	}
+}
+
+// WithTempMaxAge removes the temporary files older than maxAge
+func WithTempMaxAge(maxAge time.Duration) Option {
+	return func(opts *Options) {
+		opts.TempMaxAge = maxAge
+	}
+}
+
+// WithDryRun only reports what would be removed
+func WithDryRun(dryRun bool) Option {
+	return func(opts *Options) {
+		opts.DryRun = dryRun
+	}
+}
+
+// WithDataDirs removes the .tmp files of the directories as well, relative to the working directory, e.g. the one of a
+// store configured in it
+func WithDataDirs(dirs ...string) Option {
+	return func(opts *Options) {
+		opts.DataDirs = append(opts.DataDirs, dirs...)
+	}
+}
+
+// WithSkip does not look for temporary files in the directories
+func WithSkip(dirs ...string) Option {
+	return func(opts *Options) {
+		opts.Skip = append(opts.Skip, dirs...)
+	}
+}
+
+// Collect removes the artifacts of the working directory, libPath being the lib directory of the running version,
+// always kept, the lib directories of the other versions are kept while they are used
+func Collect(wd string, libPath string, opts ...Option) ([]Artifact, error) {
+	options := buildOptions(opts...)
+	wd = filepath.Clean(wd)
+
+	libArtifacts, err := outdatedLibs(filepath.Dir(libPath), filepath.Base(libPath), options)
+	if err != nil {
+		return nil, err
+	}
+	skip := append([]string{filepath.Dir(libPath)}, options.Skip...)
+	tempArtifacts, err := orphanedTempFiles(wd, skip, options)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := append(libArtifacts, tempArtifacts...)
+	if options.DryRun {
+		return artifacts, nil
+	}
+
+	for _, artifact := range artifacts {
+		if err := os.RemoveAll(artifact.Path); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", artifact.Path, err)
+		}
+	}
+	return artifacts, nil
+}
+
+// outdatedLibs lists the lib directories of the versions not used recently, and the files of the layout before the
+// lib directories were versioned
+func outdatedLibs(libRoot string, current string, options *Options) ([]Artifact, error) {
+	entries, err := os.ReadDir(libRoot)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lib directory: %w", err)
+	}
+
+	var artifacts []Artifact
+	for _, entry := range entries {
+		if entry.Name() == current {
+			continue
+		}
+		path := filepath.Join(libRoot, entry.Name())
+		if !entry.IsDir() || entry.Name() == ".venv" {
+			artifacts = append(artifacts, Artifact{Path: path, Reason: "unversioned lib", Bytes: size(path)})
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if options.Now.Sub(info.ModTime()) > options.LibMaxAge {
+			artifacts = append(artifacts, Artifact{Path: path, Reason: "unused lib version", Bytes: size(path)})
+		}
+	}
+	return artifacts, nil
+}
+
+// orphanedTempFiles lists the temporary files of the working directory old enough to be left by interrupted runs
+func orphanedTempFiles(wd string, skip []string, options *Options) ([]Artifact, error) {
+	var artifacts []Artifact
+	err := filepath.WalkDir(wd, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && isSkipped(path, skip) {
+			return filepath.SkipDir
+		}
+		if !isTemporary(path, wd, entry, options.DataDirs) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if options.Now.Sub(info.ModTime()) > options.TempMaxAge {
+			artifacts = append(artifacts, Artifact{Path: path, Reason: "temporary file", Bytes: size(path)})
+		}
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk working directory: %w", err)
+	}
+	return artifacts, nil
+}
+
+// isTemporary tells whether the entry is written by mm before being renamed in place, or extracted from a snapshot,
+// the files of the user sharing the working directory are left untouched
+func isTemporary(path string, wd string, entry fs.DirEntry, dataDirs []string) bool {
+	name := entry.Name()
+	if entry.IsDir() {
+		return filepath.Dir(path) == wd && strings.HasPrefix(name, "snapshot-")
+	}
+	if strings.HasPrefix(name, ".mm-write-check-") {
+		return true
+	}
+	return strings.HasSuffix(name, ".tmp") && isDataFile(path, wd, dataDirs)
+}
+
+// isDataFile tells whether the file is inside one of the data directories of the working directory
+func isDataFile(path string, wd string, dataDirs []string) bool {
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range dataDirs {
+		if strings.HasPrefix(rel, filepath.Clean(dir)+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSkipped(path string, skip []string) bool {
+	for _, dir := range skip {
+		if filepath.Clean(dir) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// size is the number of bytes of the file, or of the files of the directory
+func size(path string) int64 {
+	var total int64
+	_ = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+func buildOptions(opts ...Option) *Options {
+	options := &Options{
+		LibMaxAge:  DefaultLibMaxAge,
+		TempMaxAge: DefaultTempMaxAge,
+		Now:        time.Now(),
+		DataDirs:   slices.Clone(DataDirs),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
@@ -0,0 +1,92 @@
+package gc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollect(t *testing.T) {
+	// GIVEN
+	wd := t.TempDir()
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	current := filepath.Join(wd, "lib", "current")
+	write(t, filepath.Join(current, "indexer.py"), old)
+	write(t, filepath.Join(wd, "lib", "recent", "indexer.py"), time.Now())
+	write(t, filepath.Join(wd, "lib", "uninstalled", "indexer.py"), old)
+	write(t, filepath.Join(wd, "lib", "indexer.py.sha256"), time.Now())
+	write(t, filepath.Join(wd, "manifests", "0123456789abcdef.json.tmp"), old)
+	write(t, filepath.Join(wd, "manifests", "fedcba9876543210.json.tmp"), time.Now())
+	write(t, filepath.Join(wd, "manifests", "0123456789abcdef.json"), old)
+	write(t, filepath.Join(wd, "snapshot-1234", "data", "store.gob"), old)
+	require.NoError(t, os.Chtimes(filepath.Join(wd, "snapshot-1234"), old, old))
+	write(t, filepath.Join(wd, "chroma", "data.tmp"), old)
+	write(t, filepath.Join(wd, "notes", "draft.tmp"), old)
+	write(t, filepath.Join(wd, "draft.tmp"), old)
+	write(t, filepath.Join(wd, ".mm-write-check-1234"), old)
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantPaths []string
+		wantLeft  []string
+	}{
+		{
+			name:      "it should only report the artifacts in dry run",
+			opts:      []Option{WithDryRun(true), WithSkip(filepath.Join(wd, "chroma"))},
+			wantPaths: []string{"lib/indexer.py.sha256", "lib/uninstalled", "manifests/0123456789abcdef.json.tmp", "snapshot-1234", ".mm-write-check-1234"},
+			wantLeft:  []string{"lib/uninstalled", "snapshot-1234"},
+		},
+		{
+			name:      "it should remove the unused lib versions and the orphaned temporary files",
+			opts:      []Option{WithSkip(filepath.Join(wd, "chroma"))},
+			wantPaths: []string{"lib/indexer.py.sha256", "lib/uninstalled", "manifests/0123456789abcdef.json.tmp", "snapshot-1234", ".mm-write-check-1234"},
+			wantLeft: []string{
+				"lib/current",
+				"lib/recent",
+				"manifests/fedcba9876543210.json.tmp",
+				"manifests/0123456789abcdef.json",
+				"chroma/data.tmp",
+				"notes/draft.tmp",
+				"draft.tmp",
+			},
+		},
+		{
+			name:      "it should remove the temporary files of the added data directories",
+			opts:      []Option{WithSkip(filepath.Join(wd, "chroma")), WithDataDirs("notes")},
+			wantPaths: []string{"notes/draft.tmp"},
+			wantLeft:  []string{"draft.tmp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			artifacts, err := Collect(wd, current, tt.opts...)
+
+			// THEN
+			require.NoError(t, err)
+			var paths []string
+			for _, artifact := range artifacts {
+				rel, err := filepath.Rel(wd, artifact.Path)
+				require.NoError(t, err)
+				paths = append(paths, rel)
+			}
+			assert.ElementsMatch(t, tt.wantPaths, paths)
+			for _, left := range tt.wantLeft {
+				_, err := os.Stat(filepath.Join(wd, left))
+				assert.NoError(t, err, "it should keep %s", left)
+			}
+		})
+	}
+}
+
+func write(t *testing.T, path string, modifiedAt time.Time) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("artifact"), 0644))
+	require.NoError(t, os.Chtimes(path, modifiedAt, modifiedAt))
+	require.NoError(t, os.Chtimes(filepath.Dir(path), modifiedAt, modifiedAt))
+}
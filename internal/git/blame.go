@@ -0,0 +1,130 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// uncommittedSha is the sha reported by git blame for lines not committed yet
+const uncommittedSha = "0000000000000000000000000000000000000000"
+
+type (
+	Commit struct {
+		Sha           string
+		Subject       string
+		CommitterTime int64
+	}
+
+	// Blame holds, for each line of a file, the commit which last touched it
+	Blame struct {
+		commits map[string]*Commit
+		lines   []string // sha per line, index 0 is line 1
+	}
+)
+
+// BlameFile runs git blame on the given file, the file must be part of a git repository
+func BlameFile(ctx context.Context, filePath string) (*Blame, error) {
+	cmd := exec.CommandContext(ctx, "git", "blame", "--porcelain", "--", filepath.Base(filePath))
+	cmd.Dir = filepath.Dir(filePath)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to blame file %s: %w", filePath, err)
+	}
+
+	return parsePorcelain(out)
+}
+
+func parsePorcelain(out []byte) (*Blame, error) {
+	blame := &Blame{
+		commits: make(map[string]*Commit),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var current *Commit
+	var currentLine int
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\t") {
+			// content line, closes the current entry
+			if current != nil {
+				blame.setLine(currentLine, current.Sha)
+			}
+			current = nil
+			continue
+		}
+
+		if current == nil {
+			// header of an entry: <sha> <original line> <final line> [<number of lines>]
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("unexpected blame header: %q", line)
+			}
+			finalLine, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("unexpected blame header: %q: %w", line, err)
+			}
+			sha := fields[0]
+			commit, found := blame.commits[sha]
+			if !found {
+				commit = &Commit{Sha: sha}
+				blame.commits[sha] = commit
+			}
+			current = commit
+			currentLine = finalLine
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "summary":
+			current.Subject = value
+		case "committer-time":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err == nil {
+				current.CommitterTime = ts
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blame output: %w", err)
+	}
+
+	return blame, nil
+}
+
+func (b *Blame) setLine(line int, sha string) {
+	for len(b.lines) < line {
+		b.lines = append(b.lines, "")
+	}
+	b.lines[line-1] = sha
+}
+
+// LastCommit returns the most recent commit touching the lines between start and end (both inclusive, 1-based),
+// lines not committed yet are ignored.
+func (b *Blame) LastCommit(start int, end int) (Commit, bool) {
+	var last *Commit
+	for line := max(start, 1); line <= end && line <= len(b.lines); line++ {
+		sha := b.lines[line-1]
+		if sha == "" || sha == uncommittedSha {
+			continue
+		}
+		commit := b.commits[sha]
+		if last == nil || commit.CommitterTime > last.CommitterTime {
+			last = commit
+		}
+	}
+	if last == nil {
+		return Commit{}, false
+	}
+
+	return *last, true
+}
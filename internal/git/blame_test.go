@@ -0,0 +1,88 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const porcelainOutput = `aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa 1 1 2
+author John
+committer-time 1700000000
+summary Initial version of the tax calculator
+filename tax.py
+	def calculate_tax(income):
+aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa 2 2
+	    return income * 0.2
+bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb 3 3 1
+author Jane
+committer-time 1710000000
+summary Use progressive rate, required by the new regulation
+filename tax.py
+	    # progressive
+0000000000000000000000000000000000000000 4 4 1
+author Not Committed Yet
+committer-time 1720000000
+summary Version of tax.py from tax.py
+filename tax.py
+	    pass
+`
+
+func TestBlame_LastCommit(t *testing.T) {
+	type args struct {
+		start int
+		end   int
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      Commit
+		wantFound bool
+	}{
+		{
+			name: "it should return the only commit touching the range",
+			args: args{start: 1, end: 2},
+			want: Commit{
+				Sha:           "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				Subject:       "Initial version of the tax calculator",
+				CommitterTime: 1700000000,
+			},
+			wantFound: true,
+		},
+		{
+			name: "it should return the most recent commit touching the range",
+			args: args{start: 1, end: 3},
+			want: Commit{
+				Sha:           "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				Subject:       "Use progressive rate, required by the new regulation",
+				CommitterTime: 1710000000,
+			},
+			wantFound: true,
+		},
+		{
+			name:      "it should ignore lines not committed yet",
+			args:      args{start: 4, end: 4},
+			wantFound: false,
+		},
+		{
+			name:      "it should not find anything outside of the file",
+			args:      args{start: 10, end: 12},
+			wantFound: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			blame, err := parsePorcelain([]byte(porcelainOutput))
+			require.NoError(t, err)
+
+			// WHEN
+			got, found := blame.LastCommit(tt.args.start, tt.args.end)
+
+			// THEN
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
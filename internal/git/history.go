@@ -0,0 +1,55 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Commits returns the hashes of the last commits of the current branch of the repository containing the directory,
+// from the most recent one
+func Commits(ctx context.Context, dir string, count int) ([]string, error) {
+	out, err := run(ctx, dir, "rev-list", "--max-count="+strconv.Itoa(count), "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// ChangedFiles returns the absolute paths of the files of the repository rooted at root which differ from the
+// commit: modified since, staged or not, deleted, and untracked files not ignored
+func ChangedFiles(ctx context.Context, root string, commit string) (map[string]bool, error) {
+	diff, err := run(ctx, root, "diff", "-z", "--name-only", "--no-renames", commit, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := run(ctx, root, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	for _, path := range bytes.Split(append(diff, untracked...), []byte{0}) {
+		if len(path) == 0 {
+			continue
+		}
+		files[filepath.Join(root, filepath.FromSlash(string(path)))] = true
+	}
+	return files, nil
+}
+
+func run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run git %s in %s: %w: %s", args[0], dir, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFiles(t *testing.T) {
+	// GIVEN
+	repository, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	gitRun := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=mm", "-c", "user.email=mm@example.com"}, args...)...)
+		cmd.Dir = repository
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(file string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(repository, file), []byte(content), 0644))
+	}
+	gitRun("init", "-q")
+	write("kept.go", "package main")
+	write("modified.go", "package main")
+	write("deleted.go", "package main")
+	write(".gitignore", "ignored.go\n")
+	gitRun("add", ".")
+	gitRun("commit", "-q", "-m", "first")
+	write("committed.go", "package main")
+	gitRun("add", ".")
+	gitRun("commit", "-q", "-m", "second")
+	write("modified.go", "package main // changed")
+	require.NoError(t, os.Remove(filepath.Join(repository, "deleted.go")))
+	write("untracked.go", "package main")
+	write("ignored.go", "package main")
+
+	commits, err := Commits(context.Background(), repository, 5)
+	require.NoError(t, err)
+	require.Len(t, commits, 2, "it should list the commits from the most recent one")
+
+	// WHEN
+	changed, err := ChangedFiles(context.Background(), repository, commits[1])
+
+	// THEN
+	require.NoError(t, err)
+	want := make(map[string]bool)
+	for _, file := range []string{"committed.go", "modified.go", "deleted.go", "untracked.go"} {
+		want[filepath.Join(repository, file)] = true
+	}
+	assert.Equal(t, want, changed)
+}
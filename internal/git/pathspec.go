@@ -0,0 +1,39 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// ListFiles returns the absolute paths of the files of the directory matching the git pathspecs, relative to it, e.g.
+// 'src/**' or ':!src/generated', tracked files and untracked ones not ignored are listed, the directory must be part
+// of a git repository
+func ListFiles(ctx context.Context, dir string, pathspecs []string) (map[string]bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", dir, err)
+	}
+
+	args := append([]string{"ls-files", "-z", "--cached", "--others", "--exclude-standard", "--"}, pathspecs...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = absDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve pathspecs in %s (it must be a git repository): %w: %s",
+			dir, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	files := make(map[string]bool)
+	for _, path := range bytes.Split(out, []byte{0}) {
+		if len(path) == 0 {
+			continue
+		}
+		files[filepath.Join(absDir, filepath.FromSlash(string(path)))] = true
+	}
+	return files, nil
+}
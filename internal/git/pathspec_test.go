@@ -0,0 +1,61 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFiles(t *testing.T) {
+	// GIVEN
+	repository, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, exec.Command("git", "init", "-q", repository).Run())
+	for _, file := range []string{"src/auth.go", "src/generated/auth.pb.go", "docs/conf.py", "build/out.go"} {
+		path := filepath.Join(repository, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("package main"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(repository, ".gitignore"), []byte("build/\n"), 0644))
+
+	tests := []struct {
+		name      string
+		pathspecs []string
+		want      []string
+	}{
+		{
+			name:      "it should list the files matching the pathspec, excluding the ones given with :!",
+			pathspecs: []string{"src/**", ":!src/generated"},
+			want:      []string{"src/auth.go"},
+		},
+		{
+			name: "it should list all the files not ignored without pathspec",
+			want: []string{".gitignore", "docs/conf.py", "src/auth.go", "src/generated/auth.pb.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			files, err := ListFiles(context.Background(), repository, tt.pathspecs)
+
+			// THEN
+			require.NoError(t, err)
+			want := make(map[string]bool, len(tt.want))
+			for _, file := range tt.want {
+				want[filepath.Join(repository, filepath.FromSlash(file))] = true
+			}
+			assert.Equal(t, want, files)
+		})
+	}
+}
+
+func TestListFiles_NotARepository(t *testing.T) {
+	_, err := ListFiles(context.Background(), t.TempDir(), []string{"src/**"})
+
+	assert.Error(t, err, "it should fail outside of a git repository")
+}
@@ -0,0 +1,27 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Root returns the root of the git repository containing the directory, or the directory itself if it is not part
+// of a repository
+func Root(ctx context.Context, dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path %s: %w", dir, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel")
+	cmd.Dir = absDir
+	out, err := cmd.Output()
+	if err != nil {
+		// not a repository, or git is not installed
+		return absDir, nil
+	}
+	return filepath.Clean(strings.TrimSpace(string(out))), nil
+}
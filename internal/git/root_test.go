@@ -0,0 +1,50 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoot(t *testing.T) {
+	// GIVEN
+	repository, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, exec.Command("git", "init", "-q", repository).Run())
+	subDir := filepath.Join(repository, "internal", "auth")
+	require.NoError(t, os.MkdirAll(subDir, 0755))
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{
+			name: "it should return the root of the repository containing the directory",
+			dir:  subDir,
+			want: repository,
+		},
+		{
+			name: "it should return the directory itself outside of a repository",
+			dir:  outside,
+			want: outside,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			root, err := Root(context.Background(), tt.dir)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, root)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package glob
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pattern matches paths against a glob, where * matches within a path segment and ** across segments, a pattern
+// without wildcards matches the path itself and everything below it (a directory)
+type Pattern struct {
+	raw    string
+	regexp *regexp.Regexp
+}
+
+// Compile parses the glob pattern, paths are expected to use forward slashes
+func Compile(pattern string) (*Pattern, error) {
+	pattern = filepath.ToSlash(pattern)
+	if !strings.ContainsAny(pattern, "*?") {
+		// the path itself, or anything below it
+		expression := "^" + regexp.QuoteMeta(strings.TrimSuffix(pattern, "/")) + "(/.*)?$"
+		return &Pattern{raw: pattern, regexp: regexp.MustCompile(expression)}, nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// **/ also matches no directory at all
+					i++
+					builder.WriteString("(.*/)?")
+				} else {
+					builder.WriteString(".*")
+				}
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	builder.WriteString("$")
+
+	compiled, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	return &Pattern{raw: pattern, regexp: compiled}, nil
+}
+
+// Match checks if the path matches the pattern
+func (p *Pattern) Match(path string) bool {
+	return p.regexp.MatchString(filepath.ToSlash(path))
+}
+
+func (p *Pattern) String() string {
+	return p.raw
+}
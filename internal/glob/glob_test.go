@@ -0,0 +1,40 @@
+package glob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{name: "it should match files below a directory", pattern: "/src/legacy", path: "/src/legacy/a/b.go", want: true},
+		{name: "it should match the directory itself", pattern: "/src/legacy/", path: "/src/legacy", want: true},
+		{name: "it should not match a sibling with the same prefix", pattern: "/src/legacy", path: "/src/legacy2/b.go"},
+		{name: "it should match any depth with **", pattern: "/src/legacy/**", path: "/src/legacy/a/b/c.go", want: true},
+		{name: "it should match no directory with **/", pattern: "/src/**/*.py", path: "/src/tax.py", want: true},
+		{name: "it should match within a segment with *", pattern: "/src/*.go", path: "/src/main.go", want: true},
+		{name: "it should not cross segments with *", pattern: "/src/*.go", path: "/src/cmd/main.go"},
+		{name: "it should match a single character with ?", pattern: "/src/v?.go", path: "/src/v1.go", want: true},
+		{name: "it should quote regexp characters", pattern: "/src/a+b/*.go", path: "/src/aab/main.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			pattern, err := Compile(tt.pattern)
+			require.NoError(t, err)
+
+			// WHEN
+			got := pattern.Match(tt.path)
+
+			// THEN
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
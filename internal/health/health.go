@@ -0,0 +1,79 @@
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+)
+
+type (
+	// Stats are the counters of a collection, as recorded by the last indexing run and as found in the store
+	Stats struct {
+		Name    string `json:"name"`
+		Backend string `json:"backend"`
+		Model   string `json:"model,omitempty"`
+		// Chunks is the number of chunks in the store, IndexedChunks the number recorded by the indexing runs
+		Chunks        int `json:"chunks"`
+		IndexedChunks int `json:"indexed_chunks"`
+		Files         int `json:"files"`
+		// EvictedFiles had their chunks dropped to keep the collection under its maximum size
+		EvictedFiles int `json:"evicted_files,omitempty"`
+		// IndexedAt is the time of the last indexing run, nil if the collection was never indexed
+		IndexedAt *time.Time `json:"indexed_at,omitempty"`
+		// Problems are empty for a healthy collection
+		Problems []string `json:"problems,omitempty"`
+	}
+)
+
+// Collect gathers the counters of the collection, and checks whether the store diverged from the manifest, or was
+// not indexed for longer than maxAge if not zero
+func Collect(name string, backend string, vectorStore store.VectorStore, indexManifest *manifest.Manifest, maxAge time.Duration, now time.Time) (Stats, error) {
+	storeStats, err := vectorStore.Stats()
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to get stats of collection %s: %w", name, err)
+	}
+
+	paths := indexManifest.Paths()
+	stats := Stats{
+		Name:    name,
+		Backend: backend,
+		Model:   indexManifest.Model(),
+		Chunks:  storeStats.Records,
+	}
+	for _, path := range paths {
+		entry, _ := indexManifest.Get(path)
+		if entry.Evicted {
+			stats.EvictedFiles++
+			continue
+		}
+		stats.Files++
+		stats.IndexedChunks += len(entry.ChunkIds)
+	}
+	if at := indexManifest.IndexedAt(); !at.IsZero() {
+		stats.IndexedAt = &at
+	}
+
+	if stats.Chunks != stats.IndexedChunks {
+		stats.Problems = append(stats.Problems, fmt.Sprintf(
+			"diverged: %d chunk(s) in the store, %d recorded by the indexing runs",
+			stats.Chunks,
+			stats.IndexedChunks,
+		))
+	}
+	if maxAge > 0 {
+		switch {
+		case stats.IndexedAt == nil:
+			stats.Problems = append(stats.Problems, "stalled: never indexed")
+		case now.Sub(*stats.IndexedAt) > maxAge:
+			stats.Problems = append(stats.Problems, fmt.Sprintf("stalled: not indexed for %s", now.Sub(*stats.IndexedAt).Round(time.Second)))
+		}
+	}
+	return stats, nil
+}
+
+// Healthy checks that no problem was found
+func (s Stats) Healthy() bool {
+	return len(s.Problems) == 0
+}
@@ -0,0 +1,76 @@
+package health
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollect(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		chunkIds     []string
+		indexedAt    time.Time
+		maxAge       time.Duration
+		wantProblems []string
+	}{
+		{
+			name:      "it should report a collection matching its manifest as healthy",
+			chunkIds:  []string{"tax.py_calculate_tax_1"},
+			indexedAt: now.Add(-time.Hour),
+			maxAge:    24 * time.Hour,
+		},
+		{
+			name:         "it should report a store diverging from the manifest",
+			chunkIds:     []string{"tax.py_calculate_tax_1", "tax.py_TAX_RATE_5"},
+			indexedAt:    now.Add(-time.Hour),
+			wantProblems: []string{"diverged: 1 chunk(s) in the store, 2 recorded by the indexing runs"},
+		},
+		{
+			name:         "it should report a collection not indexed for too long",
+			chunkIds:     []string{"tax.py_calculate_tax_1"},
+			indexedAt:    now.Add(-48 * time.Hour),
+			maxAge:       24 * time.Hour,
+			wantProblems: []string{"stalled: not indexed for 48h0m0s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			dir := t.TempDir()
+			vectorStore, err := store.OpenLocal(filepath.Join(dir, "store.gob"))
+			require.NoError(t, err)
+			records, err := store.NewRecords(
+				[]code.Chunk{{Id: "tax.py_calculate_tax_1", Metadata: code.ChunkMetadata{FilePath: "tax.py"}}},
+				[][]float32{{1, 0}},
+			)
+			require.NoError(t, err)
+			require.NoError(t, vectorStore.Upsert(records))
+
+			indexManifest, err := manifest.Load(filepath.Join(dir, "manifest.json"))
+			require.NoError(t, err)
+			indexManifest.Put("/src/tax.py", manifest.Entry{FilePath: "tax.py", ChunkIds: tt.chunkIds})
+			indexManifest.Put("/src/legacy.py", manifest.Entry{FilePath: "legacy.py", Evicted: true})
+			indexManifest.MarkIndexed(tt.indexedAt, "all-MiniLM-L6-v2")
+
+			// WHEN
+			stats, err := Collect("code_chunks", "local", vectorStore, indexManifest, tt.maxAge, now)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, 1, stats.Chunks)
+			assert.Equal(t, 1, stats.Files)
+			assert.Equal(t, 1, stats.EvictedFiles)
+			assert.Equal(t, "all-MiniLM-L6-v2", stats.Model)
+			assert.Equal(t, tt.wantProblems, stats.Problems)
+		})
+	}
+}
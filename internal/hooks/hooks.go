@@ -0,0 +1,135 @@
+// Package hooks lets the applications embedding mm observe the indexing and the searches, to attach their own metrics
+// or audit without forking the pipeline
+package hooks
+
+import (
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+)
+
+type (
+	// FileIndexed is emitted once a file has been parsed and stored, or skipped as unchanged
+	FileIndexed struct {
+		Path     string
+		Language string
+		Chunks   int
+		// Unchanged is set when the file was skipped, its chunks being already indexed
+		Unchanged bool
+		Elapsed   time.Duration
+	}
+
+	// ChunkEmbedded is emitted for each chunk once its embedding is computed, or reused from a cache
+	ChunkEmbedded struct {
+		Chunk      code.Chunk
+		Dimensions int
+	}
+
+	// FileFailed is emitted when the chunks of a file cannot be embedded or stored, the file being indexed again by
+	// the next run
+	FileFailed struct {
+		Path     string
+		Language string
+		// Stage is where the indexing of the file failed, embed or store
+		Stage string
+		Err   error
+	}
+
+	// Search is emitted once a search completes, Err being set if it failed
+	Search struct {
+		Query       string
+		Collections []string
+		Results     int
+		Elapsed     time.Duration
+		Err         error
+	}
+
+	// Hooks are the callbacks called on the events, a nil Hooks calls nothing
+	Hooks struct {
+		onFileIndexed   []func(FileIndexed)
+		onChunkEmbedded []func(ChunkEmbedded)
+		onSearch        []func(Search)
+
+		onFileFailed []func(FileFailed)
+	}
+
+	Option func(*Hooks)
+)
+
+// New creates the hooks, the callbacks of an event are called in the order they are given
+func New(opts ...Option) *Hooks {
+	h := &Hooks{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// OnFileIndexed calls the hook after each indexed file, from the indexing workers, so concurrently
+func OnFileIndexed(hook func(FileIndexed)) Option {
+	return func(h *Hooks) {
+		h.onFileIndexed = append(h.onFileIndexed, hook)
+	}
+}
+
+// OnChunkEmbedded calls the hook after each embedded chunk, from the indexing workers, so concurrently
+func OnChunkEmbedded(hook func(ChunkEmbedded)) Option {
+	return func(h *Hooks) {
+		h.onChunkEmbedded = append(h.onChunkEmbedded, hook)
+	}
+}
+
+// OnFileFailed calls the hook after each file failing to be embedded or stored, from the indexing workers, so
+// concurrently
+func OnFileFailed(hook func(FileFailed)) Option {
+	return func(h *Hooks) {
+		h.onFileFailed = append(h.onFileFailed, hook)
+	}
+}
+
+// OnSearch calls the hook after each search, successful or not
+func OnSearch(hook func(Search)) Option {
+	return func(h *Hooks) {
+		h.onSearch = append(h.onSearch, hook)
+	}
+}
+
+// FileIndexed calls the hooks of the indexed files
+func (h *Hooks) FileIndexed(event FileIndexed) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.onFileIndexed {
+		hook(event)
+	}
+}
+
+// ChunkEmbedded calls the hooks of the embedded chunks
+func (h *Hooks) ChunkEmbedded(event ChunkEmbedded) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.onChunkEmbedded {
+		hook(event)
+	}
+}
+
+// FileFailed calls the hooks of the files failing to be indexed
+func (h *Hooks) FileFailed(event FileFailed) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.onFileFailed {
+		hook(event)
+	}
+}
+
+// Search calls the hooks of the searches
+func (h *Hooks) Search(event Search) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.onSearch {
+		hook(event)
+	}
+}
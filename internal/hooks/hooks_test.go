@@ -0,0 +1,43 @@
+package hooks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	// GIVEN
+	var calls []string
+	h := New(
+		OnFileIndexed(func(event FileIndexed) { calls = append(calls, "first "+event.Path) }),
+		OnFileIndexed(func(event FileIndexed) { calls = append(calls, "second "+event.Path) }),
+		OnSearch(func(event Search) { calls = append(calls, "search "+event.Query) }),
+		OnFileFailed(func(event FileFailed) { calls = append(calls, "failed "+event.Path) }),
+	)
+
+	// WHEN
+	h.FileIndexed(FileIndexed{Path: "tax.py"})
+	h.ChunkEmbedded(ChunkEmbedded{Dimensions: 384})
+	h.Search(Search{Query: "vat rate"})
+	h.FileFailed(FileFailed{Path: "vat.py"})
+
+	// THEN
+	assert.Equal(t, []string{"first tax.py", "second tax.py", "search vat rate", "failed vat.py"}, calls, "it should call the hooks in order")
+}
+
+func TestHooks_Nil(t *testing.T) {
+	// GIVEN
+	var h *Hooks
+
+	// WHEN
+	call := func() {
+		h.FileIndexed(FileIndexed{Path: "tax.py"})
+		h.ChunkEmbedded(ChunkEmbedded{})
+		h.Search(Search{})
+		h.FileFailed(FileFailed{})
+	}
+
+	// THEN
+	assert.NotPanics(t, call, "it should call nothing without hooks")
+}
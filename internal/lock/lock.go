@@ -0,0 +1,207 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/netfs"
+)
+
+const (
+	// retryInterval is the delay between two attempts to acquire a lock held by another process
+	retryInterval = 500 * time.Millisecond
+	// unreadableGrace is the age from which an unreadable lock file is considered left by a crash while writing it
+	unreadableGrace = time.Minute
+)
+
+// ErrLocked is returned when the lock is held by another process
+var ErrLocked = errors.New("locked by another process")
+
+type (
+	// Lock is a lock file held by the process, e.g. while writing an index
+	Lock struct {
+		path string
+		// token identifies the acquisition, the lock file is only removed while it holds it
+		token string
+	}
+
+	// Owner describes the process holding a lock, recorded in the lock file
+	Owner struct {
+		Pid       int       `json:"pid"`
+		Host      string    `json:"host"`
+		StartedAt time.Time `json:"started_at"`
+		// Token is unique to the acquisition, a lock taken over and acquired again by the same pid has another one
+		Token string `json:"token,omitempty"`
+	}
+
+	// LockedError is returned when the lock is held by another process, it wraps ErrLocked
+	LockedError struct {
+		Owner Owner
+	}
+)
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf(
+		"%s (pid %d on %s, since %s)",
+		ErrLocked,
+		e.Owner.Pid,
+		e.Owner.Host,
+		e.Owner.StartedAt.Local().Format(time.DateTime),
+	)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// Acquire creates the lock file at path, waiting up to wait for another process to release it, a lock left by a
+// process of this host which is no longer running is taken over
+func Acquire(ctx context.Context, path string, wait time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	network := netfs.IsNetwork(filepath.Dir(path))
+	owner, err := newOwner()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err := create(path, network, owner)
+		if err == nil {
+			return &Lock{path: path, token: owner.Token}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		owner, stale := inspect(path)
+		if stale {
+			takeOver(path)
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, &LockedError{Owner: owner}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(retryInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// Release removes the lock file, unless it was taken over by another process since it was acquired, e.g. after this one
+// was considered stale, the lock is then the one of the other process
+func (l *Lock) Release() error {
+	content, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read lock %s: %w", l.path, err)
+	}
+	var owner Owner
+	if json.Unmarshal(content, &owner) != nil || owner.Token != l.token {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to release lock %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// takeOver removes the stale lock, another process may take it over at the same time and acquire it before this one
+// removes it, so the lock is first renamed to a name unique to the process, atomically, and put back unless the renamed
+// one is still stale
+func takeOver(path string) {
+	host, _ := os.Hostname()
+	unique := fmt.Sprintf("%s.stale.%s.%d", path, host, os.Getpid())
+	if err := os.Rename(path, unique); err != nil {
+		// released, or taken over by another process
+		return
+	}
+	if _, stale := inspect(unique); !stale {
+		// acquired by another process since it was inspected, linked back unless yet another one acquired it
+		_ = os.Link(unique, path)
+	}
+	_ = os.Remove(unique)
+}
+
+// create writes the lock file, exclusive creation being unreliable on network filesystems (NFSv2 and v3), the file is
+// written under a name unique to the process there, and hard linked to path, which is atomic
+func create(path string, network bool, owner Owner) error {
+	if !network {
+		return write(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, owner)
+	}
+	host, _ := os.Hostname()
+	unique := fmt.Sprintf("%s.%s.%d", path, host, os.Getpid())
+	if err := write(unique, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, owner); err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(unique)
+	}()
+	return os.Link(unique, path)
+}
+
+// newOwner returns the owner of a lock acquired by the process, with a token unique to the acquisition
+func newOwner() (Owner, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return Owner{}, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	host, _ := os.Hostname()
+	return Owner{
+		Pid:       os.Getpid(),
+		Host:      host,
+		StartedAt: time.Now(),
+		Token:     fmt.Sprintf("%d-%s", os.Getpid(), hex.EncodeToString(nonce)),
+	}, nil
+}
+
+// write creates the file with the owner of the lock, it is removed if it cannot be written
+func write(path string, flag int, owner Owner) error {
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(owner)
+	if err == nil {
+		_, err = file.Write(content)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// inspect reads the owner of the lock, and checks whether it was left by a process which is no longer running
+func inspect(path string) (Owner, bool) {
+	var owner Owner
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// released in the meantime
+		return owner, true
+	}
+	if err != nil || json.Unmarshal(content, &owner) != nil {
+		// being written, or left by a crash while writing it
+		info, statErr := os.Stat(path)
+		return owner, statErr == nil && time.Since(info.ModTime()) > unreadableGrace
+	}
+	host, _ := os.Hostname()
+	// the processes of other hosts cannot be checked, their locks are only released by them
+	return owner, owner.Host == host && !running(owner.Pid)
+}
@@ -0,0 +1,131 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquire(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "locks", "index.lock")
+	held, err := Acquire(context.Background(), path, 0)
+	require.NoError(t, err)
+
+	// WHEN
+	_, lockedErr := Acquire(context.Background(), path, 0)
+	require.NoError(t, held.Release())
+	reacquired, err := Acquire(context.Background(), path, 0)
+
+	// THEN
+	require.ErrorIs(t, lockedErr, ErrLocked, "it should fail fast while the lock is held")
+	var locked *LockedError
+	require.ErrorAs(t, lockedErr, &locked)
+	assert.Equal(t, os.Getpid(), locked.Owner.Pid)
+	require.NoError(t, err, "it should acquire the released lock")
+	require.NoError(t, reacquired.Release())
+}
+
+func TestAcquire_Wait(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.lock")
+	held, err := Acquire(context.Background(), path, 0)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = held.Release()
+	}()
+
+	// WHEN
+	lock, err := Acquire(context.Background(), path, 5*time.Second)
+
+	// THEN
+	require.NoError(t, err, "it should wait for the lock to be released")
+	require.NoError(t, lock.Release())
+}
+
+func TestAcquire_Stale(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.lock")
+	host, err := os.Hostname()
+	require.NoError(t, err)
+	// no process runs with the maximum pid
+	content, err := json.Marshal(Owner{Pid: 1<<22 + 1, Host: host, StartedAt: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0644))
+
+	// WHEN
+	lock, err := Acquire(context.Background(), path, 0)
+
+	// THEN
+	require.NoError(t, err, "it should take over a lock left by a process no longer running")
+	require.NoError(t, lock.Release())
+}
+
+func TestRelease_TakenOver(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.lock")
+	held, err := Acquire(context.Background(), path, 0)
+	require.NoError(t, err)
+	// considered stale, taken over and acquired by another process
+	require.NoError(t, os.Remove(path))
+	other, err := Acquire(context.Background(), path, 0)
+	require.NoError(t, err)
+
+	// WHEN
+	err = held.Release()
+
+	// THEN
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "it should not remove the lock of another process")
+	require.NoError(t, other.Release())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "it should remove its own lock")
+}
+
+func TestTakeOver_Acquired(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.lock")
+	// inspected as stale, then released and acquired by another process before being taken over
+	owner, err := newOwner()
+	require.NoError(t, err)
+	require.NoError(t, create(path, false, owner))
+
+	// WHEN
+	takeOver(path)
+
+	// THEN
+	inspected, stale := inspect(path)
+	assert.False(t, stale, "it should put back a lock acquired since it was inspected")
+	assert.Equal(t, os.Getpid(), inspected.Pid)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "it should remove the renamed lock")
+}
+
+func TestCreate_Network(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "index.lock")
+	owner, err := newOwner()
+	require.NoError(t, err)
+	require.NoError(t, create(path, true, owner))
+
+	// WHEN
+	err = create(path, true, owner)
+
+	// THEN
+	require.ErrorIs(t, err, os.ErrExist, "it should fail to link over a held lock")
+	inspected, stale := inspect(path)
+	assert.False(t, stale)
+	assert.Equal(t, os.Getpid(), inspected.Pid)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "it should remove the file linked to the lock")
+}
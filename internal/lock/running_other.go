@@ -0,0 +1,8 @@
+//go:build !unix
+
+package lock
+
+// running cannot be checked on this platform, the process is assumed to be running
+func running(int) bool {
+	return true
+}
@@ -0,0 +1,108 @@
+package manifest
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minAssetTerm is the length of the shortest word of a query matched against the paths of the assets
+const minAssetTerm = 3
+
+// Asset is a non-code file cataloged without being parsed nor embedded, so it can be located by its name or its path
+type Asset struct {
+	// FilePath is the path of the file as found by the indexing run
+	FilePath   string `json:"file_path"`
+	Type       string `json:"type"`
+	Hash       string `json:"hash"`
+	Size       int64  `json:"size"`
+	ModifiedAt int64  `json:"modified_at"`
+}
+
+// Asset returns the asset cataloged at the absolute path
+func (m *Manifest) Asset(path string) (Asset, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	asset, found := m.assets[path]
+	return asset, found
+}
+
+// PutAsset catalogs the asset at the absolute path
+func (m *Manifest) PutAsset(path string, asset Asset) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.assets[path] = asset
+	m.dirty = true
+}
+
+// RemoveAsset removes the asset at the absolute path from the catalog
+func (m *Manifest) RemoveAsset(path string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, found := m.assets[path]; found {
+		delete(m.assets, path)
+		m.dirty = true
+	}
+}
+
+// AssetPaths returns the sorted paths of the assets cataloged in the directory, or any of its subdirectories
+func (m *Manifest) AssetPaths(dir string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	var paths []string
+	for path := range m.assets {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// FindAssets returns the assets whose path contains words of the query, the ones matching the most words first, all
+// the assets for an empty query, words shorter than 3 characters are ignored
+func (m *Manifest) FindAssets(query string) []Asset {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) >= minAssetTerm {
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) == 0 && strings.TrimSpace(query) != "" {
+		return nil
+	}
+
+	matches := make(map[string]int)
+	var assets []Asset
+	for _, asset := range m.assets {
+		path := strings.ToLower(filepath.ToSlash(asset.FilePath))
+		count := 0
+		for _, term := range terms {
+			if strings.Contains(path, term) {
+				count++
+			}
+		}
+		if count > 0 || len(terms) == 0 {
+			matches[asset.FilePath] = count
+			assets = append(assets, asset)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		if matches[assets[i].FilePath] != matches[assets[j].FilePath] {
+			return matches[assets[i].FilePath] > matches[assets[j].FilePath]
+		}
+		return assets[i].FilePath < assets[j].FilePath
+	})
+	return assets
+}
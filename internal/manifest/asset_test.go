@@ -0,0 +1,79 @@
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest_FindAssets(t *testing.T) {
+	// GIVEN
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	manifest.PutAsset("/src/static/logo.png", Asset{FilePath: "static/logo.png", Type: "image"})
+	manifest.PutAsset("/src/static/logo-dark.svg", Asset{FilePath: "static/logo-dark.svg", Type: "image"})
+	manifest.PutAsset("/src/models/ranker.onnx", Asset{FilePath: "models/Ranker.onnx", Type: "model"})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "it should return the assets matching the most words first",
+			query: "dark logo",
+			want:  []string{"static/logo-dark.svg", "static/logo.png"},
+		},
+		{
+			name:  "it should ignore the case",
+			query: "where is the ranker model",
+			want:  []string{"models/Ranker.onnx"},
+		},
+		{
+			name:  "it should ignore the short words",
+			query: "a of",
+		},
+		{
+			name:  "it should return all the assets for an empty query",
+			query: "",
+			want:  []string{"models/Ranker.onnx", "static/logo-dark.svg", "static/logo.png"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			assets := manifest.FindAssets(tt.query)
+
+			// THEN
+			var paths []string
+			for _, asset := range assets {
+				paths = append(paths, asset.FilePath)
+			}
+			assert.Equal(t, tt.want, paths)
+		})
+	}
+}
+
+func TestManifest_Assets(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "store.json")
+	manifest, err := Load(path)
+	require.NoError(t, err)
+	manifest.PutAsset("/src/static/logo.png", Asset{FilePath: "static/logo.png", Type: "image", Hash: "h", Size: 3})
+	manifest.PutAsset("/other/dump.sql", Asset{FilePath: "dump.sql", Type: "dump"})
+	manifest.RemoveAsset("/other/dump.sql")
+
+	// WHEN
+	require.NoError(t, manifest.Save())
+	loaded, err := Load(path)
+	require.NoError(t, err)
+
+	// THEN
+	asset, found := loaded.Asset("/src/static/logo.png")
+	assert.True(t, found)
+	assert.Equal(t, Asset{FilePath: "static/logo.png", Type: "image", Hash: "h", Size: 3}, asset)
+	assert.Equal(t, []string{"/src/static/logo.png"}, loaded.AssetPaths("/src"))
+	assert.Empty(t, loaded.AssetPaths("/other"))
+}
@@ -0,0 +1,111 @@
+package manifest
+
+import (
+	"sort"
+	"time"
+)
+
+// Eviction is a file whose chunks are dropped to keep the index under its maximum size
+type Eviction struct {
+	Path   string
+	Entry  Entry
+	Chunks int
+	// Bytes is the estimated size of the file in the index
+	Bytes int64
+}
+
+// IndexSize estimates the size of the file in the index, the content of its chunks and their embeddings of
+// embeddingBytes each, the content of the chunks whose size was not recorded is not counted
+func (e Entry) IndexSize(embeddingBytes int) int64 {
+	var size int64
+	for _, chunk := range e.Chunks {
+		size += chunk.Bytes
+	}
+	return size + int64(len(e.ChunkIds)*embeddingBytes)
+}
+
+// IndexSize estimates the size of the index, see Entry.IndexSize
+func (m *Manifest) IndexSize(embeddingBytes int) int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var size int64
+	for _, entry := range m.files {
+		size += entry.IndexSize(embeddingBytes)
+	}
+	return size
+}
+
+// MarkMatched records that chunks of the files were returned by a search, the files are identified by the path
+// recorded in the metadata of their chunks
+func (m *Manifest) MarkMatched(filePaths []string, at time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	matched := make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		matched[filePath] = true
+	}
+	for path, entry := range m.files {
+		if matched[entry.FilePath] {
+			entry.MatchedAt = at.Unix()
+			m.files[path] = entry
+			m.dirty = true
+		}
+	}
+}
+
+// Evictions selects the files to evict for the index to fit in maxSize, the least recently matched ones first when
+// leastRecentlyMatched is set, the oldest ones otherwise, the files are not evicted yet, see Evict
+func (m *Manifest) Evictions(maxSize int64, embeddingBytes int, leastRecentlyMatched bool) []Eviction {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var size int64
+	candidates := make([]Eviction, 0, len(m.files))
+	for path, entry := range m.files {
+		evictionSize := entry.IndexSize(embeddingBytes)
+		size += evictionSize
+		if len(entry.ChunkIds) > 0 {
+			candidates = append(candidates, Eviction{Path: path, Entry: entry, Chunks: len(entry.ChunkIds), Bytes: evictionSize})
+		}
+	}
+	if size <= maxSize {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].Entry, candidates[j].Entry
+		if leastRecentlyMatched && a.MatchedAt != b.MatchedAt {
+			return a.MatchedAt < b.MatchedAt
+		}
+		if a.ModifiedAt != b.ModifiedAt {
+			return a.ModifiedAt < b.ModifiedAt
+		}
+		return candidates[i].Path < candidates[j].Path
+	})
+
+	var evictions []Eviction
+	for _, candidate := range candidates {
+		if size <= maxSize {
+			break
+		}
+		evictions = append(evictions, candidate)
+		size -= candidate.Bytes
+	}
+	return evictions
+}
+
+// Evict forgets the chunks of the file, once they have been deleted, the file is kept so it is not indexed again until
+// it changes
+func (m *Manifest) Evict(path string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if entry, found := m.files[path]; found {
+		entry.ChunkIds = nil
+		entry.Chunks = nil
+		entry.Evicted = true
+		m.files[path] = entry
+		m.dirty = true
+	}
+}
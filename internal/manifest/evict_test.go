@@ -0,0 +1,80 @@
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest_Evictions(t *testing.T) {
+	// GIVEN
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	// 100 bytes of content and 1 embedding of 4 bytes, 104 bytes per file
+	entry := func(filePath string, modifiedAt int64) Entry {
+		return Entry{FilePath: filePath, ModifiedAt: modifiedAt, ChunkIds: []string{"1"}, Chunks: []ChunkStats{{Type: "functions", Count: 1, Bytes: 100}}}
+	}
+	manifest.Put("/src/old.py", entry("old.py", 1))
+	manifest.Put("/src/recent.py", entry("recent.py", 3))
+	manifest.Put("/src/matched.py", entry("matched.py", 2))
+	manifest.Put("/src/empty.py", Entry{FilePath: "empty.py"})
+	manifest.MarkMatched([]string{"matched.py"}, time.Unix(10, 0))
+
+	tests := []struct {
+		name                 string
+		maxSize              int64
+		leastRecentlyMatched bool
+		want                 []string
+	}{
+		{
+			name:    "it should evict nothing when the index fits",
+			maxSize: 312,
+		},
+		{
+			name:    "it should evict the oldest files first",
+			maxSize: 150,
+			want:    []string{"/src/old.py", "/src/matched.py"},
+		},
+		{
+			name:                 "it should evict the least recently matched files first",
+			maxSize:              150,
+			leastRecentlyMatched: true,
+			want:                 []string{"/src/old.py", "/src/recent.py"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			evictions := manifest.Evictions(tt.maxSize, 4, tt.leastRecentlyMatched)
+
+			// THEN
+			var paths []string
+			for _, eviction := range evictions {
+				paths = append(paths, eviction.Path)
+			}
+			assert.Equal(t, tt.want, paths)
+		})
+	}
+}
+
+func TestManifest_Evict(t *testing.T) {
+	// GIVEN
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	manifest.Put("/src/tax.py", Entry{Language: "python", Size: 42, ChunkIds: []string{"1"}, Chunks: []ChunkStats{{Type: "functions", Count: 1, Bytes: 100}}})
+
+	// WHEN
+	manifest.Evict("/src/tax.py")
+
+	// THEN
+	entry, found := manifest.Get("/src/tax.py")
+	require.True(t, found, "it should keep the file, so it is not indexed again until it changes")
+	assert.True(t, entry.Evicted)
+	assert.Empty(t, entry.ChunkIds)
+	assert.Equal(t, int64(42), entry.Size)
+	assert.Equal(t, int64(0), manifest.IndexSize(1536))
+	assert.Empty(t, manifest.Stats(), "it should not count the evicted files")
+}
@@ -0,0 +1,361 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formatVersion is the version of the layout of the manifest, 2 recording the path of the files in their chunks
+const formatVersion = 2
+
+type (
+	// Entry describes the state of a file when it was last indexed
+	Entry struct {
+		// FilePath is the path of the file as recorded in the metadata of its chunks
+		FilePath   string   `json:"file_path"`
+		Language   string   `json:"language,omitempty"`
+		Hash       string   `json:"hash"`
+		Size       int64    `json:"size"`
+		ModifiedAt int64    `json:"modified_at"`
+		ChunkIds   []string `json:"chunk_ids"`
+
+		// Chunks counts the chunks extracted from the file by type, not recorded by the releases before it
+		Chunks []ChunkStats `json:"chunks,omitempty"`
+
+		// MatchedAt is the unix time a chunk of the file was last returned by a search, only recorded when the index
+		// evicts the least recently matched files
+		MatchedAt int64 `json:"matched_at,omitempty"`
+		// Evicted files had their chunks dropped to keep the index under its maximum size, they are not indexed again
+		// until they change
+		Evicted bool `json:"evicted,omitempty"`
+	}
+
+	// Failure counts the crashes of the parser on a version of a file
+	Failure struct {
+		// Hash of the content the parser crashed on, the count restarts when the file changes
+		Hash      string `json:"hash"`
+		Count     int    `json:"count"`
+		LastError string `json:"last_error"`
+		// Quarantined files are skipped until they change
+		Quarantined bool `json:"quarantined,omitempty"`
+	}
+
+	// Manifest records the indexed files, so unchanged files can be skipped by the next indexing runs
+	Manifest struct {
+		path string
+
+		lock      sync.Mutex
+		files     map[string]Entry
+		failures  map[string]Failure
+		assets    map[string]Asset
+		indexedAt int64
+		model     string
+		schema    int
+		dirty     bool
+	}
+
+	manifestFile struct {
+		Version int `json:"version"`
+		// IndexedAt is the unix time of the last indexing run
+		IndexedAt int64            `json:"indexed_at,omitempty"`
+		Model     string           `json:"model,omitempty"`
+		Files     map[string]Entry `json:"files"`
+		// Failures of the parser, by path
+		Failures map[string]Failure `json:"failures,omitempty"`
+		// Schema is the version of the chunks in the store, see schema.Version
+		Schema int `json:"schema,omitempty"`
+
+		// Assets are the non-code files cataloged by path, see Asset
+		Assets map[string]Asset `json:"assets,omitempty"`
+	}
+)
+
+// Load reads the manifest persisted at path, or creates an empty one if the file does not exist yet
+func Load(path string) (*Manifest, error) {
+	manifest := &Manifest{
+		path:     path,
+		files:    make(map[string]Entry),
+		failures: make(map[string]Failure),
+		assets:   make(map[string]Asset),
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	var file manifestFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", path, err)
+	}
+	if file.Version != formatVersion {
+		// an outdated manifest only means a full re-index
+		return manifest, nil
+	}
+	if file.Files != nil {
+		manifest.files = file.Files
+	}
+	if file.Failures != nil {
+		manifest.failures = file.Failures
+	}
+	if file.Assets != nil {
+		manifest.assets = file.Assets
+	}
+	manifest.indexedAt = file.IndexedAt
+	manifest.model = file.Model
+	manifest.schema = file.Schema
+
+	return manifest, nil
+}
+
+// Hash returns the hash identifying the content of a file
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// MarkIndexed records the time of an indexing run, and the model used to embed the chunks
+func (m *Manifest) MarkIndexed(at time.Time, model string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.indexedAt = at.Unix()
+	m.model = model
+	m.dirty = true
+}
+
+// IndexedAt returns the time of the last indexing run, zero if there was none
+func (m *Manifest) IndexedAt() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.indexedAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(m.indexedAt, 0)
+}
+
+// Model returns the model used by the last indexing run
+func (m *Manifest) Model() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.model
+}
+
+// Schema returns the version of the chunks in the store, 0 if it was not recorded
+func (m *Manifest) Schema() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.schema
+}
+
+// SetSchema records the version of the chunks in the store, once they all have it
+func (m *Manifest) SetSchema(version int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.schema != version {
+		m.schema = version
+		m.dirty = true
+	}
+}
+
+// Get returns the entry of the file, if it has been indexed
+func (m *Manifest) Get(path string) (Entry, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, found := m.files[path]
+	return entry, found
+}
+
+// Put records the entry of an indexed file
+func (m *Manifest) Put(path string, entry Entry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.files[path] = entry
+	m.dirty = true
+}
+
+// Remove forgets a file, once its chunks have been deleted
+func (m *Manifest) Remove(path string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, found := m.files[path]; found {
+		delete(m.files, path)
+		m.dirty = true
+	}
+}
+
+// RemoveChunks forgets chunks deleted from the store, their files are kept so they are not indexed again until they
+// change
+func (m *Manifest) RemoveChunks(ids []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	removed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+	}
+	for path, entry := range m.files {
+		kept := slices.DeleteFunc(slices.Clone(entry.ChunkIds), func(id string) bool { return removed[id] })
+		if len(kept) != len(entry.ChunkIds) {
+			entry.ChunkIds = kept
+			m.files[path] = entry
+			m.dirty = true
+		}
+	}
+}
+
+// RecordFailure counts a crash of the parser on the content of the file, the file is quarantined once the parser
+// crashed quarantineAfter times on the same content, returns the updated failure
+func (m *Manifest) RecordFailure(path string, hash string, reason string, quarantineAfter int) Failure {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	failure := m.failures[path]
+	if failure.Hash != hash {
+		failure = Failure{Hash: hash}
+	}
+	failure.Count++
+	failure.LastError = reason
+	failure.Quarantined = failure.Count >= quarantineAfter
+	m.failures[path] = failure
+	m.dirty = true
+	return failure
+}
+
+// Quarantined checks if the file is quarantined with this content
+func (m *Manifest) Quarantined(path string, hash string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	failure, found := m.failures[path]
+	return found && failure.Quarantined && failure.Hash == hash
+}
+
+// ClearFailure forgets the crashes of the parser on the file, once it has been parsed
+func (m *Manifest) ClearFailure(path string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, found := m.failures[path]; found {
+		delete(m.failures, path)
+		m.dirty = true
+	}
+}
+
+// Failures returns the crashes of the parser by path
+func (m *Manifest) Failures() map[string]Failure {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return maps.Clone(m.failures)
+}
+
+// Paths returns the sorted paths of all the indexed files
+func (m *Manifest) Paths() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Files returns the sorted paths of the files indexed in the directory, or any of its subdirectories
+func (m *Manifest) Files(dir string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	var paths []string
+	for path := range m.files {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Match returns the sorted paths of the indexed files ending with the given path, compared component by component,
+// e.g. the relative path of a frame of a stack trace
+func (m *Manifest) Match(path string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	suffix := filepath.Clean(path)
+	if filepath.IsAbs(suffix) {
+		if _, found := m.files[suffix]; found {
+			return []string{suffix}
+		}
+		return nil
+	}
+	var paths []string
+	for indexed := range m.files {
+		if indexed == suffix || strings.HasSuffix(indexed, string(filepath.Separator)+suffix) {
+			paths = append(paths, indexed)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Save persists the manifest if it changed, the file is replaced atomically
+func (m *Manifest) Save() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.dirty {
+		return nil
+	}
+
+	content, err := json.Marshal(manifestFile{
+		Version:   formatVersion,
+		IndexedAt: m.indexedAt,
+		Model:     m.model,
+		Schema:    m.schema,
+		Files:     m.files,
+		Failures:  m.failures,
+		Assets:    m.assets,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("failed to replace manifest %s: %w", m.path, err)
+	}
+	m.dirty = false
+
+	return nil
+}
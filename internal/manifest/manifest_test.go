@@ -0,0 +1,178 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest_Save(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "manifests", "store.json")
+	manifest, err := Load(path)
+	require.NoError(t, err)
+	entry := Entry{
+		Hash:       Hash([]byte("def calculate_tax(income):")),
+		Size:       26,
+		ModifiedAt: 1700000000,
+		ChunkIds:   []string{"tax.py_calculate_tax_1"},
+	}
+	manifest.Put("/src/tax.py", entry)
+	manifest.SetSchema(3)
+
+	// WHEN
+	require.NoError(t, manifest.Save())
+	reloaded, err := Load(path)
+
+	// THEN
+	require.NoError(t, err)
+	got, found := reloaded.Get("/src/tax.py")
+	assert.True(t, found)
+	assert.Equal(t, entry, got)
+	_, found = reloaded.Get("/src/other.py")
+	assert.False(t, found)
+	assert.Equal(t, 3, reloaded.Schema())
+}
+
+func TestLoad_OutdatedVersion(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "store.json")
+	// written before the entries recorded the path of their chunks
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 1, "files": {"/src/tax.py": {"hash": "abc"}}}`), 0644))
+
+	// WHEN
+	manifest, err := Load(path)
+
+	// THEN
+	require.NoError(t, err)
+	_, found := manifest.Get("/src/tax.py")
+	assert.False(t, found, "it should start from an empty manifest")
+}
+
+func TestManifest_Files(t *testing.T) {
+	// GIVEN
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	manifest.Put("/src/app/tax.py", Entry{})
+	manifest.Put("/src/app/billing/invoice.py", Entry{})
+	manifest.Put("/src/application/main.py", Entry{})
+	manifest.Put("/other/main.go", Entry{})
+
+	// WHEN
+	files := manifest.Files("/src/app")
+
+	// THEN
+	assert.Equal(t, []string{"/src/app/billing/invoice.py", "/src/app/tax.py"}, files, "it should only list the files of the directory")
+}
+
+func TestManifest_Match(t *testing.T) {
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	manifest.Put("/src/app/billing/invoice.py", Entry{})
+	manifest.Put("/src/app/legacy/billing/invoice.py", Entry{})
+	manifest.Put("/src/app/tax.py", Entry{})
+	manifest.Put("/src/app/syntax.py", Entry{})
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "it should match the files ending with the relative path",
+			path: "billing/invoice.py",
+			want: []string{"/src/app/billing/invoice.py", "/src/app/legacy/billing/invoice.py"},
+		},
+		{
+			name: "it should only match whole path components",
+			path: "tax.py",
+			want: []string{"/src/app/tax.py"},
+		},
+		{
+			name: "it should clean the path before matching",
+			path: "./app/../app/tax.py",
+			want: []string{"/src/app/tax.py"},
+		},
+		{
+			name: "it should match an absolute path exactly",
+			path: "/src/app/tax.py",
+			want: []string{"/src/app/tax.py"},
+		},
+		{
+			name: "it should match nothing for an unknown file",
+			path: "/other/tax.py",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			paths := manifest.Match(tt.path)
+
+			// THEN
+			assert.Equal(t, tt.want, paths)
+		})
+	}
+}
+
+func TestManifest_RemoveChunks(t *testing.T) {
+	// GIVEN
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	manifest.Put("/src/tax.py", Entry{ChunkIds: []string{"tax.py_calculate_tax_1", "tax.py_TAX_RATE_5"}})
+
+	// WHEN
+	manifest.RemoveChunks([]string{"tax.py_TAX_RATE_5", "other"})
+
+	// THEN
+	entry, found := manifest.Get("/src/tax.py")
+	assert.True(t, found, "it should keep the file")
+	assert.Equal(t, []string{"tax.py_calculate_tax_1"}, entry.ChunkIds)
+}
+
+func TestManifest_RecordFailure(t *testing.T) {
+	tests := []struct {
+		name            string
+		hashes          []string
+		wantCount       int
+		wantQuarantined bool
+	}{
+		{
+			name:            "it should not quarantine a file below the threshold",
+			hashes:          []string{"abc", "abc"},
+			wantCount:       2,
+			wantQuarantined: false,
+		},
+		{
+			name:            "it should quarantine a file crashing the parser repeatedly",
+			hashes:          []string{"abc", "abc", "abc"},
+			wantCount:       3,
+			wantQuarantined: true,
+		},
+		{
+			name:            "it should restart the count when the file changes",
+			hashes:          []string{"abc", "abc", "def"},
+			wantCount:       1,
+			wantQuarantined: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+			require.NoError(t, err)
+
+			// WHEN
+			var failure Failure
+			for _, hash := range tt.hashes {
+				failure = manifest.RecordFailure("/src/huge.py", hash, "parser timed out", 3)
+			}
+
+			// THEN
+			assert.Equal(t, tt.wantCount, failure.Count)
+			assert.Equal(t, tt.wantQuarantined, manifest.Quarantined("/src/huge.py", tt.hashes[len(tt.hashes)-1]))
+		})
+	}
+}
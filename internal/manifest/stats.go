@@ -0,0 +1,123 @@
+package manifest
+
+import (
+	"sort"
+)
+
+// unknownType names the language or the type of the chunks which were not recorded
+const unknownType = "unknown"
+
+type (
+	// ChunkStats counts the chunks of a type extracted from a file, and the size of their content
+	ChunkStats struct {
+		Type  string `json:"type"`
+		Count int    `json:"count"`
+		Bytes int64  `json:"bytes"`
+	}
+
+	// LanguageStats summarizes the indexed files of a language, and their chunks by type
+	LanguageStats struct {
+		Language string `json:"language"`
+		Files    int    `json:"files"`
+		ContentStats
+		ChunkTypes []ChunkTypeStats `json:"chunk_types"`
+	}
+
+	// ChunkTypeStats summarizes the chunks of a type, for a language
+	ChunkTypeStats struct {
+		Type string `json:"type"`
+		ContentStats
+	}
+
+	// ContentStats counts chunks and the size of their content, the average only covers the chunks whose size was
+	// recorded
+	ContentStats struct {
+		Chunks            int   `json:"chunks"`
+		Bytes             int64 `json:"bytes"`
+		AverageChunkBytes int64 `json:"average_chunk_bytes"`
+
+		sized int
+	}
+)
+
+// Stats summarizes the indexed files and their chunks by language and chunk type, the languages with the most files
+// first, and the chunk types with the most chunks first
+func (m *Manifest) Stats() []LanguageStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	byLanguage := make(map[string]*LanguageStats)
+	byType := make(map[string]map[string]*ChunkTypeStats)
+	for _, entry := range m.files {
+		if entry.Evicted {
+			continue
+		}
+		language := entry.Language
+		if language == "" {
+			language = unknownType
+		}
+		stats, found := byLanguage[language]
+		if !found {
+			stats = &LanguageStats{Language: language}
+			byLanguage[language] = stats
+			byType[language] = make(map[string]*ChunkTypeStats)
+		}
+		stats.Files++
+
+		chunks := entry.Chunks
+		recorded := 0
+		for _, chunk := range chunks {
+			recorded += chunk.Count
+		}
+		if untyped := len(entry.ChunkIds) - recorded; untyped > 0 {
+			// indexed by a release not recording them, or imported
+			chunks = append(chunks, ChunkStats{Type: unknownType, Count: untyped})
+		}
+		for _, chunk := range chunks {
+			if chunk.Type == "" {
+				chunk.Type = unknownType
+			}
+			typeStats, found := byType[language][chunk.Type]
+			if !found {
+				typeStats = &ChunkTypeStats{Type: chunk.Type}
+				byType[language][chunk.Type] = typeStats
+			}
+			sized := chunk.Count
+			if chunk.Type == unknownType && chunk.Bytes == 0 {
+				sized = 0
+			}
+			typeStats.add(chunk.Count, sized, chunk.Bytes)
+			stats.add(chunk.Count, sized, chunk.Bytes)
+		}
+	}
+
+	languages := make([]LanguageStats, 0, len(byLanguage))
+	for language, stats := range byLanguage {
+		for _, typeStats := range byType[language] {
+			stats.ChunkTypes = append(stats.ChunkTypes, *typeStats)
+		}
+		sort.Slice(stats.ChunkTypes, func(i, j int) bool {
+			if stats.ChunkTypes[i].Chunks != stats.ChunkTypes[j].Chunks {
+				return stats.ChunkTypes[i].Chunks > stats.ChunkTypes[j].Chunks
+			}
+			return stats.ChunkTypes[i].Type < stats.ChunkTypes[j].Type
+		})
+		languages = append(languages, *stats)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languages[i].Files != languages[j].Files {
+			return languages[i].Files > languages[j].Files
+		}
+		return languages[i].Language < languages[j].Language
+	})
+	return languages
+}
+
+func (s *ContentStats) add(chunks int, sized int, bytes int64) {
+	s.Chunks += chunks
+	s.Bytes += bytes
+	s.sized += sized
+	if s.sized > 0 {
+		s.AverageChunkBytes = s.Bytes / int64(s.sized)
+	}
+}
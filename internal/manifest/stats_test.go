@@ -0,0 +1,50 @@
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest_Stats(t *testing.T) {
+	// GIVEN
+	manifest, err := Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	manifest.Put("/src/tax.py", Entry{
+		Language: "python",
+		ChunkIds: []string{"1", "2", "3"},
+		Chunks:   []ChunkStats{{Type: "functions", Count: 2, Bytes: 300}, {Type: "classes", Count: 1, Bytes: 900}},
+	})
+	manifest.Put("/src/invoice.py", Entry{
+		Language: "python",
+		ChunkIds: []string{"4", "5"},
+		Chunks:   []ChunkStats{{Type: "functions", Count: 2, Bytes: 500}},
+	})
+	// indexed before the chunks were counted
+	manifest.Put("/src/main.go", Entry{Language: "go", ChunkIds: []string{"6", "7"}})
+
+	// WHEN
+	stats := manifest.Stats()
+
+	// THEN
+	require.Len(t, stats, 2)
+	python := stats[0]
+	assert.Equal(t, "python", python.Language, "it should list the languages with the most files first")
+	assert.Equal(t, 2, python.Files)
+	assert.Equal(t, 5, python.Chunks)
+	assert.Equal(t, int64(1700), python.Bytes)
+	assert.Equal(t, int64(340), python.AverageChunkBytes)
+	require.Len(t, python.ChunkTypes, 2)
+	assert.Equal(t, "functions", python.ChunkTypes[0].Type, "it should list the chunk types with the most chunks first")
+	assert.Equal(t, 4, python.ChunkTypes[0].Chunks)
+	assert.Equal(t, int64(200), python.ChunkTypes[0].AverageChunkBytes)
+	assert.Equal(t, int64(900), python.ChunkTypes[1].AverageChunkBytes)
+
+	golang := stats[1]
+	assert.Equal(t, 2, golang.Chunks, "it should count the chunks whose type was not recorded")
+	require.Len(t, golang.ChunkTypes, 1)
+	assert.Equal(t, "unknown", golang.ChunkTypes[0].Type)
+	assert.Equal(t, int64(0), golang.AverageChunkBytes)
+}
@@ -0,0 +1,43 @@
+// Package netfs detects the network filesystems (NFS, SMB, ...), where the locks of SQLite and of exclusive file
+// creation are unreliable
+package netfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem describes the filesystem of a path
+type FileSystem struct {
+	// Type is the name of the filesystem, e.g. nfs, empty if unknown
+	Type    string
+	Network bool
+}
+
+// Detect returns the filesystem of the path, or of its closest existing parent when it is not created yet
+func Detect(path string) (FileSystem, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return FileSystem{}, err
+	}
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return statfs(path)
+		}
+		parent := filepath.Dir(path)
+		if !errors.Is(err, fs.ErrNotExist) || parent == path {
+			return FileSystem{}, err
+		}
+		path = parent
+	}
+}
+
+// IsNetwork checks whether the path is on a network filesystem, a filesystem which cannot be detected is assumed to be
+// local
+func IsNetwork(path string) bool {
+	fileSystem, err := Detect(path)
+	return err == nil && fileSystem.Network
+}
@@ -0,0 +1,23 @@
+package netfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	// GIVEN
+	dir := t.TempDir()
+
+	// WHEN
+	existing, err := Detect(dir)
+	require.NoError(t, err)
+	missing, missingErr := Detect(filepath.Join(dir, "not", "created", "yet"))
+
+	// THEN
+	require.NoError(t, missingErr, "it should detect the filesystem of the closest existing parent")
+	assert.Equal(t, existing, missing)
+}
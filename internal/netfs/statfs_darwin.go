@@ -0,0 +1,26 @@
+package netfs
+
+import "syscall"
+
+var networkTypes = map[string]bool{
+	"nfs":    true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+	"cifs":   true,
+}
+
+func statfs(path string) (FileSystem, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return FileSystem{}, err
+	}
+	var name []byte
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return FileSystem{Type: string(name), Network: networkTypes[string(name)]}, nil
+}
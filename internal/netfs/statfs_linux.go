@@ -0,0 +1,28 @@
+package netfs
+
+import "syscall"
+
+// magic numbers of the network filesystems, from linux/magic.h
+var networkTypes = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x5346414f: "afs",
+	0x564c:     "ncp",
+	0x01021997: "9p",
+	0x013111a8: "ibrix",
+	0x19830326: "fhgfs",
+	0x0bd00bd0: "lustre",
+	0x47504653: "gpfs",
+	0x00c36400: "ceph",
+}
+
+func statfs(path string) (FileSystem, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return FileSystem{}, err
+	}
+	name, network := networkTypes[uint32(stat.Type)]
+	return FileSystem{Type: name, Network: network}, nil
+}
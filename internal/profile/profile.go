@@ -0,0 +1,66 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+// Start captures a CPU profile in the directory, the returned function stops it and captures the heap and goroutine
+// profiles, all the files of a run share the same timestamp
+func Start(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory %s: %w", dir, err)
+	}
+	prefix := filepath.Join(dir, time.Now().Format("20060102-150405"))
+
+	cpuFile, err := os.Create(prefix + "-cpu.pprof")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cpu profile: %w", err)
+	}
+	if err := rpprof.StartCPUProfile(cpuFile); err != nil {
+		_ = cpuFile.Close()
+		return nil, fmt.Errorf("failed to start cpu profile: %w", err)
+	}
+
+	return func() error {
+		rpprof.StopCPUProfile()
+		errs := []error{cpuFile.Close()}
+
+		// up-to-date statistics of the live heap
+		runtime.GC()
+		errs = append(errs, writeProfile("heap", prefix+"-heap.pprof"))
+		errs = append(errs, writeProfile("goroutine", prefix+"-goroutine.pprof"))
+		return errors.Join(errs...)
+	}, nil
+}
+
+func writeProfile(name string, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s profile: %w", name, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if err := rpprof.Lookup(name).WriteTo(file, 0); err != nil {
+		return fmt.Errorf("failed to write %s profile: %w", name, err)
+	}
+	return nil
+}
+
+// RegisterHandlers exposes the pprof endpoints under /debug/pprof/
+func RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,155 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	reset = "\x1b[0m"
+	bold  = "\x1b[1m"
+	dim   = "\x1b[2m"
+	cyan  = "\x1b[36m"
+)
+
+// maxDuplicatesShown bounds the other locations listed for a result
+const maxDuplicatesShown = 3
+
+// Renderer writes the output of the commands, with colors only if the destination supports them
+type Renderer struct {
+	out   io.Writer
+	color bool
+}
+
+// New creates a renderer writing to out, colors are only used if color is true
+func New(out io.Writer, color bool) *Renderer {
+	return &Renderer{out: out, color: color}
+}
+
+// ColorEnabled checks if colors should be used for the file: never if disabled explicitly, if NO_COLOR is set
+// (https://no-color.org), or if the file is not a terminal (piped to a file, a CI log, ...)
+func ColorEnabled(file *os.File, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fd := file.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// SearchResults writes the results, ranked, with their location and their content
+func (r *Renderer) SearchResults(results []search.Result) {
+	if len(results) == 0 {
+		_, _ = fmt.Fprintln(r.out, "No matches found.")
+		return
+	}
+	for i, result := range results {
+		metadata := result.Metadata
+		_, _ = fmt.Fprintf(
+			r.out,
+			"%s %s %s\n",
+			r.style(bold, fmt.Sprintf("%d.", i+1)),
+			r.style(cyan, fmt.Sprintf("%s%s:%d-%d", collectionPrefix(result), metadata.FilePath, metadata.StartLine, metadata.EndLine)),
+			r.style(dim, fmt.Sprintf("(score %.3f)", result.Score)),
+		)
+		if result.Explanation != nil {
+			_, _ = fmt.Fprintln(r.out, r.style(dim, explanationText(result)))
+		}
+		if duplicates := duplicatesText(result); duplicates != "" {
+			_, _ = fmt.Fprintln(r.out, r.style(dim, duplicates))
+		}
+		_, _ = fmt.Fprintln(r.out, result.Document)
+		_, _ = fmt.Fprintln(r.out)
+	}
+}
+
+// LinesResult writes the chunks covering a line range, ordered by line, then the related chunks, ranked
+func (r *Renderer) LinesResult(result search.LinesResult) {
+	if len(result.Covering) == 0 {
+		_, _ = fmt.Fprintln(r.out, "No chunks cover these lines.")
+		return
+	}
+	r.Chunks(result.Covering)
+	if len(result.Related) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintln(r.out, r.style(bold, "Related:"))
+	r.SearchResults(result.Related)
+}
+
+// Chunks writes the results in their order, with their location and their content, but without score
+func (r *Renderer) Chunks(results []search.Result) {
+	for _, result := range results {
+		metadata := result.Metadata
+		_, _ = fmt.Fprintln(r.out, r.style(cyan, fmt.Sprintf("%s:%d-%d", metadata.FilePath, metadata.StartLine, metadata.EndLine)))
+		_, _ = fmt.Fprintln(r.out, result.Document)
+		_, _ = fmt.Fprintln(r.out)
+	}
+}
+
+// Assets writes the cataloged assets, with their type and their size, nothing if there is none
+func (r *Renderer) Assets(assets []manifest.Asset) {
+	if len(assets) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintln(r.out, r.style(bold, "Assets:"))
+	for _, asset := range assets {
+		_, _ = fmt.Fprintf(
+			r.out,
+			"%s %s\n",
+			r.style(cyan, asset.FilePath),
+			r.style(dim, fmt.Sprintf("(%s, %d bytes)", asset.Type, asset.Size)),
+		)
+	}
+}
+
+// collectionPrefix names the collection of the result, empty when a single collection is searched
+func collectionPrefix(result search.Result) string {
+	if result.Collection == "" {
+		return ""
+	}
+	return "[" + result.Collection + "] "
+}
+
+// explanationText details the contribution of each ranking stage to the score of the result
+func explanationText(result search.Result) string {
+	explanation := result.Explanation
+	text := fmt.Sprintf("vector %.3f (distance %.3f, rank %d", explanation.Vector, explanation.Distance, explanation.VectorRank)
+	if explanation.ExampleWeight > 0 {
+		text += fmt.Sprintf(", example weight %.2f", explanation.ExampleWeight)
+	}
+	text += ")"
+	if explanation.Recency > 0 {
+		text += fmt.Sprintf(" + recency %.3f (changed %s)", explanation.Recency, explanation.ChangedAt.Format(time.DateOnly))
+	}
+	return text + fmt.Sprintf(" = %.3f", result.Score)
+}
+
+// duplicatesText lists the other locations of the content of the result, empty if there is none
+func duplicatesText(result search.Result) string {
+	if len(result.Duplicates) == 0 {
+		return ""
+	}
+	var locations []string
+	for _, metadata := range result.Duplicates[:min(len(result.Duplicates), maxDuplicatesShown)] {
+		locations = append(locations, fmt.Sprintf("%s:%d-%d", metadata.FilePath, metadata.StartLine, metadata.EndLine))
+	}
+	text := "also in " + strings.Join(locations, ", ")
+	if hidden := len(result.Duplicates) - maxDuplicatesShown; hidden > 0 {
+		text += fmt.Sprintf(" and %d more", hidden)
+	}
+	return text
+}
+
+func (r *Renderer) style(style string, text string) string {
+	if !r.color {
+		return text
+	}
+	return style + text + reset
+}
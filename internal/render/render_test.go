@@ -0,0 +1,166 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderer_SearchResults(t *testing.T) {
+	results := []search.Result{
+		{
+			QueryResult: embedding.QueryResult{
+				Document: "def calculate_tax(income):",
+				Metadata: code.ChunkMetadata{FilePath: "tax.py", StartLine: 1, EndLine: 2},
+			},
+			Score: 0.5,
+		},
+	}
+	tests := []struct {
+		name    string
+		results []search.Result
+		color   bool
+		want    string
+	}{
+		{
+			name:    "it should render plain results without escape codes",
+			results: results,
+			want:    "1. tax.py:1-2 (score 0.500)\ndef calculate_tax(income):\n\n",
+		},
+		{
+			name:    "it should highlight the location of the results with colors",
+			results: results,
+			color:   true,
+			want:    "\x1b[1m1.\x1b[0m \x1b[36mtax.py:1-2\x1b[0m \x1b[2m(score 0.500)\x1b[0m\ndef calculate_tax(income):\n\n",
+		},
+		{
+			name: "it should list the other locations of duplicated content",
+			results: []search.Result{
+				{
+					QueryResult: results[0].QueryResult,
+					Score:       0.5,
+					Duplicates: []code.ChunkMetadata{
+						{FilePath: "vendor/a/tax.py", StartLine: 1, EndLine: 2},
+						{FilePath: "vendor/b/tax.py", StartLine: 1, EndLine: 2},
+						{FilePath: "vendor/c/tax.py", StartLine: 1, EndLine: 2},
+						{FilePath: "vendor/d/tax.py", StartLine: 1, EndLine: 2},
+					},
+				},
+			},
+			want: "1. tax.py:1-2 (score 0.500)\nalso in vendor/a/tax.py:1-2, vendor/b/tax.py:1-2, vendor/c/tax.py:1-2 and 1 more\n" +
+				"def calculate_tax(income):\n\n",
+		},
+		{
+			name: "it should name the collection of the results when several are searched",
+			results: []search.Result{
+				{QueryResult: results[0].QueryResult, Score: 0.5, Collection: "feature-x"},
+			},
+			want: "1. [feature-x] tax.py:1-2 (score 0.500)\ndef calculate_tax(income):\n\n",
+		},
+		{
+			name: "it should explain the score of the results",
+			results: []search.Result{
+				{
+					QueryResult: results[0].QueryResult,
+					Score:       0.8,
+					Explanation: &search.Explanation{
+						Distance:   0.25,
+						Vector:     0.6,
+						VectorRank: 2,
+						Recency:    0.2,
+						ChangedAt:  time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local),
+					},
+				},
+			},
+			want: "1. tax.py:1-2 (score 0.800)\nvector 0.600 (distance 0.250, rank 2) + recency 0.200 (changed 2026-10-17) = 0.800\n" +
+				"def calculate_tax(income):\n\n",
+		},
+		{
+			name: "it should tell when nothing matches",
+			want: "No matches found.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			out := &bytes.Buffer{}
+			renderer := New(out, tt.color)
+
+			// WHEN
+			renderer.SearchResults(tt.results)
+
+			// THEN
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestRenderer_LinesResult(t *testing.T) {
+	covering := search.Result{
+		QueryResult: embedding.QueryResult{
+			Document: "def calculate_tax(income):",
+			Metadata: code.ChunkMetadata{FilePath: "tax.py", StartLine: 1, EndLine: 2},
+		},
+		Score: 1,
+	}
+	related := search.Result{
+		QueryResult: embedding.QueryResult{
+			Document: "def total(invoice):",
+			Metadata: code.ChunkMetadata{FilePath: "invoice.py", StartLine: 3, EndLine: 4},
+		},
+		Score: 0.5,
+	}
+	tests := []struct {
+		name   string
+		result search.LinesResult
+		want   string
+	}{
+		{
+			name:   "it should render the covering chunks, then the related ones",
+			result: search.LinesResult{Covering: []search.Result{covering}, Related: []search.Result{related}},
+			want: "tax.py:1-2\ndef calculate_tax(income):\n\n" +
+				"Related:\n1. invoice.py:3-4 (score 0.500)\ndef total(invoice):\n\n",
+		},
+		{
+			name:   "it should omit the related section when there is none",
+			result: search.LinesResult{Covering: []search.Result{covering}},
+			want:   "tax.py:1-2\ndef calculate_tax(income):\n\n",
+		},
+		{
+			name: "it should tell when no chunk covers the lines",
+			want: "No chunks cover these lines.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			out := &bytes.Buffer{}
+			renderer := New(out, false)
+
+			// WHEN
+			renderer.LinesResult(tt.result)
+
+			// THEN
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestRenderer_Assets(t *testing.T) {
+	// GIVEN
+	out := &bytes.Buffer{}
+	renderer := New(out, false)
+
+	// WHEN
+	renderer.Assets([]manifest.Asset{{FilePath: "static/logo.png", Type: "image", Size: 2048}})
+	renderer.Assets(nil)
+
+	// THEN
+	assert.Equal(t, "Assets:\nstatic/logo.png (image, 2048 bytes)\n", out.String())
+}
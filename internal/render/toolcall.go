@@ -0,0 +1,96 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/search"
+)
+
+// Format of the search results
+type Format string
+
+const (
+	// TextFormat is the human-readable output
+	TextFormat Format = "text"
+	// OpenAIFormat is a tool message of the OpenAI chat completions API
+	OpenAIFormat Format = "openai"
+	// AnthropicFormat is a tool_result content block of the Anthropic messages API
+	AnthropicFormat Format = "anthropic"
+)
+
+type (
+	openAIToolMessage struct {
+		Role       string `json:"role"`
+		ToolCallId string `json:"tool_call_id"`
+		Content    string `json:"content"`
+	}
+
+	anthropicToolResult struct {
+		Type      string          `json:"type"`
+		ToolUseId string          `json:"tool_use_id"`
+		Content   []anthropicText `json:"content"`
+	}
+
+	anthropicText struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+)
+
+// ParseFormat parses the name of an output format
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case TextFormat, OpenAIFormat, AnthropicFormat:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %s, expected one of text, openai, anthropic", name)
+	}
+}
+
+// ToolResult writes the results as the response to the tool call toolCallId, in the JSON shape expected by the API
+// of the format, so they can be appended as is to the messages of a conversation
+func (r *Renderer) ToolResult(format Format, toolCallId string, results []search.Result) error {
+	var message any
+	switch format {
+	case OpenAIFormat:
+		texts := make([]string, len(results))
+		for i, result := range results {
+			texts[i] = resultText(result)
+		}
+		content := strings.Join(texts, "\n\n")
+		if len(results) == 0 {
+			content = "No matches found."
+		}
+		message = openAIToolMessage{Role: "tool", ToolCallId: toolCallId, Content: content}
+	case AnthropicFormat:
+		content := make([]anthropicText, len(results))
+		for i, result := range results {
+			content[i] = anthropicText{Type: "text", Text: resultText(result)}
+		}
+		if len(results) == 0 {
+			content = []anthropicText{{Type: "text", Text: "No matches found."}}
+		}
+		message = anthropicToolResult{Type: "tool_result", ToolUseId: toolCallId, Content: content}
+	default:
+		return fmt.Errorf("format %s is not a tool call format", format)
+	}
+
+	encoder := json.NewEncoder(r.out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(message); err != nil {
+		return fmt.Errorf("failed to encode tool result: %w", err)
+	}
+	return nil
+}
+
+// resultText describes a result for a model: its location, and its content in a fenced code block
+func resultText(result search.Result) string {
+	metadata := result.Metadata
+	location := fmt.Sprintf("%s%s:%d-%d (score %.3f)", collectionPrefix(result), metadata.FilePath, metadata.StartLine, metadata.EndLine, result.Score)
+	if duplicates := duplicatesText(result); duplicates != "" {
+		location += "\n" + duplicates
+	}
+	return fmt.Sprintf("%s\n```%s\n%s\n```", location, metadata.Language, result.Document)
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderer_ToolResult(t *testing.T) {
+	results := []search.Result{
+		{
+			QueryResult: embedding.QueryResult{
+				Document: "def calculate_tax(income):",
+				Metadata: code.ChunkMetadata{FilePath: "tax.py", Language: "python", StartLine: 1, EndLine: 2},
+			},
+			Score: 0.5,
+		},
+	}
+	tests := []struct {
+		name    string
+		format  Format
+		results []search.Result
+		want    string
+	}{
+		{
+			name:    "it should render an openai tool message",
+			format:  OpenAIFormat,
+			results: results,
+			want:    `{"role":"tool","tool_call_id":"call_1","content":"tax.py:1-2 (score 0.500)\n` + "```" + `python\ndef calculate_tax(income):\n` + "```" + `"}` + "\n",
+		},
+		{
+			name:    "it should render an anthropic tool result with a text block per result",
+			format:  AnthropicFormat,
+			results: results,
+			want:    `{"type":"tool_result","tool_use_id":"call_1","content":[{"type":"text","text":"tax.py:1-2 (score 0.500)\n` + "```" + `python\ndef calculate_tax(income):\n` + "```" + `"}]}` + "\n",
+		},
+		{
+			name:   "it should tell the model when nothing matches",
+			format: AnthropicFormat,
+			want:   `{"type":"tool_result","tool_use_id":"call_1","content":[{"type":"text","text":"No matches found."}]}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			out := &bytes.Buffer{}
+			renderer := New(out, false)
+
+			// WHEN
+			err := renderer.ToolResult(tt.format, "call_1", tt.results)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	// WHEN
+	_, err := ParseFormat("xml")
+
+	// THEN
+	assert.Error(t, err, "it should reject unknown formats")
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+)
+
+// Version of the chunks written by this release, covering the shape of their metadata (code.ChunkMetadata) and the
+// scheme of their ids. Bump it when either changes, or when a field the search filters rely on is added, the chunks
+// stored without it would silently match none of them, and register a migration if the stored chunks can be upgraded
+// in place, otherwise a reindex is required
+//
+// Version 2 added the root, the content hash, and the issues of the chunks
+const Version = 2
+
+// unrecordedVersion is the version of the indexes built before the version was recorded in the manifest
+const unrecordedVersion = 1
+
+var (
+	// ErrReindexRequired is returned when no migration upgrades the index to the current version
+	ErrReindexRequired = errors.New("reindex required")
+	// ErrNewerIndex is returned when the index was built by a more recent release of mm
+	ErrNewerIndex = errors.New("index built by a newer release of mm")
+)
+
+type (
+	// Migration upgrades the chunks of a store from the version From to From+1
+	Migration struct {
+		From        int
+		Description string
+		Apply       func(vectorStore store.VectorStore, indexManifest *manifest.Manifest) error
+	}
+)
+
+// migrations are the registered migrations, ordered by version
+var migrations []Migration
+
+// IndexVersion returns the version of the chunks of the index described by the manifest, an empty index is at the
+// current version
+func IndexVersion(indexManifest *manifest.Manifest) int {
+	if version := indexManifest.Schema(); version != 0 {
+		return version
+	}
+	if len(indexManifest.Paths()) == 0 {
+		return Version
+	}
+	return unrecordedVersion
+}
+
+// Check fails if the index cannot be used by this release, returns the migrations to apply before writing to it
+func Check(indexManifest *manifest.Manifest) ([]Migration, error) {
+	return plan(IndexVersion(indexManifest), Version, migrations)
+}
+
+// Migrate applies the migrations upgrading the index to the current version, and records it in the manifest
+func Migrate(vectorStore store.VectorStore, indexManifest *manifest.Manifest) error {
+	pending, err := Check(indexManifest)
+	if err != nil {
+		return err
+	}
+	for _, migration := range pending {
+		if err := migration.Apply(vectorStore, indexManifest); err != nil {
+			return fmt.Errorf("failed to migrate index from version %d (%s): %w", migration.From, migration.Description, err)
+		}
+		indexManifest.SetSchema(migration.From + 1)
+	}
+	indexManifest.SetSchema(Version)
+	return nil
+}
+
+// plan returns the migrations upgrading an index from one version to another
+func plan(from int, to int, available []Migration) ([]Migration, error) {
+	if from > to {
+		return nil, fmt.Errorf("%w: index is at version %d, this release supports up to %d, upgrade mm", ErrNewerIndex, from, to)
+	}
+
+	byVersion := make(map[int]Migration, len(available))
+	for _, migration := range available {
+		byVersion[migration.From] = migration
+	}
+	var pending []Migration
+	for version := from; version < to; version++ {
+		migration, found := byVersion[version]
+		if !found {
+			return nil, fmt.Errorf(
+				"%w: index is at version %d, no migration to version %d, run mm purge --all and index again",
+				ErrReindexRequired, from, to,
+			)
+		}
+		pending = append(pending, migration)
+	}
+	return pending, nil
+}
@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	noop := func(store.VectorStore, *manifest.Manifest) error { return nil }
+	available := []Migration{
+		{From: 1, Description: "rename chunk_type", Apply: noop},
+		{From: 2, Description: "hash ids", Apply: noop},
+	}
+
+	tests := []struct {
+		name     string
+		from     int
+		to       int
+		wantFrom []int
+		wantErr  error
+	}{
+		{
+			name: "it should not migrate an index at the current version",
+			from: 3,
+			to:   3,
+		},
+		{
+			name:     "it should chain the migrations up to the current version",
+			from:     1,
+			to:       3,
+			wantFrom: []int{1, 2},
+		},
+		{
+			name:    "it should require a reindex when a migration is missing",
+			from:    1,
+			to:      4,
+			wantErr: ErrReindexRequired,
+		},
+		{
+			name:    "it should refuse an index built by a newer release",
+			from:    4,
+			to:      3,
+			wantErr: ErrNewerIndex,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			pending, err := plan(tt.from, tt.to, available)
+
+			// THEN
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var from []int
+			for _, migration := range pending {
+				from = append(from, migration.From)
+			}
+			assert.Equal(t, tt.wantFrom, from)
+		})
+	}
+}
+
+func TestIndexVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(indexManifest *manifest.Manifest)
+		want    int
+	}{
+		{
+			name:    "it should consider an empty index at the current version",
+			prepare: func(*manifest.Manifest) {},
+			want:    Version,
+		},
+		{
+			name: "it should consider an index without recorded version at the first version",
+			prepare: func(indexManifest *manifest.Manifest) {
+				indexManifest.Put("/src/tax.py", manifest.Entry{})
+			},
+			want: unrecordedVersion,
+		},
+		{
+			name: "it should return the recorded version",
+			prepare: func(indexManifest *manifest.Manifest) {
+				indexManifest.Put("/src/tax.py", manifest.Entry{})
+				indexManifest.SetSchema(7)
+			},
+			want: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			indexManifest, err := manifest.Load(filepath.Join(t.TempDir(), "store.json"))
+			require.NoError(t, err)
+			tt.prepare(indexManifest)
+
+			// WHEN
+			version := IndexVersion(indexManifest)
+
+			// THEN
+			assert.Equal(t, tt.want, version)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// GIVEN
+	indexManifest, err := manifest.Load(filepath.Join(t.TempDir(), "store.json"))
+	require.NoError(t, err)
+	indexManifest.Put("/src/tax.py", manifest.Entry{})
+	indexManifest.SetSchema(1)
+
+	// WHEN
+	_, err = Check(indexManifest)
+
+	// THEN
+	assert.ErrorIs(t, err, ErrReindexRequired, "it should require a reindex of the chunks without root, content hash and issues")
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"strings"
+)
+
+type Filter map[string]any
+
+// filterBuilders maps the prefixes usable in queries (e.g. pkg:internal/auth) to the metadata filter they produce
+var filterBuilders = map[string]func(value string) Filter{
+	"pkg": func(value string) Filter {
+		return or(
+			Filter{"package_path": Filter{"$eq": value}},
+			Filter{"import_path": Filter{"$eq": value}},
+			Filter{"package": Filter{"$eq": value}},
+		)
+	},
+	"mod": func(value string) Filter {
+		return Filter{"module_path": Filter{"$eq": value}}
+	},
+	"root": func(value string) Filter {
+		return Filter{"root": Filter{"$eq": value}}
+	},
+	"issue": func(value string) Filter {
+		return Filter{"issues": Filter{"$contains": value}}
+	},
+}
+
+// ParseQuery splits the query text from the filters it contains, e.g. "token validation pkg:internal/auth"
+func ParseQuery(query string) (string, Filter) {
+	var words []string
+	var filters []Filter
+	for _, word := range strings.Fields(query) {
+		prefix, value, found := strings.Cut(word, ":")
+		builder, known := filterBuilders[prefix]
+		if !found || !known || value == "" {
+			words = append(words, word)
+			continue
+		}
+		filters = append(filters, builder(value))
+	}
+
+	return strings.Join(words, " "), and(filters...)
+}
+
+func and(filters ...Filter) Filter {
+	return combine("$and", filters)
+}
+
+func or(filters ...Filter) Filter {
+	return combine("$or", filters)
+}
+
+func combine(operator string, filters []Filter) Filter {
+	var nonEmpty []any
+	for _, filter := range filters {
+		if len(filter) > 0 {
+			nonEmpty = append(nonEmpty, filter)
+		}
+	}
+	switch len(nonEmpty) {
+	case 0:
+		return nil
+	case 1:
+		return nonEmpty[0].(Filter)
+	default:
+		return Filter{operator: nonEmpty}
+	}
+}
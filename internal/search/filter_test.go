@@ -0,0 +1,76 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantText   string
+		wantFilter Filter
+	}{
+		{
+			name:     "it should keep a query without filters untouched",
+			query:    "where is the token validated?",
+			wantText: "where is the token validated?",
+		},
+		{
+			name:     "it should extract a package filter",
+			query:    "token validation pkg:internal/auth",
+			wantText: "token validation",
+			wantFilter: Filter{"$or": []any{
+				Filter{"package_path": Filter{"$eq": "internal/auth"}},
+				Filter{"import_path": Filter{"$eq": "internal/auth"}},
+				Filter{"package": Filter{"$eq": "internal/auth"}},
+			}},
+		},
+		{
+			name:     "it should combine multiple filters",
+			query:    "pkg:auth token pkg:session",
+			wantText: "token",
+			wantFilter: Filter{"$and": []any{
+				Filter{"$or": []any{
+					Filter{"package_path": Filter{"$eq": "auth"}},
+					Filter{"import_path": Filter{"$eq": "auth"}},
+					Filter{"package": Filter{"$eq": "auth"}},
+				}},
+				Filter{"$or": []any{
+					Filter{"package_path": Filter{"$eq": "session"}},
+					Filter{"import_path": Filter{"$eq": "session"}},
+					Filter{"package": Filter{"$eq": "session"}},
+				}},
+			}},
+		},
+		{
+			name:       "it should extract a root filter",
+			query:      "upload retries root:backend",
+			wantText:   "upload retries",
+			wantFilter: Filter{"root": Filter{"$eq": "backend"}},
+		},
+		{
+			name:       "it should extract an issue filter",
+			query:      "retries issue:PAY-1234",
+			wantText:   "retries",
+			wantFilter: Filter{"issues": Filter{"$contains": "PAY-1234"}},
+		},
+		{
+			name:     "it should keep unknown prefixes in the text",
+			query:    "http://example.com handler",
+			wantText: "http://example.com handler",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			gotText, gotFilter := ParseQuery(tt.query)
+
+			// THEN
+			assert.Equal(t, tt.wantText, gotText)
+			assert.Equal(t, tt.wantFilter, gotFilter)
+		})
+	}
+}
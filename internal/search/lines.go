@@ -0,0 +1,147 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/store"
+)
+
+type (
+	// LineRange is a range of lines of a file, inclusive, e.g. the location of a frame of a stack trace
+	LineRange struct {
+		FilePath string
+		Start    int
+		End      int
+	}
+
+	// LinesResult holds the chunks covering a line range, and the chunks semantically related to them
+	LinesResult struct {
+		Covering []Result
+		Related  []Result
+	}
+)
+
+// ParseLineRange parses a location like file.go:42 or file.go:42-60, a trailing column (file.go:42:7) is ignored
+func ParseLineRange(location string) (LineRange, error) {
+	filePath, lines, found := cutLast(location, ":")
+	if !found {
+		return LineRange{}, fmt.Errorf("invalid location %q, expected file:line or file:start-end", location)
+	}
+	// file:line:column, as printed by most compilers
+	if path, line, found := cutLast(filePath, ":"); found && isNumber(line) && isNumber(lines) {
+		filePath, lines = path, line
+	}
+
+	startText, endText, isRange := strings.Cut(lines, "-")
+	if !isRange {
+		endText = startText
+	}
+	start, err := strconv.Atoi(startText)
+	if err != nil || start < 1 {
+		return LineRange{}, fmt.Errorf("invalid start line in %q", location)
+	}
+	end, err := strconv.Atoi(endText)
+	if err != nil || end < start {
+		return LineRange{}, fmt.Errorf("invalid end line in %q", location)
+	}
+	if filePath == "" {
+		return LineRange{}, fmt.Errorf("missing file in %q", location)
+	}
+	return LineRange{FilePath: filePath, Start: start, End: end}, nil
+}
+
+func (r LineRange) String() string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%s:%d", r.FilePath, r.Start)
+	}
+	return fmt.Sprintf("%s:%d-%d", r.FilePath, r.Start, r.End)
+}
+
+// Filter keeps the chunks of the file overlapping the range
+func (r LineRange) Filter() Filter {
+	return and(
+		Filter{"file_path": Filter{"$eq": r.FilePath}},
+		Filter{"start_line": Filter{"$lte": r.End}},
+		Filter{"end_line": Filter{"$gte": r.Start}},
+	)
+}
+
+// Lines returns the chunks covering the range, ordered by line, and the related chunks closest to any of them,
+// up to related of them
+func Lines(s store.InspectableStore, lines LineRange, related int) (LinesResult, error) {
+	records, err := s.Peek(0, lines.Filter())
+	if err != nil {
+		return LinesResult{}, fmt.Errorf("failed to find the chunks of %s: %w", lines, err)
+	}
+
+	var result LinesResult
+	covering := make(map[string]bool, len(records))
+	for _, record := range records {
+		chunk, err := record.Chunk()
+		if err != nil {
+			return LinesResult{}, err
+		}
+		covering[record.Id] = true
+		result.Covering = append(result.Covering, Result{
+			QueryResult: embedding.QueryResult{Id: chunk.Id, Document: chunk.Content, Metadata: chunk.Metadata},
+			Score:       1,
+		})
+	}
+	sort.SliceStable(result.Covering, func(i, j int) bool {
+		return result.Covering[i].Metadata.StartLine < result.Covering[j].Metadata.StartLine
+	})
+
+	if related <= 0 || len(records) == 0 {
+		return result, nil
+	}
+
+	// the neighbors of each covering chunk are merged, keeping the best score of each
+	best := make(map[string]Result)
+	for _, record := range records {
+		neighbors, err := s.Query(record.Embedding, (related+len(records))*duplicateCandidatesFactor, nil)
+		if err != nil {
+			return LinesResult{}, fmt.Errorf("failed to find the chunks related to %s: %w", record.Id, err)
+		}
+		for _, neighbor := range neighbors {
+			if covering[neighbor.Id] {
+				continue
+			}
+			score := similarity(neighbor.Distance)
+			if current, found := best[neighbor.Id]; !found || score > current.Score {
+				best[neighbor.Id] = Result{QueryResult: neighbor, Score: score}
+			}
+		}
+	}
+	for _, neighbor := range best {
+		result.Related = append(result.Related, neighbor)
+	}
+	sort.Slice(result.Related, func(i, j int) bool {
+		if result.Related[i].Score != result.Related[j].Score {
+			return result.Related[i].Score > result.Related[j].Score
+		}
+		return result.Related[i].Id < result.Related[j].Id
+	})
+	result.Related = collapseDuplicates(result.Related)
+	if len(result.Related) > related {
+		result.Related = result.Related[:related]
+	}
+	return result, nil
+}
+
+func isNumber(text string) bool {
+	_, err := strconv.Atoi(text)
+	return err == nil
+}
+
+// cutLast slices text around the last separator
+func cutLast(text string, separator string) (string, string, bool) {
+	i := strings.LastIndex(text, separator)
+	if i < 0 {
+		return text, "", false
+	}
+	return text[:i], text[i+len(separator):], true
+}
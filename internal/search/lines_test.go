@@ -0,0 +1,126 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    LineRange
+		wantErr bool
+	}{
+		{
+			name:  "it should parse a single line",
+			input: "internal/auth/token.go:42",
+			want:  LineRange{FilePath: "internal/auth/token.go", Start: 42, End: 42},
+		},
+		{
+			name:  "it should parse a range of lines",
+			input: "tax.py:10-25",
+			want:  LineRange{FilePath: "tax.py", Start: 10, End: 25},
+		},
+		{
+			name:  "it should ignore the column",
+			input: "/src/app/main.go:12:7",
+			want:  LineRange{FilePath: "/src/app/main.go", Start: 12, End: 12},
+		},
+		{
+			name:    "it should reject a location without line",
+			input:   "tax.py",
+			wantErr: true,
+		},
+		{
+			name:    "it should reject a reversed range",
+			input:   "tax.py:25-10",
+			wantErr: true,
+		},
+		{
+			name:    "it should reject a location without file",
+			input:   ":12",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			lines, err := ParseLineRange(tt.input)
+
+			// THEN
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, lines)
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	// GIVEN
+	localStore, err := store.OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	chunks := []code.Chunk{
+		{Id: "tax_1", Content: "def calculate_tax(income):", Metadata: code.ChunkMetadata{FilePath: "tax.py", StartLine: 1, EndLine: 10}},
+		{Id: "tax_11", Content: "def apply_rate(amount):", Metadata: code.ChunkMetadata{FilePath: "tax.py", StartLine: 11, EndLine: 20}},
+		{Id: "tax_21", Content: "def round_cents(amount):", Metadata: code.ChunkMetadata{FilePath: "tax.py", StartLine: 21, EndLine: 30}},
+		{Id: "invoice_1", Content: "def total(invoice):", Metadata: code.ChunkMetadata{FilePath: "invoice.py", StartLine: 1, EndLine: 5}},
+		{Id: "auth_1", Content: "func Validate(token string) error", Metadata: code.ChunkMetadata{FilePath: "auth.go", StartLine: 1, EndLine: 5}},
+	}
+	records, err := store.NewRecords(chunks, [][]float32{{0, 1}, {0.1, 0.9}, {0.3, 0.7}, {0.4, 0.6}, {1, 0}})
+	require.NoError(t, err)
+	require.NoError(t, localStore.Upsert(records))
+
+	tests := []struct {
+		name         string
+		lines        LineRange
+		related      int
+		wantCovering []string
+		wantRelated  []string
+	}{
+		{
+			name:         "it should return the chunks overlapping the range, ordered by line",
+			lines:        LineRange{FilePath: "tax.py", Start: 8, End: 12},
+			related:      0,
+			wantCovering: []string{"tax_1", "tax_11"},
+		},
+		{
+			name:         "it should return the closest chunks to the covering ones, excluding them",
+			lines:        LineRange{FilePath: "tax.py", Start: 15, End: 15},
+			related:      2,
+			wantCovering: []string{"tax_11"},
+			wantRelated:  []string{"tax_1", "tax_21"},
+		},
+		{
+			name:  "it should return nothing for lines not indexed",
+			lines: LineRange{FilePath: "tax.py", Start: 40, End: 50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			result, err := Lines(localStore, tt.lines, tt.related)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCovering, ids(result.Covering))
+			assert.Equal(t, tt.wantRelated, ids(result.Related))
+		})
+	}
+}
+
+func ids(results []Result) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.Id)
+	}
+	return ids
+}
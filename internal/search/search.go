@@ -0,0 +1,299 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/hooks"
+)
+
+const (
+	defaultLimit = 5
+
+	// when boosting recent results, we fetch more candidates than needed, so stale results can be pushed away
+	recencyCandidatesFactor = 4
+	recencyHalfLife         = 30 * 24 * time.Hour
+	recencyWeight           = 0.2
+
+	// identical chunks are collapsed into a single result, so more candidates than needed are fetched
+	duplicateCandidatesFactor = 2
+)
+
+type (
+	Querier interface {
+		Query(query embedding.Query) ([]embedding.QueryResult, error)
+	}
+
+	Options struct {
+		Limit      int
+		Since      time.Time
+		Recent     bool
+		Filter     Filter
+		Like       string
+		LikeWeight float64
+		Now        time.Time
+		// KeepDuplicates returns the identical chunks as separate results, instead of collapsing them
+		KeepDuplicates bool
+		// Hooks are notified of the search, nil if nothing observes it
+		Hooks *hooks.Hooks
+		// Explain attaches to each result the contribution of each ranking stage to its score
+		Explain bool
+	}
+
+	Option func(*Options)
+
+	Result struct {
+		embedding.QueryResult
+		Score float64
+		// Duplicates are the other locations of the same content, e.g. vendored copies
+		Duplicates []code.ChunkMetadata
+		// Collection the result comes from, only set when several collections are searched
+		Collection string
+		// Explanation of the score, only set when explaining the ranking
+		Explanation *Explanation
+	}
+
+	// Explanation details the contribution of each ranking stage to the score of a result
+	Explanation struct {
+		Distance float64
+		// Vector is the similarity of the embeddings, the base of the score
+		Vector float64
+		// VectorRank is the rank of the result by vector similarity alone, before the other stages, starting at 1
+		VectorRank int
+		// ExampleWeight is the weight of the example snippet in the embedding of the query, 0 without example
+		ExampleWeight float64
+		// Recency is the boost of the recently changed chunks, 0 when not enabled
+		Recency   float64
+		ChangedAt time.Time
+	}
+
+	// Source is a collection searched along others
+	Source struct {
+		Collection string
+		Querier    Querier
+	}
+)
+
+func WithLimit(limit int) Option {
+	return func(opts *Options) {
+		opts.Limit = limit
+	}
+}
+
+// WithSince only keeps the chunks changed after the given time
+func WithSince(since time.Time) Option {
+	return func(opts *Options) {
+		opts.Since = since
+	}
+}
+
+// WithRecencyBoost ranks chunks from actively developed code above stale code
+func WithRecencyBoost(recent bool) Option {
+	return func(opts *Options) {
+		opts.Recent = recent
+	}
+}
+
+// WithFilter only keeps the chunks matching the metadata filter
+func WithFilter(filter Filter) Option {
+	return func(opts *Options) {
+		opts.Filter = and(opts.Filter, filter)
+	}
+}
+
+// WithExample searches code similar to the example snippet, combined with the query text according to the weight
+// (0 only uses the text, 1 only uses the example)
+func WithExample(snippet string, weight float64) Option {
+	return func(opts *Options) {
+		opts.Like = snippet
+		opts.LikeWeight = weight
+	}
+}
+
+// WithDuplicates keeps the identical chunks as separate results, found in the same collection or in several ones
+func WithDuplicates(keep bool) Option {
+	return func(opts *Options) {
+		opts.KeepDuplicates = keep
+	}
+}
+
+// WithHooks notifies the hooks once the search completes
+func WithHooks(h *hooks.Hooks) Option {
+	return func(opts *Options) {
+		opts.Hooks = h
+	}
+}
+
+// WithExplanation attaches to each result how its score was computed
+func WithExplanation(explain bool) Option {
+	return func(opts *Options) {
+		opts.Explain = explain
+	}
+}
+
+// Search returns the chunks closest to the text, ranked by descending score
+func Search(querier Querier, text string, opts ...Option) ([]Result, error) {
+	return SearchCollections([]Source{{Querier: querier}}, text, opts...)
+}
+
+// SearchCollections returns the chunks of all the collections closest to the text, ranked by descending score, the
+// identical chunks indexed in several collections (branch snapshots, dependencies, ...) being collapsed into the best
+// ranked one, the embeddings of all the collections must come from the same model
+func SearchCollections(sources []Source, text string, opts ...Option) (results []Result, err error) {
+	options := buildOptions(opts...)
+	start := time.Now()
+	defer func() {
+		options.Hooks.Search(searchEvent(sources, text, len(results), time.Since(start), err))
+	}()
+
+	nResults := options.Limit * duplicateCandidatesFactor
+	if options.Recent {
+		nResults *= recencyCandidatesFactor
+	}
+	filter := options.Filter
+	if !options.Since.IsZero() {
+		filter = and(filter, sinceFilter(options.Since))
+	}
+	query := embedding.Query{
+		Text:     text,
+		NResults: nResults,
+		Where:    filter,
+		Like:     options.Like,
+	}
+	if options.Like != "" {
+		query.LikeWeight = &options.LikeWeight
+	}
+
+	for _, source := range sources {
+		candidates, err := source.Querier.Query(query)
+		if err != nil {
+			if source.Collection != "" {
+				return nil, fmt.Errorf("failed to query collection %s: %w", source.Collection, err)
+			}
+			return nil, fmt.Errorf("failed to query index: %w", err)
+		}
+		for _, candidate := range candidates {
+			explanation := &Explanation{
+				Distance:  candidate.Distance,
+				Vector:    similarity(candidate.Distance),
+				ChangedAt: changedAt(candidate),
+			}
+			if options.Like != "" {
+				explanation.ExampleWeight = options.LikeWeight
+			}
+			if options.Recent {
+				explanation.Recency = recencyBoost(explanation.ChangedAt, options.Now)
+			}
+			result := Result{QueryResult: candidate, Score: explanation.Vector + explanation.Recency, Collection: source.Collection}
+			if options.Explain {
+				result.Explanation = explanation
+			}
+			results = append(results, result)
+		}
+	}
+	if options.Explain {
+		rankByVector(results)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if !options.KeepDuplicates {
+		results = collapseDuplicates(results)
+	}
+	if len(results) > options.Limit {
+		results = results[:options.Limit]
+	}
+
+	return results, nil
+}
+
+func searchEvent(sources []Source, text string, results int, elapsed time.Duration, err error) hooks.Search {
+	event := hooks.Search{Query: text, Results: results, Elapsed: elapsed, Err: err}
+	for _, source := range sources {
+		if source.Collection != "" {
+			event.Collections = append(event.Collections, source.Collection)
+		}
+	}
+	return event
+}
+
+// rankByVector records the rank of the results by vector similarity alone in their explanation
+func rankByVector(results []Result) {
+	byVector := slices.Clone(results)
+	sort.SliceStable(byVector, func(i, j int) bool {
+		return byVector[i].Explanation.Vector > byVector[j].Explanation.Vector
+	})
+	for i, result := range byVector {
+		result.Explanation.VectorRank = i + 1
+	}
+}
+
+// collapseDuplicates keeps the best ranked result of each content, the locations of the others are attached to it
+func collapseDuplicates(results []Result) []Result {
+	collapsed := make([]Result, 0, len(results))
+	byHash := make(map[string]int)
+	for _, result := range results {
+		hash := result.Metadata.ContentHash
+		if hash == "" {
+			collapsed = append(collapsed, result)
+			continue
+		}
+		if i, found := byHash[hash]; found {
+			collapsed[i].Duplicates = append(collapsed[i].Duplicates, result.Metadata)
+			continue
+		}
+		byHash[hash] = len(collapsed)
+		collapsed = append(collapsed, result)
+	}
+	return collapsed
+}
+
+func buildOptions(opts ...Option) *Options {
+	options := &Options{
+		Limit: defaultLimit,
+		Now:   time.Now(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// sinceFilter keeps the chunks committed after since, or, if the commit time is unknown, modified after since
+func sinceFilter(since time.Time) Filter {
+	ts := since.Unix()
+	return or(
+		Filter{"committed_at": Filter{"$gte": ts}},
+		and(
+			Filter{"committed_at": Filter{"$eq": 0}},
+			Filter{"modified_at": Filter{"$gte": ts}},
+		),
+	)
+}
+
+// similarity maps the distance to ]0, 1], the dot product of unnormalized embeddings can give negative distances,
+// as similar as it gets
+func similarity(distance float64) float64 {
+	return 1 / (1 + max(distance, 0))
+}
+
+// changedAt returns the last time the chunk changed, preferring the commit time over the file modification time
+func changedAt(result embedding.QueryResult) time.Time {
+	if result.Metadata.CommittedAt > 0 {
+		return time.Unix(result.Metadata.CommittedAt, 0)
+	}
+	return time.Unix(result.Metadata.ModifiedAt, 0)
+}
+
+func recencyBoost(changedAt time.Time, now time.Time) float64 {
+	age := now.Sub(changedAt)
+	if age < 0 {
+		age = 0
+	}
+	return recencyWeight * math.Pow(0.5, float64(age)/float64(recencyHalfLife))
+}
@@ -0,0 +1,107 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/hooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuerier []embedding.QueryResult
+
+func (f fakeQuerier) Query(embedding.Query) ([]embedding.QueryResult, error) {
+	return f, nil
+}
+
+func TestSearchCollections(t *testing.T) {
+	main := fakeQuerier{
+		{Id: "main/tax", Metadata: code.ChunkMetadata{FilePath: "tax.py", ContentHash: "tax"}, Distance: 0.2},
+		{Id: "main/invoice", Metadata: code.ChunkMetadata{FilePath: "invoice.py", ContentHash: "invoice-v1"}, Distance: 0.5},
+	}
+	feature := fakeQuerier{
+		{Id: "feature/tax", Metadata: code.ChunkMetadata{FilePath: "tax.py", ContentHash: "tax"}, Distance: 0.1},
+		{Id: "feature/invoice", Metadata: code.ChunkMetadata{FilePath: "invoice.py", ContentHash: "invoice-v2"}, Distance: 0.4},
+	}
+	sources := []Source{{Collection: "main", Querier: main}, {Collection: "feature-x", Querier: feature}}
+	tests := []struct {
+		name            string
+		opts            []Option
+		wantIds         []string
+		wantCollections []string
+	}{
+		{
+			name:            "it should collapse the identical chunks of the collections into the best ranked one",
+			wantIds:         []string{"feature/tax", "feature/invoice", "main/invoice"},
+			wantCollections: []string{"feature-x", "feature-x", "main"},
+		},
+		{
+			name:            "it should keep the identical chunks when asked to",
+			opts:            []Option{WithDuplicates(true)},
+			wantIds:         []string{"feature/tax", "main/tax", "feature/invoice", "main/invoice"},
+			wantCollections: []string{"feature-x", "main", "feature-x", "main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			results, err := SearchCollections(sources, "tax", tt.opts...)
+
+			// THEN
+			require.NoError(t, err)
+			var collections []string
+			for _, result := range results {
+				collections = append(collections, result.Collection)
+			}
+			assert.Equal(t, tt.wantIds, ids(results))
+			assert.Equal(t, tt.wantCollections, collections)
+		})
+	}
+}
+
+func TestSearchCollections_Hooks(t *testing.T) {
+	// GIVEN
+	sources := []Source{
+		{Collection: "main", Querier: fakeQuerier{{Id: "tax", Metadata: code.ChunkMetadata{FilePath: "tax.py"}}}},
+		{Collection: "feature-x", Querier: fakeQuerier{{Id: "invoice", Metadata: code.ChunkMetadata{FilePath: "invoice.py"}}}},
+	}
+	var events []hooks.Search
+	h := hooks.New(hooks.OnSearch(func(event hooks.Search) { events = append(events, event) }))
+
+	// WHEN
+	_, err := SearchCollections(sources, "vat rate", WithHooks(h))
+
+	// THEN
+	require.NoError(t, err)
+	require.Len(t, events, 1, "it should notify the hooks once the search completes")
+	assert.Equal(t, "vat rate", events[0].Query)
+	assert.Equal(t, []string{"main", "feature-x"}, events[0].Collections)
+	assert.Equal(t, 2, events[0].Results)
+	assert.NoError(t, events[0].Err)
+}
+
+func TestSearch_Explanation(t *testing.T) {
+	// GIVEN
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	querier := fakeQuerier{
+		{Id: "stale", Metadata: code.ChunkMetadata{FilePath: "stale.py", ModifiedAt: now.AddDate(-2, 0, 0).Unix()}, Distance: 0.5},
+		{Id: "fresh", Metadata: code.ChunkMetadata{FilePath: "fresh.py", CommittedAt: now.Unix()}, Distance: 0.6},
+	}
+
+	// WHEN
+	results, err := Search(querier, "tax", WithRecencyBoost(true), WithExplanation(true), func(opts *Options) { opts.Now = now })
+
+	// THEN
+	require.NoError(t, err)
+	require.Equal(t, []string{"fresh", "stale"}, ids(results), "it should boost the recent chunk above the closer one")
+	fresh := results[0].Explanation
+	require.NotNil(t, fresh)
+	assert.Equal(t, 2, fresh.VectorRank, "it should rank the fresh chunk second by vector similarity alone")
+	assert.InDelta(t, 1/1.6, fresh.Vector, 1e-9)
+	assert.InDelta(t, recencyWeight, fresh.Recency, 1e-9)
+	assert.InDelta(t, results[0].Score, fresh.Vector+fresh.Recency, 1e-9, "it should explain the whole score")
+	assert.Equal(t, 1, results[1].Explanation.VectorRank)
+}
@@ -0,0 +1,37 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSince parses a point in time, either as a date (2006-01-02), or as a duration relative to now,
+// supporting days and weeks on top of the standard go durations (e.g. 36h, 3d, 2w).
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if date, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return date, nil
+	}
+
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid since value %q", value)
+		}
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, fmt.Errorf("invalid since value %q, expected a date (2006-01-02) or a duration (36h, 3d, 2w)", value)
+	}
+	return now.Add(-duration), nil
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "it should parse a date",
+			value: "2024-01-02",
+			want:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:  "it should parse a go duration",
+			value: "36h",
+			want:  now.Add(-36 * time.Hour),
+		},
+		{
+			name:  "it should parse days",
+			value: "3d",
+			want:  now.Add(-3 * 24 * time.Hour),
+		},
+		{
+			name:  "it should parse weeks",
+			value: "2w",
+			want:  now.Add(-14 * 24 * time.Hour),
+		},
+		{
+			name:    "it should reject invalid values",
+			value:   "yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "it should reject negative durations",
+			value:   "-3d",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			got, err := ParseSince(tt.value, now)
+
+			// THEN
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/store"
+)
+
+// SymbolFilter keeps the chunks defining the symbol: the functions and the classes named after it, or the methods of
+// a class when qualified by it (e.g. TokenValidator.validate)
+func SymbolFilter(symbol string) Filter {
+	if className, name, qualified := strings.Cut(symbol, "."); qualified {
+		return and(
+			Filter{"class_name": Filter{"$eq": className}},
+			Filter{"function_name": Filter{"$eq": name}},
+		)
+	}
+	return or(
+		Filter{"function_name": Filter{"$eq": symbol}},
+		and(
+			Filter{"class_name": Filter{"$eq": symbol}},
+			Filter{"chunk_type": Filter{"$eq": "classes"}},
+		),
+	)
+}
+
+// Symbols returns the chunks defining the symbol and matching the filter, ordered by location, up to limit of them if
+// not zero, the chunks are looked up by their metadata, so the embeddings are not needed
+func Symbols(inspector store.Inspector, symbol string, filter Filter, limit int) ([]Result, error) {
+	records, err := inspector.Peek(0, and(SymbolFilter(symbol), filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the symbol %s: %w", symbol, err)
+	}
+
+	results := make([]Result, 0, len(records))
+	for _, record := range records {
+		chunk, err := record.Chunk()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, Result{
+			QueryResult: embedding.QueryResult{Id: chunk.Id, Document: chunk.Content, Metadata: chunk.Metadata},
+			Score:       1,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Metadata.FilePath != results[j].Metadata.FilePath {
+			return results[i].Metadata.FilePath < results[j].Metadata.FilePath
+		}
+		return results[i].Metadata.StartLine < results[j].Metadata.StartLine
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbols(t *testing.T) {
+	// GIVEN
+	localStore, err := store.OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	chunks := []code.Chunk{
+		{Id: "tax_validate", Metadata: code.ChunkMetadata{FilePath: "tax.py", FunctionName: "validate", StartLine: 30, ChunkType: "functions", Root: "billing"}},
+		{Id: "token_class", Metadata: code.ChunkMetadata{FilePath: "token.py", ClassName: "TokenValidator", StartLine: 1, ChunkType: "classes", Root: "auth"}},
+		{Id: "token_validate", Metadata: code.ChunkMetadata{FilePath: "token.py", FunctionName: "validate", ClassName: "TokenValidator", StartLine: 5, ChunkType: "methods", Root: "auth"}},
+		{Id: "token_refresh", Metadata: code.ChunkMetadata{FilePath: "token.py", FunctionName: "refresh", ClassName: "TokenValidator", StartLine: 20, ChunkType: "methods", Root: "auth"}},
+		{Id: "invoice_validate", Metadata: code.ChunkMetadata{FilePath: "invoice.py", FunctionName: "validate", StartLine: 3, ChunkType: "functions", Root: "billing"}},
+	}
+	// metadata-only indexes store no embeddings
+	records, err := store.NewRecords(chunks, make([][]float32, len(chunks)))
+	require.NoError(t, err)
+	require.NoError(t, localStore.Upsert(records))
+
+	tests := []struct {
+		name    string
+		symbol  string
+		filter  Filter
+		limit   int
+		wantIds []string
+	}{
+		{
+			name:    "it should return the functions and methods named after the symbol, ordered by location",
+			symbol:  "validate",
+			wantIds: []string{"invoice_validate", "tax_validate", "token_validate"},
+		},
+		{
+			name:    "it should return the class named after the symbol, not its methods",
+			symbol:  "TokenValidator",
+			wantIds: []string{"token_class"},
+		},
+		{
+			name:    "it should return the method of the class for a qualified symbol",
+			symbol:  "TokenValidator.validate",
+			wantIds: []string{"token_validate"},
+		},
+		{
+			name:    "it should apply the filter",
+			symbol:  "validate",
+			filter:  Filter{"root": Filter{"$eq": "billing"}},
+			wantIds: []string{"invoice_validate", "tax_validate"},
+		},
+		{
+			name:    "it should stop at the limit",
+			symbol:  "validate",
+			limit:   1,
+			wantIds: []string{"invoice_validate"},
+		},
+		{
+			name:   "it should return nothing for an unknown symbol",
+			symbol: "missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			results, err := Symbols(localStore, tt.symbol, tt.filter, tt.limit)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIds, ids(results))
+		})
+	}
+}
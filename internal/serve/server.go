@@ -0,0 +1,446 @@
+package serve
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/health"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+)
+
+const quotaWindow = time.Minute
+
+type (
+	// Tenant is an isolated user of the server, with its own data, token, and quota
+	Tenant struct {
+		Name    string
+		Token   string
+		Querier search.Querier
+		Quota   Quota
+		// Collection is the name of the collection of the tenant, its stats are returned by Stats if not nil
+		Collection string
+		Stats      func() (health.Stats, error)
+		// Lines returns the chunks covering a line range and the related ones, POST /lines is disabled if nil
+		Lines func(lines search.LineRange, related int) (search.LinesResult, error)
+		// Delete deletes the chunks matching the selector and returns them, POST /delete is disabled if nil
+		Delete func(selector *store.Selector) ([]store.Record, error)
+		// Retag sets and removes metadata of the chunks matching the selector and returns them, POST /retag is
+		// disabled if nil
+		Retag func(selector *store.Selector, set map[string]any, unset []string) ([]store.Record, error)
+	}
+
+	// Quota limits the usage of a tenant, zero values mean unlimited
+	Quota struct {
+		QueriesPerMinute int
+		MaxResults       int
+	}
+
+	// Server exposes the search over http, the tenant is identified by the bearer token of the requests
+	Server struct {
+		logger  *zerolog.Logger
+		tenants []*tenantState
+		mux     *http.ServeMux
+		// draining is set once the server is shutting down, so the load balancers stop sending it requests
+		draining atomic.Bool
+	}
+
+	tenantState struct {
+		Tenant
+
+		lock        sync.Mutex
+		windowStart time.Time
+		queries     int
+	}
+
+	SearchRequest struct {
+		Query  string `json:"query"`
+		Limit  int    `json:"limit"`
+		Since  string `json:"since"`
+		Recent bool   `json:"recent"`
+	}
+
+	SearchResult struct {
+		Id        string  `json:"id"`
+		FilePath  string  `json:"file_path"`
+		StartLine int     `json:"start_line"`
+		EndLine   int     `json:"end_line"`
+		Score     float64 `json:"score"`
+		Document  string  `json:"document"`
+	}
+
+	SearchResponse struct {
+		Results []SearchResult `json:"results"`
+	}
+
+	// LinesRequest asks for the chunks covering a location like file.go:42 or file.go:42-60
+	LinesRequest struct {
+		Location string `json:"location"`
+		Related  int    `json:"related"`
+	}
+
+	LinesResponse struct {
+		Covering []SearchResult `json:"covering"`
+		Related  []SearchResult `json:"related"`
+	}
+
+	// DeleteRequest deletes the chunks matching a selector, e.g. path:vendor/** OR is_generated:true
+	DeleteRequest struct {
+		Selector string `json:"selector"`
+	}
+
+	// RetagRequest sets and removes metadata of the chunks matching a selector
+	RetagRequest struct {
+		Selector string         `json:"selector"`
+		Set      map[string]any `json:"set"`
+		Unset    []string       `json:"unset"`
+	}
+
+	// EditResponse lists the ids of the deleted or retagged chunks
+	EditResponse struct {
+		Ids []string `json:"ids"`
+	}
+
+	HealthResponse struct {
+		Status      string             `json:"status"`
+		Collections []CollectionHealth `json:"collections"`
+	}
+
+	CollectionHealth struct {
+		Name     string   `json:"name"`
+		Problems []string `json:"problems,omitempty"`
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewServer creates a server for the tenants, a single tenant without token can be used to disable authentication
+func NewServer(logger *zerolog.Logger, tenants ...Tenant) *Server {
+	server := &Server{logger: logger, mux: http.NewServeMux()}
+	for _, tenant := range tenants {
+		server.tenants = append(server.tenants, &tenantState{Tenant: tenant})
+	}
+	server.mux.HandleFunc("POST /search", server.handleSearch)
+	server.mux.HandleFunc("POST /lines", server.handleLines)
+	server.mux.HandleFunc("POST /delete", server.handleDelete)
+	server.mux.HandleFunc("POST /retag", server.handleRetag)
+	server.mux.HandleFunc("GET /healthz", server.handleHealth)
+	server.mux.HandleFunc("GET /livez", server.handleLiveness)
+	server.mux.HandleFunc("GET /readyz", server.handleReadiness)
+	server.mux.HandleFunc("GET /collections/{name}", server.handleCollection)
+	return server
+}
+
+// Drain reports the server as not ready, before it is shut down, the requests are still served
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	tenant := s.authenticate(r)
+	if tenant == nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"invalid or missing token"})
+		return
+	}
+	if !tenant.acquire(time.Now()) {
+		writeJSON(w, http.StatusTooManyRequests, errorResponse{"query quota exceeded"})
+		return
+	}
+
+	var request SearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"invalid request: " + err.Error()})
+		return
+	}
+	limit := request.Limit
+	if tenant.Quota.MaxResults > 0 && (limit <= 0 || limit > tenant.Quota.MaxResults) {
+		limit = tenant.Quota.MaxResults
+	}
+
+	text, filter := search.ParseQuery(request.Query)
+	opts := []search.Option{
+		search.WithRecencyBoost(request.Recent),
+		search.WithFilter(filter),
+	}
+	if limit > 0 {
+		opts = append(opts, search.WithLimit(limit))
+	}
+	if request.Since != "" {
+		since, err := search.ParseSince(request.Since, time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+			return
+		}
+		opts = append(opts, search.WithSince(since))
+	}
+
+	results, err := search.Search(tenant.Querier, text, opts...)
+	if err != nil {
+		s.logger.Error().Err(err).Str("tenant", tenant.Name).Msg("search failed")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{"search failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SearchResponse{Results: toSearchResults(results)})
+}
+
+func (s *Server) handleLines(w http.ResponseWriter, r *http.Request) {
+	tenant := s.authenticate(r)
+	if tenant == nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"invalid or missing token"})
+		return
+	}
+	if tenant.Lines == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{"line ranges are not supported by the store"})
+		return
+	}
+	if !tenant.acquire(time.Now()) {
+		writeJSON(w, http.StatusTooManyRequests, errorResponse{"query quota exceeded"})
+		return
+	}
+
+	var request LinesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"invalid request: " + err.Error()})
+		return
+	}
+	lines, err := search.ParseLineRange(request.Location)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+	related := request.Related
+	if tenant.Quota.MaxResults > 0 && related > tenant.Quota.MaxResults {
+		related = tenant.Quota.MaxResults
+	}
+
+	result, err := tenant.Lines(lines, related)
+	if err != nil {
+		s.logger.Error().Err(err).Str("tenant", tenant.Name).Msg("line range retrieval failed")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{"line range retrieval failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, LinesResponse{
+		Covering: toSearchResults(result.Covering),
+		Related:  toSearchResults(result.Related),
+	})
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	tenant := s.authenticate(r)
+	if tenant == nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"invalid or missing token"})
+		return
+	}
+	if tenant.Delete == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{"deletion is not supported by the store"})
+		return
+	}
+
+	var request DeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"invalid request: " + err.Error()})
+		return
+	}
+	selector, err := store.ParseSelector(request.Selector)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+
+	deleted, err := tenant.Delete(selector)
+	if err != nil {
+		s.logger.Error().Err(err).Str("tenant", tenant.Name).Msg("deletion failed")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{"deletion failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, EditResponse{Ids: recordIds(deleted)})
+}
+
+func (s *Server) handleRetag(w http.ResponseWriter, r *http.Request) {
+	tenant := s.authenticate(r)
+	if tenant == nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"invalid or missing token"})
+		return
+	}
+	if tenant.Retag == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{"retagging is not supported by the store"})
+		return
+	}
+
+	var request RetagRequest
+	decoder := json.NewDecoder(r.Body)
+	// the numbers are converted as by mm retag, integers staying integers
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"invalid request: " + err.Error()})
+		return
+	}
+	if len(request.Set) == 0 && len(request.Unset) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"either set or unset is required"})
+		return
+	}
+	if _, found := request.Set["file_path"]; found || slices.Contains(request.Unset, "file_path") {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"the file path of the chunks cannot be changed"})
+		return
+	}
+	selector, err := store.ParseSelector(request.Selector)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+	for key, value := range request.Set {
+		if number, ok := value.(json.Number); ok {
+			request.Set[key] = store.ParseMetadataValue(number.String())
+		}
+	}
+
+	updated, err := tenant.Retag(selector, request.Set, request.Unset)
+	if err != nil {
+		s.logger.Error().Err(err).Str("tenant", tenant.Name).Msg("retagging failed")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{"retagging failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, EditResponse{Ids: recordIds(updated)})
+}
+
+func recordIds(records []store.Record) []string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.Id
+	}
+	return ids
+}
+
+func toSearchResults(results []search.Result) []SearchResult {
+	converted := make([]SearchResult, len(results))
+	for i, result := range results {
+		converted[i] = SearchResult{
+			Id:        result.Id,
+			FilePath:  result.Metadata.FilePath,
+			StartLine: result.Metadata.StartLine,
+			EndLine:   result.Metadata.EndLine,
+			Score:     result.Score,
+			Document:  result.Document,
+		}
+	}
+	return converted
+}
+
+// handleHealth reports the problems of the collections, without authentication so monitoring can poll it, the
+// counters of a collection are only exposed to its tenant
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	response := HealthResponse{Status: "ok", Collections: []CollectionHealth{}}
+	for _, tenant := range s.tenants {
+		if tenant.Stats == nil {
+			continue
+		}
+		collection := CollectionHealth{Name: tenant.Collection}
+		stats, err := tenant.Stats()
+		if err != nil {
+			s.logger.Error().Err(err).Str("tenant", tenant.Name).Msg("failed to get stats")
+			collection.Problems = []string{"stats unavailable"}
+		} else {
+			collection.Problems = stats.Problems
+		}
+		if len(collection.Problems) > 0 {
+			response.Status = "unhealthy"
+		}
+		response.Collections = append(response.Collections, collection)
+	}
+
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
+
+// handleLiveness answers as long as the server runs, unlike /healthz it does not depend on the collections, so the
+// orchestrator does not restart the server when they are stale
+func (s *Server) handleLiveness(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok", Collections: []CollectionHealth{}})
+}
+
+// handleReadiness answers 503 once the server is draining
+func (s *Server) handleReadiness(w http.ResponseWriter, _ *http.Request) {
+	if s.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: "draining", Collections: []CollectionHealth{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok", Collections: []CollectionHealth{}})
+}
+
+func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request) {
+	tenant := s.authenticate(r)
+	if tenant == nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"invalid or missing token"})
+		return
+	}
+	if tenant.Stats == nil || tenant.Collection != r.PathValue("name") {
+		writeJSON(w, http.StatusNotFound, errorResponse{"unknown collection"})
+		return
+	}
+
+	stats, err := tenant.Stats()
+	if err != nil {
+		s.logger.Error().Err(err).Str("tenant", tenant.Name).Msg("failed to get stats")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{"stats unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// authenticate returns the tenant owning the bearer token of the request, nil if there is none
+func (s *Server) authenticate(r *http.Request) *tenantState {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, tenant := range s.tenants {
+		if tenant.Token == "" {
+			// authentication disabled
+			return tenant
+		}
+		if subtle.ConstantTimeCompare([]byte(tenant.Token), []byte(token)) == 1 {
+			return tenant
+		}
+	}
+	return nil
+}
+
+// acquire consumes a query of the quota, returns false if the quota of the current window is exhausted
+func (t *tenantState) acquire(now time.Time) bool {
+	if t.Quota.QueriesPerMinute <= 0 {
+		return true
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if now.Sub(t.windowStart) >= quotaWindow {
+		t.windowStart = now
+		t.queries = 0
+	}
+	if t.queries >= t.Quota.QueriesPerMinute {
+		return false
+	}
+	t.queries++
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
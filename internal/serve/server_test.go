@@ -0,0 +1,437 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+	"github.com/a-peyrard/mm/internal/health"
+	"github.com/a-peyrard/mm/internal/search"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuerier struct {
+	filePath string
+}
+
+func (f fakeQuerier) Query(query embedding.Query) ([]embedding.QueryResult, error) {
+	var results []embedding.QueryResult
+	for i := 0; i < query.NResults; i++ {
+		results = append(results, embedding.QueryResult{
+			Id:       f.filePath,
+			Metadata: code.ChunkMetadata{FilePath: f.filePath},
+			Distance: float64(i),
+		})
+	}
+	return results, nil
+}
+
+func newTestServer() *Server {
+	logger := zerolog.Nop()
+	return NewServer(
+		&logger,
+		Tenant{Name: "payments", Token: "payments-token", Querier: fakeQuerier{"payments.go"}},
+		Tenant{
+			Name:    "search",
+			Token:   "search-token",
+			Querier: fakeQuerier{"search.go"},
+			Quota:   Quota{QueriesPerMinute: 1, MaxResults: 2},
+		},
+	)
+}
+
+func doSearch(server *Server, token string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestServer_Search(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        string
+		wantStatus   int
+		wantFilePath string
+		wantResults  int
+	}{
+		{
+			name:         "it should search in the data of the tenant owning the token",
+			token:        "payments-token",
+			wantStatus:   http.StatusOK,
+			wantFilePath: "payments.go",
+			wantResults:  5,
+		},
+		{
+			name:         "it should cap the number of results to the quota of the tenant",
+			token:        "search-token",
+			wantStatus:   http.StatusOK,
+			wantFilePath: "search.go",
+			wantResults:  2,
+		},
+		{
+			name:       "it should reject an unknown token",
+			token:      "other-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "it should reject a request without token",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			server := newTestServer()
+
+			// WHEN
+			recorder := doSearch(server, tt.token, `{"query": "validate token", "limit": 5}`)
+
+			// THEN
+			require.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response SearchResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			require.Len(t, response.Results, tt.wantResults)
+			assert.Equal(t, tt.wantFilePath, response.Results[0].FilePath)
+		})
+	}
+}
+
+func TestServer_Search_Quota(t *testing.T) {
+	// GIVEN
+	server := newTestServer()
+	require.Equal(t, http.StatusOK, doSearch(server, "search-token", `{"query": "index"}`).Code)
+
+	// WHEN
+	exceeded := doSearch(server, "search-token", `{"query": "index"}`)
+	other := doSearch(server, "payments-token", `{"query": "index"}`)
+
+	// THEN
+	assert.Equal(t, http.StatusTooManyRequests, exceeded.Code)
+	assert.Equal(t, http.StatusOK, other.Code, "it should not share the quota between tenants")
+}
+
+func TestServer_Health(t *testing.T) {
+	// GIVEN
+	logger := zerolog.Nop()
+	statsOf := func(stats health.Stats) func() (health.Stats, error) {
+		return func() (health.Stats, error) { return stats, nil }
+	}
+	server := NewServer(
+		&logger,
+		Tenant{
+			Name:       "payments",
+			Token:      "payments-token",
+			Querier:    fakeQuerier{"payments.go"},
+			Collection: "code_chunks_payments",
+			Stats:      statsOf(health.Stats{Name: "code_chunks_payments", Chunks: 12, IndexedChunks: 12}),
+		},
+		Tenant{
+			Name:       "search",
+			Token:      "search-token",
+			Querier:    fakeQuerier{"search.go"},
+			Collection: "code_chunks_search",
+			Stats:      statsOf(health.Stats{Name: "code_chunks_search", Problems: []string{"stalled: never indexed"}}),
+		},
+	)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "it should report the problems of the collections without authentication",
+			path:       "/healthz",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody: `{"status": "unhealthy", "collections": [
+				{"name": "code_chunks_payments"},
+				{"name": "code_chunks_search", "problems": ["stalled: never indexed"]}
+			]}`,
+		},
+		{
+			name:       "it should stay alive while the collections are unhealthy",
+			path:       "/livez",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status": "ok", "collections": []}`,
+		},
+		{
+			name:       "it should be ready until it drains",
+			path:       "/readyz",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status": "ok", "collections": []}`,
+		},
+		{
+			name:       "it should return the stats of the collection of the tenant",
+			path:       "/collections/code_chunks_payments",
+			token:      "payments-token",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name": "code_chunks_payments", "backend": "", "chunks": 12, "indexed_chunks": 12, "files": 0}`,
+		},
+		{
+			name:       "it should hide the collections of the other tenants",
+			path:       "/collections/code_chunks_search",
+			token:      "payments-token",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error": "unknown collection"}`,
+		},
+		{
+			name:       "it should require a token for the stats of a collection",
+			path:       "/collections/code_chunks_payments",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error": "invalid or missing token"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+
+			// WHEN
+			server.ServeHTTP(recorder, request)
+
+			// THEN
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			assert.JSONEq(t, tt.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestServer_Drain(t *testing.T) {
+	// GIVEN
+	logger := zerolog.Nop()
+	server := NewServer(&logger, Tenant{Name: "default", Querier: fakeQuerier{"payments.go"}})
+
+	// WHEN
+	server.Drain()
+	readiness := httptest.NewRecorder()
+	server.ServeHTTP(readiness, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	search := httptest.NewRecorder()
+	server.ServeHTTP(search, httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query": "refund"}`)))
+
+	// THEN
+	assert.Equal(t, http.StatusServiceUnavailable, readiness.Code, "it should not be ready once draining")
+	assert.Equal(t, http.StatusOK, search.Code, "it should still serve the requests")
+}
+
+func TestServer_Lines(t *testing.T) {
+	logger := zerolog.Nop()
+	lines := func(lines search.LineRange, related int) (search.LinesResult, error) {
+		covering := search.Result{QueryResult: embedding.QueryResult{
+			Id:       "tax_1",
+			Metadata: code.ChunkMetadata{FilePath: lines.FilePath, StartLine: 1, EndLine: lines.End},
+		}}
+		result := search.LinesResult{Covering: []search.Result{covering}}
+		for i := 0; i < related; i++ {
+			result.Related = append(result.Related, search.Result{QueryResult: embedding.QueryResult{Id: "related"}})
+		}
+		return result, nil
+	}
+	tests := []struct {
+		name        string
+		tenant      Tenant
+		body        string
+		wantStatus  int
+		wantRelated int
+	}{
+		{
+			name:        "it should return the chunks covering the location and the related ones",
+			tenant:      Tenant{Name: "default", Lines: lines},
+			body:        `{"location": "tax.py:1-12", "related": 3}`,
+			wantStatus:  http.StatusOK,
+			wantRelated: 3,
+		},
+		{
+			name:        "it should cap the related chunks to the quota of the tenant",
+			tenant:      Tenant{Name: "default", Lines: lines, Quota: Quota{MaxResults: 2}},
+			body:        `{"location": "tax.py:1-12", "related": 3}`,
+			wantStatus:  http.StatusOK,
+			wantRelated: 2,
+		},
+		{
+			name:       "it should reject an invalid location",
+			tenant:     Tenant{Name: "default", Lines: lines},
+			body:       `{"location": "tax.py"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "it should not be found if the store does not support it",
+			tenant:     Tenant{Name: "default"},
+			body:       `{"location": "tax.py:12"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			server := NewServer(&logger, tt.tenant)
+			request := httptest.NewRequest(http.MethodPost, "/lines", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			// WHEN
+			server.ServeHTTP(recorder, request)
+
+			// THEN
+			require.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response LinesResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			require.Len(t, response.Covering, 1)
+			assert.Equal(t, "tax.py", response.Covering[0].FilePath)
+			assert.Equal(t, 12, response.Covering[0].EndLine)
+			assert.Len(t, response.Related, tt.wantRelated)
+		})
+	}
+}
+
+func newEditableStore(t *testing.T) *store.Local {
+	local, err := store.OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	require.NoError(t, local.Upsert([]store.Record{
+		{Id: "vendor/lib.go_Parse_1", Metadata: map[string]any{"file_path": "vendor/lib.go"}, Embedding: []float32{1, 0}},
+		{Id: "tax.go_Rate_1", Metadata: map[string]any{"file_path": "tax.go"}, Embedding: []float32{0, 1}},
+	}))
+	return local
+}
+
+func TestServer_Delete(t *testing.T) {
+	logger := zerolog.Nop()
+	tests := []struct {
+		name       string
+		editable   bool
+		body       string
+		wantStatus int
+		wantIds    []string
+	}{
+		{
+			name:       "it should delete the chunks matching the selector",
+			editable:   true,
+			body:       `{"selector": "path:vendor/**"}`,
+			wantStatus: http.StatusOK,
+			wantIds:    []string{"vendor/lib.go_Parse_1"},
+		},
+		{
+			name:       "it should reject an invalid selector",
+			editable:   true,
+			body:       `{"selector": "vendor"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "it should not be found if the store does not support it",
+			body:       `{"selector": "path:vendor/**"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			local := newEditableStore(t)
+			tenant := Tenant{Name: "default"}
+			if tt.editable {
+				tenant.Delete = func(selector *store.Selector) ([]store.Record, error) {
+					return store.DeleteWhere(local, selector)
+				}
+			}
+			server := NewServer(&logger, tenant)
+			request := httptest.NewRequest(http.MethodPost, "/delete", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			// WHEN
+			server.ServeHTTP(recorder, request)
+
+			// THEN
+			require.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response EditResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantIds, response.Ids)
+			remaining, err := local.Peek(0, nil)
+			require.NoError(t, err)
+			require.Len(t, remaining, 1)
+			assert.Equal(t, "tax.go_Rate_1", remaining[0].Id)
+		})
+	}
+}
+
+func TestServer_Retag(t *testing.T) {
+	logger := zerolog.Nop()
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantMetadata map[string]any
+	}{
+		{
+			name:         "it should set and remove the metadata of the chunks matching the selector",
+			body:         `{"selector": "path:tax.go", "set": {"owner": "payments", "priority": 2}, "unset": ["missing"]}`,
+			wantStatus:   http.StatusOK,
+			wantMetadata: map[string]any{"file_path": "tax.go", "owner": "payments", "priority": int64(2)},
+		},
+		{
+			name:       "it should require metadata to set or remove",
+			body:       `{"selector": "path:tax.go"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "it should refuse to change the file path",
+			body:       `{"selector": "path:tax.go", "set": {"file_path": "other.go"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			local := newEditableStore(t)
+			server := NewServer(&logger, Tenant{
+				Name: "default",
+				Retag: func(selector *store.Selector, set map[string]any, unset []string) ([]store.Record, error) {
+					return store.RetagWhere(local, selector, set, unset)
+				},
+			})
+			request := httptest.NewRequest(http.MethodPost, "/retag", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			// WHEN
+			server.ServeHTTP(recorder, request)
+
+			// THEN
+			require.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response EditResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, []string{"tax.go_Rate_1"}, response.Ids)
+			records, err := local.Peek(0, nil)
+			require.NoError(t, err)
+			for _, record := range records {
+				if record.Id == "tax.go_Rate_1" {
+					assert.Equal(t, tt.wantMetadata, record.Metadata)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// formatVersion is the version of the layout of the archives
+const formatVersion = 1
+
+// MetadataName is the name of the entry describing the snapshot, first in the archive
+const MetadataName = "snapshot.json"
+
+type (
+	// Metadata describes the index packaged in a snapshot
+	Metadata struct {
+		Version   int       `json:"version"`
+		CreatedAt time.Time `json:"created_at"`
+		// MMVersion is the version of mm which created the snapshot
+		MMVersion string `json:"mm_version"`
+		Backend   string `json:"backend"`
+		// Collection is the collection of the index, or the path of the store of the local backend
+		Collection string `json:"collection"`
+	}
+
+	// Writer packages files and directories in a gzipped tar archive
+	Writer struct {
+		gzip *gzip.Writer
+		tar  *tar.Writer
+	}
+)
+
+// NewWriter creates a snapshot writing to w, starting with its metadata
+func NewWriter(w io.Writer, metadata Metadata) (*Writer, error) {
+	gzipWriter := gzip.NewWriter(w)
+	writer := &Writer{gzip: gzipWriter, tar: tar.NewWriter(gzipWriter)}
+
+	metadata.Version = formatVersion
+	content, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot metadata: %w", err)
+	}
+	if err := writer.AddBytes(MetadataName, content); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// AddBytes adds an entry holding the content
+func (w *Writer) AddBytes(name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write snapshot entry %s: %w", name, err)
+	}
+	if _, err := w.tar.Write(content); err != nil {
+		return fmt.Errorf("failed to write snapshot entry %s: %w", name, err)
+	}
+	return nil
+}
+
+// AddFile adds the file at filePath as the entry name
+func (w *Writer) AddFile(name string, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", filePath, err)
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot entry %s: %w", name, err)
+	}
+	header.Name = name
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write snapshot entry %s: %w", name, err)
+	}
+	if _, err := io.Copy(w.tar, file); err != nil {
+		return fmt.Errorf("failed to write snapshot entry %s: %w", name, err)
+	}
+	return nil
+}
+
+// AddDir adds the regular files of the directory, and of its subdirectories, under the entry name
+func (w *Writer) AddDir(name string, dir string) error {
+	return filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		return w.AddFile(path.Join(name, filepath.ToSlash(relPath)), filePath)
+	})
+}
+
+// Close flushes the archive, the underlying writer is not closed
+func (w *Writer) Close() error {
+	if err := w.tar.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := w.gzip.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	return nil
+}
+
+// Extract unpacks the snapshot in the directory, returns its metadata
+func Extract(r io.Reader, dir string) (Metadata, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	defer func() {
+		_ = gzipReader.Close()
+	}()
+
+	var metadata Metadata
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Metadata{}, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if header.Name == MetadataName {
+			if err := json.NewDecoder(tarReader).Decode(&metadata); err != nil {
+				return Metadata{}, fmt.Errorf("failed to decode snapshot metadata: %w", err)
+			}
+			continue
+		}
+		target, err := entryPath(dir, header.Name)
+		if err != nil {
+			return Metadata{}, err
+		}
+		if err := extractFile(tarReader, target, header.FileInfo().Mode().Perm()); err != nil {
+			return Metadata{}, err
+		}
+	}
+
+	if metadata.Version == 0 {
+		return Metadata{}, fmt.Errorf("not a snapshot of mm, %s is missing", MetadataName)
+	}
+	if metadata.Version != formatVersion {
+		return Metadata{}, fmt.Errorf("snapshot version %d is not supported, expected %d", metadata.Version, formatVersion)
+	}
+	return metadata, nil
+}
+
+// entryPath returns where the entry is extracted in the directory, entries escaping it are rejected
+func entryPath(dir string, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid snapshot entry %s", name)
+	}
+	return target, nil
+}
+
+func extractFile(r io.Reader, target string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", target, err)
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to extract %s: %w", target, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", target, err)
+	}
+	return nil
+}
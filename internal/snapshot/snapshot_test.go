@@ -0,0 +1,93 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	// GIVEN
+	source := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "chroma", "segments"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "chroma", "chroma.sqlite3"), []byte("sqlite"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "chroma", "segments", "data.bin"), []byte("vectors"), 0644))
+	metadata := Metadata{
+		CreatedAt:  time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		MMVersion:  "1.2.0",
+		Backend:    "chroma",
+		Collection: "code_chunks_billing_1a2b3c4d",
+	}
+
+	var archive bytes.Buffer
+	writer, err := NewWriter(&archive, metadata)
+	require.NoError(t, err)
+	require.NoError(t, writer.AddBytes("config.yaml", []byte("store:\n  backend: chroma\n")))
+	require.NoError(t, writer.AddDir("data/chroma", filepath.Join(source, "chroma")))
+	require.NoError(t, writer.Close())
+
+	// WHEN
+	target := t.TempDir()
+	got, err := Extract(&archive, target)
+
+	// THEN
+	require.NoError(t, err)
+	metadata.Version = formatVersion
+	assert.Equal(t, metadata, got)
+	for name, want := range map[string]string{
+		"config.yaml":                   "store:\n  backend: chroma\n",
+		"data/chroma/chroma.sqlite3":    "sqlite",
+		"data/chroma/segments/data.bin": "vectors",
+	} {
+		content, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), name)
+	}
+}
+
+func TestExtract_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries map[string]string
+		wantErr string
+	}{
+		{
+			name:    "it should reject an archive without metadata",
+			entries: map[string]string{"data/store.gob": "records"},
+			wantErr: "not a snapshot of mm",
+		},
+		{
+			name:    "it should reject entries escaping the directory",
+			entries: map[string]string{"../outside": "oops"},
+			wantErr: "invalid snapshot entry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			var archive bytes.Buffer
+			gzipWriter := gzip.NewWriter(&archive)
+			tarWriter := tar.NewWriter(gzipWriter)
+			for name, content := range tt.entries {
+				require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+				_, err := tarWriter.Write([]byte(content))
+				require.NoError(t, err)
+			}
+			require.NoError(t, tarWriter.Close())
+			require.NoError(t, gzipWriter.Close())
+
+			// WHEN
+			_, err := Extract(&archive, t.TempDir())
+
+			// THEN
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import "github.com/a-peyrard/mm/internal/embedding"
+
+type (
+	// Chroma is a store backed by a chroma server, reached through a python indexer running in store only mode
+	Chroma struct {
+		indexer *embedding.RunningIndexer
+
+		// space of the new collections, their metric is set by the indexer, see embedding.WithCollectionSpace
+		space Space
+	}
+
+	// ChromaOption tunes a chroma store
+	ChromaOption func(*Chroma)
+)
+
+// WithChromaSpace normalizes the embeddings when the space is normalized, the indexer compares them with its metric
+func WithChromaSpace(space Space) ChromaOption {
+	return func(c *Chroma) {
+		c.space = space
+	}
+}
+
+// NewChroma creates a store using the indexer, which is closed with the store
+func NewChroma(indexer *embedding.RunningIndexer, opts ...ChromaOption) *Chroma {
+	chroma := &Chroma{indexer: indexer, space: Space{Metric: L2Metric}}
+	for _, opt := range opts {
+		opt(chroma)
+	}
+	return chroma
+}
+
+func (c *Chroma) Upsert(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if c.space.Normalized {
+		records = normalizeRecords(records)
+	}
+	raw := make([]embedding.RawRecord, len(records))
+	for i, record := range records {
+		raw[i] = embedding.RawRecord(record)
+	}
+	return c.indexer.Upsert(raw)
+}
+
+func (c *Chroma) Query(vector []float32, nResults int, where map[string]any) ([]embedding.QueryResult, error) {
+	if c.space.Normalized {
+		vector = normalize(vector)
+	}
+	return c.indexer.QueryEmbedding(vector, nResults, where)
+}
+
+func (c *Chroma) DeleteByFile(filePath string) error {
+	return c.indexer.DeleteByFile(filePath)
+}
+
+func (c *Chroma) Stats() (Stats, error) {
+	count, dimensions, err := c.indexer.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{Records: count, Dimensions: dimensions}, nil
+}
+
+// Check looks for corruptions left by hard kills of previous runs, returns the problems found
+func (c *Chroma) Check() ([]string, error) {
+	return c.indexer.CheckStore()
+}
+
+// Repair recreates the collection, all the chunks have to be indexed again
+func (c *Chroma) Repair() error {
+	return c.indexer.ResetStore()
+}
+
+// Compact always fails with ErrStoreInUse, the sqlite database of chroma is held by its server while the store is
+// open, it is vacuumed with the chroma cli once the server is stopped
+func (c *Chroma) Compact() error {
+	return ErrStoreInUse
+}
+
+func (c *Chroma) DeleteAll() error {
+	return c.indexer.ResetStore()
+}
+
+func (c *Chroma) Close() error {
+	return c.indexer.Close()
+}
+
+func (c *Chroma) Collections() ([]string, error) {
+	return c.indexer.Collections()
+}
+
+func (c *Chroma) Peek(limit int, where map[string]any) ([]Record, error) {
+	raw, err := c.indexer.Peek(limit, where)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(raw))
+	for i, record := range raw {
+		records[i] = Record(record)
+	}
+	return records, nil
+}
+
+// Scan reads the records by offset in the collection, the records written during the scan may be missed
+func (c *Chroma) Scan(pageSize int, consume func(records []Record) error) error {
+	for offset := 0; ; offset += pageSize {
+		raw, err := c.indexer.PeekPage(offset, pageSize)
+		if err != nil {
+			return err
+		}
+		records := make([]Record, len(raw))
+		for i, record := range raw {
+			records[i] = Record(record)
+		}
+		if len(records) > 0 {
+			if err := consume(records); err != nil {
+				return err
+			}
+		}
+		if len(records) < pageSize {
+			return nil
+		}
+	}
+}
+
+func (c *Chroma) Delete(ids []string) error {
+	return c.indexer.Delete(ids)
+}
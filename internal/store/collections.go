@@ -0,0 +1,121 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/config"
+)
+
+type (
+	// CollectionManager lists, creates, and drops the collections of a backend
+	CollectionManager interface {
+		Collections() ([]string, error)
+		// CreateCollection creates an empty collection for embeddings of the given dimensions
+		CreateCollection(name string, dimensions int) error
+		DropCollection(name string) error
+	}
+
+	// LocalCollections manages the collections of the local backend, each one being a directory holding its store
+	LocalCollections struct {
+		dir      string
+		fileName string
+	}
+)
+
+var (
+	_ CollectionManager = (*LocalCollections)(nil)
+	_ CollectionManager = (*Qdrant)(nil)
+	_ CollectionManager = (*Chroma)(nil)
+)
+
+// NewLocalCollections manages the collections stored in dir, in files named fileName
+func NewLocalCollections(dir string, fileName string) *LocalCollections {
+	return &LocalCollections{dir: dir, fileName: fileName}
+}
+
+func (l *LocalCollections) Collections() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections in %s: %w", l.dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (l *LocalCollections) CreateCollection(name string, _ int) error {
+	path := filepath.Join(l.dir, name, l.fileName)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("collection %s already exists", name)
+	}
+	store, err := OpenLocal(path)
+	if err != nil {
+		return err
+	}
+	// an empty store is not written by Close
+	store.dirty = true
+	return store.Close()
+}
+
+func (l *LocalCollections) DropCollection(name string) error {
+	if err := config.ValidateCollectionName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(l.dir, name)
+	// never remove anything outside of the collections, whatever the name slipped through
+	if rel, err := filepath.Rel(l.dir, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("collection %s is not under %s", name, l.dir)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("collection %s does not exist", name)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to drop collection %s: %w", name, err)
+	}
+	return nil
+}
+
+func (q *Qdrant) CreateCollection(name string, dimensions int) error {
+	other := NewQdrant(q.ctx, q.baseURL, q.apiKey, name, WithQdrantSpace(q.space), WithQdrantQuantization(q.quantization, q.rescore))
+	var status int
+	if err := other.call(http.MethodGet, other.collectionPath(""), nil, nil, &status); err == nil {
+		return fmt.Errorf("collection %s already exists", name)
+	} else if status != http.StatusNotFound {
+		return err
+	}
+	return other.ensureCollection(dimensions)
+}
+
+func (q *Qdrant) DropCollection(name string) error {
+	other := NewQdrant(q.ctx, q.baseURL, q.apiKey, name, WithQdrantSpace(q.space), WithQdrantQuantization(q.quantization, q.rescore))
+	var status int
+	err := other.call(http.MethodDelete, other.collectionPath(""), nil, nil, &status)
+	if status == http.StatusNotFound {
+		return fmt.Errorf("collection %s does not exist", name)
+	}
+	return err
+}
+
+func (c *Chroma) CreateCollection(name string, _ int) error {
+	return c.indexer.CreateCollection(name)
+}
+
+func (c *Chroma) DropCollection(name string) error {
+	return c.indexer.DropCollection(name)
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCollections(t *testing.T) {
+	// GIVEN
+	collections := NewLocalCollections(t.TempDir(), "store.gob")
+	require.NoError(t, collections.CreateCollection("main", 2))
+	require.NoError(t, collections.CreateCollection("feature-x", 2))
+
+	// WHEN
+	err := collections.CreateCollection("main", 2)
+
+	// THEN
+	assert.Error(t, err, "it should not create a collection twice")
+	names, err := collections.Collections()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"feature-x", "main"}, names)
+
+	require.NoError(t, collections.DropCollection("feature-x"))
+	names, err = collections.Collections()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main"}, names, "it should drop the collection")
+	assert.Error(t, collections.DropCollection("feature-x"), "it should not drop an unknown collection")
+}
+
+func TestLocalCollectionsDropOutside(t *testing.T) {
+	// GIVEN
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	require.NoError(t, os.Mkdir(outside, 0o755))
+	collections := NewLocalCollections(filepath.Join(root, "collections"), "store.gob")
+	require.NoError(t, collections.CreateCollection("main", 2))
+
+	for _, name := range []string{"..", "../outside", ".", ""} {
+		// WHEN
+		err := collections.DropCollection(name)
+
+		// THEN
+		assert.Error(t, err, "it should refuse to drop %q", name)
+	}
+	assert.DirExists(t, outside, "it should not remove anything outside of the collections")
+	assert.DirExists(t, filepath.Join(root, "collections", "main"), "it should keep the collections")
+}
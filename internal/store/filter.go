@@ -0,0 +1,148 @@
+package store
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// normalizeFilter converts a filter built from any map or slice types, to plain maps and slices of any
+func normalizeFilter(where map[string]any) (map[string]any, error) {
+	if len(where) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(where)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]any
+	err = json.Unmarshal(bytes, &normalized)
+	return normalized, err
+}
+
+// matches evaluates a normalized chroma-like where filter ($and, $or, $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, and
+// $contains for the array values) against the metadata of a record, an empty filter matches everything
+func matches(metadata map[string]any, where map[string]any) bool {
+	for key, condition := range where {
+		switch key {
+		case "$and":
+			for _, sub := range asFilters(condition) {
+				if !matches(metadata, sub) {
+					return false
+				}
+			}
+		case "$or":
+			found := false
+			for _, sub := range asFilters(condition) {
+				if matches(metadata, sub) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			if !matchesField(metadata[key], condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesField(value any, condition any) bool {
+	operators, ok := asFilter(condition)
+	if !ok {
+		// shorthand for $eq
+		return equals(value, condition)
+	}
+
+	for operator, operand := range operators {
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = equals(value, operand)
+		case "$ne":
+			ok = !equals(value, operand)
+		case "$gt":
+			ok = compare(value, operand, func(c int) bool { return c > 0 })
+		case "$gte":
+			ok = compare(value, operand, func(c int) bool { return c >= 0 })
+		case "$lt":
+			ok = compare(value, operand, func(c int) bool { return c < 0 })
+		case "$lte":
+			ok = compare(value, operand, func(c int) bool { return c <= 0 })
+		case "$in":
+			ok = slices.ContainsFunc(asSlice(operand), func(candidate any) bool { return equals(value, candidate) })
+		case "$nin":
+			ok = !slices.ContainsFunc(asSlice(operand), func(candidate any) bool { return equals(value, candidate) })
+		case "$contains":
+			ok = slices.ContainsFunc(asSlice(value), func(element any) bool { return equals(element, operand) })
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func equals(a any, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	return a == b
+}
+
+func compare(a any, b any, accept func(int) bool) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if !okA || !okB {
+		return false
+	}
+	switch {
+	case fa < fb:
+		return accept(-1)
+	case fa > fb:
+		return accept(1)
+	default:
+		return accept(0)
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func asFilter(v any) (map[string]any, bool) {
+	f, ok := v.(map[string]any)
+	return f, ok
+}
+
+func asFilters(v any) []map[string]any {
+	var filters []map[string]any
+	for _, item := range asSlice(v) {
+		if filter, ok := asFilter(item); ok {
+			filters = append(filters, filter)
+		}
+	}
+	return filters
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+// copyBatchSize is the number of records copied at once into the next generation
+const copyBatchSize = 512
+
+type (
+	// Generations records the generation of a collection published by the last complete indexing run, searches keep
+	// reading it while the next run writes a copy of it, published once complete
+	Generations struct {
+		path string
+	}
+
+	generationsFile struct {
+		Published int `json:"published"`
+	}
+
+	// Follower reads the published generation of a collection, reopening the store whenever a new generation is
+	// published, so long-running readers follow the indexing runs
+	Follower struct {
+		generations *Generations
+		open        func(generation int) (VectorStore, error)
+
+		lock       sync.RWMutex
+		current    VectorStore
+		generation int
+	}
+)
+
+var (
+	_ VectorStore = (*Follower)(nil)
+	_ Inspector   = (*Follower)(nil)
+)
+
+// NewGenerations tracks the generations of a collection in the file at path
+func NewGenerations(path string) *Generations {
+	return &Generations{path: path}
+}
+
+// GenerationName returns the name of the collection holding a generation, the collection itself for generation 0
+func GenerationName(collection string, generation int) string {
+	if generation == 0 {
+		return collection
+	}
+	return fmt.Sprintf("%s_g%d", collection, generation)
+}
+
+// Published returns the published generation, 0 if none was published yet
+func (g *Generations) Published() (int, error) {
+	content, err := os.ReadFile(g.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read generations %s: %w", g.path, err)
+	}
+	var file generationsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return 0, fmt.Errorf("failed to decode generations %s: %w", g.path, err)
+	}
+	return file.Published, nil
+}
+
+// Publish switches the readers to the generation, the file is replaced atomically
+func (g *Generations) Publish(generation int) error {
+	content, err := json.Marshal(generationsFile{Published: generation})
+	if err != nil {
+		return fmt.Errorf("failed to encode generations: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return fmt.Errorf("failed to create generations directory: %w", err)
+	}
+	tmpPath := g.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write generations %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, g.path); err != nil {
+		return fmt.Errorf("failed to replace generations %s: %w", g.path, err)
+	}
+	return nil
+}
+
+// CopyRecords copies all the records of the source into the target, page by page if the source is a Scanner, returns
+// the number of records copied
+func CopyRecords(source Inspector, target VectorStore) (int, error) {
+	copied := 0
+	var copyErr error
+	err := ScanRecords(source, copyBatchSize, func(records []Record) error {
+		if copyErr = target.Upsert(records); copyErr != nil {
+			return copyErr
+		}
+		copied += len(records)
+		return nil
+	})
+	if copyErr != nil {
+		return copied, fmt.Errorf("failed to copy records: %w", copyErr)
+	}
+	if err != nil {
+		return copied, fmt.Errorf("failed to read records to copy: %w", err)
+	}
+	return copied, nil
+}
+
+// NewFollower opens the store of the published generation with open, and reopens it once another is published
+func NewFollower(generations *Generations, open func(generation int) (VectorStore, error)) (*Follower, error) {
+	generation, err := generations.Published()
+	if err != nil {
+		return nil, err
+	}
+	current, err := open(generation)
+	if err != nil {
+		return nil, err
+	}
+	return &Follower{generations: generations, open: open, current: current, generation: generation}, nil
+}
+
+// store returns the store of the published generation, switching to it if needed, the returned function releases it
+func (f *Follower) store() (VectorStore, func(), error) {
+	generation, err := f.generations.Published()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f.lock.RLock()
+	if generation == f.generation {
+		return f.current, f.lock.RUnlock, nil
+	}
+	f.lock.RUnlock()
+
+	f.lock.Lock()
+	if generation != f.generation {
+		next, err := f.open(generation)
+		if err != nil {
+			f.lock.Unlock()
+			return nil, nil, fmt.Errorf("failed to open generation %d: %w", generation, err)
+		}
+		// the readers of the previous generation are done, they hold the read lock while using it
+		_ = f.current.Close()
+		f.current, f.generation = next, generation
+	}
+	f.lock.Unlock()
+
+	f.lock.RLock()
+	return f.current, f.lock.RUnlock, nil
+}
+
+func (f *Follower) Upsert(records []Record) error {
+	current, release, err := f.store()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return current.Upsert(records)
+}
+
+func (f *Follower) Query(vector []float32, nResults int, where map[string]any) ([]embedding.QueryResult, error) {
+	current, release, err := f.store()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return current.Query(vector, nResults, where)
+}
+
+func (f *Follower) DeleteByFile(filePath string) error {
+	current, release, err := f.store()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return current.DeleteByFile(filePath)
+}
+
+func (f *Follower) DeleteAll() error {
+	current, release, err := f.store()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return current.DeleteAll()
+}
+
+func (f *Follower) Stats() (Stats, error) {
+	current, release, err := f.store()
+	if err != nil {
+		return Stats{}, err
+	}
+	defer release()
+	return current.Stats()
+}
+
+func (f *Follower) Collections() ([]string, error) {
+	inspector, release, err := f.inspector()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return inspector.Collections()
+}
+
+func (f *Follower) Peek(limit int, where map[string]any) ([]Record, error) {
+	inspector, release, err := f.inspector()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return inspector.Peek(limit, where)
+}
+
+func (f *Follower) Scan(pageSize int, consume func(records []Record) error) error {
+	inspector, release, err := f.inspector()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return ScanRecords(inspector, pageSize, consume)
+}
+
+func (f *Follower) Delete(ids []string) error {
+	inspector, release, err := f.inspector()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return inspector.Delete(ids)
+}
+
+func (f *Follower) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.current.Close()
+}
+
+func (f *Follower) inspector() (Inspector, func(), error) {
+	current, release, err := f.store()
+	if err != nil {
+		return nil, nil, err
+	}
+	inspector, ok := current.(Inspector)
+	if !ok {
+		release()
+		return nil, nil, fmt.Errorf("store cannot be inspected")
+	}
+	return inspector, release, nil
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerations_Publish(t *testing.T) {
+	// GIVEN
+	generations := NewGenerations(filepath.Join(t.TempDir(), "generations", "code_chunks.json"))
+	initial, err := generations.Published()
+	require.NoError(t, err)
+
+	// WHEN
+	require.NoError(t, generations.Publish(3))
+
+	// THEN
+	published, err := generations.Published()
+	require.NoError(t, err)
+	assert.Equal(t, 0, initial, "it should start at generation 0")
+	assert.Equal(t, 3, published)
+}
+
+func TestGenerationName(t *testing.T) {
+	assert.Equal(t, "code_chunks", GenerationName("code_chunks", 0), "it should use the collection itself for generation 0")
+	assert.Equal(t, "code_chunks_g2", GenerationName("code_chunks", 2))
+}
+
+func TestCopyRecords(t *testing.T) {
+	// GIVEN
+	source, err := OpenLocal(filepath.Join(t.TempDir(), "source.gob"))
+	require.NoError(t, err)
+	require.NoError(t, source.Upsert(newTestRecords(t)))
+	target, err := OpenLocal(filepath.Join(t.TempDir(), "target.gob"))
+	require.NoError(t, err)
+
+	// WHEN
+	copied, err := CopyRecords(source, target)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, 3, copied)
+	records, err := target.Peek(0, nil)
+	require.NoError(t, err)
+	expected, err := source.Peek(0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, records)
+}
+
+func TestFollower(t *testing.T) {
+	// GIVEN
+	dir := t.TempDir()
+	generations := NewGenerations(filepath.Join(dir, "generations.json"))
+	open := func(generation int) (VectorStore, error) {
+		return OpenLocal(filepath.Join(dir, GenerationName("code_chunks", generation), "store.gob"))
+	}
+	next, err := open(1)
+	require.NoError(t, err)
+	require.NoError(t, next.Upsert(newTestRecords(t)))
+	require.NoError(t, next.Close())
+
+	follower, err := NewFollower(generations, open)
+	require.NoError(t, err)
+	defer func() {
+		_ = follower.Close()
+	}()
+	before, err := follower.Stats()
+	require.NoError(t, err)
+
+	// WHEN
+	require.NoError(t, generations.Publish(1))
+
+	// THEN
+	after, err := follower.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 0, before.Records, "it should read the published generation")
+	assert.Equal(t, 3, after.Records, "it should switch to the newly published generation")
+}
+
+func TestFollower_CollectionModel(t *testing.T) {
+	// GIVEN
+	dir := t.TempDir()
+	generations := NewGenerations(filepath.Join(dir, "generations.json"))
+	open := func(generation int) (VectorStore, error) {
+		return OpenLocal(filepath.Join(dir, GenerationName("code_chunks", generation), "store.gob"))
+	}
+	next, err := open(1)
+	require.NoError(t, err)
+	require.NoError(t, next.Upsert(newTestRecords(t)))
+	require.NoError(t, RecordModel(next, "all-MiniLM-L6-v2"))
+	require.NoError(t, next.Close())
+	require.NoError(t, generations.Publish(1))
+
+	follower, err := NewFollower(generations, open)
+	require.NoError(t, err)
+	defer func() {
+		_ = follower.Close()
+	}()
+
+	// WHEN
+	err = CheckModel(follower, "nomic-embed-text", 0)
+
+	// THEN
+	assert.ErrorIs(t, err, ErrModelMismatch, "it should check the model recorded with the published generation")
+}
+
+func TestFollower_CollectionSpace(t *testing.T) {
+	// GIVEN
+	dir := t.TempDir()
+	open := func(generation int) (VectorStore, error) {
+		return OpenLocal(
+			filepath.Join(dir, GenerationName("code_chunks", generation), "store.gob"),
+			WithLocalSpace(Space{Metric: CosineMetric}),
+		)
+	}
+	published, err := open(0)
+	require.NoError(t, err)
+	require.NoError(t, published.Upsert(newTestRecords(t)))
+	require.NoError(t, published.Close())
+
+	follower, err := NewFollower(NewGenerations(filepath.Join(dir, "generations.json")), open)
+	require.NoError(t, err)
+	defer func() {
+		_ = follower.Close()
+	}()
+
+	// WHEN
+	err = CheckSpace(follower, Space{Metric: L2Metric})
+
+	// THEN
+	assert.ErrorIs(t, err, ErrSpaceMismatch, "it should check the space of the published generation")
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+)
+
+// Inspector gives a low-level access to the raw records of a store, to debug search results
+type Inspector interface {
+	// Collections lists the collections available in the backend
+	Collections() ([]string, error)
+	// Peek returns at most limit records matching the chroma-like where filter, all of them if limit is 0
+	Peek(limit int, where map[string]any) ([]Record, error)
+	// Delete removes the records with the given ids
+	Delete(ids []string) error
+}
+
+// Scanner is implemented by the inspectors reading their records page by page, so they are never all held in memory
+type Scanner interface {
+	// Scan passes all the records to consume, by pages of at most pageSize records
+	Scan(pageSize int, consume func(records []Record) error) error
+}
+
+// ScanRecords passes all the records of the source to consume, by pages of at most pageSize records, read page by
+// page if the source is a Scanner, all at once otherwise
+func ScanRecords(source Inspector, pageSize int, consume func(records []Record) error) error {
+	if scanner, ok := source.(Scanner); ok {
+		return scanner.Scan(pageSize, consume)
+	}
+	records, err := source.Peek(0, nil)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(records); start += pageSize {
+		if err := consume(records[start:min(start+pageSize, len(records))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Norm returns the euclidean norm of the embedding of the record
+func (r Record) Norm() float64 {
+	var sum float64
+	for _, v := range r.Embedding {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum)
+}
+
+func (s *Local) Collections() ([]string, error) {
+	// the local store holds a single collection, named after its file
+	return []string{filepath.Base(s.path)}, nil
+}
+
+func (s *Local) Peek(limit int, where map[string]any) ([]Record, error) {
+	where, err := normalizeFilter(where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ids := make([]string, 0, len(s.records))
+	for id, record := range s.records {
+		if matches(record.Metadata, where) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	records := make([]Record, len(ids))
+	for i, id := range ids {
+		records[i] = *s.records[id]
+	}
+	return records, nil
+}
+
+// Scan passes the records sorted by id, the ones deleted since the scan started are skipped
+func (s *Local) Scan(pageSize int, consume func(records []Record) error) error {
+	s.lock.RLock()
+	ids := make([]string, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	s.lock.RUnlock()
+	sort.Strings(ids)
+
+	for start := 0; start < len(ids); start += pageSize {
+		page := make([]Record, 0, pageSize)
+		s.lock.RLock()
+		for _, id := range ids[start:min(start+pageSize, len(ids))] {
+			if record, found := s.records[id]; found {
+				page = append(page, *record)
+			}
+		}
+		s.lock.RUnlock()
+		if err := consume(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Local) Delete(ids []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range ids {
+		if _, found := s.records[id]; found {
+			delete(s.records, id)
+			delete(s.codes, id)
+			s.dirty = true
+		}
+	}
+	return nil
+}
+
+func (q *Qdrant) Collections() ([]string, error) {
+	var resp qdrantResponse[struct {
+		Collections []struct {
+			Name string `json:"name"`
+		} `json:"collections"`
+	}]
+	if err := q.call(http.MethodGet, "/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(resp.Result.Collections))
+	for i, collection := range resp.Result.Collections {
+		names[i] = collection.Name
+	}
+	return names, nil
+}
+
+func (q *Qdrant) Peek(limit int, where map[string]any) ([]Record, error) {
+	where, err := normalizeFilter(where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	request := map[string]any{
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	if len(where) > 0 {
+		filter, err := toQdrantFilter(where)
+		if err != nil {
+			return nil, err
+		}
+		request["filter"] = filter
+	}
+
+	var records []Record
+	err = q.scroll(request, func() int {
+		if limit > 0 {
+			return min(qdrantPageSize, limit-len(records))
+		}
+		return qdrantPageSize
+	}, func(page []Record) error {
+		records = append(records, page...)
+		return nil
+	})
+	return records, err
+}
+
+func (q *Qdrant) Scan(pageSize int, consume func(records []Record) error) error {
+	request := map[string]any{
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	return q.scroll(request, func() int { return pageSize }, consume)
+}
+
+// scroll passes the points matching the request to consume, page by page, until pageSize returns 0 or the collection
+// is scrolled through
+func (q *Qdrant) scroll(request map[string]any, pageSize func() int, consume func(records []Record) error) error {
+	for {
+		size := pageSize()
+		if size <= 0 {
+			return nil
+		}
+		request["limit"] = size
+
+		var resp qdrantResponse[struct {
+			Points         []qdrantScoredPoint `json:"points"`
+			NextPageOffset any                 `json:"next_page_offset"`
+		}]
+		if err := q.call(http.MethodPost, q.collectionPath("points/scroll"), request, &resp); err != nil {
+			return err
+		}
+		records := make([]Record, len(resp.Result.Points))
+		for i, point := range resp.Result.Points {
+			records[i] = point.toRecord()
+		}
+		if err := consume(records); err != nil {
+			return err
+		}
+		if resp.Result.NextPageOffset == nil {
+			return nil
+		}
+		request["offset"] = resp.Result.NextPageOffset
+	}
+}
+
+func (q *Qdrant) Delete(ids []string) error {
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = qdrantPointId(id)
+	}
+	return q.call(http.MethodPost, q.collectionPath("points/delete?wait=true"), map[string]any{"points": points}, nil)
+}
@@ -0,0 +1,414 @@
+package store
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+const localFormatVersion = 1
+
+type (
+	Record struct {
+		Id        string
+		Document  string
+		Metadata  map[string]any
+		Embedding []float32
+	}
+
+	// Local is a vector store living entirely in the mm process, searched exhaustively and persisted in a
+	// single file, it requires no external runtime.
+	Local struct {
+		path string
+
+		lock    sync.RWMutex
+		records map[string]*Record
+		dirty   bool
+
+		// model of the embeddings, see ModelRecorder
+		model string
+		// space compares the embeddings, the configured one until the store holds records
+		space      Space
+		configured Space
+		// quantization of the embeddings written in the file, the embeddings are kept at full precision when
+		// keepOriginals is set, to rerank the candidates found with the quantized ones, see Quantization
+		quantization  Quantization
+		keepOriginals bool
+		codes         map[string]quantizedEmbedding
+	}
+
+	// LocalOption tunes a local store
+	LocalOption func(*Local)
+
+	localFile struct {
+		Version int
+		Records []*Record
+
+		// Model of the embeddings, empty for the stores written before it was recorded
+		Model string
+		// Space of the embeddings, without metric for the stores written before it was recorded, they used L2Metric
+		Space Space
+		// Quantization of the Codes of the records, by id, the records are written without their embedding unless
+		// the originals are kept, they are decoded to Dimensions
+		Quantization Quantization
+		Dimensions   int
+		Codes        map[string]quantizedEmbedding
+	}
+)
+
+func init() {
+	// the array values of the metadata, e.g. the issues of a chunk
+	gob.Register([]any{})
+}
+
+// WithLocalSpace compares the embeddings of a new store in the space, a store holding records keeps its own
+func WithLocalSpace(space Space) LocalOption {
+	return func(s *Local) {
+		s.space = space
+	}
+}
+
+// WithLocalQuantization writes the embeddings quantized in the file, the originals are written as well when
+// keepOriginals is set, they rerank the candidates found with the quantized embeddings
+func WithLocalQuantization(quantization Quantization, keepOriginals bool) LocalOption {
+	return func(s *Local) {
+		s.quantization = quantization
+		s.keepOriginals = keepOriginals
+	}
+}
+
+// OpenLocal loads the store persisted at path, or creates an empty one if the file does not exist yet
+func OpenLocal(path string, opts ...LocalOption) (*Local, error) {
+	store := &Local{
+		path:    path,
+		records: make(map[string]*Record),
+		space:   Space{Metric: L2Metric},
+		codes:   make(map[string]quantizedEmbedding),
+	}
+	for _, opt := range opts {
+		opt(store)
+	}
+	store.configured = store.space
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local store %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var content localFile
+	if err := gob.NewDecoder(file).Decode(&content); err != nil {
+		return nil, fmt.Errorf("failed to decode local store %s: %w", path, err)
+	}
+	if content.Version != localFormatVersion {
+		return nil, fmt.Errorf("unsupported local store version %d, expected %d", content.Version, localFormatVersion)
+	}
+	for _, record := range content.Records {
+		code, quantized := content.Codes[record.Id]
+		if len(record.Embedding) == 0 && quantized {
+			// the original was not kept, the quantized embedding is all that is left
+			record.Embedding = content.Quantization.decode(code, content.Dimensions, nil)
+		}
+		store.records[record.Id] = record
+		if store.quantization == NoQuantization {
+			continue
+		}
+		if quantized && content.Quantization == store.quantization {
+			store.codes[record.Id] = code
+		} else {
+			store.codes[record.Id] = store.quantization.quantize(record.Embedding)
+		}
+	}
+	store.model = content.Model
+	if len(content.Records) > 0 {
+		store.space = content.Space
+		if store.space.Metric == "" {
+			store.space.Metric = L2Metric
+		}
+	}
+
+	return store, nil
+}
+
+// NewRecords pairs the chunks with their embeddings
+func NewRecords(chunks []code.Chunk, embeddings [][]float32) ([]Record, error) {
+	if len(chunks) != len(embeddings) {
+		return nil, fmt.Errorf("got %d embeddings for %d chunks", len(embeddings), len(chunks))
+	}
+
+	records := make([]Record, len(chunks))
+	for i, chunk := range chunks {
+		metadata, err := toMap(chunk.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert metadata of chunk %s: %w", chunk.Id, err)
+		}
+		records[i] = Record{
+			Id:        chunk.Id,
+			Document:  chunk.Content,
+			Metadata:  metadata,
+			Embedding: embeddings[i],
+		}
+	}
+	return records, nil
+}
+
+// Chunk converts the record back to the chunk it was built from, to embed it again
+func (r Record) Chunk() (code.Chunk, error) {
+	chunk := code.Chunk{Id: r.Id, Content: r.Document}
+	if err := fromMap(r.Metadata, &chunk.Metadata); err != nil {
+		return code.Chunk{}, fmt.Errorf("failed to convert metadata of record %s: %w", r.Id, err)
+	}
+	return chunk, nil
+}
+
+// Upsert inserts the records, replacing the existing ones with the same ids
+func (s *Local) Upsert(records []Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the whole batch is checked first, a failed upsert leaves the store as it was
+	dimensions := s.dimensions()
+	for _, record := range records {
+		if dimensions == 0 {
+			dimensions = len(record.Embedding)
+		}
+		if len(record.Embedding) != dimensions {
+			return fmt.Errorf(
+				"record %s has %d dimensions, but the store contains embeddings with %d dimensions",
+				record.Id,
+				len(record.Embedding),
+				dimensions,
+			)
+		}
+	}
+	if s.space.Normalized {
+		records = normalizeRecords(records)
+	}
+	for _, record := range records {
+		if s.quantization != NoQuantization {
+			code := s.quantization.quantize(record.Embedding)
+			s.codes[record.Id] = code
+			if !s.keepOriginals {
+				// searched as it is read back from the file
+				record.Embedding = s.quantization.decode(code, len(record.Embedding), nil)
+			}
+		}
+		s.records[record.Id] = &record
+	}
+	s.dirty = true
+
+	return nil
+}
+
+// DeleteByFile removes all the records of the file
+func (s *Local) DeleteByFile(filePath string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, record := range s.records {
+		if record.Metadata["file_path"] == filePath {
+			delete(s.records, id)
+			delete(s.codes, id)
+			s.dirty = true
+		}
+	}
+	return nil
+}
+
+func (s *Local) DeleteAll() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the model is kept, the store is indexed again with it, see ForgetModel
+	if len(s.records) > 0 {
+		s.records = make(map[string]*Record)
+		s.codes = make(map[string]quantizedEmbedding)
+		s.dirty = true
+	}
+	// the store is created again, in the configured space
+	s.space = s.configured
+	return nil
+}
+
+// Query returns the nResults records closest (with the metric of the store) to the embedding, matching the where
+// filter
+func (s *Local) Query(vector []float32, nResults int, where map[string]any) ([]embedding.QueryResult, error) {
+	where, err := normalizeFilter(where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.space.Normalized {
+		vector = normalize(vector)
+	}
+
+	type candidate struct {
+		record   *Record
+		distance float64
+	}
+	var candidates []candidate
+	var decoded []float32
+	for id, record := range s.records {
+		if len(record.Embedding) != len(vector) {
+			return nil, fmt.Errorf("query has %d dimensions, store has %d", len(vector), len(record.Embedding))
+		}
+		if !matches(record.Metadata, where) {
+			continue
+		}
+		if s.rescoring() {
+			decoded = s.quantization.decode(s.codes[id], len(vector), decoded)
+			candidates = append(candidates, candidate{record, s.space.Metric.Distance(vector, decoded)})
+			continue
+		}
+		candidates = append(candidates, candidate{record, s.space.Metric.Distance(vector, record.Embedding)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	if s.rescoring() {
+		// the candidates found with the quantized embeddings are reranked with the originals
+		if len(candidates) > nResults*rescoreFactor {
+			candidates = candidates[:nResults*rescoreFactor]
+		}
+		for i := range candidates {
+			candidates[i].distance = s.space.Metric.Distance(vector, candidates[i].record.Embedding)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].distance < candidates[j].distance
+		})
+	}
+	if len(candidates) > nResults {
+		candidates = candidates[:nResults]
+	}
+
+	results := make([]embedding.QueryResult, 0, len(candidates))
+	for _, c := range candidates {
+		var metadata code.ChunkMetadata
+		if err := fromMap(c.record.Metadata, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to convert metadata of record %s: %w", c.record.Id, err)
+		}
+		results = append(results, embedding.QueryResult{
+			Id:       c.record.Id,
+			Document: c.record.Document,
+			Metadata: metadata,
+			Distance: c.distance,
+		})
+	}
+	return results, nil
+}
+
+// Close persists the store if it has been modified
+func (s *Local) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create local store directory: %w", err)
+	}
+
+	// write in a temporary file and rename it, so a crash never leaves a partially written store
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local store file: %w", err)
+	}
+	content := localFile{Version: localFormatVersion, Model: s.model, Space: s.space}
+	if s.quantization != NoQuantization {
+		content.Quantization = s.quantization
+		content.Dimensions = s.dimensions()
+		content.Codes = s.codes
+	}
+	for _, record := range s.records {
+		if s.quantization != NoQuantization && !s.keepOriginals {
+			stripped := *record
+			stripped.Embedding = nil
+			record = &stripped
+		}
+		content.Records = append(content.Records, record)
+	}
+	if err := gob.NewEncoder(file).Encode(content); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to encode local store: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write local store: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace local store: %w", err)
+	}
+	s.dirty = false
+
+	return nil
+}
+
+// Compact persists the store right away, the file is always written from scratch
+func (s *Local) Compact() error {
+	return s.Close()
+}
+
+func (s *Local) Stats() (Stats, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return Stats{Records: len(s.records), Dimensions: s.dimensions()}, nil
+}
+
+// rescoring tells whether the candidates are found with the quantized embeddings, then reranked with the originals
+func (s *Local) rescoring() bool {
+	return s.quantization != NoQuantization && s.keepOriginals
+}
+
+func (s *Local) dimensions() int {
+	for _, record := range s.records {
+		return len(record.Embedding)
+	}
+	return 0
+}
+
+func squaredL2(a []float32, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return sum
+}
+
+func toMap(metadata code.ChunkMetadata) (map[string]any, error) {
+	bytes, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	err = json.Unmarshal(bytes, &m)
+	return m, err
+}
+
+func fromMap(m map[string]any, metadata *code.ChunkMetadata) error {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, metadata)
+}
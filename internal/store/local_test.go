@@ -0,0 +1,205 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecords(t *testing.T) []Record {
+	chunks := []code.Chunk{
+		{
+			Id:       "auth.go_Validate_3",
+			Content:  "func Validate(token string) error",
+			Metadata: code.ChunkMetadata{FilePath: "auth.go", Language: "go", ModifiedAt: 100, Issues: []string{"AUTH-42"}},
+		},
+		{
+			Id:       "tax.py_calculate_tax_1",
+			Content:  "def calculate_tax(income):",
+			Metadata: code.ChunkMetadata{FilePath: "tax.py", Language: "python", ModifiedAt: 200},
+		},
+		{
+			Id:       "tax.py_TAX_RATE_5",
+			Content:  "TAX_RATE = 0.2",
+			Metadata: code.ChunkMetadata{FilePath: "tax.py", Language: "python", ModifiedAt: 300},
+		},
+	}
+	records, err := NewRecords(chunks, [][]float32{{1, 0}, {0, 1}, {0.1, 0.9}})
+	require.NoError(t, err)
+	return records
+}
+
+func TestLocal_Query(t *testing.T) {
+	tests := []struct {
+		name    string
+		vector  []float32
+		where   map[string]any
+		wantIds []string
+	}{
+		{
+			name:    "it should return the closest records first",
+			vector:  []float32{0, 1},
+			wantIds: []string{"tax.py_calculate_tax_1", "tax.py_TAX_RATE_5"},
+		},
+		{
+			name:    "it should only return the records matching the filter",
+			vector:  []float32{0, 1},
+			where:   map[string]any{"language": map[string]any{"$eq": "go"}},
+			wantIds: []string{"auth.go_Validate_3"},
+		},
+		{
+			name:   "it should support logical and comparison operators",
+			vector: []float32{0, 1},
+			where: map[string]any{"$or": []map[string]any{
+				{"modified_at": map[string]any{"$gte": int64(300)}},
+				{"file_path": map[string]any{"$in": []string{"auth.go"}}},
+			}},
+			wantIds: []string{"tax.py_TAX_RATE_5", "auth.go_Validate_3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+			require.NoError(t, err)
+			require.NoError(t, store.Upsert(newTestRecords(t)))
+
+			// WHEN
+			results, err := store.Query(tt.vector, 2, tt.where)
+
+			// THEN
+			require.NoError(t, err)
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.Id)
+			}
+			assert.Equal(t, tt.wantIds, ids)
+		})
+	}
+}
+
+func TestLocal_Close(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "local", "store.gob")
+	store, err := OpenLocal(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(newTestRecords(t)))
+
+	// WHEN
+	require.NoError(t, store.Close())
+	reopened, err := OpenLocal(path)
+
+	// THEN
+	require.NoError(t, err)
+	results, err := reopened.Query([]float32{1, 0}, 1, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "auth.go_Validate_3", results[0].Id)
+	assert.Equal(t, code.ChunkMetadata{FilePath: "auth.go", Language: "go", ModifiedAt: 100, Issues: []string{"AUTH-42"}}, results[0].Metadata)
+}
+
+func TestLocal_Upsert(t *testing.T) {
+	// GIVEN
+	store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(newTestRecords(t)))
+
+	// WHEN
+	err = store.Upsert([]Record{{Id: "other", Embedding: []float32{1, 2, 3}}})
+
+	// THEN
+	assert.Error(t, err, "it should reject embeddings with different dimensions")
+}
+
+func TestLocal_UpsertMixedBatch(t *testing.T) {
+	// GIVEN
+	store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	records := newTestRecords(t)
+	records = append(records, Record{Id: "other", Embedding: []float32{1, 2, 3}})
+
+	// WHEN
+	err = store.Upsert(records)
+
+	// THEN
+	assert.Error(t, err, "it should reject a batch mixing dimensions")
+	stored, err := store.Peek(0, nil)
+	require.NoError(t, err)
+	assert.Empty(t, stored, "it should not store any record of the rejected batch")
+}
+
+func TestLocal_Peek(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		where   map[string]any
+		wantIds []string
+	}{
+		{
+			name:    "it should return all the records sorted by id",
+			wantIds: []string{"auth.go_Validate_3", "tax.py_TAX_RATE_5", "tax.py_calculate_tax_1"},
+		},
+		{
+			name:    "it should return only the records matching the filter",
+			where:   map[string]any{"file_path": "tax.py"},
+			wantIds: []string{"tax.py_TAX_RATE_5", "tax.py_calculate_tax_1"},
+		},
+		{
+			name:    "it should limit the number of records",
+			limit:   1,
+			wantIds: []string{"auth.go_Validate_3"},
+		},
+		{
+			name:    "it should match an element of an array value with $contains",
+			where:   map[string]any{"issues": map[string]any{"$contains": "AUTH-42"}},
+			wantIds: []string{"auth.go_Validate_3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+			require.NoError(t, err)
+			require.NoError(t, store.Upsert(newTestRecords(t)))
+
+			// WHEN
+			records, err := store.Peek(tt.limit, tt.where)
+
+			// THEN
+			require.NoError(t, err)
+			var ids []string
+			for _, record := range records {
+				ids = append(ids, record.Id)
+			}
+			assert.Equal(t, tt.wantIds, ids)
+		})
+	}
+}
+
+func TestLocal_Scan(t *testing.T) {
+	// GIVEN
+	store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(newTestRecords(t)))
+
+	// WHEN
+	var pages [][]string
+	err = store.Scan(2, func(records []Record) error {
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.Id)
+		}
+		pages = append(pages, ids)
+		return nil
+	})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"auth.go_Validate_3", "tax.py_TAX_RATE_5"},
+		{"tax.py_calculate_tax_1"},
+	}, pages, "it should pass all the records sorted by id, by pages")
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+// ErrModelMismatch is returned when the store holds the embeddings of another model than the one selected
+var ErrModelMismatch = errors.New("embedding model mismatch")
+
+// ModelRecorder records the embedding model with the collection, so it cannot be searched nor updated with another
+// model, even without its manifest, e.g. when a chroma server is shared
+type ModelRecorder interface {
+	// CollectionModel returns the model recorded with the collection, empty if none was
+	CollectionModel() (string, error)
+	// RecordCollectionModel records the model of the embeddings of the collection
+	RecordCollectionModel(model string) error
+}
+
+var (
+	_ ModelRecorder = (*Local)(nil)
+	_ ModelRecorder = (*Chroma)(nil)
+	_ ModelRecorder = (*Qdrant)(nil)
+	_ ModelRecorder = (*Follower)(nil)
+	_ ModelRecorder = (*ReadOnly)(nil)
+)
+
+// CheckModel refuses a store holding the embeddings of another model than the selected one, or embeddings with other
+// dimensions than the ones of the model, if known (not zero), the similarity scores would be meaningless
+func CheckModel(vectorStore VectorStore, model string, dimensions int) error {
+	if recorder, ok := vectorStore.(ModelRecorder); ok {
+		recorded, err := recorder.CollectionModel()
+		if err != nil {
+			return err
+		}
+		if recorded != "" && recorded != model {
+			return fmt.Errorf(
+				"%w: the collection was built with %s, not %s: switch back to %s, or reindex after mm purge --all",
+				ErrModelMismatch,
+				recorded,
+				model,
+				recorded,
+			)
+		}
+	}
+	if dimensions == 0 {
+		return nil
+	}
+	stats, err := vectorStore.Stats()
+	if err != nil {
+		return err
+	}
+	if stats.Dimensions > 0 && stats.Dimensions != dimensions {
+		return fmt.Errorf(
+			"%w: the collection holds embeddings with %d dimensions, %s computes %d: switch back to the model the "+
+				"collection was built with, or reindex after mm purge --all",
+			ErrModelMismatch,
+			stats.Dimensions,
+			model,
+			dimensions,
+		)
+	}
+	return nil
+}
+
+// RecordModel records the model with the collection of the store, if it can, and if it changed
+func RecordModel(vectorStore VectorStore, model string) error {
+	recorder, ok := vectorStore.(ModelRecorder)
+	if !ok {
+		return nil
+	}
+	recorded, err := recorder.CollectionModel()
+	if err != nil {
+		return err
+	}
+	if recorded == model {
+		return nil
+	}
+	return recorder.RecordCollectionModel(model)
+}
+
+// ForgetModel forgets the model recorded with the collection of the store, once purged, so it can be indexed again with
+// another model, a reset keeps it
+func ForgetModel(vectorStore VectorStore) error {
+	return RecordModel(vectorStore, "")
+}
+
+func (s *Local) CollectionModel() (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.model, nil
+}
+
+func (s *Local) RecordCollectionModel(model string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.model != model {
+		s.model = model
+		s.dirty = true
+	}
+	return nil
+}
+
+func (c *Chroma) CollectionModel() (string, error) {
+	return c.indexer.CollectionModel()
+}
+
+// RecordCollectionModel records the model in the metadata of the collection, the indexer services started by the
+// releases not recording it are left as is
+func (c *Chroma) RecordCollectionModel(model string) error {
+	err := c.indexer.RecordCollectionModel(model)
+	var indexerErr *embedding.IndexerError
+	if errors.As(err, &indexerErr) && indexerErr.Code == embedding.InvalidRequestError {
+		return nil
+	}
+	return err
+}
+
+func (r *ReadOnly) CollectionModel() (string, error) {
+	recorder, ok := r.store.(ModelRecorder)
+	if !ok {
+		return "", nil
+	}
+	return recorder.CollectionModel()
+}
+
+func (r *ReadOnly) RecordCollectionModel(string) error {
+	return ErrReadOnly
+}
+
+// CollectionModel reads the model in the metadata of the collection, the one to record when it is created if it does
+// not exist yet
+func (q *Qdrant) CollectionModel() (string, error) {
+	q.collectionLock.Lock()
+	defer q.collectionLock.Unlock()
+
+	return q.collectionModel()
+}
+
+// RecordCollectionModel records the model in the metadata of the collection, or when it is created if it does not
+// exist yet
+func (q *Qdrant) RecordCollectionModel(model string) error {
+	q.collectionLock.Lock()
+	defer q.collectionLock.Unlock()
+
+	q.model = model
+	request := map[string]any{"metadata": map[string]any{qdrantModelKey: model}}
+	var status int
+	err := q.call(http.MethodPatch, q.collectionPath(""), request, nil, &status)
+	if status == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the model of qdrant collection %s: %w", q.collection, err)
+	}
+	return nil
+}
+
+// collectionModel reads the model recorded with the collection, the collection lock is held
+func (q *Qdrant) collectionModel() (string, error) {
+	var resp qdrantResponse[struct {
+		Config struct {
+			Metadata map[string]any `json:"metadata"`
+		} `json:"config"`
+	}]
+	var status int
+	err := q.call(http.MethodGet, q.collectionPath(""), nil, &resp, &status)
+	if status == http.StatusNotFound {
+		return q.model, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	model, _ := resp.Result.Config.Metadata[qdrantModelKey].(string)
+	return model, nil
+}
+
+func (f *Follower) CollectionModel() (string, error) {
+	current, release, err := f.store()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	recorder, ok := current.(ModelRecorder)
+	if !ok {
+		return "", nil
+	}
+	return recorder.CollectionModel()
+}
+
+func (f *Follower) RecordCollectionModel(model string) error {
+	current, release, err := f.store()
+	if err != nil {
+		return err
+	}
+	defer release()
+	recorder, ok := current.(ModelRecorder)
+	if !ok {
+		return nil
+	}
+	return recorder.RecordCollectionModel(model)
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckModel(t *testing.T) {
+	tests := []struct {
+		name       string
+		recorded   string
+		model      string
+		dimensions int
+		wantErr    string
+	}{
+		{
+			name:       "it should accept the recorded model",
+			recorded:   "all-MiniLM-L6-v2",
+			model:      "all-MiniLM-L6-v2",
+			dimensions: 2,
+		},
+		{
+			name:     "it should accept a collection without recorded model",
+			recorded: "",
+			model:    "all-MiniLM-L6-v2",
+		},
+		{
+			name:     "it should refuse another model",
+			recorded: "all-MiniLM-L6-v2",
+			model:    "openai/text-embedding-3-small",
+			wantErr:  "the collection was built with all-MiniLM-L6-v2, not openai/text-embedding-3-small",
+		},
+		{
+			name:       "it should refuse embeddings with other dimensions",
+			recorded:   "",
+			model:      "all-mpnet-base-v2",
+			dimensions: 768,
+			wantErr:    "the collection holds embeddings with 2 dimensions, all-mpnet-base-v2 computes 768",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+			require.NoError(t, err)
+			require.NoError(t, local.Upsert(newTestRecords(t)))
+			require.NoError(t, local.RecordCollectionModel(tt.recorded))
+
+			// WHEN
+			err = CheckModel(local, tt.model, tt.dimensions)
+
+			// THEN
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrModelMismatch)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRecordModel(t *testing.T) {
+	t.Run("it should persist the model with the local store", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path)
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+
+		// WHEN
+		require.NoError(t, RecordModel(local, "all-MiniLM-L6-v2"))
+		require.NoError(t, local.Close())
+
+		// THEN
+		reopened, err := OpenLocal(path)
+		require.NoError(t, err)
+		model, err := reopened.CollectionModel()
+		require.NoError(t, err)
+		assert.Equal(t, "all-MiniLM-L6-v2", model)
+	})
+
+	t.Run("it should keep the model once the store is reset", func(t *testing.T) {
+		// GIVEN
+		local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+		require.NoError(t, RecordModel(local, "all-MiniLM-L6-v2"))
+
+		// WHEN
+		require.NoError(t, local.DeleteAll())
+
+		// THEN
+		model, err := local.CollectionModel()
+		require.NoError(t, err)
+		assert.Equal(t, "all-MiniLM-L6-v2", model)
+		assert.ErrorIs(t, CheckModel(local, "nomic-embed-text", 0), ErrModelMismatch)
+	})
+
+	t.Run("it should keep the model once the store is optimized", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path)
+		require.NoError(t, err)
+		records := newTestRecords(t)
+		require.NoError(t, local.Upsert(records))
+		require.NoError(t, RecordModel(local, "all-MiniLM-L6-v2"))
+
+		// WHEN
+		require.NoError(t, Rewrite(local, records))
+		require.NoError(t, local.Close())
+
+		// THEN
+		reopened, err := OpenLocal(path)
+		require.NoError(t, err)
+		model, err := reopened.CollectionModel()
+		require.NoError(t, err)
+		assert.Equal(t, "all-MiniLM-L6-v2", model)
+	})
+
+	t.Run("it should forget the model once the store is purged", func(t *testing.T) {
+		// GIVEN
+		local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+		require.NoError(t, err)
+		require.NoError(t, RecordModel(local, "all-MiniLM-L6-v2"))
+		require.NoError(t, local.DeleteAll())
+
+		// WHEN
+		require.NoError(t, ForgetModel(local))
+
+		// THEN
+		model, err := local.CollectionModel()
+		require.NoError(t, err)
+		assert.Empty(t, model)
+	})
+
+	t.Run("it should not record the model of a read-only store", func(t *testing.T) {
+		// GIVEN
+		local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+		require.NoError(t, err)
+
+		// WHEN
+		err = RecordModel(NewReadOnly(local), "all-MiniLM-L6-v2")
+
+		// THEN
+		assert.ErrorIs(t, err, ErrReadOnly)
+	})
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+const rewriteBatchSize = 256
+
+// ErrStoreInUse is returned by the stores which cannot be compacted while their server runs
+var ErrStoreInUse = errors.New("the store is in use by its server")
+
+// Compactor is implemented by the stores reclaiming the space left by deleted records on demand
+type Compactor interface {
+	Compact() error
+}
+
+// Rewrite replaces the content of the store by the records, written from scratch, so the space left by deleted
+// records is dropped and the index of the vectors is rebuilt, ErrStoreInUse is returned once the records are written
+// back if the store cannot be compacted while its server runs
+func Rewrite(s VectorStore, records []Record) error {
+	if err := s.DeleteAll(); err != nil {
+		return fmt.Errorf("failed to clear the store: %w", err)
+	}
+	for start := 0; start < len(records); start += rewriteBatchSize {
+		end := min(start+rewriteBatchSize, len(records))
+		if err := s.Upsert(records[start:end]); err != nil {
+			return fmt.Errorf("failed to write the records back: %w", err)
+		}
+	}
+	if compactor, ok := s.(Compactor); ok {
+		if err := compactor.Compact(); err != nil {
+			return fmt.Errorf("failed to compact the store: %w", err)
+		}
+	}
+	return nil
+}
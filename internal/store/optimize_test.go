@@ -0,0 +1,55 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewrite(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "store.gob")
+	store, err := OpenLocal(path)
+	require.NoError(t, err)
+	records := newTestRecords(t)
+	require.NoError(t, store.Upsert(records))
+	require.NoError(t, store.Upsert([]Record{{Id: "deleted", Embedding: []float32{1, 1}}}))
+
+	// WHEN
+	err = Rewrite(store, records)
+
+	// THEN
+	require.NoError(t, err)
+	reopened, err := OpenLocal(path)
+	require.NoError(t, err, "it should persist the rewritten store")
+	peeked, err := reopened.Peek(0, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, records, peeked)
+}
+
+// inUseStore is a store refusing to be compacted while its server runs
+type inUseStore struct {
+	*Local
+}
+
+func (s inUseStore) Compact() error {
+	return ErrStoreInUse
+}
+
+func TestRewrite_InUse(t *testing.T) {
+	// GIVEN
+	local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	records := newTestRecords(t)
+
+	// WHEN
+	err = Rewrite(inUseStore{local}, records)
+
+	// THEN
+	require.ErrorIs(t, err, ErrStoreInUse)
+	peeked, err := local.Peek(0, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, records, peeked, "it should write the records back before compacting")
+}
@@ -0,0 +1,540 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+const (
+	qdrantTimeout = 30 * time.Second
+	// qdrantPageSize is the number of points fetched per request when scrolling a collection
+	qdrantPageSize = 256
+
+	// payload keys holding the chunk id and content, next to the chunk metadata
+	qdrantChunkIdKey  = "chunk_id"
+	qdrantDocumentKey = "document"
+
+	// qdrantModelKey is the key of the metadata of the collection recording the model of its embeddings
+	qdrantModelKey = "mm:model"
+)
+
+type (
+	// Qdrant is a store backed by a Qdrant server, through its REST API
+	Qdrant struct {
+		ctx        context.Context
+		baseURL    string
+		apiKey     string
+		collection string
+		client     *http.Client
+
+		collectionLock  sync.Mutex
+		collectionReady bool
+		// model recorded with the collection once created, kept when the collection is deleted by a reset
+		model string
+
+		// space of the new collection, qdrant records its metric, not whether the embeddings are normalized
+		space Space
+		// quantization of the new collection, qdrant always keeps the originals, on disk, rescore reranks the
+		// candidates with them
+		quantization Quantization
+		rescore      bool
+	}
+
+	// QdrantOption tunes a qdrant store
+	QdrantOption func(*Qdrant)
+
+	qdrantPoint struct {
+		Id      string         `json:"id"`
+		Vector  []float32      `json:"vector"`
+		Payload map[string]any `json:"payload"`
+	}
+
+	qdrantScoredPoint struct {
+		Id      any            `json:"id"`
+		Score   float64        `json:"score"`
+		Payload map[string]any `json:"payload"`
+		Vector  []float32      `json:"vector"`
+	}
+
+	qdrantResponse[T any] struct {
+		Result T       `json:"result"`
+		Status any     `json:"status"`
+		Time   float64 `json:"time"`
+	}
+)
+
+// qdrantDistances are the distances of qdrant, by metric
+var qdrantDistances = map[Metric]string{
+	L2Metric:     "Euclid",
+	CosineMetric: "Cosine",
+	DotMetric:    "Dot",
+}
+
+// WithQdrantSpace creates the collection with the metric of the space, and normalizes the embeddings when the space is
+// normalized
+func WithQdrantSpace(space Space) QdrantOption {
+	return func(q *Qdrant) {
+		q.space = space
+	}
+}
+
+// WithQdrantQuantization creates the collection with the quantization, the candidates found with the quantized
+// embeddings are reranked with the originals when rescore is set
+func WithQdrantQuantization(quantization Quantization, rescore bool) QdrantOption {
+	return func(q *Qdrant) {
+		q.quantization = quantization
+		q.rescore = rescore
+	}
+}
+
+// NewQdrant creates a store using the collection of the qdrant server, the collection is created on the first upsert
+// if it does not exist.
+func NewQdrant(ctx context.Context, baseURL string, apiKey string, collection string, opts ...QdrantOption) *Qdrant {
+	q := &Qdrant{
+		ctx:        ctx,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		collection: collection,
+		client:     &http.Client{Timeout: qdrantTimeout},
+		space:      Space{Metric: L2Metric},
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+func (q *Qdrant) Upsert(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := q.ensureCollection(len(records[0].Embedding)); err != nil {
+		return err
+	}
+	if q.space.Normalized {
+		records = normalizeRecords(records)
+	}
+
+	points := make([]qdrantPoint, len(records))
+	for i, record := range records {
+		payload := make(map[string]any, len(record.Metadata)+2)
+		for key, value := range record.Metadata {
+			payload[key] = value
+		}
+		payload[qdrantChunkIdKey] = record.Id
+		payload[qdrantDocumentKey] = record.Document
+		points[i] = qdrantPoint{
+			Id:      qdrantPointId(record.Id),
+			Vector:  record.Embedding,
+			Payload: payload,
+		}
+	}
+
+	return q.call(http.MethodPut, q.collectionPath("points?wait=true"), map[string]any{"points": points}, nil)
+}
+
+func (q *Qdrant) Query(vector []float32, nResults int, where map[string]any) ([]embedding.QueryResult, error) {
+	where, err := normalizeFilter(where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	if q.space.Normalized {
+		vector = normalize(vector)
+	}
+	request := map[string]any{
+		"vector":       vector,
+		"limit":        nResults,
+		"with_payload": true,
+	}
+	if q.quantization != NoQuantization {
+		request["params"] = map[string]any{
+			"quantization": map[string]any{"rescore": q.rescore, "oversampling": rescoreFactor},
+		}
+	}
+	if len(where) > 0 {
+		filter, err := toQdrantFilter(where)
+		if err != nil {
+			return nil, err
+		}
+		request["filter"] = filter
+	}
+
+	var resp qdrantResponse[[]qdrantScoredPoint]
+	err = q.call(http.MethodPost, q.collectionPath("points/search"), request, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]embedding.QueryResult, 0, len(resp.Result))
+	for _, point := range resp.Result {
+		id, _ := point.Payload[qdrantChunkIdKey].(string)
+		document, _ := point.Payload[qdrantDocumentKey].(string)
+		var metadata code.ChunkMetadata
+		if err := fromMap(point.Payload, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to convert payload of point %v: %w", point.Id, err)
+		}
+		results = append(results, embedding.QueryResult{
+			Id:       id,
+			Document: document,
+			Metadata: metadata,
+			Distance: q.space.distance(point.Score),
+		})
+	}
+	return results, nil
+}
+
+func (q *Qdrant) DeleteByFile(filePath string) error {
+	request := map[string]any{
+		"filter": map[string]any{
+			"must": []any{qdrantMatch("file_path", filePath)},
+		},
+	}
+	var status int
+	err := q.call(http.MethodPost, q.collectionPath("points/delete?wait=true"), request, nil, &status)
+	if status == http.StatusNotFound {
+		// the collection is created on the first upsert, nothing to delete yet
+		return nil
+	}
+	return err
+}
+
+func (q *Qdrant) DeleteAll() error {
+	q.collectionLock.Lock()
+	defer q.collectionLock.Unlock()
+
+	// the collection is created again with the same model
+	model, err := q.collectionModel()
+	if err != nil {
+		return err
+	}
+	q.model = model
+	var status int
+	err = q.call(http.MethodDelete, q.collectionPath(""), nil, nil, &status)
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	// recreated by the next upsert
+	q.collectionReady = false
+	return nil
+}
+
+func (q *Qdrant) Stats() (Stats, error) {
+	var resp qdrantResponse[struct {
+		PointsCount int `json:"points_count"`
+		Config      struct {
+			Params struct {
+				Vectors struct {
+					Size int `json:"size"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}]
+	var status int
+	err := q.call(http.MethodGet, q.collectionPath(""), nil, &resp, &status)
+	if status == http.StatusNotFound {
+		// the collection is created on the first upsert
+		return Stats{}, nil
+	}
+	if err != nil {
+		return Stats{}, err
+	}
+
+	dimensions := 0
+	if resp.Result.PointsCount > 0 {
+		dimensions = resp.Result.Config.Params.Vectors.Size
+	}
+	return Stats{Records: resp.Result.PointsCount, Dimensions: dimensions}, nil
+}
+
+func (q *Qdrant) Close() error {
+	q.client.CloseIdleConnections()
+	return nil
+}
+
+// ensureCollection creates the collection if it does not exist yet
+func (q *Qdrant) ensureCollection(dimensions int) error {
+	q.collectionLock.Lock()
+	defer q.collectionLock.Unlock()
+
+	if q.collectionReady {
+		return nil
+	}
+
+	var resp qdrantResponse[struct {
+		Config struct {
+			Params struct {
+				Vectors struct {
+					Size     int    `json:"size"`
+					Distance string `json:"distance"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}]
+	var status int
+	err := q.call(http.MethodGet, q.collectionPath(""), nil, &resp, &status)
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	if status != http.StatusNotFound {
+		// the points of other dimensions are refused by qdrant, and the ones of another metric are mis-scored
+		vectors := resp.Result.Config.Params.Vectors
+		if vectors.Size != dimensions {
+			return fmt.Errorf(
+				"%w: qdrant collection %s holds vectors with %d dimensions, not %d: switch back to the model the "+
+					"collection was built with, or reindex after mm purge --all",
+				ErrModelMismatch,
+				q.collection,
+				vectors.Size,
+				dimensions,
+			)
+		}
+		if distance := qdrantDistances[q.space.Metric]; vectors.Distance != distance {
+			return fmt.Errorf(
+				"%w: qdrant collection %s compares its vectors with the %s distance, not %s: switch back to its "+
+					"metric, or reindex after mm purge --all",
+				ErrSpaceMismatch,
+				q.collection,
+				vectors.Distance,
+				distance,
+			)
+		}
+	} else {
+		request := map[string]any{
+			"vectors": map[string]any{
+				"size":     dimensions,
+				"distance": qdrantDistances[q.space.Metric],
+			},
+		}
+		if q.model != "" {
+			request["metadata"] = map[string]any{qdrantModelKey: q.model}
+		}
+		if quantization := q.quantizationConfig(); quantization != nil {
+			// only the quantized embeddings are kept in memory
+			request["vectors"].(map[string]any)["on_disk"] = true
+			request["quantization_config"] = quantization
+		}
+		if err := q.call(http.MethodPut, q.collectionPath(""), request, nil); err != nil {
+			return fmt.Errorf("failed to create qdrant collection %s: %w", q.collection, err)
+		}
+		// filtering by file is used on each re-index, index the payload field
+		index := map[string]any{"field_name": "file_path", "field_schema": "keyword"}
+		if err := q.call(http.MethodPut, q.collectionPath("index?wait=true"), index, nil); err != nil {
+			return fmt.Errorf("failed to index file_path in qdrant collection %s: %w", q.collection, err)
+		}
+	}
+	q.collectionReady = true
+
+	return nil
+}
+
+// CollectionSpace reads the metric of the collection, qdrant does not record whether the embeddings are normalized,
+// the configured normalization is assumed
+func (q *Qdrant) CollectionSpace() (Space, bool, error) {
+	var resp qdrantResponse[struct {
+		PointsCount int `json:"points_count"`
+		Config      struct {
+			Params struct {
+				Vectors struct {
+					Distance string `json:"distance"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}]
+	var status int
+	err := q.call(http.MethodGet, q.collectionPath(""), nil, &resp, &status)
+	if status == http.StatusNotFound {
+		// the collection is created on the first upsert, in the configured space
+		return Space{}, false, nil
+	}
+	if err != nil {
+		return Space{}, false, err
+	}
+	if resp.Result.PointsCount == 0 {
+		return Space{}, false, nil
+	}
+
+	space := Space{Metric: L2Metric, Normalized: q.space.Normalized}
+	for metric, distance := range qdrantDistances {
+		if distance == resp.Result.Config.Params.Vectors.Distance {
+			space.Metric = metric
+		}
+	}
+	return space, true, nil
+}
+
+// distance converts the score of a point to the distance of the other stores, qdrant returns the euclidean distance,
+// squared by the other stores, and the similarity for the cosine and the dot product
+func (s Space) distance(score float64) float64 {
+	switch s.Metric {
+	case CosineMetric, DotMetric:
+		return 1 - score
+	default:
+		return math.Pow(score, 2)
+	}
+}
+
+// quantizationConfig is the quantization of a new collection, nil without quantization
+func (q *Qdrant) quantizationConfig() map[string]any {
+	switch q.quantization {
+	case Int8Quantization:
+		return map[string]any{"scalar": map[string]any{"type": "int8", "always_ram": true}}
+	case BinaryQuantization:
+		return map[string]any{"binary": map[string]any{"always_ram": true}}
+	default:
+		return nil
+	}
+}
+
+func (q *Qdrant) collectionPath(suffix string) string {
+	path := "/collections/" + url.PathEscape(q.collection)
+	if suffix != "" {
+		path += "/" + suffix
+	}
+	return path
+}
+
+// call sends the request to qdrant, decoding the response in out if not nil, the status code is written in the
+// optional status pointer
+func (q *Qdrant) call(method string, path string, body any, out any, status ...*int) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal qdrant request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(q.ctx, method, q.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create qdrant request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("qdrant request %s %s failed: %w", method, path, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	for _, s := range status {
+		*s = resp.StatusCode
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read qdrant response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant request %s %s failed with status %d: %s", method, path, resp.StatusCode, content)
+	}
+	if out != nil {
+		if err := json.Unmarshal(content, out); err != nil {
+			return fmt.Errorf("failed to decode qdrant response: %w", err)
+		}
+	}
+	return nil
+}
+
+// toRecord converts the point back to a record, removing the entries added to the payload by the upsert
+func (p qdrantScoredPoint) toRecord() Record {
+	id, _ := p.Payload[qdrantChunkIdKey].(string)
+	document, _ := p.Payload[qdrantDocumentKey].(string)
+	metadata := make(map[string]any, len(p.Payload))
+	for key, value := range p.Payload {
+		if key != qdrantChunkIdKey && key != qdrantDocumentKey {
+			metadata[key] = value
+		}
+	}
+	return Record{Id: id, Document: document, Metadata: metadata, Embedding: p.Vector}
+}
+
+// qdrantPointId derives a stable uuid from the chunk id, qdrant only accepts uuids or integers as point ids
+func qdrantPointId(chunkId string) string {
+	sum := sha1.Sum([]byte(chunkId))
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// toQdrantFilter translates a normalized chroma-like where filter to a qdrant filter
+func toQdrantFilter(where map[string]any) (map[string]any, error) {
+	var must []any
+	for key, condition := range where {
+		switch key {
+		case "$and", "$or":
+			var clauses []any
+			for _, sub := range asFilters(condition) {
+				filter, err := toQdrantFilter(sub)
+				if err != nil {
+					return nil, err
+				}
+				clauses = append(clauses, filter)
+			}
+			if key == "$and" {
+				must = append(must, map[string]any{"must": clauses})
+			} else {
+				must = append(must, map[string]any{"should": clauses})
+			}
+		default:
+			clauses, err := toQdrantFieldConditions(key, condition)
+			if err != nil {
+				return nil, err
+			}
+			must = append(must, clauses...)
+		}
+	}
+	return map[string]any{"must": must}, nil
+}
+
+func toQdrantFieldConditions(key string, condition any) ([]any, error) {
+	operators, ok := asFilter(condition)
+	if !ok {
+		return []any{qdrantMatch(key, condition)}, nil
+	}
+
+	var conditions []any
+	for operator, operand := range operators {
+		switch operator {
+		case "$eq", "$contains":
+			// qdrant matches the array values by any of their elements
+			conditions = append(conditions, qdrantMatch(key, operand))
+		case "$ne":
+			conditions = append(conditions, map[string]any{"must_not": []any{qdrantMatch(key, operand)}})
+		case "$gt", "$gte", "$lt", "$lte":
+			conditions = append(conditions, map[string]any{
+				"key":   key,
+				"range": map[string]any{strings.TrimPrefix(operator, "$"): operand},
+			})
+		case "$in":
+			conditions = append(conditions, map[string]any{"key": key, "match": map[string]any{"any": operand}})
+		case "$nin":
+			conditions = append(conditions, map[string]any{"key": key, "match": map[string]any{"except": operand}})
+		default:
+			return nil, fmt.Errorf("unsupported filter operator %s", operator)
+		}
+	}
+	return conditions, nil
+}
+
+func qdrantMatch(key string, value any) map[string]any {
+	return map[string]any{"key": key, "match": map[string]any{"value": value}}
+}
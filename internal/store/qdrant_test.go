@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToQdrantFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		where map[string]any
+		want  map[string]any
+	}{
+		{
+			name:  "it should translate a plain value to a match",
+			where: map[string]any{"language": "go"},
+			want: map[string]any{"must": []any{
+				map[string]any{"key": "language", "match": map[string]any{"value": "go"}},
+			}},
+		},
+		{
+			name:  "it should translate a range operator",
+			where: map[string]any{"modified_at": map[string]any{"$gte": 100}},
+			want: map[string]any{"must": []any{
+				map[string]any{"key": "modified_at", "range": map[string]any{"gte": 100}},
+			}},
+		},
+		{
+			name:  "it should translate $ne to a must_not clause",
+			where: map[string]any{"language": map[string]any{"$ne": "go"}},
+			want: map[string]any{"must": []any{
+				map[string]any{"must_not": []any{
+					map[string]any{"key": "language", "match": map[string]any{"value": "go"}},
+				}},
+			}},
+		},
+		{
+			name:  "it should translate $in to a match any",
+			where: map[string]any{"language": map[string]any{"$in": []any{"go", "python"}}},
+			want: map[string]any{"must": []any{
+				map[string]any{"key": "language", "match": map[string]any{"any": []any{"go", "python"}}},
+			}},
+		},
+		{
+			name:  "it should translate $contains to a match of an element",
+			where: map[string]any{"issues": map[string]any{"$contains": "AUTH-42"}},
+			want: map[string]any{"must": []any{
+				map[string]any{"key": "issues", "match": map[string]any{"value": "AUTH-42"}},
+			}},
+		},
+		{
+			name: "it should translate $or to a should clause",
+			where: map[string]any{"$or": []any{
+				map[string]any{"package": "auth"},
+				map[string]any{"module_path": "auth"},
+			}},
+			want: map[string]any{"must": []any{
+				map[string]any{"should": []any{
+					map[string]any{"must": []any{
+						map[string]any{"key": "package", "match": map[string]any{"value": "auth"}},
+					}},
+					map[string]any{"must": []any{
+						map[string]any{"key": "module_path", "match": map[string]any{"value": "auth"}},
+					}},
+				}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			where := tt.where
+
+			// WHEN
+			got, err := toQdrantFilter(where)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQdrantPointId(t *testing.T) {
+	// GIVEN
+	chunkId := "auth.go_Validate_3"
+
+	// WHEN
+	id := qdrantPointId(chunkId)
+
+	// THEN
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	assert.Equal(t, id, qdrantPointId(chunkId), "it should be stable")
+	assert.NotEqual(t, id, qdrantPointId("auth.go_Validate_4"))
+}
+
+func TestQdrant_EnsureCollection(t *testing.T) {
+	// GIVEN
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result": {"config": {"params": {"vectors": {"size": 768, "distance": "Cosine"}}}}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		dimensions int
+		metric     Metric
+		wantErr    error
+	}{
+		{
+			name:       "it should accept a collection with the dimensions and the metric configured",
+			dimensions: 768,
+			metric:     CosineMetric,
+		},
+		{
+			name:       "it should refuse a collection with other dimensions",
+			dimensions: 1024,
+			metric:     CosineMetric,
+			wantErr:    ErrModelMismatch,
+		},
+		{
+			name:       "it should refuse a collection with another metric",
+			dimensions: 768,
+			metric:     L2Metric,
+			wantErr:    ErrSpaceMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQdrant(context.Background(), server.URL, "", "code_chunks", WithQdrantSpace(Space{Metric: tt.metric}))
+
+			// WHEN
+			err := q.ensureCollection(tt.dimensions)
+
+			// THEN
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.False(t, q.collectionReady, "it should check the collection again on the next upsert")
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, q.collectionReady)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package store
+
+import "math"
+
+// Quantization stores the embeddings with less bits per dimension, trading a small recall loss for a smaller index
+type Quantization string
+
+const (
+	// NoQuantization stores the embeddings at full precision
+	NoQuantization Quantization = ""
+	// Int8Quantization stores each dimension in a byte, scaled by the largest dimension of the embedding
+	Int8Quantization Quantization = "int8"
+	// BinaryQuantization stores the sign of each dimension in a bit, scaled by the mean magnitude of the embedding
+	BinaryQuantization Quantization = "binary"
+)
+
+// rescoreFactor is the number of candidates found with the quantized embeddings, per result, reranked with the
+// original ones
+const rescoreFactor = 4
+
+// quantizedEmbedding is an embedding stored with the quantization of the store
+type quantizedEmbedding struct {
+	Scale  float32
+	Values []byte
+}
+
+// EmbeddingBytes estimates the size of an embedding of dimensions once stored with the quantization, the originals
+// are stored at full precision next to the quantized values when keepOriginals is set
+func (q Quantization) EmbeddingBytes(dimensions int, keepOriginals bool) int {
+	originals := dimensions * 4
+	var quantized int
+	switch q {
+	case Int8Quantization:
+		quantized = dimensions + 4
+	case BinaryQuantization:
+		quantized = (dimensions+7)/8 + 4
+	default:
+		return originals
+	}
+	if keepOriginals {
+		return quantized + originals
+	}
+	return quantized
+}
+
+// quantize encodes the embedding, NoQuantization is not expected
+func (q Quantization) quantize(embedding []float32) quantizedEmbedding {
+	if q == BinaryQuantization {
+		values := make([]byte, (len(embedding)+7)/8)
+		var magnitude float64
+		for i, v := range embedding {
+			if v > 0 {
+				values[i/8] |= 1 << (i % 8)
+			}
+			magnitude += math.Abs(float64(v))
+		}
+		scale := float32(0)
+		if len(embedding) > 0 {
+			scale = float32(magnitude / float64(len(embedding)))
+		}
+		return quantizedEmbedding{Scale: scale, Values: values}
+	}
+
+	var largest float64
+	for _, v := range embedding {
+		largest = max(largest, math.Abs(float64(v)))
+	}
+	values := make([]byte, len(embedding))
+	if largest == 0 {
+		return quantizedEmbedding{Values: values}
+	}
+	scale := largest / math.MaxInt8
+	for i, v := range embedding {
+		values[i] = byte(int8(math.Round(float64(v) / scale)))
+	}
+	return quantizedEmbedding{Scale: float32(scale), Values: values}
+}
+
+// decode approximates the original embedding of dimensions, written in buffer when large enough
+func (q Quantization) decode(quantized quantizedEmbedding, dimensions int, buffer []float32) []float32 {
+	if cap(buffer) < dimensions {
+		buffer = make([]float32, dimensions)
+	}
+	buffer = buffer[:dimensions]
+	for i := range buffer {
+		if q == BinaryQuantization {
+			if quantized.Values[i/8]&(1<<(i%8)) != 0 {
+				buffer[i] = quantized.Scale
+			} else {
+				buffer[i] = -quantized.Scale
+			}
+			continue
+		}
+		buffer[i] = float32(int8(quantized.Values[i])) * quantized.Scale
+	}
+	return buffer
+}
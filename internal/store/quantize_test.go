@@ -0,0 +1,202 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantization(t *testing.T) {
+	tests := []struct {
+		name         string
+		quantization Quantization
+		embedding    []float32
+		want         []float32
+		delta        float64
+	}{
+		{
+			name:         "it should approximate each dimension with a byte",
+			quantization: Int8Quantization,
+			embedding:    []float32{0.5, -0.25, 0.1, 0},
+			want:         []float32{0.5, -0.25, 0.1, 0},
+			delta:        0.5 / 127,
+		},
+		{
+			name:         "it should keep the sign of each dimension with a bit",
+			quantization: BinaryQuantization,
+			embedding:    []float32{0.5, -0.25, 0.1, 0, 0.3, -0.1, 0.2, -0.4, 0.4},
+			want:         []float32{0.25, -0.25, 0.25, -0.25, 0.25, -0.25, 0.25, -0.25, 0.25},
+			delta:        1e-6,
+		},
+		{
+			name:         "it should decode a zero embedding",
+			quantization: Int8Quantization,
+			embedding:    []float32{0, 0},
+			want:         []float32{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			quantized := tt.quantization.quantize(tt.embedding)
+			decoded := tt.quantization.decode(quantized, len(tt.embedding), nil)
+
+			// THEN
+			require.Len(t, decoded, len(tt.want))
+			for i := range tt.want {
+				assert.InDelta(t, tt.want[i], decoded[i], tt.delta, "dimension %d", i)
+			}
+		})
+	}
+}
+
+func TestQuantization_EmbeddingBytes(t *testing.T) {
+	tests := []struct {
+		name          string
+		quantization  Quantization
+		keepOriginals bool
+		want          int
+	}{
+		{
+			name:         "it should count a float32 per dimension at full precision",
+			quantization: NoQuantization,
+			want:         1536,
+		},
+		{
+			name:         "it should count a byte per dimension and the scale with int8",
+			quantization: Int8Quantization,
+			want:         388,
+		},
+		{
+			name:         "it should count a bit per dimension and the scale with binary",
+			quantization: BinaryQuantization,
+			want:         52,
+		},
+		{
+			name:          "it should count the originals when kept",
+			quantization:  BinaryQuantization,
+			keepOriginals: true,
+			want:          1588,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			size := tt.quantization.EmbeddingBytes(384, tt.keepOriginals)
+
+			// THEN
+			assert.Equal(t, tt.want, size)
+		})
+	}
+}
+
+func TestLocal_Quantization(t *testing.T) {
+	t.Run("it should write a smaller file", func(t *testing.T) {
+		// GIVEN
+		dir := t.TempDir()
+		records := newLargeTestRecords(64, 256)
+		sizes := make(map[Quantization]int64)
+
+		for _, quantization := range []Quantization{NoQuantization, Int8Quantization, BinaryQuantization} {
+			path := filepath.Join(dir, string(quantization)+"store.gob")
+			local, err := OpenLocal(path, WithLocalQuantization(quantization, false))
+			require.NoError(t, err)
+
+			// WHEN
+			require.NoError(t, local.Upsert(records))
+			require.NoError(t, local.Close())
+
+			// THEN
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			sizes[quantization] = info.Size()
+		}
+		assert.Less(t, sizes[Int8Quantization]*2, sizes[NoQuantization])
+		assert.Less(t, sizes[BinaryQuantization]*2, sizes[Int8Quantization])
+	})
+
+	t.Run("it should search the quantized embeddings read back", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path, WithLocalQuantization(Int8Quantization, false))
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+		require.NoError(t, local.Close())
+
+		// WHEN
+		reopened, err := OpenLocal(path, WithLocalQuantization(Int8Quantization, false))
+		require.NoError(t, err)
+		results, err := reopened.Query([]float32{0.1, 0.9}, 1, nil)
+
+		// THEN
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "tax.py_TAX_RATE_5", results[0].Id)
+		assert.InDelta(t, 0, results[0].Distance, 1e-4)
+	})
+
+	t.Run("it should rerank with the originals when they are kept", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path, WithLocalQuantization(BinaryQuantization, true))
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+		require.NoError(t, local.Close())
+		reopened, err := OpenLocal(path, WithLocalQuantization(BinaryQuantization, true))
+		require.NoError(t, err)
+
+		// WHEN
+		results, err := reopened.Query([]float32{0.1, 0.9}, 2, nil)
+
+		// THEN
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		// both have the same signs, only the originals tell them apart
+		assert.Equal(t, "tax.py_TAX_RATE_5", results[0].Id)
+		assert.Equal(t, float64(0), results[0].Distance)
+		assert.Equal(t, "tax.py_calculate_tax_1", results[1].Id)
+		assert.InDelta(t, 0.02, results[1].Distance, 1e-6)
+	})
+
+	t.Run("it should restore the full precision once the quantization is disabled", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path, WithLocalQuantization(Int8Quantization, false))
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+		require.NoError(t, local.Close())
+
+		// WHEN
+		reopened, err := OpenLocal(path)
+		require.NoError(t, err)
+
+		// THEN
+		records, err := reopened.Peek(0, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		for _, record := range records {
+			assert.Len(t, record.Embedding, 2, record.Id)
+		}
+	})
+}
+
+func newLargeTestRecords(count int, dimensions int) []Record {
+	records := make([]Record, count)
+	for i := range records {
+		embedding := make([]float32, dimensions)
+		for j := range embedding {
+			embedding[j] = float32((i*31+j*17)%97)/97 - 0.5
+		}
+		records[i] = Record{
+			Id:        fmt.Sprintf("src.go_chunk_%d", i),
+			Document:  "x",
+			Metadata:  map[string]any{"file_path": "src.go"},
+			Embedding: embedding,
+		}
+	}
+	return records
+}
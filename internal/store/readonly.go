@@ -0,0 +1,128 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+// ErrReadOnly is returned by the writes to a store opened read-only
+var ErrReadOnly = errors.New("the index is read-only")
+
+type (
+	// ReadOnly refuses the writes to the wrapped store, so shared or prebuilt indexes can be queried without risk
+	ReadOnly struct {
+		store VectorStore
+	}
+
+	// readOnlyCollections refuses to create or drop the collections of the wrapped manager
+	readOnlyCollections struct {
+		manager CollectionManager
+	}
+)
+
+var (
+	_ VectorStore       = (*ReadOnly)(nil)
+	_ Inspector         = (*ReadOnly)(nil)
+	_ CollectionManager = (*ReadOnly)(nil)
+)
+
+// NewReadOnly wraps the store, refusing its writes
+func NewReadOnly(store VectorStore) *ReadOnly {
+	return &ReadOnly{store: store}
+}
+
+// NewReadOnlyCollections wraps the manager, refusing to create or drop collections
+func NewReadOnlyCollections(manager CollectionManager) CollectionManager {
+	return &readOnlyCollections{manager: manager}
+}
+
+// Writable checks whether files can be created in the directory, a directory which does not exist yet is writable
+// once created
+func Writable(dir string) bool {
+	file, err := os.CreateTemp(dir, ".mm-write-check-*")
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	_ = file.Close()
+	_ = os.Remove(file.Name())
+	return true
+}
+
+func (r *ReadOnly) Upsert([]Record) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnly) Query(vector []float32, nResults int, where map[string]any) ([]embedding.QueryResult, error) {
+	return r.store.Query(vector, nResults, where)
+}
+
+func (r *ReadOnly) DeleteByFile(string) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnly) DeleteAll() error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnly) Stats() (Stats, error) {
+	return r.store.Stats()
+}
+
+func (r *ReadOnly) Close() error {
+	return r.store.Close()
+}
+
+func (r *ReadOnly) Collections() ([]string, error) {
+	inspector, ok := r.store.(Inspector)
+	if !ok {
+		return nil, fmt.Errorf("store cannot be inspected")
+	}
+	return inspector.Collections()
+}
+
+func (r *ReadOnly) Peek(limit int, where map[string]any) ([]Record, error) {
+	inspector, ok := r.store.(Inspector)
+	if !ok {
+		return nil, fmt.Errorf("store cannot be inspected")
+	}
+	return inspector.Peek(limit, where)
+}
+
+func (r *ReadOnly) Scan(pageSize int, consume func(records []Record) error) error {
+	inspector, ok := r.store.(Inspector)
+	if !ok {
+		return fmt.Errorf("store cannot be inspected")
+	}
+	return ScanRecords(inspector, pageSize, consume)
+}
+
+func (r *ReadOnly) Delete([]string) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnly) CreateCollection(string, int) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnly) DropCollection(string) error {
+	return ErrReadOnly
+}
+
+func (r *readOnlyCollections) Collections() ([]string, error) {
+	return r.manager.Collections()
+}
+
+func (r *readOnlyCollections) CreateCollection(string, int) error {
+	return ErrReadOnly
+}
+
+func (r *readOnlyCollections) DropCollection(string) error {
+	return ErrReadOnly
+}
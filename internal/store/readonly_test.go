@@ -0,0 +1,52 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	// GIVEN
+	path := filepath.Join(t.TempDir(), "store.gob")
+	local, err := OpenLocal(path)
+	require.NoError(t, err)
+	require.NoError(t, local.Upsert(newTestRecords(t)))
+	require.NoError(t, local.Close())
+	local, err = OpenLocal(path)
+	require.NoError(t, err)
+	readOnly := NewReadOnly(local)
+
+	// WHEN
+	results, queryErr := readOnly.Query([]float32{1, 0}, 1, nil)
+	upsertErr := readOnly.Upsert(newTestRecords(t))
+	deleteErr := readOnly.DeleteByFile("tax.py")
+	deleteAllErr := readOnly.DeleteAll()
+
+	// THEN
+	require.NoError(t, queryErr)
+	require.Len(t, results, 1)
+	assert.Equal(t, "auth.go_Validate_3", results[0].Id, "it should query the wrapped store")
+	assert.ErrorIs(t, upsertErr, ErrReadOnly)
+	assert.ErrorIs(t, deleteErr, ErrReadOnly)
+	assert.ErrorIs(t, deleteAllErr, ErrReadOnly)
+	stats, err := readOnly.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Records, "it should leave the store untouched")
+}
+
+func TestWritable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	dir := t.TempDir()
+	readOnlyDir := filepath.Join(dir, "read-only")
+	require.NoError(t, os.Mkdir(readOnlyDir, 0555))
+
+	assert.True(t, Writable(dir), "it should detect a writable directory")
+	assert.True(t, Writable(filepath.Join(dir, "missing")), "it should consider a missing directory writable")
+	assert.False(t, Writable(readOnlyDir), "it should detect a read-only directory")
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/a-peyrard/mm/internal/glob"
+)
+
+type (
+	// InspectableStore is a vector store giving access to its raw records
+	InspectableStore interface {
+		VectorStore
+		Inspector
+	}
+
+	// Selector selects records by their metadata, with terms like key:value, implicitly combined with AND, and
+	// alternatives separated by OR, e.g. path:vendor/** OR is_generated:true
+	Selector struct {
+		raw          string
+		alternatives [][]selectorTerm
+	}
+
+	selectorTerm struct {
+		key      string
+		value    string
+		patterns []*glob.Pattern
+	}
+)
+
+// ParseSelector parses a selector expression, the path key matches the file path against a glob, relative globs
+// matching anywhere in the path, other keys match the metadata value as text
+func ParseSelector(expression string) (*Selector, error) {
+	selector := &Selector{raw: expression}
+	var terms []selectorTerm
+	for _, word := range strings.Fields(expression) {
+		switch word {
+		case "OR":
+			if len(terms) == 0 {
+				return nil, fmt.Errorf("invalid selector %s: OR without terms before it", expression)
+			}
+			selector.alternatives = append(selector.alternatives, terms)
+			terms = nil
+			continue
+		case "AND":
+			continue
+		}
+
+		key, value, found := strings.Cut(word, ":")
+		if !found || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid selector %s: %s is not a key:value term", expression, word)
+		}
+		term := selectorTerm{key: key, value: value}
+		if key == "path" {
+			patterns, err := compilePathPatterns(value)
+			if err != nil {
+				return nil, err
+			}
+			term.patterns = patterns
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("invalid selector: no terms")
+	}
+	selector.alternatives = append(selector.alternatives, terms)
+	return selector, nil
+}
+
+// compilePathPatterns compiles the glob of a path term, relative globs match anywhere in the path, and globs without
+// wildcards match everything below them too
+func compilePathPatterns(value string) ([]*glob.Pattern, error) {
+	globs := []string{value}
+	if !filepath.IsAbs(value) && !strings.HasPrefix(value, "**") {
+		globs = []string{"**/" + value}
+		if !strings.ContainsAny(value, "*?") {
+			globs = append(globs, "**/"+strings.TrimSuffix(value, "/")+"/**")
+		}
+	}
+
+	patterns := make([]*glob.Pattern, len(globs))
+	for i, raw := range globs {
+		pattern, err := glob.Compile(raw)
+		if err != nil {
+			return nil, err
+		}
+		patterns[i] = pattern
+	}
+	return patterns, nil
+}
+
+// Match checks if the metadata of the record matches the selector
+func (s *Selector) Match(record Record) bool {
+	for _, terms := range s.alternatives {
+		if matchesAll(record.Metadata, terms) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Selector) String() string {
+	return s.raw
+}
+
+func matchesAll(metadata map[string]any, terms []selectorTerm) bool {
+	for _, term := range terms {
+		if !term.match(metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t selectorTerm) match(metadata map[string]any) bool {
+	if t.patterns != nil {
+		filePath, _ := metadata["file_path"].(string)
+		for _, pattern := range t.patterns {
+			if pattern.Match(filePath) {
+				return true
+			}
+		}
+		return false
+	}
+	value, found := metadata[t.key]
+	return found && fmt.Sprint(value) == t.value
+}
+
+// ParseMetadataValue converts the text of a metadata value to a boolean or a number when it is one
+func ParseMetadataValue(text string) any {
+	if value, err := strconv.ParseBool(text); err == nil {
+		return value
+	}
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return value
+	}
+	if value, err := strconv.ParseFloat(text, 64); err == nil {
+		return value
+	}
+	return text
+}
+
+// Select returns the records of the store matching the selector
+func Select(s InspectableStore, selector *Selector) ([]Record, error) {
+	records, err := s.Peek(0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the records of the store: %w", err)
+	}
+	var selected []Record
+	for _, record := range records {
+		if selector.Match(record) {
+			selected = append(selected, record)
+		}
+	}
+	return selected, nil
+}
+
+// DeleteWhere deletes the records matching the selector, and returns them
+func DeleteWhere(s InspectableStore, selector *Selector) ([]Record, error) {
+	selected, err := Select(s, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(selected))
+	for i, record := range selected {
+		ids[i] = record.Id
+	}
+	if err := s.Delete(ids); err != nil {
+		return nil, fmt.Errorf("failed to delete the records matching %s: %w", selector, err)
+	}
+	return selected, nil
+}
+
+// RetagWhere sets and removes metadata of the records matching the selector, their embeddings are kept, and returns
+// the updated records
+func RetagWhere(s InspectableStore, selector *Selector, set map[string]any, unset []string) ([]Record, error) {
+	if _, found := set["file_path"]; found || slices.Contains(unset, "file_path") {
+		return nil, fmt.Errorf("the file path of the records cannot be changed")
+	}
+	selected, err := Select(s, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	for i, record := range selected {
+		metadata := make(map[string]any, len(record.Metadata)+len(set))
+		for key, value := range record.Metadata {
+			metadata[key] = value
+		}
+		for key, value := range set {
+			metadata[key] = value
+		}
+		for _, key := range unset {
+			delete(metadata, key)
+		}
+		selected[i].Metadata = metadata
+	}
+	if err := s.Upsert(selected); err != nil {
+		return nil, fmt.Errorf("failed to update the records matching %s: %w", selector, err)
+	}
+	return selected, nil
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector_Match(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		metadata   map[string]any
+		want       bool
+	}{
+		{
+			name:       "it should match relative globs anywhere in the path",
+			expression: "path:vendor/**",
+			metadata:   map[string]any{"file_path": "/src/app/vendor/lib/lib.go"},
+			want:       true,
+		},
+		{
+			name:       "it should match everything below a path without wildcards",
+			expression: "path:vendor",
+			metadata:   map[string]any{"file_path": "/src/app/vendor/lib/lib.go"},
+			want:       true,
+		},
+		{
+			name:       "it should not match a segment partially",
+			expression: "path:vendor",
+			metadata:   map[string]any{"file_path": "/src/app/vendored.go"},
+			want:       false,
+		},
+		{
+			name:       "it should match any of the alternatives",
+			expression: "path:vendor/** OR is_generated:true",
+			metadata:   map[string]any{"file_path": "/src/app/api.pb.go", "is_generated": true},
+			want:       true,
+		},
+		{
+			name:       "it should match all the terms of an alternative",
+			expression: "language:go chunk_type:function",
+			metadata:   map[string]any{"language": "go", "chunk_type": "method"},
+			want:       false,
+		},
+		{
+			name:       "it should not match a missing key",
+			expression: "is_generated:false",
+			metadata:   map[string]any{"file_path": "/src/app/main.go"},
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			selector, err := ParseSelector(tt.expression)
+			require.NoError(t, err)
+
+			// WHEN
+			got := selector.Match(Record{Metadata: tt.metadata})
+
+			// THEN
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, expression := range []string{"", "OR language:go", "language:go OR", "vendor"} {
+		// WHEN
+		_, err := ParseSelector(expression)
+
+		// THEN
+		assert.Error(t, err, "it should reject %q", expression)
+	}
+}
+
+func TestRetagWhere(t *testing.T) {
+	// GIVEN
+	store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(newTestRecords(t)))
+	selector, err := ParseSelector("path:tax.py")
+	require.NoError(t, err)
+
+	// WHEN
+	updated, err := RetagWhere(store, selector, map[string]any{"owner": "payments"}, []string{"language"})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Len(t, updated, 2)
+	records, err := store.Peek(0, map[string]any{"owner": "payments"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.NotContains(t, records[0].Metadata, "language")
+	assert.Equal(t, []float32{0.1, 0.9}, records[0].Embedding, "it should keep the embeddings")
+}
+
+func TestDeleteWhere(t *testing.T) {
+	// GIVEN
+	store, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(newTestRecords(t)))
+	selector, err := ParseSelector("language:python OR path:nothing/**")
+	require.NoError(t, err)
+
+	// WHEN
+	deleted, err := DeleteWhere(store, selector)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	stats, err := store.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Records)
+}
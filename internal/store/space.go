@@ -0,0 +1,179 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrSpaceMismatch is returned when the collection compares its embeddings otherwise than configured
+var ErrSpaceMismatch = errors.New("embedding space mismatch")
+
+type (
+	// Metric measures the distance between two embeddings, the lower the closer
+	Metric string
+
+	// Space describes how the embeddings of a collection are compared, chosen when the collection is created
+	Space struct {
+		Metric Metric
+		// Normalized embeddings are scaled to a unit length before being stored, and the queries before searching
+		Normalized bool
+	}
+
+	// SpaceRecorder records the space with the collection
+	SpaceRecorder interface {
+		// CollectionSpace returns the space of the collection, false while the collection is empty, it then adopts
+		// the configured one
+		CollectionSpace() (Space, bool, error)
+	}
+)
+
+const (
+	// L2Metric is the squared euclidean distance, the default
+	L2Metric Metric = "l2"
+	// CosineMetric is one minus the cosine similarity
+	CosineMetric Metric = "cosine"
+	// DotMetric is one minus the dot product, meant for normalized embeddings
+	DotMetric Metric = "dot"
+)
+
+var (
+	_ SpaceRecorder = (*Local)(nil)
+	_ SpaceRecorder = (*Chroma)(nil)
+	_ SpaceRecorder = (*Qdrant)(nil)
+	_ SpaceRecorder = (*ReadOnly)(nil)
+	_ SpaceRecorder = (*Follower)(nil)
+)
+
+// ParseMetric returns the metric of its name, L2Metric if empty
+func ParseMetric(name string) (Metric, error) {
+	switch metric := Metric(name); metric {
+	case "":
+		return L2Metric, nil
+	case L2Metric, CosineMetric, DotMetric:
+		return metric, nil
+	default:
+		return "", fmt.Errorf("unknown metric %q, expected %q, %q or %q", name, L2Metric, CosineMetric, DotMetric)
+	}
+}
+
+// Distance measures the distance between the embeddings, which have the same dimensions
+func (m Metric) Distance(a []float32, b []float32) float64 {
+	switch m {
+	case CosineMetric:
+		norms := norm(a) * norm(b)
+		if norms == 0 {
+			return 1
+		}
+		return 1 - dot(a, b)/norms
+	case DotMetric:
+		return 1 - dot(a, b)
+	default:
+		return squaredL2(a, b)
+	}
+}
+
+func (s Space) String() string {
+	if s.Normalized {
+		return string(s.Metric) + " on normalized embeddings"
+	}
+	return string(s.Metric)
+}
+
+// CheckSpace refuses a collection comparing its embeddings otherwise than configured, the distances, and then the
+// rankings, would not be the expected ones, an empty collection adopts the configured space
+func CheckSpace(vectorStore VectorStore, configured Space) error {
+	recorder, ok := vectorStore.(SpaceRecorder)
+	if !ok {
+		return nil
+	}
+	space, known, err := recorder.CollectionSpace()
+	if err != nil {
+		return err
+	}
+	if known && space != configured {
+		return fmt.Errorf(
+			"%w: the collection compares its embeddings with %s, not %s: configure store.metric and store.normalize "+
+				"as the collection, or reindex after mm purge --all",
+			ErrSpaceMismatch,
+			space,
+			configured,
+		)
+	}
+	return nil
+}
+
+// normalize scales the embedding to a unit length, a zero embedding is left as is
+func normalize(embedding []float32) []float32 {
+	n := norm(embedding)
+	if n == 0 {
+		return embedding
+	}
+	scaled := make([]float32, len(embedding))
+	for i, v := range embedding {
+		scaled[i] = float32(float64(v) / n)
+	}
+	return scaled
+}
+
+// normalizeRecords returns the records with their embeddings normalized, the records passed are left untouched
+func normalizeRecords(records []Record) []Record {
+	normalized := make([]Record, len(records))
+	for i, record := range records {
+		record.Embedding = normalize(record.Embedding)
+		normalized[i] = record
+	}
+	return normalized
+}
+
+func norm(embedding []float32) float64 {
+	return math.Sqrt(dot(embedding, embedding))
+}
+
+func dot(a []float32, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func (s *Local) CollectionSpace() (Space, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.space, len(s.records) > 0, nil
+}
+
+func (r *ReadOnly) CollectionSpace() (Space, bool, error) {
+	recorder, ok := r.store.(SpaceRecorder)
+	if !ok {
+		return Space{}, false, nil
+	}
+	return recorder.CollectionSpace()
+}
+
+func (c *Chroma) CollectionSpace() (Space, bool, error) {
+	metric, normalized, count, err := c.indexer.CollectionSpace()
+	if err != nil {
+		return Space{}, false, err
+	}
+	parsed, err := ParseMetric(metric)
+	if err != nil {
+		return Space{}, false, err
+	}
+	return Space{Metric: parsed, Normalized: normalized}, count > 0, nil
+}
+
+func (f *Follower) CollectionSpace() (Space, bool, error) {
+	current, release, err := f.store()
+	if err != nil {
+		return Space{}, false, err
+	}
+	defer release()
+	recorder, ok := current.(SpaceRecorder)
+	if !ok {
+		return Space{}, false, nil
+	}
+	return recorder.CollectionSpace()
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetric_Distance(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric Metric
+		a      []float32
+		b      []float32
+		want   float64
+	}{
+		{
+			name:   "it should measure the squared euclidean distance",
+			metric: L2Metric,
+			a:      []float32{1, 0},
+			b:      []float32{0, 2},
+			want:   5,
+		},
+		{
+			name:   "it should ignore the lengths with the cosine",
+			metric: CosineMetric,
+			a:      []float32{1, 0},
+			b:      []float32{3, 0},
+			want:   0,
+		},
+		{
+			name:   "it should measure orthogonal embeddings as distant with the cosine",
+			metric: CosineMetric,
+			a:      []float32{1, 0},
+			b:      []float32{0, 1},
+			want:   1,
+		},
+		{
+			name:   "it should measure one minus the dot product",
+			metric: DotMetric,
+			a:      []float32{0.6, 0.8},
+			b:      []float32{0.6, 0.8},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			distance := tt.metric.Distance(tt.a, tt.b)
+
+			// THEN
+			assert.InDelta(t, tt.want, distance, 1e-6)
+		})
+	}
+}
+
+func TestCheckSpace(t *testing.T) {
+	tests := []struct {
+		name       string
+		created    Space
+		configured Space
+		empty      bool
+		wantErr    string
+	}{
+		{
+			name:       "it should accept the space of the collection",
+			created:    Space{Metric: CosineMetric, Normalized: true},
+			configured: Space{Metric: CosineMetric, Normalized: true},
+		},
+		{
+			name:       "it should refuse another metric",
+			created:    Space{Metric: L2Metric},
+			configured: Space{Metric: DotMetric},
+			wantErr:    "the collection compares its embeddings with l2, not dot",
+		},
+		{
+			name:       "it should refuse another normalization",
+			created:    Space{Metric: CosineMetric},
+			configured: Space{Metric: CosineMetric, Normalized: true},
+			wantErr:    "with cosine, not cosine on normalized embeddings",
+		},
+		{
+			name:       "it should let an empty collection adopt the configured space",
+			created:    Space{Metric: L2Metric},
+			configured: Space{Metric: DotMetric, Normalized: true},
+			empty:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"), WithLocalSpace(tt.created))
+			require.NoError(t, err)
+			if !tt.empty {
+				require.NoError(t, local.Upsert(newTestRecords(t)))
+			}
+
+			// WHEN
+			err = CheckSpace(local, tt.configured)
+
+			// THEN
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrSpaceMismatch)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLocal_Space(t *testing.T) {
+	t.Run("it should normalize the embeddings and the queries", func(t *testing.T) {
+		// GIVEN
+		local, err := OpenLocal(filepath.Join(t.TempDir(), "store.gob"), WithLocalSpace(Space{Metric: DotMetric, Normalized: true}))
+		require.NoError(t, err)
+		records := newTestRecords(t)
+		records[0].Embedding = []float32{3, 4}
+
+		// WHEN
+		require.NoError(t, local.Upsert(records))
+		results, err := local.Query([]float32{6, 8}, 1, nil)
+
+		// THEN
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "auth.go_Validate_3", results[0].Id)
+		assert.InDelta(t, 0, results[0].Distance, 1e-6)
+		assert.Equal(t, []float32{3, 4}, records[0].Embedding, "it should not modify the records passed")
+	})
+
+	t.Run("it should keep the space the store was created with", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path, WithLocalSpace(Space{Metric: CosineMetric}))
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+		require.NoError(t, local.Close())
+
+		// WHEN
+		reopened, err := OpenLocal(path, WithLocalSpace(Space{Metric: DotMetric}))
+		require.NoError(t, err)
+
+		// THEN
+		space, known, err := reopened.CollectionSpace()
+		require.NoError(t, err)
+		assert.True(t, known)
+		assert.Equal(t, Space{Metric: CosineMetric}, space)
+	})
+
+	t.Run("it should adopt the configured space once emptied", func(t *testing.T) {
+		// GIVEN
+		path := filepath.Join(t.TempDir(), "store.gob")
+		local, err := OpenLocal(path)
+		require.NoError(t, err)
+		require.NoError(t, local.Upsert(newTestRecords(t)))
+		require.NoError(t, local.Close())
+		reopened, err := OpenLocal(path, WithLocalSpace(Space{Metric: DotMetric, Normalized: true}))
+		require.NoError(t, err)
+
+		// WHEN
+		require.NoError(t, reopened.DeleteAll())
+
+		// THEN
+		require.NoError(t, reopened.Upsert(newTestRecords(t)))
+		space, _, err := reopened.CollectionSpace()
+		require.NoError(t, err)
+		assert.Equal(t, Space{Metric: DotMetric, Normalized: true}, space)
+	})
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"github.com/a-peyrard/mm/internal/embedding"
+)
+
+type (
+	// VectorStore persists the embedded chunks, and searches them by vector, it is implemented by each backend
+	VectorStore interface {
+		// Upsert inserts the records, replacing the existing ones with the same ids
+		Upsert(records []Record) error
+		// Query returns the nResults records closest to the vector, matching the chroma-like where filter
+		Query(vector []float32, nResults int, where map[string]any) ([]embedding.QueryResult, error)
+		// DeleteByFile removes all the records of the file
+		DeleteByFile(filePath string) error
+		// DeleteAll removes all the records
+		DeleteAll() error
+		Stats() (Stats, error)
+		Close() error
+	}
+
+	Stats struct {
+		Records int
+		// Dimensions of the stored embeddings, 0 if the store is empty
+		Dimensions int
+	}
+
+	QueryEmbedder interface {
+		EmbedQuery(query embedding.Query) ([]float32, error)
+	}
+
+	// Querier embeds queries with the embedder, and searches them in the store
+	Querier struct {
+		Embedder QueryEmbedder
+		Store    VectorStore
+	}
+)
+
+var (
+	_ VectorStore = (*Local)(nil)
+	_ VectorStore = (*Qdrant)(nil)
+	_ VectorStore = (*Chroma)(nil)
+)
+
+func (q Querier) Query(query embedding.Query) ([]embedding.QueryResult, error) {
+	vector, err := q.Embedder.EmbedQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return q.Store.Query(vector, query.NResults, query.Where)
+}
@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket allows a number of tokens per minute, a burst of a whole minute being allowed once the bucket is full,
+// it is safe to share between goroutines, the waiting ones being served in order
+type TokenBucket struct {
+	perSecond float64
+	capacity  float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full bucket allowing perMinute tokens, a nil bucket (no limit) is returned if it is not
+// positive
+func NewTokenBucket(perMinute int) *TokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &TokenBucket{
+		perSecond: float64(perMinute) / 60,
+		capacity:  float64(perMinute),
+		tokens:    float64(perMinute),
+		last:      time.Now(),
+	}
+}
+
+// Wait blocks until n tokens are available, and takes them, more tokens than the capacity are taken from a full
+// bucket, returns how long it waited
+func (b *TokenBucket) Wait(ctx context.Context, n int) (time.Duration, error) {
+	if b == nil || n <= 0 {
+		return 0, nil
+	}
+
+	b.lock.Lock()
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.perSecond)
+	b.last = now
+	// the tokens are taken right away, the next callers waiting for the ones owed by the bucket
+	missing := min(float64(n), b.capacity) - b.tokens
+	b.tokens -= float64(n)
+	b.lock.Unlock()
+
+	if missing <= 0 {
+		return 0, nil
+	}
+	delay := time.Duration(missing / b.perSecond * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-timer.C:
+		return delay, nil
+	}
+}
@@ -0,0 +1,77 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket_Wait(t *testing.T) {
+	t.Run("it should allow a burst of the tokens of a minute", func(t *testing.T) {
+		// GIVEN
+		bucket := NewTokenBucket(600)
+
+		// WHEN
+		first, err := bucket.Wait(context.Background(), 400)
+		require.NoError(t, err)
+		second, err := bucket.Wait(context.Background(), 200)
+		require.NoError(t, err)
+
+		// THEN
+		assert.Zero(t, first)
+		assert.Zero(t, second)
+	})
+
+	t.Run("it should wait for the tokens to be refilled", func(t *testing.T) {
+		// GIVEN
+		bucket := NewTokenBucket(600)
+		_, err := bucket.Wait(context.Background(), 600)
+		require.NoError(t, err)
+
+		// WHEN
+		waited, err := bucket.Wait(context.Background(), 1)
+
+		// THEN
+		require.NoError(t, err)
+		assert.InDelta(t, 100*time.Millisecond, waited, float64(20*time.Millisecond))
+	})
+
+	t.Run("it should take more tokens than the capacity from a full bucket", func(t *testing.T) {
+		// GIVEN
+		bucket := NewTokenBucket(6000)
+
+		// WHEN
+		waited, err := bucket.Wait(context.Background(), 6010)
+
+		// THEN
+		require.NoError(t, err)
+		assert.Zero(t, waited)
+	})
+
+	t.Run("it should stop waiting when the context is done", func(t *testing.T) {
+		// GIVEN
+		bucket := NewTokenBucket(1)
+		_, err := bucket.Wait(context.Background(), 1)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// WHEN
+		_, err = bucket.Wait(ctx, 1)
+
+		// THEN
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("it should not limit without a rate", func(t *testing.T) {
+		bucket := NewTokenBucket(0)
+
+		waited, err := bucket.Wait(context.Background(), 1000)
+
+		require.NoError(t, err)
+		assert.Zero(t, waited)
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package throttle
+
+import "fmt"
+
+// SetNiceness is not supported on this platform
+func SetNiceness(niceness int) error {
+	return fmt.Errorf("setting niceness to %d is not supported on this platform", niceness)
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package throttle
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// SetNiceness lowers the scheduling priority of the process, and of the processes it will start (python indexers).
+// On linux the niceness is per thread, so it is applied to all the threads of the process.
+func SetNiceness(niceness int) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		// no procfs, the priority applies to the whole process
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, niceness); err != nil {
+			return fmt.Errorf("failed to set niceness to %d: %w", niceness, err)
+		}
+		return nil
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, niceness); err != nil {
+			return fmt.Errorf("failed to set niceness of thread %d to %d: %w", tid, niceness, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package throttle
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// ParserLimiter bounds the parses running at the same time, across the languages and per language, independently
+	// of the number of workers, the tree-sitter parsers run through cgo and contend on large runs. It is safe to
+	// share between workers, a nil limiter does not limit anything.
+	ParserLimiter struct {
+		global    chan struct{}
+		languages map[string]chan struct{}
+
+		lock  sync.Mutex
+		stats map[string]*ParserStats
+	}
+
+	// ParserStats measures the contention of the parses of a language
+	ParserStats struct {
+		Language string
+		// Limit of the parses of the language running at the same time, 0 if only the global limit applies
+		Limit int
+		// Parses counts the parses, Waited the ones which had to wait for another one to complete
+		Parses int64
+		Waited int64
+		// WaitTime is the total time the parses waited
+		WaitTime time.Duration
+	}
+)
+
+// NewParserLimiter creates a limiter allowing global parses at the same time, and the parses of each language of
+// perLanguage at the same time, limits which are not positive are ignored, a nil limiter (no limit) is returned if
+// there is none
+func NewParserLimiter(global int, perLanguage map[string]int) *ParserLimiter {
+	limiter := &ParserLimiter{
+		languages: make(map[string]chan struct{}),
+		stats:     make(map[string]*ParserStats),
+	}
+	if global > 0 {
+		limiter.global = make(chan struct{}, global)
+	}
+	for language, limit := range perLanguage {
+		if limit > 0 {
+			limiter.languages[language] = make(chan struct{}, limit)
+		}
+	}
+	if limiter.global == nil && len(limiter.languages) == 0 {
+		return nil
+	}
+	return limiter
+}
+
+// Acquire waits for a parse of the language to be allowed, the returned function has to be called once the parse
+// completes
+func (l *ParserLimiter) Acquire(ctx context.Context, language string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	waited := false
+	var acquired []chan struct{}
+	release := func() {
+		for _, semaphore := range acquired {
+			<-semaphore
+		}
+	}
+	// the language first, the global slot is not held while waiting for it
+	for _, semaphore := range []chan struct{}{l.languages[language], l.global} {
+		if semaphore == nil {
+			continue
+		}
+		select {
+		case semaphore <- struct{}{}:
+		default:
+			waited = true
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+		acquired = append(acquired, semaphore)
+	}
+	l.record(language, waited, time.Since(start))
+
+	var once sync.Once
+	return func() { once.Do(release) }, nil
+}
+
+// Stats returns the contention of the parses of each language, sorted by language
+func (l *ParserLimiter) Stats() []ParserStats {
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stats := make([]ParserStats, 0, len(l.stats))
+	for _, languageStats := range l.stats {
+		stats = append(stats, *languageStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Language < stats[j].Language })
+	return stats
+}
+
+func (l *ParserLimiter) record(language string, waited bool, waitTime time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stats, found := l.stats[language]
+	if !found {
+		stats = &ParserStats{Language: language, Limit: cap(l.languages[language])}
+		l.stats[language] = stats
+	}
+	stats.Parses++
+	if waited {
+		stats.Waited++
+		stats.WaitTime += waitTime
+	}
+}
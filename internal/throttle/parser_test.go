@@ -0,0 +1,122 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewParserLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		global      int
+		perLanguage map[string]int
+		wantNil     bool
+	}{
+		{name: "it should not limit without limits", wantNil: true},
+		{name: "it should ignore the limits which are not positive", global: -1, perLanguage: map[string]int{"go": 0}, wantNil: true},
+		{name: "it should limit with a global limit", global: 2},
+		{name: "it should limit with a language limit", perLanguage: map[string]int{"go": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			global, perLanguage := tt.global, tt.perLanguage
+
+			// WHEN
+			limiter := NewParserLimiter(global, perLanguage)
+
+			// THEN
+			assert.Equal(t, tt.wantNil, limiter == nil)
+		})
+	}
+}
+
+func TestParserLimiter_Acquire(t *testing.T) {
+	t.Run("it should not limit with a nil limiter", func(t *testing.T) {
+		// GIVEN
+		var limiter *ParserLimiter
+
+		// WHEN
+		release, err := limiter.Acquire(context.Background(), "go")
+
+		// THEN
+		require.NoError(t, err)
+		release()
+		assert.Nil(t, limiter.Stats())
+	})
+
+	t.Run("it should wait for a parse of the language to complete", func(t *testing.T) {
+		// GIVEN
+		limiter := NewParserLimiter(0, map[string]int{"go": 1})
+		release, err := limiter.Acquire(context.Background(), "go")
+		require.NoError(t, err)
+		time.AfterFunc(20*time.Millisecond, release)
+
+		// WHEN
+		second, err := limiter.Acquire(context.Background(), "go")
+
+		// THEN
+		require.NoError(t, err)
+		second()
+		stats := limiter.Stats()
+		require.Len(t, stats, 1)
+		assert.Equal(t, "go", stats[0].Language)
+		assert.Equal(t, 1, stats[0].Limit)
+		assert.Equal(t, int64(2), stats[0].Parses)
+		assert.Equal(t, int64(1), stats[0].Waited)
+		assert.GreaterOrEqual(t, stats[0].WaitTime, 10*time.Millisecond)
+	})
+
+	t.Run("it should not limit the other languages", func(t *testing.T) {
+		// GIVEN
+		limiter := NewParserLimiter(0, map[string]int{"go": 1})
+		_, err := limiter.Acquire(context.Background(), "go")
+		require.NoError(t, err)
+
+		// WHEN
+		release, err := limiter.Acquire(context.Background(), "python")
+
+		// THEN
+		require.NoError(t, err)
+		release()
+		stats := limiter.Stats()
+		require.Len(t, stats, 2)
+		assert.Equal(t, "python", stats[1].Language)
+		assert.Equal(t, int64(0), stats[1].Waited)
+	})
+
+	t.Run("it should share the global limit between the languages", func(t *testing.T) {
+		// GIVEN
+		limiter := NewParserLimiter(1, nil)
+		_, err := limiter.Acquire(context.Background(), "go")
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// WHEN
+		_, err = limiter.Acquire(ctx, "python")
+
+		// THEN
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("it should release a slot only once", func(t *testing.T) {
+		// GIVEN
+		limiter := NewParserLimiter(2, nil)
+		release, err := limiter.Acquire(context.Background(), "go")
+		require.NoError(t, err)
+		_, err = limiter.Acquire(context.Background(), "go")
+		require.NoError(t, err)
+
+		// WHEN
+		release()
+		release()
+
+		// THEN
+		assert.Len(t, limiter.global, 1)
+	})
+}
@@ -0,0 +1,102 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadLimiter paces file reads to a maximum number of bytes per second, it is safe to share between workers
+type ReadLimiter struct {
+	bytesPerSecond int64
+
+	lock sync.Mutex
+	next time.Time
+}
+
+var rateUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"gb", 1 << 30},
+	{"g", 1 << 30},
+	{"mb", 1 << 20},
+	{"m", 1 << 20},
+	{"kb", 1 << 10},
+	{"k", 1 << 10},
+	{"b", 1},
+}
+
+// NewReadLimiter creates a limiter allowing bytesPerSecond, a nil limiter (no limit) is returned if it is not positive
+func NewReadLimiter(bytesPerSecond int64) *ReadLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &ReadLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// ParseRate parses a rate like 512K, 10MB or 1g/s to a number of bytes per second, units are powers of 1024
+func ParseRate(value string) (int64, error) {
+	normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "/s")
+	multiplier := int64(1)
+	for _, unit := range rateUnits {
+		if strings.HasSuffix(normalized, unit.suffix) {
+			normalized = strings.TrimSuffix(normalized, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimSpace(normalized), 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected a size per second like 512K or 10MB", value)
+	}
+	return int64(amount * float64(multiplier)), nil
+}
+
+// Wait blocks until n bytes can be read without exceeding the rate
+func (l *ReadLimiter) Wait(ctx context.Context, n int64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.lock.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(time.Duration(float64(n) / float64(l.bytesPerSecond) * float64(time.Second)))
+	l.lock.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ReadFile reads the whole file, waiting for the limiter to allow it
+func (l *ReadLimiter) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	if l != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.Wait(ctx, info.Size()); err != nil {
+			return nil, err
+		}
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,42 @@
+package throttle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "it should parse a number of bytes", value: "2048", want: 2048},
+		{name: "it should parse kilobytes", value: "512K", want: 512 * 1024},
+		{name: "it should parse megabytes with a two letters unit", value: "10MB", want: 10 * 1024 * 1024},
+		{name: "it should parse a per second suffix", value: "1g/s", want: 1024 * 1024 * 1024},
+		{name: "it should parse a fractional amount", value: "1.5M", want: 1536 * 1024},
+		{name: "it should reject an unknown unit", value: "10TB", wantErr: true},
+		{name: "it should reject a negative rate", value: "-1M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			value := tt.value
+
+			// WHEN
+			got, err := ParseRate(value)
+
+			// THEN
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
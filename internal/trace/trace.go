@@ -0,0 +1,89 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Frame is a location of a stack trace
+	Frame struct {
+		FilePath string
+		Line     int
+		// Function is the function of the frame, empty if the trace does not tell it
+		Function string
+	}
+)
+
+var (
+	// File "/src/app/tax.py", line 42, in calculate_tax
+	pythonFrame = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+)(?:, in (.+))?$`)
+	// Traceback (most recent call last):
+	pythonTraceback = regexp.MustCompile(`^\s*Traceback \(most recent call last\):`)
+	// \t/src/app/tax.go:42 +0x1d, the function being on the previous line
+	goFrame = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(?:\s+\+0x[0-9a-f]+)?$`)
+	// main.(*Invoice).Total(...)
+	goFunction = regexp.MustCompile(`^(\S+)\(.*\)$`)
+	// at calculateTax (/src/app/tax.js:42:7) or at /src/app/tax.js:42:7
+	jsFrame = regexp.MustCompile(`^\s*at (?:(.+?) \()?(?:file://)?([^()\s]+):(\d+):\d+\)?$`)
+)
+
+// Parse extracts the frames of the stack traces of Python, Go, and JavaScript found in the text, the innermost frame
+// of each trace first, the lines which are not frames are ignored
+func Parse(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+	// python prints the innermost frame last, the frames of a traceback are reversed once it ends
+	var traceback []Frame
+	flushTraceback := func() {
+		slices.Reverse(traceback)
+		frames = append(frames, traceback...)
+		traceback = nil
+	}
+
+	previous := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case pythonTraceback.MatchString(line):
+			flushTraceback()
+		case pythonFrame.MatchString(line):
+			match := pythonFrame.FindStringSubmatch(line)
+			traceback = append(traceback, newFrame(match[1], match[2], match[3]))
+		case goFrame.MatchString(line):
+			match := goFrame.FindStringSubmatch(line)
+			function := ""
+			if fn := goFunction.FindStringSubmatch(strings.TrimSpace(previous)); fn != nil {
+				function = fn[1]
+			}
+			frames = append(frames, newFrame(match[1], match[2], function))
+		case jsFrame.MatchString(line):
+			match := jsFrame.FindStringSubmatch(line)
+			frames = append(frames, newFrame(match[2], match[3], match[1]))
+		}
+		previous = line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stack trace: %w", err)
+	}
+	flushTraceback()
+	return frames, nil
+}
+
+func (f Frame) String() string {
+	if f.Function == "" {
+		return fmt.Sprintf("%s:%d", f.FilePath, f.Line)
+	}
+	return fmt.Sprintf("%s (%s:%d)", f.Function, f.FilePath, f.Line)
+}
+
+func newFrame(filePath string, line string, function string) Frame {
+	// the line is a number, checked by the expression
+	number, _ := strconv.Atoi(line)
+	return Frame{FilePath: filePath, Line: number, Function: strings.TrimSpace(function)}
+}
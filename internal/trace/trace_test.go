@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace string
+		want  []Frame
+	}{
+		{
+			name: "it should parse a python traceback, innermost frame first",
+			trace: `Traceback (most recent call last):
+  File "/src/app/main.py", line 12, in <module>
+    main()
+  File "/src/app/billing/tax.py", line 42, in calculate_tax
+    return income / rate
+ZeroDivisionError: division by zero`,
+			want: []Frame{
+				{FilePath: "/src/app/billing/tax.py", Line: 42, Function: "calculate_tax"},
+				{FilePath: "/src/app/main.py", Line: 12, Function: "<module>"},
+			},
+		},
+		{
+			name: "it should parse a go panic, with the functions of the frames",
+			trace: `panic: runtime error: integer divide by zero
+
+goroutine 1 [running]:
+main.(*Invoice).Total(...)
+	/src/app/invoice.go:42
+main.main()
+	/src/app/main.go:12 +0x1d
+exit status 2`,
+			want: []Frame{
+				{FilePath: "/src/app/invoice.go", Line: 42, Function: "main.(*Invoice).Total"},
+				{FilePath: "/src/app/main.go", Line: 12, Function: "main.main"},
+			},
+		},
+		{
+			name: "it should parse a javascript stack, with or without function",
+			trace: `TypeError: Cannot read properties of undefined (reading 'rate')
+    at calculateTax (/src/app/tax.js:42:17)
+    at file:///src/app/main.mjs:12:3
+    at Module._compile (node:internal/modules/cjs/loader:1256:14)`,
+			want: []Frame{
+				{FilePath: "/src/app/tax.js", Line: 42, Function: "calculateTax"},
+				{FilePath: "/src/app/main.mjs", Line: 12},
+				{FilePath: "node:internal/modules/cjs/loader", Line: 1256, Function: "Module._compile"},
+			},
+		},
+		{
+			name:  "it should find no frame in plain text",
+			trace: "something went wrong: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// WHEN
+			frames, err := Parse(strings.NewReader(tt.trace))
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, frames)
+		})
+	}
+}
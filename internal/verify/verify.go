@@ -0,0 +1,154 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+)
+
+type (
+	// Kind of inconsistency between the manifest, the store, and the filesystem
+	Kind string
+
+	// Issue is an inconsistency found by Verify
+	Issue struct {
+		Kind Kind
+		// Path of the file in the manifest, empty if the chunk belongs to no indexed file
+		Path    string
+		ChunkId string
+		Detail  string
+	}
+)
+
+const (
+	// MissingChunk is a chunk recorded in the manifest, but absent from the store
+	MissingChunk Kind = "missing chunk"
+	// OrphanChunk is a chunk of the store, recorded for no indexed file
+	OrphanChunk Kind = "orphan chunk"
+	// DeletedFile is an indexed file which no longer exists
+	DeletedFile Kind = "deleted file"
+	// HashMismatch is an indexed file whose content changed since it was indexed
+	HashMismatch Kind = "hash mismatch"
+	// DimensionMismatch is a chunk whose embedding does not have the dimensions of the store
+	DimensionMismatch Kind = "dimension mismatch"
+)
+
+func (i Issue) String() string {
+	subject := i.Path
+	if i.ChunkId != "" {
+		subject = i.ChunkId
+	}
+	if i.Detail == "" {
+		return fmt.Sprintf("%s: %s", i.Kind, subject)
+	}
+	return fmt.Sprintf("%s: %s (%s)", i.Kind, subject, i.Detail)
+}
+
+// Verify cross-checks the manifest against the records of the store and the indexed files
+func Verify(vectorStore store.InspectableStore, indexManifest *manifest.Manifest) ([]Issue, error) {
+	stats, err := vectorStore.Stats()
+	if err != nil {
+		return nil, err
+	}
+	records, err := vectorStore.Peek(0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the records of the store: %w", err)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Id < records[j].Id
+	})
+
+	stored := make(map[string]bool, len(records))
+	for _, record := range records {
+		stored[record.Id] = true
+	}
+
+	var issues []Issue
+	owners := make(map[string]string)
+	for _, path := range indexManifest.Paths() {
+		entry, _ := indexManifest.Get(path)
+		for _, id := range entry.ChunkIds {
+			owners[id] = path
+			if !stored[id] {
+				issues = append(issues, Issue{Kind: MissingChunk, Path: path, ChunkId: id})
+			}
+		}
+
+		issue, err := checkFile(path, entry)
+		if err != nil {
+			return nil, err
+		}
+		if issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+
+	for _, record := range records {
+		path, owned := owners[record.Id]
+		if !owned {
+			filePath, _ := record.Metadata["file_path"].(string)
+			issues = append(issues, Issue{Kind: OrphanChunk, ChunkId: record.Id, Detail: filePath})
+			continue
+		}
+		if len(record.Embedding) != stats.Dimensions {
+			issues = append(issues, Issue{
+				Kind:    DimensionMismatch,
+				Path:    path,
+				ChunkId: record.Id,
+				Detail:  fmt.Sprintf("%d instead of %d", len(record.Embedding), stats.Dimensions),
+			})
+		}
+	}
+	return issues, nil
+}
+
+func checkFile(path string, entry manifest.Entry) (*Issue, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Issue{Kind: DeletedFile, Path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if manifest.Hash(content) != entry.Hash {
+		return &Issue{Kind: HashMismatch, Path: path}, nil
+	}
+	return nil, nil
+}
+
+// Repair fixes the issues: the chunks of the inconsistent files are deleted, and the files are removed from the
+// manifest, so the next indexing run indexes them again, orphan chunks are deleted
+func Repair(vectorStore store.InspectableStore, indexManifest *manifest.Manifest, issues []Issue) error {
+	var orphans []string
+	dropped := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.Path == "" {
+			orphans = append(orphans, issue.ChunkId)
+			continue
+		}
+		if dropped[issue.Path] {
+			continue
+		}
+		entry, found := indexManifest.Get(issue.Path)
+		if !found {
+			continue
+		}
+		if err := vectorStore.DeleteByFile(entry.FilePath); err != nil {
+			return fmt.Errorf("failed to delete chunks of %s: %w", entry.FilePath, err)
+		}
+		indexManifest.Remove(issue.Path)
+		dropped[issue.Path] = true
+	}
+
+	if len(orphans) > 0 {
+		if err := vectorStore.Delete(orphans); err != nil {
+			return fmt.Errorf("failed to delete orphan chunks: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/a-peyrard/mm/internal/code"
+	"github.com/a-peyrard/mm/internal/manifest"
+	"github.com/a-peyrard/mm/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const taxContent = "def calculate_tax(income):"
+
+// newTestIndex indexes a single file, tax.py, with one chunk
+func newTestIndex(t *testing.T) (*store.Local, *manifest.Manifest, string) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tax.py")
+	require.NoError(t, os.WriteFile(path, []byte(taxContent), 0644))
+
+	vectorStore, err := store.OpenLocal(filepath.Join(dir, "store.gob"))
+	require.NoError(t, err)
+	records, err := store.NewRecords(
+		[]code.Chunk{{
+			Id:       "tax.py_calculate_tax_1",
+			Content:  taxContent,
+			Metadata: code.ChunkMetadata{FilePath: path, Language: "python"},
+		}},
+		[][]float32{{1, 0}},
+	)
+	require.NoError(t, err)
+	require.NoError(t, vectorStore.Upsert(records))
+
+	indexManifest, err := manifest.Load(filepath.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	indexManifest.Put(path, manifest.Entry{
+		FilePath: path,
+		Hash:     manifest.Hash([]byte(taxContent)),
+		ChunkIds: []string{"tax.py_calculate_tax_1"},
+	})
+	return vectorStore, indexManifest, path
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		corrupt    func(t *testing.T, vectorStore *store.Local, indexManifest *manifest.Manifest, path string)
+		wantIssues func(path string) []Issue
+	}{
+		{
+			name:       "it should find no issue in a consistent index",
+			corrupt:    func(*testing.T, *store.Local, *manifest.Manifest, string) {},
+			wantIssues: func(string) []Issue { return nil },
+		},
+		{
+			name: "it should report the chunks missing from the store",
+			corrupt: func(t *testing.T, vectorStore *store.Local, _ *manifest.Manifest, _ string) {
+				require.NoError(t, vectorStore.Delete([]string{"tax.py_calculate_tax_1"}))
+			},
+			wantIssues: func(path string) []Issue {
+				return []Issue{{Kind: MissingChunk, Path: path, ChunkId: "tax.py_calculate_tax_1"}}
+			},
+		},
+		{
+			name: "it should report the chunks of no indexed file",
+			corrupt: func(t *testing.T, vectorStore *store.Local, _ *manifest.Manifest, _ string) {
+				require.NoError(t, vectorStore.Upsert([]store.Record{{
+					Id:        "old.py_legacy_1",
+					Embedding: []float32{0, 1},
+					Metadata:  map[string]any{"file_path": "old.py"},
+				}}))
+			},
+			wantIssues: func(string) []Issue {
+				return []Issue{{Kind: OrphanChunk, ChunkId: "old.py_legacy_1", Detail: "old.py"}}
+			},
+		},
+		{
+			name: "it should report the deleted files",
+			corrupt: func(t *testing.T, _ *store.Local, _ *manifest.Manifest, path string) {
+				require.NoError(t, os.Remove(path))
+			},
+			wantIssues: func(path string) []Issue {
+				return []Issue{{Kind: DeletedFile, Path: path}}
+			},
+		},
+		{
+			name: "it should report the files changed since they were indexed",
+			corrupt: func(t *testing.T, _ *store.Local, _ *manifest.Manifest, path string) {
+				require.NoError(t, os.WriteFile(path, []byte("def calculate_vat(price):"), 0644))
+			},
+			wantIssues: func(path string) []Issue {
+				return []Issue{{Kind: HashMismatch, Path: path}}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN
+			vectorStore, indexManifest, path := newTestIndex(t)
+			tt.corrupt(t, vectorStore, indexManifest, path)
+
+			// WHEN
+			issues, err := Verify(vectorStore, indexManifest)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIssues(path), issues)
+		})
+	}
+}
+
+func TestRepair(t *testing.T) {
+	// GIVEN
+	vectorStore, indexManifest, path := newTestIndex(t)
+	require.NoError(t, vectorStore.Upsert([]store.Record{{
+		Id:        "old.py_legacy_1",
+		Embedding: []float32{0, 1},
+		Metadata:  map[string]any{"file_path": "old.py"},
+	}}))
+	require.NoError(t, os.Remove(path))
+	issues, err := Verify(vectorStore, indexManifest)
+	require.NoError(t, err)
+
+	// WHEN
+	err = Repair(vectorStore, indexManifest, issues)
+
+	// THEN
+	require.NoError(t, err)
+	issues, err = Verify(vectorStore, indexManifest)
+	require.NoError(t, err)
+	assert.Empty(t, issues, "it should leave a consistent index")
+	stats, err := vectorStore.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Records)
+}
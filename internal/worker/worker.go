@@ -4,7 +4,10 @@ import (
 	"context"
 	"github.com/rs/zerolog"
 	"log"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 )
 
 type (
@@ -126,3 +129,15 @@ func (g Group[P]) WaitAndClose() error {
 
 	return nil
 }
+
+// Interruptible returns a context canceled once the process is interrupted (SIGINT or SIGTERM), to stop submitting
+// work while the work in flight completes, the default handling is restored then, so a second interruption kills the
+// process, the returned function stops listening to the interruptions
+func Interruptible(ctx context.Context) (context.Context, func()) {
+	interrupted, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupted.Done()
+		stop()
+	}()
+	return interrupted, stop
+}
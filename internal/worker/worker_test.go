@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowWorker takes some time to handle each parameter, like a worker embedding the chunks of a file
+type slowWorker struct {
+	handled *atomic.Int32
+	closed  *atomic.Int32
+}
+
+func (w slowWorker) WaitReady(context.Context) error {
+	return nil
+}
+
+func (w slowWorker) Handle(context.Context, int) error {
+	time.Sleep(20 * time.Millisecond)
+	w.handled.Add(1)
+	return nil
+}
+
+func (w slowWorker) WaitAndClose() error {
+	w.closed.Add(1)
+	return nil
+}
+
+func TestInterruptible(t *testing.T) {
+	// GIVEN
+	var handled, closed atomic.Int32
+	group, err := NewGroup(context.Background(), 2, func(context.Context, int) (Worker[int], error) {
+		return slowWorker{handled: &handled, closed: &closed}, nil
+	})
+	require.NoError(t, err)
+	intake, stop := Interruptible(context.Background())
+	defer stop()
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+
+	// WHEN
+	submitted := 0
+	for i := 0; i < 100 && intake.Err() == nil; i++ {
+		require.NoError(t, group.Submit(i))
+		submitted++
+		if submitted == 3 {
+			// the work submitted is still being handled
+			require.NoError(t, process.Signal(os.Interrupt))
+			<-intake.Done()
+		}
+	}
+	require.NoError(t, group.WaitAndClose())
+
+	// THEN
+	assert.Equal(t, 3, submitted, "it should stop the intake once interrupted")
+	assert.Equal(t, int32(3), handled.Load(), "it should complete the work in flight")
+	assert.Equal(t, int32(2), closed.Load(), "it should close the workers")
+}